@@ -10,12 +10,25 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/Azure/AKSFlexNode/pkg/cmd/audit"
+	configcmd "github.com/Azure/AKSFlexNode/pkg/cmd/config"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/container"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/ctl"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/doctor"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/egress"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/enroll"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/extension"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/maintenance"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/preflight"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/reset"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/restore"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/standby"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/start"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/token"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/verify"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/version"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
 )
 
 func main() {
@@ -23,12 +36,30 @@ func main() {
 		Use:   "aks-flex-node",
 		Short: "AKS Flex Node Agent",
 		Long:  "Azure Kubernetes Service Flex Node Agent for edge computing scenarios",
+		// Every command takes unset config flags from their AKS_FLEX_NODE_*
+		// environment variables before its own hooks run.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return settings.Resolve(cmd)
+		},
 	}
+	cobra.EnableTraverseRunHooks = true
 
 	rootCmd.AddCommand(start.NewCommand())
+	rootCmd.AddCommand(enroll.NewCommand())
 	rootCmd.AddCommand(preflight.NewCommand())
 	rootCmd.AddCommand(daemon.NewCommand())
+	rootCmd.AddCommand(container.NewCommand())
+	rootCmd.AddCommand(doctor.NewCommand())
+	rootCmd.AddCommand(egress.NewCommand())
 	rootCmd.AddCommand(reset.NewCommand())
+	rootCmd.AddCommand(restore.NewCommand())
+	rootCmd.AddCommand(audit.NewCommand())
+	rootCmd.AddCommand(ctl.NewCommand())
+	rootCmd.AddCommand(configcmd.NewCommand())
+	rootCmd.AddCommand(maintenance.NewCommand())
+	rootCmd.AddCommand(standby.NewCommand())
+	rootCmd.AddCommand(verify.NewCommand())
+	rootCmd.AddCommand(extension.NewCommand())
 	rootCmd.AddCommand(version.NewCommand())
 	rootCmd.AddCommand(token.Command)
 
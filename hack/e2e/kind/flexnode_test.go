@@ -0,0 +1,377 @@
+//go:build e2e
+
+package kind
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// TestFlexNode joins the flex node container to the kind cluster and checks
+// that it registers and runs pods, that a new machine goal repaves it onto
+// its other nspawn machine, and that deleting the goal resets the host.
+// Each step needs the previous one, so the first failure ends the run.
+func TestFlexNode(t *testing.T) {
+	h := newHarness(t)
+	h.ensureBinary(t)
+	h.clusterUp(t)
+	if !h.cfg.skipCleanup {
+		t.Cleanup(func() { h.down(t) })
+	}
+	t.Cleanup(func() { h.collectLogs(t) })
+	h.controllerUp(t)
+	h.nodeUp(t)
+
+	for _, step := range []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"join", h.join},
+		{"validate", h.validate},
+		{"repave", h.repave},
+		{"unjoin", h.unjoin},
+	} {
+		if !t.Run(step.name, step.run) {
+			return
+		}
+	}
+}
+
+// join issues a bootstrap token, publishes the machine goal, and bootstraps
+// the node with the agent binary under test.
+func (h *harness) join(t *testing.T) {
+	version := h.clusterVersion(t)
+	configFile := filepath.Join(h.cfg.workDir, "config-kind.json")
+	agentConfig := map[string]any{
+		"azure": map[string]any{
+			"subscriptionId":      "00000000-0000-0000-0000-000000000000",
+			"targetAgentPoolName": h.cfg.agentPool,
+			"bootstrapToken":      map[string]string{"token": h.bootstrapToken(t)},
+			"arc":                 map[string]bool{"enabled": false},
+			"targetCluster":       map[string]string{"resourceId": h.clusterID, "location": "kind"},
+		},
+		"node": map[string]any{"kubelet": map[string]string{
+			"clusterFQDN": h.cfg.clusterName + "-control-plane:6443",
+			"caCertData":  h.clusterCA(t),
+			"nodeIP":      h.nodeIP,
+		}},
+		"networking": map[string]string{"dnsServiceIP": h.cfg.dnsServiceIP},
+		"agent": map[string]any{
+			"logLevel":                   "debug",
+			"logDir":                     "/var/log/aks-flex-node",
+			"machineClient":              map[string]string{"mode": "in-cluster", "endpointUrl": controllerProxyPath},
+			"requireMachineRegistration": true,
+		},
+		"components": map[string]string{"kubernetes": version, "containerd": h.cfg.containerdVersion, "runc": h.cfg.runcVersion},
+	}
+	data, err := json.MarshalIndent(agentConfig, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h.upsertMachine(t, version, version)
+	node := h.cfg.nodeName
+	h.run(t, nil, "docker", "cp", h.cfg.binary, node+":/tmp/aks-flex-node-binary")
+	h.run(t, nil, "docker", "cp", configFile, node+":/tmp/config.json")
+	h.run(t, nil, "docker", "cp", filepath.Join(h.repoRoot, "scripts", "install.sh"), node+":/tmp/aks-flex-node-install.sh")
+	h.onNode(t, fmt.Sprintf(`set -euo pipefail
+AKS_FLEX_NODE_LOCAL_BINARY=/tmp/aks-flex-node-binary AKS_FLEX_NODE_VERSION=e2e-local SKIP_AZCLI=true \
+  bash /tmp/aks-flex-node-install.sh --yes
+cp /tmp/config.json /etc/aks-flex-node/
+aks-flex-node preflight --config /etc/aks-flex-node/config.json --output text
+systemctl stop %[1]s 2>/dev/null || true
+systemctl reset-failed %[1]s 2>/dev/null || true
+systemd-run --unit=%[1]s --description="AKS Flex Node E2E (%[1]s)" --remain-after-exit \
+  /usr/local/bin/aks-flex-node bootstrap --config /etc/aks-flex-node/config.json
+`, bootstrapUnit))
+
+	poll(t, h.cfg.joinTimeout, agentUnit+" to start", func(ctx context.Context) (bool, error) {
+		out, _ := h.tryOnNode(ctx, fmt.Sprintf(`if systemctl is-failed --quiet %s; then echo failed; elif systemctl is-active --quiet %s; then echo active; fi`, bootstrapUnit, agentUnit))
+		switch strings.TrimSpace(out) {
+		case "failed":
+			journal, _ := h.tryOnNode(ctx, "journalctl -u "+bootstrapUnit+" -n 50 --no-pager")
+			return false, fmt.Errorf("bootstrap unit failed:\n%s", journal)
+		case "active":
+			return true, nil
+		}
+		return false, nil
+	})
+	if out, err := h.tryOnNode(t.Context(), "systemctl is-enabled "+agentUnit); err != nil {
+		t.Fatalf("%s is not enabled: %s", agentUnit, out)
+	}
+}
+
+// validate checks that the node is Ready with the container's IP, that
+// node-problem-detector reports, and that a pod runs on it.
+func (h *harness) validate(t *testing.T) {
+	h.waitNodeReady(t)
+	node, err := h.kube.CoreV1().Nodes().Get(t.Context(), h.cfg.nodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(node.Status.Addresses, func(a corev1.NodeAddress) bool {
+		return a.Type == corev1.NodeInternalIP && a.Address == h.nodeIP
+	}) {
+		t.Fatalf("node InternalIP = %v, want %s", node.Status.Addresses, h.nodeIP)
+	}
+
+	poll(t, h.cfg.joinTimeout, "node-problem-detector in the active machine", func(ctx context.Context) (bool, error) {
+		state, err := h.daemonState(ctx)
+		if err != nil || state.ActiveMachine == "" {
+			return false, nil
+		}
+		out, _ := h.tryOnNode(ctx, "systemd-run --machine="+state.ActiveMachine+" --quiet --pipe systemctl is-active node-problem-detector.service")
+		return strings.TrimSpace(out) == "active", nil
+	})
+	poll(t, h.cfg.joinTimeout, "node-problem-detector to report KernelDeadlock=False", func(ctx context.Context) (bool, error) {
+		node, err := h.kube.CoreV1().Nodes().Get(ctx, h.cfg.nodeName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return conditionStatus(node, "KernelDeadlock") == corev1.ConditionFalse, nil
+	})
+
+	h.smokeTest(t, "kind")
+}
+
+// repave publishes a new settings version and checks that the agent moves
+// the node to its other nspawn machine.
+func (h *harness) repave(t *testing.T) {
+	version := h.clusterVersion(t)
+	settingsVersion := fmt.Sprintf("repave-kind-%d", time.Now().Unix())
+	before, err := h.daemonState(t.Context())
+	if err != nil || before.ActiveMachine == "" {
+		t.Fatalf("read active machine before repave: %+v, %v", before, err)
+	}
+	node, err := h.kube.CoreV1().Nodes().Get(t.Context(), h.cfg.nodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldUID := node.UID
+
+	h.upsertMachine(t, version, settingsVersion)
+	// Deleting the Node makes the agent re-register it from the new machine.
+	if err := h.kube.CoreV1().Nodes().Delete(t.Context(), h.cfg.nodeName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+
+	poll(t, h.cfg.repaveTimeout, "the repave onto the other machine", func(ctx context.Context) (bool, error) {
+		state, err := h.daemonState(ctx)
+		if err != nil || state.ActiveMachine == "" || state.ActiveMachine == before.ActiveMachine || state.AppliedSettingsVersion != settingsVersion {
+			return false, nil
+		}
+		machineState, _ := h.tryOnNode(ctx, "machinectl show "+state.ActiveMachine+" --property=State --value")
+		if strings.TrimSpace(machineState) != "running" {
+			return false, nil
+		}
+		node, err := h.kube.CoreV1().Nodes().Get(ctx, h.cfg.nodeName, metav1.GetOptions{})
+		if err != nil || node.UID == oldUID {
+			return false, nil
+		}
+		return conditionStatus(node, corev1.NodeReady) == corev1.ConditionTrue &&
+			majorMinor(node.Status.NodeInfo.KubeletVersion) == majorMinor(version), nil
+	})
+	h.smokeTest(t, "kind-repave")
+}
+
+// unjoin deletes the machine goal, taints the node like the AKS RP, and
+// checks that the agent resets the host and the node leaves the cluster.
+func (h *harness) unjoin(t *testing.T) {
+	h.deleteMachine(t)
+	nodes := h.kube.CoreV1().Nodes()
+	node, err := nodes.Get(t.Context(), h.cfg.nodeName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		t.Logf("node %s is already absent; skipping the deletion taint", h.cfg.nodeName)
+	case err != nil:
+		t.Fatal(err)
+	default:
+		node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{Key: deletingTaint, Value: "true", Effect: corev1.TaintEffectNoSchedule})
+		if _, err := nodes.Update(t.Context(), node, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("taint node: %v", err)
+		}
+	}
+
+	poll(t, h.cfg.joinTimeout, "the agent to uninstall itself", func(ctx context.Context) (bool, error) {
+		out, _ := h.tryOnNode(ctx, "systemctl list-unit-files "+agentUnit+" --no-legend")
+		return strings.TrimSpace(out) == "", nil
+	})
+	out := h.onNode(t, `set -u
+for machine in kube1 kube2; do
+  machinectl show "$machine" >/dev/null 2>&1 && echo "nspawn machine $machine still exists"
+done
+for iface in cni0 geneve0 vxlan0 ipip0 unbounded0 cbr0; do
+  [ -e "/sys/class/net/$iface" ] && echo "interface $iface still exists"
+done
+for path in /etc/aks-flex-node /var/log/aks-flex-node; do
+  [ -e "$path" ] && echo "runtime path $path still exists"
+done
+true
+`)
+	if leftovers := strings.TrimSpace(out); leftovers != "" {
+		t.Fatalf("reset left state behind:\n%s", leftovers)
+	}
+
+	if err := nodes.Delete(t.Context(), h.cfg.nodeName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+	poll(t, h.cfg.joinTimeout, "the node to leave the cluster", func(ctx context.Context) (bool, error) {
+		_, err := nodes.Get(ctx, h.cfg.nodeName, metav1.GetOptions{})
+		return apierrors.IsNotFound(err), nil
+	})
+}
+
+// smokeTest runs a pod on the flex node and waits for it to be Ready.
+func (h *harness) smokeTest(t *testing.T, label string) {
+	t.Helper()
+	pods := h.kube.CoreV1().Pods(metav1.NamespaceDefault)
+	name := "e2e-smoke-" + label
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{corev1.LabelHostname: h.cfg.nodeName},
+			Tolerations:  []corev1.Toleration{{Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+			Containers: []corev1.Container{{
+				Name:  "nginx",
+				Image: "nginx:alpine",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi"), corev1.ResourceCPU: resource.MustParse("100m")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi"), corev1.ResourceCPU: resource.MustParse("200m")},
+				},
+			}},
+		},
+	}
+	if _, err := pods.Create(t.Context(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create pod %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		_ = pods.Delete(context.WithoutCancel(t.Context()), name, metav1.DeleteOptions{})
+	})
+	poll(t, h.cfg.podReadyTimeout, "pod "+name+" to be Ready", func(ctx context.Context) (bool, error) {
+		pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return slices.ContainsFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool {
+			return c.Type == corev1.PodReady && c.Status == corev1.ConditionTrue
+		}), nil
+	})
+}
+
+func (h *harness) waitNodeReady(t *testing.T) {
+	t.Helper()
+	poll(t, h.cfg.joinTimeout, "node "+h.cfg.nodeName+" to be Ready", func(ctx context.Context) (bool, error) {
+		node, err := h.kube.CoreV1().Nodes().Get(ctx, h.cfg.nodeName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return conditionStatus(node, corev1.NodeReady) == corev1.ConditionTrue, nil
+	})
+}
+
+// bootstrapToken creates a bootstrap token in the group the node RBAC binds.
+func (h *harness) bootstrapToken(t *testing.T) string {
+	t.Helper()
+	id, secret := randomHex(t, 3), randomHex(t, 8)
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bootstrap-token-" + id, Namespace: metav1.NamespaceSystem},
+		Type:       corev1.SecretTypeBootstrapToken,
+		StringData: map[string]string{
+			"description":                    "AKS Flex Node kind E2E bootstrap token",
+			"token-id":                       id,
+			"token-secret":                   secret,
+			"expiration":                     time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+			"usage-bootstrap-authentication": "true",
+			"usage-bootstrap-signing":        "true",
+			"auth-extra-groups":              bootstrapGroup,
+		},
+	}
+	if _, err := h.kube.CoreV1().Secrets(metav1.NamespaceSystem).Create(t.Context(), token, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create bootstrap token: %v", err)
+	}
+	return id + "." + secret
+}
+
+// clusterCA returns the base64 cluster CA from the kind kubeconfig.
+func (h *harness) clusterCA(t *testing.T) string {
+	t.Helper()
+	restConfig, err := clientcmd.BuildConfigFromFlags("", h.kubeconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(restConfig.CAData)
+}
+
+// clusterVersion returns the control plane's Kubernetes version without the
+// leading v.
+func (h *harness) clusterVersion(t *testing.T) string {
+	t.Helper()
+	info, err := h.kube.Discovery().ServerVersion()
+	if err != nil {
+		t.Fatalf("get server version: %v", err)
+	}
+	return strings.TrimPrefix(info.GitVersion, "v")
+}
+
+// agentState is the part of the agent's daemon state the test reads.
+type agentState struct {
+	ActiveMachine          string `json:"activeMachine"`
+	AppliedSettingsVersion string `json:"appliedSettingsVersion"`
+}
+
+func (h *harness) daemonState(ctx context.Context) (agentState, error) {
+	var state agentState
+	out, err := h.try(ctx, nil, "docker", "exec", h.cfg.nodeName, "cat", daemonState)
+	if err != nil {
+		return state, fmt.Errorf("read %s: %w: %s", daemonState, err, out)
+	}
+	if err := json.Unmarshal([]byte(out), &state); err != nil {
+		return state, fmt.Errorf("decode %s: %w", daemonState, err)
+	}
+	return state, nil
+}
+
+func conditionStatus(node *corev1.Node, conditionType corev1.NodeConditionType) corev1.ConditionStatus {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status
+		}
+	}
+	return corev1.ConditionUnknown
+}
+
+func majorMinor(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+func randomHex(t *testing.T, n int) string {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
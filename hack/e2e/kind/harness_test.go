@@ -0,0 +1,453 @@
+//go:build e2e
+
+// Package kind runs the bootstrap-token flow of AKS Flex Node end to end
+// without Azure. A kind cluster is the control plane, the in-cluster
+// aks-flex-controller serves the machine goal in place of the AKS RP, and the
+// flex node is a privileged systemd container on the kind Docker network.
+//
+// Run it with `make e2e-kind` or `go test -tags e2e ./hack/e2e/kind/`.
+package kind
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	nodeHostImage  = "aks-flex-node-e2e-host:local"
+	bootstrapGroup = "system:bootstrappers:aks-flex-node"
+
+	controllerNamespace  = "kube-system"
+	controllerDeployment = "aks-flex-controller"
+	controllerBaseImage  = "ghcr.io/azure/aks-flex-controller"
+	machineConfigMap     = "aks-flex-machines"
+	controllerProxyPath  = "/api/v1/namespaces/" + controllerNamespace + "/services/http:" + controllerDeployment + ":80/proxy"
+
+	agentUnit     = "aks-flex-node-agent.service"
+	bootstrapUnit = "aks-flex-node-kind"
+	daemonState   = "/etc/aks-flex-node/daemon-state.json"
+
+	// deletingTaint is the AKS RP's signal that the machine is being
+	// deleted.
+	deletingTaint = "kubernetes.azure.com/flex-node-deleting"
+
+	// pollInterval is the delay between checks of a condition the test
+	// waits for.
+	pollInterval = 5 * time.Second
+)
+
+// config holds the E2E_* settings of a run.
+type config struct {
+	binary             string
+	controllerImage    string
+	workDir            string
+	skipCleanup        bool
+	containerdVersion  string
+	runcVersion        string
+	agentPool          string
+	clusterName        string
+	kindNodeImage      string
+	nodeName           string
+	dnsServiceIP       string
+	joinTimeout        time.Duration
+	podReadyTimeout    time.Duration
+	repaveTimeout      time.Duration
+	systemdBootTimeout time.Duration
+}
+
+func loadConfig(t *testing.T) config {
+	t.Helper()
+	kubernetesVersion := env("E2E_KUBERNETES_VERSION", "1.35.0")
+	return config{
+		binary:             os.Getenv("E2E_BINARY"),
+		controllerImage:    os.Getenv("E2E_CONTROLLER_IMAGE"),
+		workDir:            env("E2E_WORK_DIR", filepath.Join(os.TempDir(), "aks-flex-node-e2e-kind")),
+		skipCleanup:        os.Getenv("E2E_SKIP_CLEANUP") == "1",
+		containerdVersion:  env("E2E_CONTAINERD_VERSION", "2.0.4"),
+		runcVersion:        env("E2E_RUNC_VERSION", "1.1.12"),
+		agentPool:          env("E2E_TARGET_AGENT_POOL_NAME", "aksflexnodes"),
+		clusterName:        env("E2E_KIND_CLUSTER_NAME", "aks-flex-e2e"),
+		kindNodeImage:      env("E2E_KIND_NODE_IMAGE", "kindest/node:v"+kubernetesVersion),
+		nodeName:           env("E2E_KIND_FLEX_NODE_NAME", "flex-kind-1"),
+		dnsServiceIP:       env("E2E_KIND_DNS_SERVICE_IP", "10.96.0.10"),
+		joinTimeout:        envSeconds(t, "E2E_NODE_JOIN_TIMEOUT", 600),
+		podReadyTimeout:    envSeconds(t, "E2E_POD_READY_TIMEOUT", 180),
+		repaveTimeout:      envSeconds(t, "E2E_DRIFT_UPGRADE_TIMEOUT", 900),
+		systemdBootTimeout: envSeconds(t, "E2E_SSH_WAIT_TIMEOUT", 120),
+	}
+}
+
+func env(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envSeconds(t *testing.T, key string, fallback int) time.Duration {
+	t.Helper()
+	value := os.Getenv(key)
+	if value == "" {
+		return time.Duration(fallback) * time.Second
+	}
+	var seconds int
+	if _, err := fmt.Sscanf(value, "%d", &seconds); err != nil || seconds <= 0 {
+		t.Fatalf("%s must be a positive number of seconds, got %q", key, value)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// harness drives the kind cluster and the flex node container.
+type harness struct {
+	cfg        config
+	repoRoot   string
+	kubeconfig string
+	kube       kubernetes.Interface
+	// clusterID is an AKS-shaped resource ID. It only has to parse; nothing
+	// calls ARM in this mode.
+	clusterID string
+	nodeIP    string
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	for _, tool := range []string{"docker", "go", "kind", "kubectl"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Fatalf("missing required tool %s: %v", tool, err)
+		}
+	}
+	cfg := loadConfig(t)
+	if err := os.MkdirAll(filepath.Join(cfg.workDir, "logs"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.Abs(filepath.Join("..", "..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &harness{
+		cfg:        cfg,
+		repoRoot:   root,
+		kubeconfig: filepath.Join(cfg.workDir, "kubeconfig"),
+		clusterID:  "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/kind/providers/Microsoft.ContainerService/managedClusters/" + cfg.clusterName,
+	}
+}
+
+// run runs a command with the harness kubeconfig, feeding it stdin when set,
+// and fails the test with its output when it fails.
+func (h *harness) run(t *testing.T, stdin io.Reader, name string, args ...string) string {
+	t.Helper()
+	out, err := h.try(t.Context(), stdin, name, args...)
+	if err != nil {
+		t.Fatalf("%s %s: %v\n%s", name, strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+// try runs a command like run and returns its combined output and error.
+func (h *harness) try(ctx context.Context, stdin io.Reader, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...) //#nosec G204 -- fixed tools with harness arguments
+	cmd.Dir = h.repoRoot
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+h.kubeconfig)
+	cmd.Stdin = stdin
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// onNode runs a bash script on the flex node container.
+func (h *harness) onNode(t *testing.T, script string) string {
+	t.Helper()
+	return h.run(t, strings.NewReader(script), "docker", "exec", "-i", h.cfg.nodeName, "bash", "-s")
+}
+
+// tryOnNode runs a bash script on the flex node container and returns its
+// output and error.
+func (h *harness) tryOnNode(ctx context.Context, script string) (string, error) {
+	return h.try(ctx, strings.NewReader(script), "docker", "exec", "-i", h.cfg.nodeName, "bash", "-s")
+}
+
+// poll calls check every pollInterval until it reports done or timeout
+// passes. A check error ends the wait.
+func poll(t *testing.T, timeout time.Duration, what string, check func(ctx context.Context) (bool, error)) {
+	t.Helper()
+	t.Logf("waiting up to %s for %s", timeout, what)
+	if err := wait.PollUntilContextTimeout(t.Context(), pollInterval, timeout, true, check); err != nil {
+		t.Fatalf("waiting for %s: %v", what, err)
+	}
+}
+
+// ensureBinary builds the agent binary unless E2E_BINARY names one.
+func (h *harness) ensureBinary(t *testing.T) {
+	t.Helper()
+	if h.cfg.binary != "" {
+		if _, err := os.Stat(h.cfg.binary); err != nil {
+			t.Fatalf("E2E_BINARY: %v", err)
+		}
+		return
+	}
+	h.cfg.binary = filepath.Join(h.cfg.workDir, "aks-flex-node")
+	commit := strings.TrimSpace(h.run(t, nil, "git", "rev-parse", "--short", "HEAD"))
+	ldflags := fmt.Sprintf("-X github.com/Azure/AKSFlexNode/pkg/version.Version=%s -X github.com/Azure/AKSFlexNode/pkg/version.GitCommit=%s -X github.com/Azure/AKSFlexNode/pkg/version.BuildTime=%s",
+		env("VERSION", "dev"), commit, time.Now().UTC().Format(time.RFC3339))
+	t.Logf("building %s", h.cfg.binary)
+	h.run(t, nil, "env", "GOOS=linux", "GOARCH=amd64", "go", "build", "-ldflags", ldflags, "-o", h.cfg.binary, "./cmd/aks-flex-node")
+}
+
+// clusterUp creates the kind cluster, or reuses it, and applies the
+// bootstrap token RBAC.
+func (h *harness) clusterUp(t *testing.T) {
+	t.Helper()
+	clusters := h.run(t, nil, "kind", "get", "clusters")
+	if containsLine(clusters, h.cfg.clusterName) {
+		t.Logf("reusing kind cluster %s", h.cfg.clusterName)
+		h.run(t, nil, "kind", "export", "kubeconfig", "--name", h.cfg.clusterName, "--kubeconfig", h.kubeconfig)
+	} else {
+		h.run(t, nil, "kind", "create", "cluster",
+			"--name", h.cfg.clusterName,
+			"--image", h.cfg.kindNodeImage,
+			"--kubeconfig", h.kubeconfig,
+			"--wait", "180s")
+	}
+	restConfig, err := clientcmd.BuildConfigFromFlags("", h.kubeconfig)
+	if err != nil {
+		t.Fatalf("load kubeconfig: %v", err)
+	}
+	if h.kube, err = kubernetes.NewForConfig(restConfig); err != nil {
+		t.Fatalf("create kube client: %v", err)
+	}
+	h.run(t, nil, "kubectl", "apply", "-f", filepath.Join(h.repoRoot, "hack", "e2e", "kind", "testdata", "node-rbac.yaml"))
+}
+
+// controllerUp builds the controller image unless E2E_CONTROLLER_IMAGE names
+// one, loads it into kind, and deploys it.
+func (h *harness) controllerUp(t *testing.T) {
+	t.Helper()
+	image := h.cfg.controllerImage
+	if image == "" {
+		commit := strings.TrimSpace(h.run(t, nil, "git", "rev-parse", "--short", "HEAD"))
+		image = "aks-flex-controller:kind-" + commit
+		t.Logf("building %s", image)
+		h.run(t, nil, "docker", "build",
+			"--file", "Dockerfile.aks-flex-controller",
+			"--build-arg", "VERSION="+env("VERSION", "dev"),
+			"--build-arg", "GIT_COMMIT="+commit,
+			"--build-arg", "BUILD_TIME="+time.Now().UTC().Format(time.RFC3339),
+			"--tag", image,
+			".")
+	}
+	h.run(t, nil, "kind", "load", "docker-image", "--name", h.cfg.clusterName, image)
+
+	overlay := filepath.Join(h.cfg.workDir, "controller-deployment")
+	if err := os.RemoveAll(overlay); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(overlay, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	h.run(t, nil, "cp", "-R", filepath.Join(h.repoRoot, "hack", "controller-deployment"), filepath.Join(overlay, "base"))
+	repo, tag, _ := strings.Cut(image, ":")
+	kustomization := fmt.Sprintf(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - base
+images:
+  - name: %[1]s
+    newName: %[2]s
+    newTag: %[3]s
+patches:
+  - target:
+      group: apps
+      version: v1
+      kind: Deployment
+      name: %[4]s
+      namespace: %[5]s
+    patch: |-
+      apiVersion: apps/v1
+      kind: Deployment
+      metadata:
+        name: %[4]s
+        namespace: %[5]s
+      spec:
+        template:
+          spec:
+            containers:
+              - name: aks-flex-controller
+                imagePullPolicy: IfNotPresent
+                args:
+                  - --listen-address=:8080
+                  - --machine-configmap-namespace=%[5]s
+                  - --machine-configmap-name=%[6]s
+                  - --enable-csr-approver=true
+`, controllerBaseImage, repo, tag, controllerDeployment, controllerNamespace, machineConfigMap)
+	if err := os.WriteFile(filepath.Join(overlay, "kustomization.yaml"), []byte(kustomization), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h.run(t, nil, "kubectl", "apply", "-k", overlay)
+	h.run(t, nil, "kubectl", "-n", controllerNamespace, "rollout", "status", "deployment/"+controllerDeployment, "--timeout=300s")
+	poll(t, time.Minute, "the controller health endpoint", func(ctx context.Context) (bool, error) {
+		err := h.kube.CoreV1().RESTClient().Get().AbsPath(controllerProxyPath + "/healthz").Do(ctx).Error()
+		return err == nil, nil
+	})
+}
+
+// nodeUp builds the systemd host image and starts the flex node container
+// on the kind network.
+func (h *harness) nodeUp(t *testing.T) {
+	t.Helper()
+	node := h.cfg.nodeName
+	h.run(t, nil, "docker", "build", "--tag", nodeHostImage, filepath.Join(h.repoRoot, "hack", "e2e", "kind", "testdata", "node"))
+	if _, err := h.try(t.Context(), nil, "docker", "container", "inspect", node); err == nil {
+		t.Logf("reusing container %s", node)
+		h.run(t, nil, "docker", "start", node)
+	} else {
+		// /var is a volume so the nspawn rootfs under /var/lib/machines is
+		// not nested in the container's overlay filesystem.
+		h.run(t, nil, "docker", "run", "--detach",
+			"--name", node,
+			"--hostname", node,
+			"--network", "kind",
+			"--privileged",
+			"--cgroupns", "host",
+			"--security-opt", "seccomp=unconfined",
+			"--security-opt", "apparmor=unconfined",
+			"--tmpfs", "/run",
+			"--tmpfs", "/run/lock",
+			"--volume", "/sys/fs/cgroup:/sys/fs/cgroup:rw",
+			"--volume", "/lib/modules:/lib/modules:ro",
+			"--volume", node+"-var:/var",
+			nodeHostImage)
+	}
+	poll(t, h.cfg.systemdBootTimeout, "systemd in "+node, func(ctx context.Context) (bool, error) {
+		state, _ := h.try(ctx, nil, "docker", "exec", node, "systemctl", "is-system-running")
+		state = strings.TrimSpace(state)
+		return state == "running" || state == "degraded", nil
+	})
+	ip := strings.TrimSpace(h.run(t, nil, "docker", "container", "inspect", "--format", `{{(index .NetworkSettings.Networks "kind").IPAddress}}`, node))
+	if net.ParseIP(ip).To4() == nil {
+		t.Fatalf("invalid kind network IP for %s: %q", node, ip)
+	}
+	h.nodeIP = ip
+	t.Logf("flex node container %s is up at %s", node, ip)
+}
+
+// collectLogs writes the agent and kubelet journals and the kind cluster
+// logs under the work directory.
+func (h *harness) collectLogs(t *testing.T) {
+	t.Helper()
+	dir := filepath.Join(h.cfg.workDir, "logs", h.cfg.nodeName)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		t.Logf("create log directory: %v", err)
+		return
+	}
+	ctx := context.WithoutCancel(t.Context())
+	save := func(name string, args ...string) {
+		out, _ := h.try(ctx, nil, "docker", append([]string{"exec", h.cfg.nodeName}, args...)...)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(out), 0o600); err != nil {
+			t.Logf("write %s: %v", name, err)
+		}
+	}
+	save("aks-flex-node.journal", "journalctl", "--no-pager", "-u", "aks-flex-node*")
+	save("machines.txt", "machinectl", "list", "--no-pager")
+	for _, machine := range []string{"kube1", "kube2"} {
+		save(machine+"-kubelet.journal", "systemd-run", "--machine="+machine, "--quiet", "--pipe", "journalctl", "--no-pager", "-u", "kubelet")
+	}
+	if out, err := h.try(ctx, nil, "kind", "export", "logs", "--name", h.cfg.clusterName, filepath.Join(h.cfg.workDir, "logs", "kind")); err != nil {
+		t.Logf("export kind logs: %v\n%s", err, out)
+	}
+	t.Logf("logs written to %s", filepath.Join(h.cfg.workDir, "logs"))
+}
+
+// down deletes the flex node container, its volume, and the kind cluster.
+func (h *harness) down(t *testing.T) {
+	t.Helper()
+	ctx := context.WithoutCancel(t.Context())
+	for _, args := range [][]string{
+		{"docker", "rm", "--force", "--volumes", h.cfg.nodeName},
+		{"docker", "volume", "rm", h.cfg.nodeName + "-var"},
+		{"kind", "delete", "cluster", "--name", h.cfg.clusterName, "--kubeconfig", h.kubeconfig},
+	} {
+		if out, err := h.try(ctx, nil, args[0], args[1:]...); err != nil {
+			t.Logf("%s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
+
+// upsertMachine publishes the machine goal the controller serves for the
+// node.
+func (h *harness) upsertMachine(t *testing.T, kubernetesVersion, settingsVersion string) {
+	t.Helper()
+	machine := map[string]any{
+		"id":   h.clusterID + "/agentPools/" + h.cfg.agentPool + "/machines/" + h.cfg.nodeName,
+		"name": h.cfg.nodeName,
+		"type": "Microsoft.ContainerService/managedClusters/agentPools/machines",
+		"properties": map[string]any{
+			"eTag":              settingsVersion,
+			"provisioningState": "Succeeded",
+			"kubernetes": map[string]any{
+				"orchestratorVersion": kubernetesVersion,
+				"maxPods":             110,
+				"nodeLabels":          map[string]string{"kubernetes.azure.com/managed": "false"},
+				"nodeTaints":          []string{},
+				"kubeletConfig":       map[string]int{"imageGcHighThreshold": 85, "imageGcLowThreshold": 80},
+			},
+		},
+	}
+	data, err := json.Marshal(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.patchMachines(t, map[string]any{h.cfg.nodeName + ".json": string(data)})
+	t.Logf("published machine goal for %s: Kubernetes %s, settings %s", h.cfg.nodeName, kubernetesVersion, settingsVersion)
+}
+
+// deleteMachine removes the node's machine goal, as the AKS RP does when
+// the machine is deleted.
+func (h *harness) deleteMachine(t *testing.T) {
+	t.Helper()
+	h.patchMachines(t, map[string]any{h.cfg.nodeName + ".json": nil, h.cfg.nodeName: nil})
+}
+
+func (h *harness) patchMachines(t *testing.T, data map[string]any) {
+	t.Helper()
+	configMaps := h.kube.CoreV1().ConfigMaps(controllerNamespace)
+	_, err := configMaps.Create(t.Context(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: machineConfigMap}}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		t.Fatalf("create configmap %s: %v", machineConfigMap, err)
+	}
+	patch, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := configMaps.Patch(t.Context(), machineConfigMap, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		t.Fatalf("patch configmap %s: %v", machineConfigMap, err)
+	}
+}
+
+func containsLine(s, line string) bool {
+	for l := range strings.Lines(s) {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
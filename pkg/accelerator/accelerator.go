@@ -0,0 +1,201 @@
+// Package accelerator partitions the host's NVIDIA GPUs into MIG instances
+// with nvidia-smi, writes the NVIDIA device plugin time-slicing config into
+// the nspawn machine, and reports when the GPUs drift from the config.
+package accelerator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+// Runner runs nvidia-smi with args and returns its standard output.
+type Runner func(ctx context.Context, args ...string) (string, error)
+
+// NvidiaSMI returns a Runner of the host's nvidia-smi.
+func NvidiaSMI(log *slog.Logger) Runner {
+	return func(ctx context.Context, args ...string) (string, error) {
+		return utilexec.OutputCmd(ctx, log, "nvidia-smi", args...)
+	}
+}
+
+// GPU is one NVIDIA GPU and its MIG state.
+type GPU struct {
+	Index int    `json:"index"`
+	UUID  string `json:"uuid"`
+	Name  string `json:"name"`
+	// MIGCapable is false for GPUs that do not support MIG.
+	MIGCapable bool `json:"migCapable"`
+	MIGEnabled bool `json:"migEnabled"`
+	// MIGPending is the MIG mode that takes effect at the next GPU reset.
+	MIGPending bool `json:"migPending"`
+	// Instances are the profile names of the GPU instances, sorted.
+	Instances []string `json:"instances,omitempty"`
+}
+
+var (
+	listGPULine = regexp.MustCompile(`^GPU (\d+): `)
+	listMIGLine = regexp.MustCompile(`^\s+MIG (\S+)\s+Device\s+\d+:`)
+)
+
+// Query returns the host's GPUs.
+func Query(ctx context.Context, run Runner) ([]GPU, error) {
+	out, err := run(ctx, "--query-gpu=index,uuid,name,mig.mode.current,mig.mode.pending", "--format=csv,noheader")
+	if err != nil {
+		return nil, fmt.Errorf("query GPUs: %w", err)
+	}
+	var gpus []GPU
+	for line := range strings.Lines(out) {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		if len(fields) != 5 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parse GPU index %q: %w", fields[0], err)
+		}
+		gpus = append(gpus, GPU{
+			Index:      index,
+			UUID:       fields[1],
+			Name:       fields[2],
+			MIGCapable: fields[3] == "Enabled" || fields[3] == "Disabled",
+			MIGEnabled: fields[3] == "Enabled",
+			MIGPending: fields[4] == "Enabled",
+		})
+	}
+
+	list, err := run(ctx, "-L")
+	if err != nil {
+		return nil, fmt.Errorf("list GPU instances: %w", err)
+	}
+	current := -1
+	for line := range strings.Lines(list) {
+		if m := listGPULine.FindStringSubmatch(line); m != nil {
+			current, _ = strconv.Atoi(m[1])
+			continue
+		}
+		m := listMIGLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for i := range gpus {
+			if gpus[i].Index == current {
+				gpus[i].Instances = append(gpus[i].Instances, m[1])
+			}
+		}
+	}
+	for i := range gpus {
+		slices.Sort(gpus[i].Instances)
+	}
+	return gpus, nil
+}
+
+// Drift is a GPU that does not match the config.
+type Drift struct {
+	GPU     int    `json:"gpu"`
+	Problem string `json:"problem"`
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("GPU %d: %s", d.GPU, d.Problem)
+}
+
+// Diff compares the GPUs with the MIG config. GPUs the config does not
+// partition are not reported.
+func Diff(cfg config.AcceleratorsConfig, gpus []GPU) []Drift {
+	if cfg.MIG == nil {
+		return nil
+	}
+	want := slices.Sorted(slices.Values(cfg.MIG.Profiles))
+	var drift []Drift
+	for _, index := range targets(cfg.MIG, gpus) {
+		i := slices.IndexFunc(gpus, func(g GPU) bool { return g.Index == index })
+		switch {
+		case i < 0:
+			drift = append(drift, Drift{GPU: index, Problem: "not found"})
+		case !gpus[i].MIGCapable:
+			drift = append(drift, Drift{GPU: index, Problem: gpus[i].Name + " does not support MIG"})
+		case !gpus[i].MIGEnabled:
+			drift = append(drift, Drift{GPU: index, Problem: "MIG mode is disabled"})
+		case !slices.Equal(gpus[i].Instances, want):
+			drift = append(drift, Drift{GPU: index, Problem: fmt.Sprintf("instances are [%s], want [%s]", strings.Join(gpus[i].Instances, " "), strings.Join(want, " "))})
+		}
+	}
+	return drift
+}
+
+// targets returns the indices of the GPUs the config partitions.
+func targets(mig *config.MIGConfig, gpus []GPU) []int {
+	if len(mig.GPUs) > 0 {
+		return mig.GPUs
+	}
+	indices := make([]int, 0, len(gpus))
+	for _, gpu := range gpus {
+		indices = append(indices, gpu.Index)
+	}
+	return indices
+}
+
+// ApplyMIG enables MIG mode on the configured GPUs and recreates their GPU
+// instances where they differ from the config, then verifies the result. A
+// MIG mode change that needs a GPU reset, or instances still in use by a
+// process, fail the apply.
+func ApplyMIG(ctx context.Context, log *slog.Logger, cfg config.AcceleratorsConfig, run Runner) error {
+	if cfg.MIG == nil {
+		return nil
+	}
+	gpus, err := Query(ctx, run)
+	if err != nil {
+		return err
+	}
+	for _, d := range Diff(cfg, gpus) {
+		gpu := strconv.Itoa(d.GPU)
+		i := slices.IndexFunc(gpus, func(g GPU) bool { return g.Index == d.GPU })
+		if i < 0 || !gpus[i].MIGCapable {
+			return fmt.Errorf("cannot partition %s", d)
+		}
+		if !gpus[i].MIGEnabled {
+			log.Info("enabling MIG mode", "gpu", d.GPU)
+			if _, err := run(ctx, "-i", gpu, "-mig", "1"); err != nil {
+				return fmt.Errorf("enable MIG mode on GPU %d: %w", d.GPU, err)
+			}
+			if gpus, err = Query(ctx, run); err != nil {
+				return err
+			}
+			if i = slices.IndexFunc(gpus, func(g GPU) bool { return g.Index == d.GPU }); i < 0 || !gpus[i].MIGEnabled {
+				return fmt.Errorf("MIG mode on GPU %d is pending a GPU reset; reboot the host", d.GPU)
+			}
+		}
+		log.Info("recreating MIG instances", "gpu", d.GPU, "from", gpus[i].Instances, "to", cfg.MIG.Profiles)
+		// Destroying fails when there is nothing to destroy, which the
+		// create below does not care about.
+		_, _ = run(ctx, "mig", "-i", gpu, "-dci")
+		_, _ = run(ctx, "mig", "-i", gpu, "-dgi")
+		if _, err := run(ctx, "mig", "-i", gpu, "-cgi", strings.Join(cfg.MIG.Profiles, ","), "-C"); err != nil {
+			return fmt.Errorf("create MIG instances on GPU %d: %w", d.GPU, err)
+		}
+	}
+
+	gpus, err = Query(ctx, run)
+	if err != nil {
+		return err
+	}
+	if drift := Diff(cfg, gpus); len(drift) > 0 {
+		problems := make([]string, 0, len(drift))
+		for _, d := range drift {
+			problems = append(problems, d.String())
+		}
+		return fmt.Errorf("MIG config did not apply: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package accelerator
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// fakeSMI answers nvidia-smi like a single A100 whose GPU instances are
+// created and destroyed by the mig subcommands.
+type fakeSMI struct {
+	migEnabled bool
+	instances  []string
+	calls      []string
+}
+
+func (f *fakeSMI) run(_ context.Context, args ...string) (string, error) {
+	f.calls = append(f.calls, strings.Join(args, " "))
+	switch {
+	case strings.HasPrefix(args[0], "--query-gpu"):
+		mode := "Disabled"
+		if f.migEnabled {
+			mode = "Enabled"
+		}
+		return "0, GPU-1111, NVIDIA A100-SXM4-80GB, " + mode + ", " + mode + "\n", nil
+	case args[0] == "-L":
+		out := "GPU 0: NVIDIA A100-SXM4-80GB (UUID: GPU-1111)\n"
+		for i, profile := range f.instances {
+			out += "  MIG " + profile + "  Device  " + string(rune('0'+i)) + ": (UUID: MIG-x)\n"
+		}
+		return out, nil
+	case args[0] == "-i" && args[2] == "-mig":
+		f.migEnabled = true
+	case args[0] == "mig" && args[3] == "-dgi":
+		f.instances = nil
+	case args[0] == "mig" && args[3] == "-cgi":
+		f.instances = append(f.instances, strings.Split(args[4], ",")...)
+	}
+	return "", nil
+}
+
+func TestApplyMIG(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.AcceleratorsConfig{MIG: &config.MIGConfig{Profiles: []string{"3g.40gb", "2g.20gb", "1g.10gb"}}}
+	smi := &fakeSMI{instances: []string{"7g.80gb"}}
+	if err := ApplyMIG(t.Context(), slog.New(slog.DiscardHandler), cfg, smi.run); err != nil {
+		t.Fatalf("ApplyMIG() error = %v", err)
+	}
+	if !smi.migEnabled || !slices.Equal(smi.instances, cfg.MIG.Profiles) {
+		t.Errorf("GPU after ApplyMIG: MIG %v, instances %v", smi.migEnabled, smi.instances)
+	}
+
+	gpus, err := Query(t.Context(), smi.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift := Diff(cfg, gpus); len(drift) != 0 {
+		t.Errorf("Diff() after apply = %v", drift)
+	}
+
+	smi.calls = nil
+	if err := ApplyMIG(t.Context(), slog.New(slog.DiscardHandler), cfg, smi.run); err != nil {
+		t.Fatalf("second ApplyMIG() error = %v", err)
+	}
+	for _, call := range smi.calls {
+		if strings.HasPrefix(call, "mig ") {
+			t.Errorf("ApplyMIG() on a matching GPU ran %q", call)
+		}
+	}
+
+	smi.instances = []string{"1g.10gb"}
+	gpus, _ = Query(t.Context(), smi.run)
+	if drift := Diff(cfg, gpus); len(drift) != 1 || !strings.Contains(drift[0].String(), "instances are [1g.10gb]") {
+		t.Errorf("Diff() after a manual change = %v", drift)
+	}
+}
+
+func TestApplyMIGPendingReset(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.AcceleratorsConfig{MIG: &config.MIGConfig{Profiles: []string{"1g.10gb"}}}
+	run := func(_ context.Context, args ...string) (string, error) {
+		if strings.HasPrefix(args[0], "--query-gpu") {
+			return "0, GPU-1111, NVIDIA A100-SXM4-80GB, Disabled, Enabled\n", nil
+		}
+		return "", nil
+	}
+	err := ApplyMIG(t.Context(), slog.New(slog.DiscardHandler), cfg, run)
+	if err == nil || !strings.Contains(err.Error(), "reboot") {
+		t.Errorf("ApplyMIG() error = %v, want a reboot to be asked for", err)
+	}
+
+	run = func(_ context.Context, args ...string) (string, error) {
+		if strings.HasPrefix(args[0], "--query-gpu") {
+			return "0, GPU-2222, Tesla T4, [N/A], [N/A]\n", nil
+		}
+		return "", nil
+	}
+	if err := ApplyMIG(t.Context(), slog.New(slog.DiscardHandler), cfg, run); err == nil || !strings.Contains(err.Error(), "does not support MIG") {
+		t.Errorf("ApplyMIG() on a T4 error = %v", err)
+	}
+}
+
+func TestWriteDevicePluginConfig(t *testing.T) {
+	t.Parallel()
+
+	machineDir := t.TempDir()
+	log := slog.New(slog.DiscardHandler)
+	cfg := config.AcceleratorsConfig{
+		MIG:         &config.MIGConfig{Profiles: []string{"3g.40gb", "1g.10gb", "1g.10gb"}},
+		TimeSlicing: &config.TimeSlicingConfig{Replicas: 4},
+	}
+	if changed, err := WriteDevicePluginConfig(t.Context(), log, cfg, machineDir); err != nil || !changed {
+		t.Fatalf("WriteDevicePluginConfig() = %v, %v", changed, err)
+	}
+	data, err := os.ReadFile(filepath.Join(machineDir, DevicePluginConfigPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"migStrategy: mixed", "- name: nvidia.com/mig-1g.10gb\n      replicas: 4", "- name: nvidia.com/mig-3g.40gb"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config missing %q:\n%s", want, data)
+		}
+	}
+	if changed, _ := WriteDevicePluginConfig(t.Context(), log, cfg, machineDir); changed {
+		t.Error("rewriting the same config reported a change")
+	}
+
+	if changed, err := WriteDevicePluginConfig(t.Context(), log, config.AcceleratorsConfig{}, machineDir); err != nil || !changed {
+		t.Errorf("WriteDevicePluginConfig() without config = %v, %v, want the stale file removed", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(machineDir, DevicePluginConfigPath)); !os.IsNotExist(err) {
+		t.Errorf("stale device plugin config still present: %v", err)
+	}
+}
+
+func TestMIGStrategy(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		cfg  config.AcceleratorsConfig
+		want string
+	}{
+		{cfg: config.AcceleratorsConfig{TimeSlicing: &config.TimeSlicingConfig{Replicas: 2}}, want: "none"},
+		{cfg: config.AcceleratorsConfig{MIG: &config.MIGConfig{Profiles: []string{"1g.10gb", "1g.10gb"}}}, want: "single"},
+		{cfg: config.AcceleratorsConfig{MIG: &config.MIGConfig{Profiles: []string{"1g.10gb", "2g.20gb"}}}, want: "mixed"},
+	} {
+		if got := MIGStrategy(tt.cfg); got != tt.want {
+			t.Errorf("MIGStrategy(%+v) = %s, want %s", tt.cfg.MIG, got, tt.want)
+		}
+	}
+}
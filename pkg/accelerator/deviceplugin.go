@@ -0,0 +1,131 @@
+package accelerator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// DevicePluginConfigPath is where the NVIDIA device plugin config is written
+// in the machine. A device plugin DaemonSet picks it up by mounting the
+// host path /var/lib/machines/<machine>/etc/nvidia-device-plugin and passing
+// --config-file.
+const DevicePluginConfigPath = "/etc/nvidia-device-plugin/config.yaml"
+
+const devicePluginHeader = "# Managed by aks-flex-node. Changes are overwritten.\n"
+
+// MIGStrategy returns the device plugin MIG strategy for cfg: single when
+// every GPU instance has the same profile, so pods keep requesting
+// nvidia.com/gpu, mixed otherwise, and none without MIG.
+func MIGStrategy(cfg config.AcceleratorsConfig) string {
+	if cfg.MIG == nil {
+		return "none"
+	}
+	if len(slices.Compact(slices.Sorted(slices.Values(cfg.MIG.Profiles)))) == 1 {
+		return "single"
+	}
+	return "mixed"
+}
+
+// DevicePluginConfig renders the NVIDIA device plugin config for cfg.
+func DevicePluginConfig(cfg config.AcceleratorsConfig) string {
+	strategy := MIGStrategy(cfg)
+	var b strings.Builder
+	b.WriteString(devicePluginHeader)
+	b.WriteString("version: v1\n")
+	b.WriteString("flags:\n")
+	fmt.Fprintf(&b, "  migStrategy: %s\n", strategy)
+	if cfg.TimeSlicing == nil {
+		return b.String()
+	}
+	resources := []string{"nvidia.com/gpu"}
+	if strategy == "mixed" {
+		resources = resources[:0]
+		for _, profile := range slices.Compact(slices.Sorted(slices.Values(cfg.MIG.Profiles))) {
+			resources = append(resources, "nvidia.com/mig-"+profile)
+		}
+	}
+	b.WriteString("sharing:\n")
+	b.WriteString("  timeSlicing:\n")
+	b.WriteString("    resources:\n")
+	for _, resource := range resources {
+		fmt.Fprintf(&b, "    - name: %s\n", resource)
+		fmt.Fprintf(&b, "      replicas: %d\n", cfg.TimeSlicing.Replicas)
+	}
+	return b.String()
+}
+
+// WriteDevicePluginConfig writes the device plugin config for cfg into the
+// machine at machineDir, or removes a previously written one when cfg
+// configures nothing. It reports whether the file changed.
+func WriteDevicePluginConfig(ctx context.Context, log *slog.Logger, cfg config.AcceleratorsConfig, machineDir string) (bool, error) {
+	path := filepath.Join(machineDir, DevicePluginConfigPath)
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	if !cfg.Enabled() {
+		if current == nil || !bytes.HasPrefix(current, []byte(devicePluginHeader)) {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("remove stale device plugin config %s: %w", path, err)
+		}
+		audit.Record(ctx, log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: audit.HashBytes(current), Detail: "NVIDIA device plugin config"})
+		return true, nil
+	}
+	content := []byte(DevicePluginConfig(cfg))
+	if bytes.Equal(current, content) {
+		return false, nil
+	}
+	before := audit.HashFile(path)
+	if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // the device plugin reads it from a host path mount
+		return false, fmt.Errorf("write device plugin config %s: %w", path, err)
+	}
+	audit.Record(ctx, log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content), Detail: "NVIDIA device plugin config"})
+	return true, nil
+}
+
+type configureTask struct {
+	log        *slog.Logger
+	cfg        config.AcceleratorsConfig
+	run        Runner
+	machineDir string
+}
+
+// Configure returns a task that partitions the GPUs as configured, verifies
+// the partitions, and writes the device plugin config into the machine at
+// machineDir. GPUs are left alone when no accelerator config is set.
+func Configure(log *slog.Logger, cfg *config.Config, machineDir string) phases.Task {
+	return &configureTask{log: log, cfg: cfg.Accelerators, run: NvidiaSMI(log), machineDir: machineDir}
+}
+
+func (t *configureTask) Name() string { return "configure-accelerators" }
+
+// Plan returns the device plugin config when accelerators are configured.
+func (t *configureTask) Plan() []string {
+	if !t.cfg.Enabled() {
+		return nil
+	}
+	return []string{filepath.Join(t.machineDir, DevicePluginConfigPath)}
+}
+
+func (t *configureTask) Do(ctx context.Context) error {
+	if err := ApplyMIG(ctx, t.log, t.cfg, t.run); err != nil {
+		return err
+	}
+	_, err := WriteDevicePluginConfig(ctx, t.log, t.cfg, t.machineDir)
+	return err
+}
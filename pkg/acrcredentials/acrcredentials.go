@@ -0,0 +1,391 @@
+// Package acrcredentials provides the kubelet's image credentials for Azure
+// Container Registry on Arc-joined nodes.
+//
+// The kubelet runs the agent binary as an image credential provider plugin
+// (`token acr`) that answers from a credentials file. The agent exchanges
+// the Arc machine identity for a refresh token of each configured registry
+// and rotates that file on the host and in the nspawn machine's /etc, so the
+// kubelet picks up new tokens on its next plugin call without a restart.
+package acrcredentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// ProviderConfigPath and ProviderBinDir are the kubelet's
+	// --image-credential-provider-config and --image-credential-provider-bin-dir
+	// inside the machine.
+	ProviderConfigPath = "/etc/kubernetes/image-credential-provider-config.json"
+	ProviderBinDir     = "/var/lib/kubelet/credential-provider"
+
+	// providerName is the plugin's file name in ProviderBinDir, a link to
+	// the agent binary the machine already carries.
+	providerName   = "acr-credential-provider"
+	providerTarget = "/usr/local/bin/aks-flex-node"
+
+	// defaultCacheDuration applies when a plugin response sets none.
+	defaultCacheDuration = "10m"
+
+	// refreshTokenUser is the user name ACR expects with a refresh token.
+	refreshTokenUser = "00000000-0000-0000-0000-000000000000"
+
+	providerAPIVersion = "credentialprovider.kubelet.k8s.io/v1"
+)
+
+// RefreshBefore is how long before expiry the registry tokens are renewed.
+// The plugin caches a response only until then, so the kubelet asks again
+// once the tokens were renewed.
+const RefreshBefore = 15 * time.Minute
+
+// Applies reports whether the kubelet gets ACR credentials from the agent.
+func Applies(cfg *config.Config) bool {
+	return cfg != nil && cfg.ACRCredentials.Enabled
+}
+
+// KubeletArgs returns the kubelet flags that enable the credential provider
+// when it applies.
+func KubeletArgs(cfg *config.Config) []string {
+	if !Applies(cfg) {
+		return nil
+	}
+	return []string{
+		"--image-credential-provider-config=" + ProviderConfigPath,
+		"--image-credential-provider-bin-dir=" + ProviderBinDir,
+	}
+}
+
+// Credentials is the document the agent rotates in the credentials file.
+type Credentials struct {
+	// ExpiresOn is when the earliest of the tokens expires.
+	ExpiresOn time.Time `json:"expiresOn"`
+	// Registries maps each login server to its refresh token.
+	Registries map[string]string `json:"registries"`
+}
+
+// Load reads the credentials file at path.
+func Load(path string) (*Credentials, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is the agent's credentials file
+	if err != nil {
+		return nil, fmt.Errorf("read ACR credentials: %w", err)
+	}
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("decode ACR credentials %s: %w", path, err)
+	}
+	return &creds, nil
+}
+
+// Manager exchanges and writes the registry tokens and checks whether they
+// need to be renewed.
+type Manager struct {
+	log      *slog.Logger
+	cfg      *config.Config
+	identity kubeconfig.Source
+	client   *http.Client
+	// exchangeURL returns the token exchange endpoint of a registry.
+	exchangeURL func(registry string) string
+	hostPath    string
+	now         func() time.Time
+}
+
+// NewManager returns a Manager that exchanges the Arc machine identity's
+// Azure Resource Manager token, which ACR accepts for its token exchange.
+func NewManager(log *slog.Logger, cfg *config.Config) *Manager {
+	resource := strings.TrimRight(cfg.Azure.ResourceManagerEndpointURL, "/")
+	if resource == "" {
+		resource = config.DefaultResourceManagerEndpointURL
+	}
+	return &Manager{
+		log:         log,
+		cfg:         cfg,
+		identity:    kubeconfig.NewArcIdentity(cfg, resource+"/"),
+		client:      httpclient.NewForConfig(cfg.Agent.HTTP, "acr-exchange", httpclient.KindRequest),
+		exchangeURL: func(registry string) string { return "https://" + registry + "/oauth2/exchange" },
+		hostPath:    cfg.Instance.ACRCredentialsPath(),
+		now:         time.Now,
+	}
+}
+
+// Generate exchanges a token for every configured registry, stores them on
+// the host and, when machineDir is set, in the machine's /etc together with
+// the kubelet's credential provider config and plugin.
+func (m *Manager) Generate(ctx context.Context, machineDir string) error {
+	aad, err := m.identity.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("obtain Arc identity token for ACR: %w", err)
+	}
+	creds := Credentials{ExpiresOn: aad.ExpiresOn, Registries: map[string]string{}}
+	for _, registry := range m.cfg.ACRCredentials.Registries {
+		token, err := m.exchange(ctx, registry, aad.Value)
+		if err != nil {
+			return err
+		}
+		if expiresOn, err := kubeconfig.TokenExpiry([]byte(token)); err == nil && expiresOn.Before(creds.ExpiresOn) {
+			creds.ExpiresOn = expiresOn
+		}
+		creds.Registries[registry] = token
+	}
+	if err := m.write(machineDir, creds); err != nil {
+		return err
+	}
+	m.log.Info("generated ACR credentials", "registries", len(creds.Registries), "expiresOn", creds.ExpiresOn, "machineDir", machineDir)
+	return nil
+}
+
+// exchange trades the Entra access token for a refresh token of registry.
+func (m *Manager) exchange(ctx context.Context, registry, accessToken string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registry},
+		"access_token": {accessToken},
+	}
+	if m.cfg.Azure.TenantID != "" {
+		form.Set("tenant", m.cfg.Azure.TenantID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.exchangeURL(registry), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("exchange ACR token for %s: %w", registry, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body close
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("read ACR token exchange response from %s: %w", registry, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ACR token exchange with %s returned %s: %s", registry, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var out struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("decode ACR token exchange response from %s: %w", registry, err)
+	}
+	if out.RefreshToken == "" {
+		return "", fmt.Errorf("ACR token exchange with %s returned no refresh token", registry)
+	}
+	return out.RefreshToken, nil
+}
+
+func (m *Manager) write(machineDir string, creds Credentials) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("encode ACR credentials: %w", err)
+	}
+	paths := []string{m.hostPath}
+	if machineDir != "" {
+		paths = append(paths, filepath.Join(machineDir, m.cfg.Instance.ACRCredentialsPath()))
+	}
+	for _, path := range paths {
+		if err := utilio.WriteFile(path, data, 0o600); err != nil {
+			return fmt.Errorf("write ACR credentials %s: %w", path, err)
+		}
+	}
+	if machineDir == "" {
+		return nil
+	}
+	provider, err := m.providerConfig()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(machineDir, ProviderConfigPath)
+	if err := utilio.WriteFile(path, provider, 0o644); err != nil { //nolint:gosec // read by the kubelet; holds no secrets
+		return fmt.Errorf("write credential provider config %s: %w", path, err)
+	}
+	return linkProvider(machineDir)
+}
+
+// linkProvider points the plugin in the machine's ProviderBinDir at the
+// agent binary.
+func linkProvider(machineDir string) error {
+	path := filepath.Join(machineDir, ProviderBinDir, providerName)
+	if target, err := os.Readlink(path); err == nil && target == providerTarget {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gosec // the kubelet's plugin directory
+		return fmt.Errorf("create credential provider directory: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("replace credential provider %s: %w", path, err)
+	}
+	if err := os.Symlink(providerTarget, path); err != nil {
+		return fmt.Errorf("link credential provider %s: %w", path, err)
+	}
+	return nil
+}
+
+// providerConfig renders the kubelet's CredentialProviderConfig. JSON is
+// valid YAML, which the kubelet reads the file as.
+func (m *Manager) providerConfig() ([]byte, error) {
+	type provider struct {
+		Name                 string   `json:"name"`
+		MatchImages          []string `json:"matchImages"`
+		DefaultCacheDuration string   `json:"defaultCacheDuration"`
+		APIVersion           string   `json:"apiVersion"`
+		Args                 []string `json:"args"`
+	}
+	doc := struct {
+		APIVersion string     `json:"apiVersion"`
+		Kind       string     `json:"kind"`
+		Providers  []provider `json:"providers"`
+	}{
+		APIVersion: "kubelet.config.k8s.io/v1",
+		Kind:       "CredentialProviderConfig",
+		Providers: []provider{{
+			Name:                 providerName,
+			MatchImages:          m.cfg.ACRCredentials.Registries,
+			DefaultCacheDuration: defaultCacheDuration,
+			APIVersion:           providerAPIVersion,
+			Args:                 []string{"token", "acr", "--path", m.cfg.Instance.ACRCredentialsPath()},
+		}},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encode credential provider config: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Check returns why the credentials for machineDir need to be regenerated,
+// or nil when they are current: the credentials are missing, unreadable,
+// differ between the host and the machine, do not cover the configured
+// registries, or expire within RefreshBefore, or the provider config or
+// plugin in the machine is missing or stale.
+func (m *Manager) Check(machineDir string) error {
+	host, err := os.ReadFile(m.hostPath)
+	if err != nil {
+		return fmt.Errorf("read ACR credentials: %w", err)
+	}
+	var creds Credentials
+	if err := json.Unmarshal(host, &creds); err != nil {
+		return fmt.Errorf("decode ACR credentials: %w", err)
+	}
+	if !slices.Equal(slices.Sorted(maps.Keys(creds.Registries)), slices.Sorted(slices.Values(m.cfg.ACRCredentials.Registries))) {
+		return fmt.Errorf("ACR credentials do not match acrCredentials.registries")
+	}
+	if remaining := creds.ExpiresOn.Sub(m.now()); remaining < RefreshBefore {
+		return fmt.Errorf("ACR credentials expire at %s", creds.ExpiresOn.UTC().Format(time.RFC3339))
+	}
+	if machineDir == "" {
+		return nil
+	}
+
+	machine, err := os.ReadFile(filepath.Join(machineDir, m.cfg.Instance.ACRCredentialsPath()))
+	if err != nil {
+		return fmt.Errorf("read machine ACR credentials: %w", err)
+	}
+	if string(machine) != string(host) {
+		return fmt.Errorf("machine ACR credentials differ from the host credentials")
+	}
+	want, err := m.providerConfig()
+	if err != nil {
+		return err
+	}
+	got, err := os.ReadFile(filepath.Join(machineDir, ProviderConfigPath))
+	if err != nil {
+		return fmt.Errorf("read credential provider config: %w", err)
+	}
+	if string(got) != string(want) {
+		return fmt.Errorf("credential provider config does not match acrCredentials")
+	}
+	if target, err := os.Readlink(filepath.Join(machineDir, ProviderBinDir, providerName)); err != nil || target != providerTarget {
+		return fmt.Errorf("credential provider plugin is not linked to %s", providerTarget)
+	}
+	return nil
+}
+
+// Task returns a phase that generates the credentials for machineDir. It is
+// a no-op unless acrCredentials is enabled.
+func (m *Manager) Task(machineDir string) phases.Task {
+	return &generateTask{manager: m, machineDir: machineDir}
+}
+
+type generateTask struct {
+	manager    *Manager
+	machineDir string
+}
+
+func (t *generateTask) Name() string { return "generate-acr-credentials" }
+
+// Plan returns the credentials on the host and in the machine, and the
+// machine's credential provider config.
+func (t *generateTask) Plan() []string {
+	if !Applies(t.manager.cfg) {
+		return nil
+	}
+	return []string{
+		t.manager.hostPath,
+		filepath.Join(t.machineDir, t.manager.cfg.Instance.ACRCredentialsPath()),
+		filepath.Join(t.machineDir, ProviderConfigPath),
+	}
+}
+
+func (t *generateTask) Do(ctx context.Context) error {
+	if !Applies(t.manager.cfg) {
+		return nil
+	}
+	return t.manager.Generate(ctx, t.machineDir)
+}
+
+// authConfig is the credential the kubelet pulls a registry's images with.
+type authConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Response is the kubelet's CredentialProviderResponse for the plugin.
+type Response struct {
+	APIVersion    string                `json:"apiVersion"`
+	Kind          string                `json:"kind"`
+	CacheKeyType  string                `json:"cacheKeyType"`
+	CacheDuration string                `json:"cacheDuration,omitempty"`
+	Auth          map[string]authConfig `json:"auth"`
+}
+
+// NewResponse answers a plugin request from creds. The kubelet caches the
+// answer per registry until RefreshBefore the tokens expire, by which time
+// the agent has renewed them. Expired credentials are an error, so the
+// kubelet does not keep retrying with rejected tokens.
+func NewResponse(creds *Credentials, now time.Time) (*Response, error) {
+	remaining := creds.ExpiresOn.Sub(now)
+	if remaining <= 0 {
+		return nil, fmt.Errorf("ACR credentials expired at %s", creds.ExpiresOn.UTC().Format(time.RFC3339))
+	}
+	resp := &Response{
+		APIVersion:    providerAPIVersion,
+		Kind:          "CredentialProviderResponse",
+		CacheKeyType:  "Registry",
+		CacheDuration: max(remaining-RefreshBefore, 0).Round(time.Second).String(),
+		Auth:          make(map[string]authConfig, len(creds.Registries)),
+	}
+	for registry, token := range creds.Registries {
+		resp.Auth[registry] = authConfig{Username: refreshTokenUser, Password: token}
+	}
+	return resp, nil
+}
@@ -0,0 +1,154 @@
+package acrcredentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+)
+
+type fakeIdentity struct {
+	token kubeconfig.Token
+	err   error
+}
+
+func (f *fakeIdentity) Name() string { return "fake" }
+
+func (f *fakeIdentity) Token(context.Context) (kubeconfig.Token, error) { return f.token, f.err }
+
+func newTestManager(t *testing.T, registries []string, handler http.HandlerFunc) (*Manager, time.Time) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	now := time.Unix(1700000000, 0)
+	return &Manager{
+		log: slog.New(slog.DiscardHandler),
+		cfg: &config.Config{
+			Azure:          config.AzureConfig{TenantID: "tenant"},
+			ACRCredentials: config.ACRCredentialsConfig{Enabled: true, Registries: registries},
+		},
+		identity:    &fakeIdentity{token: kubeconfig.Token{Value: "aad", ExpiresOn: now.Add(time.Hour)}},
+		client:      server.Client(),
+		exchangeURL: func(registry string) string { return server.URL + "/" + registry + "/oauth2/exchange" },
+		hostPath:    filepath.Join(t.TempDir(), "acr-credentials.json"),
+		now:         func() time.Time { return now },
+	}, now
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	m, now := newTestManager(t, []string{"contoso.azurecr.io", "fabrikam.azurecr.io"}, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("grant_type") != "access_token" || r.PostForm.Get("access_token") != "aad" || r.PostForm.Get("tenant") != "tenant" {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"refresh_token": "refresh-" + r.PostForm.Get("service")})
+	})
+	machineDir := t.TempDir()
+	if err := m.Check(machineDir); err == nil {
+		t.Fatal("Check() = nil before the credentials were generated")
+	}
+	if err := m.Generate(t.Context(), machineDir); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if err := m.Check(machineDir); err != nil {
+		t.Fatalf("Check() after Generate = %v", err)
+	}
+
+	creds, err := Load(filepath.Join(machineDir, config.ACRCredentialsPath))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if creds.Registries["fabrikam.azurecr.io"] != "refresh-fabrikam.azurecr.io" || !creds.ExpiresOn.Equal(now.Add(time.Hour)) {
+		t.Fatalf("credentials = %+v", creds)
+	}
+	data, err := os.ReadFile(filepath.Join(machineDir, ProviderConfigPath))
+	if err != nil {
+		t.Fatalf("ReadFile provider config: %v", err)
+	}
+	for _, want := range []string{`"name": "acr-credential-provider"`, `"contoso.azurecr.io"`, config.ACRCredentialsPath} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("provider config missing %s:\n%s", want, data)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(machineDir, ProviderBinDir, providerName)); err != nil || target != providerTarget {
+		t.Fatalf("plugin link = %q, %v", target, err)
+	}
+
+	// A registry added to the config needs new credentials.
+	m.cfg.ACRCredentials.Registries = append(m.cfg.ACRCredentials.Registries, "northwind.azurecr.io")
+	if err := m.Check(machineDir); err == nil {
+		t.Fatal("Check() = nil after a registry was added")
+	}
+	// So do credentials close to expiry.
+	m.cfg.ACRCredentials.Registries = m.cfg.ACRCredentials.Registries[:2]
+	m.now = func() time.Time { return now.Add(50 * time.Minute) }
+	if err := m.Check(machineDir); err == nil || !strings.Contains(err.Error(), "expire") {
+		t.Fatalf("Check() near expiry = %v, want expiry", err)
+	}
+}
+
+func TestGenerateFailures(t *testing.T) {
+	t.Parallel()
+
+	m, _ := newTestManager(t, []string{"contoso.azurecr.io"}, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "identity lacks AcrPull", http.StatusUnauthorized)
+	})
+	if err := m.Generate(t.Context(), ""); err == nil || !strings.Contains(err.Error(), "AcrPull") {
+		t.Fatalf("Generate() = %v, want the exchange error", err)
+	}
+	m.identity = &fakeIdentity{err: errors.New("himds unavailable")}
+	if err := m.Generate(t.Context(), ""); err == nil || !strings.Contains(err.Error(), "himds") {
+		t.Fatalf("Generate() = %v, want the identity error", err)
+	}
+	if _, err := os.Stat(m.hostPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("credentials written after a failed exchange: %v", err)
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+	creds := &Credentials{ExpiresOn: now.Add(time.Hour), Registries: map[string]string{"contoso.azurecr.io": "refresh"}}
+	resp, err := NewResponse(creds, now)
+	if err != nil {
+		t.Fatalf("NewResponse: %v", err)
+	}
+	if resp.CacheDuration != "45m0s" || resp.CacheKeyType != "Registry" {
+		t.Fatalf("response cache = %s by %s, want 45m0s by Registry", resp.CacheDuration, resp.CacheKeyType)
+	}
+	if auth := resp.Auth["contoso.azurecr.io"]; auth.Username != refreshTokenUser || auth.Password != "refresh" {
+		t.Fatalf("auth = %+v", auth)
+	}
+	if _, err := NewResponse(creds, now.Add(2*time.Hour)); err == nil {
+		t.Fatal("NewResponse() with expired credentials succeeded")
+	}
+}
+
+func TestKubeletArgs(t *testing.T) {
+	t.Parallel()
+
+	if args := KubeletArgs(&config.Config{}); len(args) != 0 {
+		t.Fatalf("KubeletArgs(disabled) = %v, want none", args)
+	}
+	args := KubeletArgs(&config.Config{ACRCredentials: config.ACRCredentialsConfig{Enabled: true}})
+	if len(args) != 2 || !strings.HasPrefix(args[0], "--image-credential-provider-config=") {
+		t.Fatalf("KubeletArgs(enabled) = %v", args)
+	}
+}
@@ -0,0 +1,175 @@
+package aksmachine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v8"
+
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// AgentPool is the part of an AKS agent pool profile a flex node aligns with.
+type AgentPool struct {
+	Name          string
+	Mode          string
+	MaxPods       int
+	NodeLabels    map[string]string
+	NodeTaints    []string
+	KubeletConfig KubeletConfig
+}
+
+// AgentPoolReader reads the node's target agent pool from the cluster.
+type AgentPoolReader interface {
+	GetAgentPool(ctx context.Context) (*AgentPool, error)
+}
+
+type armAgentPoolReader struct {
+	cluster *arm.ResourceID
+	pool    string
+	client  *armcontainerservice.AgentPoolsClient
+}
+
+// NewAgentPoolReader returns a reader of azure.targetAgentPoolName backed by
+// the AKS ARM API, with the same credentials as the machine client.
+func NewAgentPoolReader(cfg *config.Config, logger *slog.Logger) (AgentPoolReader, error) {
+	if cfg.Azure.TargetCluster == nil {
+		return nil, fmt.Errorf("azure.targetCluster is required")
+	}
+	cluster, err := arm.ParseResourceID(cfg.Azure.TargetCluster.ResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("parse cluster resource ID: %w", err)
+	}
+	clientOpts := azureClientOptionsFromConfig(cfg)
+	cred, err := getCredential(cfg, logger, clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("resolve ARM credential: %w", err)
+	}
+	client, err := armcontainerservice.NewAgentPoolsClient(cluster.SubscriptionID, cred, &arm.ClientOptions{ClientOptions: clientOpts})
+	if err != nil {
+		return nil, fmt.Errorf("create agent pools client: %w", err)
+	}
+	return &armAgentPoolReader{cluster: cluster, pool: cfg.Azure.TargetAgentPoolName, client: client}, nil
+}
+
+func (r *armAgentPoolReader) GetAgentPool(ctx context.Context) (*AgentPool, error) {
+	ctx, _ = azclient.WithCorrelationID(ctx)
+	resp, err := r.client.Get(ctx, r.cluster.ResourceGroupName, r.cluster.Name, r.pool, nil)
+	if isARMNotFound(err) {
+		return nil, &NotFoundError{Resource: r.cluster.String() + "/agentPools/" + r.pool}
+	}
+	if err != nil {
+		return nil, azclient.WrapError(ctx, fmt.Errorf("get agent pool %q: %w", r.pool, err))
+	}
+	return agentPoolFromARM(r.pool, resp.AgentPool), nil
+}
+
+func agentPoolFromARM(name string, pool armcontainerservice.AgentPool) *AgentPool {
+	result := &AgentPool{Name: name}
+	properties := pool.Properties
+	if properties == nil {
+		return result
+	}
+	if properties.Mode != nil {
+		result.Mode = string(*properties.Mode)
+	}
+	if properties.MaxPods != nil {
+		result.MaxPods = int(*properties.MaxPods)
+	}
+	if properties.NodeLabels != nil {
+		result.NodeLabels = stringMapFromPointers(properties.NodeLabels)
+	}
+	if properties.NodeTaints != nil {
+		result.NodeTaints = stringSliceFromPointers(properties.NodeTaints)
+	}
+	if kubelet := properties.KubeletConfig; kubelet != nil {
+		if kubelet.ImageGcHighThreshold != nil {
+			result.KubeletConfig.ImageGCHighThreshold = int(*kubelet.ImageGcHighThreshold)
+		}
+		if kubelet.ImageGcLowThreshold != nil {
+			result.KubeletConfig.ImageGCLowThreshold = int(*kubelet.ImageGcLowThreshold)
+		}
+	}
+	return result
+}
+
+// AlignWithAgentPool checks that the target agent pool exists in the cluster
+// and warns unless it is a Machines pool, which flex nodes join. With
+// azure.inheritAgentPoolProfile it then merges the pool's profile into
+// cfg.Node with MergeNodeProfile.
+//
+// A pool that does not exist is logged and the node keeps its local config,
+// so a pool created after the node still works. Other read failures only fail
+// when the profile is inherited, since the node can register without it.
+func AlignWithAgentPool(ctx context.Context, log *slog.Logger, cfg *config.Config, pools AgentPoolReader) error {
+	pool, err := pools.GetAgentPool(ctx)
+	var notFound *NotFoundError
+	switch {
+	case errors.As(err, &notFound):
+		log.Warn("target agent pool does not exist in the cluster; using the local node config",
+			"pool", cfg.Azure.TargetAgentPoolName, "cluster", cfg.Azure.TargetCluster.Name)
+		return nil
+	case err != nil && cfg.Azure.InheritAgentPoolProfile:
+		return fmt.Errorf("read agent pool profile: %w", err)
+	case err != nil:
+		log.Warn("could not validate the target agent pool", "pool", cfg.Azure.TargetAgentPoolName, "error", err)
+		return nil
+	}
+	if pool.Mode != "" && !strings.EqualFold(pool.Mode, string(armcontainerservice.AgentPoolModeMachines)) {
+		log.Warn("target agent pool is not a Machines pool; the node may not register", "pool", pool.Name, "mode", pool.Mode)
+	}
+	if !cfg.Azure.InheritAgentPoolProfile {
+		return nil
+	}
+
+	MergeNodeProfile(cfg, GoalState{
+		MaxPods:       pool.MaxPods,
+		NodeLabels:    pool.NodeLabels,
+		NodeTaints:    pool.NodeTaints,
+		KubeletConfig: pool.KubeletConfig,
+	})
+	log.Info("inherited agent pool profile",
+		"pool", pool.Name,
+		"labels", len(pool.NodeLabels),
+		"taints", len(pool.NodeTaints),
+		"maxPods", cfg.Node.MaxPods,
+	)
+	return nil
+}
+
+// MergeNodeProfile merges the agent pool profile in goal into cfg.Node. The
+// goal's max pods and image GC thresholds, when set, replace the local ones.
+// With azure.inheritAgentPoolProfile, labels the config does not set and
+// taints it lacks are added as well; local labels win.
+func MergeNodeProfile(cfg *config.Config, goal GoalState) {
+	if cfg.Azure.InheritAgentPoolProfile {
+		if cfg.Node.Labels == nil && len(goal.NodeLabels) > 0 {
+			cfg.Node.Labels = map[string]string{}
+		}
+		for key, value := range goal.NodeLabels {
+			if _, ok := cfg.Node.Labels[key]; !ok {
+				cfg.Node.Labels[key] = value
+			}
+		}
+		for _, taint := range goal.NodeTaints {
+			if !slices.Contains(cfg.Node.Taints, taint) {
+				cfg.Node.Taints = append(cfg.Node.Taints, taint)
+			}
+		}
+	}
+	if goal.MaxPods > 0 {
+		cfg.Node.MaxPods = goal.MaxPods
+	}
+	if goal.KubeletConfig.ImageGCHighThreshold > 0 {
+		cfg.Node.Kubelet.ImageGCHighThreshold = goal.KubeletConfig.ImageGCHighThreshold
+	}
+	if goal.KubeletConfig.ImageGCLowThreshold > 0 {
+		cfg.Node.Kubelet.ImageGCLowThreshold = goal.KubeletConfig.ImageGCLowThreshold
+	}
+}
@@ -0,0 +1,117 @@
+package aksmachine
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+type fakeAgentPoolReader struct {
+	pool *AgentPool
+	err  error
+}
+
+func (f fakeAgentPoolReader) GetAgentPool(context.Context) (*AgentPool, error) {
+	return f.pool, f.err
+}
+
+func agentPoolTestConfig(inherit bool) *config.Config {
+	return &config.Config{
+		Azure: config.AzureConfig{
+			TargetCluster:           &config.TargetClusterConfig{Name: "cluster"},
+			TargetAgentPoolName:     "gpu",
+			InheritAgentPoolProfile: inherit,
+		},
+		Node: config.NodeConfig{
+			MaxPods: 110,
+			Labels:  map[string]string{"team": "edge", config.AgentPoolLabel: "gpu"},
+			Taints:  []string{"edge=true:NoSchedule"},
+		},
+	}
+}
+
+func TestAlignWithAgentPoolErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		inherit bool
+		reader  AgentPoolReader
+		wantErr string
+	}{
+		{name: "missing pool falls back to the local config", reader: fakeAgentPoolReader{err: &NotFoundError{Resource: "gpu"}}},
+		{name: "missing pool with inherit", inherit: true, reader: fakeAgentPoolReader{err: &NotFoundError{Resource: "gpu"}}},
+		{name: "read error without inherit", reader: fakeAgentPoolReader{err: errors.New("forbidden")}},
+		{name: "read error with inherit", inherit: true, reader: fakeAgentPoolReader{err: errors.New("forbidden")}, wantErr: "forbidden"},
+		{name: "system pool", reader: fakeAgentPoolReader{pool: &AgentPool{Name: "gpu", Mode: "System"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := AlignWithAgentPool(t.Context(), slog.New(slog.DiscardHandler), agentPoolTestConfig(tt.inherit), tt.reader)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("AlignWithAgentPool() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("AlignWithAgentPool() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAlignWithAgentPoolInheritsProfile(t *testing.T) {
+	t.Parallel()
+
+	pool := &AgentPool{
+		Name:          "gpu",
+		Mode:          "Machines",
+		MaxPods:       50,
+		NodeLabels:    map[string]string{"team": "ml", "accelerator": "nvidia"},
+		NodeTaints:    []string{"edge=true:NoSchedule", "gpu=true:NoSchedule"},
+		KubeletConfig: KubeletConfig{ImageGCHighThreshold: 90, ImageGCLowThreshold: 70},
+	}
+
+	cfg := agentPoolTestConfig(false)
+	if err := AlignWithAgentPool(t.Context(), slog.New(slog.DiscardHandler), cfg, fakeAgentPoolReader{pool: pool}); err != nil {
+		t.Fatalf("AlignWithAgentPool() error = %v", err)
+	}
+	if cfg.Node.MaxPods != 110 || len(cfg.Node.Labels) != 2 {
+		t.Errorf("profile was merged without inheritAgentPoolProfile: %+v", cfg.Node)
+	}
+
+	cfg = agentPoolTestConfig(true)
+	if err := AlignWithAgentPool(t.Context(), slog.New(slog.DiscardHandler), cfg, fakeAgentPoolReader{pool: pool}); err != nil {
+		t.Fatalf("AlignWithAgentPool() error = %v", err)
+	}
+	if cfg.Node.Labels["team"] != "edge" || cfg.Node.Labels["accelerator"] != "nvidia" {
+		t.Errorf("labels = %v, want local team kept and accelerator added", cfg.Node.Labels)
+	}
+	if want := []string{"edge=true:NoSchedule", "gpu=true:NoSchedule"}; !slices.Equal(cfg.Node.Taints, want) {
+		t.Errorf("taints = %v, want %v", cfg.Node.Taints, want)
+	}
+	if cfg.Node.MaxPods != 50 || cfg.Node.Kubelet.ImageGCHighThreshold != 90 || cfg.Node.Kubelet.ImageGCLowThreshold != 70 {
+		t.Errorf("node = %+v, want the pool's max pods and GC thresholds", cfg.Node)
+	}
+}
+
+func TestMergeNodeProfileWithoutInherit(t *testing.T) {
+	t.Parallel()
+
+	cfg := agentPoolTestConfig(false)
+	MergeNodeProfile(cfg, GoalState{MaxPods: 30, NodeLabels: map[string]string{"accelerator": "nvidia"}, NodeTaints: []string{"gpu=true:NoSchedule"}})
+	if cfg.Node.MaxPods != 30 {
+		t.Errorf("MaxPods = %d, want the goal's 30", cfg.Node.MaxPods)
+	}
+	if len(cfg.Node.Labels) != 2 || len(cfg.Node.Taints) != 1 {
+		t.Errorf("node = %+v, want labels and taints left alone without inheritAgentPoolProfile", cfg.Node)
+	}
+}
@@ -2,10 +2,14 @@ package aksmachine
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -15,8 +19,13 @@ import (
 
 	"github.com/Azure/AKSFlexNode/pkg/azclient"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/tokencache"
 )
 
+// arcHIMDSPath is the Azure Connected Machine agent's identity service,
+// whose presence marks a host connected to Azure Arc.
+const arcHIMDSPath = "/opt/azcmagent/bin/himds"
+
 type armMachineClient struct {
 	machineID *arm.ResourceID
 	client    *armcontainerservice.MachinesClient
@@ -57,7 +66,8 @@ func (c *armMachineClient) Create(ctx context.Context, desired GoalState) (*Mach
 	}
 	agentPoolID := c.machineID.Parent
 	clusterID := agentPoolID.Parent
-	c.logger.Info("creating or updating AKS machine", "machine", c.machineID.Name, "pool", agentPoolID.Name)
+	ctx, correlationID := azclient.WithCorrelationID(ctx)
+	c.logger.Info("creating or updating AKS machine", "machine", c.machineID.Name, "pool", agentPoolID.Name, "correlationID", correlationID)
 	poller, err := c.client.BeginCreateOrUpdate(
 		ctx,
 		c.machineID.ResourceGroupName,
@@ -68,11 +78,11 @@ func (c *armMachineClient) Create(ctx context.Context, desired GoalState) (*Mach
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("begin create machine %q: %w", c.machineID.Name, err)
+		return nil, azclient.WrapError(ctx, fmt.Errorf("begin create machine %q: %w", c.machineID.Name, err))
 	}
 	resp, err := poller.PollUntilDone(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("wait for machine %q: %w", c.machineID.Name, err)
+		return nil, azclient.WrapError(ctx, fmt.Errorf("wait for machine %q: %w", c.machineID.Name, err))
 	}
 	if err := c.validateMachineIdentity(resp.Machine); err != nil {
 		return nil, err
@@ -86,6 +96,7 @@ func (c *armMachineClient) Create(ctx context.Context, desired GoalState) (*Mach
 func (c *armMachineClient) Get(ctx context.Context) (*Machine, error) {
 	agentPoolID := c.machineID.Parent
 	clusterID := agentPoolID.Parent
+	ctx, _ = azclient.WithCorrelationID(ctx)
 	resp, err := c.client.Get(
 		ctx,
 		c.machineID.ResourceGroupName,
@@ -98,7 +109,7 @@ func (c *armMachineClient) Get(ctx context.Context) (*Machine, error) {
 		return nil, &NotFoundError{Resource: c.machineID.String()}
 	}
 	if err != nil {
-		return nil, fmt.Errorf("get machine %q: %w", c.machineID.Name, err)
+		return nil, azclient.WrapError(ctx, fmt.Errorf("get machine %q: %w", c.machineID.Name, err))
 	}
 	if err := c.validateMachineIdentity(resp.Machine); err != nil {
 		return nil, err
@@ -157,8 +168,65 @@ func azureClientOptionsFromConfig(cfg *config.Config) azcore.ClientOptions {
 	return azclient.ClientOptionsFromConfig(cfg)
 }
 
+// NewCredential returns the Azure credential the machine client uses, for
+// other Azure calls the agent makes on the node's behalf.
+func NewCredential(cfg *config.Config, logger *slog.Logger) (azcore.TokenCredential, error) {
+	return getCredential(cfg, logger, azureClientOptionsFromConfig(cfg))
+}
+
+// getCredential returns the credential for cfg's authentication method,
+// serving its tokens from the process-wide token cache.
 func getCredential(cfg *config.Config, logger *slog.Logger, clientOpts azcore.ClientOptions) (azcore.TokenCredential, error) {
+	cred, err := newCredential(cfg, logger, clientOpts)
+	if err != nil {
+		return nil, err
+	}
+	method, identity := credentialIdentity(cfg)
+	return tokencache.Default().Wrap(method, identity, cred), nil
+}
+
+// credentialIdentity names cfg's authentication method and the principal it
+// authenticates as, which is empty for the default credential chain.
+func credentialIdentity(cfg *config.Config) (method, identity string) {
 	switch {
+	case cfg.IsSPCertificateConfigured():
+		return "service-principal-certificate", cfg.Azure.ServicePrincipal.TenantID + "/" + cfg.Azure.ServicePrincipal.ClientID
+	case cfg.IsSPConfigured():
+		return "service-principal", cfg.Azure.ServicePrincipal.TenantID + "/" + cfg.Azure.ServicePrincipal.ClientID
+	case cfg.IsWorkloadIdentityConfigured():
+		return "workload-identity", cfg.Azure.WorkloadIdentity.TenantID + "/" + cfg.Azure.WorkloadIdentity.ClientID
+	case cfg.IsArcManagedIdentityConfigured():
+		return "arc-managed-identity", "system"
+	case cfg.IsMIConfigured():
+		if cfg.Azure.ManagedIdentity.ClientID != "" {
+			return "managed-identity", cfg.Azure.ManagedIdentity.ClientID
+		}
+		return "managed-identity", "system"
+	default:
+		return "default", ""
+	}
+}
+
+func newCredential(cfg *config.Config, logger *slog.Logger, clientOpts azcore.ClientOptions) (azcore.TokenCredential, error) {
+	switch {
+	case cfg.IsSPCertificateConfigured():
+		logger.Debug(
+			"using service principal certificate credential for ARM",
+			"tenantID", cfg.Azure.ServicePrincipal.TenantID,
+			"clientID", cfg.Azure.ServicePrincipal.ClientID,
+			"certificateFile", cfg.Azure.ServicePrincipal.CertificateFile,
+		)
+		certs, key, err := loadClientCertificate(cfg.Azure.ServicePrincipal.CertificateFile)
+		if err != nil {
+			return nil, err
+		}
+		return azidentity.NewClientCertificateCredential(
+			cfg.Azure.ServicePrincipal.TenantID,
+			cfg.Azure.ServicePrincipal.ClientID,
+			certs,
+			key,
+			&azidentity.ClientCertificateCredentialOptions{ClientOptions: clientOpts},
+		)
 	case cfg.IsSPConfigured():
 		logger.Debug(
 			"using service principal credential for ARM",
@@ -171,6 +239,27 @@ func getCredential(cfg *config.Config, logger *slog.Logger, clientOpts azcore.Cl
 			cfg.Azure.ServicePrincipal.ClientSecret,
 			&azidentity.ClientSecretCredentialOptions{ClientOptions: clientOpts},
 		)
+	case cfg.IsWorkloadIdentityConfigured():
+		logger.Debug(
+			"using workload identity credential for ARM",
+			"tenantID", cfg.Azure.WorkloadIdentity.TenantID,
+			"clientID", cfg.Azure.WorkloadIdentity.ClientID,
+			"tokenFile", cfg.Azure.WorkloadIdentity.TokenFile,
+		)
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: clientOpts,
+			TenantID:      cfg.Azure.WorkloadIdentity.TenantID,
+			ClientID:      cfg.Azure.WorkloadIdentity.ClientID,
+			TokenFilePath: cfg.Azure.WorkloadIdentity.TokenFile,
+		})
+	case cfg.IsArcManagedIdentityConfigured():
+		// The credential falls back to the Azure VM endpoint when himds is
+		// missing, which fails with a less helpful error off Azure.
+		if _, err := os.Stat(arcHIMDSPath); err != nil {
+			return nil, fmt.Errorf("managed identity source %q needs a host connected to Azure Arc: %w", config.ManagedIdentitySourceArc, err)
+		}
+		logger.Debug("using Arc machine identity credential for ARM")
+		return azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOpts})
 	case cfg.IsMIConfigured():
 		opts := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOpts}
 		if cfg.Azure.ManagedIdentity != nil && cfg.Azure.ManagedIdentity.ClientID != "" {
@@ -189,6 +278,20 @@ func getCredential(cfg *config.Config, logger *slog.Logger, clientOpts azcore.Cl
 	}
 }
 
+// loadClientCertificate reads a PEM file holding a client certificate and
+// its unencrypted private key.
+func loadClientCertificate(path string) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read service principal certificate: %w", err)
+	}
+	certs, key, err := azidentity.ParseCertificates(data, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse service principal certificate %s: %w", path, err)
+	}
+	return certs, key, nil
+}
+
 func buildK8sProfile(goal GoalState) *armcontainerservice.MachineKubernetesProfile {
 	// FlexNode RP accepts the registration surface below; local kubelet defaults
 	// are consumed during node bootstrap and must not be sent as Machine fields.
@@ -14,7 +14,9 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v8"
 
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/version"
 )
 
 const (
@@ -39,7 +41,9 @@ func newARMProxyClient(cfg *config.Config, logger *slog.Logger) (MachineClient,
 		staticARMProxyCredential{},
 		&arm.ClientOptions{
 			ClientOptions: policy.ClientOptions{
-				Transport: transport,
+				Transport:       transport,
+				Telemetry:       policy.TelemetryOptions{ApplicationID: version.ApplicationID()},
+				PerCallPolicies: azclient.PerCallPolicies(cfg),
 			},
 		})
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
 
@@ -59,6 +60,13 @@ func (t *ensureMachineTask) Do(ctx context.Context) error {
 	if err != nil {
 		return t.handleError("create machine", err)
 	}
+	if machine != nil {
+		audit.Record(ctx, t.logger, audit.Event{
+			Operation: audit.OperationAzureResourceCreate,
+			Target:    machine.ID,
+			Detail:    "AKS machine " + machine.Name,
+		})
+	}
 	return t.adoptSettingsVersion(machine, "create machine")
 }
 
@@ -0,0 +1,399 @@
+// Package apiprobe checks the Kubernetes API server through the same
+// credentials the kubelet uses and explains what fails.
+//
+// A kubelet that cannot register usually logs nothing more than
+// "Unauthorized" or a connection error. The probe runs the steps in the order
+// they can fail (TCP and TLS handshake, /healthz, then authorization of the
+// verbs node registration needs) and classifies the first failure as a
+// connectivity, TLS, authentication, authorization, or server problem, with
+// the certificate chain and expiry that were actually presented.
+package apiprobe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Failure classifies the first failing probe step.
+type Failure string
+
+const (
+	FailureNone           Failure = ""
+	FailureConnectivity   Failure = "connectivity"
+	FailureTLS            Failure = "tls"
+	FailureAuthentication Failure = "authentication"
+	FailureAuthorization  Failure = "authorization"
+	FailureServer         Failure = "server"
+
+	// DefaultTimeout bounds each probe step.
+	DefaultTimeout = 10 * time.Second
+
+	// expiryWarning is how far ahead certificate expiry is reported.
+	expiryWarning = 7 * 24 * time.Hour
+
+	maxHealthzBody = 1024
+)
+
+// CertInfo describes one certificate.
+type CertInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// TLSResult is the outcome of the TLS handshake. ServerChain is filled even
+// when verification fails, so a wrong CA or expired serving certificate shows
+// what the server actually presented.
+type TLSResult struct {
+	Version     string     `json:"version,omitempty"`
+	ServerChain []CertInfo `json:"serverChain,omitempty"`
+	ClientCert  *CertInfo  `json:"clientCert,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// HealthzResult is the outcome of GET /healthz.
+type HealthzResult struct {
+	StatusCode int    `json:"statusCode,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AccessCheck is one verb the credentials must be allowed to perform.
+type AccessCheck struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+}
+
+func (c AccessCheck) String() string {
+	resource := c.Resource
+	if c.Subresource != "" {
+		resource += "/" + c.Subresource
+	}
+	if c.Group != "" {
+		resource += "." + c.Group
+	}
+	if c.Namespace != "" {
+		resource = c.Namespace + "/" + resource
+	}
+	return c.Verb + " " + resource
+}
+
+// AccessResult is the SelfSubjectAccessReview outcome for one check.
+type AccessResult struct {
+	AccessCheck
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report is the full probe result.
+type Report struct {
+	Source    string         `json:"source"`
+	Server    string         `json:"server"`
+	CheckedAt time.Time      `json:"checkedAt"`
+	TLS       TLSResult      `json:"tls"`
+	Healthz   HealthzResult  `json:"healthz"`
+	Access    []AccessResult `json:"access,omitempty"`
+	Failure   Failure        `json:"failure,omitempty"`
+	Message   string         `json:"message,omitempty"`
+	Warnings  []string       `json:"warnings,omitempty"`
+}
+
+// Healthy reports whether every step passed.
+func (r *Report) Healthy() bool { return r.Failure == FailureNone }
+
+func (r *Report) fail(failure Failure, format string, args ...any) {
+	if r.Failure != FailureNone {
+		return
+	}
+	r.Failure = failure
+	r.Message = fmt.Sprintf(format, args...)
+}
+
+// Target is a set of credentials to probe and the access they need.
+type Target struct {
+	// Source describes where the credentials came from, e.g. a kubeconfig path.
+	Source string
+	Config *rest.Config
+	Access []AccessCheck
+}
+
+// Probe runs all steps against target. It never returns an error; failures
+// are described in the report.
+func Probe(ctx context.Context, target Target) Report {
+	report := Report{Source: target.Source, Server: target.Config.Host, CheckedAt: time.Now().UTC()}
+	now := report.CheckedAt
+
+	cert, err := clientCertificate(target.Config)
+	if err != nil {
+		report.TLS.Error = err.Error()
+		report.fail(FailureAuthentication, "read client certificate: %v", err)
+		return report
+	}
+	if cert != nil {
+		report.TLS.ClientCert = cert
+		if now.After(cert.NotAfter) {
+			report.fail(FailureAuthentication, "client certificate %q expired at %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+			return report
+		}
+		report.warnExpiry("client certificate", *cert, now)
+	}
+
+	if !probeTLS(ctx, target.Config, &report) {
+		return report
+	}
+	if !probeHealthz(ctx, target.Config, &report) {
+		return report
+	}
+	probeAccess(ctx, target, &report)
+	return report
+}
+
+func (r *Report) warnExpiry(what string, cert CertInfo, now time.Time) {
+	if cert.NotAfter.Sub(now) < expiryWarning {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%s %q expires soon, at %s", what, cert.Subject, cert.NotAfter.Format(time.RFC3339)))
+	}
+}
+
+func probeTLS(ctx context.Context, cfg *rest.Config, report *Report) bool {
+	u, err := url.Parse(cfg.Host)
+	if err != nil || u.Host == "" {
+		report.TLS.Error = fmt.Sprintf("invalid server URL %q", cfg.Host)
+		report.fail(FailureConnectivity, "invalid server URL %q", cfg.Host)
+		return false
+	}
+	if u.Scheme != "https" {
+		return true
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "443")
+	}
+	tlsConfig, err := rest.TLSConfigFor(cfg)
+	if err != nil {
+		report.TLS.Error = err.Error()
+		report.fail(FailureTLS, "build TLS config: %v", err)
+		return false
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	state, err := handshake(ctx, address, tlsConfig)
+	if err == nil {
+		report.TLS.Version = tls.VersionName(state.Version)
+		report.TLS.ServerChain = certInfos(state.PeerCertificates)
+		if len(state.PeerCertificates) > 0 {
+			report.warnExpiry("server certificate", report.TLS.ServerChain[0], report.CheckedAt)
+		}
+		return true
+	}
+	report.TLS.Error = err.Error()
+	if !isTLSError(err) {
+		report.fail(FailureConnectivity, "connect to %s: %v", address, err)
+		return false
+	}
+	// Handshake again without verification only to describe the chain the
+	// server presented; nothing is sent over this connection.
+	insecure := tlsConfig.Clone()
+	insecure.InsecureSkipVerify = true //nolint:gosec // used only to read the presented chain for diagnostics
+	insecure.VerifyPeerCertificate = nil
+	if state, err := handshake(ctx, address, insecure); err == nil {
+		report.TLS.Version = tls.VersionName(state.Version)
+		report.TLS.ServerChain = certInfos(state.PeerCertificates)
+	}
+	report.fail(FailureTLS, "TLS handshake with %s: %v", address, err)
+	return false
+}
+
+func handshake(ctx context.Context, address string, cfg *tls.Config) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close() //nolint:errcheck // probe connection
+	return conn.(*tls.Conn).ConnectionState(), nil
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		verification     *tls.CertificateVerificationError
+		alert            tls.AlertError
+		record           tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) ||
+		errors.As(err, &verification) || errors.As(err, &alert) || errors.As(err, &record) ||
+		strings.Contains(err.Error(), "tls:")
+}
+
+func probeHealthz(ctx context.Context, cfg *rest.Config, report *Report) bool {
+	client, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		report.Healthz.Error = err.Error()
+		report.fail(FailureAuthentication, "build client: %v", err)
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(cfg.Host, "/")+"/healthz", nil)
+	if err != nil {
+		report.Healthz.Error = err.Error()
+		report.fail(FailureConnectivity, "build /healthz request: %v", err)
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		report.Healthz.Error = err.Error()
+		if isCredentialError(err) {
+			report.fail(FailureAuthentication, "get credentials: %v", err)
+		} else {
+			report.fail(FailureConnectivity, "GET /healthz: %v", err)
+		}
+		return false
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthzBody))
+	report.Healthz.StatusCode = resp.StatusCode
+	report.Healthz.Body = strings.TrimSpace(string(body))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true
+	case resp.StatusCode == http.StatusUnauthorized:
+		report.fail(FailureAuthentication, "API server rejected the credentials (401 Unauthorized); the token or client certificate is invalid, expired, or not trusted by the cluster")
+	case resp.StatusCode == http.StatusForbidden:
+		report.fail(FailureAuthorization, "credentials were accepted but may not read /healthz (403 Forbidden)")
+	default:
+		report.fail(FailureServer, "/healthz returned %d: %s", resp.StatusCode, report.Healthz.Body)
+	}
+	return false
+}
+
+// isCredentialError matches client-go failures to obtain credentials, such as
+// an exec plugin that is missing or exits non-zero.
+func isCredentialError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "getting credentials") || strings.Contains(msg, "exec plugin")
+}
+
+func probeAccess(ctx context.Context, target Target, report *Report) {
+	if len(target.Access) == 0 {
+		return
+	}
+	clientset, err := kubernetes.NewForConfig(target.Config)
+	if err != nil {
+		report.fail(FailureAuthentication, "build client: %v", err)
+		return
+	}
+	var denied []string
+	for _, check := range target.Access {
+		result := AccessResult{AccessCheck: check}
+		reviewCtx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(reviewCtx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:        check.Verb,
+					Group:       check.Group,
+					Resource:    check.Resource,
+					Subresource: check.Subresource,
+					Namespace:   check.Namespace,
+				},
+			},
+		}, metav1.CreateOptions{})
+		cancel()
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+			if apierrors.IsUnauthorized(err) {
+				report.fail(FailureAuthentication, "API server rejected the credentials (401 Unauthorized)")
+			} else {
+				report.fail(FailureServer, "SelfSubjectAccessReview for %s: %v", check, err)
+			}
+		default:
+			result.Allowed = review.Status.Allowed
+			result.Reason = review.Status.Reason
+			if review.Status.EvaluationError != "" {
+				result.Error = review.Status.EvaluationError
+			}
+			if !result.Allowed {
+				denied = append(denied, check.String())
+			}
+		}
+		report.Access = append(report.Access, result)
+	}
+	if len(denied) > 0 {
+		report.fail(FailureAuthorization, "credentials are authenticated but not allowed to %s; check the RBAC bindings for this identity", strings.Join(denied, ", "))
+	}
+}
+
+// clientCertificate returns the leaf client certificate configured in cfg,
+// or nil when the credentials are not certificate based.
+func clientCertificate(cfg *rest.Config) (*CertInfo, error) {
+	data := cfg.CertData
+	if len(data) == 0 && cfg.CertFile != "" {
+		var err error
+		if data, err = os.ReadFile(cfg.CertFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	info := certInfo(cert)
+	return &info, nil
+}
+
+func certInfos(certs []*x509.Certificate) []CertInfo {
+	infos := make([]CertInfo, 0, len(certs))
+	for _, cert := range certs {
+		infos = append(infos, certInfo(cert))
+	}
+	return infos
+}
+
+func certInfo(cert *x509.Certificate) CertInfo {
+	return CertInfo{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+	}
+}
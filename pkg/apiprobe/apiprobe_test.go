@@ -0,0 +1,310 @@
+package apiprobe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+// fakeAPIServer answers /healthz with healthz and allows every access review
+// whose verb is not in deny.
+func fakeAPIServer(t *testing.T, healthz int, deny ...string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(healthz)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("POST /apis/authorization.k8s.io/v1/selfsubjectaccessreviews", func(w http.ResponseWriter, r *http.Request) {
+		// client-go sends protobuf by default; decode whatever it sent and
+		// answer in JSON, which it also accepts.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var review authorizationv1.SelfSubjectAccessReview
+		if _, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, &review); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		review.APIVersion = "authorization.k8s.io/v1"
+		review.Kind = "SelfSubjectAccessReview"
+		review.Status.Allowed = true
+		for _, verb := range deny {
+			if review.Spec.ResourceAttributes.Verb == verb {
+				review.Status.Allowed = false
+				review.Status.Reason = "no RBAC policy matched"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(review)
+	})
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func trustedConfig(server *httptest.Server) *rest.Config {
+	return &rest.Config{
+		Host:            server.URL,
+		BearerToken:     "abcdef.0123456789abcdef",
+		TLSClientConfig: rest.TLSClientConfig{CAData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})},
+	}
+}
+
+func TestProbeHealthy(t *testing.T) {
+	t.Parallel()
+
+	server := fakeAPIServer(t, http.StatusOK)
+	report := Probe(context.Background(), Target{Source: "test", Config: trustedConfig(server), Access: BootstrapAccess})
+	if !report.Healthy() {
+		t.Fatalf("report not healthy: %s: %s", report.Failure, report.Message)
+	}
+	if len(report.TLS.ServerChain) == 0 || report.TLS.Version == "" {
+		t.Fatalf("TLS = %+v, want handshake details", report.TLS)
+	}
+	if report.Healthz.StatusCode != http.StatusOK {
+		t.Fatalf("healthz status = %d", report.Healthz.StatusCode)
+	}
+	if len(report.Access) != len(BootstrapAccess) {
+		t.Fatalf("access results = %d, want %d", len(report.Access), len(BootstrapAccess))
+	}
+}
+
+func TestProbeFailures(t *testing.T) {
+	t.Parallel()
+
+	closed := httptest.NewTLSServer(http.NotFoundHandler())
+	closedCfg := trustedConfig(closed)
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		config  func(t *testing.T) *rest.Config
+		want    Failure
+		wantMsg string
+	}{
+		{
+			name:   "connection refused",
+			config: func(*testing.T) *rest.Config { return closedCfg },
+			want:   FailureConnectivity,
+		},
+		{
+			name: "untrusted server certificate",
+			config: func(t *testing.T) *rest.Config {
+				cfg := trustedConfig(fakeAPIServer(t, http.StatusOK))
+				cfg.CAData = selfSignedPEM(t, time.Now().Add(time.Hour))
+				return cfg
+			},
+			want: FailureTLS,
+		},
+		{
+			name:    "rejected credentials",
+			config:  func(t *testing.T) *rest.Config { return trustedConfig(fakeAPIServer(t, http.StatusUnauthorized)) },
+			want:    FailureAuthentication,
+			wantMsg: "401",
+		},
+		{
+			name: "unhealthy server",
+			config: func(t *testing.T) *rest.Config {
+				return trustedConfig(fakeAPIServer(t, http.StatusInternalServerError))
+			},
+			want:    FailureServer,
+			wantMsg: "500",
+		},
+		{
+			name:    "missing RBAC",
+			config:  func(t *testing.T) *rest.Config { return trustedConfig(fakeAPIServer(t, http.StatusOK, "create")) },
+			want:    FailureAuthorization,
+			wantMsg: "create certificatesigningrequests.certificates.k8s.io",
+		},
+		{
+			name: "expired client certificate",
+			config: func(t *testing.T) *rest.Config {
+				cfg := trustedConfig(fakeAPIServer(t, http.StatusOK))
+				cfg.CertData = selfSignedPEM(t, time.Now().Add(-time.Hour))
+				return cfg
+			},
+			want:    FailureAuthentication,
+			wantMsg: "expired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			report := Probe(context.Background(), Target{Source: "test", Config: tt.config(t), Access: BootstrapAccess})
+			if report.Failure != tt.want {
+				t.Fatalf("Failure = %q (%s), want %q", report.Failure, report.Message, tt.want)
+			}
+			if !strings.Contains(report.Message, tt.wantMsg) {
+				t.Fatalf("Message = %q, want it to contain %q", report.Message, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestProbeTLSFailureDescribesPresentedChain(t *testing.T) {
+	t.Parallel()
+
+	cfg := trustedConfig(fakeAPIServer(t, http.StatusOK))
+	cfg.CAData = selfSignedPEM(t, time.Now().Add(time.Hour))
+	report := Probe(context.Background(), Target{Config: cfg})
+	if report.Failure != FailureTLS {
+		t.Fatalf("Failure = %q, want tls", report.Failure)
+	}
+	if len(report.TLS.ServerChain) == 0 || !strings.Contains(report.TLS.ServerChain[0].Issuer, "Acme") {
+		t.Fatalf("ServerChain = %+v, want the httptest certificate", report.TLS.ServerChain)
+	}
+}
+
+func TestProbeWarnsAboutExpiringClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	cfg := trustedConfig(fakeAPIServer(t, http.StatusOK))
+	cfg.CertData = selfSignedPEM(t, time.Now().Add(24*time.Hour))
+	report := Probe(context.Background(), Target{Config: cfg})
+	if !report.Healthy() {
+		t.Fatalf("report not healthy: %s", report.Message)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "client certificate") {
+		t.Fatalf("Warnings = %v, want client certificate expiry", report.Warnings)
+	}
+}
+
+func TestKubeletTargetRebasesMachinePaths(t *testing.T) {
+	t.Parallel()
+
+	machineDir := t.TempDir()
+	kubeconfig := filepath.Join(machineDir, "var", "lib", "kubelet", "kubeconfig")
+	pki := filepath.Join(machineDir, "var", "lib", "kubelet", "pki")
+	caFile := filepath.Join(machineDir, "etc", "kubernetes", "certs", "ca.crt")
+	for _, dir := range []string{pki, filepath.Dir(caFile)} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	certPEM := selfSignedPEM(t, time.Now().Add(time.Hour))
+	datedCert := filepath.Join(pki, "kubelet-client-2026-01-01-00-00-00.pem")
+	for path, data := range map[string][]byte{caFile: certPEM, datedCert: certPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	// The kubelet links the current certificate with an absolute path that
+	// is only valid inside the machine.
+	if err := os.Symlink("/var/lib/kubelet/pki/kubelet-client-2026-01-01-00-00-00.pem", filepath.Join(pki, "kubelet-client-current.pem")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://api.example.test:443
+    certificate-authority: /etc/kubernetes/certs/ca.crt
+users:
+- name: kubelet
+  user:
+    client-certificate: /var/lib/kubelet/pki/kubelet-client-current.pem
+    client-key: /var/lib/kubelet/pki/kubelet-client-current.pem
+contexts:
+- name: kubelet
+  context:
+    cluster: cluster
+    user: kubelet
+current-context: kubelet
+`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	target, err := KubeletTarget(machineDir)
+	if err != nil {
+		t.Fatalf("KubeletTarget: %v", err)
+	}
+	if target.Source != kubeconfig {
+		t.Errorf("Source = %q, want %q", target.Source, kubeconfig)
+	}
+	if target.Config.CAFile != caFile {
+		t.Errorf("CAFile = %q, want %q", target.Config.CAFile, caFile)
+	}
+	if target.Config.CertFile != datedCert {
+		t.Errorf("CertFile = %q, want %q", target.Config.CertFile, datedCert)
+	}
+	if len(target.Access) != len(NodeAccess) {
+		t.Errorf("Access = %v, want node registration checks", target.Access)
+	}
+
+	if _, err := KubeletTarget(t.TempDir()); !os.IsNotExist(err) && !strings.Contains(err.Error(), "no kubelet kubeconfig") {
+		t.Errorf("KubeletTarget(empty) error = %v, want not exist", err)
+	}
+}
+
+func TestPreflightResults(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		failure        Failure
+		bootstrapToken bool
+		want           preflight.Severity
+	}{
+		{name: "healthy", want: preflight.SeverityOK},
+		{name: "connectivity", failure: FailureConnectivity, want: preflight.SeverityError},
+		{name: "token rejected", failure: FailureAuthentication, bootstrapToken: true, want: preflight.SeverityError},
+		{name: "exec credential rejected", failure: FailureAuthentication, want: preflight.SeverityWarning},
+		{name: "exec credential unauthorized", failure: FailureAuthorization, want: preflight.SeverityWarning},
+	}
+	for _, tt := range tests {
+		got := results(Report{Server: "https://api", Failure: tt.failure, Message: "m"}, tt.bootstrapToken)
+		if len(got) != 1 || got[0].Severity != tt.want {
+			t.Errorf("%s: results = %+v, want severity %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// selfSignedPEM returns a self-signed certificate expiring at notAfter.
+func selfSignedPEM(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "system:node:test"},
+		NotBefore:             notAfter.Add(-48 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
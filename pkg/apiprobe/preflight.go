@@ -0,0 +1,63 @@
+package apiprobe
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const checkName = "kube-api"
+
+// Preflight returns a check that probes the API server with the bootstrap
+// credentials from cfg.
+func Preflight(cfg *config.Config) []preflight.Checker {
+	return []preflight.Checker{checker{cfg: cfg, probe: Probe}}
+}
+
+type checker struct {
+	cfg   *config.Config
+	probe func(context.Context, Target) Report
+}
+
+func (checker) Name() string { return checkName }
+
+func (c checker) Check(ctx context.Context) []preflight.Result {
+	target, err := BootstrapTarget(c.cfg)
+	if err != nil {
+		return preflight.ResultsError(checkName, "kube-apiserver", "build bootstrap client: %v", err)
+	}
+	return results(c.probe(ctx, target), c.cfg.IsBootstrapTokenConfigured())
+}
+
+// results maps a report to preflight results. Exec credentials (Arc, managed
+// identity, service principal) may only work once bootstrap installed their
+// dependencies, so authentication and authorization failures are warnings
+// for them; a bootstrap token must work up front.
+func results(report Report, bootstrapToken bool) []preflight.Result {
+	target := report.Server
+	var out []preflight.Result
+	for _, warning := range report.Warnings {
+		out = append(out, preflight.ResultsWarning(checkName, target, "%s", warning)...)
+	}
+	if report.Healthy() {
+		return append(out, preflight.ResultsOK(checkName, target, "TLS, /healthz, and "+accessSummary(report)+" passed")...)
+	}
+	credentialFailure := report.Failure == FailureAuthentication || report.Failure == FailureAuthorization
+	if credentialFailure && !bootstrapToken {
+		return append(out, preflight.ResultsWarning(checkName, target, "%s failure: %s", report.Failure, report.Message)...)
+	}
+	return append(out, preflight.ResultsError(checkName, target, "%s failure: %s", report.Failure, report.Message)...)
+}
+
+func accessSummary(report Report) string {
+	if len(report.Access) == 0 {
+		return "access checks"
+	}
+	checks := make([]string, 0, len(report.Access))
+	for _, a := range report.Access {
+		checks = append(checks, a.AccessCheck.String())
+	}
+	return strings.Join(checks, ", ")
+}
@@ -0,0 +1,82 @@
+package apiprobe
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary is a one-line description of the report for status output.
+func (r *Report) Summary() string {
+	if r.Healthy() {
+		return fmt.Sprintf("ok (checked %s)", r.CheckedAt.Local().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s failure: %s (checked %s)", r.Failure, r.Message, r.CheckedAt.Local().Format(time.RFC3339))
+}
+
+// WriteReport renders the full report for CLI output.
+func WriteReport(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	p := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(tw, format, args...)
+	}
+
+	p("Kubernetes API:\t%s\n", r.Server)
+	p("Credentials:\t%s\n", r.Source)
+	if r.Healthy() {
+		p("Result:\tok\n")
+	} else {
+		p("Result:\t%s failure\n", r.Failure)
+		p("Diagnosis:\t%s\n", r.Message)
+	}
+	for _, warning := range r.Warnings {
+		p("Warning:\t%s\n", warning)
+	}
+
+	p("\nTLS\n")
+	if r.TLS.Version != "" {
+		p("  Version:\t%s\n", r.TLS.Version)
+	}
+	for i, cert := range r.TLS.ServerChain {
+		p("  Server cert %d:\t%s\n", i, describeCert(cert))
+	}
+	if r.TLS.ClientCert != nil {
+		p("  Client cert:\t%s\n", describeCert(*r.TLS.ClientCert))
+	}
+	if r.TLS.Error != "" {
+		p("  Error:\t%s\n", r.TLS.Error)
+	}
+
+	p("\nHealthz\n")
+	switch {
+	case r.Healthz.StatusCode != 0:
+		p("  Status:\t%d %s\n", r.Healthz.StatusCode, r.Healthz.Body)
+	case r.Healthz.Error != "":
+		p("  Error:\t%s\n", r.Healthz.Error)
+	default:
+		p("  Status:\tnot checked\n")
+	}
+
+	if len(r.Access) > 0 {
+		p("\nAccess\n")
+		for _, a := range r.Access {
+			verdict := "denied"
+			if a.Allowed {
+				verdict = "allowed"
+			}
+			if a.Error != "" {
+				verdict += " (" + a.Error + ")"
+			} else if a.Reason != "" {
+				verdict += " (" + a.Reason + ")"
+			}
+			p("  %s:\t%s\n", a.AccessCheck, verdict)
+		}
+	}
+	return tw.Flush()
+}
+
+func describeCert(c CertInfo) string {
+	return fmt.Sprintf("%s, issued by %s, valid %s to %s", c.Subject, c.Issuer,
+		c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339))
+}
@@ -0,0 +1,120 @@
+package apiprobe
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/kubeauth"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+)
+
+// BootstrapAccess is what TLS bootstrap credentials need: requesting and
+// reading the kubelet client certificate.
+var BootstrapAccess = []AccessCheck{
+	{Verb: "create", Group: "certificates.k8s.io", Resource: "certificatesigningrequests"},
+	{Verb: "get", Group: "certificates.k8s.io", Resource: "certificatesigningrequests"},
+}
+
+// NodeAccess is what a registered kubelet needs to keep its Node and Lease
+// current.
+var NodeAccess = []AccessCheck{
+	{Verb: "create", Resource: "nodes"},
+	{Verb: "get", Resource: "nodes"},
+	{Verb: "patch", Resource: "nodes", Subresource: "status"},
+	{Verb: "get", Group: "coordination.k8s.io", Resource: "leases", Namespace: "kube-node-lease"},
+	{Verb: "update", Group: "coordination.k8s.io", Resource: "leases", Namespace: "kube-node-lease"},
+}
+
+// BootstrapTarget probes with the credentials the agent hands the kubelet for
+// TLS bootstrap. It works before any machine exists, so preflight uses it.
+func BootstrapTarget(cfg *config.Config) (Target, error) {
+	restCfg, err := kubeauth.BootstrapRESTConfig(cfg)
+	if err != nil {
+		return Target{}, err
+	}
+	return Target{Source: "bootstrap credentials from agent config", Config: restCfg, Access: BootstrapAccess}, nil
+}
+
+// KubeletTarget probes with the kubeconfig the kubelet in machineDir uses:
+// its rotated client kubeconfig once TLS bootstrap finished, otherwise the
+// bootstrap kubeconfig. It returns os.ErrNotExist when neither exists yet.
+func KubeletTarget(machineDir string) (Target, error) {
+	candidates := []struct {
+		path   string
+		access []AccessCheck
+	}{
+		{path: goalstates.KubeletKubeconfigPath, access: NodeAccess},
+		{path: goalstates.KubeletBootstrapKubeconfigPath, access: BootstrapAccess},
+	}
+	for _, c := range candidates {
+		hostPath := filepath.Join(machineDir, c.path)
+		if _, err := os.Stat(hostPath); err != nil {
+			continue
+		}
+		restCfg, err := machineRESTConfig(machineDir, hostPath)
+		if err != nil {
+			return Target{}, err
+		}
+		return Target{Source: hostPath, Config: restCfg, Access: c.access}, nil
+	}
+	return Target{}, fmt.Errorf("no kubelet kubeconfig in %s: %w", machineDir, os.ErrNotExist)
+}
+
+// machineRESTConfig loads a kubeconfig written for use inside the machine and
+// rewrites its absolute file references to the host view of the machine
+// rootfs.
+func machineRESTConfig(machineDir, path string) (*rest.Config, error) {
+	kubeconfig, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig %s: %w", path, err)
+	}
+	rebase := func(p *string) {
+		if filepath.IsAbs(*p) {
+			*p = machinePath(machineDir, *p)
+		}
+	}
+	for _, cluster := range kubeconfig.Clusters {
+		rebase(&cluster.CertificateAuthority)
+	}
+	for _, auth := range kubeconfig.AuthInfos {
+		rebase(&auth.ClientCertificate)
+		rebase(&auth.ClientKey)
+		rebase(&auth.TokenFile)
+		if auth.Exec != nil {
+			rebase(&auth.Exec.Command)
+		}
+	}
+	restCfg, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("build client config from %s: %w", path, err)
+	}
+	return restCfg, nil
+}
+
+// maxSymlinkHops bounds symlink resolution inside the machine rootfs.
+const maxSymlinkHops = 8
+
+// machinePath maps an absolute path inside the machine to the host. Absolute
+// symlinks, such as kubelet-client-current.pem pointing at the dated
+// certificate, are resolved against the machine root rather than the host
+// root.
+func machinePath(machineDir, path string) string {
+	hostPath := filepath.Join(machineDir, path)
+	for range maxSymlinkHops {
+		target, err := os.Readlink(hostPath)
+		if err != nil {
+			break
+		}
+		if filepath.IsAbs(target) {
+			hostPath = filepath.Join(machineDir, target)
+		} else {
+			hostPath = filepath.Join(filepath.Dir(hostPath), target)
+		}
+	}
+	return hostPath
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/hybridcompute/armhybridcompute"
 	"github.com/google/uuid"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/azclient"
 	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilaz"
@@ -29,6 +30,10 @@ type installArcTask struct {
 	cfg    *config.Config
 	logger *slog.Logger
 
+	// deviceCode is the device code login, kept so the user logs in once
+	// for all of onboarding.
+	deviceCode azcore.TokenCredential
+
 	// lazily initialised by setUpClients
 	hybridComputeClient   *armhybridcompute.MachinesClient
 	mcClient              *armcontainerservice.ManagedClustersClient
@@ -62,8 +67,10 @@ func (t *installArcTask) Do(ctx context.Context) error {
 	}
 
 	// Step 2: SDK clients + registration + RBAC
+	ctx, correlationID := azclient.WithCorrelationID(ctx)
 	if err := t.execute(ctx); err != nil {
-		return fmt.Errorf("arc installation: %w", err)
+		t.logger.Error("Arc installation failed", "correlationID", correlationID, "error", err)
+		return azclient.WrapError(ctx, fmt.Errorf("arc installation: %w", err))
 	}
 
 	// Step 3: verify connectivity
@@ -100,8 +107,12 @@ func (t *installArcTask) ensureAuthentication(ctx context.Context) error {
 }
 
 func (t *installArcTask) getCredential() (azcore.TokenCredential, error) {
-	var sources []azcore.TokenCredential
 	clientOpts := azclient.ClientOptionsFromConfig(t.cfg)
+	if t.cfg.IsDeviceCodeConfigured() {
+		return t.deviceCodeCredential(clientOpts)
+	}
+
+	var sources []azcore.TokenCredential
 
 	cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOpts})
 	if err == nil {
@@ -138,6 +149,30 @@ func (t *installArcTask) getCredential() (azcore.TokenCredential, error) {
 	return chainedCred, nil
 }
 
+// deviceCodeCredential returns the device code login for onboarding. The
+// login prompt is printed to stderr, since start may run with its logs sent
+// elsewhere and the user must see the code to complete the login.
+func (t *installArcTask) deviceCodeCredential(clientOpts azcore.ClientOptions) (azcore.TokenCredential, error) {
+	if t.deviceCode != nil {
+		return t.deviceCode, nil
+	}
+	cred, err := azidentity.NewDeviceCodeCredential(&azidentity.DeviceCodeCredentialOptions{
+		ClientOptions: clientOpts,
+		TenantID:      t.cfg.Azure.TenantID,
+		ClientID:      t.cfg.Azure.DeviceCode.ClientID,
+		UserPrompt: func(_ context.Context, msg azidentity.DeviceCodeMessage) error {
+			t.logger.Info("waiting for device code login", "verificationURL", msg.VerificationURL)
+			_, err := fmt.Fprintf(os.Stderr, "\n%s\n\n", msg.Message)
+			return err
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create device code credential: %w", err)
+	}
+	t.deviceCode = cred
+	return cred, nil
+}
+
 func getAccessToken(ctx context.Context, cred azcore.TokenCredential, scope string) (string, error) {
 	accessToken, err := cred.GetToken(ctx, policy.TokenRequestOptions{
 		Scopes: []string{scope},
@@ -241,6 +276,12 @@ func (t *installArcTask) registerArcMachine(ctx context.Context) (*armhybridcomp
 	if err := t.runArcAgentConnect(ctx); err != nil {
 		return nil, fmt.Errorf("azcmagent connect: %w", err)
 	}
+	audit.Record(ctx, t.logger, audit.Event{
+		Operation: audit.OperationAzureResourceCreate,
+		Target: fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.HybridCompute/machines/%s",
+			t.cfg.Azure.SubscriptionID, t.cfg.Azure.Arc.ResourceGroup, t.cfg.Azure.Arc.MachineName),
+		Detail: "azcmagent connect",
+	})
 
 	return t.waitForArcRegistration(ctx)
 }
@@ -425,7 +466,8 @@ func (t *installArcTask) assignRole(ctx context.Context, principalID, roleDefID,
 		}
 
 		name := uuid.New().String()
-		if _, err := t.roleAssignmentsClient.Create(ctx, scope, name, assignment, nil); err != nil {
+		resp, err := t.roleAssignmentsClient.Create(ctx, scope, name, assignment, nil)
+		if err != nil {
 			lastErr = err
 			errStr := err.Error()
 
@@ -440,6 +482,11 @@ func (t *installArcTask) assignRole(ctx context.Context, principalID, roleDefID,
 			}
 			return fmt.Errorf("create role assignment for %q: %w", roleName, err)
 		}
+		audit.Record(ctx, t.logger, audit.Event{
+			Operation: audit.OperationAzureResourceCreate,
+			Target:    ptrDeref(resp.ID),
+			Detail:    fmt.Sprintf("role assignment %q for principal %s at %s", roleName, principalID, scope),
+		})
 		return nil
 	}
 
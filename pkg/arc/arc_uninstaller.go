@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
@@ -63,8 +64,12 @@ func isArcDetectedOnHost(ctx context.Context, logger *slog.Logger) bool {
 		return true
 	}
 
+	states, err := utilexec.GetUnitStates(ctx, logger, arcServices...)
+	if err != nil {
+		logger.Debug("failed to query Arc service states", "error", err)
+	}
 	for _, service := range arcServices {
-		if utilexec.ServiceExists(ctx, logger, service) || utilexec.IsServiceActive(ctx, logger, service) {
+		if states[service].Exists() || states[service].Active() {
 			return true
 		}
 	}
@@ -98,17 +103,31 @@ func (t *uninstallArcTask) disconnectArcMachine(ctx context.Context) error {
 func (t *uninstallArcTask) removeArcAgentLocalState(ctx context.Context) error {
 	var removalErrors []string
 
+	states, err := utilexec.GetUnitStates(ctx, t.logger, arcServices...)
+	if err != nil {
+		// Fall back to attempting every service; stop and disable of a
+		// missing unit only produce errors that are reported below.
+		t.logger.Debug("failed to query Arc service states", "error", err)
+	}
+	var services []string
 	for _, service := range arcServices {
-		if !utilexec.ServiceExists(ctx, t.logger, service) && !utilexec.IsServiceActive(ctx, t.logger, service) {
+		if state, ok := states[service]; ok && !state.Exists() && !state.Active() {
 			continue
 		}
+		services = append(services, service)
 		if err := utilexec.StopService(ctx, t.logger, service); err != nil {
 			t.logger.Debug("failed to stop service", "service", service, "error", err)
 			removalErrors = append(removalErrors, fmt.Sprintf("stop %s: %v", service, err))
+		} else {
+			audit.Record(ctx, t.logger, audit.Event{Operation: audit.OperationUnitStop, Target: service})
 		}
-		if err := utilexec.DisableService(ctx, t.logger, service); err != nil {
-			t.logger.Debug("failed to disable service", "service", service, "error", err)
-			removalErrors = append(removalErrors, fmt.Sprintf("disable %s: %v", service, err))
+	}
+	if err := utilexec.DisableUnits(ctx, t.logger, services...); err != nil {
+		t.logger.Debug("failed to disable services", "services", services, "error", err)
+		removalErrors = append(removalErrors, fmt.Sprintf("disable %s: %v", strings.Join(services, " "), err))
+	} else {
+		for _, service := range services {
+			audit.Record(ctx, t.logger, audit.Event{Operation: audit.OperationUnitDisable, Target: service})
 		}
 	}
 
@@ -28,8 +28,13 @@ func isArcServicesRunning(ctx context.Context, logger *slog.Logger) bool {
 	if !isArcAgentInstalled() {
 		return false
 	}
+	states, err := utilexec.GetUnitStates(ctx, logger, arcServices...)
+	if err != nil {
+		logger.Debug("failed to query Arc service states", "error", err)
+		return false
+	}
 	for _, service := range arcServices {
-		if !utilexec.IsServiceActive(ctx, logger, service) {
+		if !states[service].Active() {
 			return false
 		}
 	}
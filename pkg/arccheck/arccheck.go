@@ -0,0 +1,310 @@
+// Package arccheck verifies that the node reaches the endpoints of the Azure
+// Connected Machine agent.
+//
+// A firewall or proxy that blocks one of them makes azcmagent connect fail
+// with an error that rarely names the endpoint. When azcmagent is installed
+// the check runs its own "azcmagent check" and parses the JSON result;
+// before that, or when its output cannot be read, the agent sends an HTTPS
+// request to each endpoint from the egress report itself.
+package arccheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/egress"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+// Sources of a Report.
+const (
+	// SourceAzcmagent is "azcmagent check".
+	SourceAzcmagent = "azcmagent"
+	// SourceAgent is the agent's own HTTPS requests.
+	SourceAgent = "agent"
+)
+
+// azcmagentTimeout bounds "azcmagent check", which probes its endpoints one
+// after another.
+const azcmagentTimeout = 2 * time.Minute
+
+// EndpointResult is the outcome for one endpoint.
+type EndpointResult struct {
+	// Endpoint is the host, or URL as azcmagent prints it.
+	Endpoint string `json:"endpoint"`
+	// Purposes say which Arc components use the endpoint.
+	Purposes  []string `json:"purposes,omitempty"`
+	Reachable bool     `json:"reachable"`
+	// Private is set when the endpoint resolved to a private link address.
+	Private bool   `json:"private,omitempty"`
+	TLS     string `json:"tls,omitempty"`
+	Proxy   string `json:"proxy,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Host returns the endpoint's host name.
+func (r EndpointResult) Host() string {
+	host := r.Endpoint
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// Report is the outcome of one check.
+type Report struct {
+	Source    string           `json:"source"`
+	CheckedAt time.Time        `json:"checkedAt"`
+	Endpoints []EndpointResult `json:"endpoints"`
+}
+
+// Blocked returns the endpoints that could not be reached.
+func (r *Report) Blocked() []EndpointResult {
+	var blocked []EndpointResult
+	for _, endpoint := range r.Endpoints {
+		if !endpoint.Reachable {
+			blocked = append(blocked, endpoint)
+		}
+	}
+	return blocked
+}
+
+// Healthy reports whether every endpoint was reached.
+func (r *Report) Healthy() bool { return len(r.Blocked()) == 0 }
+
+// Summary describes the report in one line.
+func (r *Report) Summary() string {
+	blocked := r.Blocked()
+	if len(blocked) == 0 {
+		return fmt.Sprintf("%d endpoints reachable, checked by %s", len(r.Endpoints), r.Source)
+	}
+	hosts := make([]string, 0, len(blocked))
+	for _, endpoint := range blocked {
+		hosts = append(hosts, endpoint.Host())
+	}
+	return fmt.Sprintf("%d of %d endpoints blocked, checked by %s: %s", len(blocked), len(r.Endpoints), r.Source, strings.Join(hosts, ", "))
+}
+
+// Checker checks the Arc endpoints of one config.
+type Checker struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	endpoints []egress.Endpoint
+	client    *http.Client
+	lookPath  func(string) (string, error)
+	azcmagent func(ctx context.Context, args ...string) ([]byte, error)
+	now       func() time.Time
+}
+
+// New returns a checker for the Arc endpoints of cfg.
+func New(log *slog.Logger, cfg *config.Config) *Checker {
+	return &Checker{
+		log:       log,
+		cfg:       cfg,
+		endpoints: egress.ArcEndpoints(cfg),
+		client:    httpclient.NewForConfig(cfg.Agent.HTTP, "arc-check", httpclient.KindRequest),
+		lookPath:  exec.LookPath,
+		azcmagent: runAzcmagent,
+		now:       time.Now,
+	}
+}
+
+// Check checks every endpoint. It never returns an error; unreachable
+// endpoints are described in the report.
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{CheckedAt: c.now().UTC()}
+	if _, err := c.lookPath("azcmagent"); err == nil {
+		results, err := c.checkAzcmagent(ctx)
+		if err == nil {
+			report.Source = SourceAzcmagent
+			report.Endpoints = results
+			return report
+		}
+		c.log.Debug("azcmagent check unusable, probing Arc endpoints directly", "error", err)
+	}
+	report.Source = SourceAgent
+	report.Endpoints = c.probeAll(ctx)
+	return report
+}
+
+// checkAzcmagent runs "azcmagent check" and adds the purposes the egress
+// report knows to its endpoints.
+func (c *Checker) checkAzcmagent(ctx context.Context) ([]EndpointResult, error) {
+	args := []string{"check", "--json"}
+	if location := c.cfg.Azure.Arc.Location; location != "" {
+		args = append(args, "--location", location)
+	}
+	if cloud := azclient.AzcmagentCloudNameFromConfig(c.cfg); cloud != "" {
+		args = append(args, "--cloud", cloud)
+	}
+	ctx, cancel := context.WithTimeout(ctx, azcmagentTimeout)
+	defer cancel()
+	// azcmagent check exits non-zero when an endpoint is blocked, so the
+	// output is parsed regardless of the exit status.
+	output, runErr := c.azcmagent(ctx, args...)
+	results, err := ParseAzcmagent(output)
+	if err != nil {
+		return nil, errors.Join(runErr, err)
+	}
+	for i := range results {
+		results[i].Purposes = c.purposes(results[i].Host())
+	}
+	return results, nil
+}
+
+func (c *Checker) purposes(host string) []string {
+	for _, endpoint := range c.endpoints {
+		if endpoint.Host == host || (strings.HasPrefix(endpoint.Host, "*.") && strings.HasSuffix(host, endpoint.Host[1:])) {
+			return endpoint.Purposes
+		}
+	}
+	return nil
+}
+
+// probeAll sends a request to every endpoint concurrently. Wildcard hosts
+// cannot be probed and are left out.
+func (c *Checker) probeAll(ctx context.Context) []EndpointResult {
+	var endpoints []egress.Endpoint
+	for _, endpoint := range c.endpoints {
+		if !strings.HasPrefix(endpoint.Host, "*.") {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	results := make([]EndpointResult, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Go(func() {
+			results[i] = c.probe(ctx, endpoint)
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// probe sends a HEAD request. Any HTTP response means the endpoint is
+// reachable through the firewall and proxy; the status code does not matter.
+func (c *Checker) probe(ctx context.Context, endpoint egress.Endpoint) EndpointResult {
+	result := EndpointResult{Endpoint: endpoint.Host, Purposes: endpoint.Purposes}
+	url := fmt.Sprintf("%s://%s:%d/", endpoint.Protocol, endpoint.Host, endpoint.Port)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	_ = resp.Body.Close()
+	result.Reachable = true
+	if resp.TLS != nil {
+		result.TLS = tls.VersionName(resp.TLS.Version)
+	}
+	return result
+}
+
+func runAzcmagent(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := utilexec.Azcmagent()(ctx)
+	cmd.Args = append(cmd.Args, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return output, fmt.Errorf("azcmagent check: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// azcmagentEndpoint is one row of "azcmagent check --json". Field names
+// match case-insensitively, and the flags may be booleans or strings.
+type azcmagentEndpoint struct {
+	Endpoint  string   `json:"endpoint"`
+	Reachable flexBool `json:"reachable"`
+	Private   flexBool `json:"private"`
+	TLS       string   `json:"tls"`
+	Proxy     string   `json:"proxy"`
+	Error     string   `json:"error"`
+}
+
+// ParseAzcmagent reads the output of "azcmagent check --json": either an
+// array of endpoints or an object holding them under "endpoints". Log lines
+// azcmagent prints before the JSON are skipped.
+func ParseAzcmagent(output []byte) ([]EndpointResult, error) {
+	start := bytes.IndexAny(output, "[{")
+	if start < 0 {
+		return nil, errors.New("azcmagent check printed no JSON")
+	}
+	output = output[start:]
+	var rows []azcmagentEndpoint
+	if output[0] == '[' {
+		if err := json.Unmarshal(output, &rows); err != nil {
+			return nil, fmt.Errorf("parse azcmagent check output: %w", err)
+		}
+	} else {
+		var wrapped struct {
+			Endpoints []azcmagentEndpoint `json:"endpoints"`
+		}
+		if err := json.Unmarshal(output, &wrapped); err != nil {
+			return nil, fmt.Errorf("parse azcmagent check output: %w", err)
+		}
+		rows = wrapped.Endpoints
+	}
+	results := make([]EndpointResult, 0, len(rows))
+	for _, row := range rows {
+		if row.Endpoint == "" {
+			continue
+		}
+		results = append(results, EndpointResult{
+			Endpoint:  row.Endpoint,
+			Reachable: bool(row.Reachable),
+			Private:   bool(row.Private),
+			TLS:       row.TLS,
+			Proxy:     row.Proxy,
+			Error:     row.Error,
+		})
+	}
+	if len(results) == 0 {
+		return nil, errors.New("azcmagent check reported no endpoints")
+	}
+	return results, nil
+}
+
+// flexBool decodes a JSON boolean, or a string such as "true" or "yes".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(slices.Contains([]string{"true", "yes"}, strings.ToLower(strings.TrimSpace(v))))
+	case nil:
+		*b = false
+	default:
+		return fmt.Errorf("cannot decode %s as a boolean", data)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package arccheck
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/egress"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+func arcConfig() *config.Config {
+	return &config.Config{Azure: config.AzureConfig{
+		ResourceManagerEndpointURL: "https://management.azure.com",
+		Arc:                        &config.ArcConfig{Enabled: true, MachineName: "edge-01", Location: "East US"},
+	}}
+}
+
+func TestParseAzcmagent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		output  string
+		want    []EndpointResult
+		wantErr string
+	}{
+		{
+			name: "array",
+			output: `[{"endpoint":"https://gbl.his.arc.azure.com","reachable":true,"private":false,"tls":"TLS 1.3","proxy":"Not used"},
+				{"Endpoint":"https://eastus.his.arc.azure.com","Reachable":"false","Error":"dial tcp: i/o timeout"}]`,
+			want: []EndpointResult{
+				{Endpoint: "https://gbl.his.arc.azure.com", Reachable: true, TLS: "TLS 1.3", Proxy: "Not used"},
+				{Endpoint: "https://eastus.his.arc.azure.com", Error: "dial tcp: i/o timeout"},
+			},
+		},
+		{
+			name:   "object after log lines",
+			output: "INFO checking connectivity\n{\"endpoints\":[{\"endpoint\":\"https://pas.windows.net\",\"reachable\":\"yes\",\"private\":true}]}",
+			want:   []EndpointResult{{Endpoint: "https://pas.windows.net", Reachable: true, Private: true}},
+		},
+		{name: "no json", output: "unknown flag: --json", wantErr: "no JSON"},
+		{name: "no endpoints", output: `{"endpoints":[]}`, wantErr: "no endpoints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseAzcmagent([]byte(tt.output))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseAzcmagent() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAzcmagent() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseAzcmagent() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Endpoint != tt.want[i].Endpoint || got[i].Reachable != tt.want[i].Reachable || got[i].Private != tt.want[i].Private ||
+					got[i].TLS != tt.want[i].TLS || got[i].Proxy != tt.want[i].Proxy || got[i].Error != tt.want[i].Error {
+					t.Errorf("endpoint %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckUsesAzcmagent(t *testing.T) {
+	t.Parallel()
+
+	checker := New(slog.New(slog.DiscardHandler), arcConfig())
+	checker.lookPath = func(string) (string, error) { return "/usr/bin/azcmagent", nil }
+	var gotArgs []string
+	checker.azcmagent = func(_ context.Context, args ...string) ([]byte, error) {
+		gotArgs = args
+		return []byte(`[{"endpoint":"https://eastus.his.arc.azure.com","reachable":false}]`), errors.New("exit status 1")
+	}
+
+	report := checker.Check(t.Context())
+	if report.Source != SourceAzcmagent {
+		t.Fatalf("Source = %q, want %q", report.Source, SourceAzcmagent)
+	}
+	if want := "check --json --location East US"; strings.Join(gotArgs, " ") != want {
+		t.Fatalf("azcmagent args = %q, want %q", gotArgs, want)
+	}
+	blocked := report.Blocked()
+	if len(blocked) != 1 || blocked[0].Host() != "eastus.his.arc.azure.com" || len(blocked[0].Purposes) == 0 {
+		t.Fatalf("Blocked() = %+v, want eastus.his.arc.azure.com with its purposes", blocked)
+	}
+}
+
+func TestCheckProbesWithoutAzcmagent(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portText, _ := net.SplitHostPort(serverURL.Host)
+	port, _ := strconv.Atoi(portText)
+	closed := httptest.NewUnstartedServer(nil)
+	closedPort := closed.Listener.Addr().(*net.TCPAddr).Port
+	closed.Listener.Close()
+
+	checker := New(slog.New(slog.DiscardHandler), arcConfig())
+	checker.client = server.Client()
+	checker.client.Timeout = 5 * time.Second
+	checker.lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	checker.endpoints = []egress.Endpoint{
+		{Host: host, Port: port, Protocol: "https", Purposes: []string{"Azure Arc identity"}},
+		{Host: host, Port: closedPort, Protocol: "https", Purposes: []string{"Azure Arc guest configuration"}},
+		{Host: "*.servicebus.windows.net", Port: 443, Protocol: "https"},
+	}
+
+	report := checker.Check(t.Context())
+	if report.Source != SourceAgent || len(report.Endpoints) != 2 {
+		t.Fatalf("report = %+v, want two probed endpoints without the wildcard", report)
+	}
+	if got := report.Endpoints[0]; !got.Reachable || got.TLS == "" {
+		t.Fatalf("reachable endpoint = %+v, want reachable over TLS despite the 404", got)
+	}
+	if got := report.Endpoints[1]; got.Reachable || got.Error == "" {
+		t.Fatalf("closed endpoint = %+v, want unreachable with an error", got)
+	}
+}
+
+func TestPreflightResults(t *testing.T) {
+	t.Parallel()
+
+	if checks := Preflight(slog.New(slog.DiscardHandler), &config.Config{}); len(checks) != 0 {
+		t.Fatalf("Preflight() without Arc = %d checks, want none", len(checks))
+	}
+
+	blocked := EndpointResult{
+		Endpoint: "https://eastus.his.arc.azure.com",
+		Purposes: []string{"Azure Arc identity"},
+		Error:    "connection refused",
+		Proxy:    "http://proxy:3128",
+	}
+	out := results(Report{Source: SourceAzcmagent, Endpoints: []EndpointResult{
+		{Endpoint: "https://gbl.his.arc.azure.com", Reachable: true},
+		blocked,
+	}})
+	if len(out) != 1 || out[0].Severity != preflight.SeverityError || out[0].Target != "eastus.his.arc.azure.com" {
+		t.Fatalf("results() = %+v, want one error for the blocked endpoint", out)
+	}
+	for _, want := range []string{"Azure Arc identity", "connection refused", "allow outbound HTTPS"} {
+		if !strings.Contains(out[0].Message, want) {
+			t.Errorf("message %q does not mention %q", out[0].Message, want)
+		}
+	}
+	if strings.Contains(out[0].Message, "proxy:3128") {
+		t.Errorf("message %q includes the proxy URL", out[0].Message)
+	}
+
+	if out := results(Report{Source: SourceAgent, Endpoints: []EndpointResult{{Endpoint: "pas.windows.net", Reachable: true}}}); len(out) != 1 || out[0].Severity != preflight.SeverityOK {
+		t.Fatalf("results() for reachable endpoints = %+v, want OK", out)
+	}
+	if out := results(Report{Source: SourceAgent}); len(out) != 1 || out[0].Severity != preflight.SeverityWarning {
+		t.Fatalf("results() without endpoints = %+v, want a warning", out)
+	}
+}
@@ -0,0 +1,63 @@
+package arccheck
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const checkName = "arc-endpoints"
+
+// Preflight returns a check of the Arc endpoints when Arc is enabled.
+func Preflight(log *slog.Logger, cfg *config.Config) []preflight.Checker {
+	if !cfg.IsARCEnabled() {
+		return nil
+	}
+	return []preflight.Checker{checker{check: New(log, cfg).Check}}
+}
+
+type checker struct {
+	check func(context.Context) Report
+}
+
+func (checker) Name() string { return checkName }
+
+func (c checker) Check(ctx context.Context) []preflight.Result {
+	return results(c.check(ctx))
+}
+
+// results maps a report to one error per blocked endpoint, naming what to
+// allow, or a single OK result.
+func results(report Report) []preflight.Result {
+	if len(report.Endpoints) == 0 {
+		return preflight.ResultsWarning(checkName, "azure-arc",
+			"no Arc endpoints are known for this cloud; run azcmagent check once the Connected Machine agent is installed")
+	}
+	blocked := report.Blocked()
+	if len(blocked) == 0 {
+		return preflight.ResultsOK(checkName, "azure-arc", report.Summary())
+	}
+	var out []preflight.Result
+	for _, endpoint := range blocked {
+		out = append(out, preflight.ResultsError(checkName, endpoint.Host(), "%s", BlockedMessage(endpoint))...)
+	}
+	return out
+}
+
+// BlockedMessage explains a blocked endpoint and what to allow. It leaves out
+// the proxy URL, which may hold credentials.
+func BlockedMessage(endpoint EndpointResult) string {
+	var b strings.Builder
+	b.WriteString("cannot reach " + endpoint.Host())
+	if len(endpoint.Purposes) > 0 {
+		b.WriteString(" (" + strings.Join(endpoint.Purposes, ", ") + ")")
+	}
+	if endpoint.Error != "" {
+		b.WriteString(": " + endpoint.Error)
+	}
+	b.WriteString("; allow outbound HTTPS to it in the firewall or proxy")
+	return b.String()
+}
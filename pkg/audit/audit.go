@@ -0,0 +1,381 @@
+// Package audit records privileged mutations performed by the agent in an
+// append-only, hash-chained log on the host.
+//
+// Every entry carries the SHA-256 of the previous entry, so truncating,
+// reordering, or editing any line breaks the chain from that point on. The log
+// is intentionally kept outside the directories removed by reset so the record
+// of what the agent changed survives the agent's own cleanup.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultLogPath is where the audit log is written when the agent config
+	// does not override agent.auditLogPath.
+	DefaultLogPath = "/var/lib/aks-flex-node/audit.log"
+
+	logFileMode = 0o600
+	logDirMode  = 0o700
+
+	// maxEntrySize is the longest audit log line read back.
+	maxEntrySize = 1024 * 1024
+
+	// genesisHash is the previous-hash value of the first entry in a log.
+	genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// Operation names the kind of privileged mutation being recorded.
+type Operation string
+
+const (
+	OperationFileWrite           Operation = "file-write"
+	OperationFileRemove          Operation = "file-remove"
+	OperationSymlink             Operation = "symlink"
+	OperationUnitStart           Operation = "unit-start"
+	OperationUnitStop            Operation = "unit-stop"
+	OperationUnitRestart         Operation = "unit-restart"
+	OperationUnitEnable          Operation = "unit-enable"
+	OperationUnitDisable         Operation = "unit-disable"
+	OperationFirewallRule        Operation = "firewall-rule"
+	OperationRouteChange         Operation = "route-change"
+	OperationPackageExtract      Operation = "package-extract"
+	OperationPackageHold         Operation = "package-hold"
+	OperationPackageUnhold       Operation = "package-unhold"
+	OperationAzureResourceCreate Operation = "azure-resource-create"
+	OperationAzureResourceUpdate Operation = "azure-resource-update"
+	OperationAzureResourceDelete Operation = "azure-resource-delete"
+	OperationHookRun             Operation = "hook-run"
+)
+
+// Event describes a single privileged mutation. BeforeHash and AfterHash are
+// content digests of the target before and after the change; either may be
+// empty when the target did not exist or has no content (for example a unit
+// state transition).
+type Event struct {
+	Operation  Operation `json:"operation"`
+	Target     string    `json:"target"`
+	BeforeHash string    `json:"beforeHash,omitempty"`
+	AfterHash  string    `json:"afterHash,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Sequence uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Event
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// Recorder persists audit events.
+type Recorder interface {
+	Record(ctx context.Context, event Event) error
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Record(context.Context, Event) error { return nil }
+
+var (
+	defaultMu       sync.RWMutex
+	defaultRecorder Recorder = nopRecorder{}
+)
+
+// SetDefault installs the process-wide recorder used by Record. Commands that
+// mutate the host call this once after loading config; until then events are
+// discarded so library code and tests do not need an audit sink.
+func SetDefault(r Recorder) {
+	if r == nil {
+		r = nopRecorder{}
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultRecorder = r
+}
+
+// Default returns the process-wide recorder installed by SetDefault.
+func Default() Recorder {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultRecorder
+}
+
+// Record appends event to the default recorder. Audit failures are logged but
+// never fail the mutation itself: the host change has already happened, and
+// aborting bootstrap would leave the node in a worse state than a gap in the
+// log, which Verify reports anyway.
+func Record(ctx context.Context, log *slog.Logger, event Event) {
+	defaultMu.RLock()
+	r := defaultRecorder
+	defaultMu.RUnlock()
+
+	if err := r.Record(ctx, event); err != nil && log != nil {
+		log.Warn("failed to record audit event", "operation", event.Operation, "target", event.Target, "error", err)
+	}
+}
+
+// FileLog is a Recorder backed by an append-only JSON-lines file. The CLI
+// and the daemon append to the same file, so every Record holds an exclusive
+// flock on it and chains to the last entry read under that lock.
+type FileLog struct {
+	path string
+	now  func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewFileLog returns a FileLog writing to path. The file is created on the
+// first Record call.
+func NewFileLog(path string) *FileLog {
+	if path == "" {
+		path = DefaultLogPath
+	}
+	return &FileLog{path: path, now: time.Now}
+}
+
+// Path returns the audit log file path.
+func (l *FileLog) Path() string { return l.path }
+
+// Record appends event to the log, chaining it to the last entry on disk.
+func (l *FileLog) Record(_ context.Context, event Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), logDirMode); err != nil {
+		return fmt.Errorf("create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, logFileMode) //#nosec G304 -- path is from trusted agent config
+	if err != nil {
+		return fmt.Errorf("open audit log %s: %w", l.path, err)
+	}
+	// Closing the file releases the lock.
+	defer f.Close() //nolint:errcheck // closed explicitly after the sync below
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("lock audit log %s: %w", l.path, err)
+	}
+
+	last, err := lastEntry(f)
+	if err != nil {
+		return fmt.Errorf("read audit log %s: %w", l.path, err)
+	}
+	entry := Entry{
+		Sequence: 1,
+		Time:     l.now().UTC(),
+		Event:    event,
+		PrevHash: genesisHash,
+	}
+	if last != nil {
+		entry.Sequence = last.Sequence + 1
+		entry.PrevHash = last.Hash
+	}
+	hash, err := entryHash(entry)
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("append audit log %s: %w", l.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync audit log %s: %w", l.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close audit log %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// lastEntry returns the last entry in f, or nil when the log is empty. Only
+// the end of the file is read: an entry is never longer than the scanner's
+// limit, so the last complete line lies within that many bytes.
+func lastEntry(f *os.File) (*Entry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-maxEntrySize, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var last []byte
+	for line := range bytes.Lines(data) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			last = line
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	var e Entry
+	if err := json.Unmarshal(last, &e); err != nil {
+		return nil, fmt.Errorf("decode last audit entry: %w", err)
+	}
+	return &e, nil
+}
+
+// VerifyResult summarizes a successful chain verification.
+type VerifyResult struct {
+	Entries  int    `json:"entries"`
+	LastHash string `json:"lastHash,omitempty"`
+}
+
+// Verify checks that every entry read from r hashes correctly and links to
+// its predecessor. It returns the first broken link as an error.
+func Verify(r io.Reader) (VerifyResult, error) {
+	var (
+		result   VerifyResult
+		prevHash = genesisHash
+		prevSeq  uint64
+	)
+	err := scanEntries(r, func(e *Entry) error {
+		if e.PrevHash != prevHash {
+			return fmt.Errorf("entry %d: previous hash does not match entry %d", e.Sequence, prevSeq)
+		}
+		if e.Sequence != prevSeq+1 {
+			return fmt.Errorf("entry %d: expected sequence %d", e.Sequence, prevSeq+1)
+		}
+		want, err := entryHash(Entry{Sequence: e.Sequence, Time: e.Time, Event: e.Event, PrevHash: e.PrevHash})
+		if err != nil {
+			return err
+		}
+		if e.Hash != want {
+			return fmt.Errorf("entry %d: hash mismatch", e.Sequence)
+		}
+		prevHash = e.Hash
+		prevSeq = e.Sequence
+		result.Entries++
+		result.LastHash = e.Hash
+		return nil
+	})
+	return result, err
+}
+
+// VerifyFile runs Verify against the log at path. A missing log verifies as
+// empty.
+func VerifyFile(path string) (VerifyResult, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return VerifyResult{}, nil
+	}
+	if err != nil {
+		return VerifyResult{}, fmt.Errorf("open audit log %s: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	return Verify(f)
+}
+
+// TailFile returns up to the last n entries of the log at path, oldest
+// first. A missing log has no entries.
+func TailFile(path string, n int) ([]Entry, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log %s: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	var entries []Entry
+	err = scanEntries(f, func(e *Entry) error {
+		entries = append(entries, *e)
+		if len(entries) > n {
+			entries = entries[1:]
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func scanEntries(r io.Reader, fn func(*Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEntrySize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d: decode audit entry: %w", line, err)
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// entryHash covers every field except Hash itself, in the fixed field order
+// produced by encoding/json for the Entry struct.
+func entryHash(e Entry) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("marshal audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// HashBytes returns the hex SHA-256 of data.
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the hex SHA-256 of the file at path, or an empty string if
+// the file does not exist or cannot be read. Symlinks are not followed so the
+// digest reflects what the agent itself wrote.
+func HashFile(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return ""
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return ""
+		}
+		return HashBytes([]byte("symlink:" + target))
+	}
+	if !info.Mode().IsRegular() {
+		return ""
+	}
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return ""
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,241 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLogRecordAndVerify(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "nested", "audit.log")
+	log := NewFileLog(path)
+	events := []Event{
+		{Operation: OperationFileWrite, Target: "/etc/systemd/system/a.service", AfterHash: HashBytes([]byte("a"))},
+		{Operation: OperationUnitStart, Target: "a.service"},
+		{Operation: OperationAzureResourceCreate, Target: "/subscriptions/x/resourceGroups/y", Detail: "test"},
+	}
+	for _, e := range events {
+		if err := log.Record(context.Background(), e); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	result, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+	if result.Entries != len(events) {
+		t.Fatalf("Entries = %d, want %d", result.Entries, len(events))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != logFileMode {
+		t.Fatalf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(logFileMode))
+	}
+}
+
+func TestFileLogContinuesChainAcrossInstances(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := range 3 {
+		if err := NewFileLog(path).Record(context.Background(), Event{Operation: OperationUnitStop, Target: "unit"}); err != nil {
+			t.Fatalf("Record %d: %v", i, err)
+		}
+	}
+
+	result, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+	if result.Entries != 3 {
+		t.Fatalf("Entries = %d, want 3", result.Entries)
+	}
+}
+
+func TestFileLogInterleavedWriters(t *testing.T) {
+	t.Parallel()
+
+	// The CLI and the daemon each hold their own FileLog on the same path.
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cli, daemon := NewFileLog(path), NewFileLog(path)
+	for i := range 3 {
+		if err := cli.Record(context.Background(), Event{Operation: OperationFileWrite, Target: "cli"}); err != nil {
+			t.Fatalf("cli Record %d: %v", i, err)
+		}
+		if err := daemon.Record(context.Background(), Event{Operation: OperationUnitRestart, Target: "daemon"}); err != nil {
+			t.Fatalf("daemon Record %d: %v", i, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		log := cli
+		if i%2 == 1 {
+			log = NewFileLog(path)
+		}
+		wg.Go(func() {
+			if err := log.Record(context.Background(), Event{Operation: OperationUnitStart, Target: "concurrent"}); err != nil {
+				t.Errorf("Record: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	result, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+	if result.Entries != 26 {
+		t.Fatalf("Entries = %d, want 26", result.Entries)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		tamper  func(lines []string) []string
+		wantErr string
+	}{
+		{
+			name: "edited entry",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "unit-b", "unit-x", 1)
+				return lines
+			},
+			wantErr: "entry 2: hash mismatch",
+		},
+		{
+			name: "removed entry",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantErr: "entry 3: previous hash",
+		},
+		{
+			name: "reordered entries",
+			tamper: func(lines []string) []string {
+				lines[0], lines[1] = lines[1], lines[0]
+				return lines
+			},
+			wantErr: "entry 2: previous hash",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "audit.log")
+			log := NewFileLog(path)
+			for _, target := range []string{"unit-a", "unit-b", "unit-c"} {
+				if err := log.Record(context.Background(), Event{Operation: OperationUnitStart, Target: target}); err != nil {
+					t.Fatalf("Record: %v", err)
+				}
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+			_, err = Verify(bytes.NewBufferString(strings.Join(lines, "\n")))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyFileMissing(t *testing.T) {
+	t.Parallel()
+
+	result, err := VerifyFile(filepath.Join(t.TempDir(), "missing.log"))
+	if err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+	if result.Entries != 0 {
+		t.Fatalf("Entries = %d, want 0", result.Entries)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	regular := filepath.Join(dir, "file")
+	if err := os.WriteFile(regular, []byte("content"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(regular, link); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	if got, want := HashFile(regular), HashBytes([]byte("content")); got != want {
+		t.Fatalf("HashFile(regular) = %q, want %q", got, want)
+	}
+	if got, want := HashFile(link), HashBytes([]byte("symlink:"+regular)); got != want {
+		t.Fatalf("HashFile(link) = %q, want %q", got, want)
+	}
+	if got := HashFile(filepath.Join(dir, "missing")); got != "" {
+		t.Fatalf("HashFile(missing) = %q, want empty", got)
+	}
+	if got := HashFile(dir); got != "" {
+		t.Fatalf("HashFile(dir) = %q, want empty", got)
+	}
+}
+
+func TestFileLogUsesUTCTimestamps(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log := NewFileLog(path)
+	log.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("x", 3600)) }
+	if err := log.Record(context.Background(), Event{Operation: OperationFileRemove, Target: "/etc/x"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(data), `"time":"2026-01-02T02:04:05.000000006Z"`) {
+		t.Fatalf("entry = %s, want UTC timestamp", data)
+	}
+	if _, err := VerifyFile(path); err != nil {
+		t.Fatalf("VerifyFile: %v", err)
+	}
+}
+
+func TestTailFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if entries, err := TailFile(path, 2); err != nil || len(entries) != 0 {
+		t.Fatalf("TailFile(missing) = %v, %v", entries, err)
+	}
+	log := NewFileLog(path)
+	for _, target := range []string{"a", "b", "c"} {
+		if err := log.Record(context.Background(), Event{Operation: OperationUnitStart, Target: target}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	entries, err := TailFile(path, 2)
+	if err != nil {
+		t.Fatalf("TailFile: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Target != "b" || entries[1].Target != "c" {
+		t.Fatalf("TailFile = %+v, want the last two entries", entries)
+	}
+}
@@ -0,0 +1,135 @@
+package azclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/google/uuid"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// CorrelationRequestIDHeader carries the client-chosen ID that ARM records in
+// its activity and request logs, so support can find the agent's calls.
+const CorrelationRequestIDHeader = "x-ms-correlation-request-id"
+
+// maxRecentCorrelations bounds the correlation IDs kept for status reports.
+const maxRecentCorrelations = 20
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns ctx carrying a new correlation ID for one agent
+// operation. Every Azure request made with the returned context, including
+// retries and long-running operation polls, sends the same ID. A context that
+// already carries an ID is returned unchanged.
+func WithCorrelationID(ctx context.Context) (context.Context, string) {
+	if id := CorrelationID(ctx); id != "" {
+		return ctx, id
+	}
+	id := uuid.NewString()
+	return context.WithValue(ctx, correlationIDKey{}, id), id
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WrapError annotates err with the correlation ID of ctx, or returns err
+// unchanged when ctx carries none.
+func WrapError(ctx context.Context, err error) error {
+	id := CorrelationID(ctx)
+	if err == nil || id == "" {
+		return err
+	}
+	return fmt.Errorf("%w (correlation ID %s)", err, id)
+}
+
+// Correlation is one Azure request recorded for support.
+type Correlation struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Host   string    `json:"host"`
+	Path   string    `json:"path"`
+	// StatusCode is 0 when no response was received.
+	StatusCode int `json:"statusCode,omitempty"`
+}
+
+var (
+	recentMu           sync.Mutex
+	recentCorrelations []Correlation
+)
+
+// RecentCorrelations returns the most recent Azure requests of this process,
+// oldest first.
+func RecentCorrelations() []Correlation {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	if len(recentCorrelations) == 0 {
+		return nil
+	}
+	return append([]Correlation(nil), recentCorrelations...)
+}
+
+func recordCorrelation(c Correlation) {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	recentCorrelations = append(recentCorrelations, c)
+	if n := len(recentCorrelations) - maxRecentCorrelations; n > 0 {
+		recentCorrelations = append(recentCorrelations[:0:0], recentCorrelations[n:]...)
+	}
+}
+
+// PerCallPolicies returns the policies every SDK client of the agent runs
+// once per call: the node suffix on the User-Agent and the correlation ID.
+func PerCallPolicies(cfg *config.Config) []policy.Policy {
+	var nodeName string
+	if cfg != nil {
+		nodeName = cfg.Agent.NodeName
+	}
+	return []policy.Policy{userAgentPolicy{nodeName: nodeName}, correlationPolicy{}}
+}
+
+// userAgentPolicy appends the node name to the User-Agent the SDK telemetry
+// policy built, which already starts with version.ApplicationID.
+type userAgentPolicy struct {
+	nodeName string
+}
+
+func (p userAgentPolicy) Do(req *policy.Request) (*http.Response, error) {
+	if p.nodeName != "" {
+		header := req.Raw().Header
+		ua := "node/" + p.nodeName
+		if existing := header.Get("User-Agent"); existing != "" {
+			ua = existing + " " + ua
+		}
+		header.Set("User-Agent", ua)
+	}
+	return req.Next()
+}
+
+// correlationPolicy sends the correlation ID of the request context, or a
+// fresh one for requests made outside an operation, and records it.
+type correlationPolicy struct{}
+
+func (correlationPolicy) Do(req *policy.Request) (*http.Response, error) {
+	raw := req.Raw()
+	id := CorrelationID(raw.Context())
+	if id == "" {
+		id = uuid.NewString()
+	}
+	raw.Header.Set(CorrelationRequestIDHeader, id)
+	resp, err := req.Next()
+	c := Correlation{ID: id, Time: time.Now().UTC(), Method: raw.Method, Host: raw.URL.Host, Path: raw.URL.Path}
+	if resp != nil {
+		c.StatusCode = resp.StatusCode
+	}
+	recordCorrelation(c)
+	return resp, err
+}
@@ -0,0 +1,96 @@
+package azclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestPerCallPoliciesPropagateCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	type seen struct{ userAgent, correlationID string }
+	requests := make(chan seen, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- seen{r.UserAgent(), r.Header.Get(CorrelationRequestIDHeader)}
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.Agent.NodeName = "edge-01"
+	pl := runtime.NewPipeline("test", "v1.0.0", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Telemetry:       policy.TelemetryOptions{ApplicationID: "aks-flex-node/test"},
+		PerCallPolicies: PerCallPolicies(cfg),
+		Retry:           policy.RetryOptions{RetryDelay: 1, MaxRetryDelay: 1},
+	})
+
+	ctx, id := WithCorrelationID(context.Background())
+	req, err := runtime.NewRequest(ctx, http.MethodGet, srv.URL+"/subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := pl.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// The first attempt failed and was retried with the same ID.
+	for range 2 {
+		got := <-requests
+		if got.correlationID != id {
+			t.Fatalf("correlation ID = %q, want %q", got.correlationID, id)
+		}
+		if !strings.HasPrefix(got.userAgent, "aks-flex-node/test ") || !strings.HasSuffix(got.userAgent, " node/edge-01") {
+			t.Fatalf("User-Agent = %q, want application ID prefix and node suffix", got.userAgent)
+		}
+	}
+
+	var found bool
+	for _, c := range RecentCorrelations() {
+		if c.ID == id && c.Path == "/subscriptions" && c.StatusCode == http.StatusOK {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("RecentCorrelations() = %+v, want a record for %s", RecentCorrelations(), id)
+	}
+}
+
+func TestWithCorrelationIDKeepsExistingID(t *testing.T) {
+	t.Parallel()
+
+	ctx, id := WithCorrelationID(context.Background())
+	if _, again := WithCorrelationID(ctx); again != id {
+		t.Fatalf("nested WithCorrelationID = %q, want %q", again, id)
+	}
+	if err := WrapError(ctx, context.Canceled); !strings.Contains(err.Error(), id) {
+		t.Fatalf("WrapError() = %v, want it to name %s", err, id)
+	}
+	if err := WrapError(context.Background(), context.Canceled); err != context.Canceled {
+		t.Fatalf("WrapError() without ID = %v, want err unchanged", err)
+	}
+}
+
+func TestRecentCorrelationsIsBounded(t *testing.T) {
+	for i := range maxRecentCorrelations + 5 {
+		recordCorrelation(Correlation{ID: strings.Repeat("x", i)})
+	}
+	got := RecentCorrelations()
+	if len(got) != maxRecentCorrelations {
+		t.Fatalf("len(RecentCorrelations()) = %d, want %d", len(got), maxRecentCorrelations)
+	}
+	if last := got[len(got)-1].ID; len(last) != maxRecentCorrelations+4 {
+		t.Fatalf("newest record has ID length %d, want %d", len(last), maxRecentCorrelations+4)
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/version"
 )
 
 const (
@@ -69,7 +72,14 @@ func resourceManagerService(cfg cloud.Configuration) cloud.ServiceConfiguration
 
 func ClientOptionsFromConfig(cfg *config.Config) azcore.ClientOptions {
 	env := ResourceManagerEnvironmentFromConfig(cfg)
+	var httpCfg config.HTTPClientConfig
+	if cfg != nil {
+		httpCfg = cfg.Agent.HTTP
+	}
 	return azcore.ClientOptions{
+		Transport:       httpclient.NewForConfig(httpCfg, "azure-resource-manager", httpclient.KindRequest),
+		Telemetry:       policy.TelemetryOptions{ApplicationID: version.ApplicationID()},
+		PerCallPolicies: PerCallPolicies(cfg),
 		Cloud: cloud.Configuration{
 			ActiveDirectoryAuthorityHost: env.AuthorityHost,
 			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
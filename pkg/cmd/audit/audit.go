@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// NewCommand returns the audit command group.
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the privileged operation audit log",
+		Long:  "Verify and export the append-only, hash-chained log of host and Azure mutations performed by the agent.",
+	}
+	cmd.AddCommand(newVerifyCommand())
+	cmd.AddCommand(newExportCommand())
+	return cmd
+}
+
+type pathOptions struct {
+	configPath string
+	logPath    string
+}
+
+func (o *pathOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.configPath, "config", "", "Path to configuration JSON file; used to locate agent.auditLogPath")
+	cmd.Flags().StringVar(&o.logPath, "path", "", "Audit log path (overrides --config)")
+}
+
+func (o *pathOptions) resolve() (string, error) {
+	if o.logPath != "" {
+		return o.logPath, nil
+	}
+	if o.configPath == "" {
+		return audit.DefaultLogPath, nil
+	}
+	cfg, err := config.LoadConfig(o.configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load config from %s: %w", o.configPath, err)
+	}
+	return cfg.Agent.AuditLogPath, nil
+}
+
+func newVerifyCommand() *cobra.Command {
+	var opts pathOptions
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the audit log hash chain",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := opts.resolve()
+			if err != nil {
+				return err
+			}
+			result, err := audit.VerifyFile(path)
+			if err != nil {
+				return fmt.Errorf("audit log %s failed verification: %w", path, err)
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "audit log %s verified: %d entries, last hash %s\n", path, result.Entries, result.LastHash)
+			return err
+		},
+	}
+	opts.addFlags(cmd)
+	return cmd
+}
+
+// exportManifest accompanies an exported log so whoever receives a support
+// bundle can tell which chain head the node vouched for at export time.
+type exportManifest struct {
+	Source string             `json:"source"`
+	Result audit.VerifyResult `json:"result"`
+}
+
+func newExportCommand() *cobra.Command {
+	var (
+		opts   pathOptions
+		output string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a verified copy of the audit log for a support bundle",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := opts.resolve()
+			if err != nil {
+				return err
+			}
+			return exportLog(cmd.OutOrStdout(), path, output)
+		},
+	}
+	opts.addFlags(cmd)
+	cmd.Flags().StringVar(&output, "output", "", "Directory to write audit.log and audit-manifest.json into (defaults to writing the log to stdout)")
+	return cmd
+}
+
+func exportLog(stdout io.Writer, path, outputDir string) error {
+	result, err := audit.VerifyFile(path)
+	if err != nil {
+		return fmt.Errorf("audit log %s failed verification: %w", path, err)
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read audit log %s: %w", path, err)
+	}
+	if outputDir == "" {
+		_, err := stdout.Write(data)
+		return err
+	}
+
+	if err := os.MkdirAll(outputDir, 0o750); err != nil {
+		return fmt.Errorf("create output directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "audit.log"), data, 0o600); err != nil {
+		return fmt.Errorf("write exported audit log: %w", err)
+	}
+	manifest, err := json.MarshalIndent(exportManifest{Source: path, Result: result}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "audit-manifest.json"), append(manifest, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write audit manifest: %w", err)
+	}
+	_, err = fmt.Fprintf(stdout, "exported %d audit entries to %s\n", result.Entries, outputDir)
+	return err
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
+)
+
+// NewCommand returns the config command group.
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the agent configuration",
+	}
+	cmd.AddCommand(newEffectiveCommand())
+	return cmd
+}
+
+// effective is the document config effective prints.
+type effective struct {
+	Settings []settings.Setting `json:"settings"`
+	// Origins names the profile, config file, instance section, or
+	// override that set each config value.
+	Origins config.Origins `json:"origins"`
+	Config  *config.Config `json:"config"`
+}
+
+func newEffectiveCommand() *cobra.Command {
+	var configPath, instance string
+	cmd := &cobra.Command{
+		Use:   "effective",
+		Short: "Print the merged configuration and where each setting came from",
+		Long: "Load the config file the way the daemon does, with flags and AKS_FLEX_NODE_* environment variables applied " +
+			"over it, and print the result as JSON with secrets redacted. Each flag is listed with its environment variable " +
+			"and whether its value came from the flag, the environment, the config file, or the default. Each config value " +
+			"is listed with the profile, config file, instance section, or override that set it.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, origins, err := settings.LoadConfigWithOrigins(cmd, configPath, config.Instance(instance))
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(effective{Settings: settings.Effective(cmd, cfg), Origins: origins, Config: cfg.Redacted()})
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to configuration JSON file (required)")
+	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	settings.AddConfigFlags(cmd, "log-level", "max-disruption")
+	return cmd
+}
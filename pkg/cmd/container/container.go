@@ -0,0 +1,60 @@
+package container
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/start"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/container"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
+)
+
+func NewCommand() *cobra.Command {
+	var configPath, instance string
+	cmd := &cobra.Command{
+		Use:   "container",
+		Short: "Run the agent as the entrypoint of a container",
+		Long: "Check that the container shares the host's PID and network namespaces and has the required host paths mounted, " +
+			"bootstrap the node if it has not been bootstrapped yet, then run the daemon in the foreground. " +
+			"The container runtime supervises the agent, so no agent systemd unit is installed.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := settings.LoadConfig(cmd, configPath, config.Instance(instance))
+			if err != nil {
+				return err
+			}
+			logger := logger.CreateLogger(cfg.Agent.LogLevel, cfg.Agent.LogDir)
+			if err := container.Setup(logger, cfg); err != nil {
+				return err
+			}
+			audit.SetDefault(audit.NewFileLog(cfg.Agent.AuditLogPath))
+			httpclient.SetDefault(cfg.Agent.HTTP)
+
+			bootstrapped, err := daemon.Bootstrapped(cmd.Context(), cfg.Instance)
+			if err != nil {
+				return err
+			}
+			if !bootstrapped {
+				logger.Info("bootstrapping the node from the container")
+				// A deferred bootstrap is resumed below once the network is up.
+				if _, err := start.Run(cmd.Context(), cfg, logger); err != nil && !errors.Is(err, start.ErrBootstrapDeferred) {
+					return err
+				}
+			}
+			if err := start.ResumeDeferred(cmd.Context(), cfg, logger); err != nil {
+				return err
+			}
+			return daemon.Run(cmd.Context(), cfg, logger)
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to configuration JSON file (required)")
+	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	settings.AddConfigFlags(cmd, "log-level", "max-disruption")
+	return cmd
+}
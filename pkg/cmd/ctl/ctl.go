@@ -0,0 +1,262 @@
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/arccheck"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+)
+
+// NewCommand returns the ctl command group, which talks to the running daemon
+// over its local unix-socket admin API.
+func NewCommand() *cobra.Command {
+	var socketPath, instance string
+	cmd := &cobra.Command{
+		Use:   "ctl",
+		Short: "Query the running agent daemon",
+		Long: "Talk to the running aks-flex-node-agent daemon over its local unix-socket admin API.\n\n" +
+			"ctl only reads the daemon's state. It does not apply a config or roll back generations: the daemon reads " +
+			"its config when it starts, so edit the config file and restart aks-flex-node-agent to apply it. The daemon " +
+			"falls back to the last known good generation on its own when the applied one does not come up.",
+	}
+	cmd.PersistentFlags().StringVar(&socketPath, "socket", daemon.DefaultControlSocketPath, "Path to the daemon admin API socket")
+	cmd.PersistentFlags().StringVar(&instance, "instance", "", "Named node instance whose daemon to talk to; ignored when --socket is set")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("socket") || instance == "" {
+			return nil
+		}
+		if err := config.Instance(instance).Validate(); err != nil {
+			return err
+		}
+		socketPath = config.Instance(instance).ControlSocketPath()
+		return nil
+	}
+	cmd.AddCommand(newStatusCommand(&socketPath), newEventsCommand(&socketPath), newDriftCommand(&socketPath))
+	return cmd
+}
+
+func newStatusCommand(socketPath *string) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the daemon's applied state and last operation",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := daemon.NewControlClient(*socketPath).Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(status)
+			}
+			return writeStatus(cmd.OutOrStdout(), status)
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the raw status as JSON")
+	return cmd
+}
+
+func newEventsCommand(socketPath *string) *cobra.Command {
+	var follow, asJSON bool
+	var level string
+	var components []string
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show the daemon's recent log lines, audit events, and node events",
+		Long: "Show the daemon's recent log lines at info level or above, audit events, and Events recorded on the Node. " +
+			"With --follow, keep streaming new ones as they happen.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := daemon.EventFilter{Components: components}
+			if err := filter.Level.UnmarshalText([]byte(level)); err != nil {
+				return fmt.Errorf("invalid --level %q: %w", level, err)
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			return daemon.NewControlClient(*socketPath).StreamEvents(cmd.Context(), filter, follow, func(event daemon.StreamEvent) error {
+				if asJSON {
+					return enc.Encode(event)
+				}
+				return writeEvent(cmd.OutOrStdout(), event)
+			})
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep streaming new events")
+	cmd.Flags().StringVar(&level, "level", "info", "Lowest severity to show: info, warn, or error")
+	cmd.Flags().StringSliceVar(&components, "component", nil, "Only show these components, such as agent, audit, or node")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print each event as a JSON line")
+	return cmd
+}
+
+func newDriftCommand(socketPath *string) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Compare the active machine with its recorded manifest",
+		Long: "Ask the daemon to re-hash the active machine's binaries and units against the manifest bootstrap or the " +
+			"last repave recorded, and list the files that changed. Exits non-zero when any did; run verify --repair " +
+			"to reinstall them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			drift, err := daemon.NewControlClient(*socketPath).Drift(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(drift); err != nil {
+					return err
+				}
+			} else if err := writeDrift(cmd.OutOrStdout(), drift); err != nil {
+				return err
+			}
+			if drift.Error != "" {
+				return fmt.Errorf("verify the active machine: %s", drift.Error)
+			}
+			if len(drift.Mismatches) > 0 {
+				return fmt.Errorf("machine %s has %d mismatched files", drift.Machine, len(drift.Mismatches))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the raw drift report as JSON")
+	return cmd
+}
+
+func writeDrift(w io.Writer, drift *daemon.Drift) error {
+	if drift.Error != "" {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "machine %s: %d files recorded %s, %d mismatched\n",
+		drift.Machine, drift.Files, drift.RecordedAt.Local().Format(time.RFC3339), len(drift.Mismatches)); err != nil {
+		return err
+	}
+	if len(drift.Mismatches) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PATH\tPROBLEM")
+	for _, mismatch := range drift.Mismatches {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", mismatch.Path, mismatch.Problem)
+	}
+	return tw.Flush()
+}
+
+func writeEvent(w io.Writer, event daemon.StreamEvent) error {
+	line := fmt.Sprintf("%s %-5s %-6s %s", event.Time.Local().Format(time.RFC3339), event.Level, event.Component, event.Message)
+	for _, key := range slices.Sorted(maps.Keys(event.Fields)) {
+		line += fmt.Sprintf(" %s=%q", key, event.Fields[key])
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+func writeStatus(w io.Writer, status *daemon.Status) error {
+	rows := [][2]string{
+		{"Node", status.NodeName},
+		{"Daemon started", status.DaemonStarted.Local().Format(time.RFC3339)},
+		{"Agent version", fmt.Sprintf("%s (%s)", status.Agent.Version, status.Agent.GitCommit)},
+	}
+	if status.State != nil {
+		rows = append(rows,
+			[2]string{"Active machine", status.State.ActiveMachine},
+			[2]string{"Settings version", status.State.AppliedSettingsVersion},
+			[2]string{"Kubernetes version", status.State.AppliedKubernetesVersion},
+		)
+		if good := status.State.LastKnownGood; good != nil {
+			rows = append(rows, [2]string{"Last known good", fmt.Sprintf("%s (Kubernetes %s)", good.SettingsVersion, good.KubernetesVersion)})
+		}
+	}
+	if m := status.Maintenance; m != nil {
+		rows = append(rows,
+			[2]string{"Maintenance", fmt.Sprintf("until %s", m.ExpiresAt.Local().Format(time.RFC3339))},
+			[2]string{"Maintenance reason", m.Reason},
+		)
+	}
+	if sb := status.Standby; sb != nil {
+		rows = append(rows,
+			[2]string{"Standby", fmt.Sprintf("since %s, kubelet stopped", sb.Since.Local().Format(time.RFC3339))},
+			[2]string{"Standby reason", sb.Reason},
+		)
+	}
+	if power := status.Power; power != nil && power.Sleep != nil {
+		rows = append(rows, [2]string{"Power", fmt.Sprintf("asleep on schedule until %s", power.Sleep.WakeAt.Local().Format(time.RFC3339))})
+	} else if power != nil && !power.NextSleep.IsZero() {
+		rows = append(rows, [2]string{"Power", fmt.Sprintf("awake, next sleep at %s", power.NextSleep.Local().Format(time.RFC3339))})
+	}
+	if power := status.Power; power != nil && power.LastWake != nil && !power.LastWake.Healthy {
+		rows = append(rows, [2]string{"Last wake", fmt.Sprintf("unhealthy at %s: %s", power.LastWake.At.Local().Format(time.RFC3339), power.LastWake.Message)})
+	}
+	if op := status.CurrentOperation; op != nil {
+		now := time.Now()
+		current := op.Name
+		if op.Machine != "" {
+			current += " of " + op.Machine
+		}
+		rows = append(rows, [2]string{"Current operation", fmt.Sprintf("%s, running for %s", current, now.Sub(op.StartedAt).Round(time.Second))})
+		for _, step := range op.Steps {
+			rows = append(rows, [2]string{"Running step", step.Summary(now)})
+		}
+	}
+	if p := status.Prefetched; p != nil {
+		rows = append(rows, [2]string{"Prefetched", fmt.Sprintf("%s for settings %s (Kubernetes %s), downloaded %s, waiting to activate",
+			p.Machine, p.SettingsVersion, p.KubernetesVersion, p.FetchedAt.Local().Format(time.RFC3339))})
+	}
+	if status.APIServer != nil {
+		rows = append(rows, [2]string{"Kube API", status.APIServer.Summary()})
+		for _, warning := range status.APIServer.Warnings {
+			rows = append(rows, [2]string{"Kube API warning", warning})
+		}
+	}
+	if gate := status.ReadinessGate; gate != nil && gate.Holding {
+		rows = append(rows, [2]string{"Readiness gate", "holding node, waiting for " + strings.Join(gate.Pending, ", ")})
+	} else if gate != nil && gate.TimedOut {
+		rows = append(rows, [2]string{"Readiness gate", "timed out waiting for " + strings.Join(gate.Pending, ", ")})
+	}
+	if dns := status.LocalDNS; dns != nil && dns.Healthy {
+		rows = append(rows, [2]string{"Local DNS", "answering at " + dns.Address})
+	} else if dns != nil {
+		rows = append(rows, [2]string{"Local DNS", fmt.Sprintf("not answering since %s: %s", dns.Since.Format(time.RFC3339), dns.Error)})
+	}
+	if usage := status.Usage; usage != nil {
+		rows = append(rows, [2]string{"Usage", usage.Summary()})
+	}
+	for _, ca := range status.TrustedCAs {
+		rows = append(rows, [2]string{"Trusted CA", fmt.Sprintf("%s (%s), expires %s", ca.Subject, ca.Bundle, ca.NotAfter.Local().Format(time.RFC3339))})
+	}
+	if arc := status.ArcConnectivity; arc != nil {
+		rows = append(rows, [2]string{"Arc endpoints", arc.Summary()})
+		for _, endpoint := range arc.Blocked() {
+			rows = append(rows, [2]string{"Arc endpoint", arccheck.BlockedMessage(endpoint)})
+		}
+	}
+	if status.StateError != "" {
+		rows = append(rows, [2]string{"State error", status.StateError})
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if status.LastOperation == nil {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	return daemon.WriteTimings(w, *status.LastOperation)
+}
@@ -1,17 +1,19 @@
 package daemon
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/start"
 	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
 	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
 )
 
 func NewCommand() *cobra.Command {
-	var configPath string
+	var configPath, instance string
 	cmd := &cobra.Command{
 		Use:     "daemon",
 		Aliases: []string{"agent"},
@@ -19,16 +21,23 @@ func NewCommand() *cobra.Command {
 		Long: "Run the long-lived AKS Flex Node daemon with automatic status tracking " +
 			"and self-recovery. This command is intended to be launched by systemd after bootstrap.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadConfig(configPath)
+			cfg, err := settings.LoadConfig(cmd, configPath, config.Instance(instance))
 			if err != nil {
-				return fmt.Errorf("failed to load config from %s: %w", configPath, err)
+				return err
 			}
 			logger := logger.CreateLogger(cfg.Agent.LogLevel, cfg.Agent.LogDir)
+			audit.SetDefault(audit.NewFileLog(cfg.Agent.AuditLogPath))
+			httpclient.SetDefault(cfg.Agent.HTTP)
 
+			if err := start.ResumeDeferred(cmd.Context(), cfg, logger); err != nil {
+				return err
+			}
 			return daemon.Run(cmd.Context(), cfg, logger)
 		},
 	}
 	cmd.Flags().StringVar(&configPath, "config", "", "Path to configuration JSON file (required)")
 	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	settings.AddConfigFlags(cmd, "log-level", "max-disruption")
 	return cmd
 }
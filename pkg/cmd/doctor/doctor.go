@@ -0,0 +1,74 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+)
+
+type handler struct {
+	configPath string
+	instance   string
+	output     string
+	writer     io.Writer
+}
+
+// NewCommand returns the doctor command, which diagnoses a node that does not
+// join or stays NotReady.
+func NewCommand() *cobra.Command {
+	h := &handler{writer: os.Stdout}
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose why the node cannot reach or register with the cluster",
+		Long: "Probe the Kubernetes API server with the credentials the kubelet uses and report the TLS handshake, " +
+			"certificate chain and expiry, /healthz, and whether node registration verbs are authorized.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return h.execute(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVar(&h.configPath, "config", "", "Path to configuration JSON file (required)")
+	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&h.instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	cmd.Flags().StringVar(&h.output, "output", "text", "Output format: text or json")
+
+	return cmd
+}
+
+func (h *handler) execute(ctx context.Context) error {
+	if h.output != "text" && h.output != "json" {
+		return fmt.Errorf("unsupported output format %q: must be text or json", h.output)
+	}
+	cfg, err := config.LoadInstanceConfig(h.configPath, config.Instance(h.instance))
+	if err != nil {
+		return fmt.Errorf("failed to load config from %s: %w", h.configPath, err)
+	}
+	target, err := daemon.APIProbeTarget(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("resolve kubelet credentials: %w", err)
+	}
+	report := apiprobe.Probe(ctx, target)
+
+	if h.output == "json" {
+		enc := json.NewEncoder(h.writer)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := apiprobe.WriteReport(h.writer, report); err != nil {
+		return err
+	}
+	if !report.Healthy() {
+		return fmt.Errorf("kube API probe found a %s failure", report.Failure)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package egress
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/egress"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
+)
+
+// NewCommand returns the egress-report command.
+func NewCommand() *cobra.Command {
+	var (
+		configPath string
+		instance   string
+		output     string
+		proxy      string
+	)
+	cmd := &cobra.Command{
+		Use:   "egress-report",
+		Short: "List the network endpoints this node connects to",
+		Long: "Compute the endpoints the node reaches, from the config and the resolved component versions: Azure Resource Manager, " +
+			"Microsoft Entra ID, Azure Arc, the AKS API server, artifact downloads, and image registries. The report is written as " +
+			"JSON or CSV, or as a proxy auto-config file, squid ACLs, or Azure Firewall rules. Nothing is contacted.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output = strings.ToLower(strings.TrimSpace(output))
+			if output == "pac" && proxy == "" {
+				return fmt.Errorf("--output pac needs --proxy")
+			}
+			cfg, err := settings.LoadConfig(cmd, configPath, config.Instance(instance))
+			if err != nil {
+				return err
+			}
+			// Diagnostics go to stderr so the report on stdout stays
+			// machine-readable.
+			log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+			_, gs, _, err := config.ResolveMachineGoalState(log, cfg, cfg.Instance.Machines()[0])
+			if err != nil {
+				return fmt.Errorf("resolve goal state: %w", err)
+			}
+			report := egress.Collect(cfg, gs)
+
+			w := cmd.OutOrStdout()
+			switch output {
+			case "", "json":
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			case "csv":
+				return egress.WriteCSV(w, report)
+			case "pac":
+				return egress.WritePAC(w, report, proxy)
+			case "squid":
+				return egress.WriteSquid(w, report)
+			case "azure-firewall":
+				return egress.WriteAzureFirewall(w, report)
+			default:
+				return fmt.Errorf("unsupported output format %q", output)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to configuration JSON file (required)")
+	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	cmd.Flags().StringVar(&output, "output", "json", "Output format: json, csv, pac, squid, or azure-firewall")
+	cmd.Flags().StringVar(&proxy, "proxy", "", "Proxy host:port the PAC file sends allowlisted hosts through")
+	return cmd
+}
@@ -0,0 +1,126 @@
+package enroll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/start"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/enrollment"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/logger"
+)
+
+const (
+	defaultTokenPath  = config.ConfigDir + "/enrollment-token"
+	defaultConfigPath = config.ConfigDir + "/config.json"
+	machineIDPath     = "/etc/machine-id"
+)
+
+type handler struct {
+	provisioner string
+	endpoint    string
+	tokenPath   string
+	configPath  string
+}
+
+// NewCommand returns the enroll command, which provisions a factory-enrolled
+// device from a one-time enrollment token and bootstraps it.
+func NewCommand() *cobra.Command {
+	h := &handler{}
+	cmd := &cobra.Command{
+		Use:   "enroll",
+		Short: "Exchange a one-time enrollment token for the node config and bootstrap the node",
+		Long: "Present the device's one-time enrollment token to the provisioning endpoint, which returns the agent config " +
+			"including the Arc onboarding credentials. The config is written to --config, the token is deleted, and the " +
+			"node is bootstrapped as start does. Re-running after the token was consumed resumes from the written config.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return h.execute(cmd.Context())
+		},
+	}
+	cmd.Flags().StringVar(&h.provisioner, "provisioner", enrollment.HTTPProvisionerName, "Enrollment provisioner that performs the token exchange")
+	cmd.Flags().StringVar(&h.endpoint, "endpoint", "", "Provisioning endpoint URL (required)")
+	_ = cmd.MarkFlagRequired("endpoint")
+	cmd.Flags().StringVar(&h.tokenPath, "token-file", defaultTokenPath, "File holding the one-time enrollment token")
+	cmd.Flags().StringVar(&h.configPath, "config", defaultConfigPath, "Where to write the provisioned agent config")
+	return cmd
+}
+
+func (h *handler) execute(ctx context.Context) error {
+	log := logger.CreateLogger("info", "")
+	if err := h.enroll(ctx, log); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig(h.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config from %s: %w", h.configPath, err)
+	}
+	log = logger.CreateLogger(cfg.Agent.LogLevel, cfg.Agent.LogDir)
+	audit.SetDefault(audit.NewFileLog(cfg.Agent.AuditLogPath))
+	httpclient.SetDefault(cfg.Agent.HTTP)
+	if _, err := start.Run(ctx, cfg, log); err != nil {
+		return err
+	}
+	fmt.Println("AKS Flex Node enrolled and agent service started successfully.")
+	return nil
+}
+
+// enroll exchanges the token for the config. The token is single use, so once
+// it is gone a config written by an earlier run is reused instead.
+func (h *handler) enroll(ctx context.Context, log *slog.Logger) error {
+	token, err := os.ReadFile(filepath.Clean(h.tokenPath))
+	if errors.Is(err, os.ErrNotExist) {
+		if _, serr := os.Stat(h.configPath); serr == nil {
+			log.Info("enrollment token already consumed, resuming from written config", "config", h.configPath)
+			return nil
+		}
+		return fmt.Errorf("enrollment token %s not found", h.tokenPath)
+	}
+	if err != nil {
+		return fmt.Errorf("read enrollment token: %w", err)
+	}
+
+	provisioner, err := enrollment.New(h.provisioner, h.endpoint)
+	if err != nil {
+		return err
+	}
+	nodeName, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("get hostname: %w", err)
+	}
+	req := enrollment.Request{
+		Credential: strings.TrimSpace(string(token)),
+		NodeName:   nodeName,
+		MachineID:  readMachineID(),
+	}
+	result, err := provisioner.Provision(ctx, req)
+	if err != nil {
+		return fmt.Errorf("enroll with %s: %w", h.endpoint, err)
+	}
+
+	if _, err := config.WriteConfigFile(h.configPath, result.Config); err != nil {
+		return fmt.Errorf("write provisioned config: %w", err)
+	}
+	if err := os.Remove(h.tokenPath); err != nil {
+		return fmt.Errorf("remove consumed enrollment token: %w", err)
+	}
+	log.Info("device enrolled", "provisioner", h.provisioner, "endpoint", h.endpoint, "config", h.configPath)
+	return nil
+}
+
+func readMachineID() string {
+	data, err := os.ReadFile(machineIDPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,211 @@
+package extension
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/reset"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/start"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/extension"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const configPath = config.ConfigDir + "/config.json"
+
+type handler struct {
+	extensionDir string
+	certDir      string
+}
+
+// NewCommand returns the extension command, the entrypoint the Azure Arc
+// extension manager runs for each handler operation.
+func NewCommand() *cobra.Command {
+	h := &handler{}
+	cmd := &cobra.Command{
+		Use:   "extension",
+		Short: "Run as an Azure Arc machine extension handler",
+		Long: "Handler commands for deploying the agent as an Azure Arc machine extension. The extension settings " +
+			"become the agent config: public settings hold the config document and protected settings are merged over " +
+			"them for secrets. Each operation reports its outcome in the extension status file.",
+	}
+	cmd.PersistentFlags().StringVar(&h.extensionDir, "extension-dir", "", "Extension directory containing HandlerEnvironment.json; defaults to the working directory")
+	cmd.PersistentFlags().StringVar(&h.certDir, "cert-dir", extension.DefaultCertDir, "Directory holding the certificates that encrypt protected settings")
+
+	for _, op := range []struct {
+		name  string
+		short string
+		run   func(context.Context, *slog.Logger, *extension.Environment, int) (string, error)
+	}{
+		{"install", "Prepare the extension; the node is bootstrapped by enable", h.install},
+		{"enable", "Write the agent config from the extension settings and bootstrap or restart the agent", h.enable},
+		{"disable", "Stop the agent service", h.disable},
+		{"update", "Prepare an extension update; the new version's enable restarts the agent", h.update},
+		{"uninstall", "Remove the agent, the node, and its Arc connection", h.uninstall},
+	} {
+		cmd.AddCommand(&cobra.Command{
+			Use:   op.name,
+			Short: op.short,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return h.execute(cmd.Context(), op.name, op.run)
+			},
+		})
+	}
+	return cmd
+}
+
+// execute runs one handler operation, reporting it as transitioning while it
+// runs and as success or error when it finishes.
+func (h *handler) execute(ctx context.Context, operation string, run func(context.Context, *slog.Logger, *extension.Environment, int) (string, error)) error {
+	dir := h.extensionDir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("get working directory: %w", err)
+		}
+		dir = wd
+	}
+	env, err := extension.LoadEnvironment(dir)
+	if err != nil {
+		return err
+	}
+	log := logger.CreateLogger("info", env.LogFolder).With("operation", operation)
+	seq, err := env.SequenceNumber()
+	if err != nil {
+		return err
+	}
+	report := func(state extension.State, message string) {
+		// Install runs before the first settings arrive and has no
+		// sequence number to report under.
+		if seq < 0 {
+			return
+		}
+		if err := env.WriteStatus(seq, operation, state, message); err != nil {
+			log.Warn("failed to write extension status", "error", err)
+		}
+	}
+
+	report(extension.StateTransitioning, operation+" in progress")
+	message, err := run(ctx, log, env, seq)
+	if err != nil {
+		report(extension.StateError, err.Error())
+		return err
+	}
+	report(extension.StateSuccess, message)
+	log.Info("extension operation completed", "message", message)
+	return nil
+}
+
+func (h *handler) install(context.Context, *slog.Logger, *extension.Environment, int) (string, error) {
+	return "installed", nil
+}
+
+func (h *handler) enable(ctx context.Context, log *slog.Logger, env *extension.Environment, seq int) (string, error) {
+	if seq < 0 {
+		return "", fmt.Errorf("no extension settings to enable")
+	}
+	settings, err := env.LoadSettings(ctx, seq, h.certDir)
+	if err != nil {
+		return "", err
+	}
+	data, err := settings.Config()
+	if err != nil {
+		return "", err
+	}
+	// An invalid config from the settings leaves the running one in place.
+	cfg, err := config.WriteConfigFile(configPath, data)
+	if err != nil {
+		return "", fmt.Errorf("write agent config from extension settings: %w", err)
+	}
+	audit.SetDefault(audit.NewFileLog(cfg.Agent.AuditLogPath))
+	httpclient.SetDefault(cfg.Agent.HTTP)
+	if err := installAgentBinary(cfg.Agent.BinaryPath); err != nil {
+		return "", err
+	}
+
+	store, err := daemon.NewFileStateStore(cfg.Instance)
+	if err != nil {
+		return "", err
+	}
+	state, err := store.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+	if state != nil && state.ActiveMachine != "" {
+		// Already bootstrapped: the daemon reconciles the node to the new
+		// config and binary once restarted.
+		unit := cfg.Instance.ServiceUnitName()
+		if err := utilexec.RestartService(ctx, log, unit); err != nil {
+			return "", fmt.Errorf("restart %s: %w", unit, err)
+		}
+		return fmt.Sprintf("agent restarted with settings %d", seq), nil
+	}
+	if _, err := start.Run(ctx, cfg, log); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("node bootstrapped with settings %d", seq), nil
+}
+
+func (h *handler) disable(ctx context.Context, log *slog.Logger, _ *extension.Environment, _ int) (string, error) {
+	if err := daemon.StopAgentService(ctx, log, config.Instance("")); err != nil {
+		return "", err
+	}
+	return "agent stopped", nil
+}
+
+func (h *handler) update(context.Context, *slog.Logger, *extension.Environment, int) (string, error) {
+	return "updated; enable installs the new agent binary", nil
+}
+
+func (h *handler) uninstall(ctx context.Context, log *slog.Logger, _ *extension.Environment, _ int) (string, error) {
+	// The config enable wrote carries the preUnbootstrap hooks. Without a
+	// readable one, the node is still removed, only without them.
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		log.Warn("removing the node without preUnbootstrap hooks", "config", configPath, "error", err)
+		cfg = nil
+		audit.SetDefault(audit.NewFileLog(audit.DefaultLogPath))
+	} else {
+		audit.SetDefault(audit.NewFileLog(cfg.Agent.AuditLogPath))
+	}
+	if err := reset.Run(ctx, log, "", cfg); err != nil {
+		return "", err
+	}
+	return "agent and node removed", nil
+}
+
+// installAgentBinary copies the running extension binary to binaryPath, the
+// path the agent unit executes, unless it already runs from there. Updates
+// and rollbacks take effect through this copy.
+func installAgentBinary(binaryPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate extension binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	if exe == binaryPath {
+		return nil
+	}
+	f, err := os.Open(filepath.Clean(exe))
+	if err != nil {
+		return fmt.Errorf("open extension binary: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+
+	if err := utilio.InstallFile(binaryPath, f, 0o755); err != nil { //nolint:gosec // binary must be executable
+		return fmt.Errorf("install agent binary: %w", err)
+	}
+	return nil
+}
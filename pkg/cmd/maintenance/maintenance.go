@@ -0,0 +1,87 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+)
+
+// NewCommand returns the maintenance command group. Both subcommands go
+// through the running daemon so it cordons the node with its own credentials
+// and pauses its reconcile loop in the same step.
+func NewCommand() *cobra.Command {
+	var socketPath, instance string
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Pause agent reconciliation for hands-on node work",
+		Long: "Cordon the node and pause the daemon's goal-state and repave reconciliation so an operator " +
+			"can work on the host without the agent reverting changes. Maintenance expires automatically.",
+	}
+	cmd.PersistentFlags().StringVar(&socketPath, "socket", daemon.DefaultControlSocketPath, "Path to the daemon admin API socket")
+	cmd.PersistentFlags().StringVar(&instance, "instance", "", "Named node instance whose daemon to talk to; ignored when --socket is set")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("socket") || instance == "" {
+			return nil
+		}
+		if err := config.Instance(instance).Validate(); err != nil {
+			return err
+		}
+		socketPath = config.Instance(instance).ControlSocketPath()
+		return nil
+	}
+	cmd.AddCommand(newEnableCommand(&socketPath))
+	cmd.AddCommand(newDisableCommand(&socketPath))
+	return cmd
+}
+
+func newEnableCommand(socketPath *string) *cobra.Command {
+	var (
+		reason       string
+		duration     time.Duration
+		drain        bool
+		drainTimeout time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "enable",
+		Short: "Cordon the node, optionally drain it, and pause reconciliation",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 {
+				return fmt.Errorf("--duration must be positive")
+			}
+			record, err := daemon.NewControlClient(*socketPath).EnableMaintenance(cmd.Context(), daemon.MaintenanceRequest{
+				Reason:       reason,
+				Duration:     config.JSONDuration(duration),
+				Drain:        drain,
+				DrainTimeout: config.JSONDuration(drainTimeout),
+			})
+			if err != nil {
+				return fmt.Errorf("enable maintenance: %w", err)
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Maintenance enabled until %s.\n", record.ExpiresAt.Local().Format(time.RFC3339))
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the node is in maintenance; shown in status")
+	cmd.Flags().DurationVar(&duration, "duration", daemon.DefaultMaintenanceDuration, "How long maintenance lasts before it expires automatically")
+	cmd.Flags().BoolVar(&drain, "drain", false, "Evict pods from the node after cordoning it")
+	cmd.Flags().DurationVar(&drainTimeout, "drain-timeout", daemon.DefaultDrainTimeout, "How long to retry evictions blocked by PodDisruptionBudgets")
+	return cmd
+}
+
+func newDisableCommand(socketPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable",
+		Short: "End maintenance and uncordon the node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := daemon.NewControlClient(*socketPath).DisableMaintenance(cmd.Context()); err != nil {
+				return fmt.Errorf("disable maintenance: %w", err)
+			}
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), "Maintenance disabled.")
+			return err
+		},
+	}
+}
@@ -11,10 +11,21 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/arccheck"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/hostconflict"
+	"github.com/Azure/AKSFlexNode/pkg/localdns"
+	"github.com/Azure/AKSFlexNode/pkg/localstorage"
 	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/nodetools"
 	"github.com/Azure/AKSFlexNode/pkg/npd"
-	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/AKSFlexNode/pkg/performance"
+	"github.com/Azure/AKSFlexNode/pkg/sriov"
+	"github.com/Azure/AKSFlexNode/pkg/ubuntucore"
+	"github.com/Azure/AKSFlexNode/pkg/wsl"
 	"github.com/Azure/unbounded/pkg/agent/phases/host"
 	"github.com/Azure/unbounded/pkg/agent/phases/nodestart"
 	"github.com/Azure/unbounded/pkg/agent/phases/rootfs"
@@ -23,6 +34,7 @@ import (
 
 type handler struct {
 	configPath            string
+	instance              string
 	ignorePreflightErrors []string
 	failOnWarnings        bool
 	output                string
@@ -44,6 +56,7 @@ func NewCommand() *cobra.Command {
 
 	cmd.Flags().StringVar(&h.configPath, "config", "", "Path to configuration JSON file (required)")
 	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&h.instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
 	cmd.Flags().StringSliceVar(
 		&h.ignorePreflightErrors,
 		"ignore-preflight-errors",
@@ -62,22 +75,39 @@ func (h *handler) execute(ctx context.Context) error {
 		return err
 	}
 
-	cfg, err := config.LoadConfig(h.configPath)
+	cfg, err := config.LoadInstanceConfig(h.configPath, config.Instance(h.instance))
 	if err != nil {
 		return fmt.Errorf("failed to load config from %s: %w", h.configPath, err)
 	}
 	log := createPreflightLogger(cfg.Agent.LogLevel)
 
-	agentCfg, gs, _, err := config.ResolveMachineGoalState(log, cfg, goalstates.NSpawnMachineKube1)
+	agentCfg, gs, _, err := config.ResolveMachineGoalState(log, cfg, cfg.Instance.Machines()[0])
 	if err != nil {
 		return fmt.Errorf("preflight failed to resolve goal state: %w", err)
 	}
 
+	deviceProfile, err := deviceprofile.Lookup(cfg.Node.DeviceProfile)
+	if err != nil {
+		return fmt.Errorf("preflight failed to resolve device profile: %w", err)
+	}
+
 	checks := preflight.Flatten(
 		host.Preflight(log, *agentCfg, gs),
 		nodestart.Preflight(log, *agentCfg, gs),
 		rootfs.Preflight(log, *agentCfg, gs),
 		npd.Preflight(cfg),
+		nodetools.Preflight(cfg),
+		localdns.Preflight(cfg),
+		wsl.Preflight(),
+		ubuntucore.Preflight(),
+		deviceprofile.Preflight(log, deviceProfile),
+		performance.Preflight(log, cfg, deviceProfile.BootCmdline()),
+		sriov.Preflight(log, cfg),
+		localstorage.Preflight(cfg),
+		apiprobe.Preflight(cfg),
+		arccheck.Preflight(log, cfg),
+		hostconflict.Preflight(cfg.Agent.QuarantineConflicts),
+		daemon.Preflight(cfg),
 	)
 
 	report := preflight.Run(ctx, checks, preflight.Options{
@@ -6,28 +6,61 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/hooks"
 	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
 
 func NewCommand() *cobra.Command {
-	return &cobra.Command{
+	var (
+		configPath string
+		instance   string
+	)
+	cmd := &cobra.Command{
 		Use:     "reset",
 		Aliases: []string{"unbootstrap"},
 		Short:   "Remove AKS node configuration and Arc connection",
-		Long:    "Clean up and remove all AKS node components and Arc registration from this machine",
+		Long: "Clean up and remove all AKS node components and Arc registration from this machine. " +
+			"With --instance only that node instance's machines, agent unit, and state are removed.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			log := logger.CreateLogger("info", "")
-			return runReset(cmd.Context(), log)
+			// Reset runs without a config file, so it can only append to the
+			// default audit log location.
+			audit.SetDefault(audit.NewFileLog(audit.DefaultLogPath))
+			instance := config.Instance(instance)
+			if err := instance.Validate(); err != nil {
+				return err
+			}
+			var cfg *config.Config
+			if configPath != "" {
+				var err error
+				if cfg, err = settings.LoadConfig(cmd, configPath, instance); err != nil {
+					return err
+				}
+			}
+			return Run(cmd.Context(), log, instance, cfg)
 		},
 	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to the configuration JSON file whose preUnbootstrap hooks to run; optional")
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance to remove; empty removes every node and the host setup")
+	return cmd
 }
 
-func runReset(ctx context.Context, logger *slog.Logger) error {
+// Run removes the instance's agent unit and node, or every node and the host
+// setup when instance is empty. With a config, its preUnbootstrap hooks run first.
+func Run(ctx context.Context, logger *slog.Logger, instance config.Instance, cfg *config.Config) error {
+	if cfg != nil {
+		if err := phases.ExecuteTask(ctx, logger, hooks.Run(logger, cfg, config.HookPreUnbootstrap, hooks.Facts{})); err != nil {
+			return err
+		}
+	}
 	tasks := phases.Serial(logger,
-		daemon.UninstallService(logger),
-		daemon.ResetNode(logger),
+		daemon.UninstallService(logger, instance),
+		daemon.ResetNode(logger, instance),
 	)
 	return phases.ExecuteTask(ctx, logger, tasks)
 }
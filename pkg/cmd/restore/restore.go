@@ -0,0 +1,73 @@
+package restore
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+// NewCommand returns the restore-metadata command.
+func NewCommand() *cobra.Command {
+	var (
+		instance string
+		snapshot string
+		list     bool
+	)
+	cmd := &cobra.Command{
+		Use:   "restore-metadata",
+		Short: "Restore the agent's node metadata from a snapshot",
+		Long: "Replace the daemon state, machine manifest, and maintenance record with a snapshot the daemon took " +
+			"before a repave. Stop the agent service first; it is restarted with the restored state by systemctl start. " +
+			"A snapshot whose active machine was removed after the repave is refused.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			instance := config.Instance(instance)
+			if err := instance.Validate(); err != nil {
+				return err
+			}
+			store := daemon.NewSnapshotStore(instance)
+			out := cmd.OutOrStdout()
+			if list {
+				names, err := store.List()
+				if err != nil {
+					return err
+				}
+				for _, name := range names {
+					if _, err := fmt.Fprintln(out, name); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			log := logger.CreateLogger("info", "")
+			unit := instance.ServiceUnitName()
+			if utilexec.IsServiceActive(cmd.Context(), log, unit) {
+				return fmt.Errorf("%s is running; stop it before restoring metadata", unit)
+			}
+			// Like reset, restore runs without a config file, so it can only
+			// append to the default audit log location.
+			audit.SetDefault(audit.NewFileLog(audit.DefaultLogPath))
+			name, err := store.Restore(snapshot)
+			if err != nil {
+				return fmt.Errorf("restore metadata: %w", err)
+			}
+			audit.Record(cmd.Context(), log, audit.Event{
+				Operation: audit.OperationFileWrite,
+				Target:    instance.StateDir(),
+				Detail:    "restored metadata snapshot " + name,
+			})
+			_, err = fmt.Fprintf(out, "Restored metadata snapshot %s. Start %s to resume.\n", name, unit)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance whose metadata to restore; empty selects the default node")
+	cmd.Flags().StringVar(&snapshot, "snapshot", "", "Snapshot to restore, as printed by --list; defaults to the newest")
+	cmd.Flags().BoolVar(&list, "list", false, "List the snapshots, newest first, and exit")
+	return cmd
+}
@@ -0,0 +1,69 @@
+package standby
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+)
+
+// NewCommand returns the standby command group. Both subcommands go through
+// the running daemon, which records the request in the Node's standby
+// annotation so cluster-side automation sees the same state.
+func NewCommand() *cobra.Command {
+	var socketPath, instance string
+	cmd := &cobra.Command{
+		Use:   "standby",
+		Short: "Move the node between standby and active",
+		Long: "Keep a bootstrapped node as warm capacity with its kubelet stopped and the node cordoned, " +
+			"or activate it. Requires agent.standby.enabled.",
+	}
+	cmd.PersistentFlags().StringVar(&socketPath, "socket", daemon.DefaultControlSocketPath, "Path to the daemon admin API socket")
+	cmd.PersistentFlags().StringVar(&instance, "instance", "", "Named node instance whose daemon to talk to; ignored when --socket is set")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("socket") || instance == "" {
+			return nil
+		}
+		if err := config.Instance(instance).Validate(); err != nil {
+			return err
+		}
+		socketPath = config.Instance(instance).ControlSocketPath()
+		return nil
+	}
+	cmd.AddCommand(newDeactivateCommand(&socketPath))
+	cmd.AddCommand(newActivateCommand(&socketPath))
+	return cmd
+}
+
+func newDeactivateCommand(socketPath *string) *cobra.Command {
+	var reason string
+	cmd := &cobra.Command{
+		Use:   "deactivate",
+		Short: "Cordon and drain the node, then stop its kubelet",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := daemon.NewControlClient(*socketPath).Deactivate(cmd.Context(), daemon.StandbyRequest{Reason: reason}); err != nil {
+				return fmt.Errorf("enter standby: %w", err)
+			}
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), "Node is in standby.")
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the node is in standby; shown in status")
+	return cmd
+}
+
+func newActivateCommand(socketPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "activate",
+		Short: "Start the kubelet and uncordon the node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := daemon.NewControlClient(*socketPath).Activate(cmd.Context()); err != nil {
+				return fmt.Errorf("activate node: %w", err)
+			}
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), "Node is active.")
+			return err
+		},
+	}
+}
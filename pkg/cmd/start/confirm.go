@@ -0,0 +1,53 @@
+package start
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+)
+
+// errNotConfirmed is returned when the operator declines the start plan.
+var errNotConfirmed = errors.New("start canceled: the host changes were not confirmed")
+
+// interactive reports whether start should ask before it changes the host:
+// stdin is a terminal and the process does not run under systemd, which sets
+// INVOCATION_ID for the processes of every unit it starts.
+func interactive() bool {
+	if os.Getenv("INVOCATION_ID") != "" {
+		return false
+	}
+	_, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), unix.TCGETS)
+	return err == nil
+}
+
+// confirmStart prints what start changes in /etc and which units it acts on,
+// then asks the operator on in to go ahead.
+func confirmStart(ctx context.Context, cfg *config.Config, in io.Reader, out io.Writer) error {
+	plan, err := daemon.PlanStart(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("plan host changes: %w", err)
+	}
+	if err := plan.Write(out); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprint(out, "\nProceed? [y/N] ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return errNotConfirmed
+	}
+}
@@ -2,34 +2,87 @@ package start
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/hooks"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
 	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/netwait"
+	"github.com/Azure/AKSFlexNode/pkg/settings"
+	"github.com/Azure/AKSFlexNode/pkg/ubuntucore"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
 
 func NewCommand() *cobra.Command {
-	var configPath string
+	var (
+		configPath  string
+		instance    string
+		output      string
+		showTimings bool
+		yes         bool
+	)
 	cmd := &cobra.Command{
 		Use:     "start",
 		Aliases: []string{"bootstrap"},
 		Short:   "Bootstrap the node and start the agent service",
-		Long:    "Install the systemd unit, bootstrap the nspawn-based AKS worker node, then enable and start the agent daemon through systemd.",
+		Long: "Install the systemd unit, bootstrap the nspawn-based AKS worker node, then enable and start the agent daemon through systemd. " +
+			"From a terminal, start first lists the /etc entries it adds or replaces and the units it acts on and asks for confirmation; " +
+			"--yes skips the question, and start never asks when systemd runs it.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadConfig(configPath)
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unsupported output format %q: must be text or json", output)
+			}
+			cfg, err := settings.LoadConfig(cmd, configPath, config.Instance(instance))
 			if err != nil {
-				return fmt.Errorf("failed to load config from %s: %w", configPath, err)
+				return err
+			}
+			// Keep stdout to the outputs document when it is requested.
+			console := io.Writer(os.Stdout)
+			if output == "json" {
+				console = os.Stderr
 			}
-			logger := logger.CreateLogger(cfg.Agent.LogLevel, cfg.Agent.LogDir)
+			logger := logger.CreateLoggerTo(console, cfg.Agent.LogLevel, cfg.Agent.LogDir)
+			audit.SetDefault(audit.NewFileLog(cfg.Agent.AuditLogPath))
+			httpclient.SetDefault(cfg.Agent.HTTP)
 
-			if err := runStart(cmd.Context(), cfg, logger); err != nil {
+			if !yes && interactive() {
+				if err := confirmStart(cmd.Context(), cfg, os.Stdin, console); err != nil {
+					return err
+				}
+			}
+			timings, err := Run(cmd.Context(), cfg, logger)
+			if showTimings {
+				_, _ = fmt.Fprintln(console)
+				if werr := daemon.WriteTimings(console, timings); werr != nil {
+					logger.Warn("failed to print bootstrap timings", "error", werr)
+				}
+			}
+			deferred := errors.Is(err, ErrBootstrapDeferred)
+			if output == "json" && (err == nil || deferred) {
+				return writeOutputs(cfg, deferred)
+			}
+			unit := cfg.Instance.ServiceUnitName()
+			if deferred {
+				fmt.Println()
+				fmt.Println("The network is not available yet; bootstrap was deferred.")
+				fmt.Println("The agent service finishes the bootstrap once the network is up.")
+				fmt.Println()
+				fmt.Println("  Follow progress: journalctl -u " + unit + " -f")
+				return nil
+			}
+			if err != nil {
 				return err
 			}
 
@@ -37,19 +90,85 @@ func NewCommand() *cobra.Command {
 			fmt.Println("AKS Flex Node agent service started successfully.")
 			fmt.Println()
 			fmt.Println("Next steps:")
-			fmt.Println("  Check service status: systemctl status aks-flex-node-agent")
-			fmt.Println("  View service logs:    journalctl -u aks-flex-node-agent -f")
-			fmt.Println("  Stop agent:           systemctl stop aks-flex-node-agent")
+			fmt.Println("  Check service status: systemctl status " + unit)
+			fmt.Println("  View service logs:    journalctl -u " + unit + " -f")
+			fmt.Println("  Stop agent:           systemctl stop " + unit)
 			return nil
 		},
 	}
 	cmd.Flags().StringVar(&configPath, "config", "", "Path to configuration JSON file (required)")
 	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	cmd.Flags().BoolVar(&showTimings, "timings", false, "Print the per-step bootstrap timing breakdown")
+	cmd.Flags().BoolVar(&yes, "yes", false, "Apply the host changes without asking for confirmation on a terminal")
+	cmd.Flags().StringVar(&output, "output", "text", "Output format: text, or json to print the node registration outputs document")
+	settings.AddConfigFlags(cmd, "log-level")
 
 	return cmd
 }
 
-func runStart(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+// writeOutputs prints the node registration outputs document. A deferred
+// bootstrap has not written one yet, so the fields known from the config are
+// printed instead.
+func writeOutputs(cfg *config.Config, deferred bool) error {
+	outputs := daemon.NewOutputs(cfg, nil)
+	if !deferred {
+		saved, err := daemon.NewOutputsStore(cfg.Instance).Load()
+		if err != nil {
+			return err
+		}
+		if saved != nil {
+			outputs = saved
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(outputs)
+}
+
+// ErrBootstrapDeferred is returned by Run when the network was unavailable at
+// the bootstrap.networkWait timeout and bootstrap.networkWait.deferOnTimeout
+// handed the bootstrap over to the agent service.
+var ErrBootstrapDeferred = errors.New("bootstrap deferred until the network is available")
+
+// Run bootstraps the node and returns the per-step timing breakdown,
+// which is also persisted for the daemon to export as metrics. Timings are
+// returned and persisted on failure too, since slow or failing steps are what
+// they are for.
+func Run(ctx context.Context, cfg *config.Config, logger *slog.Logger) (daemon.OperationTimings, error) {
+	timings := daemon.NewStepTimings(daemon.TimingOperationBootstrap, "")
+	stopProgress := daemon.ReportProgress(ctx, logger, timings, daemon.NewProgressStore(cfg.Instance))
+	err := bootstrap(ctx, cfg, logger, timings)
+	stopProgress()
+	result := timings.Finish(err)
+	if serr := daemon.NewTimingsStore(cfg.Instance).Save(result); serr != nil {
+		logger.Warn("failed to persist bootstrap timings", "error", serr)
+	}
+	return result, err
+}
+
+func bootstrap(ctx context.Context, cfg *config.Config, logger *slog.Logger, timings *daemon.StepTimings) error {
+	if err := ubuntucore.EnsureSupported(); err != nil {
+		return err
+	}
+	daemon.LowerAgentPriority(logger, cfg.Agent.Resources)
+	if err := cfg.PersistNodeID(); err != nil {
+		return fmt.Errorf("bootstrap failed: %w", err)
+	}
+	if err := waitForNetwork(ctx, cfg, logger); err != nil {
+		return err
+	}
+	if err := daemon.ResolveVMTopology(ctx, cfg); err != nil {
+		return fmt.Errorf("bootstrap failed: %w", err)
+	}
+	if cfg.Agent.MachineClient.Mode == config.MachineClientModeARM && cfg.Agent.MachineClient.EndpointURL == "" {
+		if err := alignWithAgentPool(ctx, cfg, logger); err != nil {
+			return fmt.Errorf("bootstrap failed: %w", err)
+		}
+	}
+	if err := daemon.CheckNodeNameCollision(ctx, logger, cfg); err != nil {
+		return fmt.Errorf("bootstrap failed: %w", err)
+	}
 	goal, err := aksmachine.GoalStateFromConfig(cfg)
 	if err != nil {
 		return fmt.Errorf("build goal state from config: %w", err)
@@ -59,18 +178,21 @@ func runStart(ctx context.Context, cfg *config.Config, logger *slog.Logger) erro
 		return fmt.Errorf("create AKS machine client: %w", err)
 	}
 	start := time.Now()
-	if err := phases.ExecuteTask(ctx, logger, aksmachine.EnsureMachine(
+	if err := phases.ExecuteTask(ctx, logger, timings.Track(hooks.Run(logger, cfg, config.HookPreBootstrap, hooks.Facts{}))); err != nil {
+		return fmt.Errorf("bootstrap failed: %w", err)
+	}
+	if err := phases.ExecuteTask(ctx, logger, timings.Track(aksmachine.EnsureMachine(
 		machines,
 		&goal,
 		cfg.Agent.RequireMachineRegistration,
 		logger,
-	)); err != nil {
+	))); err != nil {
 		return fmt.Errorf("bootstrap failed: %w", err)
 	}
 
-	state := daemon.SeededState(goal)
+	state := daemon.SeededState(goal, cfg.Instance)
 	machineName := state.ActiveMachine
-	stateStore, err := daemon.NewFileStateStore()
+	stateStore, err := daemon.NewFileStateStore(cfg.Instance)
 	if err != nil {
 		return err
 	}
@@ -81,14 +203,86 @@ func runStart(ctx context.Context, cfg *config.Config, logger *slog.Logger) erro
 	}
 
 	tasks := phases.Serial(logger,
-		daemon.SetupHost(cfg, logger),
-		daemon.StartNode(cfg, logger, machineName, gs, containerImageArchives, stateStore, state),
-		daemon.InstallService(logger),
+		daemon.SetupHost(cfg, logger, timings),
+		daemon.StartNode(cfg, logger, machineName, gs, containerImageArchives, stateStore, state, timings),
+		timings.Track(daemon.InstallService(logger, cfg)),
+		timings.Track(hooks.Run(logger, cfg, config.HookPostBootstrap, hooks.Facts{Machine: machineName, MachineDir: gs.RootFS.MachineDir})),
 	)
 	if err := phases.ExecuteTask(ctx, logger, tasks); err != nil {
 		return fmt.Errorf("bootstrap failed: %w", err)
 	}
 	logger.Info("operation completed successfully", "operation", "bootstrap", "duration", time.Since(start))
+	if err := daemon.NewOutputsStore(cfg.Instance).Save(daemon.NewOutputs(cfg, state)); err != nil {
+		logger.Warn("failed to write registration outputs", "error", err)
+	}
 
 	return nil
 }
+
+// alignWithAgentPool validates the target agent pool and, when configured,
+// merges its profile into cfg before the goal state is built from it.
+func alignWithAgentPool(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	pools, err := aksmachine.NewAgentPoolReader(cfg, logger)
+	if err != nil {
+		if cfg.Azure.InheritAgentPoolProfile {
+			return fmt.Errorf("create agent pool reader: %w", err)
+		}
+		logger.Warn("could not validate the target agent pool", "pool", cfg.Azure.TargetAgentPoolName, "error", err)
+		return nil
+	}
+	return aksmachine.AlignWithAgentPool(ctx, logger, cfg, pools)
+}
+
+// waitForNetwork holds bootstrap until the endpoints it needs are reachable.
+// When they are not at the timeout and deferOnTimeout is set, it installs the
+// agent service with a deferred bootstrap marker and returns
+// ErrBootstrapDeferred.
+func waitForNetwork(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	wait := cfg.Bootstrap.NetworkWait
+	if wait.Disabled {
+		return nil
+	}
+	err := netwait.New(logger, cfg).Wait(ctx, wait.TimeoutOrDefault())
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, netwait.ErrUnavailable) || !wait.DeferOnTimeout {
+		return fmt.Errorf("bootstrap failed: %w", err)
+	}
+
+	logger.Warn("deferring bootstrap to the agent service until the network is available", "error", err)
+	if err := daemon.NewDeferredBootstrap(cfg.Instance).Mark(); err != nil {
+		return err
+	}
+	if err := phases.ExecuteTask(ctx, logger, daemon.InstallService(logger, cfg)); err != nil {
+		return fmt.Errorf("install agent service for deferred bootstrap: %w", err)
+	}
+	return ErrBootstrapDeferred
+}
+
+// ResumeDeferred finishes a bootstrap that start deferred, waiting as long as
+// it takes for the network first. The daemon calls it before it starts its
+// controllers; the marker is only cleared once the bootstrap succeeded, so a
+// failed attempt is retried when systemd restarts the service.
+func ResumeDeferred(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	marker := daemon.NewDeferredBootstrap(cfg.Instance)
+	pending, err := marker.Pending()
+	if err != nil || !pending {
+		return err
+	}
+	logger.Info("resuming deferred bootstrap")
+	for {
+		if err := netwait.New(logger, cfg).Wait(ctx, 0); err != nil {
+			return fmt.Errorf("wait for the network: %w", err)
+		}
+		_, err := Run(ctx, cfg, logger)
+		if errors.Is(err, ErrBootstrapDeferred) {
+			// The network dropped again while bootstrap waited for it.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("deferred bootstrap: %w", err)
+		}
+		return marker.Clear()
+	}
+}
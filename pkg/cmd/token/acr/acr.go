@@ -0,0 +1,48 @@
+package acr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/acrcredentials"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+var flagPath string
+
+var Command = &cobra.Command{
+	Use:          "acr",
+	Short:        "Kubelet image credential provider for the ACR tokens the agent rotates.",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(cmd.InOrStdin(), cmd.OutOrStdout(), flagPath, time.Now())
+	},
+}
+
+func init() {
+	Command.Flags().StringVar(
+		&flagPath, "path", config.ACRCredentialsPath,
+		"Path of the ACR credentials file.",
+	)
+}
+
+func run(in io.Reader, out io.Writer, path string, now time.Time) error {
+	// The kubelet writes a CredentialProviderRequest for the image. The
+	// response covers every registry, so only drain it.
+	if _, err := io.Copy(io.Discard, in); err != nil {
+		return fmt.Errorf("read credential provider request: %w", err)
+	}
+	creds, err := acrcredentials.Load(path)
+	if err != nil {
+		return err
+	}
+	resp, err := acrcredentials.NewResponse(creds, now)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(out).Encode(resp)
+}
@@ -3,7 +3,9 @@ package token
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/Azure/AKSFlexNode/pkg/cmd/token/acr"
 	"github.com/Azure/AKSFlexNode/pkg/cmd/token/kubelogin"
+	"github.com/Azure/AKSFlexNode/pkg/cmd/token/tokenfile"
 )
 
 var Command = &cobra.Command{
@@ -13,4 +15,6 @@ var Command = &cobra.Command{
 
 func init() {
 	Command.AddCommand(kubelogin.Command)
+	Command.AddCommand(tokenfile.Command)
+	Command.AddCommand(acr.Command)
 }
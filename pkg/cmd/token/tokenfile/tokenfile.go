@@ -0,0 +1,63 @@
+package tokenfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+)
+
+var flagPath string
+
+var Command = &cobra.Command{
+	Use:          "file",
+	Short:        "Returns the bearer token the agent rotates in a file.",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return run(cmd.OutOrStdout(), flagPath)
+	},
+}
+
+func init() {
+	Command.Flags().StringVar(
+		&flagPath, "path", config.KubeletTokenPath,
+		"Path of the token file.",
+	)
+}
+
+func run(out io.Writer, path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is the operator-provided token file
+	if err != nil {
+		return fmt.Errorf("read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("token file %s is empty", path)
+	}
+
+	status := &clientauthenticationv1.ExecCredentialStatus{Token: token}
+	// Without an expiry the client caches the token until the API server
+	// rejects it, so pass the JWT expiry through when there is one.
+	if expiresOn, err := kubeconfig.TokenExpiry(data); err == nil {
+		expiration := metav1.NewTime(expiresOn)
+		status.ExpirationTimestamp = &expiration
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&clientauthenticationv1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "client.authentication.k8s.io/v1",
+			Kind:       "ExecCredential",
+		},
+		Status: status,
+	})
+}
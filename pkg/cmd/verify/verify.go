@@ -0,0 +1,149 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/daemon"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/manifest"
+)
+
+type handler struct {
+	configPath  string
+	instance    string
+	repair      bool
+	acceptUnits bool
+	output      string
+	writer      io.Writer
+}
+
+// report is the JSON output of verify.
+type report struct {
+	Machine    string              `json:"machine"`
+	Files      int                 `json:"files"`
+	Mismatches []manifest.Mismatch `json:"mismatches"`
+	Repaired   bool                `json:"repaired,omitempty"`
+	// AcceptedUnits is set when --accept-units recorded the unit drift as
+	// the new baseline.
+	AcceptedUnits bool `json:"acceptedUnits,omitempty"`
+}
+
+// NewCommand returns the verify command, which re-hashes the active machine's
+// installed files against the manifest recorded at bootstrap or repave.
+func NewCommand() *cobra.Command {
+	h := &handler{writer: os.Stdout}
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the active machine's installed binaries and units against their recorded state",
+		Long: "Re-hash the node binaries, CNI plugins, and node-problem-detector in the active nspawn machine against the " +
+			"manifest recorded when it was bootstrapped or repaved, and report missing, modified, or re-permissioned files, " +
+			"along with drop-ins and unit file edits of the kubelet and containerd units made outside the agent. " +
+			"With --repair, mismatched files are reinstalled, unmanaged drop-ins removed, and the node is restarted; this requires maintenance mode. " +
+			"With --accept-units, the units as they are now loaded become the recorded baseline.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return h.execute(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVar(&h.configPath, "config", "", "Path to configuration JSON file (required)")
+	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().StringVar(&h.instance, "instance", "", "Named node instance from the config instances section; empty selects the default node")
+	cmd.Flags().BoolVar(&h.repair, "repair", false, "Reinstall mismatched files and restart the node")
+	cmd.Flags().BoolVar(&h.acceptUnits, "accept-units", false, "Record the kubelet and containerd units as they are now loaded as the baseline")
+	cmd.MarkFlagsMutuallyExclusive("repair", "accept-units")
+	cmd.Flags().StringVar(&h.output, "output", "text", "Output format: text or json")
+
+	return cmd
+}
+
+func (h *handler) execute(ctx context.Context) error {
+	if h.output != "text" && h.output != "json" {
+		return fmt.Errorf("unsupported output format %q: must be text or json", h.output)
+	}
+	cfg, err := config.LoadInstanceConfig(h.configPath, config.Instance(h.instance))
+	if err != nil {
+		return fmt.Errorf("failed to load config from %s: %w", h.configPath, err)
+	}
+
+	if h.acceptUnits {
+		accepted, err := daemon.AcceptUnitDrift(ctx, cfg.Instance)
+		if err != nil {
+			return fmt.Errorf("accept unit drift: %w", err)
+		}
+		if err := h.writeAccepted(accepted); err != nil {
+			return err
+		}
+	}
+	m, mismatches, err := daemon.VerifyActiveMachine(ctx, cfg.Instance)
+	if err != nil {
+		return err
+	}
+	result := report{Machine: m.Machine, Files: len(m.Entries), Mismatches: mismatches, AcceptedUnits: h.acceptUnits}
+	if h.repair && len(mismatches) > 0 {
+		log := logger.CreateLogger(cfg.Agent.LogLevel, cfg.Agent.LogDir)
+		httpclient.SetDefault(cfg.Agent.HTTP)
+		if err := daemon.RepairActiveMachine(ctx, log, cfg, mismatches); err != nil {
+			return fmt.Errorf("repair machine %s: %w", m.Machine, err)
+		}
+		result.Repaired = true
+	}
+
+	if err := h.write(result); err != nil {
+		return err
+	}
+	if len(mismatches) > 0 && !result.Repaired {
+		return fmt.Errorf("machine %s has %d mismatched files", m.Machine, len(mismatches))
+	}
+	return nil
+}
+
+// writeAccepted lists the unit drift --accept-units recorded, in text output.
+// The JSON report carries acceptedUnits instead.
+func (h *handler) writeAccepted(accepted []manifest.Mismatch) error {
+	if h.output == "json" {
+		return nil
+	}
+	for _, mismatch := range accepted {
+		if _, err := fmt.Fprintf(h.writer, "accepted /%s: %s\n", mismatch.Path, mismatch.Problem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handler) write(result report) error {
+	if h.output == "json" {
+		enc := json.NewEncoder(h.writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	if _, err := fmt.Fprintf(h.writer, "machine %s: %d files recorded, %d mismatched\n", result.Machine, result.Files, len(result.Mismatches)); err != nil {
+		return err
+	}
+	if len(result.Mismatches) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(h.writer, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PATH\tPROBLEM")
+	for _, mismatch := range result.Mismatches {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", mismatch.Path, mismatch.Problem)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if result.Repaired {
+		_, err := fmt.Fprintln(h.writer, "mismatched files were reinstalled and the node restarted")
+		return err
+	}
+	return nil
+}
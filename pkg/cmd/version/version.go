@@ -1,28 +1,36 @@
 package version
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/spf13/cobra"
-)
 
-// Version information variables (set at build time)
-var (
-	Version   = "dev"
-	GitCommit = "unknown"
-	BuildTime = "unknown"
+	"github.com/Azure/AKSFlexNode/pkg/version"
 )
 
 func NewCommand() *cobra.Command {
-	return &cobra.Command{
+	var asJSON bool
+	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Show version information",
-		Long:  "Display version, build commit, and build time information",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("AKS Flex Node Agent\n")
-			fmt.Printf("Version: %s\n", Version)
-			fmt.Printf("Git Commit: %s\n", GitCommit)
-			fmt.Printf("Build Time: %s\n", BuildTime)
+		Long:  "Display version, build commit, build time, Go version, and platform information",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := version.Get()
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "AKS Flex Node Agent\n")
+			fmt.Fprintf(cmd.OutOrStdout(), "Version: %s\n", info.Version)
+			fmt.Fprintf(cmd.OutOrStdout(), "Git Commit: %s\n", info.GitCommit)
+			fmt.Fprintf(cmd.OutOrStdout(), "Build Time: %s\n", info.BuildTime)
+			fmt.Fprintf(cmd.OutOrStdout(), "Go Version: %s\n", info.GoVersion)
+			fmt.Fprintf(cmd.OutOrStdout(), "Platform: %s\n", info.Platform)
+			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the version information as JSON")
+	return cmd
 }
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAcceleratorDriftCheckInterval = 10 * time.Minute
+
+// Node labels describing the accelerator config. A MIG label is set per
+// profile, such as aks-flex-node.azure.com/mig-1g.10gb=7, counting the
+// instances of that profile on each partitioned GPU.
+const (
+	AcceleratorMIGLabelPrefix           = "aks-flex-node.azure.com/mig-"
+	AcceleratorTimeSlicingReplicasLabel = "aks-flex-node.azure.com/gpu-time-slicing-replicas"
+)
+
+// migProfilePattern matches NVIDIA GPU instance profile names such as
+// 1g.10gb, 3g.40gb, or 1g.10gb+me.
+var migProfilePattern = regexp.MustCompile(`^[1-9]g\.[0-9]+gb(\+me)?$`)
+
+// AcceleratorsConfig partitions and shares the node's NVIDIA GPUs for
+// inference workloads. The driver and container runtime setup comes from the
+// rootfs goal state; this only configures how the GPUs are carved up.
+type AcceleratorsConfig struct {
+	// MIG partitions GPUs that support Multi-Instance GPU.
+	MIG *MIGConfig `json:"mig,omitempty"`
+
+	// TimeSlicing lets several pods share each GPU, or each MIG instance.
+	TimeSlicing *TimeSlicingConfig `json:"timeSlicing,omitempty"`
+
+	// DriftCheckInterval is how often the daemon compares the GPUs with the
+	// config and re-applies it when someone changed them by hand.
+	DriftCheckInterval JSONDuration `json:"driftCheckInterval,omitempty"`
+}
+
+// MIGConfig is the set of GPU instances created on each partitioned GPU.
+type MIGConfig struct {
+	// Profiles are the GPU instance profile names created on each GPU, one
+	// entry per instance, such as ["3g.40gb", "2g.20gb", "1g.10gb"].
+	Profiles []string `json:"profiles"`
+
+	// GPUs are the indices of the GPUs to partition. Every GPU is
+	// partitioned when empty.
+	GPUs []int `json:"gpus,omitempty"`
+}
+
+// TimeSlicingConfig configures NVIDIA device plugin time-slicing.
+type TimeSlicingConfig struct {
+	// Replicas is how many pods may share each GPU or MIG instance.
+	Replicas int `json:"replicas"`
+}
+
+// Enabled reports whether MIG or time-slicing is configured.
+func (c AcceleratorsConfig) Enabled() bool {
+	return c.MIG != nil || c.TimeSlicing != nil
+}
+
+// NodeLabels returns the node labels describing the config.
+func (c AcceleratorsConfig) NodeLabels() map[string]string {
+	labels := map[string]string{}
+	if c.MIG != nil {
+		counts := map[string]int{}
+		for _, profile := range c.MIG.Profiles {
+			counts[profile]++
+		}
+		for profile, count := range counts {
+			labels[AcceleratorMIGLabelPrefix+strings.ReplaceAll(profile, "+", "-")] = strconv.Itoa(count)
+		}
+	}
+	if c.TimeSlicing != nil {
+		labels[AcceleratorTimeSlicingReplicasLabel] = strconv.Itoa(c.TimeSlicing.Replicas)
+	}
+	return labels
+}
+
+func (c *AcceleratorsConfig) validate() error {
+	if c.DriftCheckInterval < 0 || (c.DriftCheckInterval > 0 && time.Duration(c.DriftCheckInterval) < time.Minute) {
+		return fmt.Errorf("accelerators.driftCheckInterval must be at least 1m")
+	}
+	if mig := c.MIG; mig != nil {
+		if len(mig.Profiles) == 0 {
+			return fmt.Errorf("accelerators.mig.profiles must list at least one profile")
+		}
+		for i, profile := range mig.Profiles {
+			if !migProfilePattern.MatchString(profile) {
+				return fmt.Errorf("accelerators.mig.profiles[%d] %q is not a GPU instance profile name such as 1g.10gb", i, profile)
+			}
+		}
+		seen := map[int]bool{}
+		for i, gpu := range mig.GPUs {
+			if gpu < 0 || seen[gpu] {
+				return fmt.Errorf("accelerators.mig.gpus[%d] %d must be a distinct GPU index", i, gpu)
+			}
+			seen[gpu] = true
+		}
+	}
+	if ts := c.TimeSlicing; ts != nil && ts.Replicas < 2 {
+		return fmt.Errorf("accelerators.timeSlicing.replicas must be at least 2")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceleratorsConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		accelerators AcceleratorsConfig
+		wantErr      string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			accelerators: AcceleratorsConfig{
+				MIG:                &MIGConfig{Profiles: []string{"3g.40gb", "2g.20gb", "1g.10gb+me"}, GPUs: []int{0, 1}},
+				TimeSlicing:        &TimeSlicingConfig{Replicas: 4},
+				DriftCheckInterval: JSONDuration(5 * time.Minute),
+			},
+		},
+		{
+			name:         "no profiles",
+			accelerators: AcceleratorsConfig{MIG: &MIGConfig{}},
+			wantErr:      "at least one profile",
+		},
+		{
+			name:         "bad profile",
+			accelerators: AcceleratorsConfig{MIG: &MIGConfig{Profiles: []string{"1g.10gb", "MIG 1g"}}},
+			wantErr:      "profiles[1]",
+		},
+		{
+			name:         "duplicate GPU",
+			accelerators: AcceleratorsConfig{MIG: &MIGConfig{Profiles: []string{"1g.10gb"}, GPUs: []int{0, 0}}},
+			wantErr:      "gpus[1]",
+		},
+		{
+			name:         "one replica",
+			accelerators: AcceleratorsConfig{TimeSlicing: &TimeSlicingConfig{Replicas: 1}},
+			wantErr:      "replicas",
+		},
+		{
+			name:         "short drift check interval",
+			accelerators: AcceleratorsConfig{DriftCheckInterval: JSONDuration(time.Second)},
+			wantErr:      "driftCheckInterval",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.accelerators.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAcceleratorsConfigNodeLabels(t *testing.T) {
+	t.Parallel()
+
+	c := AcceleratorsConfig{
+		MIG:         &MIGConfig{Profiles: []string{"1g.10gb", "1g.10gb+me", "1g.10gb"}},
+		TimeSlicing: &TimeSlicingConfig{Replicas: 3},
+	}
+	want := map[string]string{
+		"aks-flex-node.azure.com/mig-1g.10gb":               "2",
+		"aks-flex-node.azure.com/mig-1g.10gb-me":            "1",
+		"aks-flex-node.azure.com/gpu-time-slicing-replicas": "3",
+	}
+	if got := c.NodeLabels(); !maps.Equal(got, want) {
+		t.Errorf("NodeLabels() = %v, want %v", got, want)
+	}
+}
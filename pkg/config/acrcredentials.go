@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ACRCredentialsPath holds the Azure Container Registry refresh tokens the
+// agent exchanges for the kubelet's image credential provider. Like the
+// kubelet token, the same path is used on the host and inside the nspawn
+// machine.
+const ACRCredentialsPath = ConfigDir + "/acr-credentials.json"
+
+// ACRCredentialsConfig configures the kubelet image credential provider for
+// Azure Container Registry. The agent exchanges the node's Arc managed
+// identity for registry tokens and rotates them, so pods pull from the
+// registries without image pull secrets.
+type ACRCredentialsConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Registries are the registries' login servers, such as
+	// myregistry.azurecr.io. The Arc identity needs AcrPull on each.
+	Registries []string `json:"registries,omitempty"`
+}
+
+func (c *ACRCredentialsConfig) validate(arcEnabled bool) error {
+	if !c.Enabled {
+		return nil
+	}
+	if !arcEnabled {
+		return fmt.Errorf("acrCredentials needs azure.arc, whose identity the registry tokens are exchanged for")
+	}
+	if len(c.Registries) == 0 {
+		return fmt.Errorf("acrCredentials.registries is required when acrCredentials is enabled")
+	}
+	seen := make(map[string]bool, len(c.Registries))
+	for i, registry := range c.Registries {
+		if registry == "" || strings.ContainsAny(registry, "/:* ") {
+			return fmt.Errorf("invalid acrCredentials.registries[%d]: %q must be a login server without a scheme, port, path, or wildcard", i, registry)
+		}
+		if seen[strings.ToLower(registry)] {
+			return fmt.Errorf("invalid acrCredentials.registries[%d]: duplicate registry %q", i, registry)
+		}
+		seen[strings.ToLower(registry)] = true
+	}
+	return nil
+}
+
+// ACRCredentialsPath is where the instance's registry tokens are kept, on
+// the host and inside the instance's machines.
+func (i Instance) ACRCredentialsPath() string {
+	if i == "" {
+		return ACRCredentialsPath
+	}
+	return filepath.Join(i.StateDir(), "acr-credentials.json")
+}
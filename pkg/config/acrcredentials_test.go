@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestACRCredentialsConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		acr     ACRCredentialsConfig
+		arc     bool
+		wantErr string
+	}{
+		{name: "disabled"},
+		{name: "disabled without arc", acr: ACRCredentialsConfig{Registries: []string{"contoso.azurecr.io"}}},
+		{name: "valid", acr: ACRCredentialsConfig{Enabled: true, Registries: []string{"contoso.azurecr.io", "fabrikam.azurecr.cn"}}, arc: true},
+		{name: "no arc", acr: ACRCredentialsConfig{Enabled: true, Registries: []string{"contoso.azurecr.io"}}, wantErr: "needs azure.arc"},
+		{name: "no registries", acr: ACRCredentialsConfig{Enabled: true}, arc: true, wantErr: "registries is required"},
+		{name: "scheme", acr: ACRCredentialsConfig{Enabled: true, Registries: []string{"https://contoso.azurecr.io"}}, arc: true, wantErr: "registries[0]"},
+		{name: "wildcard", acr: ACRCredentialsConfig{Enabled: true, Registries: []string{"*.azurecr.io"}}, arc: true, wantErr: "wildcard"},
+		{name: "duplicate", acr: ACRCredentialsConfig{Enabled: true, Registries: []string{"contoso.azurecr.io", "Contoso.azurecr.io"}}, arc: true, wantErr: "duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.acr.validate(tt.arc)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstanceACRCredentialsPath(t *testing.T) {
+	t.Parallel()
+
+	if got := Instance("").ACRCredentialsPath(); got != ACRCredentialsPath {
+		t.Fatalf("default ACRCredentialsPath() = %q, want %q", got, ACRCredentialsPath)
+	}
+	if got, want := Instance("edge2").ACRCredentialsPath(), InstancesDir+"/edge2/acr-credentials.json"; got != want {
+		t.Fatalf("instance ACRCredentialsPath() = %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 
 	agentconfig "github.com/Azure/unbounded/pkg/agent/config"
 	"github.com/Azure/unbounded/pkg/agent/goalstates"
@@ -32,14 +33,14 @@ func ToAgentConfig(cfg *Config, machineName string) *agentconfig.AgentConfig {
 		AdditionalHostDevices: cfg.Bootstrap.AdditionalHostDevices,
 		Cluster: agentconfig.AgentClusterConfig{
 			CaCertBase64: cfg.Node.Kubelet.CACertData,
-			ClusterDNS:   cfg.Networking.DNSServiceIP,
+			ClusterDNS:   cfg.ClusterDNS(),
 			Version:      cfg.Components.Kubernetes,
 		},
 		Kubelet: agentconfig.AgentKubeletConfig{
 			ApiServer:          cfg.APIServerURL(),
 			NodeIP:             cfg.Node.Kubelet.NodeIP,
 			Labels:             cfg.Node.Labels,
-			RegisterWithTaints: cfg.Node.Taints,
+			RegisterWithTaints: registerWithTaints(cfg),
 		},
 		CRI: agentconfig.CRIConfig{
 			Containerd: agentconfig.ContainerdConfig{
@@ -65,6 +66,9 @@ func ToAgentConfig(cfg *Config, machineName string) *agentconfig.AgentConfig {
 	case cfg.IsBootstrapTokenConfigured():
 		ac.Kubelet.Auth.BootstrapToken = cfg.Azure.BootstrapToken.Token
 
+	case cfg.KubeletUsesTokenFile():
+		ac.Kubelet.Auth.ExecCredential = TokenFileExecCredential(cfg.Instance.KubeletTokenPath())
+
 	case cfg.IsSPConfigured():
 		ac.Kubelet.Auth.ExecCredential = buildExecCredential(map[string]string{
 			"AAD_LOGIN_METHOD":                    "spn",
@@ -103,6 +107,19 @@ func ResolveMachineGoalState(log *slog.Logger, cfg *Config, machineName string)
 	return agentCfg, gs, containerImageArchives, nil
 }
 
+// TokenFileExecCredential returns the ExecConfig for Arc-joined nodes. The
+// agent rotates the token in tokenPath, and the binary's `token file`
+// subcommand hands it to the kubelet together with its expiry.
+func TokenFileExecCredential(tokenPath string) *clientcmdapi.ExecConfig {
+	return &clientcmdapi.ExecConfig{
+		APIVersion:         "client.authentication.k8s.io/v1",
+		Command:            flexNodeBinaryPath,
+		Args:               []string{"token", "file", "--path", tokenPath},
+		InteractiveMode:    clientcmdapi.NeverExecInteractiveMode,
+		ProvideClusterInfo: false,
+	}
+}
+
 // buildExecCredential creates an ExecConfig that invokes the aks-flex-node
 // binary as a credential plugin. The binary's `token kubelogin` subcommand
 // uses kubelogin to obtain an Azure AD token for the AKS API server.
@@ -121,3 +138,12 @@ func buildExecCredential(env map[string]string) *clientcmdapi.ExecConfig {
 		ProvideClusterInfo: false,
 	}
 }
+
+// registerWithTaints returns the configured node taints plus the readiness
+// gate taint when the gate is enabled.
+func registerWithTaints(cfg *Config) []string {
+	if !cfg.Agent.ReadinessGate.Enabled {
+		return cfg.Node.Taints
+	}
+	return append(slices.Clone(cfg.Node.Taints), ReadinessGateTaint)
+}
@@ -62,6 +62,37 @@ func TestToAgentConfig_BootstrapToken(t *testing.T) {
 	}
 }
 
+func TestToAgentConfig_ReadinessGateTaint(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		Agent: AgentConfig{ReadinessGate: ReadinessGateConfig{Enabled: true}},
+		Node:  NodeConfig{Taints: []string{"dedicated=infra:NoSchedule"}},
+	}
+
+	ac := ToAgentConfig(cfg, "kube1")
+	if len(ac.Kubelet.RegisterWithTaints) != 2 || ac.Kubelet.RegisterWithTaints[1] != ReadinessGateTaint {
+		t.Fatalf("Kubelet.RegisterWithTaints=%v, want the configured taint and %s", ac.Kubelet.RegisterWithTaints, ReadinessGateTaint)
+	}
+	if len(cfg.Node.Taints) != 1 {
+		t.Fatalf("Node.Taints=%v, want the config left unchanged", cfg.Node.Taints)
+	}
+}
+
+func TestToAgentConfig_LocalDNS(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Networking: NetworkingConfig{DNSServiceIP: "10.0.0.10"}}
+	if ac := ToAgentConfig(cfg, "kube1"); ac.Cluster.ClusterDNS != "10.0.0.10" {
+		t.Fatalf("Cluster.ClusterDNS=%q, want the cluster DNS service", ac.Cluster.ClusterDNS)
+	}
+
+	cfg.LocalDNS.Enabled = true
+	if ac := ToAgentConfig(cfg, "kube1"); ac.Cluster.ClusterDNS != DefaultLocalDNSAddress {
+		t.Fatalf("Cluster.ClusterDNS=%q, want the local DNS cache %s", ac.Cluster.ClusterDNS, DefaultLocalDNSAddress)
+	}
+}
+
 func TestToAgentConfig_NodeName(t *testing.T) {
 	t.Parallel()
 
@@ -213,6 +244,46 @@ func TestToAgentConfig_ManagedIdentitySystemAssigned(t *testing.T) {
 	}
 }
 
+func TestToAgentConfig_Arc(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		Azure: AzureConfig{
+			Arc: &ArcConfig{Enabled: true},
+		},
+		Node: NodeConfig{
+			Kubelet: KubeletConfig{
+				ClusterFQDN: "api.example.com:6443",
+				CACertData:  "ca-data",
+			},
+		},
+	}
+
+	ac := ToAgentConfig(cfg, "kube1")
+
+	exec := ac.Kubelet.Auth.ExecCredential
+	if exec == nil {
+		t.Fatal("ExecCredential should be set for Arc")
+	}
+	if err := ac.Kubelet.Auth.Validate(); err != nil {
+		t.Fatalf("Kubelet.Auth.Validate: %v", err)
+	}
+	want := []string{"token", "file", "--path", KubeletTokenPath}
+	if len(exec.Args) != len(want) {
+		t.Fatalf("Args=%v, want %v", exec.Args, want)
+	}
+	for i := range want {
+		if exec.Args[i] != want[i] {
+			t.Fatalf("Args=%v, want %v", exec.Args, want)
+		}
+	}
+
+	cfg.Azure.BootstrapToken = &BootstrapTokenConfig{Token: "abcdef.0123456789abcdef"}
+	if ac := ToAgentConfig(cfg, "kube1"); ac.Kubelet.Auth.ExecCredential != nil {
+		t.Fatal("ExecCredential should be nil when a bootstrap token is configured alongside Arc")
+	}
+}
+
 func TestToAgentConfig_CRICNIVersions(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,104 @@
+package config
+
+import "fmt"
+
+// Sources of azure.managedIdentity.
+const (
+	// ManagedIdentitySourceIMDS is the Azure VM instance metadata service,
+	// the default.
+	ManagedIdentitySourceIMDS = "imds"
+	// ManagedIdentitySourceArc is the hybrid instance metadata service (himds)
+	// of a host already connected to Azure Arc outside the agent.
+	ManagedIdentitySourceArc = "arc"
+)
+
+// WorkloadIdentityConfig authenticates as a Microsoft Entra application
+// through a federated credential: the agent exchanges the OIDC token in
+// TokenFile, which an external issuer keeps current, for Entra tokens. The
+// application needs a federated identity credential trusting that issuer and
+// subject.
+type WorkloadIdentityConfig struct {
+	TenantID string `json:"tenantId"` // Microsoft Entra tenant of the application
+	ClientID string `json:"clientId"` // Application (client) ID
+	// TokenFile is the host path of the OIDC token. It is read on every
+	// exchange, so the issuer may rotate it in place.
+	TokenFile string `json:"tokenFile"`
+}
+
+func (c *WorkloadIdentityConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.TenantID == "" {
+		return fmt.Errorf("azure.workloadIdentity.tenantId is required when workload identity is configured")
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("azure.workloadIdentity.clientId is required when workload identity is configured")
+	}
+	if c.TokenFile == "" {
+		return fmt.Errorf("azure.workloadIdentity.tokenFile is required when workload identity is configured")
+	}
+	return nil
+}
+
+// DeviceCodeConfig onboards the machine to Azure Arc with an interactive
+// device code login: start prints a URL and code, and a user completes the
+// login on another device. Only Arc onboarding uses the login; the agent
+// authenticates with the Arc machine identity afterwards, so no secret is
+// left on the host.
+type DeviceCodeConfig struct {
+	// ClientID is the public client application to log in with. Defaults to
+	// the Azure CLI's.
+	ClientID string `json:"clientId,omitempty"`
+}
+
+func (c *DeviceCodeConfig) validate(arcEnabled bool) error {
+	if c == nil {
+		return nil
+	}
+	if !arcEnabled {
+		return fmt.Errorf("azure.deviceCode needs azure.arc, which the device code login onboards the machine to")
+	}
+	return nil
+}
+
+// IsWorkloadIdentityConfigured checks if workload identity authentication is
+// selected.
+func (cfg *Config) IsWorkloadIdentityConfigured() bool {
+	return cfg.Azure.WorkloadIdentity != nil
+}
+
+// IsDeviceCodeConfigured checks if Arc onboarding logs in with a device code.
+func (cfg *Config) IsDeviceCodeConfigured() bool {
+	return cfg.Azure.DeviceCode != nil
+}
+
+// IsSPCertificateConfigured checks if the service principal authenticates
+// with a client certificate rather than a secret.
+func (cfg *Config) IsSPCertificateConfigured() bool {
+	return cfg.IsSPConfigured() && cfg.Azure.ServicePrincipal.CertificateFile != ""
+}
+
+// IsArcManagedIdentityConfigured checks if managed identity authentication
+// uses the identity of a host connected to Azure Arc outside the agent.
+func (cfg *Config) IsArcManagedIdentityConfigured() bool {
+	return cfg.IsMIConfigured() && cfg.Azure.ManagedIdentity.Source == ManagedIdentitySourceArc
+}
+
+// UsesArcIdentity reports whether the agent authenticates with the host's Arc
+// machine identity, registered by the agent or beforehand.
+func (cfg *Config) UsesArcIdentity() bool {
+	return cfg.IsARCEnabled() || cfg.IsArcManagedIdentityConfigured()
+}
+
+// KubeletUsesTokenFile reports whether the kubelet reads a token the agent
+// obtains and rotates, instead of logging in itself. That is the case for
+// the methods whose credentials live on the host, out of the nspawn
+// machine's reach: the Arc identity, a client certificate, and a workload
+// identity token file. A bootstrap token takes precedence.
+func (cfg *Config) KubeletUsesTokenFile() bool {
+	if cfg.IsBootstrapTokenConfigured() {
+		return false
+	}
+	return cfg.UsesArcIdentity() || cfg.IsSPCertificateConfigured() || cfg.IsWorkloadIdentityConfigured()
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const testAuthID = "12345678-1234-1234-1234-123456789012"
+
+func testAuthAzureConfig(set func(*AzureConfig)) AzureConfig {
+	c := AzureConfig{
+		SubscriptionID:             testAuthID,
+		TenantID:                   testAuthID,
+		ResourceManagerEndpointURL: "https://management.azure.com",
+		TargetAgentPoolName:        "pool1",
+		TargetCluster: &TargetClusterConfig{
+			ResourceID: "/subscriptions/" + testAuthID + "/resourceGroups/test-rg/providers/Microsoft.ContainerService/managedClusters/test-cluster",
+		},
+	}
+	set(&c)
+	return c
+}
+
+func TestAuthProviderValidation(t *testing.T) {
+	t.Parallel()
+
+	arc := &ArcConfig{Enabled: true, MachineName: "edge-01", ResourceGroup: "test-rg", Location: "eastus"}
+	workloadIdentity := &WorkloadIdentityConfig{TenantID: testAuthID, ClientID: testAuthID, TokenFile: "/var/run/secrets/azure/token"}
+	tests := []struct {
+		name    string
+		set     func(*AzureConfig)
+		wantErr string
+	}{
+		{
+			name: "workload identity",
+			set:  func(c *AzureConfig) { c.WorkloadIdentity = workloadIdentity },
+		},
+		{
+			name: "workload identity without token file",
+			set: func(c *AzureConfig) {
+				c.WorkloadIdentity = &WorkloadIdentityConfig{TenantID: testAuthID, ClientID: testAuthID}
+			},
+			wantErr: "azure.workloadIdentity.tokenFile is required",
+		},
+		{
+			name: "workload identity with service principal",
+			set: func(c *AzureConfig) {
+				c.WorkloadIdentity = workloadIdentity
+				c.ServicePrincipal = &ServicePrincipalConfig{TenantID: testAuthID, ClientID: testAuthID, ClientSecret: "secret"}
+			},
+			wantErr: "only one Azure authentication method",
+		},
+		{
+			name: "service principal certificate",
+			set: func(c *AzureConfig) {
+				c.ServicePrincipal = &ServicePrincipalConfig{TenantID: testAuthID, ClientID: testAuthID, CertificateFile: "/etc/aks-flex-node/sp.pem"}
+			},
+		},
+		{
+			name: "service principal secret and certificate",
+			set: func(c *AzureConfig) {
+				c.ServicePrincipal = &ServicePrincipalConfig{TenantID: testAuthID, ClientID: testAuthID, ClientSecret: "secret", CertificateFile: "/etc/aks-flex-node/sp.pem"}
+			},
+			wantErr: "mutually exclusive",
+		},
+		{
+			name: "arc managed identity",
+			set:  func(c *AzureConfig) { c.ManagedIdentity = &ManagedIdentityConfig{Source: ManagedIdentitySourceArc} },
+		},
+		{
+			name: "arc managed identity with client id",
+			set: func(c *AzureConfig) {
+				c.ManagedIdentity = &ManagedIdentityConfig{Source: ManagedIdentitySourceArc, ClientID: testAuthID}
+			},
+			wantErr: "azure.managedIdentity.clientId is not supported",
+		},
+		{
+			name:    "unknown managed identity source",
+			set:     func(c *AzureConfig) { c.ManagedIdentity = &ManagedIdentityConfig{Source: "wireserver"} },
+			wantErr: "invalid azure.managedIdentity.source",
+		},
+		{
+			name: "device code with arc",
+			set: func(c *AzureConfig) {
+				c.Arc = arc
+				c.DeviceCode = &DeviceCodeConfig{}
+			},
+		},
+		{
+			name: "device code without arc",
+			set: func(c *AzureConfig) {
+				c.ManagedIdentity = &ManagedIdentityConfig{}
+				c.DeviceCode = &DeviceCodeConfig{}
+			},
+			wantErr: "azure.deviceCode needs azure.arc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &Config{Azure: testAuthAzureConfig(tt.set)}
+			err := cfg.Azure.validate()
+			if err == nil {
+				err = cfg.validateAuthSettings()
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToAgentConfig_KubeletTokenFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		azure AzureConfig
+		want  bool
+	}{
+		{name: "arc", azure: AzureConfig{Arc: &ArcConfig{Enabled: true}}, want: true},
+		{name: "arc managed identity", azure: AzureConfig{ManagedIdentity: &ManagedIdentityConfig{Source: ManagedIdentitySourceArc}}, want: true},
+		{name: "workload identity", azure: AzureConfig{WorkloadIdentity: &WorkloadIdentityConfig{TokenFile: "/var/run/token"}}, want: true},
+		{name: "service principal certificate", azure: AzureConfig{ServicePrincipal: &ServicePrincipalConfig{CertificateFile: "/etc/sp.pem"}}, want: true},
+		{name: "service principal secret", azure: AzureConfig{ServicePrincipal: &ServicePrincipalConfig{ClientSecret: "secret"}}},
+		{name: "imds managed identity", azure: AzureConfig{ManagedIdentity: &ManagedIdentityConfig{}}},
+		{
+			name: "workload identity with bootstrap token",
+			azure: AzureConfig{
+				WorkloadIdentity: &WorkloadIdentityConfig{TokenFile: "/var/run/token"},
+				BootstrapToken:   &BootstrapTokenConfig{Token: "abcdef.0123456789abcdef"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &Config{Azure: tt.azure}
+			if got := cfg.KubeletUsesTokenFile(); got != tt.want {
+				t.Fatalf("KubeletUsesTokenFile() = %v, want %v", got, tt.want)
+			}
+			exec := ToAgentConfig(cfg, "kube1").Kubelet.Auth.ExecCredential
+			usesTokenFile := exec != nil && len(exec.Args) > 1 && exec.Args[0] == "token" && exec.Args[1] == "file"
+			if usesTokenFile != tt.want {
+				t.Fatalf("ExecCredential = %+v, want token file %v", exec, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultClusterEndpointInterval = 10 * time.Minute
+
+// ClusterEndpointConfig configures the daemon's watch of the target cluster's
+// API server endpoint and CA. When AKS rotates the cluster CA or moves the
+// private endpoint, the daemon pins the new values and points the kubelet at
+// them.
+type ClusterEndpointConfig struct {
+	// Enabled turns on the watch. It is off by default because reading the
+	// cluster's credentials needs the listClusterUserCredential action on
+	// the managed cluster.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is how often the managed cluster is checked.
+	Interval JSONDuration `json:"interval,omitempty"`
+}
+
+func (c *ClusterEndpointConfig) validate() error {
+	if c.Interval < 0 || (c.Interval > 0 && time.Duration(c.Interval) < time.Minute) {
+		return fmt.Errorf("agent.clusterEndpoint.interval must be at least 1m")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClusterEndpointConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		interval time.Duration
+		wantErr  string
+	}{
+		{name: "default"},
+		{name: "valid", interval: 5 * time.Minute},
+		{name: "short interval", interval: 30 * time.Second, wantErr: "at least 1m"},
+		{name: "negative interval", interval: -time.Minute, wantErr: "at least 1m"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := ClusterEndpointConfig{Enabled: true, Interval: JSONDuration(tc.interval)}
+			err := c.validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("validate() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -10,7 +13,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
 	"github.com/Azure/AKSFlexNode/pkg/logger"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
 	agentconfig "github.com/Azure/unbounded/pkg/agent/config"
 	"k8s.io/apimachinery/pkg/util/validation"
 )
@@ -20,6 +26,15 @@ const (
 	// installed on the host.
 	ConfigDir = "/etc/aks-flex-node"
 
+	// KubeletTokenPath holds the kubelet bearer token generated from the Arc
+	// identity. The same path is used on the host and inside the nspawn
+	// machine, whose /etc gets a copy of the file.
+	KubeletTokenPath = ConfigDir + "/kubelet-token"
+
+	// DefaultBinaryPath is where the agent unit runs the binary from unless
+	// agent.binaryPath overrides it.
+	DefaultBinaryPath = "/usr/local/bin/aks-flex-node"
+
 	// Default configuration values
 	DefaultLogDir                   = "/var/log/aks-flex-node"
 	defaultLogLevel                 = "info"
@@ -27,6 +42,21 @@ const (
 	defaultMachineOperationMode     = "auto"
 	defaultMachineReconcileInterval = 10 * time.Minute
 	defaultTargetAgentPoolName      = "aksflexnodes"
+	defaultAuditLogPath             = audit.DefaultLogPath
+	defaultMetricsBindAddress       = "0"
+	defaultHeartbeatInterval        = 10 * time.Second
+	defaultReadinessGateTimeout     = 10 * time.Minute
+	defaultPostureInterval          = time.Hour
+	defaultStandbyInterval          = 10 * time.Second
+	defaultComplianceFactsInterval  = 15 * time.Minute
+	defaultResourcesCheckInterval   = time.Minute
+	defaultUsageInterval            = time.Minute
+	defaultUsageSamples             = 1440
+	defaultShutdownGracePeriod      = 45 * time.Second
+
+	// AgentPoolLabel names the agent pool of a node, as on AKS-managed nodes.
+	// The kubelet registers with it set to azure.targetAgentPoolName.
+	AgentPoolLabel = "kubernetes.azure.com/agentpool"
 
 	// Machine client modes.
 	MachineClientModeARM       = "arm"
@@ -48,6 +78,10 @@ const (
 // Config represents the complete agent configuration structure.
 // It contains Azure-specific settings and agent operational settings.
 type Config struct {
+	// Instance selects one of several logical nodes on the host. It is set
+	// from the --instance flag or by a config file dedicated to one instance.
+	Instance Instance `json:"instance,omitempty"`
+
 	Azure       AzureConfig       `json:"azure"`
 	Agent       AgentConfig       `json:"agent"`
 	Components  ComponentsConfig  `json:"components"`
@@ -55,7 +89,28 @@ type Config struct {
 	Networking  NetworkingConfig  `json:"networking"`
 	Node        NodeConfig        `json:"node"`
 	Npd         NPDConfig         `json:"npd"`
+	NodeTools   NodeToolsConfig   `json:"nodeTools,omitempty"`
+	LocalDNS    LocalDNSConfig    `json:"localDNS,omitempty"`
 	HostRouting HostRoutingConfig `json:"hostRouting"`
+	Hooks       HooksConfig       `json:"hooks,omitempty"`
+	Trust       TrustConfig       `json:"trust,omitempty"`
+
+	ACRCredentials ACRCredentialsConfig `json:"acrCredentials,omitempty"`
+
+	Accelerators AcceleratorsConfig `json:"accelerators,omitempty"`
+	Performance  PerformanceConfig  `json:"performance,omitempty"`
+	SRIOV        SRIOVConfig        `json:"sriov,omitempty"`
+	LocalStorage LocalStorageConfig `json:"localStorage,omitempty"`
+	Topology     TopologyConfig     `json:"topology,omitempty"`
+
+	UnitHardening UnitHardeningConfig `json:"unitHardening,omitempty"`
+
+	// nodeID is the stable node ID generated while resolving the node name,
+	// until PersistNodeID writes it.
+	nodeID *pendingNodeID
+	// imdsTopology records which topology fields wait for
+	// ResolveVMTopology to read them from the instance metadata service.
+	imdsTopology *pendingVMTopology
 }
 
 // AzureConfig holds Azure-specific configuration required for connecting to Azure services.
@@ -66,24 +121,38 @@ type AzureConfig struct {
 	ResourceManagerEndpointURL string                  `json:"resourceManagerEndpoint,omitempty"` // Azure Resource Manager endpoint; defaults to https://management.azure.com
 	ServicePrincipal           *ServicePrincipalConfig `json:"servicePrincipal,omitempty"`        // Optional service principal authentication
 	ManagedIdentity            *ManagedIdentityConfig  `json:"managedIdentity,omitempty"`         // Optional managed identity authentication
+	WorkloadIdentity           *WorkloadIdentityConfig `json:"workloadIdentity,omitempty"`        // Optional federated workload identity authentication
+	DeviceCode                 *DeviceCodeConfig       `json:"deviceCode,omitempty"`              // Optional device code login for Arc onboarding
 	BootstrapToken             *BootstrapTokenConfig   `json:"bootstrapToken,omitempty"`          // Optional bootstrap token authentication
 	Arc                        *ArcConfig              `json:"arc"`                               // Azure Arc machine configuration
 	TargetCluster              *TargetClusterConfig    `json:"targetCluster"`                     // Target AKS cluster configuration
 	TargetAgentPoolName        string                  `json:"targetAgentPoolName"`               // Target AKS agent pool for FlexNode machines
+
+	// InheritAgentPoolProfile makes bootstrap read the target agent pool from
+	// the cluster and take its node labels, taints, max pods, and image GC
+	// thresholds. Local labels win over pool labels with the same key.
+	InheritAgentPoolProfile bool `json:"inheritAgentPoolProfile,omitempty"`
 }
 
 // ServicePrincipalConfig holds Azure service principal authentication configuration.
 // When provided, service principal authentication will be used instead of Azure CLI.
 type ServicePrincipalConfig struct {
-	TenantID     string `json:"tenantId"`     // Azure AD tenant ID
-	ClientID     string `json:"clientId"`     // Azure AD application (client) ID
-	ClientSecret string `json:"clientSecret"` // Azure AD application client secret
+	TenantID     string `json:"tenantId"`               // Azure AD tenant ID
+	ClientID     string `json:"clientId"`               // Azure AD application (client) ID
+	ClientSecret string `json:"clientSecret,omitempty"` // Azure AD application client secret
+	// CertificateFile authenticates with a client certificate instead of a
+	// secret: a PEM file holding the certificate and its unencrypted private
+	// key.
+	CertificateFile string `json:"certificateFile,omitempty"`
 }
 
 // ManagedIdentityConfig holds managed identity authentication configuration.
 // It can only be used when the agent is running on an Azure VM with a managed identity assigned.
 type ManagedIdentityConfig struct {
 	ClientID string `json:"clientId,omitempty"` // Client ID of the managed identity (optional, for VMs with multiple identities)
+	// Source is where the identity's tokens come from: "imds", the default,
+	// or "arc" for a host connected to Azure Arc outside the agent.
+	Source string `json:"source,omitempty"`
 }
 
 // BootstrapTokenConfig holds Kubernetes bootstrap token authentication configuration.
@@ -141,9 +210,13 @@ func (d JSONDuration) MarshalJSON() ([]byte, error) {
 type AgentConfig struct {
 	LogLevel string `json:"logLevel"` // Logging level: debug, info, warning, error
 	LogDir   string `json:"logDir"`   // Directory for log files
-	// NodeName is resolved from the host hostname when omitted.
+	// NodeName is resolved with NodeNaming when omitted.
 	NodeName string `json:"nodeName,omitempty"`
 
+	// NodeNaming selects how the node name is derived when NodeName is
+	// omitted and how a name another host registered is handled.
+	NodeNaming NodeNamingConfig `json:"nodeNaming,omitempty"`
+
 	// MachineClient selects how the agent reads the AKS machine resource.
 	MachineClient MachineClientConfig `json:"machineClient,omitempty"`
 
@@ -158,6 +231,302 @@ type AgentConfig struct {
 	// MachineOperationMode controls MachineOperation handling. Supported values:
 	// "auto" detects Machina CRs, "disable" uses a noop reconciler.
 	MachineOperationMode string `json:"machineOperationMode,omitempty"`
+
+	// BinaryPath is the host path of the aks-flex-node binary that the agent
+	// unit runs. Hosts with a read-only /usr, such as Flatcar, install it
+	// elsewhere, for example /opt/bin.
+	BinaryPath string `json:"binaryPath,omitempty"`
+
+	// AuditLogPath is the append-only, hash-chained log of privileged host and
+	// Azure mutations. It lives outside logDir so reset does not erase it.
+	AuditLogPath string `json:"auditLogPath,omitempty"`
+
+	// MetricsBindAddress is where the daemon serves Prometheus metrics, such as
+	// the per-step bootstrap and repave timings. "0" disables the endpoint.
+	MetricsBindAddress string `json:"metricsBindAddress,omitempty"`
+
+	// MetricsTextfile writes the daemon's metrics to a file for the
+	// node_exporter textfile collector, alongside or instead of the endpoint.
+	MetricsTextfile MetricsTextfileConfig `json:"metricsTextfile,omitempty"`
+
+	// Heartbeat publishes agent liveness to the cluster independently of the
+	// kubelet.
+	Heartbeat HeartbeatConfig `json:"heartbeat,omitempty"`
+
+	// HTTP tunes the HTTP clients used for Azure, artifact downloads, and
+	// token endpoints.
+	HTTP HTTPClientConfig `json:"http,omitempty"`
+
+	// Posture publishes the host's security posture on the Node for
+	// cluster-side admission.
+	Posture PostureConfig `json:"posture,omitempty"`
+
+	// ComplianceFacts writes agent-managed facts to a file for Azure Policy
+	// guest configuration to audit.
+	ComplianceFacts ComplianceFactsConfig `json:"complianceFacts,omitempty"`
+
+	// NodeEvents records repaves, resets, and maintenance on the Node as
+	// Events and the FlexNodeReconciled condition. It is off by default because
+	// the daemon credentials need create access to Events.
+	NodeEvents bool `json:"nodeEvents,omitempty"`
+
+	// Resources bounds the agent daemon's own memory and CPU use.
+	Resources ResourcesConfig `json:"resources,omitempty"`
+
+	// QuarantineConflicts makes bootstrap mask host units and hold dpkg
+	// packages that run a kubelet or container runtime outside the agent, such
+	// as kubeadm leftovers. Reset reverts exactly what was quarantined.
+	QuarantineConflicts bool `json:"quarantineConflicts,omitempty"`
+
+	// ReadinessGate registers the node with a NoSchedule taint that the
+	// daemon removes once CNI, the container runtime, and the API server
+	// are ready.
+	ReadinessGate ReadinessGateConfig `json:"readinessGate,omitempty"`
+
+	// Disruption bounds the restarts the daemon performs on its own.
+	Disruption DisruptionConfig `json:"disruption,omitempty"`
+
+	// Standby lets cluster-side automation keep the node as warm capacity:
+	// bootstrapped, with the kubelet stopped and the node cordoned until it
+	// is activated.
+	Standby StandbyConfig `json:"standby,omitempty"`
+
+	// Power puts the node to sleep on a daily schedule.
+	Power PowerConfig `json:"power,omitempty"`
+
+	// Usage samples node resource usage for capacity planning.
+	Usage UsageConfig `json:"usage,omitempty"`
+
+	// Inventory periodically exports the host's hardware and software
+	// inventory for asset management.
+	Inventory InventoryConfig `json:"inventory,omitempty"`
+
+	// ClusterEndpoint watches the managed cluster for a rotated CA or a moved
+	// API server endpoint and repoints the kubelet at them.
+	ClusterEndpoint ClusterEndpointConfig `json:"clusterEndpoint,omitempty"`
+
+	// UnitDrift watches the machine's kubelet and containerd units for
+	// changes made outside the agent.
+	UnitDrift UnitDriftConfig `json:"unitDrift,omitempty"`
+
+	// ExportBinaries installs host wrappers that run crictl, ctr, and kubectl
+	// in the active nspawn machine, and puts them on the default PATH.
+	ExportBinaries bool `json:"exportBinaries,omitempty"`
+
+	// Dashboard serves a local web dashboard of the node's health with safe
+	// actions such as entering maintenance.
+	Dashboard DashboardConfig `json:"dashboard,omitempty"`
+
+	// ShutdownGracePeriod is how long a stopping daemon lets a repave, reset,
+	// or state write in progress finish and report its status before
+	// canceling it. The agent unit's TimeoutStopSec leaves headroom above it.
+	ShutdownGracePeriod JSONDuration `json:"shutdownGracePeriod,omitempty"`
+}
+
+// HeartbeatConfig configures the daemon's liveness Lease and Node condition.
+type HeartbeatConfig struct {
+	// Enabled turns on the heartbeat publisher. It is off by default because
+	// the daemon credentials need extra RBAC for Leases and Node status.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is how often the Lease is renewed. The Lease duration is four
+	// times the interval, matching the kubelet's renew-to-duration ratio.
+	Interval JSONDuration `json:"interval,omitempty"`
+}
+
+// The taint the kubelet registers with while the readiness gate holds the
+// node, in the kubelet's --register-with-taints format.
+const (
+	ReadinessGateTaintKey = "aks-flex-node.azure.com/prerequisites-pending"
+	ReadinessGateTaint    = ReadinessGateTaintKey + "=true:NoSchedule"
+)
+
+// ReadinessGateConfig configures holding a new node unschedulable until its
+// prerequisites pass.
+type ReadinessGateConfig struct {
+	// Enabled registers the kubelet with ReadinessGateTaint. It is off by
+	// default because the daemon credentials need patch access to the Node,
+	// and the CNI DaemonSet must tolerate the taint.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Timeout is how long the gate holds the node. When it expires the taint
+	// is removed anyway and the node condition reports the unmet checks.
+	Timeout JSONDuration `json:"timeout,omitempty"`
+}
+
+// StandbyConfig configures the daemon's standby controller.
+type StandbyConfig struct {
+	// Enabled turns on the standby controller. It is off by default because
+	// the daemon credentials need patch access to the Node and eviction
+	// access to its pods.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// StartInStandby puts a node that has never been activated or
+	// deactivated into standby as soon as it registers.
+	StartInStandby bool `json:"startInStandby,omitempty"`
+
+	// Interval is how often the daemon reads the Node's standby annotation
+	// and stops a kubelet that was started while the node is in standby.
+	Interval JSONDuration `json:"interval,omitempty"`
+
+	// DrainTimeout bounds how long entering standby retries evictions
+	// blocked by PodDisruptionBudgets. Zero selects the maintenance default.
+	DrainTimeout JSONDuration `json:"drainTimeout,omitempty"`
+}
+
+// HTTPClientConfig tunes the agent's HTTP clients. Zero values select the
+// defaults in pkg/httpclient.
+type HTTPClientConfig struct {
+	// DialTimeout bounds establishing the TCP connection.
+	DialTimeout JSONDuration `json:"dialTimeout,omitempty"`
+	// TLSHandshakeTimeout bounds the TLS handshake.
+	TLSHandshakeTimeout JSONDuration `json:"tlsHandshakeTimeout,omitempty"`
+	// ResponseHeaderTimeout bounds waiting for the response headers after
+	// the request is written.
+	ResponseHeaderTimeout JSONDuration `json:"responseHeaderTimeout,omitempty"`
+	// IdleConnTimeout is how long an idle pooled connection is kept.
+	IdleConnTimeout JSONDuration `json:"idleConnTimeout,omitempty"`
+	// RequestTimeout bounds a whole API request, including reading the body.
+	RequestTimeout JSONDuration `json:"requestTimeout,omitempty"`
+	// DownloadTimeout bounds a whole artifact download.
+	DownloadTimeout JSONDuration `json:"downloadTimeout,omitempty"`
+
+	// MaxIdleConnsPerHost sizes the idle connection pool per host.
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	// MaxConnsPerHost caps connections per host; zero means no limit.
+	MaxConnsPerHost int `json:"maxConnsPerHost,omitempty"`
+	// DisableHTTP2 forces HTTP/1.1, for proxies that mishandle HTTP/2.
+	DisableHTTP2 bool `json:"disableHTTP2,omitempty"`
+}
+
+func (c *HTTPClientConfig) validate() error {
+	for _, timeout := range []struct {
+		name  string
+		value JSONDuration
+	}{
+		{"dialTimeout", c.DialTimeout},
+		{"tlsHandshakeTimeout", c.TLSHandshakeTimeout},
+		{"responseHeaderTimeout", c.ResponseHeaderTimeout},
+		{"idleConnTimeout", c.IdleConnTimeout},
+		{"requestTimeout", c.RequestTimeout},
+		{"downloadTimeout", c.DownloadTimeout},
+	} {
+		if timeout.value < 0 {
+			return fmt.Errorf("agent.http.%s must be non-negative", timeout.name)
+		}
+	}
+	if c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 {
+		return fmt.Errorf("agent.http connection limits must be non-negative")
+	}
+	return nil
+}
+
+// PostureConfig configures the daemon's posture report Node annotation.
+type PostureConfig struct {
+	// Enabled turns on the posture reporter. It is off by default because the
+	// daemon credentials need patch access to the Node.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is how often the posture is collected and republished.
+	Interval JSONDuration `json:"interval,omitempty"`
+}
+
+// UsageConfig configures the daemon's node resource sampler.
+type UsageConfig struct {
+	// Enabled turns on the sampler.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is how often a sample is taken.
+	Interval JSONDuration `json:"interval,omitempty"`
+
+	// Samples is how many samples the usage file keeps; older ones are
+	// dropped. The default keeps a day at the default interval.
+	Samples int `json:"samples,omitempty"`
+}
+
+// ComplianceFactsConfig configures the daemon's compliance facts file.
+type ComplianceFactsConfig struct {
+	// Enabled turns on the facts file.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is how often the facts are collected and the file rewritten.
+	Interval JSONDuration `json:"interval,omitempty"`
+}
+
+// ResourcesConfig bounds the agent daemon's own resource use, for small
+// devices where the agent competes with workloads for memory. Zero values
+// leave the corresponding limit off.
+type ResourcesConfig struct {
+	// MemoryLimitBytes is the Go runtime's soft memory limit, as GOMEMLIMIT
+	// sets it. The garbage collector works harder as the heap approaches it.
+	MemoryLimitBytes int64 `json:"memoryLimitBytes,omitempty"`
+
+	// MemoryMaxBytes is the hard MemoryMax= of the agent unit. The kernel
+	// kills the agent above it and systemd restarts it.
+	MemoryMaxBytes int64 `json:"memoryMaxBytes,omitempty"`
+
+	// CPUQuotaPercent is the CPUQuota= of the agent unit; 100 is one CPU.
+	CPUQuotaPercent int `json:"cpuQuotaPercent,omitempty"`
+
+	// MaxRSSBytes and MaxGoroutines make the daemon exit, so systemd restarts
+	// it, when its resident memory or goroutine count stays above them.
+	MaxRSSBytes   int64 `json:"maxRSSBytes,omitempty"`
+	MaxGoroutines int   `json:"maxGoroutines,omitempty"`
+
+	// CheckInterval is how often the daemon samples its resident memory and
+	// goroutine count.
+	CheckInterval JSONDuration `json:"checkInterval,omitempty"`
+
+	// Nice is the CPU niceness, 0 to 19, of the agent's own work, such as
+	// artifact downloads and extraction. Machines run in their own units and
+	// keep their priority.
+	Nice int `json:"nice,omitempty"`
+
+	// IOSchedulingClass lowers the I/O priority of the agent's own work:
+	// IOSchedulingBestEffort at its lowest level, or IOSchedulingIdle.
+	IOSchedulingClass string `json:"ioSchedulingClass,omitempty"`
+
+	// CPUWeight and IOWeight are the CPUWeight= and IOWeight= of the agent
+	// unit, 1 to 10000. systemd's default for both is 100.
+	CPUWeight int `json:"cpuWeight,omitempty"`
+	IOWeight  int `json:"ioWeight,omitempty"`
+
+	// ApplyConcurrency bounds how many artifact downloads and installs run
+	// at once. Zero derives it from the device profile and the host's cores.
+	ApplyConcurrency int `json:"applyConcurrency,omitempty"`
+}
+
+// I/O scheduling classes of agent.resources.ioSchedulingClass.
+const (
+	IOSchedulingBestEffort = "best-effort"
+	IOSchedulingIdle       = "idle"
+)
+
+func (c *ResourcesConfig) validate() error {
+	if c.MemoryLimitBytes < 0 || c.MemoryMaxBytes < 0 || c.MaxRSSBytes < 0 {
+		return fmt.Errorf("agent.resources byte limits must be non-negative")
+	}
+	if c.CPUQuotaPercent < 0 || c.MaxGoroutines < 0 {
+		return fmt.Errorf("agent.resources.cpuQuotaPercent and maxGoroutines must be non-negative")
+	}
+	if c.CheckInterval < 0 || (c.CheckInterval > 0 && time.Duration(c.CheckInterval) < time.Second) {
+		return fmt.Errorf("agent.resources.checkInterval must be at least 1s")
+	}
+	if c.Nice < 0 || c.Nice > 19 {
+		return fmt.Errorf("agent.resources.nice must be between 0 and 19")
+	}
+	switch c.IOSchedulingClass {
+	case "", IOSchedulingBestEffort, IOSchedulingIdle:
+	default:
+		return fmt.Errorf("invalid agent.resources.ioSchedulingClass: %s. Valid values are: %s, %s", c.IOSchedulingClass, IOSchedulingBestEffort, IOSchedulingIdle)
+	}
+	if c.CPUWeight < 0 || c.CPUWeight > 10000 || c.IOWeight < 0 || c.IOWeight > 10000 {
+		return fmt.Errorf("agent.resources.cpuWeight and ioWeight must be between 1 and 10000")
+	}
+	if c.ApplyConcurrency < 0 {
+		return fmt.Errorf("agent.resources.applyConcurrency must be non-negative")
+	}
+	return nil
 }
 
 // MachineClientConfig configures the machine resource backend.
@@ -195,6 +564,31 @@ type BootstrapConfig struct {
 	// AdditionalHostDevices lists extra host device nodes under /dev to expose to
 	// the nspawn machine in addition to devices discovered by the shared agent.
 	AdditionalHostDevices []string `json:"additionalHostDevices,omitempty"`
+
+	// Extraction bounds the archives the agent unpacks itself.
+	Extraction ExtractionConfig `json:"extraction,omitempty"`
+
+	// NetworkWait holds bootstrap until the network is up.
+	NetworkWait NetworkWaitConfig `json:"networkWait,omitempty"`
+}
+
+// ExtractionConfig is the archive extraction policy. Device nodes and links
+// pointing outside the extraction root are always rejected.
+type ExtractionConfig struct {
+	// MaxTotalBytes is the largest total uncompressed size of one archive.
+	// Defaults to 8 GiB.
+	MaxTotalBytes int64 `json:"maxTotalBytes,omitempty"`
+	// MaxFiles is the largest number of files in one archive. Defaults to
+	// 100000.
+	MaxFiles int `json:"maxFiles,omitempty"`
+}
+
+// Policy returns the extraction policy the config selects.
+func (c ExtractionConfig) Policy() utilio.ExtractionPolicy {
+	return utilio.ExtractionPolicy{
+		MaxTotalBytes: c.MaxTotalBytes,
+		MaxFiles:      c.MaxFiles,
+	}
 }
 
 // OfflineArtifactsConfig mirrors Unbounded's OfflineArtifacts bootstrap
@@ -215,6 +609,13 @@ type NodeConfig struct {
 	// (e.g. "dedicated=infra:NoSchedule", "gpu:NoExecute").
 	Taints  []string      `json:"taints,omitempty"`
 	Kubelet KubeletConfig `json:"kubelet"`
+	// DeviceProfile selects hardware-specific defaults such as "raspberry-pi".
+	// "auto" (the default) detects the profile from the device tree and DMI;
+	// after loading, the field holds the resolved profile name.
+	DeviceProfile string `json:"deviceProfile,omitempty"`
+	// MachineStorage selects how machine generations are stored under
+	// /var/lib/machines: "auto" (the default), "directory", or "btrfs".
+	MachineStorage string `json:"machineStorage,omitempty"`
 }
 
 // KubeletConfig holds kubelet-specific configuration settings.
@@ -225,6 +626,17 @@ type KubeletConfig struct {
 	ClusterFQDN          string `json:"clusterFQDN,omitempty"` // Kubernetes API server FQDN from AKS RP bootstrap data
 	CACertData           string `json:"caCertData"`            // Base64-encoded CA certificate data
 	NodeIP               string `json:"nodeIP"`                // IP address to advertise as the node's primary IP (--node-ip kubelet flag)
+
+	// Resource reservations and hard eviction thresholds, passed to the kubelet
+	// as --kube-reserved, --system-reserved, and --eviction-hard.
+	KubeReserved   map[string]string `json:"kubeReserved,omitempty"`
+	SystemReserved map[string]string `json:"systemReserved,omitempty"`
+	EvictionHard   map[string]string `json:"evictionHard,omitempty"`
+
+	// Port and HealthzPort override the kubelet's 10250 and 10248. Instances
+	// on one host share its network namespace and need distinct ports.
+	Port        int `json:"port,omitempty"`
+	HealthzPort int `json:"healthzPort,omitempty"`
 }
 
 // NetworkingConfig is the AKS RP networking contract used by the agent at runtime.
@@ -236,6 +648,74 @@ type NetworkingConfig struct {
 // NPDConfig holds configuration settings for the Node Problem Detector (NPD).
 type NPDConfig struct {
 	Version string `json:"version"`
+	// Mirrors are base URLs laid out like the upstream GitHub release
+	// download tree, tried in order before github.com so a region-local
+	// mirror is preferred and one outage does not block bootstrap.
+	Mirrors []string `json:"mirrors,omitempty"`
+}
+
+// NodeToolsConfig selects the optional debugging toolkit installed into the
+// nspawn machine next to the node components.
+type NodeToolsConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// NerdctlVersion and JQVersion override the pinned release versions.
+	NerdctlVersion string `json:"nerdctlVersion,omitempty"`
+	JQVersion      string `json:"jqVersion,omitempty"`
+}
+
+// DefaultLocalDNSAddress is the link-local address the local DNS cache
+// listens on, the one upstream NodeLocal DNSCache uses.
+const DefaultLocalDNSAddress = "169.254.20.10"
+
+// LocalDNSConfig selects the optional node-local DNS cache installed into the
+// nspawn machine. When it runs, the kubelet hands pods its address as the
+// cluster DNS server.
+type LocalDNSConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Version overrides the pinned CoreDNS release version.
+	Version string `json:"version,omitempty"`
+	// Address is the link-local address the cache listens on.
+	Address string `json:"address,omitempty"`
+	// Upstreams are the resolvers for names outside the cluster domain, as IP
+	// or IP:port. When empty the cache uses the machine's /etc/resolv.conf,
+	// which is copied from the host.
+	Upstreams []string `json:"upstreams,omitempty"`
+}
+
+// ListenAddress returns Address, or the default address of instance:
+// DefaultLocalDNSAddress for the default node and, since every node on the
+// host shares its network namespace, an address derived from the name in
+// 169.254.20.11-169.254.20.254 for a named instance.
+func (c LocalDNSConfig) ListenAddress(instance Instance) string {
+	if c.Address != "" {
+		return c.Address
+	}
+	if instance == "" {
+		return DefaultLocalDNSAddress
+	}
+	h := fnv.New32a()
+	h.Write([]byte(instance)) //nolint:errcheck // hash writes never fail
+	return fmt.Sprintf("169.254.20.%d", 11+h.Sum32()%244)
+}
+
+// LocalDNSAddress returns the address the node's local DNS cache listens on.
+func (cfg *Config) LocalDNSAddress() string {
+	return cfg.LocalDNS.ListenAddress(cfg.Instance)
+}
+
+// LocalDNSEnabled reports whether the local DNS cache is installed. It is
+// skipped in offline mode, where the release download is unreachable.
+func (cfg *Config) LocalDNSEnabled() bool {
+	return cfg.LocalDNS.Enabled && strings.TrimSpace(cfg.Bootstrap.OfflineArtifacts.Source) == ""
+}
+
+// ClusterDNS returns the DNS server the kubelet hands to pods: the local DNS
+// cache when it is enabled, otherwise the cluster DNS service.
+func (cfg *Config) ClusterDNS() string {
+	if cfg.LocalDNSEnabled() {
+		return cfg.LocalDNSAddress()
+	}
+	return cfg.Networking.DNSServiceIP
 }
 
 // IsARCEnabled checks if Azure Arc registration is enabled in the configuration.
@@ -261,26 +741,41 @@ func (cfg *Config) IsBootstrapTokenConfigured() bool {
 // resolveNodeName resolves the Kubernetes Node name once and stores it on the
 // config so bootstrap, daemon watches, and lifecycle operations use one value.
 func (cfg *Config) resolveNodeName(hostnameFunc func() (string, error)) (string, error) {
-	if nodeName := strings.TrimSpace(cfg.Agent.NodeName); nodeName != "" {
+	sources := hostNodeNameSources(cfg.Instance)
+	sources.hostname = hostnameFunc
+	return cfg.resolveNodeNameFrom(sources)
+}
+
+func (cfg *Config) resolveNodeNameFrom(sources nodeNameSources) (string, error) {
+	nodeName := strings.TrimSpace(cfg.Agent.NodeName)
+	if err := cfg.Agent.NodeNaming.validate(nodeName); err != nil {
+		return "", err
+	}
+	if nodeName != "" {
 		if err := validateNodeName(nodeName); err != nil {
 			return "", err
 		}
 		cfg.Agent.NodeName = nodeName
+		cfg.Agent.NodeNaming.Strategy = NodeNamingExplicit
 		return nodeName, nil
 	}
-	hostname, err := hostnameFunc()
+	derived, nodeID, err := cfg.Agent.NodeNaming.deriveNodeName(sources)
 	if err != nil {
-		return "", fmt.Errorf("get host hostname for node name: %w", err)
+		return "", err
+	}
+	cfg.nodeID = nodeID
+	if cfg.Instance != "" {
+		// Instances on one host must not register under the same name.
+		derived += "-" + string(cfg.Instance)
 	}
-	hostname = strings.ToLower(strings.TrimSpace(hostname))
-	if hostname == "" {
-		return "", fmt.Errorf("host hostname is empty")
+	if err := validateNodeName(derived); err != nil {
+		return "", fmt.Errorf("derived %w; set agent.nodeName to a valid lowercase Kubernetes node name", err)
 	}
-	if err := validateNodeName(hostname); err != nil {
-		return "", fmt.Errorf("host hostname: %w; set agent.nodeName to a valid lowercase Kubernetes node name", err)
+	if nodeName, err = claimedNodeName(sources.stateDir, derived); err != nil {
+		return "", err
 	}
-	cfg.Agent.NodeName = hostname
-	return hostname, nil
+	cfg.Agent.NodeName = nodeName
+	return nodeName, nil
 }
 
 func validateNodeName(name string) error {
@@ -293,29 +788,115 @@ func validateNodeName(name string) error {
 // LoadConfig loads configuration from a JSON file.
 // The configPath parameter is required and cannot be empty.
 func LoadConfig(configPath string) (*Config, error) {
+	return LoadInstanceConfig(configPath, "")
+}
+
+// WriteConfigFile validates data as a config in a temporary file next to
+// path, so profiles resolve as they will from path, and renames it over path
+// only when it loads. An invalid config, which may still hold credentials,
+// never reaches path and its temporary copy is removed. It returns the
+// loaded config.
+func WriteConfigFile(path string, data []byte) (*Config, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	// CreateTemp creates the file with mode 0600.
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // gone after the rename
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadInstanceConfig loads the configuration of one node instance from a JSON
+// file, applying the file's instances section for it over the shared
+// settings. An empty instance loads the default node.
+func LoadInstanceConfig(configPath string, instance Instance) (*Config, error) {
+	return LoadInstanceConfigWithOverrides(configPath, instance, nil)
+}
+
+// LoadInstanceConfigWithOverrides loads the configuration like
+// LoadInstanceConfig and applies overrides over the file and its instance
+// section before validating the result.
+func LoadInstanceConfigWithOverrides(configPath string, instance Instance, overrides Overrides) (*Config, error) {
+	config, _, err := LoadInstanceConfigWithOrigins(configPath, instance, overrides)
+	return config, err
+}
+
+// LoadInstanceConfigWithOrigins loads the configuration like
+// LoadInstanceConfigWithOverrides and also returns the layer that set each
+// value: one of the profiles, the config file, its instance section, or the
+// overrides.
+func LoadInstanceConfigWithOrigins(configPath string, instance Instance, overrides Overrides) (*Config, Origins, error) {
 	// Require config path to be specified
 	if configPath == "" {
-		return nil, fmt.Errorf("config file path is required")
+		return nil, nil, fmt.Errorf("config file path is required")
 	}
 
-	data, err := os.ReadFile(filepath.Clean(configPath))
+	configPath = filepath.Clean(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file at %s: %w", configPath, err)
+		return nil, nil, fmt.Errorf("failed to read config file at %s: %w", configPath, err)
+	}
+	origins := Origins{}
+	if data, err = applyProfiles(configPath, data, origins); err != nil {
+		return nil, nil, fmt.Errorf("apply config profiles: %w", err)
+	}
+	if data, err = applyInstanceOverlay(data, instance, origins); err != nil {
+		return nil, nil, fmt.Errorf("apply config for instance %q: %w", instance, err)
+	}
+	if data, err = overrides.apply(data, origins); err != nil {
+		return nil, nil, err
 	}
 
 	config := &Config{}
 	if err := json.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+		return nil, nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 	if err := adaptLegacyConfigData(data, config); err != nil {
-		return nil, fmt.Errorf("adapt legacy config data: %w", err)
+		return nil, nil, fmt.Errorf("adapt legacy config data: %w", err)
 	}
 
 	if err := config.validate(); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+		return nil, nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
-	return config, nil
+	return config, origins, nil
+}
+
+// Redacted returns a copy of the config with its secrets replaced, safe to
+// print or attach to a support request.
+func (cfg *Config) Redacted() *Config {
+	out := cfg.DeepCopy()
+	if out == nil {
+		return nil
+	}
+	if sp := out.Azure.ServicePrincipal; sp != nil && sp.ClientSecret != "" {
+		sp.ClientSecret = redactedValue
+	}
+	if token := out.Azure.BootstrapToken; token != nil && token.Token != "" {
+		token.Token = redactedValue
+	}
+	return out
 }
 
 // DeepCopy returns a copy of the config that does not share mutable sub-objects (maps/pointers)
@@ -338,6 +919,9 @@ func (c *Config) setDefaults() {
 	c.setNodeDefaults()
 	c.setRuncDefaults()
 	c.setNpdDefaults()
+	c.setTrustDefaults()
+	c.setAcceleratorDefaults()
+	c.setLocalStorageDefaults()
 }
 
 func (c *Config) setAzureDefaults() {
@@ -382,6 +966,60 @@ func (c *Config) setAgentDefaults() {
 	if c.Agent.MachineOperationMode == "" {
 		c.Agent.MachineOperationMode = defaultMachineOperationMode
 	}
+	if c.Agent.ShutdownGracePeriod == 0 {
+		c.Agent.ShutdownGracePeriod = JSONDuration(defaultShutdownGracePeriod)
+	}
+	if c.Agent.AuditLogPath == "" {
+		c.Agent.AuditLogPath = defaultAuditLogPath
+	}
+	if c.Agent.BinaryPath == "" {
+		c.Agent.BinaryPath = DefaultBinaryPath
+	}
+	if c.Agent.MetricsBindAddress == "" {
+		c.Agent.MetricsBindAddress = defaultMetricsBindAddress
+	}
+	if c.Agent.Heartbeat.Interval == 0 {
+		c.Agent.Heartbeat.Interval = JSONDuration(defaultHeartbeatInterval)
+	}
+	if c.Agent.Posture.Interval == 0 {
+		c.Agent.Posture.Interval = JSONDuration(defaultPostureInterval)
+	}
+	if c.Agent.ComplianceFacts.Interval == 0 {
+		c.Agent.ComplianceFacts.Interval = JSONDuration(defaultComplianceFactsInterval)
+	}
+	if c.Agent.Standby.Interval == 0 {
+		c.Agent.Standby.Interval = JSONDuration(defaultStandbyInterval)
+	}
+	if c.Agent.ReadinessGate.Timeout == 0 {
+		c.Agent.ReadinessGate.Timeout = JSONDuration(defaultReadinessGateTimeout)
+	}
+	if c.Agent.Resources.CheckInterval == 0 {
+		c.Agent.Resources.CheckInterval = JSONDuration(defaultResourcesCheckInterval)
+	}
+	if c.Agent.Usage.Interval == 0 {
+		c.Agent.Usage.Interval = JSONDuration(defaultUsageInterval)
+	}
+	if c.Agent.Usage.Samples == 0 {
+		c.Agent.Usage.Samples = defaultUsageSamples
+	}
+	if c.Agent.Inventory.Interval == 0 {
+		c.Agent.Inventory.Interval = JSONDuration(defaultInventoryInterval)
+	}
+	if c.Agent.ClusterEndpoint.Interval == 0 {
+		c.Agent.ClusterEndpoint.Interval = JSONDuration(defaultClusterEndpointInterval)
+	}
+	if c.Agent.UnitDrift.Interval == 0 {
+		c.Agent.UnitDrift.Interval = JSONDuration(defaultUnitDriftInterval)
+	}
+	if c.Agent.MetricsTextfile.Interval == 0 {
+		c.Agent.MetricsTextfile.Interval = JSONDuration(defaultMetricsTextfileInterval)
+	}
+	if c.Agent.Dashboard.BindAddress == "" {
+		c.Agent.Dashboard.BindAddress = DefaultDashboardBindAddress
+	}
+	if c.Agent.Dashboard.Username == "" {
+		c.Agent.Dashboard.Username = "admin"
+	}
 }
 
 func (c *Config) setNodeDefaults() {
@@ -397,6 +1035,9 @@ func (c *Config) setNodeDefaults() {
 	// Mark node as unmanaged by cloud controller manager by default, otherwise ccm will delete this node if node is not ready
 	// doc: https://cloud-provider-azure.sigs.k8s.io/topics/cross-resource-group-nodes/#unmanaged-nodes
 	c.Node.Labels["kubernetes.azure.com/managed"] = "false"
+	if _, ok := c.Node.Labels[AgentPoolLabel]; !ok {
+		c.Node.Labels[AgentPoolLabel] = c.Azure.TargetAgentPoolName
+	}
 
 	// Set default kubelet configuration if not provided
 	if c.Node.Kubelet.Verbosity == 0 {
@@ -416,6 +1057,65 @@ func (c *Config) setNodeDefaults() {
 	}
 }
 
+func (c *KubeletConfig) validate() error {
+	for field, values := range map[string]map[string]string{
+		"kubeReserved":   c.KubeReserved,
+		"systemReserved": c.SystemReserved,
+		"evictionHard":   c.EvictionHard,
+	} {
+		for key, value := range values {
+			if key == "" || value == "" || strings.ContainsAny(key+value, ",=< ") {
+				return fmt.Errorf("invalid node.kubelet.%s entry %q=%q: keys and values must be non-empty and must not contain ',', '=', '<', or spaces", field, key, value)
+			}
+		}
+	}
+	for field, port := range map[string]int{"port": c.Port, "healthzPort": c.HealthzPort} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid node.kubelet.%s %d: must be between 1 and 65535", field, port)
+		}
+	}
+	if c.Port != 0 && c.Port == c.HealthzPort {
+		return fmt.Errorf("node.kubelet.port and node.kubelet.healthzPort must differ")
+	}
+	return nil
+}
+
+// applyDeviceProfile resolves node.deviceProfile and fills the kubelet
+// settings the config leaves unset from the profile. It runs before
+// setDefaults so profile values win over the generic defaults.
+func (c *Config) applyDeviceProfile(detect func() string) error {
+	name := strings.TrimSpace(c.Node.DeviceProfile)
+	if name == "" || name == deviceprofile.Auto {
+		name = detect()
+	}
+	profile, err := deviceprofile.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("invalid node.deviceProfile: %w", err)
+	}
+	c.Node.DeviceProfile = profile.Name
+
+	if c.Node.MaxPods == 0 {
+		c.Node.MaxPods = profile.MaxPods
+	}
+	kubelet := &c.Node.Kubelet
+	if kubelet.ImageGCHighThreshold == 0 {
+		kubelet.ImageGCHighThreshold = profile.ImageGCHighThreshold
+	}
+	if kubelet.ImageGCLowThreshold == 0 {
+		kubelet.ImageGCLowThreshold = profile.ImageGCLowThreshold
+	}
+	if kubelet.KubeReserved == nil {
+		kubelet.KubeReserved = maps.Clone(profile.KubeReserved)
+	}
+	if kubelet.SystemReserved == nil {
+		kubelet.SystemReserved = maps.Clone(profile.SystemReserved)
+	}
+	if kubelet.EvictionHard == nil {
+		kubelet.EvictionHard = maps.Clone(profile.EvictionHard)
+	}
+	return nil
+}
+
 func (c *Config) setRuncDefaults() {
 	// Offline artifact manifests are the source of truth for runtime versions.
 	// Do not synthesize a runc version that would conflict with the manifest.
@@ -434,6 +1134,26 @@ func (c *Config) setNpdDefaults() {
 	}
 }
 
+func (c *Config) setAcceleratorDefaults() {
+	if c.Accelerators.DriftCheckInterval == 0 {
+		c.Accelerators.DriftCheckInterval = JSONDuration(defaultAcceleratorDriftCheckInterval)
+	}
+	// Label the node at registration; the daemon keeps the labels in sync
+	// afterwards.
+	for key, value := range c.Accelerators.NodeLabels() {
+		c.Node.Labels[key] = value
+	}
+}
+
+func (c *Config) setTrustDefaults() {
+	if c.Trust.SyncInterval == 0 {
+		c.Trust.SyncInterval = JSONDuration(DefaultTrustSyncInterval)
+	}
+	if c.Trust.ExpiryWarning == 0 {
+		c.Trust.ExpiryWarning = JSONDuration(DefaultTrustExpiryWarning)
+	}
+}
+
 // AKSClusterResourceIDPattern is AKS cluster resource ID regex pattern with capture groups
 // Format: /subscriptions/{subscription-id}/resourceGroups/{resource-group}/providers/Microsoft.ContainerService/managedClusters/{cluster-name}
 // Pattern is case insensitive to handle variations in Azure resource path casing
@@ -513,6 +1233,12 @@ func (c *AzureConfig) validate() error {
 	if err := c.ManagedIdentity.validate(); err != nil {
 		return err
 	}
+	if err := c.WorkloadIdentity.validate(); err != nil {
+		return err
+	}
+	if err := c.DeviceCode.validate(c.Arc != nil && c.Arc.Enabled); err != nil {
+		return err
+	}
 	if err := c.BootstrapToken.validate(); err != nil {
 		return err
 	}
@@ -578,13 +1304,28 @@ func (c *ServicePrincipalConfig) validate() error {
 	if c.ClientID == "" {
 		return fmt.Errorf("azure.servicePrincipal.clientId is required when service principal is configured")
 	}
-	if c.ClientSecret == "" {
+	if c.ClientSecret == "" && c.CertificateFile == "" {
 		return fmt.Errorf("azure.servicePrincipal.clientSecret is required when service principal is configured")
 	}
+	if c.ClientSecret != "" && c.CertificateFile != "" {
+		return fmt.Errorf("azure.servicePrincipal.clientSecret and azure.servicePrincipal.certificateFile are mutually exclusive")
+	}
 	return nil
 }
 
 func (c *ManagedIdentityConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.Source {
+	case "", ManagedIdentitySourceIMDS:
+	case ManagedIdentitySourceArc:
+		if c.ClientID != "" {
+			return fmt.Errorf("azure.managedIdentity.clientId is not supported with source %q: an Arc machine has only its system-assigned identity", c.Source)
+		}
+	default:
+		return fmt.Errorf("invalid azure.managedIdentity.source %q: must be %q or %q", c.Source, ManagedIdentitySourceIMDS, ManagedIdentitySourceArc)
+	}
 	return nil
 }
 
@@ -632,7 +1373,41 @@ func (c *BootstrapConfig) validate() error {
 	if err := agentconfig.ValidateAdditionalHostDevices(c.AdditionalHostDevices); err != nil {
 		return fmt.Errorf("invalid bootstrap.additionalHostDevices: %w", err)
 	}
+	if c.Extraction.MaxTotalBytes < 0 || c.Extraction.MaxFiles < 0 {
+		return fmt.Errorf("invalid bootstrap.extraction: maxTotalBytes and maxFiles must not be negative")
+	}
+	if err := c.NetworkWait.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *LocalDNSConfig) validate() error {
+	if c.Address != "" {
+		if ip := net.ParseIP(c.Address); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid localDNS.address %q: must be an IPv4 address", c.Address)
+		}
+	}
+	for i, upstream := range c.Upstreams {
+		host := upstream
+		if h, _, err := net.SplitHostPort(upstream); err == nil {
+			host = h
+		}
+		if net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid localDNS.upstreams[%d] %q: must be an IP or IP:port", i, upstream)
+		}
+	}
+	return nil
+}
 
+func (c *NPDConfig) validate() error {
+	for i, mirror := range c.Mirrors {
+		parsed, err := url.Parse(mirror)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid npd.mirrors[%d]: must be an absolute http or https URL", i)
+		}
+	}
 	return nil
 }
 
@@ -646,9 +1421,57 @@ func (c *AgentConfig) validate() error {
 	if c.MachineReconcileInterval < 0 {
 		return fmt.Errorf("agent.machineReconcileInterval must be non-negative")
 	}
+	if c.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("agent.shutdownGracePeriod must be non-negative")
+	}
 	if c.MachineOperationMode != "" && !validMachineOperationModes[c.MachineOperationMode] {
 		return fmt.Errorf("invalid agent.machineOperationMode: %s. Valid values are: auto, disable", c.MachineOperationMode)
 	}
+	if c.AuditLogPath != "" && !filepath.IsAbs(c.AuditLogPath) {
+		return fmt.Errorf("agent.auditLogPath must be an absolute path")
+	}
+	if c.BinaryPath != "" && !filepath.IsAbs(c.BinaryPath) {
+		return fmt.Errorf("agent.binaryPath must be an absolute path")
+	}
+	if c.Heartbeat.Interval < 0 || (c.Heartbeat.Interval > 0 && time.Duration(c.Heartbeat.Interval) < time.Second) {
+		return fmt.Errorf("agent.heartbeat.interval must be at least 1s")
+	}
+	if err := c.HTTP.validate(); err != nil {
+		return err
+	}
+	if err := c.Resources.validate(); err != nil {
+		return err
+	}
+	if err := c.Disruption.validate(); err != nil {
+		return err
+	}
+	if c.Posture.Interval < 0 || (c.Posture.Interval > 0 && time.Duration(c.Posture.Interval) < time.Minute) {
+		return fmt.Errorf("agent.posture.interval must be at least 1m")
+	}
+	if c.ComplianceFacts.Interval < 0 || (c.ComplianceFacts.Interval > 0 && time.Duration(c.ComplianceFacts.Interval) < time.Minute) {
+		return fmt.Errorf("agent.complianceFacts.interval must be at least 1m")
+	}
+	if c.ReadinessGate.Timeout < 0 {
+		return fmt.Errorf("agent.readinessGate.timeout must be non-negative")
+	}
+	if c.Standby.Interval < 0 || (c.Standby.Interval > 0 && time.Duration(c.Standby.Interval) < time.Second) {
+		return fmt.Errorf("agent.standby.interval must be at least 1s")
+	}
+	if c.Standby.DrainTimeout < 0 {
+		return fmt.Errorf("agent.standby.drainTimeout must be non-negative")
+	}
+	if c.Standby.StartInStandby && !c.Standby.Enabled {
+		return fmt.Errorf("agent.standby.startInStandby requires agent.standby.enabled")
+	}
+	if err := c.Power.validate(); err != nil {
+		return err
+	}
+	if c.Usage.Interval < 0 || (c.Usage.Interval > 0 && time.Duration(c.Usage.Interval) < time.Second) {
+		return fmt.Errorf("agent.usage.interval must be at least 1s")
+	}
+	if c.Usage.Samples < 0 {
+		return fmt.Errorf("agent.usage.samples must be non-negative")
+	}
 	return nil
 }
 
@@ -694,11 +1517,25 @@ func (c MachineClientConfig) validate() error {
 }
 
 func (c *Config) validate() error {
+	if err := c.applyDeviceProfile(deviceprofile.Detect); err != nil {
+		return err
+	}
 	c.setDefaults()
 
+	if err := c.Instance.Validate(); err != nil {
+		return err
+	}
 	if _, err := c.resolveNodeName(os.Hostname); err != nil {
 		return fmt.Errorf("resolve node name: %w", err)
 	}
+	if arc := c.Azure.Arc; arc != nil && arc.Enabled && arc.MachineName == "" {
+		// The Arc resource follows the node name unless it is named.
+		arc.MachineName = c.Agent.NodeName
+	}
+
+	if err := c.resolveTopology(c.Instance.StateDir()); err != nil {
+		return err
+	}
 
 	populateTargetClusterInfoFromConfig(c)
 
@@ -708,9 +1545,63 @@ func (c *Config) validate() error {
 	if err := c.Agent.validate(); err != nil {
 		return err
 	}
+	if err := c.Agent.Inventory.validate(c.IsARCEnabled()); err != nil {
+		return err
+	}
+	if err := c.Agent.Dashboard.validate(); err != nil {
+		return err
+	}
+	if err := c.Agent.ClusterEndpoint.validate(); err != nil {
+		return err
+	}
+	if err := c.Agent.UnitDrift.validate(); err != nil {
+		return err
+	}
+	if err := c.Agent.MetricsTextfile.validate(); err != nil {
+		return err
+	}
+	if c.Azure.InheritAgentPoolProfile && (c.Agent.MachineClient.Mode != MachineClientModeARM || c.Agent.MachineClient.EndpointURL != "") {
+		return fmt.Errorf("azure.inheritAgentPoolProfile needs agent.machineClient.mode arm without an endpointURL")
+	}
 	if err := c.Bootstrap.validate(); err != nil {
 		return err
 	}
+	if err := c.Node.Kubelet.validate(); err != nil {
+		return err
+	}
+	if err := validateMachineStorage(c.Node.MachineStorage); err != nil {
+		return err
+	}
+	if err := c.Npd.validate(); err != nil {
+		return err
+	}
+	if err := c.LocalDNS.validate(); err != nil {
+		return err
+	}
+	if err := c.Hooks.validate(); err != nil {
+		return err
+	}
+	if err := c.Trust.validate(); err != nil {
+		return err
+	}
+	if err := c.ACRCredentials.validate(c.IsARCEnabled()); err != nil {
+		return err
+	}
+	if err := c.Accelerators.validate(); err != nil {
+		return err
+	}
+	if err := c.Performance.validate(); err != nil {
+		return err
+	}
+	if err := c.SRIOV.validate(); err != nil {
+		return err
+	}
+	if err := c.LocalStorage.validate(); err != nil {
+		return err
+	}
+	if err := c.UnitHardening.validate(); err != nil {
+		return err
+	}
 
 	if err := c.validateAuthSettings(); err != nil {
 		return err
@@ -724,16 +1615,16 @@ func (c *Config) validate() error {
 
 func (c *Config) validateAuthSettings() error {
 	armAuthMethodCount := 0
-	for _, m := range []bool{c.IsARCEnabled(), c.IsSPConfigured(), c.IsMIConfigured()} {
+	for _, m := range []bool{c.IsARCEnabled(), c.IsSPConfigured(), c.IsMIConfigured(), c.IsWorkloadIdentityConfigured()} {
 		if m {
 			armAuthMethodCount++
 		}
 	}
 	if armAuthMethodCount == 0 && !c.IsBootstrapTokenConfigured() {
-		return fmt.Errorf("at least one authentication method must be configured: Arc, Service Principal, Managed Identity, or Bootstrap Token")
+		return fmt.Errorf("at least one authentication method must be configured: Arc, Service Principal, Managed Identity, Workload Identity, or Bootstrap Token")
 	}
 	if armAuthMethodCount > 1 {
-		return fmt.Errorf("only one Azure authentication method can be enabled at a time: Arc, Service Principal, or Managed Identity")
+		return fmt.Errorf("only one Azure authentication method can be enabled at a time: Arc, Service Principal, Managed Identity, or Workload Identity")
 	}
 
 	return nil
@@ -3,12 +3,15 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
 )
 
 const testTargetAgentPoolName = "aksflexnodes"
@@ -91,6 +94,8 @@ func TestSetDefaults(t *testing.T) {
 					c.Agent.LogLevel == "info" &&
 					c.Agent.LogDir == "/var/log/aks-flex-node" &&
 					c.Agent.MachineOperationMode == "auto" &&
+					c.Agent.AuditLogPath == "/var/lib/aks-flex-node/audit.log" &&
+					c.Agent.MetricsBindAddress == "0" &&
 					c.Node.MaxPods == 110 &&
 					c.Components.Runc == "1.1.12"
 			},
@@ -688,6 +693,84 @@ func TestValidateDefaultsTargetAgentPoolName(t *testing.T) {
 	}
 }
 
+func TestApplyDeviceProfile(t *testing.T) {
+	t.Parallel()
+
+	detectPi := func() string { return deviceprofile.RaspberryPi }
+
+	t.Run("auto fills unset kubelet settings", func(t *testing.T) {
+		t.Parallel()
+		cfg := &Config{Node: NodeConfig{Kubelet: KubeletConfig{ImageGCHighThreshold: 90}}}
+		if err := cfg.applyDeviceProfile(detectPi); err != nil {
+			t.Fatalf("applyDeviceProfile: %v", err)
+		}
+		cfg.setDefaults()
+		if cfg.Node.DeviceProfile != deviceprofile.RaspberryPi {
+			t.Errorf("DeviceProfile = %q, want %q", cfg.Node.DeviceProfile, deviceprofile.RaspberryPi)
+		}
+		if cfg.Node.MaxPods != 32 {
+			t.Errorf("MaxPods = %d, want profile default 32", cfg.Node.MaxPods)
+		}
+		if cfg.Node.Kubelet.ImageGCHighThreshold != 90 {
+			t.Errorf("ImageGCHighThreshold = %d, want configured 90", cfg.Node.Kubelet.ImageGCHighThreshold)
+		}
+		if cfg.Node.Kubelet.EvictionHard["memory.available"] != "100Mi" {
+			t.Errorf("EvictionHard = %v, want profile eviction thresholds", cfg.Node.Kubelet.EvictionHard)
+		}
+	})
+
+	t.Run("explicit generic keeps regular defaults", func(t *testing.T) {
+		t.Parallel()
+		cfg := &Config{Node: NodeConfig{DeviceProfile: deviceprofile.Generic}}
+		if err := cfg.applyDeviceProfile(detectPi); err != nil {
+			t.Fatalf("applyDeviceProfile: %v", err)
+		}
+		cfg.setDefaults()
+		if cfg.Node.MaxPods != 110 || cfg.Node.Kubelet.KubeReserved != nil {
+			t.Errorf("generic profile changed defaults: maxPods=%d kubeReserved=%v", cfg.Node.MaxPods, cfg.Node.Kubelet.KubeReserved)
+		}
+	})
+
+	t.Run("profile maps are not shared", func(t *testing.T) {
+		t.Parallel()
+		cfg := &Config{Node: NodeConfig{DeviceProfile: deviceprofile.RaspberryPi}}
+		if err := cfg.applyDeviceProfile(detectPi); err != nil {
+			t.Fatalf("applyDeviceProfile: %v", err)
+		}
+		cfg.Node.Kubelet.KubeReserved["memory"] = "1Gi"
+		profile, _ := deviceprofile.Lookup(deviceprofile.RaspberryPi)
+		if profile.KubeReserved["memory"] != "256Mi" {
+			t.Errorf("profile default was modified through the config")
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		t.Parallel()
+		cfg := &Config{Node: NodeConfig{DeviceProfile: "jetson"}}
+		if err := cfg.applyDeviceProfile(detectPi); err == nil {
+			t.Fatal("applyDeviceProfile succeeded, want error")
+		}
+	})
+}
+
+func TestKubeletConfigValidateMaps(t *testing.T) {
+	t.Parallel()
+
+	valid := KubeletConfig{EvictionHard: map[string]string{"memory.available": "100Mi"}}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	for _, invalid := range []KubeletConfig{
+		{KubeReserved: map[string]string{"memory": ""}},
+		{SystemReserved: map[string]string{"cpu": "100m,memory=1Gi"}},
+		{EvictionHard: map[string]string{"memory.available<": "100Mi"}},
+	} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded, want error", invalid)
+		}
+	}
+}
+
 func TestLoadConfig(t *testing.T) {
 	// Create a temporary directory for test config files
 	tempDir, err := os.MkdirTemp("", "aks-config-test-*")
@@ -790,6 +873,46 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestWriteConfigFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	valid := []byte(`{
+		"azure": {
+			"targetAgentPoolName": "pool1",
+			"bootstrapToken": {"token": "abcdef.0123456789abcdef"},
+			"targetCluster": {"resourceId": "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.ContainerService/managedClusters/test-cluster"}
+		},
+		"node": {"kubelet": {"clusterFQDN": "test-cluster.hcp.eastus.azmk8s.io", "caCertData": "Y2E="}}
+	}`)
+	cfg, err := WriteConfigFile(path, valid)
+	if err != nil {
+		t.Fatalf("WriteConfigFile() of a valid config: %v", err)
+	}
+	if cfg.Azure.TargetAgentPoolName != "pool1" {
+		t.Fatalf("TargetAgentPoolName = %q, want pool1", cfg.Azure.TargetAgentPoolName)
+	}
+
+	if _, err := WriteConfigFile(path, []byte(`{"azure":{"servicePrincipal":{"clientSecret":"s3cret"}}`)); err == nil {
+		t.Fatal("WriteConfigFile() of an invalid config = nil, want error")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(valid) {
+		t.Fatalf("config.json = %s, want the valid config left in place", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %v after an invalid config, want only config.json", entries)
+	}
+}
+
 func TestLoadConfigPoolBootstrapData(t *testing.T) {
 	t.Parallel()
 
@@ -946,6 +1069,36 @@ func TestLoadConfigRejectsInvalidAdditionalHostDevice(t *testing.T) {
 	}
 }
 
+func TestLoadConfigRejectsNegativeExtractionLimits(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Replace(testInstancesConfig, `"components":`, `"bootstrap": {"extraction": {"maxFiles": -1}}, "components":`, 1)
+	_, err := LoadConfig(writeTestConfig(t, data))
+	if err == nil || !strings.Contains(err.Error(), "bootstrap.extraction") {
+		t.Fatalf("LoadConfig() error = %v, want bootstrap.extraction", err)
+	}
+}
+
+func TestLoadConfigRejectsInvalidNPDMirror(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Replace(testInstancesConfig, `"components":`, `"npd": {"mirrors": ["ftp://mirror.example.com"]}, "components":`, 1)
+	_, err := LoadConfig(writeTestConfig(t, data))
+	if err == nil || !strings.Contains(err.Error(), "npd.mirrors[0]") {
+		t.Fatalf("LoadConfig() error = %v, want npd.mirrors[0]", err)
+	}
+}
+
+func TestLoadConfigRejectsNegativeHTTPTimeout(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Replace(testInstancesConfig, `"components":`, `"agent": {"http": {"responseHeaderTimeout": "-1s"}}, "components":`, 1)
+	_, err := LoadConfig(writeTestConfig(t, data))
+	if err == nil || !strings.Contains(err.Error(), "agent.http.responseHeaderTimeout") {
+		t.Fatalf("LoadConfig() error = %v, want agent.http.responseHeaderTimeout", err)
+	}
+}
+
 func TestLoadConfigPoolBootstrapDataMissingOptionalFields(t *testing.T) {
 	t.Parallel()
 
@@ -2335,3 +2488,70 @@ func TestIsBootstrapTokenConfigured(t *testing.T) {
 		})
 	}
 }
+
+func TestResourcesConfigValidatePriority(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name      string
+		resources ResourcesConfig
+		wantErr   string
+	}{
+		{name: "background", resources: ResourcesConfig{Nice: 10, IOSchedulingClass: IOSchedulingIdle, CPUWeight: 20, IOWeight: 20, ApplyConcurrency: 1}},
+		{name: "negative nice", resources: ResourcesConfig{Nice: -5}, wantErr: "nice"},
+		{name: "nice too high", resources: ResourcesConfig{Nice: 20}, wantErr: "nice"},
+		{name: "unknown I/O class", resources: ResourcesConfig{IOSchedulingClass: "realtime"}, wantErr: "ioSchedulingClass"},
+		{name: "weight too high", resources: ResourcesConfig{IOWeight: 10001}, wantErr: "ioWeight"},
+		{name: "negative concurrency", resources: ResourcesConfig{ApplyConcurrency: -1}, wantErr: "applyConcurrency"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.resources.validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("validate() = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMachineStorage(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range []string{"", MachineStorageAuto, MachineStorageDirectory, MachineStorageBtrfs} {
+		if err := validateMachineStorage(backend); err != nil {
+			t.Fatalf("validateMachineStorage(%q) = %v", backend, err)
+		}
+	}
+	if err := validateMachineStorage("zfs"); err == nil || !strings.Contains(err.Error(), "node.machineStorage") {
+		t.Fatalf("validateMachineStorage(zfs) = %v", err)
+	}
+}
+
+func TestLocalDNSListenAddress(t *testing.T) {
+	t.Parallel()
+
+	var c LocalDNSConfig
+	if got := c.ListenAddress(""); got != DefaultLocalDNSAddress {
+		t.Errorf("ListenAddress(\"\") = %s, want %s", got, DefaultLocalDNSAddress)
+	}
+	gpu0, gpu1 := c.ListenAddress("gpu0"), c.ListenAddress("gpu1")
+	for _, got := range []string{gpu0, gpu1} {
+		ip := net.ParseIP(got).To4()
+		if ip == nil || !strings.HasPrefix(got, "169.254.20.") || ip[3] < 11 {
+			t.Errorf("instance address %s, want one in 169.254.20.11-254", got)
+		}
+	}
+	if gpu0 == gpu1 || gpu0 != c.ListenAddress("gpu0") {
+		t.Errorf("instance addresses gpu0=%s gpu1=%s, want distinct and stable", gpu0, gpu1)
+	}
+	c.Address = "169.254.0.53"
+	if got := c.ListenAddress("gpu0"); got != c.Address {
+		t.Errorf("ListenAddress(gpu0) = %s, want the configured %s", got, c.Address)
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+)
+
+// DefaultDashboardBindAddress keeps the dashboard reachable from the node
+// itself only.
+const DefaultDashboardBindAddress = "127.0.0.1:8089"
+
+// DashboardConfig configures the daemon's local web dashboard for operators
+// without kubectl or Azure portal access.
+type DashboardConfig struct {
+	// Enabled turns on the dashboard.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// BindAddress is the host:port the dashboard listens on. An address that
+	// is not a loopback address needs PasswordFile.
+	BindAddress string `json:"bindAddress,omitempty"`
+
+	// Username is the HTTP basic auth user when PasswordFile is set. It
+	// defaults to "admin".
+	Username string `json:"username,omitempty"`
+
+	// PasswordFile holds the HTTP basic auth password. When set, every
+	// request must authenticate. Without it the dashboard is read-only: its
+	// maintenance and health check actions are refused.
+	PasswordFile string `json:"passwordFile,omitempty"`
+}
+
+func (c *DashboardConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(c.BindAddress)
+	if err != nil {
+		return fmt.Errorf("invalid agent.dashboard.bindAddress %q: %w", c.BindAddress, err)
+	}
+	if c.PasswordFile != "" && !filepath.IsAbs(c.PasswordFile) {
+		return fmt.Errorf("agent.dashboard.passwordFile must be an absolute path")
+	}
+	if ip := net.ParseIP(host); (ip == nil || !ip.IsLoopback()) && host != "localhost" && c.PasswordFile == "" {
+		return fmt.Errorf("agent.dashboard.bindAddress %q is not a loopback address; set agent.dashboard.passwordFile", c.BindAddress)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDashboardConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		dashboard DashboardConfig
+		wantErr   string
+	}{
+		{name: "disabled", dashboard: DashboardConfig{BindAddress: "0.0.0.0:80"}},
+		{name: "loopback", dashboard: DashboardConfig{Enabled: true, BindAddress: DefaultDashboardBindAddress}},
+		{name: "localhost", dashboard: DashboardConfig{Enabled: true, BindAddress: "localhost:8089"}},
+		{name: "ipv6 loopback", dashboard: DashboardConfig{Enabled: true, BindAddress: "[::1]:8089"}},
+		{name: "lan with password", dashboard: DashboardConfig{Enabled: true, BindAddress: "0.0.0.0:8089", PasswordFile: "/etc/aks-flex-node/dashboard-password"}},
+		{name: "lan without password", dashboard: DashboardConfig{Enabled: true, BindAddress: ":8089"}, wantErr: "passwordFile"},
+		{name: "missing port", dashboard: DashboardConfig{Enabled: true, BindAddress: "127.0.0.1"}, wantErr: "bindAddress"},
+		{name: "relative password file", dashboard: DashboardConfig{Enabled: true, BindAddress: DefaultDashboardBindAddress, PasswordFile: "password"}, wantErr: "absolute"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.dashboard.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Disruption levels of agent-driven restarts, from least to most disruptive.
+const (
+	// DisruptionNone allows no agent-driven restarts.
+	DisruptionNone = "none"
+	// DisruptionKubelet allows restarting the kubelet inside the running
+	// machine. Containers keep running.
+	DisruptionKubelet = "kubelet"
+	// DisruptionMachine allows stopping the nspawn machine, which stops every
+	// container on the node. It is the default.
+	DisruptionMachine = "machine"
+)
+
+var disruptionRanks = map[string]int{
+	DisruptionNone:    0,
+	DisruptionKubelet: 1,
+	DisruptionMachine: 2,
+}
+
+// DisruptionConfig bounds how disruptive the restarts the daemon performs on
+// its own, for repaves and NodeReboot operations, may be.
+type DisruptionConfig struct {
+	// MaxDisruption is the most disruptive restart allowed outside Windows:
+	// "none", "kubelet", or "machine".
+	MaxDisruption string `json:"maxDisruption,omitempty"`
+
+	// Windows are daily UTC time ranges such as "02:00-05:00" in which
+	// restarts of any level are allowed. A range may wrap past midnight.
+	Windows []string `json:"windows,omitempty"`
+
+	// RespectPodDisruptionBudgets defers machine restarts, which stop every
+	// container on the node, while a pod on the node is annotated not safe to
+	// evict or its PodDisruptionBudget allows fewer disruptions than the node
+	// would cause. The daemon credentials need list access to pods and
+	// PodDisruptionBudgets.
+	RespectPodDisruptionBudgets bool `json:"respectPodDisruptionBudgets,omitempty"`
+}
+
+// DisruptionAllowed reports whether MaxDisruption permits a restart of
+// level, ignoring the windows. An empty MaxDisruption permits everything.
+func (c DisruptionConfig) DisruptionAllowed(level string) bool {
+	if c.MaxDisruption == "" {
+		return true
+	}
+	return disruptionRanks[level] <= disruptionRanks[c.MaxDisruption]
+}
+
+// NextWindow reports whether t falls in a window and, when it does not, how
+// long until the next one opens. It returns false and zero without windows.
+func (c DisruptionConfig) NextWindow(t time.Time) (open bool, wait time.Duration) {
+	t = t.UTC()
+	sinceMidnight := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	for _, window := range c.Windows {
+		start, end, err := parseDailyWindow(window)
+		if err != nil {
+			continue
+		}
+		if inDailyWindow(sinceMidnight, start, end) {
+			return true, 0
+		}
+		until := start - sinceMidnight
+		if until < 0 {
+			until += 24 * time.Hour
+		}
+		if wait == 0 || until < wait {
+			wait = until
+		}
+	}
+	return false, wait
+}
+
+func inDailyWindow(at, start, end time.Duration) bool {
+	if start <= end {
+		return at >= start && at < end
+	}
+	return at >= start || at < end
+}
+
+// Valid reports whether MaxDisruption is empty or a known level.
+func (c DisruptionConfig) Valid() bool {
+	_, ok := disruptionRanks[c.MaxDisruption]
+	return c.MaxDisruption == "" || ok
+}
+
+func (c *DisruptionConfig) validate() error {
+	if !c.Valid() {
+		return fmt.Errorf("invalid agent.disruption.maxDisruption: %s. Valid values are: none, kubelet, machine", c.MaxDisruption)
+	}
+	for _, window := range c.Windows {
+		if _, _, err := parseDailyWindow(window); err != nil {
+			return fmt.Errorf("invalid agent.disruption.windows entry %q: %w", window, err)
+		}
+	}
+	return nil
+}
+
+// parseDailyWindow parses "HH:MM-HH:MM" into offsets from midnight.
+func parseDailyWindow(window string) (start, end time.Duration, err error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("want HH:MM-HH:MM")
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("window is empty")
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDisruptionConfigDisruptionAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		max   string
+		level string
+		want  bool
+	}{
+		{max: "", level: DisruptionMachine, want: true},
+		{max: DisruptionMachine, level: DisruptionMachine, want: true},
+		{max: DisruptionKubelet, level: DisruptionKubelet, want: true},
+		{max: DisruptionKubelet, level: DisruptionMachine, want: false},
+		{max: DisruptionNone, level: DisruptionKubelet, want: false},
+	}
+	for _, tt := range tests {
+		if got := (DisruptionConfig{MaxDisruption: tt.max}).DisruptionAllowed(tt.level); got != tt.want {
+			t.Errorf("max %q level %q: DisruptionAllowed() = %v, want %v", tt.max, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestDisruptionConfigNextWindow(t *testing.T) {
+	t.Parallel()
+
+	cfg := DisruptionConfig{Windows: []string{"02:00-05:00", "23:30-00:30"}}
+	day := time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at       time.Duration
+		wantOpen bool
+		wantWait time.Duration
+	}{
+		{at: 3 * time.Hour, wantOpen: true},
+		{at: 5 * time.Hour, wantWait: 18*time.Hour + 30*time.Minute},
+		{at: 15 * time.Minute, wantOpen: true},
+		{at: 23*time.Hour + 45*time.Minute, wantOpen: true},
+		{at: time.Hour, wantWait: time.Hour},
+	}
+	for _, tt := range tests {
+		open, wait := cfg.NextWindow(day.Add(tt.at))
+		if open != tt.wantOpen || wait != tt.wantWait {
+			t.Errorf("at %s: NextWindow() = %v, %s, want %v, %s", tt.at, open, wait, tt.wantOpen, tt.wantWait)
+		}
+	}
+
+	if open, wait := (DisruptionConfig{}).NextWindow(day); open || wait != 0 {
+		t.Errorf("no windows: NextWindow() = %v, %s, want false, 0", open, wait)
+	}
+}
+
+func TestDisruptionConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     DisruptionConfig
+		wantErr bool
+	}{
+		{name: "empty", cfg: DisruptionConfig{}},
+		{name: "valid", cfg: DisruptionConfig{MaxDisruption: DisruptionKubelet, Windows: []string{"22:00-02:00"}}},
+		{name: "unknown level", cfg: DisruptionConfig{MaxDisruption: "node"}, wantErr: true},
+		{name: "missing end", cfg: DisruptionConfig{Windows: []string{"02:00"}}, wantErr: true},
+		{name: "bad clock", cfg: DisruptionConfig{Windows: []string{"25:00-26:00"}}, wantErr: true},
+		{name: "empty window", cfg: DisruptionConfig{Windows: []string{"02:00-02:00"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
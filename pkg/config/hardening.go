@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnitHardeningConfig applies a sandboxing profile to the systemd units the
+// agent renders into the nspawn machine, the node problem detector and the
+// local DNS cache. The kubelet and containerd units come from the rootfs and
+// get a drop-in with their resource caps and explicit directives only, since
+// their containers would inherit the rest of the profile.
+type UnitHardeningConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Units overrides the profile for single units, keyed by unit name such
+	// as "node-local-dns.service".
+	Units map[string]UnitHardeningOverride `json:"units,omitempty"`
+}
+
+// UnitHardeningOverride adjusts the hardening profile of one unit.
+type UnitHardeningOverride struct {
+	// Disabled leaves the unit as rendered.
+	Disabled bool `json:"disabled,omitempty"`
+	// MemoryMaxBytes and CPUQuotaPercent cap the unit's cgroup; 100 is one
+	// CPU. Zero leaves the unit uncapped.
+	MemoryMaxBytes  int64 `json:"memoryMaxBytes,omitempty"`
+	CPUQuotaPercent int   `json:"cpuQuotaPercent,omitempty"`
+	// Directives replace or add [Service] directives of the profile. An empty
+	// value drops the directive.
+	Directives map[string]string `json:"directives,omitempty"`
+}
+
+// For returns the override of unit, which is empty when none is configured.
+func (c UnitHardeningConfig) For(unit string) UnitHardeningOverride {
+	return c.Units[unit]
+}
+
+func (c *UnitHardeningConfig) validate() error {
+	for unit, override := range c.Units {
+		if !strings.HasSuffix(unit, ".service") {
+			return fmt.Errorf("unitHardening.units: %q is not a service unit name", unit)
+		}
+		if override.MemoryMaxBytes < 0 || override.CPUQuotaPercent < 0 {
+			return fmt.Errorf("unitHardening.units[%s]: limits must not be negative", unit)
+		}
+		for key, value := range override.Directives {
+			if key == "" || strings.ContainsAny(key, "=[] \t\r\n") {
+				return fmt.Errorf("unitHardening.units[%s]: invalid directive name %q", unit, key)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("unitHardening.units[%s].directives[%s]: value must be a single line", unit, key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnitHardeningConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		hardening UnitHardeningConfig
+		wantErr   string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			hardening: UnitHardeningConfig{Enabled: true, Units: map[string]UnitHardeningOverride{
+				"node-local-dns.service": {MemoryMaxBytes: 64 << 20, CPUQuotaPercent: 50, Directives: map[string]string{"ProtectSystem": "strict", "PrivateTmp": ""}},
+			}},
+		},
+		{
+			name:      "not a service",
+			hardening: UnitHardeningConfig{Units: map[string]UnitHardeningOverride{"kubelet": {}}},
+			wantErr:   "not a service unit",
+		},
+		{
+			name:      "negative limit",
+			hardening: UnitHardeningConfig{Units: map[string]UnitHardeningOverride{"a.service": {CPUQuotaPercent: -1}}},
+			wantErr:   "negative",
+		},
+		{
+			name:      "directive with equals",
+			hardening: UnitHardeningConfig{Units: map[string]UnitHardeningOverride{"a.service": {Directives: map[string]string{"User=root": "x"}}}},
+			wantErr:   "invalid directive name",
+		},
+		{
+			name:      "multi-line value",
+			hardening: UnitHardeningConfig{Units: map[string]UnitHardeningOverride{"a.service": {Directives: map[string]string{"User": "root\nExecStart=/bin/sh"}}}},
+			wantErr:   "single line",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.hardening.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
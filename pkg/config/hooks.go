@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Hook points, in the order the bootstrap pipeline reaches them.
+const (
+	// HookPreBootstrap runs before the agent changes anything on the host.
+	HookPreBootstrap = "preBootstrap"
+	// HookPostArc runs once the host is connected to Azure Arc.
+	HookPostArc = "postArc"
+	// HookPostRootFS runs once the nspawn machine rootfs is downloaded and
+	// validated, before the kubelet is configured. It also runs on repaves.
+	HookPostRootFS = "postRootFS"
+	// HookPreKubelet runs right before the machine and its kubelet are
+	// started. It also runs on repaves.
+	HookPreKubelet = "preKubelet"
+	// HookPostBootstrap runs once the daemon service is installed.
+	HookPostBootstrap = "postBootstrap"
+	// HookPreUnbootstrap runs before a node is torn down: by reset, by the
+	// daemon when the node's deletion is requested, or by extension uninstall.
+	HookPreUnbootstrap = "preUnbootstrap"
+	// HookPreSleep runs when the power schedule puts the node to sleep,
+	// once its workloads are stopped and before the host is suspended.
+	HookPreSleep = "preSleep"
+	// HookPostWake runs when the node wakes, before its workloads are
+	// started, for steps such as reconnecting a site VPN.
+	HookPostWake = "postWake"
+)
+
+// Hook failure policies.
+const (
+	// HookAbort fails the step the hook runs in. It is the default.
+	HookAbort = "abort"
+	// HookContinue logs the failure and carries on.
+	HookContinue = "continue"
+)
+
+// DefaultHookTimeout bounds a hook that sets no timeout of its own.
+const DefaultHookTimeout = 5 * time.Minute
+
+// HooksConfig lists operator scripts to run at fixed points of the bootstrap
+// pipeline, for site-specific steps such as installing an EDR agent or
+// registering with a CMDB. Hooks at one point run in order.
+type HooksConfig struct {
+	PreBootstrap   []HookConfig `json:"preBootstrap,omitempty"`
+	PostArc        []HookConfig `json:"postArc,omitempty"`
+	PostRootFS     []HookConfig `json:"postRootFS,omitempty"`
+	PreKubelet     []HookConfig `json:"preKubelet,omitempty"`
+	PostBootstrap  []HookConfig `json:"postBootstrap,omitempty"`
+	PreUnbootstrap []HookConfig `json:"preUnbootstrap,omitempty"`
+	PreSleep       []HookConfig `json:"preSleep,omitempty"`
+	PostWake       []HookConfig `json:"postWake,omitempty"`
+}
+
+// At returns the hooks configured for point.
+func (c HooksConfig) At(point string) []HookConfig {
+	switch point {
+	case HookPreBootstrap:
+		return c.PreBootstrap
+	case HookPostArc:
+		return c.PostArc
+	case HookPostRootFS:
+		return c.PostRootFS
+	case HookPreKubelet:
+		return c.PreKubelet
+	case HookPostBootstrap:
+		return c.PostBootstrap
+	case HookPreUnbootstrap:
+		return c.PreUnbootstrap
+	case HookPreSleep:
+		return c.PreSleep
+	case HookPostWake:
+		return c.PostWake
+	}
+	return nil
+}
+
+// HookConfig is one operator script. It runs on the host as root with the
+// agent's environment plus Env and the AKS_FLEX_NODE_* facts of the node.
+type HookConfig struct {
+	// Path is the absolute path of the executable.
+	Path string   `json:"path"`
+	Args []string `json:"args,omitempty"`
+	// Env adds variables to the hook's environment.
+	Env map[string]string `json:"env,omitempty"`
+	// Timeout bounds the hook; it defaults to DefaultHookTimeout.
+	Timeout JSONDuration `json:"timeout,omitempty"`
+	// OnFailure is "abort" (default) or "continue".
+	OnFailure string `json:"onFailure,omitempty"`
+}
+
+// TimeoutOrDefault returns Timeout or DefaultHookTimeout.
+func (h HookConfig) TimeoutOrDefault() time.Duration {
+	if h.Timeout > 0 {
+		return time.Duration(h.Timeout)
+	}
+	return DefaultHookTimeout
+}
+
+// ContinueOnFailure reports whether a failure of the hook is ignored.
+func (h HookConfig) ContinueOnFailure() bool {
+	return h.OnFailure == HookContinue
+}
+
+func (c *HooksConfig) validate() error {
+	for _, point := range []string{HookPreBootstrap, HookPostArc, HookPostRootFS, HookPreKubelet, HookPostBootstrap, HookPreUnbootstrap, HookPreSleep, HookPostWake} {
+		for i, hook := range c.At(point) {
+			if err := hook.validate(); err != nil {
+				return fmt.Errorf("invalid hooks.%s[%d]: %w", point, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (h HookConfig) validate() error {
+	if !filepath.IsAbs(h.Path) {
+		return fmt.Errorf("path %q must be absolute", h.Path)
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	switch h.OnFailure {
+	case "", HookAbort, HookContinue:
+	default:
+		return fmt.Errorf("onFailure %q must be abort or continue", h.OnFailure)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHooksConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		hooks   HooksConfig
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			hooks: HooksConfig{
+				PreBootstrap:   []HookConfig{{Path: "/opt/site/edr.sh", OnFailure: HookAbort}},
+				PreUnbootstrap: []HookConfig{{Path: "/opt/site/cmdb.sh", OnFailure: HookContinue, Timeout: JSONDuration(time.Minute)}},
+			},
+		},
+		{
+			name:    "relative path",
+			hooks:   HooksConfig{PostArc: []HookConfig{{Path: "edr.sh"}}},
+			wantErr: "hooks.postArc[0]",
+		},
+		{
+			name:    "unknown policy",
+			hooks:   HooksConfig{PreKubelet: []HookConfig{{Path: "/a"}, {Path: "/b", OnFailure: "retry"}}},
+			wantErr: "hooks.preKubelet[1]",
+		},
+		{
+			name:    "negative timeout",
+			hooks:   HooksConfig{PostBootstrap: []HookConfig{{Path: "/a", Timeout: JSONDuration(-time.Second)}}},
+			wantErr: "timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.hooks.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHookConfigTimeoutOrDefault(t *testing.T) {
+	t.Parallel()
+
+	if got := (HookConfig{}).TimeoutOrDefault(); got != DefaultHookTimeout {
+		t.Errorf("TimeoutOrDefault() = %v, want %v", got, DefaultHookTimeout)
+	}
+	if got := (HookConfig{Timeout: JSONDuration(time.Minute)}).TimeoutOrDefault(); got != time.Minute {
+		t.Errorf("TimeoutOrDefault() = %v, want 1m", got)
+	}
+}
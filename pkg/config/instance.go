@@ -0,0 +1,264 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// InstancesDir holds the state root of every named node instance.
+	InstancesDir = ConfigDir + "/instances"
+
+	controlSocketDir = "/run/aks-flex-node"
+	serviceUnitBase  = "aks-flex-node-agent"
+	exportedBinBase  = "/usr/local/sbin/aks-flex"
+
+	// maxInstanceNameLength keeps suffixed machine and unit names well within
+	// the 64 character hostname limit of nspawn machines.
+	maxInstanceNameLength = 20
+
+	defaultKubeletPort        = 10250
+	defaultKubeletHealthzPort = 10248
+)
+
+// Instance names one logical node on the host. Several instances let a large
+// host register as several Kubernetes nodes, each with its own nspawn machine
+// pair, kubelet, state root, agent unit, and admin socket. The empty Instance
+// is the default node and keeps the unsuffixed names.
+type Instance string
+
+// Validate checks that the name is usable as a suffix for machine and unit
+// names.
+func (i Instance) Validate() error {
+	if i == "" {
+		return nil
+	}
+	if len(i) > maxInstanceNameLength {
+		return fmt.Errorf("instance name %q is longer than %d characters", i, maxInstanceNameLength)
+	}
+	if errs := validation.IsDNS1123Label(string(i)); len(errs) > 0 {
+		return fmt.Errorf("instance name %q is not a valid DNS label: %s", i, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (i Instance) suffix() string {
+	if i == "" {
+		return ""
+	}
+	return "-" + string(i)
+}
+
+// StateDir is the root of the instance's persisted agent state: daemon
+// state, timings, maintenance, daemon credentials, and the kubelet token.
+func (i Instance) StateDir() string {
+	if i == "" {
+		return ConfigDir
+	}
+	return filepath.Join(InstancesDir, string(i))
+}
+
+// KubeletTokenPath is where the Arc-derived kubelet token is kept, on the host
+// and inside the instance's machines.
+func (i Instance) KubeletTokenPath() string {
+	if i == "" {
+		return KubeletTokenPath
+	}
+	return filepath.Join(i.StateDir(), "kubelet-token")
+}
+
+// Machines returns the instance's blue-green nspawn machine pair. The first
+// machine is the one bootstrap starts.
+func (i Instance) Machines() [2]string {
+	return [2]string{
+		goalstates.NSpawnMachineKube1 + i.suffix(),
+		goalstates.NSpawnMachineKube2 + i.suffix(),
+	}
+}
+
+// AlternateMachine returns the other machine of the instance's pair.
+func (i Instance) AlternateMachine(current string) string {
+	machines := i.Machines()
+	if current == machines[0] {
+		return machines[1]
+	}
+	return machines[0]
+}
+
+// ServiceUnitName is the systemd unit running the instance's agent daemon.
+func (i Instance) ServiceUnitName() string {
+	return serviceUnitBase + i.suffix() + ".service"
+}
+
+// ControlSocketPath is the unix socket of the instance daemon's admin API.
+func (i Instance) ControlSocketPath() string {
+	return filepath.Join(controlSocketDir, "ctl"+i.suffix()+".sock")
+}
+
+// ExportedBinDir holds the host wrappers for the debugging tools of the
+// instance's active machine when agent.exportBinaries is set.
+func (i Instance) ExportedBinDir() string {
+	return exportedBinBase + i.suffix()
+}
+
+// ListInstances returns the named instances that have a state root on the
+// host, so reset can find them without a config file.
+func ListInstances() ([]Instance, error) {
+	entries, err := os.ReadDir(InstancesDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list instances in %s: %w", InstancesDir, err)
+	}
+	var instances []Instance
+	for _, entry := range entries {
+		instance := Instance(entry.Name())
+		if entry.IsDir() && instance.Validate() == nil {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// applyInstanceOverlay returns the config document for instance. The
+// sections under "instances" are JSON merge patches (RFC 7386) over the rest
+// of the document, so an instance only lists what differs from the shared
+// settings, such as its node name, agent pool, labels, taints, and kubelet
+// ports. Without an instance the document is returned unchanged. The
+// instance section's values are recorded in origins.
+func applyInstanceOverlay(data []byte, instance Instance, origins Origins) ([]byte, error) {
+	if err := instance.Validate(); err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	}
+	sections, _ := doc["instances"].(map[string]any)
+	delete(doc, "instances")
+	origins.drop("instances")
+	if err := checkInstancePorts(doc, sections); err != nil {
+		return nil, err
+	}
+	if instance == "" {
+		return data, nil
+	}
+
+	section, ok := sections[string(instance)]
+	if !ok {
+		// A config file dedicated to one instance names it at the top level
+		// instead of in a section.
+		if name, _ := doc["instance"].(string); name == string(instance) {
+			return data, nil
+		}
+		return nil, fmt.Errorf("instance %q is not defined in the config instances section", instance)
+	}
+	patch, ok := section.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("instances.%s must be an object", instance)
+	}
+	merged := mergePatch(doc, patch).(map[string]any)
+	merged["instance"] = string(instance)
+	origins.record("instances."+string(instance), "", patch)
+	return json.Marshal(merged)
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch to target.
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	out := maps.Clone(targetObject)
+	for key, value := range patchObject {
+		if value == nil {
+			delete(out, key)
+			continue
+		}
+		out[key] = mergePatch(out[key], value)
+	}
+	return out
+}
+
+// checkInstancePorts rejects configs whose nodes would bind the same host
+// address: the default node and every instance share the host network
+// namespace, so their kubelet, metrics, and local DNS listeners must differ.
+func checkInstancePorts(base map[string]any, sections map[string]any) error {
+	if len(sections) == 0 {
+		return nil
+	}
+	type binding struct{ key, what, field string }
+	owners := map[string]string{}
+	claim := func(owner string, doc map[string]any) error {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		var listeners struct {
+			Instance Instance `json:"instance"`
+			Agent    struct {
+				MetricsBindAddress string `json:"metricsBindAddress"`
+			} `json:"agent"`
+			Node struct {
+				Kubelet struct {
+					Port        int `json:"port"`
+					HealthzPort int `json:"healthzPort"`
+				} `json:"kubelet"`
+			} `json:"node"`
+			LocalDNS  LocalDNSConfig `json:"localDNS"`
+			Bootstrap struct {
+				OfflineArtifacts OfflineArtifactsConfig `json:"offlineArtifacts"`
+			} `json:"bootstrap"`
+		}
+		if err := json.Unmarshal(data, &listeners); err != nil {
+			return fmt.Errorf("decode %s: %w", owner, err)
+		}
+		kubelet := listeners.Node.Kubelet
+		binds := []binding{
+			{fmt.Sprintf("port %d", cmp.Or(kubelet.Port, defaultKubeletPort)), "kubelet port", "node.kubelet.port"},
+			{fmt.Sprintf("port %d", cmp.Or(kubelet.HealthzPort, defaultKubeletHealthzPort)), "kubelet healthz port", "node.kubelet.healthzPort"},
+		}
+		if _, port, err := net.SplitHostPort(listeners.Agent.MetricsBindAddress); err == nil && port != "0" {
+			binds = append(binds, binding{"port " + port, "metrics port", "agent.metricsBindAddress"})
+		}
+		if listeners.LocalDNS.Enabled && strings.TrimSpace(listeners.Bootstrap.OfflineArtifacts.Source) == "" {
+			address := net.JoinHostPort(listeners.LocalDNS.ListenAddress(listeners.Instance), "53")
+			binds = append(binds, binding{address, "local DNS address", "localDNS.address"})
+		}
+		for _, bind := range binds {
+			if other, ok := owners[bind.key]; ok {
+				return fmt.Errorf("%s and %s both bind %s (%s); set %s per instance", other, owner, bind.key, bind.what, bind.field)
+			}
+			owners[bind.key] = owner
+		}
+		return nil
+	}
+	if err := claim("the default node", base); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(sections)) {
+		patch, _ := sections[name].(map[string]any)
+		merged := mergePatch(base, patch).(map[string]any)
+		merged["instance"] = name
+		if err := claim("instance "+name, merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
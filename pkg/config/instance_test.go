@@ -0,0 +1,219 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testInstancesConfig = `{
+	"azure": {
+		"targetAgentPoolName": "pool1",
+		"bootstrapToken": {"token": "abcdef.0123456789abcdef"},
+		"targetCluster": {
+			"resourceId": "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.ContainerService/managedClusters/test-cluster"
+		}
+	},
+	"components": {"kubernetes": "1.29.0"},
+	"node": {
+		"maxPods": 50,
+		"kubelet": {
+			"clusterFQDN": "test-cluster-dns-12345678.hcp.eastus.azmk8s.io",
+			"caCertData": "LS0tLS1CRUdJTi1DRVJUSUZJQ0FURS0tLS0t"
+		}
+	},
+	"instances": {
+		"gpu0": {
+			"azure": {"targetAgentPoolName": "gpupool"},
+			"node": {"maxPods": null, "kubelet": {"port": 10260, "healthzPort": 10258}}
+		}
+	}
+}`
+
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadInstanceConfig(t *testing.T) {
+	t.Parallel()
+
+	path := writeTestConfig(t, testInstancesConfig)
+
+	base, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if base.Instance != "" || base.Azure.TargetAgentPoolName != "pool1" || base.Node.Kubelet.Port != 0 {
+		t.Fatalf("default instance = %q, pool %q, port %d; want the unpatched config",
+			base.Instance, base.Azure.TargetAgentPoolName, base.Node.Kubelet.Port)
+	}
+
+	cfg, err := LoadInstanceConfig(path, "gpu0")
+	if err != nil {
+		t.Fatalf("LoadInstanceConfig() unexpected error: %v", err)
+	}
+	if cfg.Instance != "gpu0" {
+		t.Fatalf("Instance = %q, want gpu0", cfg.Instance)
+	}
+	if cfg.Azure.TargetAgentPoolName != "gpupool" {
+		t.Fatalf("TargetAgentPoolName = %q, want gpupool", cfg.Azure.TargetAgentPoolName)
+	}
+	if cfg.Node.Kubelet.Port != 10260 || cfg.Node.Kubelet.HealthzPort != 10258 {
+		t.Fatalf("kubelet ports = %d/%d, want 10260/10258", cfg.Node.Kubelet.Port, cfg.Node.Kubelet.HealthzPort)
+	}
+	if cfg.Node.Kubelet.ClusterFQDN == "" {
+		t.Fatal("ClusterFQDN was dropped by the instance patch, want it merged from the shared settings")
+	}
+	if cfg.Node.MaxPods == 50 {
+		t.Fatal("MaxPods = 50, want the null patch to remove it")
+	}
+	named := &Config{Instance: "gpu0"}
+	if name, err := named.resolveNodeName(func() (string, error) { return "Host1", nil }); err != nil || name != "host1-gpu0" {
+		t.Fatalf("resolveNodeName = %q, %v; want host1-gpu0", name, err)
+	}
+
+	if _, err := LoadInstanceConfig(path, "gpu1"); err == nil || !strings.Contains(err.Error(), "not defined") {
+		t.Fatalf("LoadInstanceConfig(undefined) error = %v, want not defined", err)
+	}
+	if _, err := LoadInstanceConfig(path, "GPU_0"); err == nil || !strings.Contains(err.Error(), "DNS label") {
+		t.Fatalf("LoadInstanceConfig(invalid name) error = %v, want DNS label", err)
+	}
+}
+
+func TestLoadInstanceConfigDedicatedFile(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Replace(testInstancesConfig, `"instances": {`, `"instance": "edge", "unused": {`, 1)
+	path := writeTestConfig(t, data)
+	cfg, err := LoadInstanceConfig(path, "edge")
+	if err != nil {
+		t.Fatalf("LoadInstanceConfig() unexpected error: %v", err)
+	}
+	if cfg.Instance != "edge" {
+		t.Fatalf("Instance = %q, want edge", cfg.Instance)
+	}
+	if _, err := LoadInstanceConfig(path, "other"); err == nil {
+		t.Fatal("LoadInstanceConfig(other) error = nil, want mismatch with the file's instance")
+	}
+}
+
+func TestApplyInstanceOverlayRejectsSharedPorts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "instance reuses the default node's healthz port",
+			data: `{"instances": {
+				"a": {"node": {"kubelet": {"port": 10260, "healthzPort": 10258}}},
+				"b": {"node": {"kubelet": {"port": 10270}}}
+			}}`,
+			want: "the default node and instance b both bind port 10248",
+		},
+		{
+			name: "instances share a kubelet port",
+			data: `{"instances": {
+				"a": {"node": {"kubelet": {"port": 10260, "healthzPort": 10258}}},
+				"b": {"node": {"kubelet": {"port": 10260, "healthzPort": 10268}}}
+			}}`,
+			want: "instance a and instance b both bind port 10260",
+		},
+		{
+			name: "metrics port clashes with another node",
+			data: `{"agent": {"metricsBindAddress": ":8080"}, "instances": {
+				"a": {"node": {"kubelet": {"port": 10260, "healthzPort": 10258}}}
+			}}`,
+			want: "the default node and instance a both bind port 8080 (metrics port)",
+		},
+		{
+			name: "local DNS address is shared",
+			data: `{"localDNS": {"enabled": true}, "instances": {
+				"a": {
+					"localDNS": {"address": "169.254.20.10"},
+					"node": {"kubelet": {"port": 10260, "healthzPort": 10258}}
+				}
+			}}`,
+			want: "both bind 169.254.20.10:53 (local DNS address)",
+		},
+		{
+			name: "distinct listeners",
+			data: `{"agent": {"metricsBindAddress": ":8080"}, "localDNS": {"enabled": true}, "instances": {
+				"a": {
+					"agent": {"metricsBindAddress": ":8081"},
+					"node": {"kubelet": {"port": 10260, "healthzPort": 10258}}
+				}
+			}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := applyInstanceOverlay([]byte(tt.data), "a", nil)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("applyInstanceOverlay() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("applyInstanceOverlay() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		instance Instance
+		machines [2]string
+		unit     string
+		socket   string
+		stateDir string
+	}{
+		{
+			machines: [2]string{"kube1", "kube2"},
+			unit:     "aks-flex-node-agent.service",
+			socket:   "/run/aks-flex-node/ctl.sock",
+			stateDir: ConfigDir,
+		},
+		{
+			instance: "gpu0",
+			machines: [2]string{"kube1-gpu0", "kube2-gpu0"},
+			unit:     "aks-flex-node-agent-gpu0.service",
+			socket:   "/run/aks-flex-node/ctl-gpu0.sock",
+			stateDir: "/etc/aks-flex-node/instances/gpu0",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.instance.Machines(); got != tt.machines {
+			t.Errorf("%q.Machines() = %v, want %v", tt.instance, got, tt.machines)
+		}
+		if got := tt.instance.AlternateMachine(tt.machines[0]); got != tt.machines[1] {
+			t.Errorf("%q.AlternateMachine(%s) = %s, want %s", tt.instance, tt.machines[0], got, tt.machines[1])
+		}
+		if got := tt.instance.ServiceUnitName(); got != tt.unit {
+			t.Errorf("%q.ServiceUnitName() = %s, want %s", tt.instance, got, tt.unit)
+		}
+		if got := tt.instance.ControlSocketPath(); got != tt.socket {
+			t.Errorf("%q.ControlSocketPath() = %s, want %s", tt.instance, got, tt.socket)
+		}
+		if got := tt.instance.StateDir(); got != tt.stateDir {
+			t.Errorf("%q.StateDir() = %s, want %s", tt.instance, got, tt.stateDir)
+		}
+	}
+	if err := Instance("an-instance-name-that-is-too-long").Validate(); err == nil {
+		t.Error("Validate(long name) = nil, want error")
+	}
+}
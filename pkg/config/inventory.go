@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+// Inventory exporter types.
+const (
+	// InventoryExporterFile writes the inventory as JSON to a local file.
+	InventoryExporterFile = "file"
+	// InventoryExporterHTTP POSTs the inventory as JSON to a URL.
+	InventoryExporterHTTP = "http"
+	// InventoryExporterArc sets a summary of the inventory as tags on the
+	// Azure Arc machine resource.
+	InventoryExporterArc = "arc"
+)
+
+// InventoryFileName is where the file exporter writes under the instance's
+// state directory unless its path is set.
+const InventoryFileName = "inventory.json"
+
+const defaultInventoryInterval = 24 * time.Hour
+
+// InventoryConfig configures the daemon's host inventory export for asset
+// management systems.
+type InventoryConfig struct {
+	// Enabled turns on the inventory collector.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Interval is how often the inventory is collected and exported.
+	Interval JSONDuration `json:"interval,omitempty"`
+
+	// Exporters receive every collected inventory. Without any, the
+	// inventory is written to InventoryFileName under the state directory.
+	Exporters []InventoryExporterConfig `json:"exporters,omitempty"`
+}
+
+// InventoryExporterConfig is one destination of the inventory.
+type InventoryExporterConfig struct {
+	// Type is "file", "http", or "arc".
+	Type string `json:"type"`
+	// Path is the file exporter's absolute output path.
+	Path string `json:"path,omitempty"`
+	// URL is the http exporter's endpoint.
+	URL string `json:"url,omitempty"`
+	// Headers are added to the http exporter's requests, such as an
+	// Authorization header.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ExportersOrDefault returns Exporters, or a file exporter when none are
+// configured.
+func (c InventoryConfig) ExportersOrDefault() []InventoryExporterConfig {
+	if len(c.Exporters) > 0 {
+		return c.Exporters
+	}
+	return []InventoryExporterConfig{{Type: InventoryExporterFile}}
+}
+
+func (c *InventoryConfig) validate(arcEnabled bool) error {
+	if c.Interval < 0 || (c.Interval > 0 && time.Duration(c.Interval) < time.Minute) {
+		return fmt.Errorf("agent.inventory.interval must be at least 1m")
+	}
+	for i, exporter := range c.Exporters {
+		if err := exporter.validate(arcEnabled); err != nil {
+			return fmt.Errorf("invalid agent.inventory.exporters[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (e InventoryExporterConfig) validate(arcEnabled bool) error {
+	switch e.Type {
+	case InventoryExporterFile:
+		if e.Path != "" && !filepath.IsAbs(e.Path) {
+			return fmt.Errorf("path %q must be absolute", e.Path)
+		}
+	case InventoryExporterHTTP:
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url %q must be an http or https URL", e.URL)
+		}
+	case InventoryExporterArc:
+		if !arcEnabled {
+			return fmt.Errorf("the arc exporter needs azure.arc.enabled")
+		}
+	default:
+		return fmt.Errorf("type %q must be file, http, or arc", e.Type)
+	}
+	return nil
+}
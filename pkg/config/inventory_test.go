@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInventoryConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		inventory  InventoryConfig
+		arcEnabled bool
+		wantErr    string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			inventory: InventoryConfig{
+				Interval: JSONDuration(time.Hour),
+				Exporters: []InventoryExporterConfig{
+					{Type: InventoryExporterFile, Path: "/var/lib/cmdb/inventory.json"},
+					{Type: InventoryExporterHTTP, URL: "https://cmdb.example.com/api/hosts", Headers: map[string]string{"Authorization": "Bearer x"}},
+					{Type: InventoryExporterArc},
+				},
+			},
+			arcEnabled: true,
+		},
+		{
+			name:      "short interval",
+			inventory: InventoryConfig{Interval: JSONDuration(time.Second)},
+			wantErr:   "interval",
+		},
+		{
+			name:      "relative path",
+			inventory: InventoryConfig{Exporters: []InventoryExporterConfig{{Type: InventoryExporterFile, Path: "inventory.json"}}},
+			wantErr:   "exporters[0]",
+		},
+		{
+			name:      "bad url",
+			inventory: InventoryConfig{Exporters: []InventoryExporterConfig{{Type: InventoryExporterFile}, {Type: InventoryExporterHTTP, URL: "cmdb.example.com"}}},
+			wantErr:   "exporters[1]",
+		},
+		{
+			name:      "arc without arc",
+			inventory: InventoryConfig{Exporters: []InventoryExporterConfig{{Type: InventoryExporterArc}}},
+			wantErr:   "azure.arc.enabled",
+		},
+		{
+			name:      "unknown type",
+			inventory: InventoryConfig{Exporters: []InventoryExporterConfig{{Type: "syslog"}}},
+			wantErr:   "type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.inventory.validate(tt.arcEnabled)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultLocalPath is the local-path provisioner's default node path, so its
+// stock config works without changes.
+const DefaultLocalPath = "/opt/local-path-provisioner"
+
+// Node labels describing the local storage a node offers, for the
+// provisioners' node selectors.
+const (
+	LocalStorageLVMLabel       = "aks-flex-node.azure.com/local-storage-lvm"
+	LocalStorageLocalPathLabel = "aks-flex-node.azure.com/local-storage-local-path"
+)
+
+// deviceMapperControl is the device node LVM tools inside the machine need to
+// create logical volumes.
+const deviceMapperControl = "/dev/mapper/control"
+
+// volumeGroupPattern matches LVM volume group names that are also valid
+// label values.
+var volumeGroupPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+// LocalStorageConfig prepares node-local storage for a CSI-less node: an LVM
+// volume group for an LVM provisioner such as TopoLVM, or a host directory
+// for the local-path provisioner. The provisioners themselves are deployed
+// to the cluster separately.
+type LocalStorageConfig struct {
+	// LVM creates a volume group from whole disks.
+	LVM *LVMStorageConfig `json:"lvm,omitempty"`
+
+	// LocalPath exposes a host directory to the nspawn machine for the
+	// local-path provisioner.
+	LocalPath *LocalPathStorageConfig `json:"localPath,omitempty"`
+}
+
+// LVMStorageConfig is the volume group an LVM provisioner carves volumes
+// from.
+type LVMStorageConfig struct {
+	// VolumeGroup is the volume group name.
+	VolumeGroup string `json:"volumeGroup"`
+
+	// Devices are the disks the volume group is made of, preferably as
+	// stable /dev/disk/by-id paths. Disks holding a filesystem or partition
+	// table are refused.
+	Devices []string `json:"devices"`
+
+	// Prerequisites loads the device-mapper thin provisioning and snapshot
+	// modules at boot and exposes /dev/mapper/control to the nspawn machine,
+	// as the provisioner's node plugin needs.
+	Prerequisites bool `json:"prerequisites,omitempty"`
+}
+
+// LocalPathStorageConfig is the directory the local-path provisioner creates
+// volumes in.
+type LocalPathStorageConfig struct {
+	// Path is the host directory, bind-mounted at the same path into the
+	// nspawn machine. Defaults to DefaultLocalPath.
+	Path string `json:"path,omitempty"`
+}
+
+// Enabled reports whether any local storage is configured.
+func (c LocalStorageConfig) Enabled() bool {
+	return c.LVM != nil || c.LocalPath != nil
+}
+
+// NodeLabels returns the labels describing the configured local storage.
+func (c LocalStorageConfig) NodeLabels() map[string]string {
+	labels := map[string]string{}
+	if c.LVM != nil {
+		labels[LocalStorageLVMLabel] = c.LVM.VolumeGroup
+	}
+	if c.LocalPath != nil {
+		labels[LocalStorageLocalPathLabel] = "true"
+	}
+	return labels
+}
+
+func (c *Config) setLocalStorageDefaults() {
+	if c.LocalStorage.LocalPath != nil && c.LocalStorage.LocalPath.Path == "" {
+		c.LocalStorage.LocalPath.Path = DefaultLocalPath
+	}
+	if lvm := c.LocalStorage.LVM; lvm != nil && lvm.Prerequisites && !slices.Contains(c.Bootstrap.AdditionalHostDevices, deviceMapperControl) {
+		c.Bootstrap.AdditionalHostDevices = append(c.Bootstrap.AdditionalHostDevices, deviceMapperControl)
+	}
+	for key, value := range c.LocalStorage.NodeLabels() {
+		c.Node.Labels[key] = value
+	}
+}
+
+func (c *LocalStorageConfig) validate() error {
+	if lvm := c.LVM; lvm != nil {
+		if !volumeGroupPattern.MatchString(lvm.VolumeGroup) {
+			return fmt.Errorf("localStorage.lvm.volumeGroup %q must be up to 63 letters, digits, '_', '.', or '-'", lvm.VolumeGroup)
+		}
+		if len(lvm.Devices) == 0 {
+			return fmt.Errorf("localStorage.lvm.devices must list at least one disk")
+		}
+		for i, device := range lvm.Devices {
+			if !strings.HasPrefix(device, "/dev/") || filepath.Clean(device) != device {
+				return fmt.Errorf("localStorage.lvm.devices[%d] %q must be a clean path under /dev", i, device)
+			}
+			if slices.Contains(lvm.Devices[:i], device) {
+				return fmt.Errorf("localStorage.lvm.devices[%d]: duplicate device %s", i, device)
+			}
+		}
+	}
+	if lp := c.LocalPath; lp != nil && lp.Path != "" {
+		if !filepath.IsAbs(lp.Path) || filepath.Clean(lp.Path) != lp.Path || lp.Path == "/" {
+			return fmt.Errorf("localStorage.localPath.path %q must be a clean absolute directory other than /", lp.Path)
+		}
+		if strings.ContainsAny(lp.Path, ": \t\n") {
+			return fmt.Errorf("localStorage.localPath.path %q must not contain ':' or whitespace", lp.Path)
+		}
+	}
+	return nil
+}
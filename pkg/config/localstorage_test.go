@@ -0,0 +1,74 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		storage LocalStorageConfig
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			storage: LocalStorageConfig{
+				LVM:       &LVMStorageConfig{VolumeGroup: "flex-vg", Devices: []string{"/dev/disk/by-id/nvme-a", "/dev/sdc"}},
+				LocalPath: &LocalPathStorageConfig{Path: "/data/local-path"},
+			},
+		},
+		{name: "bad volume group", storage: LocalStorageConfig{LVM: &LVMStorageConfig{VolumeGroup: "-vg", Devices: []string{"/dev/sdb"}}}, wantErr: "volumeGroup"},
+		{name: "no devices", storage: LocalStorageConfig{LVM: &LVMStorageConfig{VolumeGroup: "vg"}}, wantErr: "at least one disk"},
+		{name: "device outside dev", storage: LocalStorageConfig{LVM: &LVMStorageConfig{VolumeGroup: "vg", Devices: []string{"/tmp/disk.img"}}}, wantErr: "devices[0]"},
+		{name: "duplicate device", storage: LocalStorageConfig{LVM: &LVMStorageConfig{VolumeGroup: "vg", Devices: []string{"/dev/sdb", "/dev/sdb"}}}, wantErr: "duplicate device"},
+		{name: "relative path", storage: LocalStorageConfig{LocalPath: &LocalPathStorageConfig{Path: "data"}}, wantErr: "localPath.path"},
+		{name: "root path", storage: LocalStorageConfig{LocalPath: &LocalPathStorageConfig{Path: "/"}}, wantErr: "localPath.path"},
+		{name: "path with colon", storage: LocalStorageConfig{LocalPath: &LocalPathStorageConfig{Path: "/data:/etc"}}, wantErr: "':'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.storage.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetLocalStorageDefaults(t *testing.T) {
+	t.Parallel()
+
+	c := &Config{
+		Node: NodeConfig{Labels: map[string]string{}},
+		LocalStorage: LocalStorageConfig{
+			LVM:       &LVMStorageConfig{VolumeGroup: "flex", Devices: []string{"/dev/sdb"}, Prerequisites: true},
+			LocalPath: &LocalPathStorageConfig{},
+		},
+	}
+	c.setLocalStorageDefaults()
+	c.setLocalStorageDefaults()
+
+	if c.LocalStorage.LocalPath.Path != DefaultLocalPath {
+		t.Errorf("localPath.path = %q, want %q", c.LocalStorage.LocalPath.Path, DefaultLocalPath)
+	}
+	if !slices.Equal(c.Bootstrap.AdditionalHostDevices, []string{"/dev/mapper/control"}) {
+		t.Errorf("additionalHostDevices = %v, want /dev/mapper/control once", c.Bootstrap.AdditionalHostDevices)
+	}
+	want := map[string]string{LocalStorageLVMLabel: "flex", LocalStorageLocalPathLabel: "true"}
+	if !maps.Equal(c.Node.Labels, want) {
+		t.Errorf("labels = %v, want %v", c.Node.Labels, want)
+	}
+}
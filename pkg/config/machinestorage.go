@@ -0,0 +1,25 @@
+package config
+
+import "fmt"
+
+// Machine storage backends of node.machineStorage.
+const (
+	// MachineStorageAuto uses btrfs when the machines directory is on a btrfs
+	// file system and plain directories otherwise.
+	MachineStorageAuto = "auto"
+	// MachineStorageDirectory unpacks the rootfs image into a plain directory
+	// for every machine generation.
+	MachineStorageDirectory = "directory"
+	// MachineStorageBtrfs creates every generation as a snapshot of a
+	// subvolume holding the unpacked image.
+	MachineStorageBtrfs = "btrfs"
+)
+
+func validateMachineStorage(backend string) error {
+	switch backend {
+	case "", MachineStorageAuto, MachineStorageDirectory, MachineStorageBtrfs:
+		return nil
+	}
+	return fmt.Errorf("invalid node.machineStorage: %s. Valid values are: %s, %s, %s",
+		backend, MachineStorageAuto, MachineStorageDirectory, MachineStorageBtrfs)
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const defaultMetricsTextfileInterval = 30 * time.Second
+
+// MetricsTextfileConfig configures the file the daemon writes its metrics to
+// for the node_exporter textfile collector, so sites that already scrape
+// node_exporter get them without another port.
+type MetricsTextfileConfig struct {
+	// Directory is the collector's --collector.textfile.directory. Empty
+	// writes no file.
+	Directory string `json:"directory,omitempty"`
+
+	// Interval is how often the file is rewritten.
+	Interval JSONDuration `json:"interval,omitempty"`
+}
+
+// Enabled reports whether the metrics file is written.
+func (c MetricsTextfileConfig) Enabled() bool {
+	return c.Directory != ""
+}
+
+func (c *MetricsTextfileConfig) validate() error {
+	if c.Directory != "" && !filepath.IsAbs(c.Directory) {
+		return fmt.Errorf("agent.metricsTextfile.directory must be an absolute path")
+	}
+	if c.Interval < 0 || (c.Interval > 0 && time.Duration(c.Interval) < 5*time.Second) {
+		return fmt.Errorf("agent.metricsTextfile.interval must be at least 5s")
+	}
+	return nil
+}
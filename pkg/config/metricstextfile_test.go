@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricsTextfileConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		directory string
+		interval  time.Duration
+		wantErr   bool
+	}{
+		{},
+		{directory: "/var/lib/node_exporter/textfile_collector", interval: 30 * time.Second},
+		{directory: "textfile_collector", wantErr: true},
+		{directory: "/var/lib/node_exporter/textfile_collector", interval: time.Second, wantErr: true},
+		{interval: -time.Minute, wantErr: true},
+	} {
+		c := MetricsTextfileConfig{Directory: tc.directory, Interval: JSONDuration(tc.interval)}
+		if err := c.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("validate() of %q every %s = %v, want error %v", tc.directory, tc.interval, err, tc.wantErr)
+		}
+	}
+}
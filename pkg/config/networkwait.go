@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DefaultNetworkWaitTimeout bounds how long bootstrap waits for the network
+// when bootstrap.networkWait sets no timeout.
+const DefaultNetworkWaitTimeout = 5 * time.Minute
+
+// NetworkWaitConfig holds bootstrap until DNS resolves and the endpoints the
+// first Azure-dependent steps need accept connections, for sites whose WAN
+// comes up minutes after the host boots.
+type NetworkWaitConfig struct {
+	// Disabled starts bootstrap without waiting.
+	Disabled bool `json:"disabled,omitempty"`
+	// Timeout bounds the wait; it defaults to DefaultNetworkWaitTimeout.
+	Timeout JSONDuration `json:"timeout,omitempty"`
+	// Endpoints are further host:port pairs that must accept connections,
+	// such as a site proxy or artifact mirror.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// DeferOnTimeout installs the agent service instead of failing when the
+	// network is still unavailable at the timeout. The daemon then keeps
+	// waiting and finishes the bootstrap once the endpoints are reachable.
+	DeferOnTimeout bool `json:"deferOnTimeout,omitempty"`
+}
+
+// TimeoutOrDefault returns Timeout, or DefaultNetworkWaitTimeout when unset.
+func (c NetworkWaitConfig) TimeoutOrDefault() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout)
+	}
+	return DefaultNetworkWaitTimeout
+}
+
+func (c *NetworkWaitConfig) validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("bootstrap.networkWait.timeout must not be negative")
+	}
+	for i, endpoint := range c.Endpoints {
+		host, port, err := net.SplitHostPort(endpoint)
+		if err != nil || host == "" {
+			return fmt.Errorf("invalid bootstrap.networkWait.endpoints[%d] %q: must be host:port", i, endpoint)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid bootstrap.networkWait.endpoints[%d] %q: invalid port", i, endpoint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetworkWaitConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		wait    NetworkWaitConfig
+		wantErr string
+	}{
+		{name: "empty"},
+		{name: "valid", wait: NetworkWaitConfig{Timeout: JSONDuration(time.Minute), Endpoints: []string{"proxy.contoso.com:3128", "[fd00::1]:443"}}},
+		{name: "negative timeout", wait: NetworkWaitConfig{Timeout: JSONDuration(-time.Second)}, wantErr: "timeout"},
+		{name: "missing port", wait: NetworkWaitConfig{Endpoints: []string{"proxy.contoso.com"}}, wantErr: "endpoints[0]"},
+		{name: "bad port", wait: NetworkWaitConfig{Endpoints: []string{"a:443", "b:99999"}}, wantErr: "endpoints[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.wait.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNetworkWaitConfigTimeoutOrDefault(t *testing.T) {
+	t.Parallel()
+
+	if got := (NetworkWaitConfig{}).TimeoutOrDefault(); got != DefaultNetworkWaitTimeout {
+		t.Errorf("TimeoutOrDefault() = %v, want %v", got, DefaultNetworkWaitTimeout)
+	}
+	if got := (NetworkWaitConfig{Timeout: JSONDuration(time.Hour)}).TimeoutOrDefault(); got != time.Hour {
+		t.Errorf("TimeoutOrDefault() = %v, want 1h", got)
+	}
+}
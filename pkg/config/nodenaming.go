@@ -0,0 +1,298 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// Node naming strategies of agent.nodeNaming.strategy.
+const (
+	// NodeNamingHostname names the node after the host hostname.
+	NodeNamingHostname = "hostname"
+	// NodeNamingPrefixSerial names the node <prefix>-<hardware serial>.
+	NodeNamingPrefixSerial = "prefix-serial"
+	// NodeNamingExplicit uses agent.nodeName.
+	NodeNamingExplicit = "explicit"
+	// NodeNamingStableID names the node <prefix>-<random ID>, with the ID
+	// generated once and kept in the instance's state directory.
+	NodeNamingStableID = "stable-id"
+)
+
+// Collision handling of agent.nodeNaming.onCollision.
+const (
+	// NodeNameCollisionFail fails bootstrap when another host's Node has
+	// the name.
+	NodeNameCollisionFail = "fail"
+	// NodeNameCollisionSuffix appends a short hash of the host's system UUID
+	// to a derived name that another host's Node has.
+	NodeNameCollisionSuffix = "suffix"
+)
+
+const (
+	defaultNodeNamePrefix = "flex"
+	nodeIDFileName        = "node-id"
+	nodeNameClaimFileName = "node-name.json"
+	nodeIDBytes           = 5
+)
+
+// serialPaths are read in order for the hardware serial number: the DMI
+// system and board serials on x86 and the device-tree serial on Arm boards.
+var serialPaths = []string{
+	"/sys/class/dmi/id/product_serial",
+	"/sys/class/dmi/id/board_serial",
+	"/proc/device-tree/serial-number",
+}
+
+// placeholderSerials are the values firmware reports when the vendor left the
+// serial number unset.
+var placeholderSerials = map[string]bool{
+	"":                       true,
+	"0":                      true,
+	"none":                   true,
+	"not specified":          true,
+	"default string":         true,
+	"to be filled by o.e.m.": true,
+	"system serial number":   true,
+	"0123456789":             true,
+}
+
+// NodeNamingConfig selects how the Kubernetes Node name is derived when
+// agent.nodeName is omitted. The name is also the kubelet's hostname
+// override and, unless azure.arc.machineName is set, the Arc resource name.
+type NodeNamingConfig struct {
+	// Strategy is hostname (the default), prefix-serial, explicit, or
+	// stable-id.
+	Strategy string `json:"strategy,omitempty"`
+
+	// Prefix starts prefix-serial and stable-id names. Defaults to flex.
+	Prefix string `json:"prefix,omitempty"`
+
+	// OnCollision is fail (the default) or suffix. It applies when bootstrap
+	// finds a Node of the name that another host registered.
+	OnCollision string `json:"onCollision,omitempty"`
+}
+
+func (c *NodeNamingConfig) validate(nodeName string) error {
+	switch c.Strategy {
+	case "", NodeNamingHostname, NodeNamingPrefixSerial, NodeNamingStableID:
+		if c.Strategy != "" && nodeName != "" {
+			return fmt.Errorf("agent.nodeName cannot be combined with agent.nodeNaming.strategy %s", c.Strategy)
+		}
+	case NodeNamingExplicit:
+		if nodeName == "" {
+			return fmt.Errorf("agent.nodeName is required when agent.nodeNaming.strategy is explicit")
+		}
+	default:
+		return fmt.Errorf("agent.nodeNaming.strategy must be one of hostname, prefix-serial, explicit, or stable-id")
+	}
+	if c.Prefix != "" {
+		if errs := validation.IsDNS1123Label(c.Prefix); len(errs) > 0 {
+			return fmt.Errorf("agent.nodeNaming.prefix %q is not a valid DNS label: %s", c.Prefix, strings.Join(errs, "; "))
+		}
+	}
+	switch c.OnCollision {
+	case "", NodeNameCollisionFail, NodeNameCollisionSuffix:
+	default:
+		return fmt.Errorf("agent.nodeNaming.onCollision must be fail or suffix")
+	}
+	return nil
+}
+
+func (c *NodeNamingConfig) prefix() string {
+	if c.Prefix == "" {
+		return defaultNodeNamePrefix
+	}
+	return c.Prefix
+}
+
+// SuffixesCollisions reports whether a collision renames the node rather than
+// failing bootstrap. An explicit agent.nodeName is never renamed.
+func (c *NodeNamingConfig) SuffixesCollisions(explicit bool) bool {
+	return c.OnCollision == NodeNameCollisionSuffix && !explicit
+}
+
+// nodeNameSources are the host facts node names are derived from.
+type nodeNameSources struct {
+	hostname func() (string, error)
+	serial   func() string
+	stateDir string
+}
+
+func hostNodeNameSources(instance Instance) nodeNameSources {
+	return nodeNameSources{hostname: os.Hostname, serial: hostSerial, stateDir: instance.StateDir()}
+}
+
+// hostSerial returns the first hardware serial number the firmware reports.
+func hostSerial() string {
+	for _, path := range serialPaths {
+		if serial := deviceprofile.ReadFirmwareString(path); !placeholderSerials[strings.ToLower(serial)] {
+			return serial
+		}
+	}
+	return ""
+}
+
+// deriveNodeName returns the node name of the configured strategy, without
+// the instance suffix. A stable ID generated for the name is returned too,
+// for bootstrap to persist; it is nil when the ID was already on disk.
+func (c *NodeNamingConfig) deriveNodeName(sources nodeNameSources) (string, *pendingNodeID, error) {
+	switch c.Strategy {
+	case NodeNamingPrefixSerial:
+		serial := nodeNameToken(sources.serial())
+		if serial == "" {
+			return "", nil, fmt.Errorf("the host reports no hardware serial number; use agent.nodeNaming.strategy stable-id or set agent.nodeName")
+		}
+		return c.prefix() + "-" + serial, nil, nil
+	case NodeNamingStableID:
+		path := filepath.Join(sources.stateDir, nodeIDFileName)
+		id, err := loadNodeID(path)
+		if err != nil {
+			return "", nil, err
+		}
+		var pending *pendingNodeID
+		if id == "" {
+			if id, err = newNodeID(); err != nil {
+				return "", nil, err
+			}
+			pending = &pendingNodeID{path: path, id: id}
+		}
+		return c.prefix() + "-" + id, pending, nil
+	default:
+		hostname, err := sources.hostname()
+		if err != nil {
+			return "", nil, fmt.Errorf("get host hostname for node name: %w", err)
+		}
+		hostname = strings.ToLower(strings.TrimSpace(hostname))
+		if hostname == "" {
+			return "", nil, fmt.Errorf("host hostname is empty")
+		}
+		return hostname, nil, nil
+	}
+}
+
+// nodeNameToken lowercases s and replaces every run of characters that are
+// not allowed in a DNS label with a dash.
+func nodeNameToken(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// pendingNodeID is a stable ID generated while the config was loaded and not
+// yet written to the instance state directory.
+type pendingNodeID struct {
+	path string
+	id   string
+}
+
+// loadNodeID returns the stable ID kept at path, or "" before bootstrap
+// persisted one. The ID outlives hostname changes and is removed with the
+// instance's state on reset.
+func loadNodeID(path string) (string, error) {
+	data, err := os.ReadFile(path) //#nosec G304 -- path is under the instance state directory
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read stable node ID: %w", err)
+	}
+	id := strings.TrimSpace(string(data))
+	if errs := validation.IsDNS1123Label(id); len(errs) > 0 {
+		return "", fmt.Errorf("stable node ID in %s is invalid: %s", path, strings.Join(errs, "; "))
+	}
+	return id, nil
+}
+
+func newNodeID() (string, error) {
+	buf := make([]byte, nodeIDBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate stable node ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// PersistNodeID writes the stable node ID that loading the config generated,
+// so later loads resolve the same node name. Loading the config never writes
+// it: read-only commands and runs without root must not create agent state.
+// Bootstrap calls this before it registers the node; it does nothing when the
+// ID was already on disk or the strategy is not stable-id.
+func (cfg *Config) PersistNodeID() error {
+	pending := cfg.nodeID
+	if pending == nil {
+		return nil
+	}
+	if err := utilio.WriteFile(pending.path, []byte(pending.id+"\n"), 0o644); err != nil { //nolint:gosec // the node name is not a secret
+		return fmt.Errorf("persist stable node ID: %w", err)
+	}
+	cfg.nodeID = nil
+	return nil
+}
+
+// NodeNameClaim records the name bootstrap registered the node under when
+// the derived name was taken by another host, so later loads of the config
+// resolve the same name.
+type NodeNameClaim struct {
+	// Derived is the name the naming strategy produced.
+	Derived string `json:"derived"`
+	// Name is the name the node registered under.
+	Name string `json:"name"`
+}
+
+// NodeNameClaimPath is where the instance's node name claim is kept.
+func (i Instance) NodeNameClaimPath() string {
+	return filepath.Join(i.StateDir(), nodeNameClaimFileName)
+}
+
+// SaveNodeNameClaim persists claim for the instance.
+func SaveNodeNameClaim(instance Instance, claim NodeNameClaim) error {
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return fmt.Errorf("marshal node name claim: %w", err)
+	}
+	if err := utilio.WriteFile(instance.NodeNameClaimPath(), append(data, '\n'), 0o644); err != nil { //nolint:gosec // the node name is not a secret
+		return fmt.Errorf("write node name claim: %w", err)
+	}
+	return nil
+}
+
+// claimedNodeName returns the claimed name for derived, or derived itself
+// when bootstrap has not claimed another name for it.
+func claimedNodeName(stateDir, derived string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir, nodeNameClaimFileName)) //#nosec G304 -- path is under the instance state directory
+	if errors.Is(err, os.ErrNotExist) {
+		return derived, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read node name claim: %w", err)
+	}
+	var claim NodeNameClaim
+	if err := json.Unmarshal(data, &claim); err != nil {
+		return "", fmt.Errorf("parse node name claim: %w", err)
+	}
+	// A claim for another derived name is stale: the strategy or the host
+	// changed since bootstrap.
+	if claim.Derived != derived || claim.Name == "" {
+		return derived, nil
+	}
+	return claim.Name, nil
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testNodeNameSources(t *testing.T) nodeNameSources {
+	t.Helper()
+	return nodeNameSources{
+		hostname: func() (string, error) { return "GSinha-P14s", nil },
+		serial:   func() string { return "PF-3X 9QZ/01" },
+		stateDir: t.TempDir(),
+	}
+}
+
+func TestResolveNodeNameStrategies(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		agent    AgentConfig
+		instance Instance
+		want     string
+		wantErr  string
+	}{
+		{name: "hostname by default", want: "gsinha-p14s"},
+		{name: "hostname with instance", agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingHostname}}, instance: "gpu0", want: "gsinha-p14s-gpu0"},
+		{name: "prefix and serial", agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingPrefixSerial, Prefix: "store42"}}, want: "store42-pf-3x-9qz-01"},
+		{name: "serial with default prefix", agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingPrefixSerial}}, want: "flex-pf-3x-9qz-01"},
+		{name: "explicit", agent: AgentConfig{NodeName: "edge-01", NodeNaming: NodeNamingConfig{Strategy: NodeNamingExplicit}}, want: "edge-01"},
+		{name: "explicit without name", agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingExplicit}}, wantErr: "agent.nodeName is required"},
+		{name: "name with derived strategy", agent: AgentConfig{NodeName: "edge-01", NodeNaming: NodeNamingConfig{Strategy: NodeNamingStableID}}, wantErr: "cannot be combined"},
+		{name: "unknown strategy", agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: "uuid"}}, wantErr: "agent.nodeNaming.strategy must be"},
+		{name: "invalid prefix", agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingStableID, Prefix: "Store_42"}}, wantErr: "agent.nodeNaming.prefix"},
+		{name: "unknown collision handling", agent: AgentConfig{NodeNaming: NodeNamingConfig{OnCollision: "rename"}}, wantErr: "agent.nodeNaming.onCollision"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &Config{Instance: tc.instance, Agent: tc.agent}
+			got, err := cfg.resolveNodeNameFrom(testNodeNameSources(t))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("resolveNodeNameFrom() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want || cfg.Agent.NodeName != tc.want {
+				t.Fatalf("resolveNodeNameFrom() = %q, %v (cfg %q), want %q", got, err, cfg.Agent.NodeName, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveNodeNameWithoutSerial(t *testing.T) {
+	t.Parallel()
+
+	sources := testNodeNameSources(t)
+	sources.serial = func() string { return "" }
+	cfg := &Config{Agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingPrefixSerial}}}
+	if _, err := cfg.resolveNodeNameFrom(sources); err == nil || !strings.Contains(err.Error(), "no hardware serial number") {
+		t.Fatalf("resolveNodeNameFrom() error = %v, want missing serial", err)
+	}
+}
+
+func TestResolveNodeNameStableID(t *testing.T) {
+	t.Parallel()
+
+	sources := testNodeNameSources(t)
+	idPath := filepath.Join(sources.stateDir, nodeIDFileName)
+	resolve := func() (*Config, string) {
+		cfg := &Config{Agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingStableID, Prefix: "edge"}}}
+		name, err := cfg.resolveNodeNameFrom(sources)
+		if err != nil {
+			t.Fatalf("resolveNodeNameFrom: %v", err)
+		}
+		return cfg, name
+	}
+	cfg, first := resolve()
+	if !strings.HasPrefix(first, "edge-") || len(first) != len("edge-")+2*nodeIDBytes {
+		t.Fatalf("stable-id name = %q", first)
+	}
+	// Loading the config does not write agent state; bootstrap does.
+	if _, err := os.Stat(idPath); !os.IsNotExist(err) {
+		t.Fatalf("stat %s before PersistNodeID = %v, want not exist", idPath, err)
+	}
+	if err := cfg.PersistNodeID(); err != nil {
+		t.Fatalf("PersistNodeID: %v", err)
+	}
+	// The ID survives a hostname change.
+	sources.hostname = func() (string, error) { return "renamed", nil }
+	cfg, second := resolve()
+	if second != first {
+		t.Fatalf("stable-id name changed from %q to %q", first, second)
+	}
+	if cfg.nodeID != nil {
+		t.Fatalf("nodeID = %+v after loading a persisted ID, want nil", cfg.nodeID)
+	}
+
+	if err := os.WriteFile(idPath, []byte("Not_An_ID\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{Agent: AgentConfig{NodeNaming: NodeNamingConfig{Strategy: NodeNamingStableID}}}
+	if _, err := cfg.resolveNodeNameFrom(sources); err == nil {
+		t.Fatal("resolveNodeNameFrom() with a corrupt ID succeeded")
+	}
+}
+
+func TestResolveNodeNameClaim(t *testing.T) {
+	t.Parallel()
+
+	sources := testNodeNameSources(t)
+	claim := []byte(`{"derived":"gsinha-p14s","name":"gsinha-p14s-1a2b3c"}`)
+	if err := os.WriteFile(filepath.Join(sources.stateDir, nodeNameClaimFileName), claim, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	if got, err := cfg.resolveNodeNameFrom(sources); err != nil || got != "gsinha-p14s-1a2b3c" {
+		t.Fatalf("resolveNodeNameFrom() = %q, %v, want the claimed name", got, err)
+	}
+
+	// A claim for another derived name no longer applies.
+	sources.hostname = func() (string, error) { return "renamed", nil }
+	cfg = &Config{}
+	if got, err := cfg.resolveNodeNameFrom(sources); err != nil || got != "renamed" {
+		t.Fatalf("resolveNodeNameFrom() = %q, %v, want renamed", got, err)
+	}
+}
+
+func TestNodeNameToken(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]string{
+		"ABC123":        "abc123",
+		" PF-3X 9QZ/01": "pf-3x-9qz-01",
+		"--x__y--":      "x-y",
+		"///":           "",
+	} {
+		if got := nodeNameToken(in); got != want {
+			t.Errorf("nodeNameToken(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
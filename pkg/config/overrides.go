@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// redactedValue replaces secrets in Redacted.
+const redactedValue = "REDACTED"
+
+// Overrides are config values set outside the config file, by command-line
+// flags or environment variables, keyed by their dotted JSON path such as
+// "agent.disruption.maxDisruption". They apply over the file and its
+// instance section and are validated with them.
+type Overrides map[string]any
+
+// apply merges the overrides into the JSON config document data and records
+// them in origins.
+func (o Overrides) apply(data []byte, origins Origins) ([]byte, error) {
+	if len(o) == 0 {
+		return data, nil
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	}
+	patch := map[string]any{}
+	for path, value := range o {
+		keys := strings.Split(path, ".")
+		node := patch
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+	}
+	origins.record(OriginOverrides, "", patch)
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return nil, fmt.Errorf("apply config overrides: %w", err)
+	}
+	return merged, nil
+}
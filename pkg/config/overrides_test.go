@@ -0,0 +1,51 @@
+package config
+
+import "testing"
+
+func TestLoadInstanceConfigWithOverrides(t *testing.T) {
+	t.Parallel()
+
+	path := writeTestConfig(t, testInstancesConfig)
+
+	cfg, err := LoadInstanceConfigWithOverrides(path, "gpu0", Overrides{
+		"agent.logLevel":                 "debug",
+		"agent.disruption.maxDisruption": "kubelet",
+		"azure.targetAgentPoolName":      "override",
+	})
+	if err != nil {
+		t.Fatalf("LoadInstanceConfigWithOverrides() unexpected error: %v", err)
+	}
+	if cfg.Agent.LogLevel != "debug" || cfg.Agent.Disruption.MaxDisruption != "kubelet" {
+		t.Fatalf("agent = %q/%q, want debug/kubelet", cfg.Agent.LogLevel, cfg.Agent.Disruption.MaxDisruption)
+	}
+	// Overrides apply over the instance section too.
+	if cfg.Azure.TargetAgentPoolName != "override" {
+		t.Fatalf("TargetAgentPoolName = %q, want override", cfg.Azure.TargetAgentPoolName)
+	}
+	if cfg.Node.Kubelet.Port != 10260 || cfg.Node.Kubelet.ClusterFQDN == "" {
+		t.Fatal("overrides dropped settings they do not name")
+	}
+
+	if _, err := LoadInstanceConfigWithOverrides(path, "", Overrides{"agent.disruption.maxDisruption": "host"}); err == nil {
+		t.Fatal("LoadInstanceConfigWithOverrides() accepted an invalid override")
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Azure: AzureConfig{
+		ServicePrincipal: &ServicePrincipalConfig{TenantID: "tenant", ClientSecret: "secret"},
+		BootstrapToken:   &BootstrapTokenConfig{Token: "abcdef.0123456789abcdef"},
+	}}
+	out := cfg.Redacted()
+	if out.Azure.ServicePrincipal.ClientSecret != redactedValue || out.Azure.BootstrapToken.Token != redactedValue {
+		t.Fatalf("Redacted() kept secrets: %+v, %+v", out.Azure.ServicePrincipal, out.Azure.BootstrapToken)
+	}
+	if out.Azure.ServicePrincipal.TenantID != "tenant" {
+		t.Fatal("Redacted() dropped a non-secret field")
+	}
+	if cfg.Azure.ServicePrincipal.ClientSecret != "secret" {
+		t.Fatal("Redacted() modified the original config")
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// cpuListPattern matches kernel CPU lists such as "2-7,10".
+var cpuListPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+// Hugepage sizes, as the kubelet names the hugepages-<size> resources.
+const (
+	HugePageSize2Mi = "2Mi"
+	HugePageSize1Gi = "1Gi"
+)
+
+// PerformanceConfig is a performance profile for latency-sensitive workloads
+// such as telco network functions: hugepages and CPU isolation on the kernel
+// command line, and the kubelet CPU and topology manager policies that hand
+// the isolated CPUs to pods.
+type PerformanceConfig struct {
+	// HugePages are allocated by the kernel at boot.
+	HugePages []HugePagesConfig `json:"hugePages,omitempty"`
+
+	// IsolatedCPUs is a CPU list, such as "2-15", taken away from the
+	// kernel scheduler, timer ticks, and RCU callbacks with isolcpus,
+	// nohz_full, and rcu_nocbs.
+	IsolatedCPUs string `json:"isolatedCPUs,omitempty"`
+
+	// ReservedCPUs is a CPU list the kubelet keeps for system daemons and
+	// never hands to pods, passed as --reserved-cpus.
+	ReservedCPUs string `json:"reservedCPUs,omitempty"`
+
+	// RealTimeKernel requires the host to run a PREEMPT_RT kernel.
+	RealTimeKernel bool `json:"realTimeKernel,omitempty"`
+
+	// KernelArgs are further kernel command line arguments, such as
+	// "intel_pstate=disable".
+	KernelArgs []string `json:"kernelArgs,omitempty"`
+
+	// CPUManagerPolicy is the kubelet CPU manager policy, "none" or
+	// "static".
+	CPUManagerPolicy string `json:"cpuManagerPolicy,omitempty"`
+
+	// TopologyManagerPolicy is the kubelet topology manager policy: "none",
+	// "best-effort", "restricted", or "single-numa-node".
+	TopologyManagerPolicy string `json:"topologyManagerPolicy,omitempty"`
+
+	// TopologyManagerScope is "container" or "pod".
+	TopologyManagerScope string `json:"topologyManagerScope,omitempty"`
+}
+
+// HugePagesConfig is a number of hugepages of one size.
+type HugePagesConfig struct {
+	// Size is "2Mi" or "1Gi".
+	Size string `json:"size"`
+	// Count is the number of pages allocated at boot.
+	Count int `json:"count"`
+}
+
+// Enabled reports whether the profile changes anything.
+func (c PerformanceConfig) Enabled() bool {
+	return len(c.HugePages) > 0 || c.IsolatedCPUs != "" || c.ReservedCPUs != "" || c.RealTimeKernel ||
+		len(c.KernelArgs) > 0 || c.CPUManagerPolicy != "" || c.TopologyManagerPolicy != "" || c.TopologyManagerScope != ""
+}
+
+func (c *PerformanceConfig) validate() error {
+	var sizes []string
+	for i, pages := range c.HugePages {
+		if pages.Size != HugePageSize2Mi && pages.Size != HugePageSize1Gi {
+			return fmt.Errorf("performance.hugePages[%d].size must be %s or %s", i, HugePageSize2Mi, HugePageSize1Gi)
+		}
+		if slices.Contains(sizes, pages.Size) {
+			return fmt.Errorf("performance.hugePages[%d]: duplicate size %s", i, pages.Size)
+		}
+		sizes = append(sizes, pages.Size)
+		if pages.Count <= 0 {
+			return fmt.Errorf("performance.hugePages[%d].count must be positive", i)
+		}
+	}
+	for field, list := range map[string]string{"isolatedCPUs": c.IsolatedCPUs, "reservedCPUs": c.ReservedCPUs} {
+		if list != "" && !cpuListPattern.MatchString(list) {
+			return fmt.Errorf("performance.%s %q must be a CPU list such as 2-7,10", field, list)
+		}
+	}
+	for i, arg := range c.KernelArgs {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+			return fmt.Errorf("performance.kernelArgs[%d] %q must be a single argument without spaces or quotes", i, arg)
+		}
+	}
+	switch c.CPUManagerPolicy {
+	case "", "none":
+	case "static":
+		// The static policy refuses to start without CPUs reserved for
+		// system daemons.
+		if c.ReservedCPUs == "" {
+			return fmt.Errorf("performance.cpuManagerPolicy static needs performance.reservedCPUs")
+		}
+	default:
+		return fmt.Errorf("performance.cpuManagerPolicy must be none or static")
+	}
+	switch c.TopologyManagerPolicy {
+	case "", "none", "best-effort", "restricted", "single-numa-node":
+	default:
+		return fmt.Errorf("performance.topologyManagerPolicy must be none, best-effort, restricted, or single-numa-node")
+	}
+	switch c.TopologyManagerScope {
+	case "", "container", "pod":
+	default:
+		return fmt.Errorf("performance.topologyManagerScope must be container or pod")
+	}
+	return nil
+}
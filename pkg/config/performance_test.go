@@ -0,0 +1,85 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPerformanceConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		performance PerformanceConfig
+		wantErr     string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			performance: PerformanceConfig{
+				HugePages:             []HugePagesConfig{{Size: HugePageSize1Gi, Count: 8}, {Size: HugePageSize2Mi, Count: 512}},
+				IsolatedCPUs:          "2-15",
+				ReservedCPUs:          "0-1",
+				KernelArgs:            []string{"intel_pstate=disable"},
+				CPUManagerPolicy:      "static",
+				TopologyManagerPolicy: "single-numa-node",
+				TopologyManagerScope:  "pod",
+			},
+		},
+		{
+			name:        "bad hugepage size",
+			performance: PerformanceConfig{HugePages: []HugePagesConfig{{Size: "4Ki", Count: 1}}},
+			wantErr:     "hugePages[0].size",
+		},
+		{
+			name:        "duplicate hugepage size",
+			performance: PerformanceConfig{HugePages: []HugePagesConfig{{Size: HugePageSize2Mi, Count: 1}, {Size: HugePageSize2Mi, Count: 2}}},
+			wantErr:     "duplicate size",
+		},
+		{
+			name:        "no hugepages",
+			performance: PerformanceConfig{HugePages: []HugePagesConfig{{Size: HugePageSize2Mi}}},
+			wantErr:     "count must be positive",
+		},
+		{
+			name:        "bad CPU list",
+			performance: PerformanceConfig{IsolatedCPUs: "2-"},
+			wantErr:     "isolatedCPUs",
+		},
+		{
+			name:        "kernel arg with space",
+			performance: PerformanceConfig{KernelArgs: []string{"quiet splash"}},
+			wantErr:     "kernelArgs[0]",
+		},
+		{
+			name:        "static without reserved CPUs",
+			performance: PerformanceConfig{CPUManagerPolicy: "static"},
+			wantErr:     "reservedCPUs",
+		},
+		{
+			name:        "bad topology policy",
+			performance: PerformanceConfig{TopologyManagerPolicy: "strict"},
+			wantErr:     "topologyManagerPolicy",
+		},
+		{
+			name:        "bad topology scope",
+			performance: PerformanceConfig{TopologyManagerScope: "node"},
+			wantErr:     "topologyManagerScope",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.performance.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// PowerConfig schedules the node to sleep overnight, for sites that power
+// down outside business hours. While asleep the node is cordoned and
+// drained, its kubelet and containerd are stopped, and the host is
+// optionally suspended until an RTC alarm wakes it.
+type PowerConfig struct {
+	// Sleep is the daily time range such as "22:00-06:00" in which the node
+	// sleeps. It may wrap past midnight. Empty disables the schedule.
+	Sleep string `json:"sleep,omitempty"`
+
+	// TimeZone is the IANA time zone Sleep is in, such as
+	// "America/Chicago". It defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Suspend suspends the host to RAM once the node is asleep, with an RTC
+	// alarm set for the end of Sleep. Without it the host stays up in a
+	// low-power idle with no workloads.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// DrainTimeout bounds how long going to sleep retries evictions blocked
+	// by PodDisruptionBudgets. Zero selects the maintenance default.
+	DrainTimeout JSONDuration `json:"drainTimeout,omitempty"`
+}
+
+// Enabled reports whether a sleep schedule is configured.
+func (c PowerConfig) Enabled() bool {
+	return c.Sleep != ""
+}
+
+// Asleep reports whether t falls in the sleep range and how long until the
+// next transition: the end of the range when asleep, its start otherwise.
+// It returns false and zero without a schedule.
+func (c PowerConfig) Asleep(t time.Time) (asleep bool, next time.Duration) {
+	if !c.Enabled() {
+		return false, 0
+	}
+	start, end, err := parseDailyWindow(c.Sleep)
+	if err != nil {
+		return false, 0
+	}
+	loc, err := c.location()
+	if err != nil {
+		return false, 0
+	}
+	t = t.In(loc)
+	// Offsets are wall-clock times, so a DST change does not shift the
+	// schedule by an hour.
+	at := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	asleep = inDailyWindow(at, start, end)
+	target := start
+	if asleep {
+		target = end
+	}
+	next = target - at
+	if next <= 0 {
+		next += 24 * time.Hour
+	}
+	return asleep, next
+}
+
+func (c PowerConfig) location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
+func (c *PowerConfig) validate() error {
+	if !c.Enabled() {
+		if c.Suspend || c.TimeZone != "" {
+			return fmt.Errorf("agent.power.suspend and agent.power.timeZone require agent.power.sleep")
+		}
+		return nil
+	}
+	if _, _, err := parseDailyWindow(c.Sleep); err != nil {
+		return fmt.Errorf("invalid agent.power.sleep %q: %w", c.Sleep, err)
+	}
+	if _, err := c.location(); err != nil {
+		return fmt.Errorf("invalid agent.power.timeZone %q: %w", c.TimeZone, err)
+	}
+	if c.DrainTimeout < 0 {
+		return fmt.Errorf("agent.power.drainTimeout must be non-negative")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPowerConfigAsleep(t *testing.T) {
+	t.Parallel()
+
+	cfg := PowerConfig{Sleep: "22:00-06:00", TimeZone: "America/Chicago"}
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	day := time.Date(2026, 3, 4, 0, 0, 0, 0, chicago)
+	tests := []struct {
+		at         time.Duration
+		wantAsleep bool
+		wantNext   time.Duration
+	}{
+		{at: 23 * time.Hour, wantAsleep: true, wantNext: 7 * time.Hour},
+		{at: 2 * time.Hour, wantAsleep: true, wantNext: 4 * time.Hour},
+		{at: 6 * time.Hour, wantNext: 16 * time.Hour},
+		{at: 21*time.Hour + 30*time.Minute, wantNext: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		asleep, next := cfg.Asleep(day.Add(tt.at).UTC())
+		if asleep != tt.wantAsleep || next != tt.wantNext {
+			t.Errorf("at %s: Asleep() = %v, %s, want %v, %s", tt.at, asleep, next, tt.wantAsleep, tt.wantNext)
+		}
+	}
+
+	if asleep, next := (PowerConfig{}).Asleep(day); asleep || next != 0 {
+		t.Errorf("no schedule: Asleep() = %v, %s, want false, 0", asleep, next)
+	}
+}
+
+func TestPowerConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     PowerConfig
+		wantErr bool
+	}{
+		{name: "empty", cfg: PowerConfig{}},
+		{name: "valid", cfg: PowerConfig{Sleep: "22:00-06:00", TimeZone: "UTC", Suspend: true}},
+		{name: "suspend without schedule", cfg: PowerConfig{Suspend: true}, wantErr: true},
+		{name: "bad range", cfg: PowerConfig{Sleep: "22:00"}, wantErr: true},
+		{name: "unknown time zone", cfg: PowerConfig{Sleep: "22:00-06:00", TimeZone: "Mars/Olympus"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// profilesKey lists the profiles a config file or profile builds on.
+	profilesKey = "profiles"
+
+	// OriginOverrides is the origin of values set by a flag or an
+	// environment variable.
+	OriginOverrides = "flag or environment"
+)
+
+// Origins maps the dotted JSON path of every value in the merged config
+// document, such as "node.labels.team", to the layer that set it: a profile
+// or config file path, an instances.<name> section, or OriginOverrides.
+// Values the agent defaults have no origin.
+type Origins map[string]string
+
+// record notes layer as the origin of every value patch sets. Objects merge,
+// so values an earlier layer set beside them keep their origin; any other
+// value replaces the path and everything under it, and null removes it.
+func (o Origins) record(layer, prefix string, patch map[string]any) {
+	if o == nil {
+		return
+	}
+	for key, value := range patch {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if object, ok := value.(map[string]any); ok {
+			delete(o, path)
+			o.record(layer, path, object)
+			continue
+		}
+		for p := range o {
+			if p == path || strings.HasPrefix(p, path+".") {
+				delete(o, p)
+			}
+		}
+		if value != nil {
+			o[path] = layer
+		}
+	}
+}
+
+// drop removes the origins of the document sections that never reach the
+// config, such as the instances section.
+func (o Origins) drop(key string) {
+	for p := range o {
+		if p == key || strings.HasPrefix(p, key+".") {
+			delete(o, p)
+		}
+	}
+}
+
+// configLayer is one document merged into the config, named by its path.
+type configLayer struct {
+	name  string
+	patch map[string]any
+}
+
+// applyProfiles returns the config document with the profiles it lists merged
+// under it. "profiles" lists profile files, relative to the file that lists
+// them or absolute, each a JSON merge patch (RFC 7386) like the config file.
+// They apply in the order listed, so a later profile wins over an earlier
+// one, and the config file applies last and wins over all of them. A profile
+// may list profiles of its own, which apply just before it. A file without
+// profiles is returned unchanged.
+func applyProfiles(path string, data []byte, origins Origins) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	}
+	if _, ok := doc[profilesKey]; !ok {
+		origins.record(path, "", doc)
+		return data, nil
+	}
+	layers, err := profileLayers(path, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	var merged any = map[string]any{}
+	for _, layer := range layers {
+		merged = mergePatch(merged, layer.patch)
+		origins.record(layer.name, "", layer.patch)
+	}
+	return json.Marshal(merged)
+}
+
+// profileLayers returns the layers of the document at path in the order they
+// apply: the layers of each profile it lists, then the document itself.
+// chain holds the files that led to path, so a cycle is reported instead of
+// followed.
+func profileLayers(path string, doc map[string]any, chain []string) ([]configLayer, error) {
+	chain = append(chain, path)
+	names, err := profileNames(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	delete(doc, profilesKey)
+	var layers []configLayer
+	for _, name := range names {
+		profile := name
+		if !filepath.IsAbs(profile) {
+			profile = filepath.Join(filepath.Dir(path), profile)
+		}
+		profile = filepath.Clean(profile)
+		if slices.Contains(chain, profile) {
+			return nil, fmt.Errorf("profile %s includes itself through %s", profile, strings.Join(chain, " -> "))
+		}
+		data, err := os.ReadFile(profile)
+		if err != nil {
+			return nil, fmt.Errorf("read profile %s listed in %s: %w", name, path, err)
+		}
+		var profileDoc map[string]any
+		if err := json.Unmarshal(data, &profileDoc); err != nil {
+			return nil, fmt.Errorf("parse profile %s: %w", profile, err)
+		}
+		profileLayers, err := profileLayers(profile, profileDoc, chain)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, profileLayers...)
+	}
+	return append(layers, configLayer{name: path, patch: doc}), nil
+}
+
+func profileNames(doc map[string]any) ([]string, error) {
+	value, ok := doc[profilesKey]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of profile file paths", profilesKey)
+	}
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		name, ok := item.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s must be a list of profile file paths, found %v", profilesKey, item)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testBaseProfile = `{
+	"azure": {
+		"targetAgentPoolName": "pool1",
+		"bootstrapToken": {"token": "abcdef.0123456789abcdef"},
+		"targetCluster": {
+			"resourceId": "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.ContainerService/managedClusters/test-cluster"
+		}
+	},
+	"components": {"kubernetes": "1.29.0"},
+	"node": {
+		"maxPods": 50,
+		"labels": {"fleet": "stores", "tier": "edge"},
+		"kubelet": {
+			"clusterFQDN": "test-cluster-dns-12345678.hcp.eastus.azmk8s.io",
+			"caCertData": "LS0tLS1CRUdJTi1DRVJUSUZJQ0FURS0tLS0t"
+		}
+	}
+}`
+
+func writeProfileFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("os.WriteFile: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestLoadConfigWithProfiles(t *testing.T) {
+	t.Parallel()
+
+	dir := writeProfileFiles(t, map[string]string{
+		"profiles/base.json": testBaseProfile,
+		"profiles/east.json": `{"profiles": ["base.json"], "azure": {"targetAgentPoolName": "eastpool"}, "node": {"labels": {"region-group": "east"}}}`,
+		"profiles/gpu.json":  `{"node": {"maxPods": 30}}`,
+		"config.json":        `{"profiles": ["profiles/east.json", "profiles/gpu.json"], "node": {"maxPods": 20, "labels": {"tier": null, "store": "0042"}}}`,
+	})
+	configPath := filepath.Join(dir, "config.json")
+
+	cfg, origins, err := LoadInstanceConfigWithOrigins(configPath, "", Overrides{"agent.logLevel": "debug"})
+	if err != nil {
+		t.Fatalf("LoadInstanceConfigWithOrigins() unexpected error: %v", err)
+	}
+	if cfg.Azure.TargetAgentPoolName != "eastpool" {
+		t.Errorf("TargetAgentPoolName = %q, want eastpool from the east profile", cfg.Azure.TargetAgentPoolName)
+	}
+	if cfg.Node.MaxPods != 20 {
+		t.Errorf("MaxPods = %d, want 20 from the node file", cfg.Node.MaxPods)
+	}
+	for key, want := range map[string]string{"fleet": "stores", "region-group": "east", "store": "0042"} {
+		if got := cfg.Node.Labels[key]; got != want {
+			t.Errorf("label %s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := cfg.Node.Labels["tier"]; ok {
+		t.Error("label tier is set, want the null in the node file to remove it")
+	}
+
+	base := filepath.Join(dir, "profiles", "base.json")
+	east := filepath.Join(dir, "profiles", "east.json")
+	for path, want := range map[string]string{
+		"azure.targetAgentPoolName":  east,
+		"azure.bootstrapToken.token": base,
+		"node.maxPods":               configPath,
+		"node.labels.fleet":          base,
+		"node.labels.region-group":   east,
+		"node.labels.store":          configPath,
+		"agent.logLevel":             OriginOverrides,
+	} {
+		if got := origins[path]; got != want {
+			t.Errorf("origin of %s = %q, want %q", path, got, want)
+		}
+	}
+	for _, path := range []string{"node.labels.tier", "node.labels", "profiles"} {
+		if got, ok := origins[path]; ok {
+			t.Errorf("origin of %s = %q, want none", path, got)
+		}
+	}
+}
+
+func TestLoadConfigWithProfilesInstanceOrigins(t *testing.T) {
+	t.Parallel()
+
+	dir := writeProfileFiles(t, map[string]string{
+		"base.json":   testBaseProfile,
+		"config.json": `{"profiles": ["base.json"], "instances": {"gpu0": {"azure": {"targetAgentPoolName": "gpupool"}, "node": {"kubelet": {"port": 10260, "healthzPort": 10258}}}}}`,
+	})
+	_, origins, err := LoadInstanceConfigWithOrigins(filepath.Join(dir, "config.json"), "gpu0", nil)
+	if err != nil {
+		t.Fatalf("LoadInstanceConfigWithOrigins() unexpected error: %v", err)
+	}
+	if got := origins["azure.targetAgentPoolName"]; got != "instances.gpu0" {
+		t.Errorf("origin of azure.targetAgentPoolName = %q, want instances.gpu0", got)
+	}
+	for path := range origins {
+		if strings.HasPrefix(path, "instances") {
+			t.Errorf("origins list %s, want the instances section left out", path)
+		}
+	}
+}
+
+func TestLoadConfigWithProfilesErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "missing profile",
+			files: map[string]string{"config.json": `{"profiles": ["base.json"]}`},
+			want:  "read profile base.json",
+		},
+		{
+			name:  "cycle",
+			files: map[string]string{"config.json": `{"profiles": ["a.json"]}`, "a.json": `{"profiles": ["b.json"]}`, "b.json": `{"profiles": ["a.json"]}`},
+			want:  "includes itself",
+		},
+		{
+			name:  "not a list",
+			files: map[string]string{"config.json": `{"profiles": "base.json"}`},
+			want:  "must be a list",
+		},
+		{
+			name:  "merged config invalid",
+			files: map[string]string{"config.json": `{"profiles": ["base.json"], "topology": {"site": "not a label!"}}`, "base.json": testBaseProfile},
+			want:  "config validation failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := writeProfileFiles(t, tt.files)
+			_, err := LoadConfig(filepath.Join(dir, "config.json"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
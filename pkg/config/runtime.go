@@ -19,6 +19,11 @@ func RemoveRuntimeDirs(logger *slog.Logger) phases.Task {
 	return &removeRuntimeDirsTask{logger: logger, paths: []string{ConfigDir, DefaultLogDir}}
 }
 
+// RemoveInstanceDir returns a task that deletes the state root of instance.
+func RemoveInstanceDir(logger *slog.Logger, instance Instance) phases.Task {
+	return &removeRuntimeDirsTask{logger: logger, paths: []string{instance.StateDir()}}
+}
+
 func (t *removeRuntimeDirsTask) Name() string { return "remove-runtime-dirs" }
 
 func (t *removeRuntimeDirsTask) Do(context.Context) error {
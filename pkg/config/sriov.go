@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SRIOVResourcePrefix prefixes the extended resources the SR-IOV device
+// plugin advertises for the virtual functions, such as
+// aks-flex-node.azure.com/sriov_ens1f0.
+const SRIOVResourcePrefix = "aks-flex-node.azure.com"
+
+var (
+	// netdevPattern matches Linux network interface names.
+	netdevPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:-]{0,14}$`)
+	// kernelModulePattern matches kernel driver names such as vfio-pci or
+	// iavf.
+	kernelModulePattern = regexp.MustCompile(`^[a-z0-9_][a-z0-9_-]*$`)
+	// sriovResourcePattern matches the resource names the SR-IOV device
+	// plugin accepts.
+	sriovResourcePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// SRIOVConfig creates SR-IOV virtual functions on the host's NICs and hands
+// them to pods through the SR-IOV device plugin and Multus secondary
+// networks.
+type SRIOVConfig struct {
+	// Interfaces are the physical functions to create virtual functions on.
+	Interfaces []SRIOVInterfaceConfig `json:"interfaces,omitempty"`
+}
+
+// SRIOVInterfaceConfig is the virtual function setup of one physical NIC.
+type SRIOVInterfaceConfig struct {
+	// Name is the host network interface of the physical function, such as
+	// ens1f0.
+	Name string `json:"name"`
+
+	// NumVFs is the number of virtual functions created.
+	NumVFs int `json:"numVFs"`
+
+	// Driver binds the virtual functions to a driver other than the NIC's
+	// VF driver, such as vfio-pci for DPDK workloads.
+	Driver string `json:"driver,omitempty"`
+
+	// ResourceName is the device plugin resource the virtual functions are
+	// advertised as under SRIOVResourcePrefix. Defaults to sriov_<name>.
+	ResourceName string `json:"resourceName,omitempty"`
+
+	// Network renders a CNI config Multus attaches the virtual functions
+	// with.
+	Network *SRIOVNetworkConfig `json:"network,omitempty"`
+}
+
+// SRIOVNetworkConfig is the sriov CNI config of a secondary network. A
+// NetworkAttachmentDefinition of the same name without a spec.config makes
+// Multus use it.
+type SRIOVNetworkConfig struct {
+	// Name is the network name.
+	Name string `json:"name"`
+
+	// VLAN tags the virtual functions' traffic.
+	VLAN int `json:"vlan,omitempty"`
+
+	// IPAM is the CNI ipam config object, such as
+	// {"type": "whereabouts", "range": "192.168.10.0/24"}.
+	IPAM json.RawMessage `json:"ipam,omitempty"`
+}
+
+// Enabled reports whether any virtual functions are configured.
+func (c SRIOVConfig) Enabled() bool {
+	return len(c.Interfaces) > 0
+}
+
+// Resource returns the device plugin resource name of the interface,
+// without SRIOVResourcePrefix.
+func (c SRIOVInterfaceConfig) Resource() string {
+	if c.ResourceName != "" {
+		return c.ResourceName
+	}
+	return "sriov_" + strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, c.Name)
+}
+
+func (c *SRIOVConfig) validate() error {
+	var names, resources, networks []string
+	for i, iface := range c.Interfaces {
+		field := fmt.Sprintf("sriov.interfaces[%d]", i)
+		if !netdevPattern.MatchString(iface.Name) {
+			return fmt.Errorf("%s.name %q must be a network interface name", field, iface.Name)
+		}
+		if slices.Contains(names, iface.Name) {
+			return fmt.Errorf("%s: duplicate interface %s", field, iface.Name)
+		}
+		names = append(names, iface.Name)
+		if iface.NumVFs <= 0 {
+			return fmt.Errorf("%s.numVFs must be positive", field)
+		}
+		if iface.Driver != "" && !kernelModulePattern.MatchString(iface.Driver) {
+			return fmt.Errorf("%s.driver %q must be a kernel driver name such as vfio-pci", field, iface.Driver)
+		}
+		resource := iface.Resource()
+		if !sriovResourcePattern.MatchString(resource) {
+			return fmt.Errorf("%s.resourceName %q may only contain letters, digits, and underscores", field, resource)
+		}
+		if slices.Contains(resources, resource) {
+			return fmt.Errorf("%s: duplicate resource name %s", field, resource)
+		}
+		resources = append(resources, resource)
+		if iface.Network == nil {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(iface.Network.Name); len(errs) > 0 {
+			return fmt.Errorf("%s.network.name %q is invalid: %s", field, iface.Network.Name, strings.Join(errs, "; "))
+		}
+		if slices.Contains(networks, iface.Network.Name) {
+			return fmt.Errorf("%s: duplicate network %s", field, iface.Network.Name)
+		}
+		networks = append(networks, iface.Network.Name)
+		if iface.Network.VLAN < 0 || iface.Network.VLAN > 4094 {
+			return fmt.Errorf("%s.network.vlan must be between 0 and 4094", field)
+		}
+		if len(iface.Network.IPAM) > 0 {
+			var ipam map[string]any
+			if err := json.Unmarshal(iface.Network.IPAM, &ipam); err != nil || ipam == nil {
+				return fmt.Errorf("%s.network.ipam must be a JSON object", field)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSRIOVConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	network := func(name string) *SRIOVNetworkConfig { return &SRIOVNetworkConfig{Name: name} }
+	tests := []struct {
+		name       string
+		interfaces []SRIOVInterfaceConfig
+		wantErr    string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			interfaces: []SRIOVInterfaceConfig{
+				{Name: "ens1f0", NumVFs: 8, Network: &SRIOVNetworkConfig{Name: "fronthaul", VLAN: 100, IPAM: json.RawMessage(`{"type":"whereabouts"}`)}},
+				{Name: "ens1f1", NumVFs: 4, Driver: "vfio-pci", ResourceName: "dpdk"},
+			},
+		},
+		{name: "bad name", interfaces: []SRIOVInterfaceConfig{{Name: "../eth0", NumVFs: 1}}, wantErr: "interfaces[0].name"},
+		{name: "duplicate interface", interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1}, {Name: "ens1f0", NumVFs: 1}}, wantErr: "duplicate interface"},
+		{name: "no VFs", interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0"}}, wantErr: "numVFs"},
+		{name: "bad driver", interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, Driver: "vfio pci"}}, wantErr: "driver"},
+		{name: "bad resource", interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, ResourceName: "intel.com/x"}}, wantErr: "resourceName"},
+		{
+			name:       "duplicate resource",
+			interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, ResourceName: "vf"}, {Name: "ens1f1", NumVFs: 1, ResourceName: "vf"}},
+			wantErr:    "duplicate resource",
+		},
+		{name: "bad network name", interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, Network: network("Front_Haul")}}, wantErr: "network.name"},
+		{
+			name:       "duplicate network",
+			interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, Network: network("net")}, {Name: "ens1f1", NumVFs: 1, Network: network("net")}},
+			wantErr:    "duplicate network",
+		},
+		{name: "bad VLAN", interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, Network: &SRIOVNetworkConfig{Name: "net", VLAN: 4095}}}, wantErr: "vlan"},
+		{
+			name:       "IPAM not an object",
+			interfaces: []SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 1, Network: &SRIOVNetworkConfig{Name: "net", IPAM: json.RawMessage(`"dhcp"`)}}},
+			wantErr:    "ipam",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := SRIOVConfig{Interfaces: tt.interfaces}
+			err := c.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSRIOVInterfaceConfigResource(t *testing.T) {
+	t.Parallel()
+
+	if got := (SRIOVInterfaceConfig{Name: "enp59s0f0.100"}).Resource(); got != "sriov_enp59s0f0_100" {
+		t.Errorf("Resource() = %q, want sriov_enp59s0f0_100", got)
+	}
+	if got := (SRIOVInterfaceConfig{Name: "ens1f0", ResourceName: "fronthaul"}).Resource(); got != "fronthaul" {
+		t.Errorf("Resource() = %q, want fronthaul", got)
+	}
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// Node labels describing where the node runs. The region and zone labels are
+// the well-known ones the scheduler's topology spread and zonal volume
+// binding use; the site label names a location below a zone, such as a
+// store or a factory floor.
+const (
+	TopologyRegionLabel = "topology.kubernetes.io/region"
+	TopologyZoneLabel   = "topology.kubernetes.io/zone"
+	TopologySiteLabel   = "aks-flex-node.azure.com/site"
+)
+
+const (
+	// imdsTimeout bounds the instance metadata query, which answers at once
+	// on an Azure VM and never elsewhere.
+	imdsTimeout = 2 * time.Second
+
+	topologyFileName = "topology.json"
+)
+
+// TopologyConfig labels the node with its Azure region, zone, and site so
+// zone-aware workloads spread and bind volumes across them. The labels are
+// set at registration and kept on the Node by the daemon.
+type TopologyConfig struct {
+	// Region defaults to azure.arc.location, then to
+	// azure.targetCluster.location.
+	Region string `json:"region,omitempty"`
+
+	// Zone is the topology.kubernetes.io/zone value, such as eastus-1 or a
+	// name for an edge location. Unset leaves the label off the node.
+	Zone string `json:"zone,omitempty"`
+
+	// Site is the aks-flex-node.azure.com/site value.
+	Site string `json:"site,omitempty"`
+
+	// FromIMDS reads the region and availability zone from the Azure
+	// instance metadata service when the node is an Azure VM. Region and
+	// Zone win over it. Bootstrap and the daemon query the service and keep
+	// the answer in the instance state directory, so it is only queried
+	// until it first answers.
+	FromIMDS bool `json:"fromIMDS,omitempty"`
+}
+
+// NodeLabels returns the topology labels of the resolved config.
+func (c TopologyConfig) NodeLabels() map[string]string {
+	labels := map[string]string{}
+	if c.Region != "" {
+		labels[TopologyRegionLabel] = c.Region
+	}
+	if c.Zone != "" {
+		labels[TopologyZoneLabel] = c.Zone
+	}
+	if c.Site != "" {
+		labels[TopologySiteLabel] = c.Site
+	}
+	return labels
+}
+
+func (c *TopologyConfig) validate() error {
+	for field, value := range map[string]string{"region": c.Region, "zone": c.Zone, "site": c.Site} {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("topology.%s %q is not a valid label value: %s", field, value, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// VMTopology is the region and availability zone of an Azure VM as the
+// instance metadata service reports them. Zone is empty for a VM outside an
+// availability zone.
+type VMTopology struct {
+	Location string `json:"location"`
+	Zone     string `json:"zone"`
+}
+
+// pendingVMTopology is the part of the topology that waits for the
+// instance metadata service.
+type pendingVMTopology struct {
+	region, zone bool
+}
+
+// resolveTopology fills the region and zone the config leaves unset and adds
+// the topology labels to the node labels. It reads the VM topology recorded
+// in stateDir but never queries the metadata service:
+// loading the config must not reach the network. Until ResolveVMTopology has
+// recorded an answer, the region falls back as if fromIMDS were unset.
+func (c *Config) resolveTopology(stateDir string) error {
+	topology := &c.Topology
+	if topology.FromIMDS && (topology.Region == "" || topology.Zone == "") {
+		vm, err := loadVMTopology(stateDir)
+		if err != nil {
+			return fmt.Errorf("topology.fromIMDS: %w", err)
+		}
+		if vm == nil {
+			c.imdsTopology = &pendingVMTopology{region: topology.Region == "", zone: topology.Zone == ""}
+		} else {
+			topology.applyVM(vm)
+		}
+	}
+	return c.applyTopology()
+}
+
+// ResolveVMTopology queries the instance metadata service with fetch for the
+// region and zone topology.fromIMDS leaves to it, records the answer in the
+// instance state directory, and relabels the node. Bootstrap and the daemon
+// call it once the network is up; it does nothing when the answer was
+// already recorded or fromIMDS is unset.
+func (c *Config) ResolveVMTopology(ctx context.Context, fetch func(context.Context) (*VMTopology, error)) error {
+	return c.resolveVMTopology(ctx, c.Instance.StateDir(), fetch)
+}
+
+func (c *Config) resolveVMTopology(ctx context.Context, stateDir string, fetch func(context.Context) (*VMTopology, error)) error {
+	pending := c.imdsTopology
+	if pending == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+	vm, err := fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("topology.fromIMDS: %w", err)
+	}
+	if vm.Location == "" {
+		return errors.New("topology.fromIMDS: the instance metadata has no location")
+	}
+	if err := recordVMTopology(stateDir, vm); err != nil {
+		return err
+	}
+
+	for key := range c.Topology.NodeLabels() {
+		delete(c.Node.Labels, key)
+	}
+	if pending.region {
+		c.Topology.Region = ""
+	}
+	if pending.zone {
+		c.Topology.Zone = ""
+	}
+	c.Topology.applyVM(vm)
+	c.imdsTopology = nil
+	return c.applyTopology()
+}
+
+// applyVM fills the region and zone left unset from vm.
+func (c *TopologyConfig) applyVM(vm *VMTopology) {
+	if c.Region == "" {
+		c.Region = vm.Location
+	}
+	if c.Zone == "" && vm.Zone != "" {
+		// The cloud provider labels zonal Azure VMs <region>-<zone>.
+		c.Zone = normalizeRegion(vm.Location) + "-" + vm.Zone
+	}
+}
+
+// applyTopology defaults the region, validates the topology, and adds its
+// labels to the node labels.
+func (c *Config) applyTopology() error {
+	topology := &c.Topology
+	if topology.Region == "" {
+		if arc := c.Azure.Arc; arc != nil && arc.Enabled {
+			topology.Region = arc.Location
+		}
+	}
+	if topology.Region == "" && c.Azure.TargetCluster != nil {
+		topology.Region = c.Azure.TargetCluster.Location
+	}
+	topology.Region = normalizeRegion(topology.Region)
+	if err := topology.validate(); err != nil {
+		return err
+	}
+	for key, value := range topology.NodeLabels() {
+		c.Node.Labels[key] = value
+	}
+	return nil
+}
+
+// normalizeRegion turns a region display name such as "East US" into its
+// name, eastus, which is what Azure reports in the region label.
+func normalizeRegion(region string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(region), " ", ""))
+}
+
+// loadVMTopology returns the topology recorded in stateDir, or nil when there
+// is none.
+func loadVMTopology(stateDir string) (*VMTopology, error) {
+	path := filepath.Join(stateDir, topologyFileName)
+	data, err := os.ReadFile(path) //#nosec G304 -- path is under the instance state directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	vm := &VMTopology{}
+	if err := json.Unmarshal(data, vm); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return vm, nil
+}
+
+// recordVMTopology keeps vm in stateDir so later loads of the config reuse it.
+func recordVMTopology(stateDir string, vm *VMTopology) error {
+	data, err := json.Marshal(vm)
+	if err != nil {
+		return fmt.Errorf("encode VM topology: %w", err)
+	}
+	if err := utilio.WriteFile(filepath.Join(stateDir, topologyFileName), data, 0o600); err != nil {
+		return fmt.Errorf("record VM topology: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestResolveTopology(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		topology   TopologyConfig
+		arc        *ArcConfig
+		wantLabels map[string]string
+		wantErr    string
+	}{
+		{name: "region from the cluster", wantLabels: map[string]string{TopologyRegionLabel: "westus2"}},
+		{
+			name:       "region from the Arc machine",
+			arc:        &ArcConfig{Enabled: true, Location: "East US"},
+			wantLabels: map[string]string{TopologyRegionLabel: "eastus"},
+		},
+		{
+			name:     "configured zone and site",
+			topology: TopologyConfig{Region: "centralus", Zone: "store-42", Site: "aisle-3"},
+			arc:      &ArcConfig{Enabled: true, Location: "eastus"},
+			wantLabels: map[string]string{
+				TopologyRegionLabel: "centralus",
+				TopologyZoneLabel:   "store-42",
+				TopologySiteLabel:   "aisle-3",
+			},
+		},
+		{name: "invalid site", topology: TopologyConfig{Site: "aisle 3"}, wantErr: "topology.site"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &Config{
+				Azure:    AzureConfig{Arc: tt.arc, TargetCluster: &TargetClusterConfig{Location: "westus2"}},
+				Node:     NodeConfig{Labels: map[string]string{"env": "prod"}},
+				Topology: tt.topology,
+			}
+			err := cfg.resolveTopology(t.TempDir())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveTopology() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTopology() = %v", err)
+			}
+			want := maps.Clone(tt.wantLabels)
+			want["env"] = "prod"
+			if !maps.Equal(cfg.Node.Labels, want) {
+				t.Errorf("labels = %v, want %v", cfg.Node.Labels, want)
+			}
+		})
+	}
+}
+
+func TestResolveVMTopology(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	newConfig := func() *Config {
+		return &Config{
+			Azure:    AzureConfig{TargetCluster: &TargetClusterConfig{Location: "westus2"}},
+			Node:     NodeConfig{Labels: map[string]string{}},
+			Topology: TopologyConfig{Site: "aisle-3", FromIMDS: true},
+		}
+	}
+	calls := 0
+	fetch := func(context.Context) (*VMTopology, error) {
+		calls++
+		return &VMTopology{Location: "eastus2", Zone: "3"}, nil
+	}
+	want := map[string]string{
+		TopologyRegionLabel: "eastus2",
+		TopologyZoneLabel:   "eastus2-3",
+		TopologySiteLabel:   "aisle-3",
+	}
+
+	cfg := newConfig()
+	if err := cfg.resolveTopology(dir); err != nil {
+		t.Fatalf("resolveTopology() = %v", err)
+	}
+	if got := cfg.Node.Labels[TopologyRegionLabel]; got != "westus2" {
+		t.Fatalf("region before the metadata query = %q, want the cluster's westus2", got)
+	}
+	if _, ok := cfg.Node.Labels[TopologyZoneLabel]; ok {
+		t.Fatal("zone labelled before the metadata query")
+	}
+	if err := cfg.resolveVMTopology(t.Context(), dir, fetch); err != nil {
+		t.Fatalf("resolveVMTopology() = %v", err)
+	}
+	if !maps.Equal(cfg.Node.Labels, want) {
+		t.Fatalf("labels = %v, want %v", cfg.Node.Labels, want)
+	}
+
+	cfg = newConfig()
+	if err := cfg.resolveTopology(dir); err != nil {
+		t.Fatalf("resolveTopology() with a recorded answer = %v", err)
+	}
+	if err := cfg.resolveVMTopology(t.Context(), dir, fetch); err != nil {
+		t.Fatalf("resolveVMTopology() with a recorded answer = %v", err)
+	}
+	if !maps.Equal(cfg.Node.Labels, want) {
+		t.Errorf("labels from the recorded answer = %v, want %v", cfg.Node.Labels, want)
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times, want the recorded answer reused", calls)
+	}
+
+	cfg = newConfig()
+	failing := func(context.Context) (*VMTopology, error) { return nil, errors.New("no route to host") }
+	empty := t.TempDir()
+	if err := cfg.resolveTopology(empty); err != nil {
+		t.Fatalf("resolveTopology() = %v", err)
+	}
+	if err := cfg.resolveVMTopology(t.Context(), empty, failing); err == nil {
+		t.Error("resolveVMTopology() with an unreachable service = nil, want error")
+	}
+	if vm, err := loadVMTopology(empty); vm != nil || err != nil {
+		t.Errorf("loadVMTopology() after a failed query = %+v, %v, want nothing recorded", vm, err)
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Defaults of TrustConfig.
+const (
+	DefaultTrustSyncInterval  = 6 * time.Hour
+	DefaultTrustExpiryWarning = 30 * 24 * time.Hour
+)
+
+var caBundleNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// TrustConfig distributes enterprise certificate authorities into the nspawn
+// machine, for private registries and internal services whose certificates
+// do not chain to a public root.
+type TrustConfig struct {
+	// CABundles are added to the machine's OS trust store.
+	CABundles []CABundleConfig `json:"caBundles,omitempty"`
+
+	// Registries are registry hosts, as host or host:port, whose containerd
+	// hosts.toml lists every CA bundle, for registries containerd does not
+	// verify through the OS trust store.
+	Registries []string `json:"registries,omitempty"`
+
+	// SyncInterval is how often the daemon re-reads the bundles, so a CA
+	// rotated in Key Vault reaches the running machine.
+	SyncInterval JSONDuration `json:"syncInterval,omitempty"`
+
+	// ExpiryWarning is how long before a distributed CA expires the daemon
+	// starts warning about it.
+	ExpiryWarning JSONDuration `json:"expiryWarning,omitempty"`
+}
+
+// CABundleConfig is one PEM bundle of CA certificates. Exactly one of Path,
+// Data, and KeyVault is set.
+type CABundleConfig struct {
+	// Name identifies the bundle and names its file in the trust store. It
+	// is lowercase letters, digits, and dashes.
+	Name string `json:"name"`
+	// Path is an absolute path of a PEM file on the host.
+	Path string `json:"path,omitempty"`
+	// Data is the PEM content inline.
+	Data string `json:"data,omitempty"`
+	// KeyVault reads the PEM content from a Key Vault secret with the
+	// agent's Azure credentials.
+	KeyVault *KeyVaultSecretConfig `json:"keyVault,omitempty"`
+}
+
+// KeyVaultSecretConfig names a Key Vault secret.
+type KeyVaultSecretConfig struct {
+	// VaultURL is the vault's https URL, such as https://contoso.vault.azure.net.
+	VaultURL string `json:"vaultUrl"`
+	// SecretName is the secret holding the PEM bundle. A Key Vault
+	// certificate created with the PEM content type can be read through its
+	// secret of the same name.
+	SecretName string `json:"secretName"`
+	// Version pins a secret version. The latest is read when empty.
+	Version string `json:"version,omitempty"`
+}
+
+// Enabled reports whether any CA bundle is configured.
+func (c TrustConfig) Enabled() bool {
+	return len(c.CABundles) > 0
+}
+
+func (c *TrustConfig) validate() error {
+	if c.SyncInterval < 0 || (c.SyncInterval > 0 && time.Duration(c.SyncInterval) < time.Minute) {
+		return fmt.Errorf("trust.syncInterval must be at least 1m")
+	}
+	if c.ExpiryWarning < 0 {
+		return fmt.Errorf("trust.expiryWarning must not be negative")
+	}
+	names := make(map[string]bool, len(c.CABundles))
+	for i, bundle := range c.CABundles {
+		if err := bundle.validate(); err != nil {
+			return fmt.Errorf("invalid trust.caBundles[%d]: %w", i, err)
+		}
+		if names[bundle.Name] {
+			return fmt.Errorf("invalid trust.caBundles[%d]: duplicate name %q", i, bundle.Name)
+		}
+		names[bundle.Name] = true
+	}
+	if len(c.Registries) > 0 && len(c.CABundles) == 0 {
+		return fmt.Errorf("trust.registries needs trust.caBundles")
+	}
+	for i, registry := range c.Registries {
+		if err := validateRegistryHost(registry); err != nil {
+			return fmt.Errorf("invalid trust.registries[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (b CABundleConfig) validate() error {
+	if !caBundleNamePattern.MatchString(b.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, and dashes", b.Name)
+	}
+	sources := 0
+	for _, set := range []bool{b.Path != "", b.Data != "", b.KeyVault != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of path, data, and keyVault must be set")
+	}
+	if b.Path != "" && !filepath.IsAbs(b.Path) {
+		return fmt.Errorf("path %q must be absolute", b.Path)
+	}
+	if kv := b.KeyVault; kv != nil {
+		u, err := url.Parse(kv.VaultURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("keyVault.vaultUrl %q must be an https URL", kv.VaultURL)
+		}
+		if kv.SecretName == "" {
+			return fmt.Errorf("keyVault.secretName is required")
+		}
+	}
+	return nil
+}
+
+func validateRegistryHost(registry string) error {
+	if registry == "" || strings.ContainsAny(registry, "/ ") {
+		return fmt.Errorf("%q must be a host or host:port without a scheme or path", registry)
+	}
+	if strings.Contains(registry, ":") {
+		if _, _, err := net.SplitHostPort(registry); err != nil {
+			return fmt.Errorf("%q must be a host or host:port: %w", registry, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrustConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		trust   TrustConfig
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			trust: TrustConfig{
+				CABundles: []CABundleConfig{
+					{Name: "corp-root", Path: "/etc/pki/corp-root.pem"},
+					{Name: "registry-ca", Data: "-----BEGIN CERTIFICATE-----"},
+					{Name: "issuing", KeyVault: &KeyVaultSecretConfig{VaultURL: "https://contoso.vault.azure.net", SecretName: "issuing-ca"}},
+				},
+				Registries:   []string{"registry.corp.example", "10.0.0.5:5000"},
+				SyncInterval: JSONDuration(time.Hour),
+			},
+		},
+		{
+			name:    "bad name",
+			trust:   TrustConfig{CABundles: []CABundleConfig{{Name: "Corp Root", Path: "/etc/pki/corp.pem"}}},
+			wantErr: "caBundles[0]",
+		},
+		{
+			name:    "duplicate name",
+			trust:   TrustConfig{CABundles: []CABundleConfig{{Name: "corp", Path: "/a.pem"}, {Name: "corp", Path: "/b.pem"}}},
+			wantErr: "duplicate",
+		},
+		{
+			name:    "two sources",
+			trust:   TrustConfig{CABundles: []CABundleConfig{{Name: "corp", Path: "/a.pem", Data: "x"}}},
+			wantErr: "exactly one",
+		},
+		{
+			name:    "relative path",
+			trust:   TrustConfig{CABundles: []CABundleConfig{{Name: "corp", Path: "corp.pem"}}},
+			wantErr: "absolute",
+		},
+		{
+			name:    "http vault",
+			trust:   TrustConfig{CABundles: []CABundleConfig{{Name: "corp", KeyVault: &KeyVaultSecretConfig{VaultURL: "http://contoso.vault.azure.net", SecretName: "ca"}}}},
+			wantErr: "vaultUrl",
+		},
+		{
+			name:    "registries without bundles",
+			trust:   TrustConfig{Registries: []string{"registry.corp.example"}},
+			wantErr: "needs trust.caBundles",
+		},
+		{
+			name:    "registry with scheme",
+			trust:   TrustConfig{CABundles: []CABundleConfig{{Name: "corp", Path: "/a.pem"}}, Registries: []string{"https://registry.corp.example"}},
+			wantErr: "registries[0]",
+		},
+		{
+			name:    "short sync interval",
+			trust:   TrustConfig{SyncInterval: JSONDuration(time.Second)},
+			wantErr: "syncInterval",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.trust.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultUnitDriftInterval = 5 * time.Minute
+
+// UnitDriftConfig configures the daemon's watch of the kubelet and
+// containerd units in the active machine for drop-ins and unit file edits
+// made outside the agent, such as systemctl edit kubelet.
+type UnitDriftConfig struct {
+	// Disabled turns the watch off.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Interval is how often the units are checked.
+	Interval JSONDuration `json:"interval,omitempty"`
+}
+
+func (c *UnitDriftConfig) validate() error {
+	if c.Interval < 0 || (c.Interval > 0 && time.Duration(c.Interval) < time.Minute) {
+		return fmt.Errorf("agent.unitDrift.interval must be at least 1m")
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnitDriftConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		interval time.Duration
+		wantErr  bool
+	}{
+		{},
+		{interval: 5 * time.Minute},
+		{interval: 10 * time.Second, wantErr: true},
+		{interval: -time.Minute, wantErr: true},
+	} {
+		c := UnitDriftConfig{Interval: JSONDuration(tc.interval)}
+		if err := c.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("validate() with interval %s = %v, want error %v", tc.interval, err, tc.wantErr)
+		}
+	}
+}
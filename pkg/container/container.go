@@ -0,0 +1,214 @@
+// Package container runs the agent inside a container instead of as a host
+// systemd service.
+//
+// The container shares the host's PID and network namespaces and has the
+// host paths the agent manages bind-mounted at the same paths. systemctl,
+// machinectl, and systemd-run reach the host's service and machine managers
+// through the mounted /run/systemd private socket and D-Bus system bus socket,
+// and the files the agent writes land on the host through the mounts. Package
+// managers and kernel tools act on the filesystem they run from, so they are
+// shimmed to run in the host's mount namespace through nsenter.
+package container
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+const (
+	// EnvContainer is set in the agent's environment when it runs in a
+	// container. The entrypoint sets it for the agent and the tools it runs.
+	EnvContainer = "AKS_FLEX_NODE_CONTAINER"
+
+	// envIgnoreChroot stops systemctl from ignoring start and stop requests:
+	// with the host PID namespace, / differs from PID 1's root, which
+	// systemctl takes for a chroot.
+	envIgnoreChroot = "SYSTEMD_IGNORE_CHROOT"
+
+	// hostRoot is the host's root directory seen through PID 1.
+	hostRoot = "/proc/1/root"
+
+	shimDirName = "aks-flex-node-host-tools"
+)
+
+// hostTools act on the root filesystem they run from, so in a container they
+// would change the image instead of the host.
+var hostTools = []string{
+	"apt-get", "apt-mark", "dpkg", "dpkg-query", "rpm",
+	"modprobe", "sysctl", "swapoff", "ldconfig", "update-grub",
+	"nft", "iptables", "ip6tables",
+	"pvs", "pvremove", "vgs", "vgcreate", "vgextend", "vgremove",
+	"azcmagent", "nvidia-smi",
+}
+
+// hostToolDirs are searched on the host for hostTools. Only tools the host
+// has are shimmed, so a lookup of a missing tool still fails.
+var hostToolDirs = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin", "/opt/azcmagent/bin"}
+
+var shimTemplate = template.Must(template.New("shim").Parse(`#!/bin/sh
+# Generated by aks-flex-node. Runs {{.}} in the host's mount namespace.
+exec nsenter --target 1 --mount -- {{.}} "$@"
+`))
+
+// Detect reports whether the agent runs in a container set up by the
+// container entrypoint.
+func Detect() bool {
+	return os.Getenv(EnvContainer) != ""
+}
+
+// Mount is a host path the agent needs bind-mounted into the container at
+// the same path.
+type Mount struct {
+	Path    string
+	Purpose string
+	// IfOnHost makes the mount required only when the host has the path.
+	IfOnHost bool
+}
+
+// RequiredMounts returns the host paths the agent needs in the container for
+// cfg.
+func RequiredMounts(cfg *config.Config) []Mount {
+	mounts := []Mount{
+		{Path: "/etc", Purpose: "host configuration, systemd units, and the agent's config and state"},
+		{Path: "/run/systemd", Purpose: "systemctl access to the host's service manager"},
+		{Path: "/run/dbus/system_bus_socket", Purpose: "machinectl and systemd-run access to the host's machines"},
+		{Path: "/var/lib/machines", Purpose: "the store of the nspawn machines"},
+		{Path: "/var/lib/dpkg", Purpose: "the host conflict scan of installed packages", IfOnHost: true},
+		{Path: filepath.Dir(cfg.Agent.AuditLogPath), Purpose: "the audit log"},
+		{Path: cfg.Agent.LogDir, Purpose: "agent logs"},
+		{Path: filepath.Dir(cfg.Instance.ControlSocketPath()), Purpose: "the admin socket used by aks-flex-node ctl on the host"},
+	}
+	if cfg.Agent.ExportBinaries {
+		mounts = append(mounts, Mount{Path: cfg.Instance.ExportedBinDir(), Purpose: "agent.exportBinaries wrappers"})
+	}
+	if local := cfg.LocalStorage.LocalPath; local != nil {
+		mounts = append(mounts, Mount{Path: local.Path, Purpose: "localStorage.localPath volumes"})
+	}
+	if textfile := cfg.Agent.MetricsTextfile; textfile.Enabled() {
+		mounts = append(mounts, Mount{Path: textfile.Directory, Purpose: "agent.metricsTextfile"})
+	}
+	return mounts
+}
+
+// host is the view of the host that Validate checks; tests replace it.
+type host struct {
+	root string
+	proc string
+}
+
+// Validate checks that the container shares the host's PID and network
+// namespaces and that every required mount is the host's path, and returns
+// every problem it finds.
+func Validate(cfg *config.Config) error {
+	return host{root: hostRoot, proc: "/proc"}.validate(cfg)
+}
+
+func (h host) validate(cfg *config.Config) error {
+	var errs []error
+	if comm, err := os.ReadFile(filepath.Join(h.proc, "1", "comm")); err != nil || strings.TrimSpace(string(comm)) != "systemd" {
+		errs = append(errs, errors.New("PID 1 is not systemd: run the container in the host PID namespace (--pid=host)"))
+	}
+	self, err := os.Readlink(filepath.Join(h.proc, "self", "ns", "net"))
+	pid1, pid1Err := os.Readlink(filepath.Join(h.proc, "1", "ns", "net"))
+	if err != nil || pid1Err != nil || self != pid1 {
+		errs = append(errs, errors.New("the container is not in the host network namespace: run it with --network=host"))
+	}
+	for _, m := range RequiredMounts(cfg) {
+		if _, err := os.Stat(filepath.Join(h.root, m.Path)); m.IfOnHost && err != nil {
+			continue
+		}
+		if err := h.checkMount(m.Path); err != nil {
+			errs = append(errs, fmt.Errorf("mount %s for %s: %w", m.Path, m.Purpose, err))
+		}
+	}
+	if cfg.IsARCEnabled() && h.toolPath("azcmagent") == "" {
+		// Its installer would install the agent into the container.
+		errs = append(errs, errors.New("the Azure Arc agent is not installed on the host: install azcmagent on the host before running the agent in a container"))
+	}
+	return errors.Join(errs...)
+}
+
+// toolPath returns where the host has tool, or "" when it has none.
+func (h host) toolPath(tool string) string {
+	for _, dir := range hostToolDirs {
+		path := filepath.Join(dir, tool)
+		if info, err := os.Stat(filepath.Join(h.root, path)); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// checkMount reports whether path is the host's own path, which it is when
+// it and the same path under PID 1's root are one file.
+func (h host) checkMount(path string) error {
+	inContainer, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("not mounted: %w", err)
+	}
+	onHost, err := os.Stat(filepath.Join(h.root, path))
+	if err != nil {
+		return fmt.Errorf("not found on the host: %w", err)
+	}
+	if !os.SameFile(inContainer, onHost) {
+		return errors.New("not bind-mounted from the host")
+	}
+	return nil
+}
+
+// Setup validates the container and prepares the agent's environment: host
+// tool shims first on PATH and systemctl told it is not in a chroot. The
+// environment is inherited by every tool the agent runs.
+func Setup(log *slog.Logger, cfg *config.Config) error {
+	if err := Validate(cfg); err != nil {
+		return fmt.Errorf("the container is not set up to run the agent:\n%w", err)
+	}
+	shimDir := filepath.Join(os.TempDir(), shimDirName)
+	tools, err := host{root: hostRoot}.writeShims(shimDir)
+	if err != nil {
+		return err
+	}
+	for key, value := range map[string]string{
+		EnvContainer:    "1",
+		envIgnoreChroot: "1",
+		"PATH":          shimDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+	} {
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("set %s: %w", key, err)
+		}
+	}
+	log.Info("running in a container", "shimDir", shimDir, "hostTools", tools)
+	return nil
+}
+
+// writeShims writes a script into dir for each host tool the host has that
+// runs the host's tool in the host's mount namespace, and returns the tools.
+func (h host) writeShims(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec // the shims are run by the agent's tools
+		return nil, fmt.Errorf("create %s: %w", dir, err)
+	}
+	var tools []string
+	for _, tool := range hostTools {
+		path := h.toolPath(tool)
+		if path == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := shimTemplate.Execute(&buf, path); err != nil {
+			return nil, fmt.Errorf("render %s shim: %w", tool, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, tool), buf.Bytes(), 0o755); err != nil { //nolint:gosec // shims must be executable
+			return nil, fmt.Errorf("write %s shim: %w", tool, err)
+		}
+		tools = append(tools, tool)
+	}
+	return tools, nil
+}
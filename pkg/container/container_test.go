@@ -0,0 +1,108 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestCheckMount(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	root := t.TempDir()
+	mounted := filepath.Join(dir, "machines")
+	copied := filepath.Join(dir, "etc")
+	for _, path := range []string{mounted, copied, filepath.Join(root, copied)} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The host's view of a bind mount is the same directory.
+	if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(mounted, filepath.Join(root, mounted)); err != nil {
+		t.Fatal(err)
+	}
+
+	h := host{root: root}
+	if err := h.checkMount(mounted); err != nil {
+		t.Errorf("checkMount(bind mount) = %v", err)
+	}
+	if err := h.checkMount(copied); err == nil || !strings.Contains(err.Error(), "not bind-mounted") {
+		t.Errorf("checkMount(image directory) = %v, want not bind-mounted", err)
+	}
+	if err := h.checkMount(filepath.Join(dir, "missing")); err == nil || !strings.Contains(err.Error(), "not mounted") {
+		t.Errorf("checkMount(missing) = %v, want not mounted", err)
+	}
+}
+
+func TestValidateNamespaces(t *testing.T) {
+	t.Parallel()
+
+	proc := t.TempDir()
+	for _, dir := range []string{"1/ns", "self/ns"} {
+		if err := os.MkdirAll(filepath.Join(proc, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(proc, "1", "comm"), []byte("bash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("net:[4026531840]", filepath.Join(proc, "1", "ns", "net")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("net:[4026532301]", filepath.Join(proc, "self", "ns", "net")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Azure: config.AzureConfig{Arc: &config.ArcConfig{Enabled: true}}}
+
+	err := host{root: t.TempDir(), proc: proc}.validate(cfg)
+	if err == nil {
+		t.Fatal("validate() = nil")
+	}
+	for _, want := range []string{"--pid=host", "--network=host", "mount /run/systemd", "azcmagent"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validate() = %v, want it to mention %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "/var/lib/dpkg") {
+		t.Errorf("validate() = %v, want /var/lib/dpkg skipped on a host without it", err)
+	}
+}
+
+func TestWriteShims(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr/sbin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr/sbin/modprobe"), nil, 0o755); err != nil { //nolint:gosec // fake tool
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), shimDirName)
+
+	tools, err := host{root: root}.writeShims(dir)
+	if err != nil {
+		t.Fatalf("writeShims: %v", err)
+	}
+	if !slices.Equal(tools, []string{"modprobe"}) {
+		t.Fatalf("tools = %v, want only the host's modprobe", tools)
+	}
+	shim, err := os.ReadFile(filepath.Join(dir, "modprobe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(shim), `exec nsenter --target 1 --mount -- /usr/sbin/modprobe "$@"`) {
+		t.Errorf("shim = %s", shim)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apt-get")); err == nil {
+		t.Error("apt-get is shimmed on a host without it")
+	}
+}
@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/accelerator"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+var acceleratorDrift = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "aks_flex_node_accelerator_drift_gpus",
+	Help: "Number of GPUs whose MIG partitions differed from the config at the latest check.",
+})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(acceleratorDrift)
+}
+
+// acceleratorReconciler compares the GPUs with the accelerator config and
+// re-applies it when someone repartitioned them by hand, keeps the device
+// plugin config in the active machine current, and keeps the accelerator
+// labels on the Node in sync. It implements manager.Runnable.
+type acceleratorReconciler struct {
+	log         *slog.Logger
+	cfg         config.AcceleratorsConfig
+	state       stateStore
+	reader      client.Reader
+	client      client.Client
+	nodeName    string
+	recorder    *nodeRecorder
+	interval    time.Duration
+	machinesDir string
+	run         accelerator.Runner
+
+	mu   sync.Mutex
+	last []accelerator.Drift
+}
+
+func newAcceleratorReconciler(log *slog.Logger, cfg *config.Config, state stateStore, reader client.Reader, c client.Client, nodeName string, recorder *nodeRecorder) *acceleratorReconciler {
+	return &acceleratorReconciler{
+		log:         log,
+		cfg:         cfg.Accelerators,
+		state:       state,
+		reader:      reader,
+		client:      c,
+		nodeName:    nodeName,
+		recorder:    recorder,
+		interval:    time.Duration(cfg.Accelerators.DriftCheckInterval),
+		machinesDir: machinesDir,
+		run:         accelerator.NvidiaSMI(log),
+	}
+}
+
+// NeedLeaderElection reports false: every daemon manages its own GPUs.
+func (r *acceleratorReconciler) NeedLeaderElection() bool { return false }
+
+func (r *acceleratorReconciler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the drift found by the latest check, or nil when the GPUs
+// matched the config or before the first check.
+func (r *acceleratorReconciler) Last() []accelerator.Drift {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func (r *acceleratorReconciler) reconcile(ctx context.Context) {
+	gpus, err := accelerator.Query(ctx, r.run)
+	if err != nil {
+		r.log.Warn("failed to query GPUs", "error", err)
+	} else {
+		drift := accelerator.Diff(r.cfg, gpus)
+		acceleratorDrift.Set(float64(len(drift)))
+		r.mu.Lock()
+		r.last = drift
+		r.mu.Unlock()
+		if len(drift) > 0 {
+			problems := make([]string, 0, len(drift))
+			for _, d := range drift {
+				problems = append(problems, d.String())
+			}
+			message := "GPU partitions drifted from the config, re-applying: " + strings.Join(problems, "; ")
+			r.log.Warn(message)
+			r.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonAcceleratorDrift, message)
+			if err := accelerator.ApplyMIG(ctx, r.log, r.cfg, r.run); err != nil {
+				r.log.Error("failed to re-apply the accelerator config", "error", err)
+				r.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonAcceleratorDrift, "Re-applying the accelerator config failed: "+err.Error())
+			}
+		}
+	}
+
+	if state, err := r.state.Load(ctx); err == nil && state != nil && state.ActiveMachine != "" {
+		if _, err := accelerator.WriteDevicePluginConfig(ctx, r.log, r.cfg, filepath.Join(r.machinesDir, state.ActiveMachine)); err != nil {
+			r.log.Warn("failed to write the device plugin config", "machine", state.ActiveMachine, "error", err)
+		}
+	}
+	if err := r.syncLabels(ctx); err != nil {
+		r.log.Warn("failed to sync accelerator node labels", "error", err)
+	}
+}
+
+// syncLabels sets the accelerator labels of the config on the Node and
+// removes the ones a previous config set.
+func (r *acceleratorReconciler) syncLabels(ctx context.Context) error {
+	node := &corev1.Node{}
+	if err := r.reader.Get(ctx, client.ObjectKey{Name: r.nodeName}, node); err != nil {
+		return fmt.Errorf("get node %s: %w", r.nodeName, err)
+	}
+	want := r.cfg.NodeLabels()
+	labels := maps.Clone(node.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	maps.DeleteFunc(labels, func(key, _ string) bool {
+		_, ok := want[key]
+		return !ok && isAcceleratorLabel(key)
+	})
+	maps.Copy(labels, want)
+	if maps.Equal(labels, node.Labels) {
+		return nil
+	}
+	patched := node.DeepCopy()
+	patched.Labels = labels
+	if err := r.client.Patch(ctx, patched, client.MergeFromWithOptions(node, client.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("patch labels of node %s: %w", r.nodeName, err)
+	}
+	return nil
+}
+
+func isAcceleratorLabel(key string) bool {
+	return strings.HasPrefix(key, config.AcceleratorMIGLabelPrefix) || key == config.AcceleratorTimeSlicingReplicasLabel
+}
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/accelerator"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestAcceleratorReconciler(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{
+		"env": "prod",
+		config.AcceleratorMIGLabelPrefix + "7g.80gb": "1",
+	}}}
+	kubeClient := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(node).Build()
+
+	instances := []string{"7g.80gb"}
+	var created string
+	cfg := config.AcceleratorsConfig{
+		MIG:         &config.MIGConfig{Profiles: []string{"1g.10gb", "1g.10gb"}},
+		TimeSlicing: &config.TimeSlicingConfig{Replicas: 2},
+	}
+	machines := t.TempDir()
+	r := &acceleratorReconciler{
+		log:         slog.New(slog.DiscardHandler),
+		cfg:         cfg,
+		state:       &testStateStore{state: &State{ActiveMachine: "kube1"}},
+		reader:      kubeClient,
+		client:      kubeClient,
+		nodeName:    "node1",
+		machinesDir: machines,
+		run: func(_ context.Context, args ...string) (string, error) {
+			switch {
+			case strings.HasPrefix(args[0], "--query-gpu"):
+				return "0, GPU-1111, NVIDIA A100-SXM4-80GB, Enabled, Enabled\n", nil
+			case args[0] == "-L":
+				out := "GPU 0: NVIDIA A100-SXM4-80GB (UUID: GPU-1111)\n"
+				for _, profile := range instances {
+					out += "  MIG " + profile + "  Device  0: (UUID: MIG-x)\n"
+				}
+				return out, nil
+			case args[0] == "mig" && args[3] == "-dgi":
+				instances = nil
+			case args[0] == "mig" && args[3] == "-cgi":
+				created = args[4]
+				instances = strings.Split(args[4], ",")
+			}
+			return "", nil
+		},
+	}
+
+	r.reconcile(t.Context())
+	if created != "1g.10gb,1g.10gb" {
+		t.Errorf("drift re-applied %q, want the configured profiles", created)
+	}
+	if len(r.Last()) != 1 {
+		t.Errorf("Last() = %v, want the drift found before re-applying", r.Last())
+	}
+	if _, err := os.Stat(filepath.Join(machines, "kube1", accelerator.DevicePluginConfigPath)); err != nil {
+		t.Errorf("device plugin config not written: %v", err)
+	}
+	got := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"env": "prod",
+		config.AcceleratorMIGLabelPrefix + "1g.10gb": "2",
+		config.AcceleratorTimeSlicingReplicasLabel:   "2",
+	}
+	if len(got.Labels) != len(want) {
+		t.Errorf("node labels = %v, want %v", got.Labels, want)
+	}
+	for key, value := range want {
+		if got.Labels[key] != value {
+			t.Errorf("node label %s = %q, want %q", key, got.Labels[key], value)
+		}
+	}
+
+	r.reconcile(t.Context())
+	if len(r.Last()) != 0 {
+		t.Errorf("Last() after re-applying = %v, want no drift", r.Last())
+	}
+	var nilReconciler *acceleratorReconciler
+	if nilReconciler.Last() != nil {
+		t.Error("nil reconciler reported drift")
+	}
+}
@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+const acrCredentialsCheckInterval = time.Minute
+
+// acrCredentials generates and checks the kubelet's ACR credentials; it is
+// implemented by *acrcredentials.Manager.
+type acrCredentials interface {
+	Check(machineDir string) error
+	Generate(ctx context.Context, machineDir string) error
+}
+
+// acrCredentialsRotator renews the registry tokens of the kubelet's ACR
+// image credential provider before they expire, and when they are missing,
+// damaged, or do not cover the configured registries. It implements
+// manager.Runnable.
+type acrCredentialsRotator struct {
+	log         *slog.Logger
+	state       stateStore
+	credentials acrCredentials
+	interval    time.Duration
+	machinesDir string
+	wakeups     chan struct{}
+}
+
+func newACRCredentialsRotator(log *slog.Logger, state stateStore, credentials acrCredentials) *acrCredentialsRotator {
+	return &acrCredentialsRotator{
+		log:         log,
+		state:       state,
+		credentials: credentials,
+		interval:    acrCredentialsCheckInterval,
+		machinesDir: machinesDir,
+		wakeups:     make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: the credentials belong to the local kubelet.
+func (r *acrCredentialsRotator) NeedLeaderElection() bool { return false }
+
+func (r *acrCredentialsRotator) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-r.wakeups:
+		}
+	}
+}
+
+// wake requests an immediate check, for example after the host resumed with
+// tokens that expired while it was suspended.
+func (r *acrCredentialsRotator) wake() {
+	select {
+	case r.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// run renews the credentials when needed. Before the first node has been
+// started there is no kubelet to serve, so it waits for a machine.
+func (r *acrCredentialsRotator) run(ctx context.Context) {
+	state, err := r.state.Load(ctx)
+	if err != nil {
+		r.log.Warn("failed to load daemon state for ACR credentials check", "error", err)
+		return
+	}
+	if state == nil || state.ActiveMachine == "" {
+		return
+	}
+	machineDir := filepath.Join(r.machinesDir, state.ActiveMachine)
+	reason := r.credentials.Check(machineDir)
+	if reason == nil {
+		return
+	}
+	r.log.Info("renewing ACR credentials", "reason", reason, "machineDir", machineDir)
+	if err := r.credentials.Generate(ctx, machineDir); err != nil {
+		r.log.Warn("failed to renew ACR credentials", "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+type fakeACRCredentials struct {
+	stale     error
+	generated []string
+}
+
+func (f *fakeACRCredentials) Check(string) error { return f.stale }
+
+func (f *fakeACRCredentials) Generate(_ context.Context, machineDir string) error {
+	f.generated = append(f.generated, machineDir)
+	f.stale = nil
+	return nil
+}
+
+func TestACRCredentialsRotator(t *testing.T) {
+	t.Parallel()
+
+	state := &testStateStore{}
+	credentials := &fakeACRCredentials{stale: errors.New("ACR credentials expire soon")}
+	rotator := newACRCredentialsRotator(slog.New(slog.DiscardHandler), state, credentials)
+	rotator.machinesDir = "/machines"
+
+	// Without a machine there is no kubelet to serve yet.
+	rotator.run(t.Context())
+	if len(credentials.generated) != 0 {
+		t.Fatalf("generated = %v before a machine started", credentials.generated)
+	}
+
+	state.state = &State{ActiveMachine: "kube2"}
+	rotator.run(t.Context())
+	rotator.run(t.Context())
+	if want := filepath.Join("/machines", "kube2"); len(credentials.generated) != 1 || credentials.generated[0] != want {
+		t.Fatalf("generated = %v, want one renewal for %s", credentials.generated, want)
+	}
+}
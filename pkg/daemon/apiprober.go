@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+const (
+	apiProbeInterval = time.Minute
+	machinesDir      = "/var/lib/machines"
+)
+
+// apiProber periodically probes the API server with the active machine's
+// kubelet kubeconfig and keeps the latest report for the admin API. It
+// implements manager.Runnable.
+type apiProber struct {
+	log         *slog.Logger
+	state       stateStore
+	interval    time.Duration
+	machinesDir string
+	probe       func(context.Context, apiprobe.Target) apiprobe.Report
+	wakeups     chan struct{}
+
+	mu   sync.Mutex
+	last *apiprobe.Report
+}
+
+func newAPIProber(log *slog.Logger, state stateStore) *apiProber {
+	return &apiProber{
+		log:         log,
+		state:       state,
+		interval:    apiProbeInterval,
+		machinesDir: machinesDir,
+		probe:       apiprobe.Probe,
+		wakeups:     make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: the probe describes the local kubelet.
+func (p *apiProber) NeedLeaderElection() bool { return false }
+
+func (p *apiProber) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-p.wakeups:
+		}
+	}
+}
+
+// wake requests an immediate probe, for example after the host resumed.
+func (p *apiProber) wake() {
+	select {
+	case p.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// Last returns the most recent report, or nil before the first probe.
+func (p *apiProber) Last() *apiprobe.Report {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+func (p *apiProber) run(ctx context.Context) {
+	state, err := p.state.Load(ctx)
+	if err != nil || state == nil || state.ActiveMachine == "" {
+		return
+	}
+	target, err := apiprobe.KubeletTarget(filepath.Join(p.machinesDir, state.ActiveMachine))
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		p.log.Warn("failed to load kubelet kubeconfig for API probe", "error", err)
+		return
+	}
+	report := p.probe(ctx, target)
+
+	p.mu.Lock()
+	previous := p.last
+	p.last = &report
+	p.mu.Unlock()
+
+	switch {
+	case !report.Healthy() && (previous == nil || previous.Failure != report.Failure):
+		p.log.Warn("kube API probe failed", "failure", report.Failure, "message", report.Message, "credentials", report.Source)
+	case report.Healthy() && previous != nil && !previous.Healthy():
+		p.log.Info("kube API probe recovered", "credentials", report.Source)
+	}
+	if previous == nil || !slices.Equal(previous.Warnings, report.Warnings) {
+		for _, warning := range report.Warnings {
+			p.log.Warn("kube API probe warning", "warning", warning)
+		}
+	}
+}
+
+// APIProbeTarget returns the credentials to probe the API server with: the
+// active machine's kubelet kubeconfig once a node is running, otherwise the
+// bootstrap credentials from cfg.
+func APIProbeTarget(ctx context.Context, cfg *config.Config) (apiprobe.Target, error) {
+	store, err := NewFileStateStore(cfg.Instance)
+	if err != nil {
+		return apiprobe.Target{}, err
+	}
+	state, err := store.Load(ctx)
+	if err != nil {
+		return apiprobe.Target{}, err
+	}
+	if state != nil && state.ActiveMachine != "" {
+		target, err := apiprobe.KubeletTarget(filepath.Join(machinesDir, state.ActiveMachine))
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return target, err
+		}
+	}
+	return apiprobe.BootstrapTarget(cfg)
+}
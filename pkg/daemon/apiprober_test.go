@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+)
+
+func TestAPIProberUsesActiveMachineKubeconfig(t *testing.T) {
+	t.Parallel()
+
+	machines := t.TempDir()
+	state := &testStateStore{}
+	var probed []string
+	prober := newAPIProber(slog.New(slog.DiscardHandler), state)
+	prober.machinesDir = machines
+	prober.probe = func(_ context.Context, target apiprobe.Target) apiprobe.Report {
+		probed = append(probed, target.Source)
+		return apiprobe.Report{Source: target.Source, Failure: apiprobe.FailureAuthorization, Message: "denied"}
+	}
+
+	prober.run(t.Context())
+	if prober.Last() != nil || len(probed) != 0 {
+		t.Fatalf("probed %v without an active machine", probed)
+	}
+
+	state.state = &State{ActiveMachine: "kube2"}
+	prober.run(t.Context())
+	if prober.Last() != nil || len(probed) != 0 {
+		t.Fatalf("probed %v before the kubelet kubeconfig exists", probed)
+	}
+
+	kubeconfig := filepath.Join(machines, "kube2", "var", "lib", "kubelet", "kubeconfig")
+	if err := os.MkdirAll(filepath.Dir(kubeconfig), 0o750); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: c
+  cluster:
+    server: https://api.example.test
+users:
+- name: u
+  user:
+    token: abc
+contexts:
+- name: c
+  context:
+    cluster: c
+    user: u
+current-context: c
+`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prober.run(t.Context())
+	if len(probed) != 1 || probed[0] != kubeconfig {
+		t.Fatalf("probed = %v, want %s", probed, kubeconfig)
+	}
+	if last := prober.Last(); last == nil || last.Failure != apiprobe.FailureAuthorization {
+		t.Fatalf("Last = %+v, want the probe report", last)
+	}
+}
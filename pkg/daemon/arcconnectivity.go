@@ -0,0 +1,157 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/arccheck"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+const (
+	// NodeConditionArcEndpointsReachable reports whether the node reaches
+	// every endpoint of the Azure Connected Machine agent, so a firewall
+	// change shows on the Node before Arc connectivity is lost.
+	NodeConditionArcEndpointsReachable corev1.NodeConditionType = "FlexNodeArcEndpointsReachable"
+
+	arcEndpointsReasonReachable = "ArcEndpointsReachable"
+	arcEndpointsReasonBlocked   = "ArcEndpointsBlocked"
+
+	arcConnectivityCheckInterval = 15 * time.Minute
+)
+
+var arcEndpointReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aks_flex_node_arc_endpoint_reachable",
+	Help: "Whether the latest check reached each Azure Arc endpoint (1) or not (0).",
+}, []string{"endpoint"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(arcEndpointReachable)
+}
+
+// arcConnectivityMonitor periodically checks the Arc endpoints and reports
+// blocked ones on a Node condition. It implements manager.Runnable.
+type arcConnectivityMonitor struct {
+	log      *slog.Logger
+	reader   client.Reader
+	client   client.Client
+	nodeName string
+	interval time.Duration
+	check    func(context.Context) arccheck.Report
+	now      func() time.Time
+	wakeups  chan struct{}
+
+	mu   sync.Mutex
+	last *arccheck.Report
+}
+
+func newArcConnectivityMonitor(log *slog.Logger, cfg *config.Config, reader client.Reader, c client.Client, nodeName string) *arcConnectivityMonitor {
+	return &arcConnectivityMonitor{
+		log:      log,
+		reader:   reader,
+		client:   c,
+		nodeName: nodeName,
+		interval: arcConnectivityCheckInterval,
+		check:    arccheck.New(log, cfg).Check,
+		now:      time.Now,
+		wakeups:  make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: every daemon checks its own host.
+func (m *arcConnectivityMonitor) NeedLeaderElection() bool { return false }
+
+func (m *arcConnectivityMonitor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-m.wakeups:
+		}
+	}
+}
+
+// wake requests an immediate check, for example after the host resumed.
+func (m *arcConnectivityMonitor) wake() {
+	select {
+	case m.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// Last returns the latest report, or nil before the first check or when Arc
+// is not enabled.
+func (m *arcConnectivityMonitor) Last() *arccheck.Report {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+func (m *arcConnectivityMonitor) run(ctx context.Context) {
+	report := m.check(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	m.mu.Lock()
+	previous := m.last
+	m.last = &report
+	m.mu.Unlock()
+
+	arcEndpointReachable.Reset()
+	for _, endpoint := range report.Endpoints {
+		value := 0.0
+		if endpoint.Reachable {
+			value = 1
+		}
+		arcEndpointReachable.WithLabelValues(endpoint.Host()).Set(value)
+	}
+
+	blocked := report.Blocked()
+	messages := make([]string, 0, len(blocked))
+	for _, endpoint := range blocked {
+		messages = append(messages, arccheck.BlockedMessage(endpoint))
+	}
+	switch {
+	case len(blocked) > 0 && (previous == nil || !sameBlocked(previous, &report)):
+		m.log.Warn("Azure Arc endpoints are blocked", "source", report.Source, "blocked", messages)
+	case len(blocked) == 0 && previous != nil && !previous.Healthy():
+		m.log.Info("Azure Arc endpoints are reachable again", "source", report.Source)
+	}
+
+	status, reason, message := corev1.ConditionTrue, arcEndpointsReasonReachable, report.Summary()
+	if len(blocked) > 0 {
+		status, reason, message = corev1.ConditionFalse, arcEndpointsReasonBlocked, strings.Join(messages, "\n")
+	}
+	if err := patchNodeCondition(ctx, m.reader, m.client, m.nodeName, m.now(), NodeConditionArcEndpointsReachable, status, reason, message); err != nil {
+		m.log.Warn("failed to update Arc endpoints node condition", "error", err)
+	}
+}
+
+// sameBlocked reports whether two reports block the same endpoints.
+func sameBlocked(a, b *arccheck.Report) bool {
+	hosts := func(r *arccheck.Report) []string {
+		var out []string
+		for _, endpoint := range r.Blocked() {
+			out = append(out, endpoint.Host())
+		}
+		return out
+	}
+	return slices.Equal(hosts(a), hosts(b))
+}
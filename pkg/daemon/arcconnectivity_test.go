@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/arccheck"
+)
+
+func TestArcConnectivityMonitor(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(node).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+
+	report := arccheck.Report{Source: arccheck.SourceAzcmagent, Endpoints: []arccheck.EndpointResult{
+		{Endpoint: "https://gbl.his.arc.azure.com", Reachable: true},
+		{Endpoint: "https://eastus.his.arc.azure.com", Purposes: []string{"Azure Arc identity"}, Error: "i/o timeout"},
+	}}
+	monitor := &arcConnectivityMonitor{
+		log:      slog.New(slog.DiscardHandler),
+		reader:   kubeClient,
+		client:   kubeClient,
+		nodeName: "node1",
+		check:    func(context.Context) arccheck.Report { return report },
+		now:      func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	if monitor.Last() != nil {
+		t.Fatal("Last() before the first check != nil")
+	}
+
+	condition := func() *corev1.NodeCondition {
+		t.Helper()
+		got := &corev1.Node{}
+		if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+			t.Fatalf("get node: %v", err)
+		}
+		for i := range got.Status.Conditions {
+			if got.Status.Conditions[i].Type == NodeConditionArcEndpointsReachable {
+				return &got.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	monitor.run(t.Context())
+	blocked := condition()
+	if blocked == nil || blocked.Status != corev1.ConditionFalse || blocked.Reason != arcEndpointsReasonBlocked {
+		t.Fatalf("condition = %+v, want False with reason %s", blocked, arcEndpointsReasonBlocked)
+	}
+	if !strings.Contains(blocked.Message, "cannot reach eastus.his.arc.azure.com (Azure Arc identity): i/o timeout") {
+		t.Fatalf("condition message = %q, want the blocked endpoint and its purpose", blocked.Message)
+	}
+	if last := monitor.Last(); last == nil || last.Healthy() {
+		t.Fatalf("Last() = %+v, want the unhealthy report", last)
+	}
+
+	report.Endpoints[1].Reachable = true
+	monitor.run(t.Context())
+	if reachable := condition(); reachable == nil || reachable.Status != corev1.ConditionTrue || reachable.Reason != arcEndpointsReasonReachable {
+		t.Fatalf("condition = %+v, want True with reason %s", reachable, arcEndpointsReasonReachable)
+	}
+
+	var nilMonitor *arcConnectivityMonitor
+	if nilMonitor.Last() != nil {
+		t.Fatal("nil monitor Last() != nil")
+	}
+}
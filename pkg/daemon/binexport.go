@@ -0,0 +1,189 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+// profileFragmentPath puts the default instance's wrappers on login shells'
+// PATH. Named instances share the tool names, so their wrappers are only
+// reachable by full path.
+const profileFragmentPath = "/etc/profile.d/aks-flex-node.sh"
+
+// exportedBinaries are the machine tools worth running from the host while
+// debugging a node. nerdctl and jq are only present with nodeTools.enabled.
+var exportedBinaries = []string{"crictl", "ctr", "jq", "kubectl", "nerdctl"}
+
+var binaryWrapperTemplate = template.Must(template.New("wrapper").Parse(`#!/bin/sh
+# Generated by aks-flex-node. Runs {{.Binary}} in the active node machine {{.Machine}}.
+if [ -t 0 ] && [ -t 1 ]; then io=--pty; else io=--pipe; fi
+exec systemd-run --machine={{.Machine}} --quiet --wait --collect "$io" \
+	--setenv=CONTAINERD_NAMESPACE=k8s.io {{.Path}} "$@"
+`))
+
+const profileFragment = `# Generated by aks-flex-node: debugging tools of the active node machine.
+case ":$PATH:" in
+*":%[1]s:"*) ;;
+*) PATH="$PATH:%[1]s" ;;
+esac
+`
+
+type exportBinariesTask struct {
+	log         *slog.Logger
+	enabled     bool
+	machine     string
+	machineDir  string
+	binDir      string
+	profilePath string
+}
+
+// ExportBinaries returns a task that points the host wrappers of the
+// instance's machine tools at machine, which runs from machineDir. Each
+// wrapper is replaced atomically, so a repave never leaves a half-written
+// one. When agent.exportBinaries is unset the task removes any wrappers a
+// previous configuration left behind.
+func ExportBinaries(log *slog.Logger, cfg *config.Config, machine, machineDir string) phases.Task {
+	t := &exportBinariesTask{
+		log:        log,
+		enabled:    cfg.Agent.ExportBinaries,
+		machine:    machine,
+		machineDir: machineDir,
+		binDir:     cfg.Instance.ExportedBinDir(),
+	}
+	if cfg.Instance == "" {
+		t.profilePath = profileFragmentPath
+	}
+	return t
+}
+
+// RemoveExportedBinaries returns a task that removes the instance's host
+// wrappers.
+func RemoveExportedBinaries(log *slog.Logger, instance config.Instance) phases.Task {
+	t := &exportBinariesTask{log: log, binDir: instance.ExportedBinDir()}
+	if instance == "" {
+		t.profilePath = profileFragmentPath
+	}
+	return t
+}
+
+func (t *exportBinariesTask) Name() string { return "export-binaries" }
+
+// Plan returns the wrapper directory and the login shell profile fragment.
+func (t *exportBinariesTask) Plan() []string {
+	if !t.enabled {
+		return nil
+	}
+	paths := []string{t.binDir}
+	if t.profilePath != "" {
+		paths = append(paths, t.profilePath)
+	}
+	return paths
+}
+
+func (t *exportBinariesTask) Do(ctx context.Context) error {
+	if !t.enabled {
+		return t.remove(ctx)
+	}
+
+	var exported []string
+	for _, binary := range exportedBinaries {
+		path := "/" + filepath.Join(goalstates.BinDir, binary)
+		if _, err := os.Stat(filepath.Join(t.machineDir, path)); err != nil {
+			continue
+		}
+		var wrapper strings.Builder
+		if err := binaryWrapperTemplate.Execute(&wrapper, map[string]string{"Binary": binary, "Machine": t.machine, "Path": path}); err != nil {
+			return fmt.Errorf("render %s wrapper: %w", binary, err)
+		}
+		if err := t.write(ctx, filepath.Join(t.binDir, binary), []byte(wrapper.String()), 0o750); err != nil {
+			return fmt.Errorf("write %s wrapper: %w", binary, err)
+		}
+		exported = append(exported, binary)
+	}
+	if err := t.removeStale(ctx, exported); err != nil {
+		return err
+	}
+	if t.profilePath != "" {
+		if err := t.write(ctx, t.profilePath, fmt.Appendf(nil, profileFragment, t.binDir), 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", t.profilePath, err)
+		}
+	}
+	t.log.Info("exported machine binaries", "dir", t.binDir, "machine", t.machine, "binaries", exported)
+	return nil
+}
+
+// removeStale deletes wrappers for tools the machine no longer ships.
+func (t *exportBinariesTask) removeStale(ctx context.Context, exported []string) error {
+	entries, err := os.ReadDir(t.binDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("list %s: %w", t.binDir, err)
+	}
+	for _, entry := range entries {
+		if slices.Contains(exported, entry.Name()) {
+			continue
+		}
+		if err := t.removeFile(ctx, filepath.Join(t.binDir, entry.Name())); err != nil {
+			return fmt.Errorf("remove stale wrapper: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *exportBinariesTask) remove(ctx context.Context) error {
+	if err := t.removeStale(ctx, nil); err != nil {
+		return err
+	}
+	if err := os.Remove(t.binDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove %s: %w", t.binDir, err)
+	}
+	if t.profilePath != "" {
+		if err := t.removeFile(ctx, t.profilePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write replaces path with content unless it already holds it, and audits
+// the change.
+func (t *exportBinariesTask) write(ctx context.Context, path string, content []byte, mode os.FileMode) error {
+	before := audit.HashFile(path)
+	after := audit.HashBytes(content)
+	if before == after {
+		return nil
+	}
+	if err := utilio.WriteFile(path, content, mode); err != nil {
+		return err
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: after, Detail: "machine " + t.machine})
+	return nil
+}
+
+// removeFile removes path if it exists and audits the removal.
+func (t *exportBinariesTask) removeFile(ctx context.Context, path string) error {
+	before := audit.HashFile(path)
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: before})
+	return nil
+}
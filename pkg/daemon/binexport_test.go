@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportBinaries(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	machineDir := filepath.Join(root, "machines", "kube2")
+	for _, binary := range []string{"crictl", "kubectl", "kubelet"} {
+		writeScript(t, filepath.Join(machineDir, "usr/local/bin", binary), "true")
+	}
+	binDir := filepath.Join(root, "sbin", "aks-flex")
+	writeScript(t, filepath.Join(binDir, "ctr"), "stale")
+	profilePath := filepath.Join(root, "profile.d", "aks-flex-node.sh")
+
+	task := &exportBinariesTask{
+		log:         slog.New(slog.DiscardHandler),
+		enabled:     true,
+		machine:     "kube2",
+		machineDir:  machineDir,
+		binDir:      binDir,
+		profilePath: profilePath,
+	}
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(binDir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if got := strings.Join(names, ","); got != "crictl,kubectl" {
+		t.Fatalf("wrappers = %s, want crictl,kubectl without the stale ctr", got)
+	}
+	wrapper, err := os.ReadFile(filepath.Join(binDir, "crictl"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(wrapper), "--machine=kube2") || !strings.Contains(string(wrapper), `/usr/local/bin/crictl "$@"`) {
+		t.Fatalf("crictl wrapper =\n%s\nwant it to run /usr/local/bin/crictl in kube2", wrapper)
+	}
+	profile, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(profile), `PATH="$PATH:`+binDir+`"`) {
+		t.Fatalf("profile fragment =\n%s\nwant %s appended to PATH", profile, binDir)
+	}
+
+	task.enabled = false
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do() disabled error = %v", err)
+	}
+	for _, path := range []string{binDir, profilePath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("stat %s = %v, want it removed when export is disabled", path, err)
+		}
+	}
+}
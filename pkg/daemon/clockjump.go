@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	clockCheckInterval = 15 * time.Second
+	// clockJumpThreshold is how far wall-clock time may drift from monotonic
+	// time between two checks before it is treated as a suspend/resume or a
+	// clock step. NTP slewing stays far below this.
+	clockJumpThreshold = time.Minute
+)
+
+// clockJumpDetector notices host suspend/resume and wall-clock steps. Go
+// timers run on the monotonic clock, which on Linux stops while the host is
+// suspended, so after a laptop or WSL host wakes every periodic loop would
+// otherwise wait out its remaining interval as if no time had passed. The
+// detector compares wall-clock and monotonic elapsed time and wakes the
+// registered loops immediately when they diverge. It implements
+// manager.Runnable.
+type clockJumpDetector struct {
+	log      *slog.Logger
+	interval time.Duration
+	hooks    []func()
+
+	lastWall time.Time
+	lastMono time.Time
+}
+
+func newClockJumpDetector(log *slog.Logger, hooks ...func()) *clockJumpDetector {
+	return &clockJumpDetector{log: log, interval: clockCheckInterval, hooks: hooks}
+}
+
+// NeedLeaderElection reports false: clock jumps are local to the host.
+func (d *clockJumpDetector) NeedLeaderElection() bool { return false }
+
+func (d *clockJumpDetector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	d.reset(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			jump := d.observe(now)
+			if jump == 0 {
+				continue
+			}
+			d.log.Info("wall clock jumped; waking daemon loops", "jump", jump.Round(time.Second))
+			for _, hook := range d.hooks {
+				hook()
+			}
+		}
+	}
+}
+
+func (d *clockJumpDetector) reset(now time.Time) {
+	d.lastWall = now.Round(0)
+	d.lastMono = now
+}
+
+// observe returns the wall-clock jump since the previous observation, or zero
+// when wall and monotonic elapsed time agree within clockJumpThreshold.
+func (d *clockJumpDetector) observe(now time.Time) time.Duration {
+	wallElapsed := now.Round(0).Sub(d.lastWall)
+	monoElapsed := now.Sub(d.lastMono)
+	d.reset(now)
+
+	jump := wallElapsed - monoElapsed
+	if jump < clockJumpThreshold && jump > -clockJumpThreshold {
+		return 0
+	}
+	return jump
+}
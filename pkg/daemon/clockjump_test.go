@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestClockJumpDetectorObserve(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// wallShift moves the previous wall-clock reading relative to the
+		// monotonic one, simulating time that passed (or was undone) while
+		// monotonic time did not advance.
+		wallShift time.Duration
+		want      time.Duration
+	}{
+		{name: "steady clock", wallShift: 0, want: 0},
+		{name: "ntp slew", wallShift: -2 * time.Second, want: 0},
+		{name: "resume after suspend", wallShift: -8 * time.Hour, want: 8 * time.Hour},
+		{name: "clock stepped backwards", wallShift: 5 * time.Minute, want: -5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			d := newClockJumpDetector(slog.New(slog.DiscardHandler))
+			start := time.Now()
+			d.reset(start)
+			d.lastWall = d.lastWall.Add(tt.wallShift)
+
+			if got := d.observe(start.Add(clockCheckInterval)); got != tt.want {
+				t.Fatalf("observe = %v, want %v", got, tt.want)
+			}
+			if got := d.observe(start.Add(2 * clockCheckInterval)); got != 0 {
+				t.Fatalf("second observe = %v, want 0 after resync", got)
+			}
+		})
+	}
+}
+
+func TestRepaveReconcilerWakeCoalesces(t *testing.T) {
+	t.Parallel()
+
+	r := &repaveReconciler{machineEvents: make(chan event.TypedGenericEvent[struct{}], 1)}
+	r.wake()
+	r.wake()
+	r.wake()
+	if got := len(r.machineEvents); got != 1 {
+		t.Fatalf("pending machine events = %d, want 1", got)
+	}
+}
@@ -0,0 +1,435 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v8"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases/nodestart"
+)
+
+const (
+	clusterEndpointFileName = "cluster-endpoint.json"
+
+	// NodeConditionClusterEndpointRotating is True while the node moves to a
+	// rotated cluster CA or a changed API server endpoint, so alerts can
+	// fire on nodes stuck in the transition.
+	NodeConditionClusterEndpointRotating corev1.NodeConditionType = "FlexNodeClusterEndpointRotating"
+
+	clusterEndpointReasonCARotated       = "ClusterCARotated"
+	clusterEndpointReasonEndpointChanged = "APIServerEndpointChanged"
+	clusterEndpointReasonFailed          = "ClusterEndpointRotationFailed"
+	clusterEndpointReasonCurrent         = "ClusterEndpointCurrent"
+)
+
+// errClusterEndpointPinned stops the daemon after a new endpoint was pinned,
+// so systemd restarts it with clients that trust the new CA.
+var errClusterEndpointPinned = errors.New("cluster endpoint changed; restarting the agent to use it")
+
+// ClusterEndpoint is where the node reaches the cluster's API server and the
+// CA it trusts there.
+type ClusterEndpoint struct {
+	// ClusterFQDN is the API server host, in the form of
+	// node.kubelet.clusterFQDN.
+	ClusterFQDN string `json:"clusterFQDN"`
+	// CACertData is the base64-encoded PEM bundle of the cluster CA.
+	CACertData string `json:"caCertData"`
+}
+
+// clusterEndpointPin records the endpoint the daemon last moved the node to.
+// It overrides node.kubelet.clusterFQDN and caCertData from the config file,
+// which still hold the values the node joined with.
+type clusterEndpointPin struct {
+	ClusterEndpoint
+	PinnedAt time.Time `json:"pinnedAt"`
+	// Rotating is true from pinning the endpoint until the restarted daemon
+	// reached the cluster with it.
+	Rotating bool `json:"rotating,omitempty"`
+}
+
+// clusterEndpointStore persists the pin so it survives daemon restarts.
+type clusterEndpointStore struct {
+	path string
+}
+
+func newClusterEndpointStore(path string) *clusterEndpointStore {
+	return &clusterEndpointStore{path: path}
+}
+
+func (s *clusterEndpointStore) Load() (*clusterEndpointPin, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read cluster endpoint pin %s: %w", s.path, err)
+	}
+	var pin clusterEndpointPin
+	if err := json.Unmarshal(data, &pin); err != nil {
+		return nil, fmt.Errorf("decode cluster endpoint pin %s: %w", s.path, err)
+	}
+	return &pin, nil
+}
+
+func (s *clusterEndpointStore) Save(pin *clusterEndpointPin) error {
+	data, err := json.MarshalIndent(pin, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode cluster endpoint pin: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("write cluster endpoint pin %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// applyClusterEndpointPin points cfg at the pinned endpoint, if any. The
+// daemon calls it before building any client from cfg.
+func applyClusterEndpointPin(cfg *config.Config, store *clusterEndpointStore) (*clusterEndpointPin, error) {
+	pin, err := store.Load()
+	if err != nil || pin == nil {
+		return nil, err
+	}
+	cfg.Node.Kubelet.ClusterFQDN = pin.ClusterFQDN
+	cfg.Node.Kubelet.CACertData = pin.CACertData
+	return pin, nil
+}
+
+// clusterEndpointChange describes how observed differs from current, or
+// returns an empty reason when the node already uses observed.
+func clusterEndpointChange(current, observed ClusterEndpoint) (reason, message string) {
+	moved := apiServerHost(current.ClusterFQDN) != apiServerHost(observed.ClusterFQDN)
+	rotated := !sameCABundle(current.CACertData, observed.CACertData)
+	switch {
+	case moved && rotated:
+		return clusterEndpointReasonEndpointChanged, fmt.Sprintf("API server moved from %s to %s and the cluster CA was rotated", current.ClusterFQDN, observed.ClusterFQDN)
+	case moved:
+		return clusterEndpointReasonEndpointChanged, fmt.Sprintf("API server moved from %s to %s", current.ClusterFQDN, observed.ClusterFQDN)
+	case rotated:
+		return clusterEndpointReasonCARotated, "the cluster CA was rotated"
+	}
+	return "", ""
+}
+
+// apiServerHost normalizes a cluster FQDN, with or without a scheme and
+// port, to a lowercase host:port.
+func apiServerHost(fqdn string) string {
+	host := strings.TrimSpace(fqdn)
+	if strings.Contains(host, "://") {
+		if parsed, err := url.Parse(host); err == nil {
+			host = parsed.Host
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "443")
+	}
+	return strings.ToLower(host)
+}
+
+func sameCABundle(a, b string) bool {
+	decodedA, errA := base64.StdEncoding.DecodeString(a)
+	decodedB, errB := base64.StdEncoding.DecodeString(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return bytes.Equal(bytes.TrimSpace(decodedA), bytes.TrimSpace(decodedB))
+}
+
+// clusterEndpointFromKubeconfig reads the endpoint of the current context of
+// a kubeconfig returned by the managed cluster.
+func clusterEndpointFromKubeconfig(data []byte) (ClusterEndpoint, error) {
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return ClusterEndpoint{}, fmt.Errorf("parse cluster kubeconfig: %w", err)
+	}
+	current := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if current == nil || kubeconfig.Clusters[current.Cluster] == nil {
+		return ClusterEndpoint{}, fmt.Errorf("cluster kubeconfig has no current cluster")
+	}
+	cluster := kubeconfig.Clusters[current.Cluster]
+	server, err := url.Parse(cluster.Server)
+	if err != nil || server.Host == "" {
+		return ClusterEndpoint{}, fmt.Errorf("cluster kubeconfig has an invalid server %q", cluster.Server)
+	}
+	if len(cluster.CertificateAuthorityData) == 0 {
+		return ClusterEndpoint{}, fmt.Errorf("cluster kubeconfig has no CA data")
+	}
+	return ClusterEndpoint{
+		ClusterFQDN: server.Host,
+		CACertData:  base64.StdEncoding.EncodeToString(cluster.CertificateAuthorityData),
+	}, nil
+}
+
+// clusterEndpointSource reads the cluster's current endpoint.
+type clusterEndpointSource interface {
+	ClusterEndpoint(ctx context.Context) (ClusterEndpoint, error)
+}
+
+// managedClusterEndpoints reads the endpoint from the user kubeconfig the
+// managed cluster returns, which carries the CA bundle the cluster serves.
+type managedClusterEndpoints struct {
+	log     *slog.Logger
+	cfg     *config.Config
+	clients *armcontainerservice.ManagedClustersClient
+}
+
+func (s *managedClusterEndpoints) ClusterEndpoint(ctx context.Context) (ClusterEndpoint, error) {
+	cluster := s.cfg.Azure.TargetCluster
+	if s.clients == nil {
+		cred, err := aksmachine.NewCredential(s.cfg, s.log)
+		if err != nil {
+			return ClusterEndpoint{}, fmt.Errorf("resolve managed cluster credential: %w", err)
+		}
+		clients, err := armcontainerservice.NewManagedClustersClient(cluster.SubscriptionID, cred, azclient.ARMClientOptionsFromConfig(s.cfg))
+		if err != nil {
+			return ClusterEndpoint{}, fmt.Errorf("create managed clusters client: %w", err)
+		}
+		s.clients = clients
+	}
+	resp, err := s.clients.ListClusterUserCredentials(ctx, cluster.ResourceGroup, cluster.Name, nil)
+	if err != nil {
+		return ClusterEndpoint{}, fmt.Errorf("list credentials of cluster %s: %w", cluster.Name, err)
+	}
+	for _, kubeconfig := range resp.Kubeconfigs {
+		if kubeconfig != nil && len(kubeconfig.Value) > 0 {
+			return clusterEndpointFromKubeconfig(kubeconfig.Value)
+		}
+	}
+	return ClusterEndpoint{}, fmt.Errorf("cluster %s returned no kubeconfig", cluster.Name)
+}
+
+// clusterEndpointWatcher moves the node to a rotated cluster CA or a changed
+// API server endpoint. When the managed cluster reports a different endpoint
+// than the node uses, it sets NodeConditionClusterEndpointRotating, writes
+// the new CA and server into the active machine, restarts the kubelet, pins
+// the endpoint, and stops the daemon so systemd restarts it with the pin.
+// The restarted daemon clears the condition once it reaches the cluster. It
+// implements manager.Runnable.
+type clusterEndpointWatcher struct {
+	log         *slog.Logger
+	cfg         *config.Config
+	source      clusterEndpointSource
+	store       *clusterEndpointStore
+	state       stateStore
+	reader      client.Reader
+	client      client.Client
+	nodeName    string
+	recorder    *nodeRecorder
+	interval    time.Duration
+	machinesDir string
+	now         func() time.Time
+	// restartKubelet restarts the machine's kubelet and waits for it; tests
+	// replace it.
+	restartKubelet func(ctx context.Context, machine string) error
+}
+
+func newClusterEndpointWatcher(log *slog.Logger, cfg *config.Config, store *clusterEndpointStore, state stateStore,
+	reader client.Reader, c client.Client, nodeName string, recorder *nodeRecorder) *clusterEndpointWatcher {
+	return &clusterEndpointWatcher{
+		log:         log,
+		cfg:         cfg,
+		source:      &managedClusterEndpoints{log: log, cfg: cfg},
+		store:       store,
+		state:       state,
+		reader:      reader,
+		client:      c,
+		nodeName:    nodeName,
+		recorder:    recorder,
+		interval:    time.Duration(cfg.Agent.ClusterEndpoint.Interval),
+		machinesDir: machinesDir,
+		now:         time.Now,
+		restartKubelet: func(ctx context.Context, machine string) error {
+			if err := restartKubelet(log, machine).Do(ctx); err != nil {
+				return err
+			}
+			return nodestart.WaitForKubelet(log, machine).Do(ctx)
+		},
+	}
+}
+
+// NeedLeaderElection reports false: the endpoint is that of the local kubelet.
+func (w *clusterEndpointWatcher) NeedLeaderElection() bool { return false }
+
+func (w *clusterEndpointWatcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if err := w.check(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check compares the managed cluster's endpoint with the one in use. It
+// returns errClusterEndpointPinned once the node moved to a new endpoint, and
+// an error when the moved node's endpoint could not be pinned; every other
+// failure is logged and retried on the next check.
+func (w *clusterEndpointWatcher) check(ctx context.Context) error {
+	observed, err := w.source.ClusterEndpoint(ctx)
+	if err != nil {
+		w.log.Warn("failed to read the cluster endpoint", "error", err)
+		return nil
+	}
+	current := ClusterEndpoint{ClusterFQDN: w.cfg.Node.Kubelet.ClusterFQDN, CACertData: w.cfg.Node.Kubelet.CACertData}
+	reason, message := clusterEndpointChange(current, observed)
+	if reason == "" {
+		w.finishRotation(ctx)
+		return nil
+	}
+
+	w.log.Warn("cluster endpoint changed; moving the node to it", "reason", reason, "message", message)
+	clusterEndpointRotatingGauge.Set(1)
+	w.setCondition(ctx, corev1.ConditionTrue, reason, message)
+	w.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonClusterEndpointRotating, message)
+	if err := w.retarget(ctx, observed); err != nil {
+		w.log.Warn("failed to move the node to the new cluster endpoint", "error", err)
+		w.setCondition(ctx, corev1.ConditionTrue, clusterEndpointReasonFailed, fmt.Sprintf("%s; moving the node failed: %v", message, err))
+		return nil
+	}
+	if err := w.store.Save(&clusterEndpointPin{ClusterEndpoint: observed, PinnedAt: w.now(), Rotating: true}); err != nil {
+		// The machine already uses the new endpoint; a daemon that kept
+		// running with the old one would retarget it on every check.
+		w.setCondition(ctx, corev1.ConditionTrue, clusterEndpointReasonFailed, fmt.Sprintf("%s; pinning the new endpoint failed: %v", message, err))
+		return fmt.Errorf("pin the new cluster endpoint: %w", err)
+	}
+	return errClusterEndpointPinned
+}
+
+// retarget writes the new CA and server into the active machine and restarts
+// its kubelet. Before the first node has been started there is no machine;
+// the pin alone points the next start at the new endpoint.
+func (w *clusterEndpointWatcher) retarget(ctx context.Context, endpoint ClusterEndpoint) error {
+	state, err := w.state.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.ActiveMachine == "" {
+		return nil
+	}
+	machineDir := filepath.Join(w.machinesDir, state.ActiveMachine)
+	if err := retargetMachine(machineDir, endpoint); err != nil {
+		return err
+	}
+	return w.restartKubelet(ctx, state.ActiveMachine)
+}
+
+// retargetMachine replaces the cluster CA in machineDir and the server of the
+// kubelet's kubeconfigs, leaving their credentials as they are.
+func retargetMachine(machineDir string, endpoint ClusterEndpoint) error {
+	ca, err := base64.StdEncoding.DecodeString(endpoint.CACertData)
+	if err != nil {
+		return fmt.Errorf("decode cluster CA: %w", err)
+	}
+	caPath := filepath.Join(machineDir, goalstates.KubeletAPIServerCACertPath)
+	if err := utilio.WriteFile(caPath, ca, 0o644); err != nil {
+		return fmt.Errorf("write cluster CA %s: %w", caPath, err)
+	}
+	server := "https://" + apiServerHost(endpoint.ClusterFQDN)
+	for _, name := range []string{goalstates.KubeletKubeconfigPath, goalstates.KubeletBootstrapKubeconfigPath} {
+		path := filepath.Join(machineDir, name)
+		kubeconfig, err := clientcmd.LoadFromFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("load kubeconfig %s: %w", path, err)
+		}
+		for _, cluster := range kubeconfig.Clusters {
+			cluster.Server = server
+			if len(cluster.CertificateAuthorityData) > 0 {
+				cluster.CertificateAuthorityData = ca
+			}
+		}
+		if err := clientcmd.WriteToFile(*kubeconfig, path); err != nil {
+			return fmt.Errorf("write kubeconfig %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// finishRotation clears the condition once the daemon runs with the endpoint
+// the managed cluster reports. Setting the condition also proves the daemon
+// reaches the API server with it. The Node is only patched when a rotation
+// finishes or the condition does not read current yet, not on every check.
+func (w *clusterEndpointWatcher) finishRotation(ctx context.Context) {
+	clusterEndpointRotatingGauge.Set(0)
+	pin, err := w.store.Load()
+	if err != nil {
+		w.log.Warn("failed to load the cluster endpoint pin", "error", err)
+		return
+	}
+	rotating := pin != nil && pin.Rotating
+	if !rotating {
+		current, err := w.conditionCurrent(ctx)
+		if err != nil {
+			w.log.Warn("failed to read node condition", "condition", NodeConditionClusterEndpointRotating, "error", err)
+			return
+		}
+		if current {
+			return
+		}
+	}
+	if err := patchNodeCondition(ctx, w.reader, w.client, w.nodeName, w.now(), NodeConditionClusterEndpointRotating,
+		corev1.ConditionFalse, clusterEndpointReasonCurrent, "the node uses the cluster's current API server endpoint and CA"); err != nil {
+		w.log.Warn("failed to set node condition", "condition", NodeConditionClusterEndpointRotating, "error", err)
+		return
+	}
+	if !rotating {
+		return
+	}
+	pin.Rotating = false
+	if err := w.store.Save(pin); err != nil {
+		w.log.Warn("failed to record the finished cluster endpoint rotation", "error", err)
+		return
+	}
+	w.log.Info("moved the node to the new cluster endpoint", "clusterFQDN", pin.ClusterFQDN)
+	w.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonClusterEndpointRotated,
+		fmt.Sprintf("Node moved to the cluster endpoint %s and its current CA", pin.ClusterFQDN))
+}
+
+// conditionCurrent reports whether the Node already shows the endpoint as
+// current.
+func (w *clusterEndpointWatcher) conditionCurrent(ctx context.Context) (bool, error) {
+	node := &corev1.Node{}
+	if err := w.reader.Get(ctx, client.ObjectKey{Name: w.nodeName}, node); err != nil {
+		return false, fmt.Errorf("get node %s: %w", w.nodeName, err)
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == NodeConditionClusterEndpointRotating {
+			return condition.Status == corev1.ConditionFalse && condition.Reason == clusterEndpointReasonCurrent, nil
+		}
+	}
+	return false, nil
+}
+
+func (w *clusterEndpointWatcher) setCondition(ctx context.Context, status corev1.ConditionStatus, reason, message string) {
+	if err := patchNodeCondition(ctx, w.reader, w.client, w.nodeName, w.now(), NodeConditionClusterEndpointRotating, status, reason, message); err != nil {
+		// With a rotated CA the daemon's own client may no longer reach the
+		// API server; the restarted daemon reports the outcome.
+		w.log.Warn("failed to set node condition", "condition", NodeConditionClusterEndpointRotating, "error", err)
+	}
+}
@@ -0,0 +1,227 @@
+package daemon
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+)
+
+type fakeClusterEndpoints struct {
+	endpoint ClusterEndpoint
+	err      error
+}
+
+func (f *fakeClusterEndpoints) ClusterEndpoint(context.Context) (ClusterEndpoint, error) {
+	return f.endpoint, f.err
+}
+
+func encodeCA(pem string) string { return base64.StdEncoding.EncodeToString([]byte(pem)) }
+
+func TestClusterEndpointChange(t *testing.T) {
+	t.Parallel()
+
+	current := ClusterEndpoint{ClusterFQDN: "contoso.hcp.eastus.azmk8s.io", CACertData: encodeCA("old-ca\n")}
+	for _, tc := range []struct {
+		name       string
+		observed   ClusterEndpoint
+		wantReason string
+	}{
+		{name: "same with port", observed: ClusterEndpoint{ClusterFQDN: "Contoso.hcp.eastus.azmk8s.io:443", CACertData: encodeCA("old-ca")}},
+		{name: "same as URL", observed: ClusterEndpoint{ClusterFQDN: "https://contoso.hcp.eastus.azmk8s.io", CACertData: current.CACertData}},
+		{name: "CA rotated", observed: ClusterEndpoint{ClusterFQDN: current.ClusterFQDN, CACertData: encodeCA("new-ca")}, wantReason: clusterEndpointReasonCARotated},
+		{name: "endpoint moved", observed: ClusterEndpoint{ClusterFQDN: "10.0.0.9:443", CACertData: current.CACertData}, wantReason: clusterEndpointReasonEndpointChanged},
+		{name: "both", observed: ClusterEndpoint{ClusterFQDN: "10.0.0.9", CACertData: encodeCA("new-ca")}, wantReason: clusterEndpointReasonEndpointChanged},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if reason, message := clusterEndpointChange(current, tc.observed); reason != tc.wantReason || (reason != "") != (message != "") {
+				t.Fatalf("clusterEndpointChange() = %q, %q, want reason %q", reason, message, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestClusterEndpointFromKubeconfig(t *testing.T) {
+	t.Parallel()
+
+	data, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"contoso": {Server: "https://contoso-priv.privatelink.eastus.azmk8s.io:443", CertificateAuthorityData: []byte("ca")},
+		},
+		Contexts:       map[string]*clientcmdapi.Context{"contoso": {Cluster: "contoso"}},
+		CurrentContext: "contoso",
+	})
+	if err != nil {
+		t.Fatalf("write kubeconfig: %v", err)
+	}
+	endpoint, err := clusterEndpointFromKubeconfig(data)
+	if err != nil {
+		t.Fatalf("clusterEndpointFromKubeconfig: %v", err)
+	}
+	if want := (ClusterEndpoint{ClusterFQDN: "contoso-priv.privatelink.eastus.azmk8s.io:443", CACertData: encodeCA("ca")}); endpoint != want {
+		t.Fatalf("endpoint = %+v, want %+v", endpoint, want)
+	}
+	if _, err := clusterEndpointFromKubeconfig([]byte("apiVersion: v1\nkind: Config\n")); err == nil {
+		t.Fatal("clusterEndpointFromKubeconfig() without a current context succeeded")
+	}
+}
+
+func TestClusterEndpointWatcherRotation(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+	machines := t.TempDir()
+	kubeconfigPath := filepath.Join(machines, "kube1", goalstates.KubeletKubeconfigPath)
+	if err := os.MkdirAll(filepath.Dir(kubeconfigPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientcmd.WriteToFile(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"cluster": {Server: "https://contoso.hcp.eastus.azmk8s.io:443", CertificateAuthority: goalstates.KubeletAPIServerCACertPath}},
+		Contexts:       map[string]*clientcmdapi.Context{"default": {Cluster: "cluster"}},
+		CurrentContext: "default",
+	}, kubeconfigPath); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Node.Kubelet.ClusterFQDN = "contoso.hcp.eastus.azmk8s.io"
+	cfg.Node.Kubelet.CACertData = encodeCA("old-ca")
+	store := newClusterEndpointStore(filepath.Join(t.TempDir(), clusterEndpointFileName))
+	source := &fakeClusterEndpoints{err: errors.New("ARM unavailable")}
+	var restarted []string
+	newWatcher := func() *clusterEndpointWatcher {
+		w := newClusterEndpointWatcher(slog.New(slog.DiscardHandler), cfg, store, &testStateStore{state: &State{ActiveMachine: "kube1"}}, kubeClient, kubeClient, "node1", nil)
+		w.source = source
+		w.machinesDir = machines
+		w.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+		w.restartKubelet = func(_ context.Context, machine string) error {
+			restarted = append(restarted, machine)
+			return nil
+		}
+		return w
+	}
+
+	// A failed read leaves the node as it is.
+	if err := newWatcher().check(t.Context()); err != nil {
+		t.Fatalf("check() with ARM unavailable = %v", err)
+	}
+
+	source.err = nil
+	source.endpoint = ClusterEndpoint{ClusterFQDN: "contoso-priv.privatelink.eastus.azmk8s.io:443", CACertData: encodeCA("new-ca")}
+	if err := newWatcher().check(t.Context()); !errors.Is(err, errClusterEndpointPinned) {
+		t.Fatalf("check() after rotation = %v, want errClusterEndpointPinned", err)
+	}
+	if len(restarted) != 1 || restarted[0] != "kube1" {
+		t.Fatalf("restarted = %v, want kube1", restarted)
+	}
+	if ca, err := os.ReadFile(filepath.Join(machines, "kube1", goalstates.KubeletAPIServerCACertPath)); err != nil || string(ca) != "new-ca" {
+		t.Fatalf("machine CA = %q, %v", ca, err)
+	}
+	kubeconfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		t.Fatalf("load kubeconfig: %v", err)
+	}
+	if got := kubeconfig.Clusters["cluster"]; got.Server != "https://contoso-priv.privatelink.eastus.azmk8s.io:443" || got.CertificateAuthority != goalstates.KubeletAPIServerCACertPath {
+		t.Fatalf("kubeconfig cluster = %+v", got)
+	}
+	assertClusterEndpointCondition(t, kubeClient, corev1.ConditionTrue, clusterEndpointReasonEndpointChanged)
+
+	// The restarted daemon runs with the pin and finishes the rotation.
+	pin, err := applyClusterEndpointPin(cfg, store)
+	if err != nil || pin == nil || !pin.Rotating {
+		t.Fatalf("applyClusterEndpointPin() = %+v, %v", pin, err)
+	}
+	if cfg.Node.Kubelet.ClusterFQDN != source.endpoint.ClusterFQDN || cfg.Node.Kubelet.CACertData != source.endpoint.CACertData {
+		t.Fatalf("pinned kubelet config = %s, %s", cfg.Node.Kubelet.ClusterFQDN, cfg.Node.Kubelet.CACertData)
+	}
+	if err := newWatcher().check(t.Context()); err != nil {
+		t.Fatalf("check() after restart = %v", err)
+	}
+	assertClusterEndpointCondition(t, kubeClient, corev1.ConditionFalse, clusterEndpointReasonCurrent)
+	if pin, err := store.Load(); err != nil || pin == nil || pin.Rotating {
+		t.Fatalf("pin after rotation = %+v, %v", pin, err)
+	}
+	if len(restarted) != 1 {
+		t.Fatalf("restarted = %v after the rotation finished", restarted)
+	}
+
+	// Later checks leave the current condition alone.
+	later := newWatcher()
+	later.now = func() time.Time { return time.Date(2026, 1, 2, 4, 0, 0, 0, time.UTC) }
+	if err := later.check(t.Context()); err != nil {
+		t.Fatalf("check() after the rotation = %v", err)
+	}
+	node := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, node); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == NodeConditionClusterEndpointRotating && !condition.LastHeartbeatTime.Time.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Fatalf("%s heartbeat = %v, want the node left unpatched", condition.Type, condition.LastHeartbeatTime)
+		}
+	}
+}
+
+func TestClusterEndpointWatcherPinFailure(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+	// A regular file where the pin's directory should be makes Save fail.
+	blocker := filepath.Join(t.TempDir(), "state")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Node.Kubelet.ClusterFQDN = "contoso.hcp.eastus.azmk8s.io"
+	cfg.Node.Kubelet.CACertData = encodeCA("old-ca")
+	w := newClusterEndpointWatcher(slog.New(slog.DiscardHandler), cfg, newClusterEndpointStore(filepath.Join(blocker, clusterEndpointFileName)),
+		&testStateStore{}, kubeClient, kubeClient, "node1", nil)
+	w.source = &fakeClusterEndpoints{endpoint: ClusterEndpoint{ClusterFQDN: cfg.Node.Kubelet.ClusterFQDN, CACertData: encodeCA("new-ca")}}
+	w.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	err := w.check(t.Context())
+	if err == nil || errors.Is(err, errClusterEndpointPinned) {
+		t.Fatalf("check() with an unwritable pin = %v, want the save error", err)
+	}
+	assertClusterEndpointCondition(t, kubeClient, corev1.ConditionTrue, clusterEndpointReasonFailed)
+}
+
+func assertClusterEndpointCondition(t *testing.T, reader client.Reader, status corev1.ConditionStatus, reason string) {
+	t.Helper()
+	node := &corev1.Node{}
+	if err := reader.Get(t.Context(), client.ObjectKey{Name: "node1"}, node); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == NodeConditionClusterEndpointRotating {
+			if condition.Status != status || condition.Reason != reason {
+				t.Fatalf("%s = %s/%s, want %s/%s", condition.Type, condition.Status, condition.Reason, status, reason)
+			}
+			return
+		}
+	}
+	t.Fatalf("node has no %s condition", NodeConditionClusterEndpointRotating)
+}
@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/posture"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	complianceFactsFileName = "compliance-facts.json"
+
+	// complianceFactsSchemaVersion is bumped when a fact is renamed or
+	// changes meaning, so policies can require the shape they were written
+	// for.
+	complianceFactsSchemaVersion = 1
+)
+
+// ComplianceFacts are the agent-managed facts of a node, written as a flat
+// JSON object for Azure Policy guest configuration packages to audit, such
+// as "flex nodes must run kubelet >= X".
+type ComplianceFacts struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	NodeName      string `json:"nodeName"`
+	posture.Report
+	// SettingsVersion is the applied AKS machine settings version.
+	SettingsVersion   string `json:"settingsVersion,omitempty"`
+	ContainerdVersion string `json:"containerdVersion,omitempty"`
+	RuncVersion       string `json:"runcVersion,omitempty"`
+	MaintenanceMode   bool   `json:"maintenanceMode"`
+}
+
+// complianceFactsWriter periodically collects ComplianceFacts and writes them
+// to a world-readable file under the instance's state root. It implements
+// manager.Runnable.
+type complianceFactsWriter struct {
+	log         *slog.Logger
+	cfg         *config.Config
+	path        string
+	interval    time.Duration
+	state       stateStore
+	manifests   *ManifestStore
+	maintenance *maintenanceManager
+	collect     func() (*posture.Report, error)
+	// componentVersions resolves the containerd and runc versions of a
+	// machine's goal state.
+	componentVersions func(cfg *config.Config, machine string) (containerd, runc string, err error)
+}
+
+func newComplianceFactsWriter(log *slog.Logger, cfg *config.Config, state stateStore, maintenance *maintenanceManager) *complianceFactsWriter {
+	return &complianceFactsWriter{
+		log:         log,
+		cfg:         cfg,
+		path:        filepath.Join(cfg.Instance.StateDir(), complianceFactsFileName),
+		interval:    time.Duration(cfg.Agent.ComplianceFacts.Interval),
+		state:       state,
+		manifests:   NewManifestStore(cfg.Instance),
+		maintenance: maintenance,
+		collect:     posture.NewCollector(utilhost.HostRoot).Collect,
+		componentVersions: func(cfg *config.Config, machine string) (string, string, error) {
+			_, gs, _, err := config.ResolveMachineGoalState(log, cfg, machine)
+			if err != nil {
+				return "", "", err
+			}
+			return gs.RootFS.ContainerdVersion, gs.RootFS.RunCVersion, nil
+		},
+	}
+}
+
+// NeedLeaderElection reports false: every daemon reports its own node.
+func (w *complianceFactsWriter) NeedLeaderElection() bool { return false }
+
+func (w *complianceFactsWriter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if err := w.write(ctx); err != nil {
+			w.log.Warn("failed to write compliance facts", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// write collects the facts and replaces the file atomically, since the
+// guest configuration agent may read it at any time. Facts that could not be
+// collected are left empty rather than failing the whole file.
+func (w *complianceFactsWriter) write(ctx context.Context) error {
+	report, err := w.collect()
+	if err != nil {
+		w.log.Debug("posture collection was incomplete", "error", err)
+	}
+	facts := ComplianceFacts{
+		SchemaVersion: complianceFactsSchemaVersion,
+		NodeName:      w.cfg.Agent.NodeName,
+		Report:        *report,
+	}
+	if active := addMachinePosture(ctx, w.log, w.state, w.manifests, w.cfg.Instance, &facts.Report); active != nil {
+		facts.SettingsVersion = active.State.AppliedSettingsVersion
+		cfg := w.cfg.DeepCopy()
+		if active.State.AppliedKubernetesVersion != "" {
+			cfg.Components.Kubernetes = active.State.AppliedKubernetesVersion
+		}
+		if facts.ContainerdVersion, facts.RuncVersion, err = w.componentVersions(cfg, active.Name); err != nil {
+			w.log.Debug("component versions not resolved for compliance facts", "error", err)
+		}
+	}
+	if maintenance, err := w.maintenance.Current(); err != nil {
+		w.log.Debug("failed to load maintenance record for compliance facts", "error", err)
+	} else {
+		facts.MaintenanceMode = maintenance != nil
+	}
+
+	data, err := json.MarshalIndent(facts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal compliance facts: %w", err)
+	}
+	if err := utilio.WriteFile(w.path, append(data, '\n'), 0o644); err != nil { //nolint:gosec // read by the guest configuration agent; holds no secrets
+		return fmt.Errorf("write compliance facts %s: %w", w.path, err)
+	}
+	return nil
+}
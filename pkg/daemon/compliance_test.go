@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/posture"
+)
+
+func TestComplianceFactsWriter(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	machineDir := t.TempDir()
+	writeScript(t, filepath.Join(machineDir, "usr/local/bin/kubelet"), "echo kubelet")
+	manifests := &ManifestStore{path: filepath.Join(dir, manifestFileName)}
+	record := &recordManifestTask{store: manifests, machine: "kube1", machineDir: machineDir}
+	if err := record.Do(t.Context()); err != nil {
+		t.Fatalf("record manifest: %v", err)
+	}
+	maintenanceStore := newMaintenanceStore(filepath.Join(dir, maintenanceFileName))
+	if err := maintenanceStore.Save(&Maintenance{StartedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("save maintenance: %v", err)
+	}
+
+	cfg := &config.Config{Agent: config.AgentConfig{NodeName: "node1"}}
+	state := &testStateStore{state: &State{ActiveMachine: "kube1", AppliedKubernetesVersion: "1.34.3", AppliedSettingsVersion: "7"}}
+	writer := newComplianceFactsWriter(slog.New(slog.DiscardHandler), cfg, state,
+		newMaintenanceManager(slog.New(slog.DiscardHandler), nil, nil, "node1", maintenanceStore, nil))
+	writer.path = filepath.Join(dir, complianceFactsFileName)
+	writer.manifests = manifests
+	writer.collect = func() (*posture.Report, error) {
+		return &posture.Report{AgentVersion: "v1", SecureBoot: posture.SecureBootEnabled}, nil
+	}
+	var resolvedKubernetes string
+	writer.componentVersions = func(cfg *config.Config, machine string) (string, string, error) {
+		resolvedKubernetes = cfg.Components.Kubernetes
+		return "2.1.4", "1.3.0", nil
+	}
+
+	if err := writer.write(t.Context()); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if resolvedKubernetes != "1.34.3" {
+		t.Fatalf("component versions resolved for Kubernetes %q, want the applied 1.34.3", resolvedKubernetes)
+	}
+	data, err := os.ReadFile(writer.path)
+	if err != nil {
+		t.Fatalf("read facts: %v", err)
+	}
+	var facts map[string]any
+	if err := json.Unmarshal(data, &facts); err != nil {
+		t.Fatalf("decode facts: %v", err)
+	}
+	for key, want := range map[string]any{
+		"schemaVersion":     float64(1),
+		"nodeName":          "node1",
+		"agentVersion":      "v1",
+		"secureBoot":        posture.SecureBootEnabled,
+		"kubernetesVersion": "1.34.3",
+		"settingsVersion":   "7",
+		"containerdVersion": "2.1.4",
+		"runcVersion":       "1.3.0",
+		"rootfsVerified":    true,
+		"maintenanceMode":   true,
+	} {
+		if facts[key] != want {
+			t.Errorf("facts[%q] = %v, want %v", key, facts[key], want)
+		}
+	}
+}
@@ -0,0 +1,558 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/arccheck"
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/manifest"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+	"github.com/Azure/AKSFlexNode/pkg/trust"
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+const (
+	// DefaultControlSocketPath is the unix socket the default instance's
+	// daemon serves its local admin API on. Only root can connect. Named
+	// instances use config.Instance.ControlSocketPath.
+	DefaultControlSocketPath = "/run/aks-flex-node/ctl.sock"
+
+	// ControlStatusPath is the admin API route returning Status.
+	ControlStatusPath = "/v1/status"
+	// ControlMaintenancePath enables (POST) or disables (DELETE) maintenance.
+	ControlMaintenancePath = "/v1/maintenance"
+	// ControlStandbyPath puts the node into standby (POST) or activates it
+	// (DELETE).
+	ControlStandbyPath = "/v1/standby"
+	// ControlHealthCheckPath re-runs the API server probe (POST) and returns
+	// its report.
+	ControlHealthCheckPath = "/v1/healthcheck"
+	// ControlDriftPath is the admin API route returning Drift.
+	ControlDriftPath = "/v1/drift"
+	// ControlHealthzPath and ControlLivezPath answer while the agent serves
+	// requests, and ControlReadyzPath once the node is bootstrapped and
+	// running, for kubelet-style probes.
+	ControlHealthzPath = "/healthz"
+	ControlLivezPath   = "/livez"
+	ControlReadyzPath  = "/readyz"
+	// ControlEventsPath is the admin API route returning the latest audit log
+	// entries.
+	ControlEventsPath = "/v1/events"
+	// ControlEventStreamPath streams the agent's log lines, audit events,
+	// and Node Events as server-sent events.
+	ControlEventStreamPath = "/v1/events/stream"
+
+	// controlEventsLimit bounds the audit log entries ControlEventsPath
+	// returns.
+	controlEventsLimit = 50
+
+	controlSocketMode    = 0o600
+	controlSocketDirMode = 0o750
+)
+
+// Status is the daemon's view of the node returned by the local admin API.
+type Status struct {
+	NodeName      string            `json:"nodeName"`
+	DaemonStarted time.Time         `json:"daemonStarted"`
+	Agent         version.Info      `json:"agent"`
+	State         *State            `json:"state,omitempty"`
+	StateError    string            `json:"stateError,omitempty"`
+	LastOperation *OperationTimings `json:"lastOperation,omitempty"`
+	// CurrentOperation lists the steps of a running bootstrap or repave and
+	// their download progress.
+	CurrentOperation *progress.Operation `json:"currentOperation,omitempty"`
+	// Prefetched is the machine generation a pending repave downloaded
+	// ahead of its activation.
+	Prefetched  *PrefetchedGeneration `json:"prefetched,omitempty"`
+	Maintenance *Maintenance          `json:"maintenance,omitempty"`
+	// Standby is set while the node is in standby with its kubelet stopped.
+	Standby *Standby `json:"standby,omitempty"`
+	// Power is the power schedule's state when a sleep schedule is
+	// configured.
+	Power *PowerStatus `json:"power,omitempty"`
+	// APIServer is the latest probe of the API server through the kubelet's
+	// kubeconfig.
+	APIServer *apiprobe.Report `json:"apiServer,omitempty"`
+	// RecentAzureRequests lists the correlation IDs of the daemon's latest
+	// Azure calls.
+	RecentAzureRequests []azclient.Correlation `json:"recentAzureRequests,omitempty"`
+	// ReadinessGate is the latest evaluation of the node prerequisites when
+	// the readiness gate is enabled.
+	ReadinessGate *ReadinessGateStatus `json:"readinessGate,omitempty"`
+	// LocalDNS is the latest health check of the node-local DNS cache when
+	// it is enabled.
+	LocalDNS *LocalDNSStatus `json:"localDNS,omitempty"`
+	// Usage is the latest node resource usage sample when sampling is
+	// enabled.
+	Usage *UsageSample `json:"usage,omitempty"`
+	// TrustedCAs lists the CA certificates distributed into the active
+	// machine from trust.caBundles.
+	TrustedCAs []trust.Certificate `json:"trustedCAs,omitempty"`
+	// ArcConnectivity is the latest check of the Azure Arc endpoints when
+	// Arc is enabled.
+	ArcConnectivity *arccheck.Report `json:"arcConnectivity,omitempty"`
+}
+
+// Drift is the comparison of the active machine's rootfs with the manifest
+// recorded when it was bootstrapped or repaved.
+type Drift struct {
+	Machine    string              `json:"machine,omitempty"`
+	RecordedAt time.Time           `json:"recordedAt,omitzero"`
+	Files      int                 `json:"files"`
+	Mismatches []manifest.Mismatch `json:"mismatches,omitempty"`
+	// Error is set when the active machine could not be verified.
+	Error string `json:"error,omitempty"`
+}
+
+// controlServer serves the local admin API over a unix socket. It implements
+// manager.Runnable so it starts and stops with the daemon's manager.
+type controlServer struct {
+	log         *slog.Logger
+	path        string
+	nodeName    string
+	state       stateStore
+	timings     *TimingsStore
+	progress    *ProgressStore
+	maintenance *maintenanceManager
+	apiProber   *apiProber
+	// readinessGate is set when the gate is enabled.
+	readinessGate *readinessGate
+	// localDNS is set when the node-local DNS cache is enabled.
+	localDNS *localDNSMonitor
+	// usage is set when usage sampling is enabled.
+	usage *usageSampler
+	// trust is set when CA bundles are configured.
+	trust *trustMonitor
+	// arcConnectivity is set when Arc is enabled.
+	arcConnectivity *arcConnectivityMonitor
+	// standby is set when the standby controller is enabled.
+	standby *standbyManager
+	// power is set when a sleep schedule is configured.
+	power *powerManager
+	// prefetched is the generation a pending repave downloaded.
+	prefetched *PrefetchStore
+	// manifests and instance verify the active machine for the drift route,
+	// and auditLogPath feeds the events route. Both answer 501 when unset.
+	manifests    *ManifestStore
+	instance     config.Instance
+	auditLogPath string
+	// events feeds the event stream route, which answers 501 when unset.
+	events *eventHub
+	// deferred is the marker /readyz checks for a deferred bootstrap, and
+	// unitStates reports the active machine's units to it.
+	deferred   *DeferredBootstrap
+	unitStates func(ctx context.Context, machine string) (map[string]bool, error)
+	started    time.Time
+}
+
+func newControlServer(log *slog.Logger, path, nodeName string, state stateStore, timings *TimingsStore, progress *ProgressStore, maintenance *maintenanceManager, apiProber *apiProber) *controlServer {
+	if path == "" {
+		path = DefaultControlSocketPath
+	}
+	return &controlServer{
+		log:         log,
+		path:        path,
+		nodeName:    nodeName,
+		state:       state,
+		timings:     timings,
+		progress:    progress,
+		maintenance: maintenance,
+		apiProber:   apiProber,
+		unitStates: func(ctx context.Context, machine string) (map[string]bool, error) {
+			return generationUnitStates(ctx, log, machine)
+		},
+		started: time.Now().UTC(),
+	}
+}
+
+// NeedLeaderElection reports false: the admin API serves the local node only.
+func (s *controlServer) NeedLeaderElection() bool { return false }
+
+func (s *controlServer) Start(ctx context.Context) error {
+	listener, err := listenUnix(s.path)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Event streams only end with their request's context.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Info("local admin API listening", "socket", s.path)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve local admin API: %w", err)
+	}
+	return nil
+}
+
+func (s *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+ControlStatusPath, s.serveStatus)
+	mux.HandleFunc("POST "+ControlMaintenancePath, s.serveEnableMaintenance)
+	mux.HandleFunc("DELETE "+ControlMaintenancePath, s.serveDisableMaintenance)
+	mux.HandleFunc("POST "+ControlStandbyPath, s.serveDeactivate)
+	mux.HandleFunc("DELETE "+ControlStandbyPath, s.serveActivate)
+	mux.HandleFunc("POST "+ControlHealthCheckPath, s.serveHealthCheck)
+	mux.HandleFunc("GET "+ControlDriftPath, s.serveDrift)
+	mux.HandleFunc("GET "+ControlEventsPath, s.serveEvents)
+	mux.HandleFunc("GET "+ControlEventStreamPath, s.serveEventStream)
+	s.healthHandlers(mux)
+	return mux
+}
+
+func (s *controlServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status := Status{NodeName: s.nodeName, DaemonStarted: s.started, Agent: version.Get()}
+	state, err := s.state.Load(r.Context())
+	if err != nil {
+		status.StateError = err.Error()
+	}
+	status.State = state
+	if s.timings != nil {
+		if timings, err := s.timings.Load(); err != nil {
+			s.log.Debug("failed to load step timings for status", "error", err)
+		} else {
+			status.LastOperation = timings
+		}
+	}
+	if s.progress != nil {
+		if current, err := s.progress.Load(); err != nil {
+			s.log.Debug("failed to load operation progress for status", "error", err)
+		} else if current != nil {
+			status.CurrentOperation = current.CurrentOperation
+		}
+	}
+	if prefetched, err := s.prefetched.Load(); err != nil {
+		s.log.Debug("failed to load the prefetched generation for status", "error", err)
+	} else {
+		status.Prefetched = prefetched
+	}
+
+	if maintenance, err := s.maintenance.Current(); err != nil {
+		s.log.Debug("failed to load maintenance record for status", "error", err)
+	} else {
+		status.Maintenance = maintenance
+	}
+	if standby, err := s.standby.Current(); err != nil {
+		s.log.Debug("failed to load standby record for status", "error", err)
+	} else {
+		status.Standby = standby
+	}
+	status.Power = s.power.Status()
+	status.APIServer = s.apiProber.Last()
+	status.RecentAzureRequests = azclient.RecentCorrelations()
+	status.ReadinessGate = s.readinessGate.Last()
+	status.LocalDNS = s.localDNS.Last()
+	status.Usage = s.usage.Last()
+	status.TrustedCAs = s.trust.Last()
+	status.ArcConnectivity = s.arcConnectivity.Last()
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+func (s *controlServer) serveEnableMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance == nil {
+		http.Error(w, "maintenance is not supported by this daemon", http.StatusNotImplemented)
+		return
+	}
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decode maintenance request: %v", err), http.StatusBadRequest)
+		return
+	}
+	record, err := s.maintenance.Enable(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, record)
+}
+
+func (s *controlServer) serveDisableMaintenance(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance == nil {
+		http.Error(w, "maintenance is not supported by this daemon", http.StatusNotImplemented)
+		return
+	}
+	if err := s.maintenance.Disable(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *controlServer) serveDeactivate(w http.ResponseWriter, r *http.Request) {
+	if s.standby == nil {
+		http.Error(w, "standby is not enabled on this daemon", http.StatusNotImplemented)
+		return
+	}
+	var req StandbyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decode standby request: %v", err), http.StatusBadRequest)
+		return
+	}
+	record, err := s.standby.Deactivate(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, record)
+}
+
+func (s *controlServer) serveActivate(w http.ResponseWriter, r *http.Request) {
+	if s.standby == nil {
+		http.Error(w, "standby is not enabled on this daemon", http.StatusNotImplemented)
+		return
+	}
+	if err := s.standby.Activate(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *controlServer) serveHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if s.apiProber == nil {
+		http.Error(w, "health checks are not supported by this daemon", http.StatusNotImplemented)
+		return
+	}
+	s.apiProber.run(r.Context())
+	report := s.apiProber.Last()
+	if report == nil {
+		http.Error(w, "no active machine to probe", http.StatusConflict)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, report)
+}
+
+func (s *controlServer) serveDrift(w http.ResponseWriter, r *http.Request) {
+	if s.manifests == nil {
+		http.Error(w, "drift checks are not supported by this daemon", http.StatusNotImplemented)
+		return
+	}
+	var drift Drift
+	m, mismatches, err := verifyActiveMachine(r.Context(), s.state, s.manifests, s.instance)
+	if err != nil {
+		drift.Error = err.Error()
+	} else {
+		drift.Machine = m.Machine
+		drift.RecordedAt = m.RecordedAt
+		drift.Files = len(m.Entries)
+		drift.Mismatches = mismatches
+	}
+	s.writeJSON(w, http.StatusOK, drift)
+}
+
+func (s *controlServer) serveEvents(w http.ResponseWriter, _ *http.Request) {
+	if s.auditLogPath == "" {
+		http.Error(w, "events are not supported by this daemon", http.StatusNotImplemented)
+		return
+	}
+	entries, err := audit.TailFile(s.auditLogPath, controlEventsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *controlServer) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Debug("failed to write admin API response", "error", err)
+	}
+}
+
+// listenUnix replaces any stale socket left by a previous daemon and restricts
+// the new one to root.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), controlSocketDirMode); err != nil {
+		return nil, fmt.Errorf("create control socket directory: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale control socket %s: %w", path, err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on control socket %s: %w", path, err)
+	}
+	if err := os.Chmod(path, controlSocketMode); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("restrict control socket %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// controlStatusTimeout bounds quick admin API calls. Maintenance and standby
+// calls are bounded by the caller's context instead because a drain can take
+// minutes.
+const controlStatusTimeout = 30 * time.Second
+
+// ControlClient is an HTTP client for the daemon's local admin API.
+type ControlClient struct {
+	http *http.Client
+}
+
+// NewControlClient returns a client that dials the admin API at socketPath.
+func NewControlClient(socketPath string) *ControlClient {
+	if socketPath == "" {
+		socketPath = DefaultControlSocketPath
+	}
+	dialer := &net.Dialer{}
+	return &ControlClient{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}}
+}
+
+// Status fetches the daemon status.
+func (c *ControlClient) Status(ctx context.Context) (*Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, controlStatusTimeout)
+	defer cancel()
+	var status Status
+	if err := c.do(ctx, http.MethodGet, ControlStatusPath, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// EnableMaintenance asks the daemon to enter maintenance and returns the
+// resulting record.
+func (c *ControlClient) EnableMaintenance(ctx context.Context, req MaintenanceRequest) (*Maintenance, error) {
+	var record Maintenance
+	if err := c.do(ctx, http.MethodPost, ControlMaintenancePath, req, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DisableMaintenance asks the daemon to leave maintenance.
+func (c *ControlClient) DisableMaintenance(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, ControlMaintenancePath, nil, nil)
+}
+
+// Deactivate asks the daemon to put the node into standby and returns the
+// resulting record.
+func (c *ControlClient) Deactivate(ctx context.Context, req StandbyRequest) (*Standby, error) {
+	var record Standby
+	if err := c.do(ctx, http.MethodPost, ControlStandbyPath, req, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Activate asks the daemon to take the node out of standby.
+func (c *ControlClient) Activate(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, ControlStandbyPath, nil, nil)
+}
+
+// Drift verifies the active machine against its recorded manifest. Hashing
+// the machine can take a while, so the call is bounded by ctx only.
+func (c *ControlClient) Drift(ctx context.Context) (*Drift, error) {
+	var drift Drift
+	if err := c.do(ctx, http.MethodGet, ControlDriftPath, nil, &drift); err != nil {
+		return nil, err
+	}
+	return &drift, nil
+}
+
+// StreamEvents calls fn with the daemon's recent events that match filter
+// and, with follow, with every later one until ctx is done or fn returns an
+// error.
+func (c *ControlClient) StreamEvents(ctx context.Context, filter EventFilter, follow bool, fn func(StreamEvent) error) error {
+	path := ControlEventStreamPath + "?" + filter.query()
+	if !follow {
+		path += "&follow=false"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://aks-flex-node"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("contact daemon (is aks-flex-node-agent running?): %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("daemon returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event StreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("decode streamed event: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("read event stream: %w", err)
+	}
+	return nil
+}
+
+func (c *ControlClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://aks-flex-node"+path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("contact daemon (is aks-flex-node-agent running?): %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("daemon returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode daemon response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+)
+
+func TestControlServerStatus(t *testing.T) {
+	t.Parallel()
+
+	// Unix socket paths are length-limited, so avoid the long t.TempDir path.
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "ctl.sock")
+
+	timings := newTimingsStore(filepath.Join(dir, timingsFileName))
+	if err := timings.Save(OperationTimings{Operation: TimingOperationBootstrap, Outcome: StepOutcomeSucceeded}); err != nil {
+		t.Fatalf("Save timings: %v", err)
+	}
+	progressStore := &ProgressStore{path: filepath.Join(dir, progressFileName)}
+	if err := progressStore.Save(&progress.Operation{Name: TimingOperationRepave, Steps: []progress.Step{{Name: "download-kube-binaries"}}}); err != nil {
+		t.Fatalf("Save progress: %v", err)
+	}
+	state := &testStateStore{state: &State{ActiveMachine: "kube2", AppliedSettingsVersion: "v3"}}
+	server := newControlServer(slog.New(slog.DiscardHandler), socket, "node-a", state, timings, progressStore, nil, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+
+	client := NewControlClient(socket)
+	var status *Status
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err = client.Status(t.Context())
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.NodeName != "node-a" || status.State == nil || status.State.ActiveMachine != "kube2" {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.LastOperation == nil || status.LastOperation.Operation != TimingOperationBootstrap {
+		t.Fatalf("lastOperation = %+v", status.LastOperation)
+	}
+	if op := status.CurrentOperation; op == nil || op.Name != TimingOperationRepave || len(op.Steps) != 1 {
+		t.Fatalf("currentOperation = %+v", status.CurrentOperation)
+	}
+
+	if _, err := client.Drift(t.Context()); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("Drift() without manifests = %v, want not supported", err)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Stat socket: %v", err)
+	}
+	if info.Mode().Perm() != controlSocketMode {
+		t.Fatalf("socket mode = %v, want %v", info.Mode().Perm(), os.FileMode(controlSocketMode))
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
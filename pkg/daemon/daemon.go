@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -17,9 +18,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	"github.com/Azure/AKSFlexNode/pkg/acrcredentials"
 	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/kubeauth"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+	"github.com/Azure/AKSFlexNode/pkg/shutdown"
+	"github.com/Azure/AKSFlexNode/pkg/tokencache"
 	"github.com/Azure/unbounded/pkg/agent/daemon"
 	"github.com/Azure/unbounded/pkg/agent/daemoncred"
 )
@@ -31,6 +37,48 @@ const (
 
 // Run starts the machine-driven daemon loop.
 func Run(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
+	// Log lines and audit events also feed the admin API's event stream.
+	events := newEventHub()
+	log = slog.New(events.logHandler(log.Handler()))
+	audit.SetDefault(events.auditRecorder(audit.Default()))
+	// Installed before any Azure client is created, so every credential
+	// shares the persisted tokens.
+	tokens := tokencache.New(log, cfg.Instance.StateDir())
+	tokencache.SetDefault(tokens)
+	if limit := cfg.Agent.Resources.MemoryLimitBytes; limit > 0 {
+		debug.SetMemoryLimit(limit)
+		log.Info("set agent memory limit", "bytes", limit)
+	}
+	// The unit carries the priority of the config at the last bootstrap;
+	// applying it here too picks up a changed config on restart.
+	LowerAgentPriority(log, cfg.Agent.Resources)
+	if err := ResolveVMTopology(ctx, cfg); err != nil {
+		return err
+	}
+	endpoints := newClusterEndpointStore(filepath.Join(cfg.Instance.StateDir(), clusterEndpointFileName))
+	if cfg.Agent.ClusterEndpoint.Enabled {
+		// The pinned endpoint replaces the one the node joined with before
+		// any client or kubeconfig is built from cfg.
+		pin, err := applyClusterEndpointPin(cfg, endpoints)
+		if err != nil {
+			return err
+		}
+		if pin != nil {
+			log.Info("using pinned cluster endpoint", "clusterFQDN", pin.ClusterFQDN, "pinnedAt", pin.PinnedAt)
+		}
+	}
+	var kubeletCredentials *kubeconfig.Manager
+	if kubeconfig.Applies(cfg) {
+		// The daemon's own client reads the host copy of the Arc-derived
+		// token, so it has to be current before connecting.
+		kubeletCredentials = kubeconfig.NewManager(log, cfg)
+		if reason := kubeletCredentials.Check(""); reason != nil {
+			log.Info("regenerating kubelet token", "reason", reason)
+			if _, err := kubeletCredentials.Generate(ctx, ""); err != nil {
+				return fmt.Errorf("generate kubelet token: %w", err)
+			}
+		}
+	}
 	restCfg, stopCredentials, err := daemonRESTConfig(ctx, cfg)
 	if err != nil {
 		return err
@@ -42,17 +90,22 @@ func Run(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
 	if err != nil {
 		return fmt.Errorf("create AKS machine client: %w", err)
 	}
-	store, err := NewFileStateStore()
+	store, err := NewFileStateStore(cfg.Instance)
 	if err != nil {
 		return err
 	}
 	nodeName := cfg.Agent.NodeName
 	// TODO: use the ARM machine resource name once the AKS RP Machine API contract is defined.
 	aksMachineName := nodeName
+	gracePeriod := time.Duration(cfg.Agent.ShutdownGracePeriod)
+	coordinator := shutdown.New(gracePeriod)
 	mgr, err := ctrl.NewManager(restCfg, manager.Options{
 		Scheme: newScheme(),
+		// Reconciles in a critical section keep running after the signal;
+		// the manager must wait for them rather than give up at its default.
+		GracefulShutdownTimeout: &gracePeriod,
 		Metrics: metricsserver.Options{
-			BindAddress: "0",
+			BindAddress: cfg.Agent.MetricsBindAddress,
 		},
 		Cache: ctrlcache.Options{
 			ByObject: map[client.Object]ctrlcache.ByObject{
@@ -69,6 +122,34 @@ func Run(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
 	if err != nil {
 		return err
 	}
+	if cfg.Agent.Disruption.RespectPodDisruptionBudgets {
+		operator.disruption.workloads = &workloadGuard{reader: mgr.GetAPIReader(), nodeName: nodeName}
+	}
+	// An operation recorded as running was interrupted by the restart of the
+	// process that ran it.
+	if err := operator.progress.Save(nil); err != nil {
+		log.Warn("failed to clear stale operation progress", "error", err)
+	}
+	if timings, err := operator.timings.Load(); err != nil {
+		log.Warn("failed to load persisted step timings", "error", err)
+	} else if timings != nil {
+		publishTimings(*timings)
+	}
+	var recorder *nodeRecorder
+	if cfg.Agent.NodeEvents {
+		recorder = newNodeRecorder(log, mgr.GetAPIReader(), mgr.GetClient(), nodeName)
+		recorder.events = events
+	}
+	maintenance := newMaintenanceManager(log, mgr.GetClient(), mgr.GetAPIReader(), nodeName, newMaintenanceStore(filepath.Join(cfg.Instance.StateDir(), maintenanceFileName)), recorder)
+	apiProber := newAPIProber(log, store)
+	var power *powerManager
+	if cfg.Agent.Power.Enabled() {
+		host := &machinePowerHost{log: log, state: store, instance: cfg.Instance, rtcWakeAlarm: rtcWakeAlarmPath}
+		power = newPowerManager(log, cfg, mgr.GetClient(), mgr.GetAPIReader(), nodeName,
+			newPowerStore(filepath.Join(cfg.Instance.StateDir(), powerFileName)), maintenance, host, apiProber, recorder)
+	}
+	standbys := newStandbyStore(filepath.Join(cfg.Instance.StateDir(), standbyFileName))
+	generations := newGenerationGuard(log, store, operator, recorder, coordinator, standbys, power)
 	repaves, err := newRepaveReconciler(repaveReconcilerOptions{
 		Log:                      log,
 		Machines:                 machines,
@@ -76,6 +157,11 @@ func Run(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
 		Operator:                 operator,
 		NodeName:                 nodeName,
 		MachineReconcileInterval: time.Duration(cfg.Agent.MachineReconcileInterval),
+		Maintenance:              maintenance,
+		Power:                    power,
+		Recorder:                 recorder,
+		Shutdown:                 coordinator,
+		Generations:              generations,
 	})
 	if err != nil {
 		return err
@@ -87,6 +173,7 @@ func Run(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
 		AKSMachineName:       aksMachineName,
 		MachineOperationMode: cfg.Agent.MachineOperationMode,
 		Operator:             repaves.operator,
+		Shutdown:             coordinator,
 	})
 	if err != nil {
 		return err
@@ -94,9 +181,170 @@ func Run(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
 	if err := daemon.SetupController("aks-flex-node-daemon", mgr, machineOperations, repaves); err != nil {
 		return fmt.Errorf("setup daemon controller: %w", err)
 	}
+	if err := mgr.Add(generations); err != nil {
+		return fmt.Errorf("add generation guard: %w", err)
+	}
+	if err := mgr.Add(apiProber); err != nil {
+		return fmt.Errorf("add kube API prober: %w", err)
+	}
+	control := newControlServer(log, cfg.Instance.ControlSocketPath(), nodeName, store, operator.timings, operator.progress, maintenance, apiProber)
+	control.manifests = NewManifestStore(cfg.Instance)
+	control.instance = cfg.Instance
+	control.auditLogPath = cfg.Agent.AuditLogPath
+	control.events = events
+	control.deferred = NewDeferredBootstrap(cfg.Instance)
+	control.prefetched = NewPrefetchStore(cfg.Instance)
+	if power != nil {
+		control.power = power
+		if err := mgr.Add(power); err != nil {
+			return fmt.Errorf("add power schedule: %w", err)
+		}
+	}
+	if gate := cfg.Agent.ReadinessGate; gate.Enabled {
+		control.readinessGate = newReadinessGate(log, mgr.GetAPIReader(), mgr.GetClient(), nodeName, time.Duration(gate.Timeout), store, apiProber)
+		if err := mgr.Add(control.readinessGate); err != nil {
+			return fmt.Errorf("add readiness gate: %w", err)
+		}
+	}
+	if cfg.LocalDNSEnabled() {
+		control.localDNS = newLocalDNSMonitor(log, cfg.LocalDNSAddress())
+		if err := mgr.Add(control.localDNS); err != nil {
+			return fmt.Errorf("add local DNS monitor: %w", err)
+		}
+	}
+	if usage := cfg.Agent.Usage; usage.Enabled {
+		control.usage = newUsageSampler(log, usage, NewUsageStore(cfg.Instance, usage.Samples), store)
+		if err := mgr.Add(control.usage); err != nil {
+			return fmt.Errorf("add usage sampler: %w", err)
+		}
+	}
+	if cfg.Trust.Enabled() {
+		control.trust = newTrustMonitor(log, cfg, store)
+		if err := mgr.Add(control.trust); err != nil {
+			return fmt.Errorf("add trust monitor: %w", err)
+		}
+	}
+	if cfg.IsARCEnabled() {
+		control.arcConnectivity = newArcConnectivityMonitor(log, cfg, mgr.GetAPIReader(), mgr.GetClient(), nodeName)
+		if err := mgr.Add(control.arcConnectivity); err != nil {
+			return fmt.Errorf("add Arc connectivity monitor: %w", err)
+		}
+	}
+	if cfg.Accelerators.Enabled() {
+		if err := mgr.Add(newAcceleratorReconciler(log, cfg, store, mgr.GetAPIReader(), mgr.GetClient(), nodeName, recorder)); err != nil {
+			return fmt.Errorf("add accelerator reconciler: %w", err)
+		}
+	}
+	if err := mgr.Add(newTopologyLabeler(log, cfg, mgr.GetAPIReader(), mgr.GetClient(), nodeName)); err != nil {
+		return fmt.Errorf("add topology labeler: %w", err)
+	}
+	if !cfg.Agent.UnitDrift.Disabled {
+		if err := mgr.Add(newUnitDriftWatchdog(log, cfg, store, control.manifests, recorder)); err != nil {
+			return fmt.Errorf("add unit drift watchdog: %w", err)
+		}
+	}
+	if cfg.Agent.MetricsBindAddress != "0" || cfg.Agent.MetricsTextfile.Enabled() {
+		if err := mgr.Add(newNodeStatusExporter(log, cfg, store)); err != nil {
+			return fmt.Errorf("add node status exporter: %w", err)
+		}
+	}
+	if cfg.SRIOV.Enabled() {
+		if err := mgr.Add(newSRIOVRestorer(log, cfg)); err != nil {
+			return fmt.Errorf("add SR-IOV restorer: %w", err)
+		}
+	}
+	if standby := cfg.Agent.Standby; standby.Enabled {
+		kubelet := &machineKubelet{log: log, state: store, instance: cfg.Instance}
+		control.standby = newStandbyManager(log, standby, mgr.GetClient(), mgr.GetAPIReader(), nodeName,
+			standbys, maintenance, kubelet, recorder)
+		if err := mgr.Add(control.standby); err != nil {
+			return fmt.Errorf("add standby controller: %w", err)
+		}
+	}
+	if err := mgr.Add(maintenance); err != nil {
+		return fmt.Errorf("add maintenance expiry: %w", err)
+	}
+	if err := mgr.Add(control); err != nil {
+		return fmt.Errorf("add local admin API: %w", err)
+	}
+	if dash := cfg.Agent.Dashboard; dash.Enabled {
+		if err := mgr.Add(newDashboard(log, dash, control.handler())); err != nil {
+			return fmt.Errorf("add local dashboard: %w", err)
+		}
+	}
+	wakeHooks := []func(){repaves.wake, apiProber.wake}
+	if control.arcConnectivity != nil {
+		wakeHooks = append(wakeHooks, control.arcConnectivity.wake)
+	}
+	if power != nil {
+		wakeHooks = append(wakeHooks, power.wake)
+	}
+	refresher := newTokenRefresher(log, tokens)
+	if err := mgr.Add(refresher); err != nil {
+		return fmt.Errorf("add Azure token refresher: %w", err)
+	}
+	wakeHooks = append(wakeHooks, refresher.wake)
+	if kubeletCredentials != nil {
+		rotator := newKubeconfigRotator(log, store, kubeletCredentials, apiProber)
+		if err := mgr.Add(rotator); err != nil {
+			return fmt.Errorf("add kubeconfig rotator: %w", err)
+		}
+		wakeHooks = append(wakeHooks, rotator.wake)
+	}
+	if acrcredentials.Applies(cfg) {
+		rotator := newACRCredentialsRotator(log, store, acrcredentials.NewManager(log, cfg))
+		if err := mgr.Add(rotator); err != nil {
+			return fmt.Errorf("add ACR credentials rotator: %w", err)
+		}
+		wakeHooks = append(wakeHooks, rotator.wake)
+	}
+	if cfg.Agent.ClusterEndpoint.Enabled {
+		watcher := newClusterEndpointWatcher(log, cfg, endpoints, store, mgr.GetAPIReader(), mgr.GetClient(), nodeName, recorder)
+		if err := mgr.Add(watcher); err != nil {
+			return fmt.Errorf("add cluster endpoint watcher: %w", err)
+		}
+	}
+	if cfg.Agent.Heartbeat.Enabled {
+		heartbeat := newHeartbeatPublisher(log, mgr.GetAPIReader(), mgr.GetClient(), nodeName, time.Duration(cfg.Agent.Heartbeat.Interval))
+		if err := mgr.Add(heartbeat); err != nil {
+			return fmt.Errorf("add heartbeat publisher: %w", err)
+		}
+		wakeHooks = append(wakeHooks, heartbeat.wake)
+	}
+	if cfg.Agent.Posture.Enabled {
+		if err := mgr.Add(newPostureReporter(log, mgr.GetClient(), nodeName, time.Duration(cfg.Agent.Posture.Interval), cfg.Instance, store)); err != nil {
+			return fmt.Errorf("add posture reporter: %w", err)
+		}
+	}
+	if cfg.Agent.ComplianceFacts.Enabled {
+		if err := mgr.Add(newComplianceFactsWriter(log, cfg, store, maintenance)); err != nil {
+			return fmt.Errorf("add compliance facts writer: %w", err)
+		}
+	}
+	if err := mgr.Add(newOutputsWriter(log, mgr.GetAPIReader(), cfg, store)); err != nil {
+		return fmt.Errorf("add registration outputs writer: %w", err)
+	}
+	if cfg.Agent.Inventory.Enabled {
+		reporter, err := newInventoryReporter(log, cfg, store)
+		if err != nil {
+			return fmt.Errorf("create inventory reporter: %w", err)
+		}
+		if err := mgr.Add(reporter); err != nil {
+			return fmt.Errorf("add inventory reporter: %w", err)
+		}
+	}
+	if resources := cfg.Agent.Resources; resources.MaxRSSBytes > 0 || resources.MaxGoroutines > 0 {
+		if err := mgr.Add(newSelfMonitor(log, resources)); err != nil {
+			return fmt.Errorf("add agent self-monitor: %w", err)
+		}
+	}
+	if err := mgr.Add(newClockJumpDetector(log, wakeHooks...)); err != nil {
+		return fmt.Errorf("add clock jump detector: %w", err)
+	}
 
 	err = mgr.Start(ctx)
 	repaves.log.Info("daemon shutting down")
+	coordinator.Drain(log)
 	return err
 }
 
@@ -116,7 +364,7 @@ func daemonRESTConfig(ctx context.Context, cfg *config.Config) (*rest.Config, fu
 }
 
 func daemonRESTConfigProvider(ctx context.Context, cfg *config.Config, base *rest.Config) (*daemoncred.RESTConfigProvider, func(), error) {
-	credentialDir := filepath.Join(config.ConfigDir, daemonCredentialDir)
+	credentialDir := filepath.Join(cfg.Instance.StateDir(), daemonCredentialDir)
 	if err := os.MkdirAll(credentialDir, 0o700); err != nil {
 		return nil, nil, fmt.Errorf("create daemon credential directory: %w", err)
 	}
@@ -0,0 +1,199 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// dashboardActionHeader must accompany the dashboard's POST and DELETE calls.
+// Browsers only attach custom headers to same-origin script requests, so a
+// page on another site cannot make the operator's browser trigger actions.
+const dashboardActionHeader = "X-AKS-Flex-Node-Dashboard"
+
+//go:embed assets/dashboard.html
+var dashboardPage []byte
+
+// dashboard serves a single-page view of the local admin API over TCP for
+// operators without kubectl or portal access. It implements manager.Runnable.
+type dashboard struct {
+	log *slog.Logger
+	cfg config.DashboardConfig
+	// api is the local admin API handler the page's /api/ calls reach.
+	api http.Handler
+}
+
+func newDashboard(log *slog.Logger, cfg config.DashboardConfig, api http.Handler) *dashboard {
+	return &dashboard{log: log, cfg: cfg, api: api}
+}
+
+// NeedLeaderElection reports false: the dashboard serves the local node only.
+func (d *dashboard) NeedLeaderElection() bool { return false }
+
+func (d *dashboard) Start(ctx context.Context) error {
+	handler, err := d.handler()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", d.cfg.BindAddress)
+	if err != nil {
+		return fmt.Errorf("listen on dashboard address %s: %w", d.cfg.BindAddress, err)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	d.log.Info("local dashboard listening", "address", listener.Addr().String(), "authenticated", d.cfg.PasswordFile != "")
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve local dashboard: %w", err)
+	}
+	return nil
+}
+
+func (d *dashboard) handler() (http.Handler, error) {
+	password, err := d.password()
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboardPage)
+	})
+	api := requireActionHeader(d.api)
+	if password == "" {
+		// Without a credential any local user or hostNetwork pod can reach
+		// the dashboard, so it must not cordon, drain, or stop the kubelet.
+		api = readOnly(d.api)
+	}
+	mux.Handle("/api/", http.StripPrefix("/api", api))
+
+	// Load balancers and fleet probes cannot authenticate, and the probes
+	// only disclose which checks pass.
+	root := http.NewServeMux()
+	for _, path := range healthProbePaths {
+		root.Handle(path, d.api)
+		root.Handle(path+"/", d.api)
+	}
+	root.Handle("/", d.checkHost(d.authenticate(password, mux)))
+	return root, nil
+}
+
+// password reads agent.dashboard.passwordFile, returning "" when the
+// dashboard is unauthenticated.
+func (d *dashboard) password() (string, error) {
+	if d.cfg.PasswordFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(filepath.Clean(d.cfg.PasswordFile))
+	if err != nil {
+		return "", fmt.Errorf("read dashboard password file: %w", err)
+	}
+	password := strings.TrimSpace(string(data))
+	if password == "" {
+		return "", fmt.Errorf("dashboard password file %s is empty", d.cfg.PasswordFile)
+	}
+	return password, nil
+}
+
+func (d *dashboard) authenticate(password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-store")
+		if password != "" {
+			user, pass, ok := r.BasicAuth()
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(d.cfg.Username)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+			if !ok || !userOK || !passOK {
+				w.Header().Set("WWW-Authenticate", `Basic realm="aks-flex-node", charset="UTF-8"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkHost rejects requests whose Host header does not name the bind
+// address, so a page whose DNS name was rebound to the node's address cannot
+// reach the dashboard from the operator's browser.
+func (d *dashboard) checkHost(next http.Handler) http.Handler {
+	nodeName, _ := os.Hostname()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hostMatchesBind(r.Host, d.cfg.BindAddress, nodeName) {
+			http.Error(w, "unexpected Host header", http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hostMatchesBind reports whether the Host header names bindAddress. A
+// loopback bind address also answers to localhost, and a wildcard one to any
+// IP address or the node's host name.
+func hostMatchesBind(hostHeader, bindAddress, nodeName string) bool {
+	bindHost, bindPort, err := net.SplitHostPort(bindAddress)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(hostHeader)
+	if err != nil {
+		host, port = hostHeader, "80"
+	}
+	if port != bindPort {
+		return false
+	}
+	ip, bindIP := net.ParseIP(host), net.ParseIP(bindHost)
+	switch {
+	case strings.EqualFold(host, bindHost):
+		return true
+	case bindHost == "" || bindIP != nil && bindIP.IsUnspecified():
+		return ip != nil || strings.EqualFold(host, nodeName)
+	case bindIP != nil && bindIP.IsLoopback():
+		return ip != nil && ip.Equal(bindIP) || strings.EqualFold(host, "localhost")
+	default:
+		return ip != nil && bindIP != nil && ip.Equal(bindIP)
+	}
+}
+
+// readOnly rejects every request that is not a GET or HEAD.
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "dashboard actions need agent.dashboard.passwordFile", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireActionHeader rejects state-changing requests that do not carry
+// dashboardActionHeader.
+func requireActionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Header.Get(dashboardActionHeader) == "" {
+			http.Error(w, "missing "+dashboardActionHeader+" header", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auditLog := filepath.Join(dir, "audit.log")
+	if err := audit.NewFileLog(auditLog).Record(context.Background(), audit.Event{Operation: audit.OperationUnitRestart, Target: "kubelet"}); err != nil {
+		t.Fatal(err)
+	}
+	control := newControlServer(slog.New(slog.DiscardHandler), "", "node-a", &testStateStore{state: &State{ActiveMachine: "kube1"}}, nil, nil, nil, nil)
+	control.manifests = &ManifestStore{path: filepath.Join(dir, manifestFileName)}
+	control.auditLogPath = auditLog
+
+	dash := newDashboard(slog.New(slog.DiscardHandler), config.DashboardConfig{BindAddress: "127.0.0.1:8089", Username: "admin", PasswordFile: passwordFile}, control.handler())
+	handler, err := dash.handler()
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	serve := func(method, path, password string, header bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://127.0.0.1:8089"+path, nil)
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		if header {
+			req.Header.Set(dashboardActionHeader, "1")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodGet, "/", "wrong", false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET / with a wrong password = %d, want 401", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/", "s3cret", false); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Re-run health check") {
+		t.Errorf("GET / = %d, want the dashboard page", rec.Code)
+	}
+	if rec := serve(http.MethodGet, ControlLivezPath, "", false); rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("GET livez without a password = %d %q, want the probe answered", rec.Code, rec.Body.String())
+	}
+
+	rec := serve(http.MethodGet, "/api"+ControlEventsPath, "s3cret", false)
+	var events []audit.Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil || len(events) != 1 || events[0].Target != "kubelet" {
+		t.Errorf("GET events = %d %s, want the audit entry", rec.Code, rec.Body.String())
+	}
+	rec = serve(http.MethodGet, "/api"+ControlDriftPath, "s3cret", false)
+	var drift Drift
+	if err := json.Unmarshal(rec.Body.Bytes(), &drift); err != nil || !strings.Contains(drift.Error, "no machine manifest") {
+		t.Errorf("GET drift = %d %s, want the missing manifest reported", rec.Code, rec.Body.String())
+	}
+
+	if rec := serve(http.MethodDelete, "/api"+ControlMaintenancePath, "s3cret", false); rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE maintenance without the action header = %d, want 403", rec.Code)
+	}
+	if rec := serve(http.MethodDelete, "/api"+ControlMaintenancePath, "s3cret", true); rec.Code != http.StatusNotImplemented {
+		t.Errorf("DELETE maintenance with the action header = %d, want it forwarded to the admin API", rec.Code)
+	}
+
+	rebound := httptest.NewRequest(http.MethodGet, "http://attacker.example:8089/", nil)
+	rebound.SetBasicAuth("admin", "s3cret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, rebound)
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Errorf("GET / with a foreign Host = %d, want 421", rec.Code)
+	}
+}
+
+func TestDashboardWithoutPasswordIsReadOnly(t *testing.T) {
+	t.Parallel()
+
+	control := newControlServer(slog.New(slog.DiscardHandler), "", "node-a", &testStateStore{state: &State{ActiveMachine: "kube1"}}, nil, nil, nil, nil)
+	dash := newDashboard(slog.New(slog.DiscardHandler), config.DashboardConfig{BindAddress: "127.0.0.1:8089"}, control.handler())
+	handler, err := dash.handler()
+	if err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	serve := func(method, url string) int {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set(dashboardActionHeader, "1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(http.MethodGet, "http://localhost:8089/api"+ControlStatusPath); code != http.StatusOK {
+		t.Errorf("GET status = %d, want 200", code)
+	}
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		if code := serve(method, "http://127.0.0.1:8089/api"+ControlMaintenancePath); code != http.StatusForbidden {
+			t.Errorf("%s maintenance without a password = %d, want 403", method, code)
+		}
+	}
+	if code := serve(http.MethodPost, "http://127.0.0.1:8089/api"+ControlStandbyPath); code != http.StatusForbidden {
+		t.Errorf("POST standby without a password = %d, want 403", code)
+	}
+}
+
+func TestHostMatchesBind(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		host, bind string
+		want       bool
+	}{
+		{host: "127.0.0.1:8089", bind: "127.0.0.1:8089", want: true},
+		{host: "localhost:8089", bind: "127.0.0.1:8089", want: true},
+		{host: "[::1]:8089", bind: "[::1]:8089", want: true},
+		{host: "127.0.0.1:9000", bind: "127.0.0.1:8089"},
+		{host: "rebound.example:8089", bind: "127.0.0.1:8089"},
+		{host: "10.0.0.4:8089", bind: "0.0.0.0:8089", want: true},
+		{host: "edge-01:8089", bind: "0.0.0.0:8089", want: true},
+		{host: "rebound.example:8089", bind: "0.0.0.0:8089"},
+		{host: "10.0.0.4:8089", bind: "10.0.0.4:8089", want: true},
+		{host: "10.0.0.5:8089", bind: "10.0.0.4:8089"},
+	}
+	for _, tt := range tests {
+		if got := hostMatchesBind(tt.host, tt.bind, "edge-01"); got != tt.want {
+			t.Errorf("hostMatchesBind(%q, %q) = %v, want %v", tt.host, tt.bind, got, tt.want)
+		}
+	}
+}
+
+func TestDashboardEmptyPasswordFile(t *testing.T) {
+	t.Parallel()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dash := newDashboard(slog.New(slog.DiscardHandler), config.DashboardConfig{PasswordFile: passwordFile}, http.NotFoundHandler())
+	if _, err := dash.handler(); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("handler() error = %v, want the empty password file rejected", err)
+	}
+}
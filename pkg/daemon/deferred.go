@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const deferredBootstrapFileName = "bootstrap-deferred"
+
+// DeferredBootstrap marks a bootstrap that start deferred because the network
+// was unavailable, so the daemon finishes it once the network is up.
+type DeferredBootstrap struct {
+	path string
+}
+
+// NewDeferredBootstrap returns the marker under the instance's state root.
+func NewDeferredBootstrap(instance config.Instance) *DeferredBootstrap {
+	return &DeferredBootstrap{path: filepath.Join(instance.StateDir(), deferredBootstrapFileName)}
+}
+
+// Mark records that bootstrap was deferred.
+func (d *DeferredBootstrap) Mark() error {
+	if err := utilio.WriteFile(d.path, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write deferred bootstrap marker %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// Pending reports whether a deferred bootstrap has not completed yet.
+func (d *DeferredBootstrap) Pending() (bool, error) {
+	_, err := os.Stat(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat deferred bootstrap marker %s: %w", d.path, err)
+	}
+	return true, nil
+}
+
+// Clear removes the marker after the deferred bootstrap completed.
+func (d *DeferredBootstrap) Clear() error {
+	if err := os.Remove(d.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove deferred bootstrap marker %s: %w", d.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDeferredBootstrap(t *testing.T) {
+	t.Parallel()
+
+	marker := &DeferredBootstrap{path: filepath.Join(t.TempDir(), "state", deferredBootstrapFileName)}
+	for _, step := range []struct {
+		name string
+		do   func() error
+		want bool
+	}{
+		{name: "initial", do: func() error { return nil }, want: false},
+		{name: "mark", do: marker.Mark, want: true},
+		{name: "clear", do: marker.Clear, want: false},
+		{name: "clear again", do: marker.Clear, want: false},
+	} {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		pending, err := marker.Pending()
+		if err != nil || pending != step.want {
+			t.Errorf("%s: Pending() = %v, %v, want %v", step.name, pending, err, step.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+var restartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "aks_flex_node_restarts_total",
+	Help: "Agent-driven node restarts by disruption level and outcome (performed or refused).",
+}, []string{"disruption", "outcome"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(restartsTotal)
+}
+
+// DisruptionRefusedError is returned when agent.disruption does not allow a
+// restart now.
+type DisruptionRefusedError struct {
+	Level string
+	Max   string
+	// RetryAfter is the time until the next window opens, or zero when no
+	// window is configured.
+	RetryAfter time.Duration
+	// Blockers, when set, are the workloads on the node the restart would
+	// disrupt against their PodDisruptionBudgets or annotations.
+	Blockers []string
+	// Prefetched, when set, is the machine generation already downloaded
+	// for the deferred repave.
+	Prefetched string
+}
+
+func (e *DisruptionRefusedError) Error() string {
+	var msg string
+	if len(e.Blockers) > 0 {
+		msg = fmt.Sprintf("%s restart deferred for the node's workloads, retrying in %s: %s",
+			e.Level, e.RetryAfter.Round(time.Minute), strings.Join(e.Blockers, "; "))
+	} else {
+		msg = fmt.Sprintf("%s restart refused: agent.disruption.maxDisruption is %s", e.Level, e.Max)
+		if e.RetryAfter > 0 {
+			msg += fmt.Sprintf(" and the next window opens in %s", e.RetryAfter.Round(time.Minute))
+		}
+	}
+	if e.Prefetched != "" {
+		msg = fmt.Sprintf("new machine generation %s downloaded; %s", e.Prefetched, msg)
+	}
+	return msg
+}
+
+// disruptionGuard decides whether a restart of a given level may run now.
+type disruptionGuard struct {
+	cfg config.DisruptionConfig
+	now func() time.Time
+	// workloads, when set, defers machine restarts that would disrupt the
+	// node's workloads. It is set by the daemon with
+	// agent.disruption.respectPodDisruptionBudgets.
+	workloads *workloadGuard
+}
+
+func newDisruptionGuard(cfg config.DisruptionConfig) disruptionGuard {
+	return disruptionGuard{cfg: cfg, now: time.Now}
+}
+
+// allow returns nil when a restart of level is permitted by maxDisruption or
+// falls in a window and, for machine restarts, does not disrupt workloads the
+// node's PodDisruptionBudgets protect. It counts refusals; the caller counts
+// the restart with performed once it has succeeded.
+func (g disruptionGuard) allow(ctx context.Context, log *slog.Logger, level string) error {
+	if err := g.allowLevel(log, level); err != nil {
+		restartsTotal.WithLabelValues(level, "refused").Inc()
+		return err
+	}
+	if g.workloads != nil && level == config.DisruptionMachine {
+		blockers, err := g.workloads.blockers(ctx)
+		if err != nil {
+			return fmt.Errorf("check workloads before %s restart: %w", level, err)
+		}
+		if len(blockers) > 0 {
+			restartsTotal.WithLabelValues(level, "refused").Inc()
+			return &DisruptionRefusedError{Level: level, Max: g.cfg.MaxDisruption, RetryAfter: workloadRecheckInterval, Blockers: blockers}
+		}
+	}
+	return nil
+}
+
+// performed counts a restart of level that allow permitted and that completed.
+func (g disruptionGuard) performed(level string) {
+	restartsTotal.WithLabelValues(level, "performed").Inc()
+}
+
+func (g disruptionGuard) allowLevel(log *slog.Logger, level string) error {
+	if g.cfg.DisruptionAllowed(level) {
+		return nil
+	}
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+	open, wait := g.cfg.NextWindow(now())
+	if open {
+		log.Info("restart exceeds agent.disruption.maxDisruption but a window is open", "disruption", level, "maxDisruption", g.cfg.MaxDisruption)
+		return nil
+	}
+	return &DisruptionRefusedError{Level: level, Max: g.cfg.MaxDisruption, RetryAfter: wait}
+}
+
+type restartKubeletTask struct {
+	log     *slog.Logger
+	machine string
+}
+
+// restartKubelet returns a task that restarts only the kubelet inside
+// machine. containerd and its shims keep running, so the node's containers
+// survive and the kubelet adopts them again.
+func restartKubelet(log *slog.Logger, machine string) phases.Task {
+	return &restartKubeletTask{log: log, machine: machine}
+}
+
+func (t *restartKubeletTask) Name() string { return "restart-kubelet" }
+
+func (t *restartKubeletTask) Do(ctx context.Context) error {
+	if _, err := utilexec.MachineRun(ctx, t.log, t.machine, "systemctl", "restart", goalstates.SystemdUnitKubelet); err != nil {
+		return fmt.Errorf("restart kubelet in %s: %w", t.machine, err)
+	}
+	return nil
+}
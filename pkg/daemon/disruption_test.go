@@ -0,0 +1,38 @@
+package daemon
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestDisruptionGuardAllow(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.DiscardHandler)
+	at := time.Date(2026, 3, 4, 1, 0, 0, 0, time.UTC)
+	guard := disruptionGuard{
+		cfg: config.DisruptionConfig{MaxDisruption: config.DisruptionKubelet, Windows: []string{"02:00-05:00"}},
+		now: func() time.Time { return at },
+	}
+
+	if err := guard.allow(t.Context(), log, config.DisruptionKubelet); err != nil {
+		t.Fatalf("allow(kubelet) = %v, want nil", err)
+	}
+	err := guard.allow(t.Context(), log, config.DisruptionMachine)
+	refused, ok := errors.AsType[*DisruptionRefusedError](err)
+	if !ok {
+		t.Fatalf("allow(machine) = %v, want DisruptionRefusedError", err)
+	}
+	if refused.RetryAfter != time.Hour {
+		t.Fatalf("RetryAfter = %s, want 1h", refused.RetryAfter)
+	}
+
+	at = at.Add(2 * time.Hour)
+	if err := guard.allow(t.Context(), log, config.DisruptionMachine); err != nil {
+		t.Fatalf("allow(machine) in window = %v, want nil", err)
+	}
+}
@@ -0,0 +1,335 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+)
+
+// Components of the streamed events. Log lines carry the component or
+// controller attribute they were logged with, or StreamComponentAgent.
+const (
+	StreamComponentAgent  = "agent"
+	StreamComponentAudit  = "audit"
+	StreamComponentNode   = "node"
+	StreamComponentStream = "stream"
+)
+
+const (
+	// eventHubRecent is the number of events replayed to a new subscriber,
+	// so a follower starts with context instead of an empty screen.
+	eventHubRecent = 200
+	// eventSubscriberBuffer bounds the events queued for one subscriber. A
+	// consumer that falls further behind loses events instead of slowing
+	// the agent, and is told how many it lost.
+	eventSubscriberBuffer = 256
+	// eventStreamKeepAlive is how often an idle stream writes a comment, so
+	// a consumer that went away is noticed.
+	eventStreamKeepAlive = 15 * time.Second
+)
+
+// StreamEvent is one entry of the live event stream: an agent log line at
+// info level or above, an audit event, or an Event recorded on the Node.
+type StreamEvent struct {
+	Sequence  uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Level     string            `json:"level"`
+	Component string            `json:"component"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// EventFilter selects the streamed events. The zero value selects every
+// event at info level or above.
+type EventFilter struct {
+	// Level is the lowest severity streamed.
+	Level slog.Level
+	// Components limits the stream to these components; empty streams all.
+	Components []string
+}
+
+func (f EventFilter) matches(event *StreamEvent) bool {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(event.Level)); err != nil || level < f.Level {
+		return false
+	}
+	return len(f.Components) == 0 || slices.Contains(f.Components, event.Component)
+}
+
+// query returns f as the stream route's query parameters.
+func (f EventFilter) query() string {
+	query := "level=" + strings.ToLower(f.Level.String())
+	if len(f.Components) > 0 {
+		query += "&component=" + strings.Join(f.Components, ",")
+	}
+	return query
+}
+
+func parseEventFilter(r *http.Request) (EventFilter, error) {
+	var filter EventFilter
+	if level := r.URL.Query().Get("level"); level != "" {
+		if err := filter.Level.UnmarshalText([]byte(level)); err != nil {
+			return filter, fmt.Errorf("invalid level %q: %w", level, err)
+		}
+	}
+	for _, component := range strings.Split(r.URL.Query().Get("component"), ",") {
+		if component = strings.TrimSpace(component); component != "" {
+			filter.Components = append(filter.Components, component)
+		}
+	}
+	return filter, nil
+}
+
+// eventHub fans the agent's events out to the stream's subscribers. It keeps
+// the latest events for new subscribers and never blocks a publisher: a
+// subscriber whose buffer is full misses the event. A nil hub publishes
+// nothing.
+type eventHub struct {
+	mu          sync.Mutex
+	sequence    uint64
+	recent      []StreamEvent
+	subscribers map[*eventSubscriber]struct{}
+	now         func() time.Time
+}
+
+type eventSubscriber struct {
+	filter EventFilter
+	events chan StreamEvent
+	// dropped counts the events missed since the last one delivered.
+	dropped int
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: map[*eventSubscriber]struct{}{}, now: time.Now}
+}
+
+func (h *eventHub) publish(level slog.Level, component, message string, fields map[string]string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sequence++
+	event := StreamEvent{
+		Sequence:  h.sequence,
+		Time:      h.now().UTC(),
+		Level:     level.String(),
+		Component: component,
+		Message:   message,
+		Fields:    fields,
+	}
+	if len(h.recent) == eventHubRecent {
+		h.recent = slices.Delete(h.recent, 0, 1)
+	}
+	h.recent = append(h.recent, event)
+	for sub := range h.subscribers {
+		if !sub.filter.matches(&event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the recent events that match
+// its filter. The subscriber must be passed to unsubscribe when done.
+func (h *eventHub) subscribe(filter EventFilter) (*eventSubscriber, []StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &eventSubscriber{filter: filter, events: make(chan StreamEvent, eventSubscriberBuffer)}
+	h.subscribers[sub] = struct{}{}
+	var recent []StreamEvent
+	for i := range h.recent {
+		if filter.matches(&h.recent[i]) {
+			recent = append(recent, h.recent[i])
+		}
+	}
+	return sub, recent
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// takeDropped returns and resets the number of events sub missed.
+func (h *eventHub) takeDropped(sub *eventSubscriber) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dropped := sub.dropped
+	sub.dropped = 0
+	return dropped
+}
+
+// logHandler returns a handler that passes records to next and publishes
+// those at info level or above, whatever the configured log level.
+func (h *eventHub) logHandler(next slog.Handler) slog.Handler {
+	return &eventLogHandler{next: next, hub: h}
+}
+
+// auditRecorder returns a recorder that passes events to next and publishes
+// them.
+func (h *eventHub) auditRecorder(next audit.Recorder) audit.Recorder {
+	return &eventAuditRecorder{next: next, hub: h}
+}
+
+// nodeEvent publishes an Event recorded on the Node.
+func (h *eventHub) nodeEvent(eventType, reason, message string) {
+	level := slog.LevelInfo
+	if eventType == corev1.EventTypeWarning {
+		level = slog.LevelWarn
+	}
+	h.publish(level, StreamComponentNode, message, map[string]string{"reason": reason})
+}
+
+type eventLogHandler struct {
+	next   slog.Handler
+	hub    *eventHub
+	attrs  []slog.Attr
+	groups string
+}
+
+func (h *eventLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || h.next.Enabled(ctx, level)
+}
+
+func (h *eventLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelInfo {
+		component := StreamComponentAgent
+		fields := map[string]string{}
+		add := func(a slog.Attr) bool {
+			key, value := h.groups+a.Key, a.Value.Resolve().String()
+			if a.Key == "component" || a.Key == "controller" {
+				component = value
+			} else {
+				fields[key] = value
+			}
+			return true
+		}
+		for _, a := range h.attrs {
+			add(a)
+		}
+		record.Attrs(add)
+		if len(fields) == 0 {
+			fields = nil
+		}
+		h.hub.publish(record.Level, component, record.Message, fields)
+	}
+	if !h.next.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *eventLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefixed := slices.Clone(h.attrs)
+	for _, a := range attrs {
+		prefixed = append(prefixed, slog.Attr{Key: h.groups + a.Key, Value: a.Value})
+	}
+	return &eventLogHandler{next: h.next.WithAttrs(attrs), hub: h.hub, attrs: prefixed, groups: h.groups}
+}
+
+func (h *eventLogHandler) WithGroup(name string) slog.Handler {
+	return &eventLogHandler{next: h.next.WithGroup(name), hub: h.hub, attrs: h.attrs, groups: h.groups + name + "."}
+}
+
+type eventAuditRecorder struct {
+	next audit.Recorder
+	hub  *eventHub
+}
+
+func (r *eventAuditRecorder) Record(ctx context.Context, event audit.Event) error {
+	fields := map[string]string{"operation": string(event.Operation), "target": event.Target}
+	if event.Detail != "" {
+		fields["detail"] = event.Detail
+	}
+	r.hub.publish(slog.LevelInfo, StreamComponentAudit, string(event.Operation)+" "+event.Target, fields)
+	return r.next.Record(ctx, event)
+}
+
+// serveEventStream streams the events matching the request's level and
+// component parameters as server-sent events, starting with the recent ones.
+// With follow=false it ends after those.
+func (s *controlServer) serveEventStream(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		http.Error(w, "event streaming is not supported by this daemon", http.StatusNotImplemented)
+		return
+	}
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+	sub, recent := s.events.subscribe(filter)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	for i := range recent {
+		if err := writeStreamEvent(w, &recent[i]); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	if r.URL.Query().Get("follow") == "false" {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event := <-sub.events:
+			if dropped := s.events.takeDropped(sub); dropped > 0 {
+				notice := StreamEvent{
+					Time:      time.Now().UTC(),
+					Level:     slog.LevelWarn.String(),
+					Component: StreamComponentStream,
+					Message:   fmt.Sprintf("%d events were dropped because the consumer fell behind", dropped),
+				}
+				if err := writeStreamEvent(w, &notice); err != nil {
+					return
+				}
+			}
+			if err := writeStreamEvent(w, &event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event *StreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
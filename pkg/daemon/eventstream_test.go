@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+)
+
+func TestEventHubPublishesLogsAuditAndNodeEvents(t *testing.T) {
+	t.Parallel()
+
+	hub := newEventHub()
+	log := slog.New(hub.logHandler(slog.DiscardHandler)).With("machine", "kube1")
+	log.Debug("not streamed")
+	log.Info("bootstrapped", "settingsVersion", "v2")
+	log.Warn("probe failed", "component", "apiprobe")
+	var audited auditEvents
+	if err := hub.auditRecorder(&audited).Record(t.Context(), audit.Event{Operation: audit.OperationFileWrite, Target: "/etc/kubelet.conf"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if len(audited) != 1 {
+		t.Fatalf("audited = %+v, want the event passed on", audited)
+	}
+	hub.nodeEvent(corev1.EventTypeWarning, EventReasonUnitDrift, "kubelet drifted")
+
+	_, recent := hub.subscribe(EventFilter{})
+	if len(recent) != 4 {
+		t.Fatalf("recent = %+v, want 4 events", recent)
+	}
+	if got := recent[0]; got.Component != StreamComponentAgent || got.Message != "bootstrapped" ||
+		got.Fields["machine"] != "kube1" || got.Fields["settingsVersion"] != "v2" {
+		t.Errorf("log event = %+v", got)
+	}
+	if got := recent[1]; got.Component != "apiprobe" || got.Level != "WARN" {
+		t.Errorf("component event = %+v", got)
+	}
+	if got := recent[2]; got.Component != StreamComponentAudit || got.Message != "file-write /etc/kubelet.conf" {
+		t.Errorf("audit event = %+v", got)
+	}
+	if got := recent[3]; got.Component != StreamComponentNode || got.Level != "WARN" || got.Fields["reason"] != EventReasonUnitDrift {
+		t.Errorf("node event = %+v", got)
+	}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   int
+	}{
+		{name: "warnings", filter: EventFilter{Level: slog.LevelWarn}, want: 2},
+		{name: "components", filter: EventFilter{Components: []string{StreamComponentAgent, StreamComponentAudit}}, want: 2},
+		{name: "warnings of a component", filter: EventFilter{Level: slog.LevelWarn, Components: []string{StreamComponentNode}}, want: 1},
+		{name: "errors", filter: EventFilter{Level: slog.LevelError}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, recent := hub.subscribe(tt.filter)
+			if len(recent) != tt.want {
+				t.Fatalf("recent = %+v, want %d events", recent, tt.want)
+			}
+		})
+	}
+}
+
+type auditEvents []audit.Event
+
+func (a *auditEvents) Record(_ context.Context, event audit.Event) error {
+	*a = append(*a, event)
+	return nil
+}
+
+func TestEventHubDropsForSlowSubscribers(t *testing.T) {
+	t.Parallel()
+
+	hub := newEventHub()
+	sub, _ := hub.subscribe(EventFilter{})
+	for range eventSubscriberBuffer + 10 {
+		hub.publish(slog.LevelInfo, StreamComponentAgent, "tick", nil)
+	}
+	if len(sub.events) != eventSubscriberBuffer {
+		t.Fatalf("queued = %d, want %d", len(sub.events), eventSubscriberBuffer)
+	}
+	if dropped := hub.takeDropped(sub); dropped != 10 {
+		t.Fatalf("dropped = %d, want 10", dropped)
+	}
+	if dropped := hub.takeDropped(sub); dropped != 0 {
+		t.Fatalf("dropped after take = %d, want 0", dropped)
+	}
+	if _, recent := hub.subscribe(EventFilter{}); len(recent) != eventHubRecent {
+		t.Fatalf("recent = %d events, want %d", len(recent), eventHubRecent)
+	}
+}
+
+func TestControlServerEventStream(t *testing.T) {
+	t.Parallel()
+
+	// Unix socket paths are length-limited, so avoid the long t.TempDir path.
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "ctl.sock")
+
+	server := newControlServer(slog.New(slog.DiscardHandler), socket, "node-a", &testStateStore{}, nil, nil, nil, nil)
+	server.events = newEventHub()
+	server.events.publish(slog.LevelInfo, StreamComponentAgent, "daemon started", nil)
+	server.events.publish(slog.LevelWarn, StreamComponentNode, "repave deferred", nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+
+	client := NewControlClient(socket)
+	var recent []StreamEvent
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recent = nil
+		err = client.StreamEvents(t.Context(), EventFilter{}, false, func(event StreamEvent) error {
+			recent = append(recent, event)
+			return nil
+		})
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("StreamEvents: %v", err)
+	}
+	if len(recent) != 2 || recent[0].Message != "daemon started" {
+		t.Fatalf("recent = %+v", recent)
+	}
+
+	// A follower gets the recent warning, then the events published after
+	// it subscribed.
+	errStop := errors.New("stop")
+	var followed []StreamEvent
+	err = client.StreamEvents(t.Context(), EventFilter{Level: slog.LevelWarn}, true, func(event StreamEvent) error {
+		followed = append(followed, event)
+		if len(followed) == 1 {
+			server.events.publish(slog.LevelInfo, StreamComponentAgent, "filtered out", nil)
+			server.events.publish(slog.LevelError, StreamComponentAgent, "repave failed", nil)
+			return nil
+		}
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("StreamEvents follow: %v", err)
+	}
+	if followed[0].Message != "repave deferred" || followed[1].Message != "repave failed" {
+		t.Fatalf("followed = %+v", followed)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
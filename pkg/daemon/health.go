@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// healthProbePaths are the kubelet-style probe routes. Each answers "ok", or
+// with ?verbose every check as [+]name ok or [-]name failed, and takes
+// ?exclude=name to skip a check. A single check is served at <path>/<name>.
+var healthProbePaths = []string{ControlHealthzPath, ControlLivezPath, ControlReadyzPath}
+
+// healthHandlers registers the probe routes on mux. /healthz and /livez only
+// report that the agent serves requests; /readyz reports whether the node is
+// bootstrapped and running.
+func (s *controlServer) healthHandlers(mux *http.ServeMux) {
+	alive := &healthz.Handler{Checks: map[string]healthz.Checker{"ping": healthz.Ping}}
+	ready := &healthz.Handler{Checks: s.readyChecks()}
+	for path, handler := range map[string]http.Handler{
+		ControlHealthzPath: alive,
+		ControlLivezPath:   alive,
+		ControlReadyzPath:  ready,
+	} {
+		mux.Handle("GET "+path, http.StripPrefix(path, handler))
+		mux.Handle("GET "+path+"/", http.StripPrefix(path, handler))
+	}
+}
+
+// readyChecks returns the /readyz checks: the bootstrap is complete, the
+// active machine's containerd and kubelet are active, and the node-local DNS
+// cache answers when it is enabled.
+func (s *controlServer) readyChecks() map[string]healthz.Checker {
+	checks := map[string]healthz.Checker{
+		"ping":      healthz.Ping,
+		"bootstrap": s.checkBootstrap,
+		"units":     s.checkUnits,
+	}
+	if s.localDNS != nil {
+		checks["localdns"] = s.checkLocalDNS
+	}
+	return checks
+}
+
+func (s *controlServer) checkBootstrap(r *http.Request) error {
+	if s.deferred != nil {
+		deferred, err := s.deferred.Pending()
+		if err != nil {
+			return err
+		}
+		if deferred {
+			return errors.New("bootstrap is deferred until the network is up")
+		}
+	}
+	state, err := s.state.Load(r.Context())
+	if err != nil {
+		return fmt.Errorf("load daemon state: %w", err)
+	}
+	if state == nil || state.ActiveMachine == "" {
+		return errors.New("the node is not bootstrapped")
+	}
+	return nil
+}
+
+func (s *controlServer) checkUnits(r *http.Request) error {
+	state, err := s.state.Load(r.Context())
+	if err != nil {
+		return fmt.Errorf("load daemon state: %w", err)
+	}
+	if state == nil || state.ActiveMachine == "" {
+		return errors.New("no active machine")
+	}
+	active, err := s.unitStates(r.Context(), state.ActiveMachine)
+	if err != nil {
+		return err
+	}
+	var inactive []string
+	for _, unit := range generationUnits {
+		if !active[unit] {
+			inactive = append(inactive, unit)
+		}
+	}
+	if len(inactive) > 0 {
+		return fmt.Errorf("%s not active in %s", strings.Join(inactive, ", "), state.ActiveMachine)
+	}
+	return nil
+}
+
+func (s *controlServer) checkLocalDNS(*http.Request) error {
+	last := s.localDNS.Last()
+	switch {
+	case last == nil:
+		return errors.New("the local DNS cache has not been checked yet")
+	case !last.Healthy:
+		return fmt.Errorf("the local DNS cache is not answering: %s", last.Error)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+)
+
+func TestHealthProbes(t *testing.T) {
+	t.Parallel()
+
+	state := &testStateStore{}
+	kubeletActive := false
+	server := newControlServer(slog.New(slog.DiscardHandler), "", "node-a", state, nil, nil, nil, nil)
+	server.deferred = &DeferredBootstrap{path: filepath.Join(t.TempDir(), deferredBootstrapFileName)}
+	server.unitStates = func(_ context.Context, machine string) (map[string]bool, error) {
+		if machine != "kube1" {
+			t.Errorf("unitStates(%q), want the active machine", machine)
+		}
+		return map[string]bool{goalstates.SystemdUnitContainerd: true, goalstates.SystemdUnitKubelet: kubeletActive}, nil
+	}
+	handler := server.handler()
+	get := func(path string) (int, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	for _, path := range []string{ControlHealthzPath, ControlLivezPath} {
+		if code, body := get(path); code != http.StatusOK || body != "ok" {
+			t.Errorf("GET %s = %d %q, want 200 ok", path, code, body)
+		}
+	}
+	if code, body := get(ControlLivezPath + "?verbose"); code != http.StatusOK || !strings.Contains(body, "[+]ping ok") {
+		t.Errorf("GET livez?verbose = %d %q, want the ping check listed", code, body)
+	}
+
+	if code, body := get(ControlReadyzPath); code != http.StatusInternalServerError ||
+		!strings.Contains(body, "[-]bootstrap failed") || !strings.Contains(body, "[-]units failed") {
+		t.Errorf("GET readyz before bootstrap = %d %q, want bootstrap and units failed", code, body)
+	}
+
+	if err := server.deferred.Mark(); err != nil {
+		t.Fatal(err)
+	}
+	state.state = &State{ActiveMachine: "kube1"}
+	if code, body := get(ControlReadyzPath + "/bootstrap"); code != http.StatusInternalServerError {
+		t.Errorf("GET readyz/bootstrap with a deferred bootstrap = %d %q, want 500", code, body)
+	}
+	if err := server.deferred.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := get(ControlReadyzPath + "/bootstrap"); code != http.StatusOK {
+		t.Errorf("GET readyz/bootstrap = %d %q, want 200", code, body)
+	}
+
+	if code, body := get(ControlReadyzPath); code != http.StatusInternalServerError || !strings.Contains(body, "[-]units failed") {
+		t.Errorf("GET readyz with kubelet inactive = %d %q, want units failed", code, body)
+	}
+	if code, body := get(ControlReadyzPath + "?exclude=units"); code != http.StatusOK {
+		t.Errorf("GET readyz?exclude=units = %d %q, want 200", code, body)
+	}
+	kubeletActive = true
+	if code, body := get(ControlReadyzPath + "?verbose"); code != http.StatusOK ||
+		!strings.Contains(body, "[+]units ok") || !strings.Contains(body, "check passed") {
+		t.Errorf("GET readyz?verbose = %d %q, want every check passed", code, body)
+	}
+}
@@ -0,0 +1,148 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NodeConditionFlexAgentHealthy reports whether the flex node daemon is
+	// running and heartbeating. It is independent of the kubelet's Ready.
+	NodeConditionFlexAgentHealthy corev1.NodeConditionType = "FlexAgentHealthy"
+
+	heartbeatLeaseNamespace = corev1.NamespaceNodeLease
+	heartbeatLeasePrefix    = "aks-flex-node-"
+
+	heartbeatReasonRunning = "AgentHeartbeating"
+	heartbeatReasonStopped = "AgentStopped"
+
+	// heartbeatLeaseDurationFactor matches the kubelet's 10s renew / 40s lease.
+	heartbeatLeaseDurationFactor = 4
+)
+
+// heartbeatLeaseName returns the daemon's Lease name. It differs from the
+// kubelet's Lease so the two liveness signals can be told apart.
+func heartbeatLeaseName(nodeName string) string {
+	return heartbeatLeasePrefix + nodeName
+}
+
+// heartbeatPublisher renews a Lease while the daemon runs and keeps a Node
+// condition reporting whether it runs. The Lease carries liveness; the
+// condition is only patched when it changes, so a healthy daemon does not
+// write the Node object every interval. It implements manager.Runnable.
+type heartbeatPublisher struct {
+	log      *slog.Logger
+	reader   client.Reader
+	client   client.Client
+	nodeName string
+	interval time.Duration
+	now      func() time.Time
+	wakeups  chan struct{}
+}
+
+func newHeartbeatPublisher(log *slog.Logger, reader client.Reader, c client.Client, nodeName string, interval time.Duration) *heartbeatPublisher {
+	return &heartbeatPublisher{
+		log:      log,
+		reader:   reader,
+		client:   c,
+		nodeName: nodeName,
+		interval: interval,
+		now:      time.Now,
+		wakeups:  make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: every daemon heartbeats for its own node.
+func (h *heartbeatPublisher) NeedLeaderElection() bool { return false }
+
+func (h *heartbeatPublisher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.beat(ctx)
+		select {
+		case <-ctx.Done():
+			// Report the stop with a fresh context so a clean shutdown is
+			// distinguishable from a lost node.
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := h.setCondition(stopCtx, corev1.ConditionFalse, heartbeatReasonStopped, "AKS Flex Node daemon stopped"); err != nil {
+				h.log.Debug("failed to report daemon stop on node", "error", err)
+			}
+			return nil
+		case <-ticker.C:
+		case <-h.wakeups:
+			ticker.Reset(h.interval)
+		}
+	}
+}
+
+// wake renews the heartbeat immediately, for example after host resume when
+// the Lease has likely expired.
+func (h *heartbeatPublisher) wake() {
+	select {
+	case h.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// beat renews the Lease and sets the Node condition when it does not read
+// running yet. Failures are logged and retried on the next tick; a missed
+// heartbeat is exactly what the Lease is meant to surface.
+func (h *heartbeatPublisher) beat(ctx context.Context) {
+	if err := h.renewLease(ctx); err != nil {
+		h.log.Warn("failed to renew heartbeat lease", "error", err)
+	}
+	if err := h.setCondition(ctx, corev1.ConditionTrue, heartbeatReasonRunning, "AKS Flex Node daemon is running"); err != nil {
+		h.log.Warn("failed to update node heartbeat condition", "error", err)
+	}
+}
+
+func (h *heartbeatPublisher) renewLease(ctx context.Context) error {
+	now := metav1.NewMicroTime(h.now())
+	duration := int32(heartbeatLeaseDurationFactor * h.interval / time.Second) //nolint:gosec // interval is validated to a small duration
+
+	lease := &coordinationv1.Lease{}
+	key := client.ObjectKey{Namespace: heartbeatLeaseNamespace, Name: heartbeatLeaseName(h.nodeName)}
+	err := h.reader.Get(ctx, key, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(h.nodeName),
+				LeaseDurationSeconds: ptr.To(duration),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if err := h.client.Create(ctx, lease); err != nil {
+			return fmt.Errorf("create lease %s: %w", key, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get lease %s: %w", key, err)
+	}
+	lease.Spec.HolderIdentity = ptr.To(h.nodeName)
+	lease.Spec.LeaseDurationSeconds = ptr.To(duration)
+	lease.Spec.RenewTime = &now
+	if err := h.client.Update(ctx, lease); err != nil {
+		return fmt.Errorf("update lease %s: %w", key, err)
+	}
+	return nil
+}
+
+// setCondition patches the FlexAgentHealthy condition when it changes. Its
+// LastHeartbeatTime is the time of the last change, not of the last beat.
+func (h *heartbeatPublisher) setCondition(ctx context.Context, status corev1.ConditionStatus, reason, message string) error {
+	return updateNodeCondition(ctx, h.reader, h.client, h.nodeName, h.now(), NodeConditionFlexAgentHealthy, status, reason, message)
+}
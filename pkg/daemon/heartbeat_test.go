@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHeartbeatPublisherBeat(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"},
+		}},
+	}
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(node).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	heartbeat := newHeartbeatPublisher(slog.New(slog.DiscardHandler), kubeClient, kubeClient, "node1", 10*time.Second)
+	heartbeat.now = func() time.Time { return now }
+
+	heartbeat.beat(t.Context())
+	now = now.Add(10 * time.Second)
+	heartbeat.beat(t.Context())
+
+	lease := &coordinationv1.Lease{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Namespace: corev1.NamespaceNodeLease, Name: "aks-flex-node-node1"}, lease); err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	if got := *lease.Spec.LeaseDurationSeconds; got != 40 {
+		t.Fatalf("LeaseDurationSeconds = %d, want 40", got)
+	}
+	if !lease.Spec.RenewTime.Time.Equal(now) || !lease.Spec.AcquireTime.Time.Equal(start) {
+		t.Fatalf("lease times = acquire %v renew %v, want %v / %v", lease.Spec.AcquireTime, lease.Spec.RenewTime, start, now)
+	}
+
+	got := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	var ready, healthy *corev1.NodeCondition
+	for i := range got.Status.Conditions {
+		switch got.Status.Conditions[i].Type {
+		case corev1.NodeReady:
+			ready = &got.Status.Conditions[i]
+		case NodeConditionFlexAgentHealthy:
+			healthy = &got.Status.Conditions[i]
+		}
+	}
+	if ready == nil {
+		t.Fatal("kubelet Ready condition was removed")
+	}
+	if healthy == nil || healthy.Status != corev1.ConditionTrue || healthy.Reason != heartbeatReasonRunning {
+		t.Fatalf("FlexAgentHealthy = %+v", healthy)
+	}
+	// The second beat renewed only the Lease.
+	if !healthy.LastHeartbeatTime.Time.Equal(start) || !healthy.LastTransitionTime.Time.Equal(start) {
+		t.Fatalf("FlexAgentHealthy times = heartbeat %v transition %v, want %v", healthy.LastHeartbeatTime, healthy.LastTransitionTime, start)
+	}
+
+	// A change of status is patched on the next beat.
+	if err := heartbeat.setCondition(t.Context(), corev1.ConditionFalse, heartbeatReasonStopped, "stopped"); err != nil {
+		t.Fatalf("setCondition: %v", err)
+	}
+	now = now.Add(10 * time.Second)
+	heartbeat.beat(t.Context())
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	for _, condition := range got.Status.Conditions {
+		if condition.Type == NodeConditionFlexAgentHealthy && (condition.Status != corev1.ConditionTrue || !condition.LastTransitionTime.Time.Equal(now)) {
+			t.Fatalf("FlexAgentHealthy after restart = %+v, want True since %v", condition, now)
+		}
+	}
+}
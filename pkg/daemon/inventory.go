@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/inventory"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+// inventoryReporter periodically collects the host inventory and hands it to
+// the configured exporters. It implements manager.Runnable.
+type inventoryReporter struct {
+	log       *slog.Logger
+	cfg       *config.Config
+	interval  time.Duration
+	state     stateStore
+	exporters []inventory.Exporter
+	collect   func() (*inventory.Inventory, error)
+}
+
+func newInventoryReporter(log *slog.Logger, cfg *config.Config, state stateStore) (*inventoryReporter, error) {
+	exporters, err := inventory.NewExporters(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &inventoryReporter{
+		log:       log,
+		cfg:       cfg,
+		interval:  time.Duration(cfg.Agent.Inventory.Interval),
+		state:     state,
+		exporters: exporters,
+		collect:   inventory.NewCollector(utilhost.HostRoot).Collect,
+	}, nil
+}
+
+// NeedLeaderElection reports false: every daemon reports its own host.
+func (r *inventoryReporter) NeedLeaderElection() bool { return false }
+
+func (r *inventoryReporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.export(ctx); err != nil {
+			r.log.Warn("failed to export inventory", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// export collects the inventory and hands it to every exporter. A failing
+// exporter does not keep the others from receiving it.
+func (r *inventoryReporter) export(ctx context.Context) error {
+	inv, err := r.collect()
+	if err != nil {
+		r.log.Debug("inventory collection was incomplete", "error", err)
+	}
+	inv.Agent.Instance = string(r.cfg.Instance)
+	inv.Cluster = inventory.Cluster{
+		NodeName:  r.cfg.Agent.NodeName,
+		AgentPool: r.cfg.Azure.TargetAgentPoolName,
+	}
+	if r.cfg.Azure.TargetCluster != nil {
+		inv.Cluster.ClusterResourceID = r.cfg.Azure.TargetCluster.ResourceID
+	}
+	if r.cfg.IsARCEnabled() {
+		inv.Cluster.ArcMachine = r.cfg.Azure.Arc.MachineName
+	}
+	if active, err := activeMachineFromStore(ctx, r.state, r.cfg.Instance); err != nil {
+		r.log.Debug("no active machine for inventory", "error", err)
+	} else {
+		inv.Agent.ActiveMachine = active.Name
+		inv.Agent.KubernetesVersion = active.State.AppliedKubernetesVersion
+	}
+
+	var errs []error
+	for _, exporter := range r.exporters {
+		if err := exporter.Export(ctx, inv); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", exporter.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/inventory"
+)
+
+type recordingExporter struct {
+	name string
+	err  error
+	got  *inventory.Inventory
+}
+
+func (e *recordingExporter) Name() string { return e.name }
+
+func (e *recordingExporter) Export(_ context.Context, inv *inventory.Inventory) error {
+	e.got = inv
+	return e.err
+}
+
+func TestInventoryReporterExport(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		Instance: "edge",
+		Agent:    config.AgentConfig{NodeName: "node1"},
+		Azure: config.AzureConfig{
+			TargetCluster:       &config.TargetClusterConfig{ResourceID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.ContainerService/managedClusters/c"},
+			TargetAgentPoolName: "aksflexnodes",
+			Arc:                 &config.ArcConfig{Enabled: true, MachineName: "edge-01"},
+		},
+	}
+	failing := &recordingExporter{name: "http cmdb", err: errors.New("connection refused")}
+	file := &recordingExporter{name: "file"}
+	reporter := &inventoryReporter{
+		log:       slog.New(slog.DiscardHandler),
+		cfg:       cfg,
+		state:     &testStateStore{state: &State{ActiveMachine: "kube1-edge", AppliedKubernetesVersion: "1.33.2"}},
+		exporters: []inventory.Exporter{failing, file},
+		collect: func() (*inventory.Inventory, error) {
+			return &inventory.Inventory{Hostname: "edge-01"}, errors.New("no DMI")
+		},
+	}
+
+	err := reporter.export(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "http cmdb") {
+		t.Errorf("export() error = %v, want the failing exporter named", err)
+	}
+	if file.got == nil {
+		t.Fatal("exporter after a failing one did not receive the inventory")
+	}
+	want := inventory.Cluster{
+		NodeName:          "node1",
+		ClusterResourceID: cfg.Azure.TargetCluster.ResourceID,
+		AgentPool:         "aksflexnodes",
+		ArcMachine:        "edge-01",
+	}
+	if file.got.Cluster != want {
+		t.Errorf("cluster = %+v, want %+v", file.got.Cluster, want)
+	}
+	if agent := file.got.Agent; agent.Instance != "edge" || agent.ActiveMachine != "kube1-edge" || agent.KubernetesVersion != "1.33.2" {
+		t.Errorf("agent = %+v", agent)
+	}
+}
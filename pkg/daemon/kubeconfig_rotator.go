@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+)
+
+const kubeconfigCheckInterval = time.Minute
+
+// kubeletCredentials generates and checks the kubelet kubeconfig; it is
+// implemented by *kubeconfig.Manager.
+type kubeletCredentials interface {
+	Check(machineDir string) error
+	Generate(ctx context.Context, machineDir string) (kubeconfig.Token, error)
+}
+
+// kubeconfigRotator regenerates the Arc-derived kubelet kubeconfig before the
+// token expires, when the token or kubeconfig is missing or damaged, and when
+// the API prober reports that the API server rejected the credentials. It
+// implements manager.Runnable.
+type kubeconfigRotator struct {
+	log         *slog.Logger
+	state       stateStore
+	credentials kubeletCredentials
+	prober      *apiProber
+	interval    time.Duration
+	machinesDir string
+	wakeups     chan struct{}
+
+	// regeneratedForRejection is set once the credentials were replaced
+	// after an authentication failure and cleared when a probe succeeds.
+	regeneratedForRejection bool
+}
+
+func newKubeconfigRotator(log *slog.Logger, state stateStore, credentials kubeletCredentials, prober *apiProber) *kubeconfigRotator {
+	return &kubeconfigRotator{
+		log:         log,
+		state:       state,
+		credentials: credentials,
+		prober:      prober,
+		interval:    kubeconfigCheckInterval,
+		machinesDir: machinesDir,
+		wakeups:     make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: the kubeconfig belongs to the local kubelet.
+func (r *kubeconfigRotator) NeedLeaderElection() bool { return false }
+
+func (r *kubeconfigRotator) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-r.wakeups:
+		}
+	}
+}
+
+// wake requests an immediate check, for example after the host resumed with
+// a token that expired while it was suspended.
+func (r *kubeconfigRotator) wake() {
+	select {
+	case r.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// run regenerates the kubeconfig when needed. Before the first node has been
+// started only the host token, which the daemon's own client uses, is kept
+// current.
+func (r *kubeconfigRotator) run(ctx context.Context) {
+	machineDir := ""
+	if state, err := r.state.Load(ctx); err != nil {
+		r.log.Warn("failed to load daemon state for kubeconfig check", "error", err)
+	} else if state != nil && state.ActiveMachine != "" {
+		machineDir = filepath.Join(r.machinesDir, state.ActiveMachine)
+	}
+
+	reason := r.credentials.Check(machineDir)
+	if reason == nil {
+		reason = r.rejected()
+	}
+	if reason == nil {
+		return
+	}
+	r.log.Info("regenerating kubelet kubeconfig", "reason", reason, "machineDir", machineDir)
+	if _, err := r.credentials.Generate(ctx, machineDir); err != nil {
+		r.log.Warn("failed to regenerate kubelet kubeconfig", "error", err)
+		return
+	}
+	if r.prober != nil {
+		r.prober.wake()
+	}
+}
+
+// rejected returns an error when the latest API probe failed to
+// authenticate. A revoked token is replaced once per outage rather than on
+// every probe, since a fresh token from the same identity that is rejected
+// again points at RBAC or cluster configuration instead.
+func (r *kubeconfigRotator) rejected() error {
+	report := r.prober.Last()
+	switch {
+	case report == nil:
+		return nil
+	case report.Healthy():
+		r.regeneratedForRejection = false
+		return nil
+	case report.Failure != apiprobe.FailureAuthentication || r.regeneratedForRejection:
+		return nil
+	}
+	r.regeneratedForRejection = true
+	return fmt.Errorf("API server rejected the kubelet credentials: %s", report.Message)
+}
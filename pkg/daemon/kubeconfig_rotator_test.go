@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+)
+
+type fakeKubeletCredentials struct {
+	stale     error
+	generated []string
+}
+
+func (f *fakeKubeletCredentials) Check(string) error { return f.stale }
+
+func (f *fakeKubeletCredentials) Generate(_ context.Context, machineDir string) (kubeconfig.Token, error) {
+	f.generated = append(f.generated, machineDir)
+	f.stale = nil
+	return kubeconfig.Token{}, nil
+}
+
+func TestKubeconfigRotator(t *testing.T) {
+	t.Parallel()
+
+	state := &testStateStore{state: &State{ActiveMachine: "kube1"}}
+	credentials := &fakeKubeletCredentials{stale: errors.New("kubelet token expires soon")}
+	prober := newAPIProber(slog.New(slog.DiscardHandler), state)
+	rotator := newKubeconfigRotator(slog.New(slog.DiscardHandler), state, credentials, prober)
+	rotator.machinesDir = "/machines"
+	wantDir := filepath.Join("/machines", "kube1")
+
+	rotator.run(t.Context())
+	if len(credentials.generated) != 1 || credentials.generated[0] != wantDir {
+		t.Fatalf("generated = %v, want one regeneration for %s", credentials.generated, wantDir)
+	}
+	rotator.run(t.Context())
+	if len(credentials.generated) != 1 {
+		t.Fatalf("generated = %v, want no regeneration for current credentials", credentials.generated)
+	}
+
+	// A rejected token is replaced once per outage.
+	prober.last = &apiprobe.Report{Failure: apiprobe.FailureAuthentication, Message: "401"}
+	rotator.run(t.Context())
+	rotator.run(t.Context())
+	if len(credentials.generated) != 2 {
+		t.Fatalf("generated = %v, want one regeneration after rejection", credentials.generated)
+	}
+	prober.last = &apiprobe.Report{}
+	rotator.run(t.Context())
+	prober.last = &apiprobe.Report{Failure: apiprobe.FailureAuthentication, Message: "401"}
+	rotator.run(t.Context())
+	if len(credentials.generated) != 3 {
+		t.Fatalf("generated = %v, want another regeneration after recovery and a new rejection", credentials.generated)
+	}
+
+	// Before the first node starts only the host token is maintained.
+	state.state = nil
+	credentials.stale = errors.New("missing")
+	rotator.run(t.Context())
+	if last := credentials.generated[len(credentials.generated)-1]; last != "" {
+		t.Fatalf("generated for %q without an active machine, want host only", last)
+	}
+}
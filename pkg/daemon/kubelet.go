@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/acrcredentials"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+// kubeletEnvFile is read by the unbounded kubelet unit through
+// EnvironmentFile=-/etc/default/kubelet inside the machine.
+const kubeletEnvFile = "etc/default/kubelet"
+
+// cpuManagerStateFile is the kubelet's CPU assignment checkpoint inside the
+// machine. The kubelet refuses to start when its policy differs from the
+// configured one.
+const cpuManagerStateFile = "var/lib/kubelet/cpu_manager_state"
+
+type writeKubeletTuningTask struct {
+	cfg        *config.Config
+	machineDir string
+}
+
+// WriteKubeletTuning returns a task that writes the node's kubelet tuning
+// flags (max pods, image GC thresholds, reservations, eviction thresholds,
+// the ports of a node instance, the performance profile's CPU and topology
+// manager policies, and the ACR image credential provider) into the machine
+// rootfs, where the kubelet unit picks them up as KUBELET_TUNING_ARGS.
+func WriteKubeletTuning(cfg *config.Config, machineDir string) phases.Task {
+	return &writeKubeletTuningTask{cfg: cfg, machineDir: machineDir}
+}
+
+func (t *writeKubeletTuningTask) Name() string { return "write-kubelet-tuning" }
+
+func (t *writeKubeletTuningTask) Plan() []string {
+	return []string{filepath.Join(t.machineDir, kubeletEnvFile)}
+}
+
+func (t *writeKubeletTuningTask) Do(context.Context) error {
+	path := filepath.Join(t.machineDir, kubeletEnvFile)
+	if err := utilio.WriteFile(path, kubeletTuningContent(t.cfg), 0o644); err != nil { //nolint:gosec // read by systemd inside the machine
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return removeStaleCPUManagerState(filepath.Join(t.machineDir, cpuManagerStateFile), t.cfg.Performance.CPUManagerPolicy)
+}
+
+// kubeletTuningContent renders the kubelet environment file for cfg.
+func kubeletTuningContent(cfg *config.Config) []byte {
+	return fmt.Appendf(nil, "KUBELET_TUNING_ARGS=%q\n", strings.Join(kubeletTuningArgs(cfg), " "))
+}
+
+// kubeletTuningCurrent reports whether the kubelet environment file in
+// machineDir already holds the tuning flags for cfg. The CPU manager policy
+// is one of those flags, so a matching file also means the checkpoint was
+// cleaned up when it was written.
+func kubeletTuningCurrent(cfg *config.Config, machineDir string) bool {
+	data, err := os.ReadFile(filepath.Join(machineDir, kubeletEnvFile)) //#nosec G304 -- fixed path inside the machine
+	return err == nil && bytes.Equal(data, kubeletTuningContent(cfg))
+}
+
+// removeStaleCPUManagerState removes the kubelet's CPU manager checkpoint
+// when it was written under a different policy, so the kubelet starts with
+// the new one instead of crash-looping.
+func removeStaleCPUManagerState(path, policy string) error {
+	data, err := os.ReadFile(path) //#nosec G304 -- fixed path inside the machine
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	if policy == "" {
+		policy = "none"
+	}
+	var state struct {
+		PolicyName string `json:"policyName"`
+	}
+	if err := json.Unmarshal(data, &state); err == nil && state.PolicyName == policy {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	return nil
+}
+
+func kubeletTuningArgs(cfg *config.Config) []string {
+	var args []string
+	if cfg.Node.MaxPods > 0 {
+		args = append(args, "--max-pods="+strconv.Itoa(cfg.Node.MaxPods))
+	}
+	kubelet := cfg.Node.Kubelet
+	if kubelet.ImageGCHighThreshold > 0 {
+		args = append(args, "--image-gc-high-threshold="+strconv.Itoa(kubelet.ImageGCHighThreshold))
+	}
+	if kubelet.ImageGCLowThreshold > 0 {
+		args = append(args, "--image-gc-low-threshold="+strconv.Itoa(kubelet.ImageGCLowThreshold))
+	}
+	if len(kubelet.KubeReserved) > 0 {
+		args = append(args, "--kube-reserved="+joinKubeletMap(kubelet.KubeReserved, "="))
+	}
+	if len(kubelet.SystemReserved) > 0 {
+		args = append(args, "--system-reserved="+joinKubeletMap(kubelet.SystemReserved, "="))
+	}
+	if len(kubelet.EvictionHard) > 0 {
+		args = append(args, "--eviction-hard="+joinKubeletMap(kubelet.EvictionHard, "<"))
+	}
+	if kubelet.Port > 0 {
+		args = append(args, "--port="+strconv.Itoa(kubelet.Port))
+	}
+	if kubelet.HealthzPort > 0 {
+		args = append(args, "--healthz-port="+strconv.Itoa(kubelet.HealthzPort))
+	}
+	perf := cfg.Performance
+	if perf.CPUManagerPolicy != "" {
+		args = append(args, "--cpu-manager-policy="+perf.CPUManagerPolicy)
+	}
+	if perf.ReservedCPUs != "" {
+		args = append(args, "--reserved-cpus="+perf.ReservedCPUs)
+	}
+	if perf.TopologyManagerPolicy != "" {
+		args = append(args, "--topology-manager-policy="+perf.TopologyManagerPolicy)
+	}
+	if perf.TopologyManagerScope != "" {
+		args = append(args, "--topology-manager-scope="+perf.TopologyManagerScope)
+	}
+	return append(args, acrcredentials.KubeletArgs(cfg)...)
+}
+
+// joinKubeletMap renders m in the kubelet's comma-separated map flag format
+// with sorted keys so the file is stable across runs.
+func joinKubeletMap(m map[string]string, sep string) string {
+	pairs := make([]string, 0, len(m))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		pairs = append(pairs, key+sep+m[key])
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+func TestWriteKubeletTuning(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Node: config.NodeConfig{
+		MaxPods: 32,
+		Kubelet: config.KubeletConfig{
+			ImageGCHighThreshold: 75,
+			ImageGCLowThreshold:  65,
+			KubeReserved:         map[string]string{"memory": "256Mi", "cpu": "100m"},
+			SystemReserved:       map[string]string{"memory": "128Mi"},
+			EvictionHard:         map[string]string{"nodefs.available": "10%", "memory.available": "100Mi"},
+			Port:                 10260,
+			HealthzPort:          10258,
+		},
+	}}
+	machineDir := t.TempDir()
+	if err := WriteKubeletTuning(cfg, machineDir).Do(context.Background()); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(machineDir, "etc", "default", "kubelet"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := `KUBELET_TUNING_ARGS="--max-pods=32 --image-gc-high-threshold=75 --image-gc-low-threshold=65 ` +
+		`--kube-reserved=cpu=100m,memory=256Mi --system-reserved=memory=128Mi ` +
+		`--eviction-hard=memory.available<100Mi,nodefs.available<10% --port=10260 --healthz-port=10258"` + "\n"
+	if string(data) != want {
+		t.Fatalf("kubelet env file =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestKubeletTuningCurrent(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Node: config.NodeConfig{MaxPods: 32}}
+	machineDir := t.TempDir()
+	if kubeletTuningCurrent(cfg, machineDir) {
+		t.Fatal("kubeletTuningCurrent() = true without an env file")
+	}
+	if err := WriteKubeletTuning(cfg, machineDir).Do(context.Background()); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if !kubeletTuningCurrent(cfg, machineDir) {
+		t.Fatal("kubeletTuningCurrent() = false after writing the same flags")
+	}
+	cfg.Node.MaxPods = 50
+	if kubeletTuningCurrent(cfg, machineDir) {
+		t.Fatal("kubeletTuningCurrent() = true after max pods changed")
+	}
+}
+
+func TestKubeletTuningArgsPerformanceProfile(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Performance: config.PerformanceConfig{
+		ReservedCPUs:          "0-1",
+		CPUManagerPolicy:      "static",
+		TopologyManagerPolicy: "single-numa-node",
+		TopologyManagerScope:  "pod",
+	}}
+	want := []string{"--cpu-manager-policy=static", "--reserved-cpus=0-1", "--topology-manager-policy=single-numa-node", "--topology-manager-scope=pod"}
+	if got := kubeletTuningArgs(cfg); !slices.Equal(got, want) {
+		t.Fatalf("kubeletTuningArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestRemoveStaleCPUManagerState(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cpu_manager_state")
+	if err := removeStaleCPUManagerState(path, "static"); err != nil {
+		t.Fatalf("removeStaleCPUManagerState() without a state file = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"policyName":"none","defaultCpuSet":""}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleCPUManagerState(path, ""); err != nil {
+		t.Fatalf("removeStaleCPUManagerState() = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("state for the same policy was removed: %v", err)
+	}
+	if err := removeStaleCPUManagerState(path, "static"); err != nil {
+		t.Fatalf("removeStaleCPUManagerState() = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state for another policy still exists: %v", err)
+	}
+}
+
+func TestKubeletTuningArgsOmitsUnsetSettings(t *testing.T) {
+	t.Parallel()
+
+	if args := kubeletTuningArgs(&config.Config{}); len(args) != 0 {
+		t.Fatalf("kubeletTuningArgs(empty) = %v, want none", args)
+	}
+}
+
+// concurrencyTask records the highest number of tasks running at once.
+type concurrencyTask struct {
+	mu      *sync.Mutex
+	running *int
+	peak    *int
+}
+
+func (concurrencyTask) Name() string { return "concurrency" }
+
+func (c concurrencyTask) Do(context.Context) error {
+	c.mu.Lock()
+	*c.running++
+	*c.peak = max(*c.peak, *c.running)
+	c.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Lock()
+	*c.running--
+	c.mu.Unlock()
+	return nil
+}
+
+func TestBoundedParallel(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, limit := range []int{1, 2, 3} {
+		var (
+			mu            sync.Mutex
+			running, peak int
+		)
+		tasks := make([]phases.Task, 5)
+		for i := range tasks {
+			tasks[i] = concurrencyTask{mu: &mu, running: &running, peak: &peak}
+		}
+		if err := boundedParallel(log, limit, tasks...).Do(context.Background()); err != nil {
+			t.Fatalf("limit %d: Do: %v", limit, err)
+		}
+		if peak > limit {
+			t.Errorf("limit %d: peak concurrency = %d", limit, peak)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/shutdown"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+)
+
+const (
+	// generationHealthTimeout bounds how long a health pass waits for the
+	// machine's units to come up. At boot the machine starts with the host,
+	// so the daemon may check before the kubelet is running.
+	generationHealthTimeout = 3 * time.Minute
+	// generationHealthInterval is the delay between health pass attempts.
+	generationHealthInterval = 5 * time.Second
+)
+
+// generationUnits are the units a healthy machine runs.
+var generationUnits = []string{goalstates.SystemdUnitContainerd, goalstates.SystemdUnitKubelet}
+
+// generationGuard tracks the last known good generation: the goal state
+// whose machine last passed a health pass after it was applied. When the
+// daemon starts and the applied generation's units do not come up, it
+// re-applies the last known good one. It implements manager.Runnable.
+type generationGuard struct {
+	log      *slog.Logger
+	store    stateStore
+	operator nodeOperator
+	recorder *nodeRecorder
+	shutdown *shutdown.Coordinator
+	// standby and power hold the check while they keep the kubelet stopped
+	// on purpose.
+	standby *standbyStore
+	power   *powerManager
+	// health returns nil when the machine's units are running.
+	health   func(ctx context.Context, machine string) error
+	timeout  time.Duration
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+func newGenerationGuard(log *slog.Logger, store stateStore, operator nodeOperator, recorder *nodeRecorder, coordinator *shutdown.Coordinator, standby *standbyStore, power *powerManager) *generationGuard {
+	return &generationGuard{
+		log:      log,
+		store:    store,
+		operator: operator,
+		recorder: recorder,
+		shutdown: coordinator,
+		standby:  standby,
+		power:    power,
+		health: func(ctx context.Context, machine string) error {
+			return machineUnitsActive(ctx, log, machine)
+		},
+		timeout:  generationHealthTimeout,
+		interval: generationHealthInterval,
+	}
+}
+
+// machineUnitsActive returns nil when every generation unit in machine is
+// active. It fails while the machine itself is not running.
+func machineUnitsActive(ctx context.Context, log *slog.Logger, machine string) error {
+	active, err := generationUnitStates(ctx, log, machine)
+	if err != nil {
+		return err
+	}
+	var inactive []string
+	for _, unit := range generationUnits {
+		if !active[unit] {
+			inactive = append(inactive, unit)
+		}
+	}
+	if len(inactive) > 0 {
+		return fmt.Errorf("%s not active in %s", strings.Join(inactive, " and "), machine)
+	}
+	return nil
+}
+
+// generationUnitStates reports which generation units in machine are active.
+func generationUnitStates(ctx context.Context, log *slog.Logger, machine string) (map[string]bool, error) {
+	out, err := utilexec.MachineRun(ctx, log, machine, append([]string{"systemctl", "is-active"}, generationUnits...)...)
+	states := strings.Fields(out)
+	if err != nil && len(states) == 0 {
+		return nil, fmt.Errorf("check units in %s: %w", machine, err)
+	}
+	active := make(map[string]bool, len(generationUnits))
+	for i, unit := range generationUnits {
+		active[unit] = i < len(states) && states[i] == "active"
+	}
+	return active, nil
+}
+
+// NeedLeaderElection reports false: every daemon guards its own machines.
+func (g *generationGuard) NeedLeaderElection() bool { return false }
+
+// Start runs the boot check once. A failure is logged rather than returned
+// so it does not stop the daemon.
+func (g *generationGuard) Start(ctx context.Context) error {
+	if err := g.CheckBoot(ctx); err != nil && ctx.Err() == nil {
+		g.log.Error("boot generation check failed", "error", err)
+	}
+	return nil
+}
+
+// CheckBoot runs a health pass on the applied generation. A healthy
+// generation becomes the last known good one; an unhealthy one is replaced
+// by re-applying the last known good goal state.
+func (g *generationGuard) CheckBoot(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if record, err := g.standby.Load(); err != nil || record != nil {
+		g.log.Info("node in standby, skipping boot generation check")
+		return nil
+	}
+	if asleep, _ := g.power.Sleeping(); asleep {
+		g.log.Info("node asleep on its power schedule, skipping boot generation check")
+		return nil
+	}
+	state, err := g.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.ActiveMachine == "" {
+		return nil
+	}
+	healthErr := g.healthy(ctx, state.ActiveMachine)
+	if healthErr == nil {
+		return g.record(ctx, state, nil)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	good := state.LastKnownGood
+	if good == nil || good.SettingsVersion == state.AppliedSettingsVersion {
+		message := fmt.Sprintf("Generation %s on %s did not start: %v. No other last known good generation to fall back to",
+			state.AppliedSettingsVersion, state.ActiveMachine, healthErr)
+		g.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonGenerationUnhealthy, message)
+		return healthErr
+	}
+	message := fmt.Sprintf("Generation %s on %s did not start: %v. Falling back to last known good generation %s",
+		state.AppliedSettingsVersion, state.ActiveMachine, healthErr, good.SettingsVersion)
+	g.log.Error("applied generation is unhealthy, falling back to the last known good one",
+		"settingsVersion", state.AppliedSettingsVersion, "machine", state.ActiveMachine,
+		"lastKnownGood", good.SettingsVersion, "error", healthErr)
+	g.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonGenerationFallback, message)
+	g.recorder.SetReconciled(ctx, corev1.ConditionFalse, reconciledReasonFellBack, message)
+
+	ctx, done := g.shutdown.Critical(ctx, "generation fallback")
+	defer done()
+	// The unhealthy machine is replaced even when the versions match: a
+	// kubelet restart in place would keep whatever broke it.
+	newState, err := g.operator.RepaveGoalState(ctx, g.log, *good)
+	if err != nil {
+		g.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonGenerationFallback,
+			fmt.Sprintf("Failed to fall back to last known good generation %s: %v", good.SettingsVersion, err))
+		return fmt.Errorf("fall back to generation %s: %w", good.SettingsVersion, err)
+	}
+	g.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonGenerationFallback,
+		fmt.Sprintf("Fell back to last known good generation %s on %s", good.SettingsVersion, newState.ActiveMachine))
+	return nil
+}
+
+// MarkGood runs a health pass on the generation just applied for goal and
+// records it as the last known good one when it passes.
+func (g *generationGuard) MarkGood(ctx context.Context, goal aksmachine.GoalState) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state, err := g.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.AppliedSettingsVersion != goal.SettingsVersion {
+		return nil
+	}
+	if err := g.healthy(ctx, state.ActiveMachine); err != nil {
+		return fmt.Errorf("generation %s failed its health pass: %w", goal.SettingsVersion, err)
+	}
+	return g.record(ctx, state, &goal)
+}
+
+// healthy polls the health check until it passes or the timeout expires,
+// and returns the last failure.
+func (g *generationGuard) healthy(ctx context.Context, machine string) error {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	for {
+		err := g.health(ctx, machine)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				return ctx.Err()
+			}
+			return err
+		case <-time.After(g.interval):
+		}
+	}
+}
+
+// record makes the applied generation the last known good one. Without a
+// goal, such as at boot, the applied goal the state keeps is recorded. Only
+// a state written before the applied goal was kept falls back to its
+// versions, and the goal's kubelet settings then default when it is
+// re-applied.
+func (g *generationGuard) record(ctx context.Context, state *State, goal *aksmachine.GoalState) error {
+	if goal == nil {
+		if good := state.LastKnownGood; good != nil && good.SettingsVersion == state.AppliedSettingsVersion {
+			return nil
+		}
+		goal = state.AppliedGoal
+		if goal == nil || goal.SettingsVersion != state.AppliedSettingsVersion {
+			goal = &aksmachine.GoalState{
+				SettingsVersion:   state.AppliedSettingsVersion,
+				KubernetesVersion: state.AppliedKubernetesVersion,
+			}
+		}
+	}
+	if goal.SettingsVersion == "" {
+		return nil
+	}
+	state.LastKnownGood = goal
+	if err := g.store.Save(ctx, state); err != nil {
+		return fmt.Errorf("record last known good generation: %w", err)
+	}
+	g.log.Info("recorded last known good generation", "settingsVersion", goal.SettingsVersion, "machine", state.ActiveMachine)
+	return nil
+}
@@ -0,0 +1,148 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+)
+
+func newTestGenerationGuard(t *testing.T, state *State, operator nodeOperator, health error) (*generationGuard, *fileStateStore, *int) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := newFileStateStore(filepath.Join(dir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		if err := store.Save(t.Context(), state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := newGenerationGuard(slog.New(slog.DiscardHandler), store, operator, nil, nil, newStandbyStore(filepath.Join(dir, standbyFileName)), nil)
+	checks := 0
+	g.health = func(context.Context, string) error {
+		checks++
+		return health
+	}
+	g.timeout = 20 * time.Millisecond
+	g.interval = time.Millisecond
+	return g, store, &checks
+}
+
+func TestGenerationGuardRecordsHealthyBoot(t *testing.T) {
+	t.Parallel()
+
+	operator := &fakeNodeOperator{}
+	g, store, _ := newTestGenerationGuard(t, &State{AppliedSettingsVersion: "42", AppliedKubernetesVersion: "1.34.0", ActiveMachine: "kube1"}, operator, nil)
+	if err := g.CheckBoot(t.Context()); err != nil {
+		t.Fatalf("CheckBoot: %v", err)
+	}
+	state, err := store.Load(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if good := state.LastKnownGood; good == nil || good.SettingsVersion != "42" || good.KubernetesVersion != "1.34.0" {
+		t.Fatalf("LastKnownGood = %+v, want 42 on 1.34.0", good)
+	}
+	if operator.applied {
+		t.Fatal("healthy generation was re-applied")
+	}
+}
+
+func TestGenerationGuardRecordsAppliedGoalAtBoot(t *testing.T) {
+	t.Parallel()
+
+	applied := &aksmachine.GoalState{SettingsVersion: "42", KubernetesVersion: "1.34.0", MaxPods: 30, NodeLabels: map[string]string{"team": "a"}}
+	g, store, _ := newTestGenerationGuard(t, &State{AppliedSettingsVersion: "42", AppliedKubernetesVersion: "1.34.0", ActiveMachine: "kube1", AppliedGoal: applied}, &fakeNodeOperator{}, nil)
+	if err := g.CheckBoot(t.Context()); err != nil {
+		t.Fatalf("CheckBoot: %v", err)
+	}
+	state, err := store.Load(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if good := state.LastKnownGood; good == nil || good.MaxPods != 30 || good.NodeLabels["team"] != "a" {
+		t.Fatalf("LastKnownGood = %+v, want the full applied goal", good)
+	}
+}
+
+func TestGenerationGuardFallsBack(t *testing.T) {
+	t.Parallel()
+
+	// The last known good generation has the same Kubernetes version, so
+	// only a forced repave replaces the broken machine.
+	good := &aksmachine.GoalState{SettingsVersion: "41", KubernetesVersion: "1.34.0", MaxPods: 50}
+	operator := &fakeNodeOperator{newState: &State{AppliedSettingsVersion: "41", ActiveMachine: "kube1", LastKnownGood: good}}
+	g, _, _ := newTestGenerationGuard(t,
+		&State{AppliedSettingsVersion: "42", AppliedKubernetesVersion: "1.34.0", ActiveMachine: "kube2", LastKnownGood: good},
+		operator, errors.New("kubelet not active in kube2"))
+	if err := g.CheckBoot(t.Context()); err != nil {
+		t.Fatalf("CheckBoot: %v", err)
+	}
+	if !operator.repaved {
+		t.Fatal("unhealthy generation did not fall back to the last known good one on a new machine")
+	}
+}
+
+func TestGenerationGuardWithoutFallback(t *testing.T) {
+	t.Parallel()
+
+	operator := &fakeNodeOperator{}
+	g, store, _ := newTestGenerationGuard(t, &State{AppliedSettingsVersion: "42", ActiveMachine: "kube1"}, operator, errors.New("kubelet not active in kube1"))
+	if err := g.CheckBoot(t.Context()); err == nil {
+		t.Fatal("CheckBoot succeeded for an unhealthy generation")
+	}
+	if operator.applied {
+		t.Fatal("applied a goal state without a last known good generation")
+	}
+	if state, _ := store.Load(t.Context()); state.LastKnownGood != nil {
+		t.Fatalf("unhealthy generation recorded as last known good: %+v", state.LastKnownGood)
+	}
+}
+
+func TestGenerationGuardSkipsStandby(t *testing.T) {
+	t.Parallel()
+
+	operator := &fakeNodeOperator{}
+	g, _, checks := newTestGenerationGuard(t, &State{AppliedSettingsVersion: "42", ActiveMachine: "kube1", LastKnownGood: &aksmachine.GoalState{SettingsVersion: "41"}},
+		operator, errors.New("kubelet not active in kube1"))
+	if err := g.standby.Save(&Standby{Since: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CheckBoot(t.Context()); err != nil {
+		t.Fatalf("CheckBoot: %v", err)
+	}
+	if *checks != 0 || operator.applied {
+		t.Fatalf("checked %d times and applied=%v while in standby", *checks, operator.applied)
+	}
+}
+
+func TestGenerationGuardMarkGood(t *testing.T) {
+	t.Parallel()
+
+	goal := aksmachine.GoalState{SettingsVersion: "42", KubernetesVersion: "1.34.0", MaxPods: 30}
+	g, store, _ := newTestGenerationGuard(t, &State{AppliedSettingsVersion: "42", AppliedKubernetesVersion: "1.34.0", ActiveMachine: "kube2"}, &fakeNodeOperator{}, nil)
+	if err := g.MarkGood(t.Context(), goal); err != nil {
+		t.Fatalf("MarkGood: %v", err)
+	}
+	state, err := store.Load(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if good := state.LastKnownGood; good == nil || good.MaxPods != 30 {
+		t.Fatalf("LastKnownGood = %+v, want the full goal", good)
+	}
+	// The next apply keeps it until its own health pass.
+	next := nextAppliedState(state, aksmachine.GoalState{SettingsVersion: "43"}, &activeMachine{Name: "kube1"})
+	if next.LastKnownGood == nil || next.LastKnownGood.SettingsVersion != "42" {
+		t.Fatalf("nextAppliedState dropped LastKnownGood: %+v", next.LastKnownGood)
+	}
+	if next.AppliedGoal == nil || next.AppliedGoal.SettingsVersion != "43" {
+		t.Fatalf("AppliedGoal = %+v, want the applied goal", next.AppliedGoal)
+	}
+}
@@ -1,78 +1,168 @@
 package daemon
 
 import (
+	"bytes"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/container"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
 
 const (
-	ServiceUnitName  = "aks-flex-node-agent.service"
 	systemdSystemDir = "/etc/systemd/system"
+
+	// stopHeadroom is added to agent.shutdownGracePeriod for the unit's
+	// TimeoutStopSec, so the daemon can release its resources after draining
+	// before systemd kills it.
+	stopHeadroom = 15 * time.Second
+	// defaultTimeoutStopSec is the unit template's TimeoutStopSec when no
+	// grace period is set.
+	defaultTimeoutStopSec = 60
 )
 
 //go:embed assets/aks-flex-node-agent.service
-var serviceUnitContent []byte
+var serviceUnitTemplate string
+
+var serviceUnit = template.Must(template.New("service").Parse(serviceUnitTemplate))
+
+// serviceUnitData fills the agent unit template.
+type serviceUnitData struct {
+	// Instance is passed as --instance for named instances so the daemon
+	// loads their config section.
+	Instance   config.Instance
+	BinaryPath string
+	// MemoryMax and CPUQuota, when set, cap the agent's cgroup. Machines run
+	// in their own units and are not affected.
+	MemoryMax int64
+	CPUQuota  int
+	// CPUWeight, IOWeight, Nice, and IOSchedulingClass, when set, make the
+	// agent's downloads and extraction yield to the machines' workloads.
+	CPUWeight         int
+	IOWeight          int
+	Nice              int
+	IOSchedulingClass string
+	// TimeoutStopSec is how long systemd waits for the daemon to drain;
+	// zero keeps the template default.
+	TimeoutStopSec int
+}
+
+func newServiceUnitData(cfg *config.Config) serviceUnitData {
+	data := serviceUnitData{
+		Instance:          cfg.Instance,
+		BinaryPath:        cfg.Agent.BinaryPath,
+		MemoryMax:         cfg.Agent.Resources.MemoryMaxBytes,
+		CPUQuota:          cfg.Agent.Resources.CPUQuotaPercent,
+		CPUWeight:         cfg.Agent.Resources.CPUWeight,
+		IOWeight:          cfg.Agent.Resources.IOWeight,
+		Nice:              cfg.Agent.Resources.Nice,
+		IOSchedulingClass: cfg.Agent.Resources.IOSchedulingClass,
+	}
+	if grace := time.Duration(cfg.Agent.ShutdownGracePeriod); grace > 0 {
+		data.TimeoutStopSec = int((grace + stopHeadroom).Round(time.Second).Seconds())
+	}
+	return data
+}
+
+// renderServiceUnit returns the agent unit.
+func renderServiceUnit(data serviceUnitData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := serviceUnit.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render service unit: %w", err)
+	}
+	return buf.Bytes(), nil
+}
 
 type installServiceTask struct {
-	log *slog.Logger
+	log  *slog.Logger
+	unit serviceUnitData
 }
 
-// InstallService returns a task that installs, enables, and starts the systemd unit.
-func InstallService(log *slog.Logger) phases.Task {
-	return &installServiceTask{log: log}
+// InstallService returns a task that installs, enables, and starts the
+// instance's systemd unit, which runs the binary at agent.binaryPath within
+// the agent.resources unit limits. In a container the container runtime
+// supervises the agent instead, and the task does nothing.
+func InstallService(log *slog.Logger, cfg *config.Config) phases.Task {
+	return &installServiceTask{log: log, unit: newServiceUnitData(cfg)}
 }
 
 func (t *installServiceTask) Name() string { return "install-service" }
 
 func (t *installServiceTask) Do(ctx context.Context) error {
-	unitPath := filepath.Join(systemdSystemDir, ServiceUnitName)
-	if err := utilio.WriteFile(unitPath, serviceUnitContent, 0o644); err != nil { //nolint:gosec // service files must be world-readable
+	unitName := t.unit.Instance.ServiceUnitName()
+	if container.Detect() {
+		t.log.Info("running in a container; not installing the agent unit", "unit", unitName)
+		return nil
+	}
+	unitContent, err := renderServiceUnit(t.unit)
+	if err != nil {
+		return err
+	}
+	unitPath := filepath.Join(systemdSystemDir, unitName)
+	before := audit.HashFile(unitPath)
+	if err := utilio.WriteFile(unitPath, unitContent, 0o644); err != nil { //nolint:gosec // service files must be world-readable
 		return fmt.Errorf("write %s: %w", unitPath, err)
 	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileWrite, Target: unitPath, BeforeHash: before, AfterHash: audit.HashBytes(unitContent)})
 
 	if err := utilexec.ReloadSystemd(ctx, t.log); err != nil {
 		return fmt.Errorf("systemctl daemon-reload: %w", err)
 	}
-	if err := utilexec.RunCmd(ctx, t.log, utilexec.Systemctl(), "enable", ServiceUnitName); err != nil {
-		return fmt.Errorf("systemctl enable %s: %w", ServiceUnitName, err)
+	if err := utilexec.EnableService(ctx, t.log, unitName); err != nil {
+		return fmt.Errorf("systemctl enable %s: %w", unitName, err)
 	}
-	if err := utilexec.RunCmd(ctx, t.log, utilexec.Systemctl(), "start", ServiceUnitName); err != nil {
-		return fmt.Errorf("systemctl start %s: %w", ServiceUnitName, err)
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitEnable, Target: unitName})
+	if err := utilexec.StartService(ctx, t.log, unitName); err != nil {
+		return fmt.Errorf("systemctl start %s: %w", unitName, err)
 	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitStart, Target: unitName})
 
-	t.log.Info("systemd service installed and started", "unit", ServiceUnitName)
+	t.log.Info("systemd service installed and started", "unit", unitName)
 	return nil
 }
 
 type uninstallServiceTask struct {
-	log *slog.Logger
+	log      *slog.Logger
+	instance config.Instance
 }
 
-// UninstallService returns a task that stops, disables, removes, and reloads the systemd unit.
-func UninstallService(log *slog.Logger) phases.Task {
-	return &uninstallServiceTask{log: log}
+// UninstallService returns a task that stops, disables, removes, and reloads
+// the instance's systemd unit.
+func UninstallService(log *slog.Logger, instance config.Instance) phases.Task {
+	return &uninstallServiceTask{log: log, instance: instance}
 }
 
 func (t *uninstallServiceTask) Name() string { return "uninstall-service" }
 
 func (t *uninstallServiceTask) Do(ctx context.Context) error {
-	if err := utilexec.StopService(ctx, t.log, ServiceUnitName); err != nil {
-		t.log.Warn("failed to stop service (may not be running)", "unit", ServiceUnitName, "error", err)
+	unitName := t.instance.ServiceUnitName()
+	if err := StopAgentService(ctx, t.log, t.instance); err != nil {
+		return err
 	}
-	if err := utilexec.DisableService(ctx, t.log, ServiceUnitName); err != nil {
-		t.log.Warn("failed to disable service (may not be enabled)", "unit", ServiceUnitName, "error", err)
+	if err := utilexec.DisableService(ctx, t.log, unitName); err != nil {
+		t.log.Warn("failed to disable service (may not be enabled)", "unit", unitName, "error", err)
+	} else {
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitDisable, Target: unitName})
 	}
 
-	unitPath := filepath.Join(systemdSystemDir, ServiceUnitName)
-	if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+	unitPath := filepath.Join(systemdSystemDir, unitName)
+	before := audit.HashFile(unitPath)
+	if err := os.Remove(unitPath); err == nil {
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileRemove, Target: unitPath, BeforeHash: before})
+	} else if !os.IsNotExist(err) {
 		return fmt.Errorf("remove %s: %w", unitPath, err)
 	}
 
@@ -80,6 +170,48 @@ func (t *uninstallServiceTask) Do(ctx context.Context) error {
 		return fmt.Errorf("systemctl daemon-reload: %w", err)
 	}
 
-	t.log.Info("systemd service uninstalled", "unit", ServiceUnitName)
+	t.log.Info("systemd service uninstalled", "unit", unitName)
+	return nil
+}
+
+// StopAgentService stops the instance's agent unit and returns once it is
+// inactive. systemd lets the daemon drain for the unit's TimeoutStopSec,
+// which follows agent.shutdownGracePeriod and may exceed systemctl's default
+// job timeout, so the stop is bounded by it plus stopHeadroom. When the stop
+// call fails or times out, for example because the unit is not running, the
+// unit is waited on as long again before the error is returned, so nothing
+// is removed while the daemon still finishes an operation.
+func StopAgentService(ctx context.Context, log *slog.Logger, instance config.Instance) error {
+	unitName := instance.ServiceUnitName()
+	timeout := agentStopTimeout(filepath.Join(systemdSystemDir, unitName))
+	stopErr := utilexec.StopServiceWithin(ctx, log, unitName, timeout)
+	if stopErr == nil {
+		audit.Record(ctx, log, audit.Event{Operation: audit.OperationUnitStop, Target: unitName})
+		return nil
+	}
+	log.Warn("failed to stop service (may not be running); waiting for it to become inactive", "unit", unitName, "error", stopErr)
+	if err := utilexec.WaitServiceInactive(ctx, log, unitName, timeout); err != nil {
+		return fmt.Errorf("stop %s: %w", unitName, errors.Join(stopErr, err))
+	}
 	return nil
 }
+
+// agentStopTimeout returns the installed unit's TimeoutStopSec plus
+// stopHeadroom, for the kill that follows it. Units that cannot be read get
+// the template default.
+func agentStopTimeout(unitPath string) time.Duration {
+	timeout := defaultTimeoutStopSec * time.Second
+	data, err := os.ReadFile(filepath.Clean(unitPath))
+	if err == nil {
+		for line := range strings.Lines(string(data)) {
+			value, ok := strings.CutPrefix(strings.TrimSpace(line), "TimeoutStopSec=")
+			if !ok {
+				continue
+			}
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				timeout = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return timeout + stopHeadroom
+}
@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestRenderServiceUnit(t *testing.T) {
+	t.Parallel()
+
+	unit, err := renderServiceUnit(serviceUnitData{BinaryPath: config.DefaultBinaryPath})
+	if err != nil {
+		t.Fatalf("renderServiceUnit: %v", err)
+	}
+	if !strings.Contains(string(unit), "--config /etc/aks-flex-node/config.json\n") || strings.Contains(string(unit), "--instance") ||
+		strings.Contains(string(unit), "MemoryMax=") || strings.Contains(string(unit), "CPUQuota=") || strings.Contains(string(unit), "Nice=") {
+		t.Fatalf("default unit =\n%s\nwant no --instance flag or resource limits", unit)
+	}
+
+	if !strings.Contains(string(unit), "TimeoutStopSec=60\n") {
+		t.Fatalf("default unit =\n%s\nwant the default TimeoutStopSec", unit)
+	}
+
+	unit, err = renderServiceUnit(serviceUnitData{
+		Instance: "gpu0", BinaryPath: "/opt/bin/aks-flex-node", MemoryMax: 268435456, CPUQuota: 50, TimeoutStopSec: 135,
+		CPUWeight: 20, IOWeight: 10, Nice: 10, IOSchedulingClass: config.IOSchedulingBestEffort,
+	})
+	if err != nil {
+		t.Fatalf("renderServiceUnit: %v", err)
+	}
+	for _, want := range []string{
+		"Description=AKS Flex Node Agent (gpu0)\n", "ExecStart=/opt/bin/aks-flex-node agent --config /etc/aks-flex-node/config.json --instance gpu0\n",
+		"StandardError=journal\nMemoryMax=268435456\nCPUQuota=50%\nCPUWeight=20\nIOWeight=10\nNice=10\nIOSchedulingClass=best-effort\nIOSchedulingPriority=7\n",
+		"TimeoutStopSec=135\n",
+	} {
+		if !strings.Contains(string(unit), want) {
+			t.Fatalf("instance unit =\n%s\nwant %q", unit, want)
+		}
+	}
+}
+
+func TestAgentStopTimeout(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	unit, err := renderServiceUnit(newServiceUnitData(&config.Config{Agent: config.AgentConfig{
+		BinaryPath:          config.DefaultBinaryPath,
+		ShutdownGracePeriod: config.JSONDuration(2 * time.Minute),
+	}}))
+	if err != nil {
+		t.Fatalf("renderServiceUnit: %v", err)
+	}
+	unitPath := filepath.Join(dir, "aks-flex-node-agent.service")
+	if err := os.WriteFile(unitPath, unit, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// A 2m grace period gives TimeoutStopSec=135, above systemctl's default
+	// 2m job timeout.
+	if got, want := agentStopTimeout(unitPath), 135*time.Second+stopHeadroom; got != want {
+		t.Fatalf("agentStopTimeout() = %v, want %v", got, want)
+	}
+	if got, want := agentStopTimeout(filepath.Join(dir, "missing.service")), defaultTimeoutStopSec*time.Second+stopHeadroom; got != want {
+		t.Fatalf("agentStopTimeout() without a unit = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/localdns"
+)
+
+const localDNSCheckInterval = 30 * time.Second
+
+// LocalDNSStatus is the latest health check of the node-local DNS cache.
+type LocalDNSStatus struct {
+	Address   string    `json:"address"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+	// Since is when the cache entered its current health.
+	Since time.Time `json:"since"`
+}
+
+// localDNSMonitor periodically resolves a cluster name through the local DNS
+// cache and logs when it stops or resumes answering. It implements
+// manager.Runnable.
+type localDNSMonitor struct {
+	log      *slog.Logger
+	address  string
+	interval time.Duration
+	check    func(ctx context.Context, address string) error
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last *LocalDNSStatus
+}
+
+func newLocalDNSMonitor(log *slog.Logger, address string) *localDNSMonitor {
+	return &localDNSMonitor{
+		log:      log,
+		address:  address,
+		interval: localDNSCheckInterval,
+		check:    localdns.Check,
+		now:      time.Now,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon monitors its own node.
+func (m *localDNSMonitor) NeedLeaderElection() bool { return false }
+
+func (m *localDNSMonitor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *localDNSMonitor) probe(ctx context.Context) {
+	err := m.check(ctx, m.address)
+	if ctx.Err() != nil {
+		return
+	}
+	now := m.now().UTC()
+	status := &LocalDNSStatus{Address: m.address, Healthy: err == nil, CheckedAt: now, Since: now}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	previous := m.last
+	if previous != nil && previous.Healthy == status.Healthy {
+		status.Since = previous.Since
+	}
+	m.last = status
+	m.mu.Unlock()
+
+	switch {
+	case err != nil && (previous == nil || previous.Healthy):
+		m.log.Warn("local DNS cache is not answering", "address", m.address, "error", err)
+	case err == nil && previous != nil && !previous.Healthy:
+		m.log.Info("local DNS cache is answering again", "address", m.address, "downFor", now.Sub(previous.Since).Round(time.Second))
+	}
+}
+
+// Last returns the latest check, or nil before the first one or when the
+// cache is not enabled.
+func (m *localDNSMonitor) Last() *LocalDNSStatus {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
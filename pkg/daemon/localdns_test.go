@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLocalDNSMonitor(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	checkErr := errors.New("i/o timeout")
+	monitor := newLocalDNSMonitor(slog.New(slog.DiscardHandler), "169.254.20.10")
+	monitor.check = func(context.Context, string) error { return checkErr }
+	monitor.now = func() time.Time { return now }
+
+	if monitor.Last() != nil {
+		t.Fatalf("Last() before the first check = %+v, want nil", monitor.Last())
+	}
+	monitor.probe(t.Context())
+	down := now
+	now = now.Add(time.Minute)
+	monitor.probe(t.Context())
+	last := monitor.Last()
+	if last == nil || last.Healthy || last.Error != "i/o timeout" || !last.Since.Equal(down) || !last.CheckedAt.Equal(now) {
+		t.Fatalf("Last() = %+v, want unhealthy since the first failure", last)
+	}
+
+	checkErr = nil
+	now = now.Add(time.Minute)
+	monitor.probe(t.Context())
+	if last := monitor.Last(); last == nil || !last.Healthy || last.Error != "" || !last.Since.Equal(now) {
+		t.Fatalf("Last() = %+v, want healthy since the recovery", last)
+	}
+
+	var nilMonitor *localDNSMonitor
+	if nilMonitor.Last() != nil {
+		t.Fatal("nil monitor Last() != nil")
+	}
+}
@@ -2,8 +2,10 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -11,6 +13,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/Azure/AKSFlexNode/pkg/shutdown"
 	machinav1alpha3 "github.com/Azure/unbounded/api/machina/v1alpha3"
 	"github.com/Azure/unbounded/pkg/agent/daemon"
 )
@@ -25,11 +28,13 @@ type machineOperationReconcilerOptions struct {
 	AKSMachineName       string
 	MachineOperationMode string
 	Operator             nodeOperator
+	Shutdown             *shutdown.Coordinator
 }
 
 type machineOperationHandlers struct {
 	log      *slog.Logger
 	operator nodeOperator
+	shutdown *shutdown.Coordinator
 }
 
 // machineOperationReconciler runs MachineOperations when the Machina CRD is available.
@@ -73,7 +78,7 @@ func machineOperationReconciler(
 		return nil, fmt.Errorf("AKS machine name is empty")
 	}
 
-	handlers := &machineOperationHandlers{log: opts.Log, operator: opts.Operator}
+	handlers := &machineOperationHandlers{log: opts.Log, operator: opts.Operator, shutdown: opts.Shutdown}
 	reconciler, err := daemon.NewMachinaMachineOperationReconciler(
 		opts.Client,
 		opts.NodeName,
@@ -112,10 +117,19 @@ func (h *machineOperationHandlers) reconcileNodeReboot(
 	store daemon.MachineOperationStore[int64],
 	op daemon.MachineOperation,
 ) (ctrl.Result, error) {
+	ctx, done := h.shutdown.Critical(ctx, "NodeReboot")
+	defer done()
 	if err := store.MarkInProgress(ctx, op, "restarting active nspawn node"); err != nil {
 		return ctrl.Result{}, fmt.Errorf("mark NodeReboot MachineOperation in progress: %w", err)
 	}
 	if err := h.operator.RestartNode(ctx, h.log); err != nil {
+		if refused, ok := errors.AsType[*DisruptionRefusedError](err); ok {
+			if refused.RetryAfter > 0 {
+				h.log.Info("deferring NodeReboot until the next disruption window", "retryAfter", refused.RetryAfter.Round(time.Second))
+				return ctrl.Result{RequeueAfter: refused.RetryAfter}, nil
+			}
+			return h.finishFailedMachineOperation(ctx, store, op, "DisruptionRefused", err.Error())
+		}
 		return h.finishFailedMachineOperation(
 			ctx,
 			store,
@@ -141,6 +155,8 @@ func (h *machineOperationHandlers) reconcileAgentReset(
 	store daemon.MachineOperationStore[int64],
 	op daemon.MachineOperation,
 ) (ctrl.Result, error) {
+	ctx, done := h.shutdown.Critical(ctx, "AgentReset")
+	defer done()
 	if err := store.MarkInProgress(
 		ctx,
 		op,
@@ -0,0 +1,351 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	maintenanceFileName = "maintenance.json"
+
+	// DefaultMaintenanceDuration bounds maintenance when the operator does not
+	// pass a duration, so a forgotten toggle cannot pause the node forever.
+	DefaultMaintenanceDuration = 4 * time.Hour
+	// DefaultDrainTimeout bounds how long enabling maintenance waits for pod
+	// evictions to be accepted.
+	DefaultDrainTimeout = 5 * time.Minute
+
+	drainRetryInterval  = 5 * time.Second
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+	// maintenanceCheckInterval is how often the expiry timer checks for a
+	// record while none is active, and retries a failed uncordon.
+	maintenanceCheckInterval = 5 * time.Minute
+)
+
+// Maintenance records an operator-requested pause of daemon reconciliation.
+type Maintenance struct {
+	Reason    string    `json:"reason,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Cordoned is true when enabling maintenance cordoned the node, so
+	// disabling it only uncordons nodes the agent cordoned itself.
+	Cordoned bool `json:"cordoned,omitempty"`
+	Drained  bool `json:"drained,omitempty"`
+}
+
+// Active reports whether maintenance is still in effect at now.
+func (m *Maintenance) Active(now time.Time) bool {
+	return m != nil && now.Before(m.ExpiresAt)
+}
+
+// MaintenanceRequest is the admin API payload that enables maintenance.
+type MaintenanceRequest struct {
+	Reason       string              `json:"reason,omitempty"`
+	Duration     config.JSONDuration `json:"duration,omitempty"`
+	Drain        bool                `json:"drain,omitempty"`
+	DrainTimeout config.JSONDuration `json:"drainTimeout,omitempty"`
+}
+
+// maintenanceStore persists the maintenance record so it survives daemon
+// restarts.
+type maintenanceStore struct {
+	path string
+}
+
+func newMaintenanceStore(path string) *maintenanceStore {
+	if path == "" {
+		path = filepath.Join(config.ConfigDir, maintenanceFileName)
+	}
+	return &maintenanceStore{path: path}
+}
+
+func (s *maintenanceStore) Load() (*Maintenance, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read maintenance record %s: %w", s.path, err)
+	}
+	var m Maintenance
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode maintenance record %s: %w", s.path, err)
+	}
+	return &m, nil
+}
+
+func (s *maintenanceStore) Save(m *Maintenance) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal maintenance record: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write maintenance record %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *maintenanceStore) Delete() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove maintenance record %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// maintenanceManager owns entering and leaving maintenance. The admin API
+// calls Enable and Disable; the repave reconciler calls Check before acting.
+// As a runnable, it ends maintenance when it expires, even while nothing
+// else reconciles.
+type maintenanceManager struct {
+	log      *slog.Logger
+	client   client.Client
+	reader   client.Reader
+	nodeName string
+	store    *maintenanceStore
+	recorder *nodeRecorder
+	now      func() time.Time
+	wakeups  chan struct{}
+
+	mu sync.Mutex
+}
+
+func newMaintenanceManager(log *slog.Logger, c client.Client, reader client.Reader, nodeName string, store *maintenanceStore, recorder *nodeRecorder) *maintenanceManager {
+	return &maintenanceManager{log: log, client: c, reader: reader, nodeName: nodeName, store: store, recorder: recorder, now: time.Now, wakeups: make(chan struct{}, 1)}
+}
+
+// NeedLeaderElection reports false: every daemon owns its node's maintenance.
+func (m *maintenanceManager) NeedLeaderElection() bool { return false }
+
+// Start ends maintenance when its record expires. Enable wakes it so a new
+// expiry is picked up at once.
+func (m *maintenanceManager) Start(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		case <-m.wakeups:
+		}
+		timer.Reset(m.expire(ctx))
+	}
+}
+
+// expire clears an expired record and returns how long to wait before the
+// next check.
+func (m *maintenanceManager) expire(ctx context.Context) time.Duration {
+	paused, remaining, err := m.Check(ctx)
+	switch {
+	case err != nil:
+		m.log.Warn("failed to end expired maintenance", "error", err)
+	case paused:
+		return remaining
+	}
+	return maintenanceCheckInterval
+}
+
+// Current returns the active maintenance record, or nil. It does not take the
+// lock so status queries are not blocked behind a long drain.
+func (m *maintenanceManager) Current() (*Maintenance, error) {
+	if m == nil {
+		return nil, nil
+	}
+	record, err := m.store.Load()
+	if err != nil || !record.Active(m.now()) {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Enable cordons the node, optionally drains it, and records maintenance.
+// Calling Enable while maintenance is active updates the reason and expiry.
+func (m *maintenanceManager) Enable(ctx context.Context, req MaintenanceRequest) (*Maintenance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	duration := time.Duration(req.Duration)
+	if duration <= 0 {
+		duration = DefaultMaintenanceDuration
+	}
+	now := m.now().UTC()
+	record, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if !record.Active(now) {
+		record = &Maintenance{StartedAt: now}
+	}
+	record.Reason = req.Reason
+	record.ExpiresAt = now.Add(duration)
+
+	cordoned, err := m.setUnschedulable(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	record.Cordoned = record.Cordoned || cordoned
+	// Persist before draining so a drain that times out still leaves the
+	// node paused and cordoned rather than half-configured.
+	if err := m.store.Save(record); err != nil {
+		return nil, err
+	}
+
+	if req.Drain {
+		timeout := time.Duration(req.DrainTimeout)
+		if timeout <= 0 {
+			timeout = DefaultDrainTimeout
+		}
+		if err := m.drain(ctx, timeout); err != nil {
+			return record, fmt.Errorf("drain node %s: %w", m.nodeName, err)
+		}
+		record.Drained = true
+		if err := m.store.Save(record); err != nil {
+			return nil, err
+		}
+	}
+	m.log.Info("node maintenance enabled", "reason", record.Reason, "expiresAt", record.ExpiresAt, "drained", record.Drained)
+	select {
+	case m.wakeups <- struct{}{}:
+	default:
+	}
+	m.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonMaintenanceEnabled,
+		fmt.Sprintf("Maintenance until %s: %s", record.ExpiresAt.Format(time.RFC3339), record.Reason))
+	return record, nil
+}
+
+// Disable ends maintenance and uncordons the node if maintenance cordoned it.
+func (m *maintenanceManager) Disable(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.disableLocked(ctx, "disabled")
+}
+
+// Check reports whether reconciliation must stay paused and for how long. An
+// expired record is cleared, which uncordons the node.
+func (m *maintenanceManager) Check(ctx context.Context) (bool, time.Duration, error) {
+	if m == nil {
+		return false, 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, err := m.store.Load()
+	if err != nil || record == nil {
+		return false, 0, err
+	}
+	now := m.now()
+	if record.Active(now) {
+		return true, record.ExpiresAt.Sub(now), nil
+	}
+	return false, 0, m.disableLocked(ctx, "expired")
+}
+
+func (m *maintenanceManager) disableLocked(ctx context.Context, why string) error {
+	record, err := m.store.Load()
+	if err != nil || record == nil {
+		return err
+	}
+	if record.Cordoned {
+		if _, err := m.setUnschedulable(ctx, false); err != nil {
+			return err
+		}
+	}
+	if err := m.store.Delete(); err != nil {
+		return err
+	}
+	m.log.Info("node maintenance "+why, "reason", record.Reason, "uncordoned", record.Cordoned)
+	m.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonMaintenanceDisabled, "Maintenance "+why)
+	return nil
+}
+
+// setUnschedulable sets spec.unschedulable and reports whether it changed.
+func (m *maintenanceManager) setUnschedulable(ctx context.Context, unschedulable bool) (bool, error) {
+	node := &corev1.Node{}
+	if err := m.reader.Get(ctx, client.ObjectKey{Name: m.nodeName}, node); err != nil {
+		return false, fmt.Errorf("get node %s: %w", m.nodeName, err)
+	}
+	if node.Spec.Unschedulable == unschedulable {
+		return false, nil
+	}
+	patch := fmt.Appendf(nil, `{"spec":{"unschedulable":%t}}`, unschedulable)
+	if err := m.client.Patch(ctx, node, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil {
+		return false, fmt.Errorf("set node %s unschedulable=%t: %w", m.nodeName, unschedulable, err)
+	}
+	return true, nil
+}
+
+// drain evicts the node's pods, honoring PodDisruptionBudgets by retrying
+// rejected evictions until timeout. DaemonSet and static pods are left alone,
+// as kubectl drain does. It returns once every eviction has been accepted.
+func (m *maintenanceManager) drain(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		pods := &corev1.PodList{}
+		if err := m.reader.List(ctx, pods, client.MatchingFields{"spec.nodeName": m.nodeName}); err != nil {
+			return fmt.Errorf("list pods: %w", err)
+		}
+		var pending int
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if !evictable(pod) {
+				continue
+			}
+			eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+			err := m.client.SubResource("eviction").Create(ctx, pod, eviction)
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+			case apierrors.IsTooManyRequests(err):
+				pending++
+			default:
+				return fmt.Errorf("evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		m.log.Info("waiting for pod disruption budgets to allow eviction", "pending", pending)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d pods could not be evicted: %w", pending, ctx.Err())
+		case <-time.After(drainRetryInterval):
+		}
+	}
+}
+
+func evictable(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
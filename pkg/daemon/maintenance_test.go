@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func newTestMaintenanceManager(t *testing.T, c client.Client) *maintenanceManager {
+	t.Helper()
+	store := newMaintenanceStore(filepath.Join(t.TempDir(), maintenanceFileName))
+	return newMaintenanceManager(slog.New(slog.DiscardHandler), c, c, "node1", store, nil)
+}
+
+func getNode(t *testing.T, c client.Client) *corev1.Node {
+	t.Helper()
+	node := &corev1.Node{}
+	if err := c.Get(t.Context(), client.ObjectKey{Name: "node1"}, node); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	return node
+}
+
+func TestMaintenanceEnableDisable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		alreadyCordoned  bool
+		wantUncordonLeft bool
+	}{
+		{name: "cordons and uncordons", alreadyCordoned: false, wantUncordonLeft: false},
+		{name: "leaves operator cordon in place", alreadyCordoned: true, wantUncordonLeft: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			kubeClient := fakeClient(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Spec:       corev1.NodeSpec{Unschedulable: tt.alreadyCordoned},
+			})
+			m := newTestMaintenanceManager(t, kubeClient)
+
+			record, err := m.Enable(t.Context(), MaintenanceRequest{Reason: "swap disk", Duration: config.JSONDuration(time.Hour)})
+			if err != nil {
+				t.Fatalf("Enable: %v", err)
+			}
+			if record.Cordoned == tt.alreadyCordoned || record.Reason != "swap disk" {
+				t.Fatalf("record = %+v", record)
+			}
+			if !getNode(t, kubeClient).Spec.Unschedulable {
+				t.Fatal("node was not cordoned")
+			}
+			paused, remaining, err := m.Check(t.Context())
+			if err != nil || !paused || remaining <= 0 {
+				t.Fatalf("Check = %v, %v, %v; want paused", paused, remaining, err)
+			}
+
+			if err := m.Disable(t.Context()); err != nil {
+				t.Fatalf("Disable: %v", err)
+			}
+			if got := getNode(t, kubeClient).Spec.Unschedulable; got != tt.wantUncordonLeft {
+				t.Fatalf("unschedulable = %v, want %v", got, tt.wantUncordonLeft)
+			}
+			if current, err := m.Current(); err != nil || current != nil {
+				t.Fatalf("Current = %+v, %v; want nil", current, err)
+			}
+		})
+	}
+}
+
+func TestMaintenanceExpires(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fakeClient(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	m := newTestMaintenanceManager(t, kubeClient)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	if _, err := m.Enable(t.Context(), MaintenanceRequest{Duration: config.JSONDuration(time.Minute)}); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+
+	paused, _, err := m.Check(t.Context())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if paused {
+		t.Fatal("Check reported paused after expiry")
+	}
+	if getNode(t, kubeClient).Spec.Unschedulable {
+		t.Fatal("expired maintenance left node cordoned")
+	}
+}
+
+func TestMaintenanceStartExpires(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fakeClient(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	m := newTestMaintenanceManager(t, kubeClient)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go m.Start(ctx) //nolint:errcheck // returns nil on cancel
+
+	if _, err := m.Enable(t.Context(), MaintenanceRequest{Duration: config.JSONDuration(100 * time.Millisecond)}); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for getNode(t, kubeClient).Spec.Unschedulable {
+		if time.Now().After(deadline) {
+			t.Fatal("expired maintenance left node cordoned without a reconcile")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if record, err := m.store.Load(); err != nil || record != nil {
+		t.Fatalf("record after expiry = %+v, %v; want none", record, err)
+	}
+}
+
+func TestMaintenanceCheckNil(t *testing.T) {
+	t.Parallel()
+
+	var m *maintenanceManager
+	if paused, _, err := m.Check(t.Context()); paused || err != nil {
+		t.Fatalf("nil Check = %v, %v; want not paused", paused, err)
+	}
+}
+
+func TestEvictable(t *testing.T) {
+	t.Parallel()
+
+	now := metav1.Now()
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want bool
+	}{
+		{name: "regular pod", pod: corev1.Pod{}, want: true},
+		{name: "daemonset pod", pod: corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", APIVersion: appsv1.SchemeGroupVersion.String()}}}}},
+		{name: "mirror pod", pod: corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{mirrorPodAnnotation: "x"}}}},
+		{name: "terminating pod", pod: corev1.Pod{ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now}}},
+		{name: "completed pod", pod: corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodSucceeded}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := evictable(&tt.pod); got != tt.want {
+				t.Fatalf("evictable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
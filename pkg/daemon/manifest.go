@@ -0,0 +1,218 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/localdns"
+	"github.com/Azure/AKSFlexNode/pkg/manifest"
+	"github.com/Azure/AKSFlexNode/pkg/nodetools"
+	"github.com/Azure/AKSFlexNode/pkg/npd"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const manifestFileName = "machine-manifest.json"
+
+// manifestPaths are the rootfs paths whose content the agent installs and
+// that no component rewrites at runtime: the node binaries, the CNI plugins,
+// and node-problem-detector.
+var manifestPaths = []string{
+	goalstates.BinDir,
+	strings.TrimPrefix(goalstates.CNIBinDir, "/"),
+	"usr/bin/node-problem-detector",
+}
+
+// ManifestStore persists the file manifest of the instance's active machine.
+type ManifestStore struct {
+	path string
+	// units queries the managed units of a running machine. Unit drift is
+	// not recorded or verified when it is nil.
+	units machineUnitsFunc
+}
+
+// NewManifestStore returns the store under the instance's state root.
+func NewManifestStore(instance config.Instance) *ManifestStore {
+	return &ManifestStore{path: filepath.Join(instance.StateDir(), manifestFileName), units: queryMachineUnits(slog.Default())}
+}
+
+// Load returns the recorded manifest, or nil when none was recorded.
+func (s *ManifestStore) Load() (*manifest.Manifest, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read machine manifest %s: %w", s.path, err)
+	}
+	var m manifest.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode machine manifest %s: %w", s.path, err)
+	}
+	return &m, nil
+}
+
+// Save overwrites the recorded manifest.
+func (s *ManifestStore) Save(m *manifest.Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal machine manifest: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write machine manifest %s: %w", s.path, err)
+	}
+	return nil
+}
+
+type recordManifestTask struct {
+	log        *slog.Logger
+	store      *ManifestStore
+	machine    string
+	machineDir string
+}
+
+// RecordManifest returns a task that hashes the files installed into the
+// machine rootfs at machineDir and records the files systemd loaded the
+// machine's units from, for later verification. The machine must be running.
+func RecordManifest(log *slog.Logger, instance config.Instance, machine, machineDir string) phases.Task {
+	return &recordManifestTask{log: log, store: NewManifestStore(instance), machine: machine, machineDir: machineDir}
+}
+
+func (t *recordManifestTask) Name() string { return "record-machine-manifest" }
+
+func (t *recordManifestTask) Do(ctx context.Context) error {
+	m, err := manifest.Build(t.machine, t.machineDir, manifestPaths)
+	if err != nil {
+		return fmt.Errorf("build machine manifest: %w", err)
+	}
+	if t.store.units != nil {
+		// Without a unit baseline only unit drift goes unnoticed, which is
+		// no reason to fail the bootstrap or repave.
+		if m.Units, err = recordUnits(ctx, t.store.units, t.machine, t.machineDir); err != nil {
+			t.log.Warn("failed to record the machine's units; unit drift is not checked", "machine", t.machine, "error", err)
+		}
+	}
+	return t.store.Save(m)
+}
+
+// VerifyActiveMachine re-hashes the instance's active machine against the
+// manifest recorded when it was bootstrapped or repaved.
+func VerifyActiveMachine(ctx context.Context, instance config.Instance) (*manifest.Manifest, []manifest.Mismatch, error) {
+	store, err := NewFileStateStore(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return verifyActiveMachine(ctx, store, NewManifestStore(instance), instance)
+}
+
+func verifyActiveMachine(ctx context.Context, state stateStore, manifests *ManifestStore, instance config.Instance) (*manifest.Manifest, []manifest.Mismatch, error) {
+	m, err := loadActiveManifest(ctx, state, manifests, instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	mismatches := manifest.Verify(m)
+	units, err := verifyUnits(ctx, manifests, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, append(mismatches, units...), nil
+}
+
+// loadActiveManifest returns the recorded manifest of the active machine.
+func loadActiveManifest(ctx context.Context, state stateStore, manifests *ManifestStore, instance config.Instance) (*manifest.Manifest, error) {
+	active, err := activeMachineFromStore(ctx, state, instance)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifests.Load()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("no machine manifest recorded; it is written by bootstrap and repave")
+	}
+	if m.Machine != active.Name {
+		return nil, fmt.Errorf("machine manifest is for %s but the active machine is %s", m.Machine, active.Name)
+	}
+	return m, nil
+}
+
+// RepairActiveMachine removes the mismatched files from the active machine,
+// re-runs the rootfs installs that recreate them, records a new manifest, and
+// restarts the node on the repaired rootfs. It requires maintenance mode so
+// the daemon does not repave the machine underneath the repair.
+func RepairActiveMachine(ctx context.Context, log *slog.Logger, cfg *config.Config, mismatches []manifest.Mismatch) error {
+	maintenance, err := newMaintenanceStore(filepath.Join(cfg.Instance.StateDir(), maintenanceFileName)).Load()
+	if err != nil {
+		return err
+	}
+	if !maintenance.Active(time.Now()) {
+		return fmt.Errorf("repair requires maintenance mode; run aks-flex-node maintenance enable first")
+	}
+	state, err := NewFileStateStore(cfg.Instance)
+	if err != nil {
+		return err
+	}
+	active, err := activeMachineFromStore(ctx, state, cfg.Instance)
+	if err != nil {
+		return err
+	}
+
+	cfg = cfg.DeepCopy()
+	if active.State.AppliedKubernetesVersion != "" {
+		cfg.Components.Kubernetes = active.State.AppliedKubernetesVersion
+	}
+	_, gs, containerImageArchives, err := config.ResolveMachineGoalState(log, cfg, active.Name)
+	if err != nil {
+		return fmt.Errorf("resolve goal state for repair: %w", err)
+	}
+
+	downloads := applyConcurrency(cfg)
+	return phases.Serial(log,
+		removeFiles(gs.RootFS.MachineDir, mismatches),
+		provisionRootFS(log, gs.RootFS, downloads),
+		boundedParallel(log, downloads,
+			npd.Download(log, cfg, gs.RootFS.MachineDir),
+			nodetools.Download(log, cfg, gs.RootFS.MachineDir),
+			localdns.Download(log, cfg, gs.RootFS.MachineDir),
+			InstallBinary(gs.RootFS.MachineDir),
+		),
+		ValidateRootFS(log, gs.RootFS),
+		restartMachine(log, cfg, active.Name, gs, containerImageArchives),
+		// Recorded once the machine runs again, so the unit baseline is
+		// taken from the restarted units.
+		RecordManifest(log, cfg.Instance, active.Name, gs.RootFS.MachineDir),
+	).Do(ctx)
+}
+
+type removeFilesTask struct {
+	machineDir string
+	mismatches []manifest.Mismatch
+}
+
+// removeFiles deletes the mismatched files so the version-checked rootfs
+// installs download them again instead of trusting what is on disk.
+func removeFiles(machineDir string, mismatches []manifest.Mismatch) phases.Task {
+	return &removeFilesTask{machineDir: machineDir, mismatches: mismatches}
+}
+
+func (t *removeFilesTask) Name() string { return "remove-mismatched-files" }
+
+func (t *removeFilesTask) Do(context.Context) error {
+	for _, mismatch := range t.mismatches {
+		path := filepath.Join(t.machineDir, mismatch.Path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
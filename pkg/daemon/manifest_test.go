@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyActiveMachine(t *testing.T) {
+	t.Parallel()
+
+	machineDir := t.TempDir()
+	kubelet := filepath.Join(machineDir, "usr/local/bin/kubelet")
+	writeScript(t, kubelet, "echo kubelet")
+
+	store := &ManifestStore{path: filepath.Join(t.TempDir(), manifestFileName)}
+	state := &testStateStore{state: &State{ActiveMachine: "kube1"}}
+
+	if _, _, err := verifyActiveMachine(context.Background(), state, store, ""); err == nil || !strings.Contains(err.Error(), "no machine manifest") {
+		t.Fatalf("verify without manifest error = %v", err)
+	}
+
+	record := &recordManifestTask{store: store, machine: "kube1", machineDir: machineDir}
+	if err := record.Do(context.Background()); err != nil {
+		t.Fatalf("record manifest: %v", err)
+	}
+	m, mismatches, err := verifyActiveMachine(context.Background(), state, store, "")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if m.Machine != "kube1" || len(m.Entries) != 1 || len(mismatches) != 0 {
+		t.Fatalf("manifest = %+v, mismatches = %+v", m, mismatches)
+	}
+
+	if err := os.WriteFile(kubelet, []byte("#!/bin/sh\necho tampered\n"), 0o755); err != nil { //nolint:gosec // test script
+		t.Fatal(err)
+	}
+	if _, mismatches, err = verifyActiveMachine(context.Background(), state, store, ""); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Path != "usr/local/bin/kubelet" {
+		t.Fatalf("mismatches = %+v, want usr/local/bin/kubelet", mismatches)
+	}
+
+	state.state.ActiveMachine = "kube2"
+	if _, _, err := verifyActiveMachine(context.Background(), state, store, ""); err == nil || !strings.Contains(err.Error(), "active machine is kube2") {
+		t.Fatalf("verify after repave error = %v", err)
+	}
+}
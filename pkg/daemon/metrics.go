@@ -0,0 +1,62 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	operationDurationSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_operation_duration_seconds",
+		Help: "Duration of the most recent bootstrap or repave operation.",
+	}, []string{"operation", "outcome"})
+
+	stepDurationSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_operation_step_duration_seconds",
+		Help: "Duration of each step in the most recent bootstrap or repave operation.",
+	}, []string{"operation", "step", "outcome"})
+
+	stepAttempts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_operation_step_attempts",
+		Help: "Number of attempts of each step in the most recent bootstrap or repave operation.",
+	}, []string{"operation", "step"})
+
+	standbyGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aks_flex_node_standby",
+		Help: "Whether the node is in standby with its kubelet stopped (1) or active (0).",
+	})
+
+	powerAsleepGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aks_flex_node_power_asleep",
+		Help: "Whether the power schedule has the node asleep (1) or awake (0).",
+	})
+
+	clusterEndpointRotatingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aks_flex_node_cluster_endpoint_rotating",
+		Help: "Whether the node is moving to a rotated cluster CA or a changed API server endpoint (1) or uses the current ones (0).",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(operationDurationSeconds, stepDurationSeconds, stepAttempts, standbyGauge, powerAsleepGauge, clusterEndpointRotatingGauge)
+}
+
+// publishTimings replaces the exported series for timings.Operation with the
+// given record, so only the most recent run of each operation is reported.
+func publishTimings(timings OperationTimings) {
+	if timings.Operation == "" {
+		return
+	}
+	labels := prometheus.Labels{"operation": timings.Operation}
+	operationDurationSeconds.DeletePartialMatch(labels)
+	stepDurationSeconds.DeletePartialMatch(labels)
+	stepAttempts.DeletePartialMatch(labels)
+
+	operationDurationSeconds.WithLabelValues(timings.Operation, timings.Outcome).Set(time.Duration(timings.Duration).Seconds())
+	for _, step := range timings.Steps {
+		stepDurationSeconds.WithLabelValues(timings.Operation, step.Name, step.Outcome).Set(time.Duration(step.Duration).Seconds())
+		stepAttempts.WithLabelValues(timings.Operation, step.Name).Set(float64(step.Attempts))
+	}
+}
@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NodeConditionFlexNodeReconciled reports whether the node's last repave
+	// applied the AKS machine goal state. It is Unknown while a repave runs.
+	NodeConditionFlexNodeReconciled corev1.NodeConditionType = "FlexNodeReconciled"
+
+	reconciledReasonApplying = "GoalStateApplying"
+	reconciledReasonApplied  = "GoalStateApplied"
+	reconciledReasonFailed   = "GoalStateFailed"
+	reconciledReasonFellBack = "GoalStateFellBack"
+)
+
+// Reasons of the Events recorded on the Node.
+const (
+	EventReasonRepaveStarted       = "FlexNodeRepaveStarted"
+	EventReasonRepaved             = "FlexNodeRepaved"
+	EventReasonRepaveFailed        = "FlexNodeRepaveFailed"
+	EventReasonRepaveDeferred      = "FlexNodeRepaveDeferred"
+	EventReasonResetting           = "FlexNodeResetting"
+	EventReasonMaintenanceEnabled  = "FlexNodeMaintenanceEnabled"
+	EventReasonMaintenanceDisabled = "FlexNodeMaintenanceDisabled"
+	EventReasonAcceleratorDrift    = "FlexNodeAcceleratorDrift"
+	EventReasonUnitDrift           = "FlexNodeUnitDrift"
+	EventReasonStandbyEntered      = "FlexNodeStandbyEntered"
+	EventReasonActivated           = "FlexNodeActivated"
+	EventReasonPowerSleep          = "FlexNodePowerSleep"
+	EventReasonPowerWake           = "FlexNodePowerWake"
+	EventReasonGenerationFallback  = "FlexNodeGenerationFallback"
+	EventReasonGenerationUnhealthy = "FlexNodeGenerationUnhealthy"
+
+	EventReasonClusterEndpointRotating = "FlexNodeClusterEndpointRotating"
+	EventReasonClusterEndpointRotated  = "FlexNodeClusterEndpointRotated"
+)
+
+// nodeEventComponent is the Event source, shown in the From column of
+// kubectl describe node.
+const nodeEventComponent = "aks-flex-node"
+
+// nodeRecorder records the daemon's lifecycle on the Node as Events and the
+// FlexNodeReconciled condition, so operators can follow it with kubectl
+// describe node. Recording is best effort: failures are logged and never
+// fail the operation being recorded. A nil recorder records nothing.
+type nodeRecorder struct {
+	log      *slog.Logger
+	reader   client.Reader
+	client   client.Client
+	nodeName string
+	now      func() time.Time
+	// events also streams the recorded Events from the local admin API.
+	events *eventHub
+}
+
+func newNodeRecorder(log *slog.Logger, reader client.Reader, c client.Client, nodeName string) *nodeRecorder {
+	return &nodeRecorder{log: log, reader: reader, client: c, nodeName: nodeName, now: time.Now}
+}
+
+// Event creates an Event about the Node. Like the kubelet, it uses the node
+// name as the involved object's UID, so the Event is listed for the Node
+// regardless of its current UID.
+func (r *nodeRecorder) Event(ctx context.Context, eventType, reason, message string) {
+	if r == nil {
+		return
+	}
+	r.events.nodeEvent(eventType, reason, message)
+	now := metav1.NewTime(r.now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: r.nodeName + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind: "Node",
+			Name: r.nodeName,
+			UID:  types.UID(r.nodeName),
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: nodeEventComponent, Host: r.nodeName},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: nodeEventComponent,
+		ReportingInstance:   r.nodeName,
+	}
+	if err := r.client.Create(ctx, event); err != nil {
+		r.log.Warn("failed to record node event", "reason", reason, "error", err)
+	}
+}
+
+// SetReconciled sets the FlexNodeReconciled condition.
+func (r *nodeRecorder) SetReconciled(ctx context.Context, status corev1.ConditionStatus, reason, message string) {
+	if r == nil {
+		return
+	}
+	if err := patchNodeCondition(ctx, r.reader, r.client, r.nodeName, r.now(), NodeConditionFlexNodeReconciled, status, reason, message); err != nil {
+		r.log.Warn("failed to set node condition", "condition", NodeConditionFlexNodeReconciled, "error", err)
+	}
+}
+
+// patchNodeCondition patches only the given condition with a strategic merge
+// patch, so conditions owned by the kubelet are left untouched. The
+// transition time is kept while the status is unchanged.
+func patchNodeCondition(ctx context.Context, reader client.Reader, c client.Client, nodeName string, at time.Time, conditionType corev1.NodeConditionType, status corev1.ConditionStatus, reason, message string) error {
+	node := &corev1.Node{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("get node %s: %w", nodeName, err)
+	}
+	return patchCondition(ctx, c, node, at, conditionType, status, reason, message)
+}
+
+// updateNodeCondition patches the condition like patchNodeCondition, but only
+// when its status, reason, or message differs from the Node's, so an
+// unchanged condition costs a read rather than a Node status write.
+func updateNodeCondition(ctx context.Context, reader client.Reader, c client.Client, nodeName string, at time.Time, conditionType corev1.NodeConditionType, status corev1.ConditionStatus, reason, message string) error {
+	node := &corev1.Node{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("get node %s: %w", nodeName, err)
+	}
+	for _, existing := range node.Status.Conditions {
+		if existing.Type == conditionType && existing.Status == status && existing.Reason == reason && existing.Message == message {
+			return nil
+		}
+	}
+	return patchCondition(ctx, c, node, at, conditionType, status, reason, message)
+}
+
+func patchCondition(ctx context.Context, c client.Client, node *corev1.Node, at time.Time, conditionType corev1.NodeConditionType, status corev1.ConditionStatus, reason, message string) error {
+	now := metav1.NewTime(at)
+	condition := corev1.NodeCondition{
+		Type:               conditionType,
+		Status:             status,
+		LastHeartbeatTime:  now,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	}
+	for _, existing := range node.Status.Conditions {
+		if existing.Type == conditionType && existing.Status == status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"status": map[string]any{"conditions": []corev1.NodeCondition{condition}},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal node condition patch: %w", err)
+	}
+	if err := c.Status().Patch(ctx, node, client.RawPatch(types.StrategicMergePatchType, patch)); err != nil {
+		return fmt.Errorf("patch node %s status: %w", node.Name, err)
+	}
+	return nil
+}
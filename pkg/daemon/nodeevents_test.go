@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+)
+
+func TestApplyGoalStateRecordsNodeLifecycle(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(node).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+	operator := &fakeNodeOperator{state: &State{}, newState: &State{AppliedSettingsVersion: "42"}}
+	repaves := newTestRepaveReconciler(t, &fakeMachineClient{machine: &aksmachine.Machine{}}, kubeClient, operator)
+	repaves.recorder = newNodeRecorder(slog.New(slog.DiscardHandler), kubeClient, kubeClient, "node1")
+
+	if err := repaves.applyGoalState(t.Context(), operator.state, aksmachine.GoalState{SettingsVersion: "42"}); err != nil {
+		t.Fatalf("applyGoalState: %v", err)
+	}
+
+	events := &corev1.EventList{}
+	if err := kubeClient.List(t.Context(), events); err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	var reasons []string
+	for _, event := range events.Items {
+		if event.InvolvedObject.Kind != "Node" || event.InvolvedObject.Name != "node1" || event.InvolvedObject.UID != "node1" {
+			t.Fatalf("event involved object = %+v", event.InvolvedObject)
+		}
+		reasons = append(reasons, event.Reason)
+	}
+	if len(reasons) != 2 || !slices.Contains(reasons, EventReasonRepaveStarted) || !slices.Contains(reasons, EventReasonRepaved) {
+		t.Fatalf("event reasons = %v, want %s and %s", reasons, EventReasonRepaveStarted, EventReasonRepaved)
+	}
+
+	got := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	var reconciled *corev1.NodeCondition
+	for i := range got.Status.Conditions {
+		if got.Status.Conditions[i].Type == NodeConditionFlexNodeReconciled {
+			reconciled = &got.Status.Conditions[i]
+		}
+	}
+	if reconciled == nil || reconciled.Status != corev1.ConditionTrue || reconciled.Reason != reconciledReasonApplied {
+		t.Fatalf("FlexNodeReconciled = %+v", reconciled)
+	}
+}
+
+func TestNilNodeRecorderRecordsNothing(t *testing.T) {
+	t.Parallel()
+
+	var recorder *nodeRecorder
+	recorder.Event(t.Context(), corev1.EventTypeNormal, EventReasonRepaved, "ignored")
+	recorder.SetReconciled(t.Context(), corev1.ConditionTrue, reconciledReasonApplied, "ignored")
+}
@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/kubeauth"
+)
+
+// systemUUIDPath is the host's SMBIOS system UUID, which the kubelet reports
+// as the Node's status.nodeInfo.systemUUID.
+const systemUUIDPath = "/sys/class/dmi/id/product_uuid"
+
+// ErrNodeNameTaken is returned by CheckNodeNameCollision when another host
+// registered a Node of the configured name.
+var ErrNodeNameTaken = errors.New("node name is taken by another host")
+
+// CheckNodeNameCollision looks for a Node of the resolved name that another
+// host registered, telling hosts apart by their system UUID. With
+// agent.nodeNaming.onCollision suffix a derived name is extended with a short
+// hash of this host's UUID and the new name is claimed for later config
+// loads; otherwise bootstrap fails. The check is skipped with a warning when
+// the host has no system UUID or the bootstrap credential may not read Nodes.
+func CheckNodeNameCollision(ctx context.Context, log *slog.Logger, cfg *config.Config) error {
+	hostUUID := deviceprofile.ReadFirmwareString(systemUUIDPath)
+	if hostUUID == "" {
+		log.Warn("skipping the node name collision check: the host reports no system UUID")
+		return nil
+	}
+	restCfg, err := kubeauth.BootstrapRESTConfig(cfg)
+	if err != nil {
+		log.Warn("skipping the node name collision check", "error", err)
+		return nil
+	}
+	reader, err := client.New(restCfg, client.Options{Scheme: newScheme()})
+	if err != nil {
+		log.Warn("skipping the node name collision check", "error", err)
+		return nil
+	}
+	return resolveNodeNameCollision(ctx, log, cfg, reader, hostUUID, config.SaveNodeNameClaim)
+}
+
+func resolveNodeNameCollision(ctx context.Context, log *slog.Logger, cfg *config.Config, reader client.Reader, hostUUID string, saveClaim func(config.Instance, config.NodeNameClaim) error) error {
+	name := cfg.Agent.NodeName
+	owner, err := nodeOwner(ctx, reader, name)
+	if err != nil {
+		log.Warn("skipping the node name collision check", "node", name, "error", err)
+		return nil
+	}
+	if owner == "" || strings.EqualFold(owner, hostUUID) {
+		return nil
+	}
+
+	naming := cfg.Agent.NodeNaming
+	suffix := "-" + nodeNameSuffix(hostUUID)
+	if !naming.SuffixesCollisions(naming.Strategy == config.NodeNamingExplicit) || strings.HasSuffix(name, suffix) {
+		return fmt.Errorf("%w: node %s has system UUID %s; set agent.nodeName or agent.nodeNaming", ErrNodeNameTaken, name, owner)
+	}
+	renamed := name + suffix
+	if owner, err := nodeOwner(ctx, reader, renamed); err != nil {
+		return fmt.Errorf("check node name %s: %w", renamed, err)
+	} else if owner != "" && !strings.EqualFold(owner, hostUUID) {
+		return fmt.Errorf("%w: node %s has system UUID %s", ErrNodeNameTaken, renamed, owner)
+	}
+	if err := saveClaim(cfg.Instance, config.NodeNameClaim{Derived: name, Name: renamed}); err != nil {
+		return err
+	}
+	log.Warn("node name is taken by another host; registering under a suffixed name", "taken", name, "owner", owner, "node", renamed)
+	cfg.Agent.NodeName = renamed
+	if arc := cfg.Azure.Arc; arc != nil && arc.MachineName == name {
+		arc.MachineName = renamed
+	}
+	return nil
+}
+
+// nodeOwner returns the system UUID of the Node name, or "" when there is no
+// such Node or its kubelet has not reported one yet.
+func nodeOwner(ctx context.Context, reader client.Reader, name string) (string, error) {
+	node := &corev1.Node{}
+	if err := reader.Get(ctx, client.ObjectKey{Name: name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return node.Status.NodeInfo.SystemUUID, nil
+}
+
+// nodeNameSuffix is a short, stable hash of the host's system UUID.
+func nodeNameSuffix(hostUUID string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(hostUUID)))
+	return hex.EncodeToString(sum[:3])
+}
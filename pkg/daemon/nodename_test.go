@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestResolveNodeNameCollision(t *testing.T) {
+	t.Parallel()
+
+	const hostUUID = "4C4C4544-0042-3510-8052-B4C04F4E4D32"
+	node := func(name, uuid string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{SystemUUID: uuid}},
+		}
+	}
+	suffixed := "gsinha-p14s-" + nodeNameSuffix(hostUUID)
+	for _, tc := range []struct {
+		name      string
+		nodes     []*corev1.Node
+		naming    config.NodeNamingConfig
+		wantName  string
+		wantErr   bool
+		wantClaim bool
+	}{
+		{name: "no node", wantName: "gsinha-p14s"},
+		{name: "own node", nodes: []*corev1.Node{node("gsinha-p14s", "4c4c4544-0042-3510-8052-b4c04f4e4d32")}, wantName: "gsinha-p14s"},
+		{name: "node not reported yet", nodes: []*corev1.Node{node("gsinha-p14s", "")}, wantName: "gsinha-p14s"},
+		{name: "taken fails", nodes: []*corev1.Node{node("gsinha-p14s", "other")}, wantErr: true},
+		{name: "taken is suffixed", nodes: []*corev1.Node{node("gsinha-p14s", "other")}, naming: config.NodeNamingConfig{OnCollision: config.NodeNameCollisionSuffix}, wantName: suffixed, wantClaim: true},
+		{name: "explicit is never suffixed", nodes: []*corev1.Node{node("gsinha-p14s", "other")}, naming: config.NodeNamingConfig{Strategy: config.NodeNamingExplicit, OnCollision: config.NodeNameCollisionSuffix}, wantErr: true},
+		{name: "suffixed is taken too", nodes: []*corev1.Node{node("gsinha-p14s", "other"), node(suffixed, "third")}, naming: config.NodeNamingConfig{OnCollision: config.NodeNameCollisionSuffix}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			builder := fake.NewClientBuilder().WithScheme(newScheme())
+			for _, n := range tc.nodes {
+				builder = builder.WithObjects(n)
+			}
+			cfg := &config.Config{Agent: config.AgentConfig{NodeName: "gsinha-p14s", NodeNaming: tc.naming}}
+			cfg.Azure.Arc = &config.ArcConfig{Enabled: true, MachineName: "gsinha-p14s"}
+			var claims []config.NodeNameClaim
+			save := func(_ config.Instance, claim config.NodeNameClaim) error {
+				claims = append(claims, claim)
+				return nil
+			}
+
+			err := resolveNodeNameCollision(t.Context(), slog.New(slog.DiscardHandler), cfg, builder.Build(), hostUUID, save)
+			if tc.wantErr {
+				if !errors.Is(err, ErrNodeNameTaken) {
+					t.Fatalf("resolveNodeNameCollision() = %v, want ErrNodeNameTaken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveNodeNameCollision: %v", err)
+			}
+			if cfg.Agent.NodeName != tc.wantName || cfg.Azure.Arc.MachineName != tc.wantName {
+				t.Fatalf("node name = %q, Arc machine = %q, want %q", cfg.Agent.NodeName, cfg.Azure.Arc.MachineName, tc.wantName)
+			}
+			if tc.wantClaim != (len(claims) == 1) {
+				t.Fatalf("claims = %+v", claims)
+			}
+			if tc.wantClaim && claims[0] != (config.NodeNameClaim{Derived: "gsinha-p14s", Name: suffixed}) {
+				t.Fatalf("claim = %+v", claims[0])
+			}
+		})
+	}
+}
@@ -2,11 +2,18 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 
+	"github.com/Azure/AKSFlexNode/pkg/acrcredentials"
 	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/hooks"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+	"github.com/Azure/AKSFlexNode/pkg/localdns"
 	"github.com/Azure/AKSFlexNode/pkg/npd"
 	"github.com/Azure/unbounded/pkg/agent/goalstates"
 	"github.com/Azure/unbounded/pkg/agent/phases"
@@ -23,6 +30,9 @@ type activeMachine struct {
 type nodeOperator interface {
 	LoadState(ctx context.Context) (*State, error)
 	ApplyGoalState(ctx context.Context, log *slog.Logger, goal aksmachine.GoalState) (*State, error)
+	// RepaveGoalState applies goal on the standby machine and swaps to it,
+	// even when the goal could be applied by restarting the kubelet.
+	RepaveGoalState(ctx context.Context, log *slog.Logger, goal aksmachine.GoalState) (*State, error)
 	RestartNode(ctx context.Context, log *slog.Logger) error
 	// ResetNode removes nspawn node runtime and persisted daemon state but must
 	// not stop this daemon process. The controller publishes lifecycle completion
@@ -42,30 +52,67 @@ func (o *nspawnNodeOperator) RestartNode(ctx context.Context, log *slog.Logger)
 	if active.State.AppliedKubernetesVersion != "" {
 		cfg.Components.Kubernetes = active.State.AppliedKubernetesVersion
 	}
+	if err := o.disruption.allow(ctx, log, config.DisruptionMachine); err != nil {
+		return err
+	}
 	_, gs, containerImageArchives, err := config.ResolveMachineGoalState(log, cfg, active.Name)
 	if err != nil {
 		return fmt.Errorf("resolve goal state for node restart: %w", err)
 	}
 
+	if err := restartMachine(log, cfg, active.Name, gs, containerImageArchives).Do(ctx); err != nil {
+		return err
+	}
+	o.disruption.performed(config.DisruptionMachine)
+	return nil
+}
+
+// restartMachine stops machine and starts it again on its existing rootfs.
+func restartMachine(
+	log *slog.Logger,
+	cfg *config.Config,
+	machine string,
+	gs *goalstates.MachineGoalState,
+	containerImageArchives *goalstates.ContainerImageArchiveStaging,
+) phases.Task {
+	dns := localdns.NewInstaller(log, cfg, gs.NodeStart)
 	return phases.Serial(log,
 		stageContainerImageArchiveBindSource(log, containerImageArchives),
-		nodestop.StopNode(log, active.Name),
+		nodestop.StopNode(log, machine),
+		kubeconfig.NewManager(log, cfg).Task(gs.RootFS.MachineDir),
+		acrcredentials.NewManager(log, cfg).Task(gs.RootFS.MachineDir),
+		dns.Configure(),
 		nodestart.StartNode(log, gs.NodeStart),
-		nodestart.WaitForKubelet(log, active.Name),
+		dns.Start(),
+		nodestart.WaitForKubelet(log, machine),
 		npd.Start(log, cfg, gs.NodeStart),
-	).Do(ctx)
+		refreshUnitHashes(log, cfg.Instance, machine),
+	)
 }
 
 type nspawnNodeOperator struct {
-	cfg   *config.Config
-	state stateStore
+	cfg        *config.Config
+	state      stateStore
+	timings    *TimingsStore
+	progress   *ProgressStore
+	snapshots  *SnapshotStore
+	prefetched *PrefetchStore
+	disruption disruptionGuard
 }
 
 func newNSpawnNodeOperator(cfg *config.Config, state stateStore) (*nspawnNodeOperator, error) {
 	if state == nil {
 		return nil, fmt.Errorf("state store is nil")
 	}
-	return &nspawnNodeOperator{cfg: cfg, state: state}, nil
+	return &nspawnNodeOperator{
+		cfg:        cfg,
+		state:      state,
+		timings:    NewTimingsStore(cfg.Instance),
+		progress:   NewProgressStore(cfg.Instance),
+		snapshots:  NewSnapshotStore(cfg.Instance),
+		prefetched: NewPrefetchStore(cfg.Instance),
+		disruption: newDisruptionGuard(cfg.Agent.Disruption),
+	}, nil
 }
 
 func (o *nspawnNodeOperator) LoadState(ctx context.Context) (*State, error) {
@@ -73,10 +120,20 @@ func (o *nspawnNodeOperator) LoadState(ctx context.Context) (*State, error) {
 }
 
 func (o *nspawnNodeOperator) findActiveMachine(ctx context.Context) (*activeMachine, error) {
-	return activeMachineFromStore(ctx, o.state)
+	return activeMachineFromStore(ctx, o.state, o.cfg.Instance)
 }
 
 func (o *nspawnNodeOperator) ApplyGoalState(ctx context.Context, log *slog.Logger, goal aksmachine.GoalState) (*State, error) {
+	return o.applyGoalState(ctx, log, goal, false)
+}
+
+func (o *nspawnNodeOperator) RepaveGoalState(ctx context.Context, log *slog.Logger, goal aksmachine.GoalState) (*State, error) {
+	return o.applyGoalState(ctx, log, goal, true)
+}
+
+// applyGoalState restarts the kubelet in place when goal changes only its
+// tuning flags and repave is not set, and otherwise swaps machines.
+func (o *nspawnNodeOperator) applyGoalState(ctx context.Context, log *slog.Logger, goal aksmachine.GoalState, repave bool) (*State, error) {
 	active, err := o.findActiveMachine(ctx)
 	if err != nil {
 		return nil, err
@@ -87,38 +144,164 @@ func (o *nspawnNodeOperator) ApplyGoalState(ctx context.Context, log *slog.Logge
 	if goal.KubernetesVersion != "" {
 		cfg.Components.Kubernetes = goal.KubernetesVersion
 	}
+	// With azure.inheritAgentPoolProfile the goal's labels and taints, which
+	// bootstrap merged from the agent pool, are added too, since the config
+	// file does not hold them.
+	aksmachine.MergeNodeProfile(cfg, goal)
+	if !repave && kubeletTuningOnly(active.State.AppliedGoal, goal) {
+		return o.applyKubeletSettings(ctx, log, cfg, active, goal)
+	}
 	oldMachine := active.Name
-	newMachine := goalstates.AlternateMachine(oldMachine)
+	newMachine := o.cfg.Instance.AlternateMachine(oldMachine)
+	_, gs, containerImageArchives, err := config.ResolveMachineGoalState(log, cfg, newMachine)
+	if err != nil {
+		return nil, fmt.Errorf("resolve goal state for repave: %w", err)
+	}
+
+	// The new generation is downloaded before the machine restart is
+	// allowed, so the outage only covers the swap and a deferred restart
+	// finds everything in place when its window opens.
+	generation := &PrefetchedGeneration{Machine: newMachine, SettingsVersion: goal.SettingsVersion, KubernetesVersion: cfg.Components.Kubernetes}
+	if err := o.prefetchGeneration(ctx, log, generation, func(timings *StepTimings) phases.Task {
+		return FetchGeneration(cfg, log, gs, containerImageArchives, timings)
+	}); err != nil {
+		return nil, err
+	}
+	if err := o.disruption.allow(ctx, log, config.DisruptionMachine); err != nil {
+		if refused, ok := errors.AsType[*DisruptionRefusedError](err); ok {
+			refused.Prefetched = newMachine
+		}
+		return nil, err
+	}
 	log.Info("starting nspawn machine goal-state apply",
 		"oldMachine", oldMachine,
 		"newMachine", newMachine,
 		"settingsVersion", goal.SettingsVersion,
 		"kubernetesVersion", cfg.Components.Kubernetes,
 	)
+	newState := nextAppliedState(active.State, goal, &activeMachine{Name: newMachine})
 
-	_, gs, containerImageArchives, err := config.ResolveMachineGoalState(log, cfg, newMachine)
+	timings := NewStepTimings(TimingOperationRepave, newMachine)
+	tasks := phases.Serial(log,
+		timings.Track(snapshotMetadata(log, o.snapshots, "repave")),
+		timings.Track(nodestop.StopNode(log, oldMachine)),
+		StartNode(cfg, log, newMachine, gs, containerImageArchives, o.state, newState, timings),
+		timings.Track(reset.CleanupMachine(log, oldMachine)),
+		timings.Track(snapshotMetadata(log, o.snapshots, "repaved")),
+	)
+	stopProgress := ReportProgress(ctx, log, timings, o.progress)
+	err = tasks.Do(ctx)
+	stopProgress()
+	o.recordTimings(log, timings.Finish(err))
 	if err != nil {
-		return nil, fmt.Errorf("resolve goal state for repave: %w", err)
+		return nil, fmt.Errorf("apply machine goal state: %w", err)
 	}
-	newState := nextAppliedState(active.State, goal, &activeMachine{Name: newMachine})
+	o.disruption.performed(config.DisruptionMachine)
+	if err := o.prefetched.Clear(); err != nil {
+		log.Warn("failed to clear the prefetched generation record", "error", err)
+	}
+	return newState, nil
+}
+
+// applyKubeletSettings applies a goal state that changes only the kubelet
+// tuning flags in place: the machine's binaries stay, so only the kubelet
+// flags are rewritten and the kubelet restarted. containerd is not restarted and the
+// node's containers keep running, unlike the machine swap of a repave.
+func (o *nspawnNodeOperator) applyKubeletSettings(ctx context.Context, log *slog.Logger, cfg *config.Config, active *activeMachine, goal aksmachine.GoalState) (*State, error) {
+	_, gs, _, err := config.ResolveMachineGoalState(log, cfg, active.Name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve goal state for kubelet restart: %w", err)
+	}
+	newState := nextAppliedState(active.State, goal, active)
+	if kubeletTuningCurrent(cfg, gs.RootFS.MachineDir) && machineUnitsActive(ctx, log, active.Name) == nil {
+		return o.recordUpToDate(ctx, log, active, newState)
+	}
+	if err := o.disruption.allow(ctx, log, config.DisruptionKubelet); err != nil {
+		return nil, err
+	}
+	log.Info("applying goal state in place by restarting the kubelet; containers keep running",
+		"machine", active.Name,
+		"settingsVersion", goal.SettingsVersion,
+	)
 
+	timings := NewStepTimings(TimingOperationRepave, active.Name)
 	tasks := phases.Serial(log,
-		nodestop.StopNode(log, oldMachine),
-		StartNode(cfg, log, newMachine, gs, containerImageArchives, o.state, newState),
-		reset.CleanupMachine(log, oldMachine),
+		timings.Track(WriteKubeletTuning(cfg, gs.RootFS.MachineDir)),
+		timings.Track(restartKubelet(log, active.Name)),
+		timings.Track(nodestart.WaitForKubelet(log, active.Name)),
+		timings.Track(saveState(o.state, newState)),
 	)
-	if err := tasks.Do(ctx); err != nil {
-		return nil, fmt.Errorf("apply machine goal state: %w", err)
+	stopProgress := ReportProgress(ctx, log, timings, o.progress)
+	err = tasks.Do(ctx)
+	stopProgress()
+	o.recordTimings(log, timings.Finish(err))
+	if err != nil {
+		return nil, fmt.Errorf("apply goal state in place: %w", err)
+	}
+	o.disruption.performed(config.DisruptionKubelet)
+	return newState, nil
+}
+
+// kubeletTuningOnly reports whether goal can be applied in place over the
+// applied goal: the Kubernetes version, labels and taints are unchanged and
+// the goal is either the same or changes only the kubelet tuning flags. A
+// settings bump that changes nothing the agent can apply in place, or an
+// unknown applied goal, needs a repave.
+func kubeletTuningOnly(applied *aksmachine.GoalState, goal aksmachine.GoalState) bool {
+	if applied == nil || goal.KubernetesVersion == "" || goal.KubernetesVersion != applied.KubernetesVersion {
+		return false
+	}
+	if !maps.Equal(goal.NodeLabels, applied.NodeLabels) || !slices.Equal(goal.NodeTaints, applied.NodeTaints) {
+		return false
+	}
+	if goal.SettingsVersion == applied.SettingsVersion {
+		return true
+	}
+	return goal.MaxPods != applied.MaxPods || goal.KubeletConfig != applied.KubeletConfig
+}
+
+// recordUpToDate finishes an in-place apply whose kubelet flags the machine
+// already runs with its units active: only the new settings version is
+// saved, nothing is rewritten or restarted, and the timings record reports
+// the apply as up to date.
+func (o *nspawnNodeOperator) recordUpToDate(ctx context.Context, log *slog.Logger, active *activeMachine, newState *State) (*State, error) {
+	log.Info("goal state already applied in place; kubelet flags unchanged, nothing restarted",
+		"machine", active.Name,
+		"settingsVersion", newState.AppliedSettingsVersion,
+	)
+	timings := NewStepTimings(TimingOperationRepave, active.Name)
+	err := phases.ExecuteTask(ctx, log, timings.Track(saveState(o.state, newState)))
+	record := timings.Finish(err)
+	if err != nil {
+		o.recordTimings(log, record)
+		return nil, fmt.Errorf("apply goal state in place: %w", err)
 	}
+	record.Outcome = OperationOutcomeUpToDate
+	o.recordTimings(log, record)
 	return newState, nil
 }
 
+// recordTimings persists and exports a repave step breakdown. Failures are
+// logged only; timings are diagnostic and must not fail the repave.
+func (o *nspawnNodeOperator) recordTimings(log *slog.Logger, timings OperationTimings) {
+	publishTimings(timings)
+	if o.timings == nil {
+		return
+	}
+	if err := o.timings.Save(timings); err != nil {
+		log.Warn("failed to persist repave timings", "error", err)
+	}
+}
+
 func (o *nspawnNodeOperator) ResetNode(ctx context.Context, log *slog.Logger) error {
-	return phases.ExecuteTask(ctx, log, ResetNode(log))
+	return phases.ExecuteTask(ctx, log, phases.Serial(log,
+		hooks.Run(log, o.cfg, config.HookPreUnbootstrap, hooks.Facts{}),
+		ResetNode(log, o.cfg.Instance),
+	))
 }
 
 func (o *nspawnNodeOperator) StopDaemon(ctx context.Context, log *slog.Logger) error {
-	return phases.ExecuteTask(ctx, log, UninstallService(log))
+	return phases.ExecuteTask(ctx, log, UninstallService(log, o.cfg.Instance))
 }
 
 func nextAppliedState(current *State, goal aksmachine.GoalState, active *activeMachine) *State {
@@ -131,7 +314,9 @@ func nextAppliedState(current *State, goal aksmachine.GoalState, active *activeM
 	if current != nil {
 		next.PreviousSettingsVersion = current.AppliedSettingsVersion
 		next.PreviousKubernetesVersion = current.AppliedKubernetesVersion
+		next.LastKnownGood = current.LastKnownGood
 	}
+	next.AppliedGoal = &goal
 	if active != nil {
 		next.ActiveMachine = active.Name
 	}
@@ -2,8 +2,12 @@ package daemon
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"testing"
 
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/unbounded/pkg/agent/goalstates"
 )
 
@@ -40,7 +44,7 @@ func TestFindActiveMachine(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			got, err := (&nspawnNodeOperator{state: &testStateStore{state: tt.state}}).findActiveMachine(t.Context())
+			got, err := (&nspawnNodeOperator{cfg: &config.Config{}, state: &testStateStore{state: tt.state}}).findActiveMachine(t.Context())
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("findActiveMachine error = nil, want error")
@@ -72,3 +76,77 @@ func (s *testStateStore) Save(context.Context, *State) error {
 func (s *testStateStore) Delete(context.Context) error {
 	return nil
 }
+
+func TestKubeletTuningOnly(t *testing.T) {
+	t.Parallel()
+
+	applied := &aksmachine.GoalState{
+		KubernetesVersion: "1.31.2",
+		SettingsVersion:   "7",
+		MaxPods:           110,
+		NodeLabels:        map[string]string{"team": "a"},
+		NodeTaints:        []string{"dedicated=a:NoSchedule"},
+	}
+	with := func(mutate func(*aksmachine.GoalState)) aksmachine.GoalState {
+		goal := *applied
+		goal.NodeLabels = maps.Clone(applied.NodeLabels)
+		goal.NodeTaints = slices.Clone(applied.NodeTaints)
+		goal.SettingsVersion = "8"
+		mutate(&goal)
+		return goal
+	}
+
+	tests := map[string]struct {
+		applied *aksmachine.GoalState
+		goal    aksmachine.GoalState
+		want    bool
+	}{
+		"same goal": {
+			applied: applied,
+			goal:    *applied,
+			want:    true,
+		},
+		"max pods": {
+			applied: applied,
+			goal:    with(func(g *aksmachine.GoalState) { g.MaxPods = 250 }),
+			want:    true,
+		},
+		"image gc thresholds": {
+			applied: applied,
+			goal:    with(func(g *aksmachine.GoalState) { g.KubeletConfig.ImageGCHighThreshold = 90 }),
+			want:    true,
+		},
+		"settings bump without kubelet changes": {
+			applied: applied,
+			goal:    with(func(*aksmachine.GoalState) {}),
+		},
+		"labels": {
+			applied: applied,
+			goal: with(func(g *aksmachine.GoalState) {
+				g.MaxPods = 250
+				g.NodeLabels["team"] = "b"
+			}),
+		},
+		"taints": {
+			applied: applied,
+			goal:    with(func(g *aksmachine.GoalState) { g.NodeTaints = nil }),
+		},
+		"kubernetes version": {
+			applied: applied,
+			goal:    with(func(g *aksmachine.GoalState) { g.KubernetesVersion = "1.32.0" }),
+		},
+		"unknown applied goal": {
+			goal: *applied,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := kubeletTuningOnly(tt.applied, tt.goal); got != tt.want {
+				t.Fatalf("kubeletTuningOnly = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
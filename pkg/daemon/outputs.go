@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+const (
+	outputsFileName = "outputs.json"
+
+	// OutputsSchemaVersion is bumped only when a field of Outputs is renamed,
+	// removed, or changes meaning. Added fields keep the version, so external
+	// automation must ignore fields it does not know.
+	OutputsSchemaVersion = 1
+
+	outputsRefreshInterval = 5 * time.Minute
+)
+
+// Outputs is the node registration document external automation, such as a
+// Terraform data source or an ARM deployment script, reads after bootstrap.
+// Its fields are a contract; see OutputsSchemaVersion.
+type Outputs struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	NodeName      string `json:"nodeName"`
+	// Instance is empty for the default node instance.
+	Instance          string `json:"instance,omitempty"`
+	ClusterResourceID string `json:"clusterResourceId,omitempty"`
+	AgentPool         string `json:"agentPool,omitempty"`
+	// ArcMachineResourceID is set when the node is connected to Azure Arc.
+	ArcMachineResourceID string `json:"arcMachineResourceId,omitempty"`
+	// PodCIDRs are the pod ranges the cluster assigned to the Node. They are
+	// empty until the Node registered and was assigned a range.
+	PodCIDRs          []string  `json:"podCIDRs,omitempty"`
+	KubernetesVersion string    `json:"kubernetesVersion,omitempty"`
+	AgentVersion      string    `json:"agentVersion"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// NewOutputs returns the outputs of cfg and the daemon state, without pod
+// CIDRs.
+func NewOutputs(cfg *config.Config, state *State) *Outputs {
+	outputs := &Outputs{
+		SchemaVersion: OutputsSchemaVersion,
+		NodeName:      cfg.Agent.NodeName,
+		Instance:      string(cfg.Instance),
+		AgentPool:     cfg.Azure.TargetAgentPoolName,
+		AgentVersion:  version.Version,
+	}
+	if cfg.Azure.TargetCluster != nil {
+		outputs.ClusterResourceID = cfg.Azure.TargetCluster.ResourceID
+	}
+	if cfg.IsARCEnabled() {
+		outputs.ArcMachineResourceID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.HybridCompute/machines/%s",
+			cfg.Azure.SubscriptionID, cfg.Azure.Arc.ResourceGroup, cfg.Azure.Arc.MachineName)
+	}
+	if state != nil {
+		outputs.KubernetesVersion = state.AppliedKubernetesVersion
+	}
+	return outputs
+}
+
+// OutputsStore persists Outputs as world-readable JSON.
+type OutputsStore struct {
+	path string
+}
+
+// NewOutputsStore returns a store under the instance's state root.
+func NewOutputsStore(instance config.Instance) *OutputsStore {
+	return &OutputsStore{path: filepath.Join(instance.StateDir(), outputsFileName)}
+}
+
+// Path returns the file the outputs are written to.
+func (s *OutputsStore) Path() string { return s.path }
+
+// Load returns the persisted outputs, or nil when none were written.
+func (s *OutputsStore) Load() (*Outputs, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read outputs %s: %w", s.path, err)
+	}
+	var outputs Outputs
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("decode outputs %s: %w", s.path, err)
+	}
+	return &outputs, nil
+}
+
+// Save replaces the persisted outputs.
+func (s *OutputsStore) Save(outputs *Outputs) error {
+	data, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal outputs: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), 0o644); err != nil { //nolint:gosec // read by external automation; holds no secrets
+		return fmt.Errorf("write outputs %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// outputsWriter keeps the outputs document current as the Node is assigned
+// pod CIDRs and repaves change the Kubernetes version. It implements
+// manager.Runnable.
+type outputsWriter struct {
+	log      *slog.Logger
+	reader   client.Reader
+	cfg      *config.Config
+	interval time.Duration
+	state    stateStore
+	store    *OutputsStore
+}
+
+func newOutputsWriter(log *slog.Logger, reader client.Reader, cfg *config.Config, state stateStore) *outputsWriter {
+	return &outputsWriter{
+		log:      log,
+		reader:   reader,
+		cfg:      cfg,
+		interval: outputsRefreshInterval,
+		state:    state,
+		store:    NewOutputsStore(cfg.Instance),
+	}
+}
+
+// NeedLeaderElection reports false: every daemon reports its own node.
+func (w *outputsWriter) NeedLeaderElection() bool { return false }
+
+func (w *outputsWriter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if err := w.write(ctx); err != nil {
+			w.log.Warn("failed to write registration outputs", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// write refreshes the outputs and saves them when anything but the update
+// time changed, so automation that watches the file is not woken needlessly.
+func (w *outputsWriter) write(ctx context.Context) error {
+	state, err := w.state.Load(ctx)
+	if err != nil {
+		return err
+	}
+	outputs := NewOutputs(w.cfg, state)
+	var node corev1.Node
+	if err := w.reader.Get(ctx, types.NamespacedName{Name: w.cfg.Agent.NodeName}, &node); err != nil {
+		w.log.Debug("node not readable for registration outputs", "error", err)
+	} else {
+		outputs.PodCIDRs = slices.Clone(node.Spec.PodCIDRs)
+		if len(outputs.PodCIDRs) == 0 && node.Spec.PodCIDR != "" {
+			outputs.PodCIDRs = []string{node.Spec.PodCIDR}
+		}
+	}
+
+	previous, err := w.store.Load()
+	if err != nil {
+		w.log.Debug("rewriting unreadable registration outputs", "error", err)
+	}
+	if previous != nil && sameOutputs(previous, outputs) {
+		return nil
+	}
+	outputs.UpdatedAt = time.Now().UTC()
+	return w.store.Save(outputs)
+}
+
+func sameOutputs(a, b *Outputs) bool {
+	x, y := *a, *b
+	x.UpdatedAt, y.UpdatedAt = time.Time{}, time.Time{}
+	xj, _ := json.Marshal(x)
+	yj, _ := json.Marshal(y)
+	return bytes.Equal(xj, yj)
+}
@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestOutputsWriter(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec:       corev1.NodeSpec{PodCIDR: "10.244.3.0/24", PodCIDRs: []string{"10.244.3.0/24", "fd00:3::/64"}},
+	}
+	kubeClient := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(node).Build()
+	cfg := &config.Config{
+		Agent: config.AgentConfig{NodeName: "node1"},
+		Azure: config.AzureConfig{
+			SubscriptionID:      "sub",
+			TargetCluster:       &config.TargetClusterConfig{ResourceID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerService/managedClusters/c"},
+			TargetAgentPoolName: "aksflexnodes",
+			Arc:                 &config.ArcConfig{Enabled: true, ResourceGroup: "edge-rg", MachineName: "edge-01"},
+		},
+	}
+	store := &OutputsStore{path: filepath.Join(t.TempDir(), outputsFileName)}
+	writer := &outputsWriter{
+		log:    slog.New(slog.DiscardHandler),
+		reader: kubeClient,
+		cfg:    cfg,
+		state:  &testStateStore{state: &State{ActiveMachine: "kube1", AppliedKubernetesVersion: "1.34.3"}},
+		store:  store,
+	}
+
+	if err := writer.write(t.Context()); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	got, err := store.Load()
+	if err != nil || got == nil {
+		t.Fatalf("Load() = %v, %v", got, err)
+	}
+	if got.SchemaVersion != OutputsSchemaVersion || got.NodeName != "node1" || got.KubernetesVersion != "1.34.3" {
+		t.Errorf("outputs = %+v", got)
+	}
+	if want := "/subscriptions/sub/resourceGroups/edge-rg/providers/Microsoft.HybridCompute/machines/edge-01"; got.ArcMachineResourceID != want {
+		t.Errorf("arcMachineResourceId = %q, want %q", got.ArcMachineResourceID, want)
+	}
+	if !slices.Equal(got.PodCIDRs, node.Spec.PodCIDRs) {
+		t.Errorf("podCIDRs = %v, want %v", got.PodCIDRs, node.Spec.PodCIDRs)
+	}
+
+	// Unchanged outputs keep the file, and its update time, as it was.
+	first := got.UpdatedAt
+	time.Sleep(time.Millisecond)
+	if err := writer.write(t.Context()); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	if got, _ := store.Load(); !got.UpdatedAt.Equal(first) {
+		t.Errorf("updatedAt changed from %v to %v without any other change", first, got.UpdatedAt)
+	}
+}
@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/posture"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+// NodeAnnotationPosture holds the node's posture report as JSON, for
+// cluster-side admission to evaluate.
+const NodeAnnotationPosture = "kubernetes.azure.com/flex-node-posture"
+
+// postureReporter periodically collects the node's posture and publishes it
+// as a Node annotation. It implements manager.Runnable.
+type postureReporter struct {
+	log       *slog.Logger
+	client    client.Client
+	nodeName  string
+	interval  time.Duration
+	instance  config.Instance
+	state     stateStore
+	manifests *ManifestStore
+	collect   func() (*posture.Report, error)
+}
+
+func newPostureReporter(log *slog.Logger, c client.Client, nodeName string, interval time.Duration, instance config.Instance, state stateStore) *postureReporter {
+	return &postureReporter{
+		log:       log,
+		client:    c,
+		nodeName:  nodeName,
+		interval:  interval,
+		instance:  instance,
+		state:     state,
+		manifests: NewManifestStore(instance),
+		collect:   posture.NewCollector(utilhost.HostRoot).Collect,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon reports its own node.
+func (p *postureReporter) NeedLeaderElection() bool { return false }
+
+func (p *postureReporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.report(ctx); err != nil {
+			p.log.Warn("failed to publish posture report", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// report collects the posture and patches it onto the Node. Host fields the
+// collector could not read are published as unsupported, so a partial report
+// still reaches admission.
+func (p *postureReporter) report(ctx context.Context) error {
+	report, err := p.collect()
+	if err != nil {
+		p.log.Warn("posture collection was incomplete", "error", err)
+	}
+	p.addMachine(ctx, report)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal posture report: %w", err)
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{NodeAnnotationPosture: string(data)}},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal posture patch: %w", err)
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: p.nodeName}}
+	if err := p.client.Patch(ctx, node, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("patch node %s posture: %w", p.nodeName, err)
+	}
+	return nil
+}
+
+// addMachine fills in the active machine's Kubernetes version and whether
+// its binaries still match the recorded manifest.
+func (p *postureReporter) addMachine(ctx context.Context, report *posture.Report) {
+	addMachinePosture(ctx, p.log, p.state, p.manifests, p.instance, report)
+}
+
+// addMachinePosture fills in the machine fields of report and returns the
+// active machine, or nil when there is none.
+func addMachinePosture(ctx context.Context, log *slog.Logger, state stateStore, manifests *ManifestStore, instance config.Instance, report *posture.Report) *activeMachine {
+	active, err := activeMachineFromStore(ctx, state, instance)
+	if err != nil {
+		log.Debug("no active machine for posture report", "error", err)
+		return nil
+	}
+	report.ActiveMachine = active.Name
+	report.KubernetesVersion = active.State.AppliedKubernetesVersion
+
+	_, mismatches, err := verifyActiveMachine(ctx, state, manifests, instance)
+	if err != nil {
+		log.Debug("active machine not verified for posture report", "error", err)
+		return active
+	}
+	report.RootFSVerified = ptr.To(len(mismatches) == 0)
+	report.RootFSMismatches = len(mismatches)
+	return active
+}
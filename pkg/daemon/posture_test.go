@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/posture"
+)
+
+func TestPostureReporterPublishesAnnotation(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Annotations: map[string]string{"other": "kept"},
+	}}
+	kubeClient := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(node).Build()
+
+	machineDir := t.TempDir()
+	writeScript(t, filepath.Join(machineDir, "usr/local/bin/kubelet"), "echo kubelet")
+	manifests := &ManifestStore{path: filepath.Join(t.TempDir(), manifestFileName)}
+	record := &recordManifestTask{store: manifests, machine: "kube1", machineDir: machineDir}
+	if err := record.Do(t.Context()); err != nil {
+		t.Fatalf("record manifest: %v", err)
+	}
+
+	reporter := newPostureReporter(slog.New(slog.DiscardHandler), kubeClient, "node1", 0, "",
+		&testStateStore{state: &State{ActiveMachine: "kube1", AppliedKubernetesVersion: "1.34.3"}})
+	reporter.manifests = manifests
+	reporter.collect = func() (*posture.Report, error) {
+		return &posture.Report{AgentVersion: "v1", SecureBoot: posture.SecureBootEnabled, KernelLockdown: "integrity"}, nil
+	}
+	if err := reporter.report(t.Context()); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+
+	got := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	if got.Annotations["other"] != "kept" {
+		t.Fatalf("annotations = %v, want other annotations kept", got.Annotations)
+	}
+	var report posture.Report
+	if err := json.Unmarshal([]byte(got.Annotations[NodeAnnotationPosture]), &report); err != nil {
+		t.Fatalf("decode posture annotation: %v", err)
+	}
+	if report.SecureBoot != posture.SecureBootEnabled || report.ActiveMachine != "kube1" || report.KubernetesVersion != "1.34.3" ||
+		report.RootFSVerified == nil || !*report.RootFSVerified {
+		t.Fatalf("posture report = %+v", report)
+	}
+}
@@ -0,0 +1,431 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/hooks"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases/nodestart"
+)
+
+const (
+	powerFileName      = "power.json"
+	powerCheckInterval = 30 * time.Second
+	rtcWakeAlarmPath   = "/sys/class/rtc/rtc0/wakealarm"
+
+	// NodeAnnotationPowerState is "asleep" while the power schedule has the
+	// node asleep, so fleet monitoring can tell expected downtime from an
+	// outage.
+	NodeAnnotationPowerState = "kubernetes.azure.com/flex-node-power-state"
+	// NodeAnnotationWakeAt is the RFC 3339 time a sleeping node wakes.
+	NodeAnnotationWakeAt = "kubernetes.azure.com/flex-node-wake-at"
+
+	powerStateAsleep = "asleep"
+)
+
+// PowerSleep records that the power schedule put the node to sleep.
+type PowerSleep struct {
+	Since  time.Time `json:"since"`
+	WakeAt time.Time `json:"wakeAt"`
+	// Cordoned is true when going to sleep cordoned the node, so waking
+	// only uncordons nodes the agent cordoned itself.
+	Cordoned bool `json:"cordoned,omitempty"`
+	// Suspended is true when the host was suspended with an RTC alarm.
+	Suspended bool `json:"suspended,omitempty"`
+}
+
+// PowerWake is the outcome of the latest wake.
+type PowerWake struct {
+	At      time.Time `json:"at"`
+	Healthy bool      `json:"healthy"`
+	Message string    `json:"message,omitempty"`
+}
+
+// PowerStatus is the power schedule's view of the node for the admin API.
+type PowerStatus struct {
+	// Sleep is set while the node is asleep.
+	Sleep *PowerSleep `json:"sleep,omitempty"`
+	// NextSleep is when the node goes to sleep next, while it is awake.
+	NextSleep time.Time  `json:"nextSleep,omitzero"`
+	LastWake  *PowerWake `json:"lastWake,omitempty"`
+}
+
+// powerStore persists the sleep record so a daemon restarted during the
+// night, or after the host resumed, knows the node is asleep.
+type powerStore struct {
+	path string
+}
+
+func newPowerStore(path string) *powerStore {
+	if path == "" {
+		path = filepath.Join(config.ConfigDir, powerFileName)
+	}
+	return &powerStore{path: path}
+}
+
+func (s *powerStore) Load() (*PowerSleep, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read power record %s: %w", s.path, err)
+	}
+	var record PowerSleep
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decode power record %s: %w", s.path, err)
+	}
+	return &record, nil
+}
+
+func (s *powerStore) Save(record *PowerSleep) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal power record: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write power record %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *powerStore) Delete() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove power record %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// powerHost stops and starts the node's workloads and suspends the host.
+type powerHost interface {
+	StopWorkloads(ctx context.Context) error
+	StartWorkloads(ctx context.Context) error
+	Suspend(ctx context.Context, wakeAt time.Time) error
+}
+
+type machinePowerHost struct {
+	log          *slog.Logger
+	state        stateStore
+	instance     config.Instance
+	rtcWakeAlarm string
+}
+
+// StopWorkloads stops the kubelet and then containerd in the active machine,
+// which stops every container left after the drain. The machine itself
+// keeps running so waking does not have to boot it.
+func (h *machinePowerHost) StopWorkloads(ctx context.Context) error {
+	active, err := activeMachineFromStore(ctx, h.state, h.instance)
+	if err != nil {
+		return err
+	}
+	for _, unit := range []string{goalstates.SystemdUnitKubelet, goalstates.SystemdUnitContainerd} {
+		if _, err := utilexec.MachineRun(ctx, h.log, active.Name, "systemctl", "stop", unit); err != nil {
+			return fmt.Errorf("stop %s in %s: %w", unit, active.Name, err)
+		}
+	}
+	return nil
+}
+
+// StartWorkloads starts containerd and the kubelet again and waits for the
+// kubelet to be active.
+func (h *machinePowerHost) StartWorkloads(ctx context.Context) error {
+	active, err := activeMachineFromStore(ctx, h.state, h.instance)
+	if err != nil {
+		return err
+	}
+	for _, unit := range []string{goalstates.SystemdUnitContainerd, goalstates.SystemdUnitKubelet} {
+		if _, err := utilexec.MachineRun(ctx, h.log, active.Name, "systemctl", "start", unit); err != nil {
+			return fmt.Errorf("start %s in %s: %w", unit, active.Name, err)
+		}
+	}
+	return nodestart.WaitForKubelet(h.log, active.Name).Do(ctx)
+}
+
+// Suspend sets the RTC alarm to wakeAt and suspends the host to RAM. A host
+// without an RTC alarm is not suspended, since nothing would wake it.
+func (h *machinePowerHost) Suspend(ctx context.Context, wakeAt time.Time) error {
+	if _, err := os.Stat(h.rtcWakeAlarm); err != nil {
+		return fmt.Errorf("host has no RTC wake alarm: %w", err)
+	}
+	// The alarm only accepts a new time once the previous one is cleared.
+	if err := os.WriteFile(h.rtcWakeAlarm, []byte("0"), 0o644); err != nil { //nolint:gosec // sysfs attribute
+		return fmt.Errorf("clear RTC wake alarm: %w", err)
+	}
+	if err := os.WriteFile(h.rtcWakeAlarm, []byte(strconv.FormatInt(wakeAt.Unix(), 10)), 0o644); err != nil { //nolint:gosec // sysfs attribute
+		return fmt.Errorf("set RTC wake alarm: %w", err)
+	}
+	if _, err := utilexec.OutputCmd(ctx, h.log, "systemctl", "suspend"); err != nil {
+		return fmt.Errorf("suspend host: %w", err)
+	}
+	return nil
+}
+
+// powerManager puts the node to sleep and wakes it on the configured daily
+// schedule. Transitions are paused while the node is in maintenance, so an
+// operator on site is not interrupted. It implements manager.Runnable.
+type powerManager struct {
+	log          *slog.Logger
+	cfg          config.PowerConfig
+	client       client.Client
+	reader       client.Reader
+	nodeName     string
+	store        *powerStore
+	recorder     *nodeRecorder
+	maintenance  *maintenanceManager
+	host         powerHost
+	drainTimeout time.Duration
+	// runHooks runs the operator hooks configured at a hook point.
+	runHooks func(ctx context.Context, point string) error
+	// verify checks the node's health after waking.
+	verify  func(ctx context.Context) (bool, string)
+	now     func() time.Time
+	wakeups chan struct{}
+
+	mu       sync.Mutex
+	lastWake *PowerWake
+}
+
+func newPowerManager(log *slog.Logger, cfg *config.Config, c client.Client, reader client.Reader, nodeName string, store *powerStore, maintenance *maintenanceManager, host powerHost, prober *apiProber, recorder *nodeRecorder) *powerManager {
+	drainTimeout := time.Duration(cfg.Agent.Power.DrainTimeout)
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+	return &powerManager{
+		log:          log,
+		cfg:          cfg.Agent.Power,
+		client:       c,
+		reader:       reader,
+		nodeName:     nodeName,
+		store:        store,
+		recorder:     recorder,
+		maintenance:  maintenance,
+		host:         host,
+		drainTimeout: drainTimeout,
+		runHooks: func(ctx context.Context, point string) error {
+			return hooks.Run(log, cfg, point, hooks.Facts{}).Do(ctx)
+		},
+		verify: func(ctx context.Context) (bool, string) {
+			prober.run(ctx)
+			report := prober.Last()
+			if report == nil {
+				return false, "no API server probe of the active machine"
+			}
+			if !report.Healthy() {
+				return false, report.Message
+			}
+			return true, ""
+		},
+		now:     time.Now,
+		wakeups: make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: every daemon manages its own host.
+func (m *powerManager) NeedLeaderElection() bool { return false }
+
+// Start checks the schedule every powerCheckInterval. Failures are logged
+// and the transition is retried on the next check.
+func (m *powerManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(powerCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.Reconcile(ctx); err != nil {
+			m.log.Warn("failed to apply power schedule", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-m.wakeups:
+		}
+	}
+}
+
+// wake requests an immediate check, for example after the host resumed.
+func (m *powerManager) wake() {
+	select {
+	case m.wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// Sleeping reports whether the node is asleep and how long until it wakes,
+// so the repave reconciler leaves a sleeping node alone.
+func (m *powerManager) Sleeping() (bool, time.Duration) {
+	if m == nil {
+		return false, 0
+	}
+	record, err := m.store.Load()
+	if err != nil || record == nil {
+		return false, 0
+	}
+	return true, max(record.WakeAt.Sub(m.now()), powerCheckInterval)
+}
+
+// Status returns the node's power state for the admin API.
+func (m *powerManager) Status() *PowerStatus {
+	if m == nil {
+		return nil
+	}
+	status := &PowerStatus{}
+	m.mu.Lock()
+	status.LastWake = m.lastWake
+	m.mu.Unlock()
+	record, err := m.store.Load()
+	if err != nil {
+		m.log.Debug("failed to load power record for status", "error", err)
+	}
+	status.Sleep = record
+	if record == nil {
+		now := m.now()
+		if asleep, next := m.cfg.Asleep(now); !asleep && next > 0 {
+			status.NextSleep = now.Add(next).UTC().Truncate(time.Second)
+		}
+	}
+	return status
+}
+
+// Reconcile puts the node to sleep inside the sleep range and wakes it
+// outside.
+func (m *powerManager) Reconcile(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if maintenance, err := m.maintenance.Current(); err != nil {
+		return err
+	} else if maintenance != nil {
+		m.log.Debug("node in maintenance, holding power state")
+		return nil
+	}
+	record, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	now := m.now()
+	asleep, next := m.cfg.Asleep(now)
+	switch {
+	case asleep && record == nil:
+		return m.sleepLocked(ctx, now, now.Add(next))
+	case !asleep && record != nil:
+		return m.wakeLocked(ctx, record)
+	}
+	return nil
+}
+
+// sleepLocked cordons and drains the node, stops its workloads, marks the
+// expected downtime on the Node, and suspends the host when configured. The
+// record is saved before draining so an interrupted sleep is finished on
+// wake rather than leaving the node cordoned.
+func (m *powerManager) sleepLocked(ctx context.Context, now, wakeAt time.Time) error {
+	record := &PowerSleep{Since: now.UTC(), WakeAt: wakeAt.UTC().Truncate(time.Second)}
+	cordoned, err := m.maintenance.setUnschedulable(ctx, true)
+	if err != nil {
+		return err
+	}
+	record.Cordoned = cordoned
+	if err := m.store.Save(record); err != nil {
+		return err
+	}
+	if err := m.patchAnnotations(ctx, map[string]any{
+		NodeAnnotationPowerState: powerStateAsleep,
+		NodeAnnotationWakeAt:     record.WakeAt.Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+	if err := m.maintenance.drain(ctx, m.drainTimeout); err != nil {
+		m.log.Warn("pods left on the node when going to sleep", "error", err)
+	}
+	if err := m.host.StopWorkloads(ctx); err != nil {
+		return err
+	}
+	powerAsleepGauge.Set(1)
+	m.log.Info("node asleep", "wakeAt", record.WakeAt)
+	m.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonPowerSleep,
+		fmt.Sprintf("Asleep on schedule until %s", record.WakeAt.Format(time.RFC3339)))
+	if err := m.runHooks(ctx, config.HookPreSleep); err != nil {
+		m.log.Warn("preSleep hook failed", "error", err)
+	}
+	if !m.cfg.Suspend {
+		return nil
+	}
+	record.Suspended = true
+	if err := m.store.Save(record); err != nil {
+		return err
+	}
+	if err := m.host.Suspend(ctx, record.WakeAt); err != nil {
+		record.Suspended = false
+		if saveErr := m.store.Save(record); saveErr != nil {
+			m.log.Warn("failed to update power record", "error", saveErr)
+		}
+		m.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonPowerSleep, "Staying idle, host not suspended: "+err.Error())
+		return err
+	}
+	return nil
+}
+
+// wakeLocked runs the postWake hooks, starts the workloads, uncordons the
+// node if sleeping cordoned it, and checks the API server through the
+// kubelet's credentials.
+func (m *powerManager) wakeLocked(ctx context.Context, record *PowerSleep) error {
+	if err := m.runHooks(ctx, config.HookPostWake); err != nil {
+		m.log.Warn("postWake hook failed", "error", err)
+	}
+	if err := m.host.StartWorkloads(ctx); err != nil {
+		return err
+	}
+	if record.Cordoned {
+		if _, err := m.maintenance.setUnschedulable(ctx, false); err != nil {
+			return err
+		}
+	}
+	if err := m.patchAnnotations(ctx, map[string]any{
+		NodeAnnotationPowerState: nil,
+		NodeAnnotationWakeAt:     nil,
+	}); err != nil {
+		return err
+	}
+	if err := m.store.Delete(); err != nil {
+		return err
+	}
+	powerAsleepGauge.Set(0)
+
+	healthy, message := m.verify(ctx)
+	m.lastWake = &PowerWake{At: m.now().UTC(), Healthy: healthy, Message: message}
+	if !healthy {
+		m.log.Warn("node woke but is not healthy", "message", message)
+		m.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonPowerWake, "Woke on schedule, health check failed: "+message)
+		return nil
+	}
+	m.log.Info("node awake", "asleepFor", m.now().Sub(record.Since).Round(time.Second))
+	m.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonPowerWake, "Woke on schedule and passed the health check")
+	return nil
+}
+
+func (m *powerManager) patchAnnotations(ctx context.Context, annotations map[string]any) error {
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": annotations}})
+	if err != nil {
+		return fmt.Errorf("marshal node patch: %w", err)
+	}
+	node := &corev1.Node{}
+	node.Name = m.nodeName
+	if err := m.client.Patch(ctx, node, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("patch node %s: %w", m.nodeName, err)
+	}
+	return nil
+}
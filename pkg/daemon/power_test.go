@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+type fakePowerHost struct {
+	running    bool
+	suspendErr error
+	suspended  []time.Time
+}
+
+func (h *fakePowerHost) StopWorkloads(context.Context) error {
+	h.running = false
+	return nil
+}
+
+func (h *fakePowerHost) StartWorkloads(context.Context) error {
+	h.running = true
+	return nil
+}
+
+func (h *fakePowerHost) Suspend(_ context.Context, wakeAt time.Time) error {
+	h.suspended = append(h.suspended, wakeAt)
+	return h.suspendErr
+}
+
+func newTestPowerManager(t *testing.T, power config.PowerConfig) (*powerManager, client.Client, *fakePowerHost, *[]string) {
+	t.Helper()
+	kubeClient := fake.NewClientBuilder().WithScheme(newScheme()).
+		WithObjects(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}).
+		WithIndex(&corev1.Pod{}, "spec.nodeName", func(o client.Object) []string {
+			return []string{o.(*corev1.Pod).Spec.NodeName}
+		}).Build()
+	log := slog.New(slog.DiscardHandler)
+	dir := t.TempDir()
+	cfg := &config.Config{Agent: config.AgentConfig{Power: power}}
+	maintenance := newMaintenanceManager(log, kubeClient, kubeClient, "node1", newMaintenanceStore(filepath.Join(dir, maintenanceFileName)), nil)
+	host := &fakePowerHost{running: true}
+	m := newPowerManager(log, cfg, kubeClient, kubeClient, "node1", newPowerStore(filepath.Join(dir, powerFileName)), maintenance, host, nil, nil)
+	var ran []string
+	m.runHooks = func(_ context.Context, point string) error {
+		ran = append(ran, point)
+		return nil
+	}
+	m.verify = func(context.Context) (bool, string) { return true, "" }
+	return m, kubeClient, host, &ran
+}
+
+func TestPowerSleepAndWake(t *testing.T) {
+	t.Parallel()
+
+	m, kubeClient, host, ran := newTestPowerManager(t, config.PowerConfig{Sleep: "22:00-06:00"})
+	now := time.Date(2026, 3, 4, 22, 30, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile at close: %v", err)
+	}
+	node := getNode(t, kubeClient)
+	if !node.Spec.Unschedulable || host.running {
+		t.Fatalf("node not asleep: unschedulable=%v running=%v", node.Spec.Unschedulable, host.running)
+	}
+	if node.Annotations[NodeAnnotationPowerState] != powerStateAsleep || node.Annotations[NodeAnnotationWakeAt] != "2026-03-05T06:00:00Z" {
+		t.Fatalf("annotations = %v", node.Annotations)
+	}
+	if asleep, _ := m.Sleeping(); !asleep {
+		t.Fatal("Sleeping() = false while asleep")
+	}
+	if len(host.suspended) != 0 {
+		t.Fatal("host suspended without agent.power.suspend")
+	}
+
+	now = time.Date(2026, 3, 5, 6, 0, 30, 0, time.UTC)
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile at open: %v", err)
+	}
+	node = getNode(t, kubeClient)
+	if node.Spec.Unschedulable || !host.running {
+		t.Fatalf("node not awake: unschedulable=%v running=%v", node.Spec.Unschedulable, host.running)
+	}
+	if _, ok := node.Annotations[NodeAnnotationPowerState]; ok {
+		t.Fatalf("power annotation left on awake node: %v", node.Annotations)
+	}
+	if want := []string{config.HookPreSleep, config.HookPostWake}; len(*ran) != 2 || (*ran)[0] != want[0] || (*ran)[1] != want[1] {
+		t.Fatalf("hooks ran %v, want %v", *ran, want)
+	}
+	status := m.Status()
+	if status.Sleep != nil || status.LastWake == nil || !status.LastWake.Healthy || !status.NextSleep.Equal(time.Date(2026, 3, 5, 22, 0, 0, 0, time.UTC)) {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestPowerSuspendFailureStaysIdle(t *testing.T) {
+	t.Parallel()
+
+	m, _, host, _ := newTestPowerManager(t, config.PowerConfig{Sleep: "22:00-06:00", Suspend: true})
+	m.now = func() time.Time { return time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC) }
+	host.suspendErr = errors.New("no RTC")
+
+	if err := m.Reconcile(t.Context()); err == nil {
+		t.Fatal("Reconcile succeeded, want the suspend error")
+	}
+	if len(host.suspended) != 1 || !host.suspended[0].Equal(time.Date(2026, 3, 5, 6, 0, 0, 0, time.UTC)) {
+		t.Fatalf("suspended = %v, want one alarm at 06:00", host.suspended)
+	}
+	record, err := m.store.Load()
+	if err != nil || record == nil || record.Suspended {
+		t.Fatalf("record = %+v, %v; want asleep, not suspended", record, err)
+	}
+	// The node stays asleep; the next check does not retry the suspend.
+	if err := m.Reconcile(t.Context()); err != nil || len(host.suspended) != 1 {
+		t.Fatalf("second Reconcile = %v, suspended %d times", err, len(host.suspended))
+	}
+}
+
+func TestPowerHeldDuringMaintenance(t *testing.T) {
+	t.Parallel()
+
+	m, _, host, _ := newTestPowerManager(t, config.PowerConfig{Sleep: "22:00-06:00"})
+	if _, err := m.maintenance.Enable(t.Context(), MaintenanceRequest{Duration: config.JSONDuration(24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return time.Now().Truncate(24 * time.Hour).Add(23 * time.Hour) }
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !host.running {
+		t.Fatal("node went to sleep during maintenance")
+	}
+}
@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+	"github.com/Azure/unbounded/pkg/agent/phases/reset"
+)
+
+const (
+	// TimingOperationPrefetch downloads a repave's new machine generation
+	// while the active machine keeps running.
+	TimingOperationPrefetch = "prefetch"
+
+	prefetchFileName = "prefetched-generation.json"
+)
+
+// PrefetchedGeneration is a machine generation whose rootfs and binaries were
+// downloaded ahead of its activation.
+type PrefetchedGeneration struct {
+	Machine           string    `json:"machine"`
+	SettingsVersion   string    `json:"settingsVersion"`
+	KubernetesVersion string    `json:"kubernetesVersion"`
+	FetchedAt         time.Time `json:"fetchedAt"`
+}
+
+// PrefetchStore persists the prefetched generation under the instance's state
+// root. It is written only once the fetch completed, so a generation without
+// a record may be partly downloaded.
+type PrefetchStore struct {
+	path string
+}
+
+// NewPrefetchStore returns the store under the instance's state root.
+func NewPrefetchStore(instance config.Instance) *PrefetchStore {
+	return &PrefetchStore{path: filepath.Join(instance.StateDir(), prefetchFileName)}
+}
+
+// Load returns the prefetched generation, or nil when there is none.
+func (s *PrefetchStore) Load() (*PrefetchedGeneration, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read prefetched generation %s: %w", s.path, err)
+	}
+	var generation PrefetchedGeneration
+	if err := json.Unmarshal(data, &generation); err != nil {
+		return nil, fmt.Errorf("parse prefetched generation %s: %w", s.path, err)
+	}
+	return &generation, nil
+}
+
+func (s *PrefetchStore) save(generation *PrefetchedGeneration) error {
+	data, err := json.MarshalIndent(generation, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal prefetched generation: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write prefetched generation %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Clear removes the record once its generation was activated.
+func (s *PrefetchStore) Clear() error {
+	if s == nil {
+		return nil
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove prefetched generation %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (g *PrefetchedGeneration) matches(want *PrefetchedGeneration) bool {
+	return g != nil && g.Machine == want.Machine && g.SettingsVersion == want.SettingsVersion && g.KubernetesVersion == want.KubernetesVersion
+}
+
+type recordPrefetchTask struct {
+	store      *PrefetchStore
+	generation *PrefetchedGeneration
+}
+
+func (t *recordPrefetchTask) Name() string { return "record-prefetched-generation" }
+
+func (t *recordPrefetchTask) Do(context.Context) error {
+	t.generation.FetchedAt = time.Now().UTC()
+	return t.store.save(t.generation)
+}
+
+// prefetchGeneration downloads want's machine generation unless it is
+// already prefetched. A generation prefetched for another goal state, or
+// partly fetched before a failure, is removed first, since the rootfs
+// bootstrap leaves a machine directory that is not empty as it is. The fetch
+// is recorded as its own operation, so its steps and failures show apart from
+// the activation's.
+func (o *nspawnNodeOperator) prefetchGeneration(ctx context.Context, log *slog.Logger, want *PrefetchedGeneration, fetch func(*StepTimings) phases.Task) error {
+	current, err := o.prefetched.Load()
+	if err != nil {
+		return err
+	}
+	if current.matches(want) {
+		log.Info("machine generation already prefetched", "machine", want.Machine, "settingsVersion", want.SettingsVersion, "fetchedAt", current.FetchedAt)
+		return nil
+	}
+	log.Info("prefetching machine generation while the active machine keeps running",
+		"machine", want.Machine,
+		"settingsVersion", want.SettingsVersion,
+		"kubernetesVersion", want.KubernetesVersion,
+	)
+	if err := o.prefetched.Clear(); err != nil {
+		return err
+	}
+	timings := NewStepTimings(TimingOperationPrefetch, want.Machine)
+	tasks := phases.Serial(log,
+		timings.Track(reset.CleanupMachine(log, want.Machine)),
+		fetch(timings),
+		timings.Track(&recordPrefetchTask{store: o.prefetched, generation: want}),
+	)
+	stopProgress := ReportProgress(ctx, log, timings, o.progress)
+	err = tasks.Do(ctx)
+	stopProgress()
+	o.recordTimings(log, timings.Finish(err))
+	if err != nil {
+		return fmt.Errorf("prefetch machine generation %s: %w", want.Machine, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+func TestPrefetchStore(t *testing.T) {
+	t.Parallel()
+
+	store := &PrefetchStore{path: filepath.Join(t.TempDir(), "state", prefetchFileName)}
+	if got, err := store.Load(); err != nil || got != nil {
+		t.Fatalf("Load() before a prefetch = %+v, %v, want nil", got, err)
+	}
+	generation := &PrefetchedGeneration{Machine: "kube2", SettingsVersion: "v4", KubernetesVersion: "1.33.1"}
+	if err := (&recordPrefetchTask{store: store, generation: generation}).Do(t.Context()); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil || !got.matches(generation) || got.FetchedAt.IsZero() {
+		t.Fatalf("Load() = %+v, %v, want the recorded generation", got, err)
+	}
+	if got.matches(&PrefetchedGeneration{Machine: "kube2", SettingsVersion: "v5", KubernetesVersion: "1.33.1"}) {
+		t.Error("a generation for another settings version matches")
+	}
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Clear() = %v", err)
+	}
+	if got, err := store.Load(); err != nil || got != nil {
+		t.Fatalf("Load() after Clear = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestPrefetchGenerationSkipsFetchedGeneration(t *testing.T) {
+	t.Parallel()
+
+	store := &PrefetchStore{path: filepath.Join(t.TempDir(), prefetchFileName)}
+	generation := &PrefetchedGeneration{Machine: "kube2", SettingsVersion: "v4", KubernetesVersion: "1.33.1"}
+	if err := store.save(generation); err != nil {
+		t.Fatal(err)
+	}
+	operator := &nspawnNodeOperator{prefetched: store}
+	fetched := false
+	err := operator.prefetchGeneration(t.Context(), slog.New(slog.DiscardHandler), generation, func(*StepTimings) phases.Task {
+		fetched = true
+		return nil
+	})
+	if err != nil || fetched {
+		t.Fatalf("prefetchGeneration() = %v, fetched = %v, want the recorded generation reused", err, fetched)
+	}
+}
+
+func TestDisruptionRefusedErrorPrefetched(t *testing.T) {
+	t.Parallel()
+
+	err := &DisruptionRefusedError{Level: "machine", Max: "kubelet", RetryAfter: 3 * time.Hour, Prefetched: "kube2"}
+	if msg := err.Error(); !strings.HasPrefix(msg, "new machine generation kube2 downloaded; machine restart refused") {
+		t.Errorf("Error() = %q, want the prefetched generation reported", msg)
+	}
+}
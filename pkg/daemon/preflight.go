@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	writablePathsCheckName = "writable-paths"
+	binaryPathCheckName    = "agent-binary-path"
+)
+
+// Preflight returns the checks for the host paths the agent writes. Immutable
+// distributions such as Flatcar and Fedora IoT mount /usr read-only and leave
+// only /etc and /var writable, which breaks bootstrap halfway through unless
+// the affected paths are moved in the config.
+func Preflight(cfg *config.Config) []preflight.Checker {
+	paths := []string{
+		cfg.Instance.StateDir(),
+		cfg.Agent.LogDir,
+		filepath.Dir(cfg.Agent.AuditLogPath),
+		machinesDir,
+		systemdSystemDir,
+	}
+	if cfg.Agent.ExportBinaries {
+		paths = append(paths, cfg.Instance.ExportedBinDir(), filepath.Dir(profileFragmentPath))
+	}
+	return []preflight.Checker{
+		writablePathsChecker{paths: paths, access: writable},
+		binaryPathChecker{path: cfg.Agent.BinaryPath},
+	}
+}
+
+type writablePathsChecker struct {
+	paths []string
+	// access reports whether a directory can be written; tests replace it.
+	access func(dir string) error
+}
+
+func (writablePathsChecker) Name() string { return writablePathsCheckName }
+
+// Check tests each path, or its closest existing parent for paths bootstrap
+// has yet to create. A read-only filesystem is fatal; any other access error
+// only means preflight could not tell, for example when it runs unprivileged.
+func (c writablePathsChecker) Check(context.Context) []preflight.Result {
+	var readOnly, unknown []string
+	for _, path := range c.paths {
+		err := c.access(existingParent(path))
+		switch {
+		case err == nil:
+		case errors.Is(err, unix.EROFS):
+			readOnly = append(readOnly, path)
+		default:
+			unknown = append(unknown, fmt.Sprintf("%s (%v)", path, err))
+		}
+	}
+	switch {
+	case len(readOnly) > 0:
+		return preflight.ResultsError(writablePathsCheckName, strings.Join(readOnly, ", "),
+			"paths are on a read-only filesystem; move agent.logDir, agent.auditLogPath, or agent.binaryPath under /var, or disable agent.exportBinaries")
+	case len(unknown) > 0:
+		return preflight.ResultsWarning(writablePathsCheckName, "host paths", "could not verify that paths are writable: %s", strings.Join(unknown, ", "))
+	}
+	return preflight.ResultsOK(writablePathsCheckName, "host paths", "all agent paths are writable")
+}
+
+type binaryPathChecker struct{ path string }
+
+func (binaryPathChecker) Name() string { return binaryPathCheckName }
+
+// Check makes sure the agent unit will find its binary, since a host that
+// cannot use the default location has the binary installed somewhere else.
+func (c binaryPathChecker) Check(context.Context) []preflight.Result {
+	info, err := os.Stat(c.path)
+	if err != nil || info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+		return preflight.ResultsError(binaryPathCheckName, c.path,
+			"the agent unit runs %s, which is not an executable file; install the binary there or set agent.binaryPath", c.path)
+	}
+	return preflight.ResultsOK(binaryPathCheckName, c.path, "agent binary is installed")
+}
+
+func writable(dir string) error {
+	return unix.Access(dir, unix.W_OK)
+}
+
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+func TestWritablePathsChecker(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		denied     map[string]error
+		want       preflight.Severity
+		wantTarget string
+	}{
+		{name: "writable", want: preflight.SeverityOK},
+		{name: "read-only usr", denied: map[string]error{"/usr": unix.EROFS}, want: preflight.SeverityError, wantTarget: "/usr/local/sbin/aks-flex"},
+		{name: "unprivileged", denied: map[string]error{dir: unix.EACCES}, want: preflight.SeverityWarning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			checker := writablePathsChecker{
+				// The state dir exists; the exported bin dir is checked
+				// through its closest existing parent.
+				paths: []string{dir, "/usr/local/sbin/aks-flex"},
+				access: func(path string) error {
+					for prefix, err := range tt.denied {
+						if path == prefix || strings.HasPrefix(path, prefix+"/") {
+							return err
+						}
+					}
+					return nil
+				},
+			}
+			results := checker.Check(t.Context())
+			if len(results) != 1 || results[0].Severity != tt.want {
+				t.Fatalf("Check() = %+v, want severity %v", results, tt.want)
+			}
+			if tt.wantTarget != "" && results[0].Target != tt.wantTarget {
+				t.Fatalf("target = %q, want %q", results[0].Target, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestBinaryPathChecker(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "aks-flex-node")
+	if err := os.WriteFile(executable, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	plain := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(plain, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]preflight.Severity{
+		executable:                    preflight.SeverityOK,
+		plain:                         preflight.SeverityError,
+		filepath.Join(dir, "missing"): preflight.SeverityError,
+		dir:                           preflight.SeverityError,
+	} {
+		results := binaryPathChecker{path: path}.Check(t.Context())
+		if len(results) != 1 || results[0].Severity != want {
+			t.Errorf("Check(%s) = %+v, want severity %v", path, results, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"log/slog"
+	"runtime"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+// applyConcurrency bounds how many artifact downloads and installs run at
+// once: agent.resources.applyConcurrency when set, otherwise half the host's
+// cores, capped by the device profile.
+func applyConcurrency(cfg *config.Config) int {
+	return applyConcurrencyFor(cfg, runtime.NumCPU())
+}
+
+func applyConcurrencyFor(cfg *config.Config, cores int) int {
+	if limit := cfg.Agent.Resources.ApplyConcurrency; limit > 0 {
+		return limit
+	}
+	limit := max(1, cores/2)
+	if profile := nodeDeviceProfile(cfg).DownloadConcurrency; profile > 0 {
+		limit = min(limit, profile)
+	}
+	return limit
+}
+
+// LowerAgentPriority applies agent.resources.nice and ioSchedulingClass to
+// the running agent. The agent unit sets them for the daemon; bootstrap from
+// a shell calls this so its downloads and extraction yield to workloads too.
+// Failures are logged: the agent still works at its current priority.
+func LowerAgentPriority(log *slog.Logger, resources config.ResourcesConfig) {
+	ioClass, ioLevel := ioPriority(resources.IOSchedulingClass)
+	if resources.Nice == 0 && ioClass == 0 {
+		return
+	}
+	if err := utilhost.LowerPriority(resources.Nice, ioClass, ioLevel); err != nil {
+		log.Warn("failed to lower agent priority", "nice", resources.Nice, "ioSchedulingClass", resources.IOSchedulingClass, "error", err)
+	}
+}
+
+// ioPriority maps agent.resources.ioSchedulingClass to an ioprio_set(2)
+// class and level; zero leaves the I/O priority unchanged.
+func ioPriority(class string) (int, int) {
+	switch class {
+	case config.IOSchedulingBestEffort:
+		return utilhost.IOPrioClassBestEffort, utilhost.IOPrioLowest
+	case config.IOSchedulingIdle:
+		return utilhost.IOPrioClassIdle, 0
+	}
+	return 0, 0
+}
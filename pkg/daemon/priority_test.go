@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+func TestApplyConcurrency(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name       string
+		configured int
+		profile    string
+		cores      int
+		want       int
+	}{
+		{name: "single core", cores: 1, want: 1},
+		{name: "half the cores", cores: 8, want: 4},
+		{name: "capped by the profile", profile: deviceprofile.RaspberryPi, cores: 4, want: 1},
+		{name: "profile above the cores", profile: deviceprofile.ARMSBC, cores: 2, want: 1},
+		{name: "configured", configured: 3, profile: deviceprofile.RaspberryPi, cores: 4, want: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := &config.Config{}
+			cfg.Agent.Resources.ApplyConcurrency = tc.configured
+			cfg.Node.DeviceProfile = tc.profile
+			if got := applyConcurrencyFor(cfg, tc.cores); got != tc.want {
+				t.Fatalf("applyConcurrencyFor(%d cores) = %d, want %d", tc.cores, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIOPriority(t *testing.T) {
+	t.Parallel()
+
+	if class, level := ioPriority(config.IOSchedulingBestEffort); class != utilhost.IOPrioClassBestEffort || level != utilhost.IOPrioLowest {
+		t.Fatalf("ioPriority(best-effort) = %d, %d", class, level)
+	}
+	if class, _ := ioPriority(config.IOSchedulingIdle); class != utilhost.IOPrioClassIdle {
+		t.Fatalf("ioPriority(idle) class = %d", class)
+	}
+	if class, _ := ioPriority(""); class != 0 {
+		t.Fatalf("ioPriority(\"\") class = %d, want unchanged", class)
+	}
+}
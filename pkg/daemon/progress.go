@@ -0,0 +1,135 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+const (
+	progressFileName    = "status.json"
+	progressLogInterval = 15 * time.Second
+)
+
+// ProgressStatus is the persisted view of the operation in flight. It is
+// rewritten while a bootstrap or repave runs, so operators can follow a
+// bootstrap before the daemon and its admin API are up.
+type ProgressStatus struct {
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Agent is the build that wrote the status.
+	Agent            version.Info        `json:"agent"`
+	CurrentOperation *progress.Operation `json:"currentOperation,omitempty"`
+	// RecentAzureRequests lists the correlation IDs of the writer's latest
+	// Azure calls, for support to find them in ARM logs.
+	RecentAzureRequests []azclient.Correlation `json:"recentAzureRequests,omitempty"`
+}
+
+// ProgressStore persists ProgressStatus next to the daemon state.
+type ProgressStore struct {
+	path string
+}
+
+// NewProgressStore returns a store under the instance's state root.
+func NewProgressStore(instance config.Instance) *ProgressStore {
+	return &ProgressStore{path: filepath.Join(instance.StateDir(), progressFileName)}
+}
+
+// Load returns the persisted status, or nil when none was written.
+func (s *ProgressStore) Load() (*ProgressStatus, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read operation status %s: %w", s.path, err)
+	}
+	var status ProgressStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("decode operation status %s: %w", s.path, err)
+	}
+	return &status, nil
+}
+
+// Save overwrites the persisted status with operation, or with no current
+// operation when it is nil.
+func (s *ProgressStore) Save(operation *progress.Operation) error {
+	data, err := json.MarshalIndent(ProgressStatus{
+		UpdatedAt:           time.Now().UTC(),
+		Agent:               version.Get(),
+		CurrentOperation:    operation,
+		RecentAzureRequests: azclient.RecentCorrelations(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal operation status: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write operation status %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// ReportProgress logs the running steps of timings every progressLogInterval
+// and mirrors them into store until the returned stop function is called,
+// which clears the current operation. Steps whose downloads stopped advancing
+// are logged as warnings.
+func ReportProgress(ctx context.Context, log *slog.Logger, timings *StepTimings, store *ProgressStore) (stop func()) {
+	return reportProgress(ctx, log, timings, store, progressLogInterval)
+}
+
+func reportProgress(ctx context.Context, log *slog.Logger, timings *StepTimings, store *ProgressStore, interval time.Duration) func() {
+	tracker := timings.Progress()
+	if tracker == nil {
+		return func() {}
+	}
+	save := func(operation *progress.Operation) {
+		if store == nil {
+			return
+		}
+		if err := store.Save(operation); err != nil {
+			log.Warn("failed to persist operation progress", "error", err)
+		}
+	}
+	save(tracker.Snapshot())
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			operation := tracker.Snapshot()
+			now := time.Now()
+			for _, step := range operation.Steps {
+				attrs := []any{"operation", operation.Name, "step", step.Name, "progress", step.Summary(now)}
+				if step.Stalled(now) {
+					log.Warn("operation step is not making progress", attrs...)
+				} else {
+					log.Info("operation step progress", attrs...)
+				}
+			}
+			save(operation)
+		}
+	})
+	return func() {
+		cancel()
+		wg.Wait()
+		save(nil)
+	}
+}
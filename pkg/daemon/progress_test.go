@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+)
+
+// syncBuffer is a bytes.Buffer safe for the reporter goroutine and the test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// blockingTask reports a download and blocks until released.
+type blockingTask struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (blockingTask) Name() string { return "download-driver" }
+
+func (b blockingTask) Do(ctx context.Context) error {
+	counter := progress.FromContext(ctx)
+	counter.SetTotal(700 << 20)
+	_, _ = counter.Reader(strings.NewReader("chunk")).Read(make([]byte, 5))
+	close(b.started)
+	<-b.release
+	return nil
+}
+
+func TestReportProgress(t *testing.T) {
+	t.Parallel()
+
+	var logs syncBuffer
+	log := slog.New(slog.NewTextHandler(&logs, nil))
+	store := &ProgressStore{path: filepath.Join(t.TempDir(), progressFileName)}
+	timings := NewStepTimings(TimingOperationBootstrap, "kube1")
+	task := blockingTask{started: make(chan struct{}), release: make(chan struct{})}
+
+	stop := reportProgress(t.Context(), log, timings, store, 10*time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- timings.Track(task).Do(t.Context()) }()
+	<-task.started
+
+	// The reporter logs and then persists each tick, so wait for both.
+	var status *ProgressStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		if status, err = store.Load(); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		logged := strings.Contains(logs.String(), "download-driver: 5 B of 700.0 MiB")
+		if logged && status != nil && status.CurrentOperation != nil && len(status.CurrentOperation.Steps) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v, want the running download step; logs:\n%s", status, logs.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if step := status.CurrentOperation.Steps[0]; step.BytesDone != 5 || step.BytesTotal != 700<<20 {
+		t.Fatalf("persisted step = %+v", step)
+	}
+
+	close(task.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	stop()
+	status, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if status == nil || status.CurrentOperation != nil {
+		t.Fatalf("status after stop = %+v, want no current operation", status)
+	}
+}
@@ -0,0 +1,239 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+const (
+	// NodeConditionFlexNodePrerequisitesReady reports whether the readiness
+	// gate found CNI, the container runtime, and the API server ready.
+	NodeConditionFlexNodePrerequisitesReady corev1.NodeConditionType = "FlexNodePrerequisitesReady"
+
+	gateReasonPending  = "PrerequisitesPending"
+	gateReasonPassed   = "PrerequisitesPassed"
+	gateReasonTimedOut = "PrerequisitesTimedOut"
+
+	readinessGateInterval = 10 * time.Second
+
+	// cniConfDir is where the CNI plugin installs its network config inside
+	// the machine rootfs.
+	cniConfDir = "etc/cni/net.d"
+)
+
+// ReadinessGateStatus is the readiness gate's latest evaluation.
+type ReadinessGateStatus struct {
+	// Holding reports whether the Node still carries the gate taint.
+	Holding bool `json:"holding"`
+	// Pending lists the prerequisites that have not passed.
+	Pending   []string  `json:"pending,omitempty"`
+	TimedOut  bool      `json:"timedOut,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// readinessGate removes config.ReadinessGateTaint from the Node once the
+// machine has a CNI network config, containerd is active, and the API
+// server probe is healthy, or once the timeout since the Node registered
+// expires. The kubelet applies the taint only when it registers the Node, so
+// the gate holds new and re-registered nodes and is idle otherwise. It
+// implements manager.Runnable.
+type readinessGate struct {
+	log         *slog.Logger
+	reader      client.Reader
+	client      client.Client
+	nodeName    string
+	timeout     time.Duration
+	interval    time.Duration
+	state       stateStore
+	machinesDir string
+	apiProbe    func() *apiprobe.Report
+	runtimeUp   func(ctx context.Context, machine string) error
+	now         func() time.Time
+
+	mu            sync.Mutex
+	last          *ReadinessGateStatus
+	lastCondition string
+}
+
+func newReadinessGate(log *slog.Logger, reader client.Reader, c client.Client, nodeName string, timeout time.Duration, state stateStore, prober *apiProber) *readinessGate {
+	return &readinessGate{
+		log:         log,
+		reader:      reader,
+		client:      c,
+		nodeName:    nodeName,
+		timeout:     timeout,
+		interval:    readinessGateInterval,
+		state:       state,
+		machinesDir: machinesDir,
+		apiProbe:    prober.Last,
+		runtimeUp: func(ctx context.Context, machine string) error {
+			_, err := utilexec.MachineRun(ctx, log, machine, "systemctl", "is-active", "--quiet", "containerd")
+			return err
+		},
+		now: time.Now,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon gates its own node.
+func (g *readinessGate) NeedLeaderElection() bool { return false }
+
+func (g *readinessGate) Start(ctx context.Context) error {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		if err := g.check(ctx); err != nil {
+			g.log.Warn("readiness gate check failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the latest evaluation, or nil before the Node registered.
+func (g *readinessGate) Last() *ReadinessGateStatus {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.last
+}
+
+func (g *readinessGate) check(ctx context.Context) error {
+	node := &corev1.Node{}
+	if err := g.reader.Get(ctx, client.ObjectKey{Name: g.nodeName}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The kubelet has not registered yet.
+			return nil
+		}
+		return fmt.Errorf("get node %s: %w", g.nodeName, err)
+	}
+	now := g.now()
+	status := &ReadinessGateStatus{CheckedAt: now.UTC()}
+	if !slices.ContainsFunc(node.Spec.Taints, isReadinessGateTaint) {
+		// After a timeout keep evaluating until the prerequisites pass, so
+		// the condition does not stay False forever.
+		if previous := g.Last(); previous != nil && previous.TimedOut {
+			if status.Pending = g.pending(ctx); len(status.Pending) > 0 {
+				status.TimedOut = true
+			} else {
+				g.setCondition(ctx, corev1.ConditionTrue, gateReasonPassed, "CNI, container runtime, and API server are ready")
+			}
+		}
+		g.setLast(status)
+		return nil
+	}
+
+	status.Holding = true
+	status.Pending = g.pending(ctx)
+	// Registration taints carry no time; the Node's age survives daemon
+	// restarts.
+	held := now.Sub(node.CreationTimestamp.Time)
+	switch {
+	case len(status.Pending) == 0:
+		if err := g.release(ctx, node); err != nil {
+			return err
+		}
+		status.Holding = false
+		g.log.Info("node prerequisites passed; node is schedulable", "heldFor", held.Round(time.Second))
+		g.setCondition(ctx, corev1.ConditionTrue, gateReasonPassed, "CNI, container runtime, and API server are ready")
+	case held >= g.timeout:
+		if err := g.release(ctx, node); err != nil {
+			return err
+		}
+		status.Holding = false
+		status.TimedOut = true
+		g.log.Warn("node prerequisites did not pass in time; node is schedulable anyway", "timeout", g.timeout, "pending", status.Pending)
+		g.setCondition(ctx, corev1.ConditionFalse, gateReasonTimedOut, "released after "+g.timeout.String()+"; waiting for "+strings.Join(status.Pending, ", "))
+	default:
+		g.setCondition(ctx, corev1.ConditionFalse, gateReasonPending, "waiting for "+strings.Join(status.Pending, ", "))
+	}
+	g.setLast(status)
+	return nil
+}
+
+// pending returns the prerequisites of the active machine that have not
+// passed.
+func (g *readinessGate) pending(ctx context.Context) []string {
+	state, err := g.state.Load(ctx)
+	if err != nil || state == nil || state.ActiveMachine == "" {
+		return []string{"active machine"}
+	}
+	var pending []string
+	if !hasCNIConfig(filepath.Join(g.machinesDir, state.ActiveMachine, cniConfDir)) {
+		pending = append(pending, "CNI network config")
+	}
+	if err := g.runtimeUp(ctx, state.ActiveMachine); err != nil {
+		pending = append(pending, "containerd")
+	}
+	if report := g.apiProbe(); report == nil || !report.Healthy() {
+		pending = append(pending, "API server")
+	}
+	return pending
+}
+
+func hasCNIConfig(dir string) bool {
+	for _, pattern := range []string{"*.conf", "*.conflist", "*.json"} {
+		if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// release removes the gate taint. The optimistic lock keeps the merge patch
+// of the taint list from overwriting a concurrent taint change.
+func (g *readinessGate) release(ctx context.Context, node *corev1.Node) error {
+	released := node.DeepCopy()
+	released.Spec.Taints = slices.DeleteFunc(released.Spec.Taints, isReadinessGateTaint)
+	if err := g.client.Patch(ctx, released, client.MergeFromWithOptions(node, client.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("remove readiness gate taint from node %s: %w", g.nodeName, err)
+	}
+	return nil
+}
+
+// setCondition patches the condition when its reason or message changed.
+// Failures are logged; the taint, not the condition, gates scheduling.
+func (g *readinessGate) setCondition(ctx context.Context, status corev1.ConditionStatus, reason, message string) {
+	key := reason + "/" + message
+	g.mu.Lock()
+	unchanged := g.lastCondition == key
+	g.mu.Unlock()
+	if unchanged {
+		return
+	}
+	if err := patchNodeCondition(ctx, g.reader, g.client, g.nodeName, g.now(), NodeConditionFlexNodePrerequisitesReady, status, reason, message); err != nil {
+		g.log.Warn("failed to set node condition", "condition", NodeConditionFlexNodePrerequisitesReady, "error", err)
+		return
+	}
+	g.mu.Lock()
+	g.lastCondition = key
+	g.mu.Unlock()
+}
+
+func (g *readinessGate) setLast(status *ReadinessGateStatus) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last = status
+}
+
+func isReadinessGateTaint(taint corev1.Taint) bool {
+	return taint.Key == config.ReadinessGateTaintKey
+}
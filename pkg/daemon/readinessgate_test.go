@@ -0,0 +1,144 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/apiprobe"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestReadinessGate(t *testing.T) {
+	t.Parallel()
+
+	registered := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", CreationTimestamp: metav1.NewTime(registered)},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+			{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+			{Key: config.ReadinessGateTaintKey, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+		}},
+	}
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(node).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+
+	machines := t.TempDir()
+	runtimeErr := errors.New("inactive")
+	gate := newReadinessGate(slog.New(slog.DiscardHandler), kubeClient, kubeClient, "node1", 10*time.Minute, &testStateStore{state: &State{ActiveMachine: "kube1"}}, nil)
+	gate.machinesDir = machines
+	gate.apiProbe = func() *apiprobe.Report { return &apiprobe.Report{} }
+	gate.runtimeUp = func(context.Context, string) error { return runtimeErr }
+	gate.now = func() time.Time { return registered.Add(time.Minute) }
+
+	getNode := func() *corev1.Node {
+		t.Helper()
+		got := &corev1.Node{}
+		if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+			t.Fatalf("get node: %v", err)
+		}
+		return got
+	}
+	condition := func(n *corev1.Node) *corev1.NodeCondition {
+		for i := range n.Status.Conditions {
+			if n.Status.Conditions[i].Type == NodeConditionFlexNodePrerequisitesReady {
+				return &n.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	if err := gate.check(t.Context()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	got := getNode()
+	if len(got.Spec.Taints) != 2 {
+		t.Fatalf("taints = %v, want the gate taint kept", got.Spec.Taints)
+	}
+	if c := condition(got); c == nil || c.Status != corev1.ConditionFalse || c.Reason != gateReasonPending ||
+		c.Message != "waiting for CNI network config, containerd" {
+		t.Fatalf("condition = %+v, want pending on CNI and containerd", c)
+	}
+	if last := gate.Last(); last == nil || !last.Holding || len(last.Pending) != 2 {
+		t.Fatalf("Last() = %+v", last)
+	}
+
+	confDir := filepath.Join(machines, "kube1", cniConfDir)
+	if err := os.MkdirAll(confDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(confDir, "05-cilium.conflist"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runtimeErr = nil
+	if err := gate.check(t.Context()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	got = getNode()
+	if len(got.Spec.Taints) != 1 || got.Spec.Taints[0].Key != "dedicated" {
+		t.Fatalf("taints = %v, want only the gate taint removed", got.Spec.Taints)
+	}
+	if c := condition(got); c == nil || c.Status != corev1.ConditionTrue || c.Reason != gateReasonPassed {
+		t.Fatalf("condition = %+v, want passed", c)
+	}
+	if last := gate.Last(); last == nil || last.Holding {
+		t.Fatalf("Last() = %+v, want released", last)
+	}
+}
+
+func TestReadinessGateTimeout(t *testing.T) {
+	t.Parallel()
+
+	registered := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", CreationTimestamp: metav1.NewTime(registered)},
+		Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+			{Key: config.ReadinessGateTaintKey, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+		}},
+	}
+	kubeClient := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(node).
+		WithStatusSubresource(&corev1.Node{}).
+		Build()
+
+	gate := newReadinessGate(slog.New(slog.DiscardHandler), kubeClient, kubeClient, "node1", 10*time.Minute, &testStateStore{state: &State{ActiveMachine: "kube1"}}, nil)
+	gate.machinesDir = t.TempDir()
+	gate.runtimeUp = func(context.Context, string) error { return nil }
+	gate.now = func() time.Time { return registered.Add(10 * time.Minute) }
+
+	if err := gate.check(t.Context()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	got := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatalf("get node: %v", err)
+	}
+	if len(got.Spec.Taints) != 0 {
+		t.Fatalf("taints = %v, want the gate released on timeout", got.Spec.Taints)
+	}
+	last := gate.Last()
+	if last == nil || !last.TimedOut || len(last.Pending) != 2 {
+		t.Fatalf("Last() = %+v, want timed out on CNI and API server", last)
+	}
+
+	// Later checks keep reporting the unmet prerequisites.
+	if err := gate.check(t.Context()); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if last := gate.Last(); last == nil || !last.TimedOut {
+		t.Fatalf("Last() = %+v, want still timed out", last)
+	}
+}
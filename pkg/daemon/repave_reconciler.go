@@ -21,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/shutdown"
 	"github.com/Azure/unbounded/pkg/agent/daemon"
 )
 
@@ -74,6 +75,11 @@ type repaveReconciler struct {
 	// polling for ARM-only machine transitions.
 	machineEvents            chan event.TypedGenericEvent[struct{}]
 	machineReconcileInterval time.Duration
+	maintenance              *maintenanceManager
+	power                    *powerManager
+	recorder                 *nodeRecorder
+	shutdown                 *shutdown.Coordinator
+	generations              *generationGuard
 }
 
 type repaveReconcilerOptions struct {
@@ -91,6 +97,20 @@ type repaveReconcilerOptions struct {
 	// the tradeoff is that ARM-only transitions can wait up to this duration plus
 	// jitter.
 	MachineReconcileInterval time.Duration
+	// Maintenance, when set, pauses reconciliation while an operator has the
+	// node in maintenance.
+	Maintenance *maintenanceManager
+	// Power, when set, pauses reconciliation while the power schedule has
+	// the node asleep.
+	Power *powerManager
+	// Recorder, when set, records repaves and resets on the Node.
+	Recorder *nodeRecorder
+	// Shutdown, when set, lets a goal-state apply or reset in progress finish
+	// and report its status when the daemon stops.
+	Shutdown *shutdown.Coordinator
+	// Generations, when set, records each applied goal state that passes a
+	// health pass as the last known good generation.
+	Generations *generationGuard
 }
 
 func newRepaveReconciler(opts repaveReconcilerOptions) (*repaveReconciler, error) {
@@ -120,6 +140,11 @@ func newRepaveReconciler(opts repaveReconcilerOptions) (*repaveReconciler, error
 		nodeName:                 opts.NodeName,
 		machineEvents:            make(chan event.TypedGenericEvent[struct{}], 1),
 		machineReconcileInterval: opts.MachineReconcileInterval,
+		maintenance:              opts.Maintenance,
+		power:                    opts.Power,
+		recorder:                 opts.Recorder,
+		shutdown:                 opts.Shutdown,
+		generations:              opts.Generations,
 	}, nil
 }
 
@@ -147,7 +172,26 @@ func (r *repaveReconciler) SetupController(b *builder.TypedBuilder[daemon.Reques
 }
 
 func (r *repaveReconciler) ReconcileRepave(ctx context.Context, source string) (reconcile.Result, error) {
+	paused, remaining, err := r.maintenance.Check(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if paused {
+		r.log.Info("node in maintenance, skipping reconcile", "remaining", remaining.Round(time.Second))
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+	if asleep, remaining := r.power.Sleeping(); asleep {
+		r.log.Info("node asleep on its power schedule, skipping reconcile", "remaining", remaining.Round(time.Second))
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
 	if err := r.reconcileOnce(ctx); err != nil {
+		if refused, ok := errors.AsType[*DisruptionRefusedError](err); ok {
+			r.log.Info("deferring goal state apply", "reason", refused.Error())
+			if refused.RetryAfter > 0 {
+				return reconcile.Result{RequeueAfter: refused.RetryAfter}, nil
+			}
+			return reconcile.Result{RequeueAfter: r.machineReconcileInterval}, nil
+		}
 		return reconcile.Result{}, err
 	}
 	if source == repaveByAKSMachine {
@@ -181,8 +225,12 @@ func (r *repaveReconciler) reconcileOnce(ctx context.Context) error {
 	case decisionReportSucceeded:
 		return r.patchStatus(ctx, aksmachine.ProvisioningStateSucceeded, decision.Goal.SettingsVersion, decision.Reason)
 	case decisionApplyGoalState:
+		ctx, done := r.shutdown.Critical(ctx, "goal state apply")
+		defer done()
 		return r.applyGoalState(ctx, state, decision.Goal)
 	case decisionResetDelete:
+		ctx, done := r.shutdown.Critical(ctx, "reset")
+		defer done()
 		return r.resetDelete(ctx)
 	default:
 		return fmt.Errorf("unsupported daemon decision %q", decision.Kind)
@@ -215,15 +263,32 @@ func (r *repaveReconciler) applyGoalState(ctx context.Context, state *State, goa
 	if err := r.patchStatus(ctx, aksmachine.ProvisioningStateReconciling, stateObservedVersion(state), "applying machine goal state"); err != nil {
 		return err
 	}
+	r.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonRepaveStarted, fmt.Sprintf("Applying machine goal state %s", goal.SettingsVersion))
+	r.recorder.SetReconciled(ctx, corev1.ConditionUnknown, reconciledReasonApplying, "applying machine goal state")
 	newState, err := r.operator.ApplyGoalState(ctx, r.log, goal)
+	if _, ok := errors.AsType[*DisruptionRefusedError](err); ok {
+		r.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonRepaveDeferred, err.Error())
+		_ = r.patchStatus(ctx, aksmachine.ProvisioningStateReconciling, stateObservedVersion(state), err.Error())
+		return err
+	}
 	if err != nil {
+		r.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonRepaveFailed, fmt.Sprintf("Failed to apply machine goal state %s: %v", goal.SettingsVersion, err))
+		r.recorder.SetReconciled(ctx, corev1.ConditionFalse, reconciledReasonFailed, err.Error())
 		_ = r.patchStatus(ctx, aksmachine.ProvisioningStateFailed, stateObservedVersion(state), err.Error())
 		return err
 	}
+	r.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonRepaved, fmt.Sprintf("Applied machine goal state %s", newState.AppliedSettingsVersion))
+	r.recorder.SetReconciled(ctx, corev1.ConditionTrue, reconciledReasonApplied, "machine goal state applied")
+	// The apply succeeded either way; a failed health pass only keeps the
+	// previous last known good generation.
+	if err := r.generations.MarkGood(ctx, goal); err != nil {
+		r.log.Warn("applied goal state not recorded as last known good", "error", err)
+	}
 	return r.patchStatus(ctx, aksmachine.ProvisioningStateSucceeded, newState.AppliedSettingsVersion, "machine goal state applied")
 }
 
 func (r *repaveReconciler) resetDelete(ctx context.Context) error {
+	r.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonResetting, "Node deletion requested, resetting the host and stopping the agent")
 	// Stage 1 clears local runtime/settings while keeping this daemon alive.
 	if err := r.operator.ResetNode(ctx, r.log); err != nil {
 		return err
@@ -312,6 +377,16 @@ func machineReconcileJitter(interval time.Duration) time.Duration {
 	return time.Duration(jitter.Int64())
 }
 
+// wake queues an immediate AKS-machine reconcile. The send never blocks, and
+// because machineEvents holds at most one pending event, repeated wakes
+// coalesce instead of stacking up reconciles.
+func (r *repaveReconciler) wake() {
+	select {
+	case r.machineEvents <- event.TypedGenericEvent[struct{}]{}:
+	default:
+	}
+}
+
 func (r *repaveReconciler) mapMachineEvent(context.Context, struct{}) []daemon.Request {
 	return []daemon.Request{daemon.NewRepaveRequest(repaveByAKSMachine)}
 }
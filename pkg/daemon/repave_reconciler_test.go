@@ -122,6 +122,7 @@ type fakeNodeOperator struct {
 	resetErr   error
 	stopErr    error
 	applied    bool
+	repaved    bool
 	restarted  bool
 	reset      bool
 	stopped    bool
@@ -140,6 +141,11 @@ func (f *fakeNodeOperator) ApplyGoalState(context.Context, *slog.Logger, aksmach
 	return f.state, nil
 }
 
+func (f *fakeNodeOperator) RepaveGoalState(ctx context.Context, log *slog.Logger, goal aksmachine.GoalState) (*State, error) {
+	f.repaved = true
+	return f.ApplyGoalState(ctx, log, goal)
+}
+
 func (f *fakeNodeOperator) RestartNode(context.Context, *slog.Logger) error {
 	f.restarted = true
 	return f.restartErr
@@ -5,30 +5,72 @@ import (
 
 	"github.com/Azure/AKSFlexNode/pkg/arc"
 	"github.com/Azure/AKSFlexNode/pkg/config"
-	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/hostconflict"
+	"github.com/Azure/AKSFlexNode/pkg/localstorage"
+	"github.com/Azure/AKSFlexNode/pkg/machinestore"
+	"github.com/Azure/AKSFlexNode/pkg/sriov"
+	"github.com/Azure/AKSFlexNode/pkg/wsl"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 	"github.com/Azure/unbounded/pkg/agent/phases/nodestop"
 	"github.com/Azure/unbounded/pkg/agent/phases/reset"
 )
 
-func ResetNode(log *slog.Logger) phases.Task {
-	return phases.Serial(log,
-		phases.Parallel(log,
-			nodestop.StopNode(log, goalstates.NSpawnMachineKube1),
-			nodestop.StopNode(log, goalstates.NSpawnMachineKube2),
-		),
-		phases.Parallel(log,
-			reset.CleanupMachine(log, goalstates.NSpawnMachineKube1),
-			reset.CleanupMachine(log, goalstates.NSpawnMachineKube2),
-		),
+// ResetNode returns the tasks that remove the instance's node. A named
+// instance only removes its own machines and state root, leaving the host
+// setup the other instances share. The default instance tears down the whole
+// host, including every named instance and the Arc connection.
+func ResetNode(log *slog.Logger, instance config.Instance) phases.Task {
+	if instance != "" {
+		return phases.Serial(log,
+			resetMachines(log, instance),
+			RemoveExportedBinaries(log, instance),
+			reset.ReloadSystemd(log),
+			config.RemoveInstanceDir(log, instance),
+		)
+	}
+
+	var tasks []phases.Task
+	named, err := config.ListInstances()
+	if err != nil {
+		log.Warn("failed to list node instances; only the default instance is reset", "error", err)
+	}
+	for _, instance := range named {
+		tasks = append(tasks, UninstallService(log, instance), resetMachines(log, instance), RemoveExportedBinaries(log, instance))
+	}
+	tasks = append(tasks,
+		resetMachines(log, ""),
+		RemoveExportedBinaries(log, ""),
 		phases.Parallel(log,
 			reset.RemoveNetworkInterfaces(log),
 			reset.RemoveWireGuardKeys(log),
 			reset.CleanupRoutes(log),
 			cleanupLegacyBridgeCNI(log),
+			wsl.ResetHost(log),
+			deviceprofile.ResetHost(log),
+			hostconflict.Release(log),
+			sriov.ResetHost(log),
+			localstorage.ResetHost(log),
+			machinestore.ResetHost(log),
 		),
 		reset.ReloadSystemd(log),
 		config.RemoveRuntimeDirs(log),
 		arc.UninstallArc(log),
 	)
+	return phases.Serial(log, tasks...)
+}
+
+// resetMachines stops and removes the instance's machine pair.
+func resetMachines(log *slog.Logger, instance config.Instance) phases.Task {
+	machines := instance.Machines()
+	return phases.Serial(log,
+		phases.Parallel(log,
+			nodestop.StopNode(log, machines[0]),
+			nodestop.StopNode(log, machines[1]),
+		),
+		phases.Parallel(log,
+			reset.CleanupMachine(log, machines[0]),
+			reset.CleanupMachine(log, machines[1]),
+		),
+	)
 }
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
@@ -96,7 +97,13 @@ func (t *cleanupLegacyCNI) removeIPTablesRules(ctx context.Context) {
 	for _, lineNumber := range legacyCNIIPTablesRuleNumbers(listing, chains) {
 		if err := t.run(ctx, "iptables", "--wait", "-t", "nat", "-D", legacyCNIPostroutingChain, strconv.Itoa(lineNumber)); err != nil {
 			t.log.Warn("failed to delete legacy CNI iptables reference", "lineNumber", lineNumber, "error", err)
+			continue
 		}
+		audit.Record(ctx, t.log, audit.Event{
+			Operation: audit.OperationFirewallRule,
+			Target:    "iptables nat " + legacyCNIPostroutingChain,
+			Detail:    "deleted rule " + strconv.Itoa(lineNumber),
+		})
 	}
 	for _, chain := range chains {
 		t.log.Info("removing legacy CNI iptables chain", "chain", chain)
@@ -106,7 +113,9 @@ func (t *cleanupLegacyCNI) removeIPTablesRules(ctx context.Context) {
 		}
 		if err := t.run(ctx, "iptables", "--wait", "-t", "nat", "-X", chain); err != nil {
 			t.log.Warn("failed to delete legacy CNI iptables chain", "chain", chain, "error", err)
+			continue
 		}
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFirewallRule, Target: "iptables nat " + chain, Detail: "deleted chain"})
 	}
 }
 
@@ -122,7 +131,13 @@ func (t *cleanupLegacyCNI) removeNFTablesRules(ctx context.Context) {
 		t.log.Info("removing legacy CNI nftables rule", "handle", handle)
 		if err := t.run(ctx, "nft", "delete", "rule", "inet", legacyCNINFTablesTable, legacyCNINFTablesChain, "handle", handle); err != nil {
 			t.log.Warn("failed to delete legacy CNI nftables rule", "handle", handle, "error", err)
+			continue
 		}
+		audit.Record(ctx, t.log, audit.Event{
+			Operation: audit.OperationFirewallRule,
+			Target:    "nft inet " + legacyCNINFTablesTable + " " + legacyCNINFTablesChain,
+			Detail:    "deleted rule handle " + handle,
+		})
 	}
 }
 
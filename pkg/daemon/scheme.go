@@ -1,7 +1,9 @@
 package daemon
 
 import (
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	machinav1alpha3 "github.com/Azure/unbounded/api/machina/v1alpha3"
@@ -10,6 +12,8 @@ import (
 func newScheme() *runtime.Scheme {
 	scheme := runtime.NewScheme()
 	_ = corev1.AddToScheme(scheme)
+	_ = coordinationv1.AddToScheme(scheme)
+	_ = policyv1.AddToScheme(scheme)
 	_ = machinav1alpha3.AddToScheme(scheme)
 	return scheme
 }
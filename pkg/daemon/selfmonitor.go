@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// leakGuardSamples is how many consecutive checks must exceed a limit before
+// the agent exits. A single spike, such as decoding a large machine spec, is
+// expected and released by the forced GC after the first breach.
+const leakGuardSamples = 3
+
+var limitExceededChecks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aks_flex_node_agent_limit_exceeded_checks",
+	Help: "Consecutive self-health checks in which the agent exceeded its configured resource limit.",
+}, []string{"resource"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(limitExceededChecks)
+}
+
+// selfMonitor guards against leaks in the agent itself. It samples resident
+// memory and the goroutine count, and once either stays over its limit for
+// leakGuardSamples checks it fails, which stops the manager so systemd
+// restarts the agent through Restart=on-failure. It implements
+// manager.Runnable.
+type selfMonitor struct {
+	log      *slog.Logger
+	interval time.Duration
+	maxRSS   int64
+	maxGo    int
+
+	// rss and goroutines sample the process; tests replace them.
+	rss        func() (int64, error)
+	goroutines func() int
+
+	rssBreaches int
+	goBreaches  int
+}
+
+func newSelfMonitor(log *slog.Logger, resources config.ResourcesConfig) *selfMonitor {
+	return &selfMonitor{
+		log:        log,
+		interval:   time.Duration(resources.CheckInterval),
+		maxRSS:     resources.MaxRSSBytes,
+		maxGo:      resources.MaxGoroutines,
+		rss:        residentBytes,
+		goroutines: runtime.NumGoroutine,
+	}
+}
+
+// NeedLeaderElection reports false: the agent's own health is local.
+func (m *selfMonitor) NeedLeaderElection() bool { return false }
+
+func (m *selfMonitor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := m.check(); err != nil {
+				m.log.Error("agent resource limit exceeded; exiting for restart", "error", err)
+				return err
+			}
+		}
+	}
+}
+
+// check takes one sample and returns an error once a limit has been exceeded
+// for leakGuardSamples consecutive checks.
+func (m *selfMonitor) check() error {
+	var rss int64
+	if m.maxRSS > 0 {
+		var err error
+		if rss, err = m.rss(); err != nil {
+			// Without a sample there is nothing to act on; keep the agent up.
+			m.log.Warn("could not read agent resident memory", "error", err)
+		}
+	}
+	goroutines := m.goroutines()
+
+	m.rssBreaches = m.observe("rss", m.rssBreaches, m.maxRSS > 0 && rss > m.maxRSS)
+	m.goBreaches = m.observe("goroutines", m.goBreaches, m.maxGo > 0 && goroutines > m.maxGo)
+
+	switch {
+	case m.rssBreaches >= leakGuardSamples:
+		return fmt.Errorf("agent resident memory %d bytes exceeded agent.resources.maxRSSBytes %d for %d checks", rss, m.maxRSS, m.rssBreaches)
+	case m.goBreaches >= leakGuardSamples:
+		return fmt.Errorf("agent goroutine count %d exceeded agent.resources.maxGoroutines %d for %d checks", goroutines, m.maxGo, m.goBreaches)
+	}
+	return nil
+}
+
+// observe updates the breach count for resource. The first breach forces a
+// GC that returns memory to the OS, so garbage alone never restarts the agent.
+func (m *selfMonitor) observe(resource string, breaches int, exceeded bool) int {
+	if !exceeded {
+		breaches = 0
+	} else {
+		breaches++
+		if breaches == 1 {
+			m.log.Warn("agent exceeded resource limit; forcing garbage collection", "resource", resource)
+			debug.FreeOSMemory()
+		}
+	}
+	limitExceededChecks.WithLabelValues(resource).Set(float64(breaches))
+	return breaches
+}
+
+// residentBytes reads the process's resident set size from /proc/self/statm,
+// whose second field counts resident pages.
+func residentBytes() (int64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, fmt.Errorf("read /proc/self/statm: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected /proc/self/statm content %q", data)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse resident pages: %w", err)
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
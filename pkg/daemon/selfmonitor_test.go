@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestSelfMonitorCheck(t *testing.T) {
+	t.Parallel()
+
+	const maxRSS, maxGoroutines = 100 << 20, 500
+	tests := []struct {
+		name       string
+		rss        []int64
+		goroutines []int
+		wantErrAt  int // 1-based check that fails, 0 for none
+	}{
+		{name: "under limits", rss: []int64{50 << 20, 60 << 20, 70 << 20, 80 << 20}, goroutines: []int{100, 100, 100, 100}},
+		{name: "transient memory spike", rss: []int64{200 << 20, 200 << 20, 50 << 20, 200 << 20}, goroutines: []int{100, 100, 100, 100}},
+		{name: "sustained memory leak", rss: []int64{200 << 20, 200 << 20, 200 << 20, 200 << 20}, goroutines: []int{100, 100, 100, 100}, wantErrAt: 3},
+		{name: "goroutine leak", rss: []int64{50 << 20, 50 << 20, 50 << 20, 50 << 20}, goroutines: []int{400, 600, 700, 800}, wantErrAt: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sample := 0
+			m := &selfMonitor{
+				log:        slog.New(slog.DiscardHandler),
+				maxRSS:     maxRSS,
+				maxGo:      maxGoroutines,
+				rss:        func() (int64, error) { return tt.rss[sample], nil },
+				goroutines: func() int { return tt.goroutines[sample] },
+			}
+			gotErrAt := 0
+			for ; sample < len(tt.rss); sample++ {
+				if err := m.check(); err != nil {
+					gotErrAt = sample + 1
+					break
+				}
+			}
+			if gotErrAt != tt.wantErrAt {
+				t.Fatalf("check failed at sample %d, want %d", gotErrAt, tt.wantErrAt)
+			}
+		})
+	}
+}
+
+func TestResidentBytes(t *testing.T) {
+	t.Parallel()
+
+	rss, err := residentBytes()
+	if err != nil {
+		t.Fatalf("residentBytes: %v", err)
+	}
+	if rss <= 0 {
+		t.Fatalf("residentBytes() = %d, want positive", rss)
+	}
+}
@@ -0,0 +1,278 @@
+package daemon
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const (
+	snapshotDirName   = "snapshots"
+	snapshotExt       = ".tar.gz"
+	snapshotTimestamp = "20060102T150405Z"
+	snapshotFileMode  = 0o600
+
+	// maxSnapshots is how many snapshots are kept; older ones are pruned
+	// when a new one is taken.
+	maxSnapshots = 10
+	// maxSnapshotFileSize bounds a file read back from a snapshot. The
+	// metadata files are a few KiB.
+	maxSnapshotFileSize = 16 << 20
+)
+
+// snapshotFiles are the metadata files under the state root that a snapshot
+// captures. Payloads such as the machine rootfs, secrets such as the kubelet
+// token, and diagnostics the daemon rewrites anyway are left out.
+var snapshotFiles = []string{
+	stateFileName,
+	stateFileName + ".sha256",
+	manifestFileName,
+	maintenanceFileName,
+	standbyFileName,
+	powerFileName,
+}
+
+// SnapshotStore keeps timestamped archives of the instance's metadata files,
+// taken before risky operations, so a corrupted daemon state can be rolled
+// back with restore-metadata.
+type SnapshotStore struct {
+	stateDir    string
+	dir         string
+	machinesDir string
+	keep        int
+	now         func() time.Time
+}
+
+// NewSnapshotStore returns the store under the instance's state root.
+func NewSnapshotStore(instance config.Instance) *SnapshotStore {
+	return newSnapshotStore(instance.StateDir())
+}
+
+func newSnapshotStore(stateDir string) *SnapshotStore {
+	return &SnapshotStore{
+		stateDir:    stateDir,
+		dir:         filepath.Join(stateDir, snapshotDirName),
+		machinesDir: machinesDir,
+		keep:        maxSnapshots,
+		now:         time.Now,
+	}
+}
+
+// Take archives the metadata files that exist and returns the snapshot name.
+// reason is recorded in the name, such as "repave". Each file is read whole,
+// and the stores replace files by rename, so every archived file is one
+// complete version of it.
+func (s *SnapshotStore) Take(reason string) (string, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := s.now().UTC()
+	for _, name := range snapshotFiles {
+		data, err := os.ReadFile(filepath.Join(s.stateDir, name)) //nolint:gosec // fixed file names under the state root
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("read %s for snapshot: %w", name, err)
+		}
+		header := &tar.Header{Name: name, Mode: snapshotFileMode, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return "", fmt.Errorf("write snapshot header for %s: %w", name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return "", fmt.Errorf("write %s to snapshot: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("close snapshot archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("close snapshot archive: %w", err)
+	}
+
+	name := now.Format(snapshotTimestamp) + "-" + reason + snapshotExt
+	if err := utilio.WriteFile(filepath.Join(s.dir, name), buf.Bytes(), snapshotFileMode); err != nil {
+		return "", fmt.Errorf("write snapshot %s: %w", name, err)
+	}
+	s.prune()
+	return name, nil
+}
+
+// List returns the snapshot names, newest first.
+func (s *SnapshotStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots in %s: %w", s.dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), snapshotExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	// Names start with a fixed-width UTC timestamp, so they sort by age.
+	slices.Sort(names)
+	slices.Reverse(names)
+	return names, nil
+}
+
+// Restore replaces the metadata files with the ones in the named snapshot,
+// or the newest snapshot when name is empty, and returns the restored
+// snapshot name. Metadata files the snapshot does not hold are removed, since
+// they did not exist when it was taken. A snapshot whose active machine no
+// longer exists, such as one taken before a repave that later removed the
+// old machine, is rejected before anything is replaced.
+func (s *SnapshotStore) Restore(name string) (string, error) {
+	if name == "" {
+		names, err := s.List()
+		if err != nil {
+			return "", err
+		}
+		if len(names) == 0 {
+			return "", fmt.Errorf("no metadata snapshots in %s", s.dir)
+		}
+		name = names[0]
+	}
+	if filepath.Base(name) != name || !strings.HasSuffix(name, snapshotExt) {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	files, err := s.read(name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkActiveMachine(name, files[stateFileName]); err != nil {
+		return "", err
+	}
+	for _, file := range snapshotFiles {
+		path := filepath.Join(s.stateDir, file)
+		data, ok := files[file]
+		if !ok {
+			if err := utilexec.RemoveFileIfExists(path); err != nil {
+				return "", fmt.Errorf("remove %s: %w", path, err)
+			}
+			continue
+		}
+		if err := utilio.WriteFile(path, data, stateFileMode); err != nil {
+			return "", fmt.Errorf("restore %s: %w", path, err)
+		}
+	}
+	return name, nil
+}
+
+// checkActiveMachine fails when the state in a snapshot names an active
+// machine whose rootfs is gone, since the daemon would start from a machine
+// it cannot run.
+func (s *SnapshotStore) checkActiveMachine(name string, data []byte) error {
+	if data == nil {
+		return nil
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("snapshot %s: decode %s: %w", name, stateFileName, err)
+	}
+	if state.ActiveMachine == "" {
+		return nil
+	}
+	path := filepath.Join(s.machinesDir, state.ActiveMachine)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("snapshot %s names active machine %s, which no longer exists at %s; restore a newer snapshot from --list", name, state.ActiveMachine, path)
+	} else if err != nil {
+		return fmt.Errorf("check active machine %s: %w", state.ActiveMachine, err)
+	}
+	return nil
+}
+
+// read returns the metadata files in the named snapshot by name. Entries
+// that are not metadata files are ignored.
+func (s *SnapshotStore) read(name string) (map[string][]byte, error) {
+	f, err := os.Open(filepath.Join(s.dir, name)) //nolint:gosec // name is checked to be a plain file name
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot %s: %w", name, err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read snapshot %s: %w", name, err)
+		}
+		if header.Typeflag != tar.TypeReg || !slices.Contains(snapshotFiles, header.Name) {
+			continue
+		}
+		if header.Size > maxSnapshotFileSize {
+			return nil, fmt.Errorf("snapshot %s: %s is larger than %d bytes", name, header.Name, maxSnapshotFileSize)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s from snapshot %s: %w", header.Name, name, err)
+		}
+		files[header.Name] = data
+	}
+}
+
+// prune removes all but the newest keep snapshots. Failures only leave extra
+// snapshots behind.
+func (s *SnapshotStore) prune() {
+	names, err := s.List()
+	if err != nil || len(names) <= s.keep {
+		return
+	}
+	for _, name := range names[s.keep:] {
+		_ = os.Remove(filepath.Join(s.dir, name))
+	}
+}
+
+type snapshotTask struct {
+	log    *slog.Logger
+	store  *SnapshotStore
+	reason string
+}
+
+// snapshotMetadata returns a task that snapshots the instance's metadata
+// before a risky operation. A failed snapshot is logged and does not block
+// the operation.
+func snapshotMetadata(log *slog.Logger, store *SnapshotStore, reason string) phases.Task {
+	return &snapshotTask{log: log, store: store, reason: reason}
+}
+
+func (t *snapshotTask) Name() string { return "snapshot-metadata" }
+
+func (t *snapshotTask) Do(context.Context) error {
+	if t.store == nil {
+		return nil
+	}
+	name, err := t.store.Take(t.reason)
+	if err != nil {
+		t.log.Warn("failed to snapshot metadata", "reason", t.reason, "error", err)
+		return nil
+	}
+	t.log.Info("snapshotted metadata", "reason", t.reason, "snapshot", name)
+	return nil
+}
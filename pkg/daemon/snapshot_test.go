@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotStoreTakeAndRestore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := newFileStateStore(filepath.Join(dir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(t.Context(), &State{ActiveMachine: "kube1", AppliedKubernetesVersion: "1.33.2"}); err != nil {
+		t.Fatal(err)
+	}
+	snapshots := newSnapshotStore(dir)
+	snapshots.machinesDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(snapshots.machinesDir, "kube1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	snapshots.now = func() time.Time { return time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC) }
+	name, err := snapshots.Take("repave")
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if want := "20260501T120000Z-repave.tar.gz"; name != want {
+		t.Errorf("Take() = %q, want %q", name, want)
+	}
+
+	// Corrupt the ledger and add a maintenance record the snapshot predates.
+	if err := os.WriteFile(filepath.Join(dir, stateFileName), []byte("{garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, maintenanceFileName), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(t.Context()); err == nil {
+		t.Fatal("Load() of corrupted state succeeded")
+	}
+
+	restored, err := snapshots.Restore("")
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if restored != name {
+		t.Errorf("Restore() = %q, want newest %q", restored, name)
+	}
+	state, err := store.Load(t.Context())
+	if err != nil {
+		t.Fatalf("Load() after restore error = %v", err)
+	}
+	if state.ActiveMachine != "kube1" || state.AppliedKubernetesVersion != "1.33.2" {
+		t.Errorf("restored state = %+v", state)
+	}
+	if _, err := os.Stat(filepath.Join(dir, maintenanceFileName)); !os.IsNotExist(err) {
+		t.Errorf("maintenance record not in the snapshot was kept: %v", err)
+	}
+}
+
+func TestSnapshotStoreRejectsRemovedActiveMachine(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := newFileStateStore(filepath.Join(dir, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(t.Context(), &State{ActiveMachine: "kube1"}); err != nil {
+		t.Fatal(err)
+	}
+	snapshots := newSnapshotStore(dir)
+	snapshots.machinesDir = t.TempDir()
+	name, err := snapshots.Take("repave")
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	// The repave swapped to kube2 and removed kube1.
+	if err := store.Save(t.Context(), &State{ActiveMachine: "kube2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = snapshots.Restore(name)
+	if err == nil || !strings.Contains(err.Error(), "kube1, which no longer exists") {
+		t.Fatalf("Restore() error = %v, want the removed machine named", err)
+	}
+	state, err := store.Load(t.Context())
+	if err != nil || state.ActiveMachine != "kube2" {
+		t.Errorf("state after rejected restore = %+v, %v; want kube2 kept", state, err)
+	}
+}
+
+func TestSnapshotStorePrunesAndRejectsPaths(t *testing.T) {
+	t.Parallel()
+
+	snapshots := newSnapshotStore(t.TempDir())
+	snapshots.keep = 2
+	at := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	snapshots.now = func() time.Time { at = at.Add(time.Minute); return at }
+	for range 3 {
+		if _, err := snapshots.Take("repave"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := snapshots.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20260501T000300Z-repave.tar.gz", "20260501T000200Z-repave.tar.gz"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("List() = %v, want %v", names, want)
+	}
+
+	if _, err := snapshots.Restore("../" + want[0]); err == nil {
+		t.Error("Restore() accepted a path outside the snapshot directory")
+	}
+}
+
+func TestSnapshotTaskDoesNotFailOperation(t *testing.T) {
+	t.Parallel()
+
+	// A state root that is a file cannot hold a snapshot directory.
+	root := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(root, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	task := snapshotMetadata(slog.New(slog.DiscardHandler), newSnapshotStore(root), "repave")
+	if err := task.Do(t.Context()); err != nil {
+		t.Errorf("Do() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/sriov"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+// sriovRestorer re-creates the configured SR-IOV virtual functions when the
+// daemon starts. The kernel drops them on every reboot while the machine and
+// its device plugin config survive. It implements manager.Runnable.
+type sriovRestorer struct {
+	log   *slog.Logger
+	apply func(ctx context.Context) error
+}
+
+func newSRIOVRestorer(log *slog.Logger, cfg *config.Config) *sriovRestorer {
+	host := sriov.NewHost(log, utilhost.HostRoot)
+	return &sriovRestorer{
+		log: log,
+		apply: func(ctx context.Context) error {
+			if err := host.Apply(ctx, cfg.SRIOV); err != nil {
+				return err
+			}
+			return host.Validate(cfg.SRIOV)
+		},
+	}
+}
+
+// NeedLeaderElection reports false: every daemon manages its own NICs.
+func (r *sriovRestorer) NeedLeaderElection() bool { return false }
+
+// Start applies the config once. A failure is logged rather than returned
+// so it does not stop the daemon.
+func (r *sriovRestorer) Start(ctx context.Context) error {
+	if err := r.apply(ctx); err != nil {
+		r.log.Error("failed to restore SR-IOV virtual functions", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestSRIOVRestorerLogsFailure(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	r := &sriovRestorer{
+		log: slog.New(slog.DiscardHandler),
+		apply: func(context.Context) error {
+			calls++
+			return errors.New("ens1f0 does not support SR-IOV")
+		},
+	}
+	if err := r.Start(t.Context()); err != nil {
+		t.Fatalf("Start() = %v, want nil so the daemon keeps running", err)
+	}
+	if calls != 1 {
+		t.Errorf("apply ran %d times, want 1", calls)
+	}
+}
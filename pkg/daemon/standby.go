@@ -0,0 +1,385 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases/nodestart"
+)
+
+const (
+	standbyFileName = "standby.json"
+
+	// NodeAnnotationStandby requests standby ("true") or activation
+	// ("false"). Cluster-side automation, such as an autoscaler driving a
+	// warm pool, sets it; the admin API sets it too so both agree.
+	NodeAnnotationStandby = "kubernetes.azure.com/flex-node-standby"
+	// NodeLabelInStandby is set to "true" while the node is in standby, so
+	// automation can select the warm pool.
+	NodeLabelInStandby = "kubernetes.azure.com/flex-node-in-standby"
+)
+
+// Standby records that the daemon put the node into standby.
+type Standby struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+	// Cordoned is true when entering standby cordoned the node, so
+	// activating it only uncordons nodes the agent cordoned itself.
+	Cordoned bool `json:"cordoned,omitempty"`
+}
+
+// StandbyRequest is the admin API payload that puts the node into standby.
+type StandbyRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// standbyStore persists the standby record so it survives daemon restarts.
+type standbyStore struct {
+	path string
+}
+
+func newStandbyStore(path string) *standbyStore {
+	if path == "" {
+		path = filepath.Join(config.ConfigDir, standbyFileName)
+	}
+	return &standbyStore{path: path}
+}
+
+func (s *standbyStore) Load() (*Standby, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read standby record %s: %w", s.path, err)
+	}
+	var record Standby
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decode standby record %s: %w", s.path, err)
+	}
+	return &record, nil
+}
+
+func (s *standbyStore) Save(record *Standby) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal standby record: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write standby record %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *standbyStore) Delete() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove standby record %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// kubeletUnit starts and stops the kubelet of the active machine.
+type kubeletUnit interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Active(ctx context.Context) (bool, error)
+}
+
+type machineKubelet struct {
+	log      *slog.Logger
+	state    stateStore
+	instance config.Instance
+}
+
+func (k *machineKubelet) machine(ctx context.Context) (string, error) {
+	active, err := activeMachineFromStore(ctx, k.state, k.instance)
+	if err != nil {
+		return "", err
+	}
+	return active.Name, nil
+}
+
+// Start starts the kubelet and waits for the unit to be active. containerd
+// kept running in standby, so the node is Ready as soon as the kubelet
+// reports to the API server.
+func (k *machineKubelet) Start(ctx context.Context) error {
+	machine, err := k.machine(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := utilexec.MachineRun(ctx, k.log, machine, "systemctl", "start", goalstates.SystemdUnitKubelet); err != nil {
+		return fmt.Errorf("start kubelet in %s: %w", machine, err)
+	}
+	return nodestart.WaitForKubelet(k.log, machine).Do(ctx)
+}
+
+// Stop stops the kubelet but leaves it enabled, so a repave or machine
+// restart brings it back and the standby controller stops it again.
+func (k *machineKubelet) Stop(ctx context.Context) error {
+	machine, err := k.machine(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := utilexec.MachineRun(ctx, k.log, machine, "systemctl", "stop", goalstates.SystemdUnitKubelet); err != nil {
+		return fmt.Errorf("stop kubelet in %s: %w", machine, err)
+	}
+	return nil
+}
+
+func (k *machineKubelet) Active(ctx context.Context) (bool, error) {
+	machine, err := k.machine(ctx)
+	if err != nil {
+		return false, err
+	}
+	// is-active exits non-zero for every state but active, so only its
+	// output tells a stopped kubelet from a failed call.
+	out, err := utilexec.MachineRun(ctx, k.log, machine, "systemctl", "is-active", goalstates.SystemdUnitKubelet)
+	state := strings.TrimSpace(out)
+	if err != nil && state == "" {
+		return false, fmt.Errorf("check kubelet in %s: %w", machine, err)
+	}
+	return state == "active", nil
+}
+
+// standbyManager owns entering and leaving standby. The admin API calls
+// Deactivate and Activate; its Start loop follows NodeAnnotationStandby and
+// keeps the kubelet stopped while the node is in standby. It implements
+// manager.Runnable.
+type standbyManager struct {
+	log            *slog.Logger
+	client         client.Client
+	reader         client.Reader
+	nodeName       string
+	store          *standbyStore
+	recorder       *nodeRecorder
+	maintenance    *maintenanceManager
+	kubelet        kubeletUnit
+	interval       time.Duration
+	drainTimeout   time.Duration
+	startInStandby bool
+	now            func() time.Time
+
+	mu sync.Mutex
+}
+
+func newStandbyManager(log *slog.Logger, cfg config.StandbyConfig, c client.Client, reader client.Reader, nodeName string, store *standbyStore, maintenance *maintenanceManager, kubelet kubeletUnit, recorder *nodeRecorder) *standbyManager {
+	drainTimeout := time.Duration(cfg.DrainTimeout)
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+	return &standbyManager{
+		log:            log,
+		client:         c,
+		reader:         reader,
+		nodeName:       nodeName,
+		store:          store,
+		recorder:       recorder,
+		maintenance:    maintenance,
+		kubelet:        kubelet,
+		interval:       time.Duration(cfg.Interval),
+		drainTimeout:   drainTimeout,
+		startInStandby: cfg.StartInStandby,
+		now:            time.Now,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon manages its own node.
+func (m *standbyManager) NeedLeaderElection() bool { return false }
+
+// Start reconciles the node's standby state every interval. Failures are
+// logged and retried on the next tick.
+func (m *standbyManager) Start(ctx context.Context) error {
+	if record, err := m.store.Load(); err == nil && record != nil {
+		standbyGauge.Set(1)
+	}
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Reconcile(ctx); err != nil {
+			m.log.Warn("failed to reconcile standby", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Current returns the standby record, or nil when the node is active.
+func (m *standbyManager) Current() (*Standby, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return m.store.Load()
+}
+
+// Deactivate puts the node into standby and records the request on the Node
+// so the controller does not activate it again.
+func (m *standbyManager) Deactivate(ctx context.Context, req StandbyRequest) (*Standby, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.patchNode(ctx, map[string]any{"annotations": map[string]any{NodeAnnotationStandby: "true"}}); err != nil {
+		return nil, err
+	}
+	return m.enterLocked(ctx, req.Reason)
+}
+
+// Activate takes the node out of standby and records the request on the
+// Node.
+func (m *standbyManager) Activate(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.patchNode(ctx, map[string]any{"annotations": map[string]any{NodeAnnotationStandby: "false"}}); err != nil {
+		return err
+	}
+	return m.activateLocked(ctx)
+}
+
+// Reconcile converges the node on the state NodeAnnotationStandby requests.
+// Without the annotation the node keeps its current state, except that
+// startInStandby requests standby for a node that has none.
+func (m *standbyManager) Reconcile(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node := &corev1.Node{}
+	if err := m.reader.Get(ctx, client.ObjectKey{Name: m.nodeName}, node); apierrors.IsNotFound(err) {
+		// The kubelet has not registered the node yet.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("get node %s: %w", m.nodeName, err)
+	}
+	record, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+
+	want := record != nil
+	value, ok := node.Annotations[NodeAnnotationStandby]
+	if ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			m.log.Warn("ignoring invalid standby annotation", "annotation", NodeAnnotationStandby, "value", value)
+		} else {
+			want = parsed
+		}
+	} else if m.startInStandby {
+		if err := m.patchNode(ctx, map[string]any{"annotations": map[string]any{NodeAnnotationStandby: "true"}}); err != nil {
+			return err
+		}
+		want = true
+	}
+
+	switch {
+	case want && record == nil:
+		_, err := m.enterLocked(ctx, "requested by "+NodeAnnotationStandby)
+		return err
+	case want:
+		// A repave or machine restart starts the kubelet again.
+		active, err := m.kubelet.Active(ctx)
+		if err != nil || !active {
+			return err
+		}
+		m.log.Info("kubelet started while the node is in standby, stopping it")
+		return m.kubelet.Stop(ctx)
+	case record != nil:
+		return m.activateLocked(ctx)
+	}
+	return nil
+}
+
+// enterLocked cordons and drains the node, then stops the kubelet. The
+// record is saved before draining so a drain that times out still leaves
+// the node cordoned and the next reconcile retries it.
+func (m *standbyManager) enterLocked(ctx context.Context, reason string) (*Standby, error) {
+	record, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		record = &Standby{Since: m.now().UTC()}
+	}
+	record.Reason = reason
+	cordoned, err := m.maintenance.setUnschedulable(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	record.Cordoned = record.Cordoned || cordoned
+	if err := m.store.Save(record); err != nil {
+		return nil, err
+	}
+	if err := m.maintenance.drain(ctx, m.drainTimeout); err != nil {
+		return record, fmt.Errorf("drain node %s: %w", m.nodeName, err)
+	}
+	if err := m.kubelet.Stop(ctx); err != nil {
+		return record, err
+	}
+	if err := m.patchNode(ctx, map[string]any{"labels": map[string]any{NodeLabelInStandby: "true"}}); err != nil {
+		return record, err
+	}
+	standbyGauge.Set(1)
+	m.log.Info("node entered standby", "reason", record.Reason)
+	m.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonStandbyEntered, "Entered standby: "+record.Reason)
+	return record, nil
+}
+
+// activateLocked starts the kubelet, uncordons the node if standby cordoned
+// it, and clears the record.
+func (m *standbyManager) activateLocked(ctx context.Context) error {
+	record, err := m.store.Load()
+	if err != nil || record == nil {
+		return err
+	}
+	start := m.now()
+	if err := m.kubelet.Start(ctx); err != nil {
+		return err
+	}
+	if record.Cordoned {
+		if _, err := m.maintenance.setUnschedulable(ctx, false); err != nil {
+			return err
+		}
+	}
+	if err := m.patchNode(ctx, map[string]any{"labels": map[string]any{NodeLabelInStandby: nil}}); err != nil {
+		return err
+	}
+	if err := m.store.Delete(); err != nil {
+		return err
+	}
+	standbyGauge.Set(0)
+	took := m.now().Sub(start).Round(time.Millisecond)
+	m.log.Info("node activated", "took", took, "uncordoned", record.Cordoned)
+	m.recorder.Event(ctx, corev1.EventTypeNormal, EventReasonActivated, fmt.Sprintf("Activated from standby in %s", took))
+	return nil
+}
+
+func (m *standbyManager) patchNode(ctx context.Context, metadata map[string]any) error {
+	patch, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return fmt.Errorf("marshal node patch: %w", err)
+	}
+	node := &corev1.Node{}
+	node.Name = m.nodeName
+	if err := m.client.Patch(ctx, node, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("patch node %s: %w", m.nodeName, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+type fakeKubelet struct {
+	active bool
+	starts int
+	stops  int
+}
+
+func (k *fakeKubelet) Start(context.Context) error {
+	k.active = true
+	k.starts++
+	return nil
+}
+
+func (k *fakeKubelet) Stop(context.Context) error {
+	k.active = false
+	k.stops++
+	return nil
+}
+
+func (k *fakeKubelet) Active(context.Context) (bool, error) { return k.active, nil }
+
+func newTestStandbyManager(t *testing.T, cfg config.StandbyConfig, node *corev1.Node) (*standbyManager, client.Client, *fakeKubelet) {
+	t.Helper()
+	kubeClient := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(node).
+		WithIndex(&corev1.Pod{}, "spec.nodeName", func(o client.Object) []string {
+			return []string{o.(*corev1.Pod).Spec.NodeName}
+		}).Build()
+	log := slog.New(slog.DiscardHandler)
+	dir := t.TempDir()
+	maintenance := newMaintenanceManager(log, kubeClient, kubeClient, "node1", newMaintenanceStore(filepath.Join(dir, maintenanceFileName)), nil)
+	kubelet := &fakeKubelet{active: true}
+	m := newStandbyManager(log, cfg, kubeClient, kubeClient, "node1", newStandbyStore(filepath.Join(dir, standbyFileName)), maintenance, kubelet, nil)
+	return m, kubeClient, kubelet
+}
+
+func TestStandbyDeactivateActivate(t *testing.T) {
+	t.Parallel()
+
+	m, kubeClient, kubelet := newTestStandbyManager(t, config.StandbyConfig{}, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+
+	record, err := m.Deactivate(t.Context(), StandbyRequest{Reason: "warm pool"})
+	if err != nil {
+		t.Fatalf("Deactivate: %v", err)
+	}
+	if !record.Cordoned || record.Reason != "warm pool" {
+		t.Fatalf("record = %+v", record)
+	}
+	node := getNode(t, kubeClient)
+	if !node.Spec.Unschedulable || node.Annotations[NodeAnnotationStandby] != "true" || node.Labels[NodeLabelInStandby] != "true" {
+		t.Fatalf("node after Deactivate = %+v", node.ObjectMeta)
+	}
+	if kubelet.active {
+		t.Fatal("kubelet still running in standby")
+	}
+
+	if err := m.Activate(t.Context()); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+	node = getNode(t, kubeClient)
+	if node.Spec.Unschedulable || node.Annotations[NodeAnnotationStandby] != "false" {
+		t.Fatalf("node after Activate = %+v", node.ObjectMeta)
+	}
+	if _, ok := node.Labels[NodeLabelInStandby]; ok {
+		t.Fatal("standby label left on the active node")
+	}
+	if !kubelet.active {
+		t.Fatal("kubelet not started on activation")
+	}
+	if current, err := m.Current(); err != nil || current != nil {
+		t.Fatalf("Current = %+v, %v; want nil", current, err)
+	}
+}
+
+func TestStandbyReconcileFollowsAnnotation(t *testing.T) {
+	t.Parallel()
+
+	m, kubeClient, kubelet := newTestStandbyManager(t, config.StandbyConfig{}, &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:        "node1",
+		Annotations: map[string]string{NodeAnnotationStandby: "true"},
+	}})
+
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if kubelet.active || !getNode(t, kubeClient).Spec.Unschedulable {
+		t.Fatal("annotation did not put the node into standby")
+	}
+
+	// A repave starts the kubelet again; the next reconcile stops it.
+	kubelet.active = true
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if kubelet.active || kubelet.stops != 2 {
+		t.Fatalf("kubelet active=%v stops=%d; want stopped twice", kubelet.active, kubelet.stops)
+	}
+
+	node := getNode(t, kubeClient)
+	node.Annotations[NodeAnnotationStandby] = "false"
+	if err := kubeClient.Update(t.Context(), node); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !kubelet.active || getNode(t, kubeClient).Spec.Unschedulable {
+		t.Fatal("annotation did not activate the node")
+	}
+}
+
+func TestStandbyStartInStandby(t *testing.T) {
+	t.Parallel()
+
+	m, kubeClient, kubelet := newTestStandbyManager(t, config.StandbyConfig{Enabled: true, StartInStandby: true},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if kubelet.active || getNode(t, kubeClient).Annotations[NodeAnnotationStandby] != "true" {
+		t.Fatal("new node did not start in standby")
+	}
+
+	// Once activated, the annotation keeps it active.
+	if err := m.Activate(t.Context()); err != nil {
+		t.Fatalf("Activate: %v", err)
+	}
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !kubelet.active {
+		t.Fatal("activated node went back into standby")
+	}
+}
+
+func TestStandbyReconcileWithoutNode(t *testing.T) {
+	t.Parallel()
+
+	m, _, kubelet := newTestStandbyManager(t, config.StandbyConfig{StartInStandby: true}, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+	if err := m.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !kubelet.active {
+		t.Fatal("kubelet stopped before the node registered")
+	}
+}
@@ -2,11 +2,28 @@ package daemon
 
 import (
 	"log/slog"
+	"path/filepath"
+	"slices"
 
+	"github.com/Azure/AKSFlexNode/pkg/accelerator"
+	"github.com/Azure/AKSFlexNode/pkg/acrcredentials"
 	"github.com/Azure/AKSFlexNode/pkg/arc"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/hooks"
+	"github.com/Azure/AKSFlexNode/pkg/hostconflict"
 	"github.com/Azure/AKSFlexNode/pkg/hostrouting"
+	"github.com/Azure/AKSFlexNode/pkg/kubeconfig"
+	"github.com/Azure/AKSFlexNode/pkg/localdns"
+	"github.com/Azure/AKSFlexNode/pkg/localstorage"
+	"github.com/Azure/AKSFlexNode/pkg/machinestore"
+	"github.com/Azure/AKSFlexNode/pkg/nodetools"
 	"github.com/Azure/AKSFlexNode/pkg/npd"
+	"github.com/Azure/AKSFlexNode/pkg/performance"
+	"github.com/Azure/AKSFlexNode/pkg/sriov"
+	"github.com/Azure/AKSFlexNode/pkg/trust"
+	"github.com/Azure/AKSFlexNode/pkg/unithardening"
+	"github.com/Azure/AKSFlexNode/pkg/wsl"
 	"github.com/Azure/unbounded/pkg/agent/goalstates"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 	"github.com/Azure/unbounded/pkg/agent/phases/host"
@@ -14,18 +31,37 @@ import (
 	"github.com/Azure/unbounded/pkg/agent/phases/rootfs"
 )
 
-func SetupHost(cfg *config.Config, log *slog.Logger) phases.Task {
+// SetupHost returns the host preparation tasks. When timings is non-nil each
+// step's duration and outcome is recorded into it.
+func SetupHost(cfg *config.Config, log *slog.Logger, timings *StepTimings) phases.Task {
+	return setupHost(cfg, log, timings.Track)
+}
+
+// setupHost builds SetupHost, passing every step through track. The start
+// plan tracks the same steps to ask them which files they write.
+func setupHost(cfg *config.Config, log *slog.Logger, track func(phases.Task) phases.Task) phases.Task {
 	return phases.Serial(log,
-		host.InstallPackages(log),
+		track(host.InstallPackages(log)),
 		phases.Parallel(log,
-			host.ConfigureOS(log),
-			host.ConfigureNFTables(log),
-			host.DisableDocker(log),
-			host.DisableSwap(log),
-			host.HardenAPT(log),
-			arc.InstallArc(cfg, log),
-			hostrouting.Configure(cfg, log),
+			track(hostconflict.Quarantine(log, cfg.Agent.QuarantineConflicts)),
+			track(withPlan(host.ConfigureOS(log), hostSysctlPath)),
+			track(withPlan(host.ConfigureNFTables(log), nftablesClearPath, filepath.Join(goalstates.SystemdSystemDir, nftablesFlushUnit))),
+			track(withPlan(host.DisableDocker(log), dockerDaemonConfigPath)),
+			track(host.DisableSwap(log)),
+			track(withPlan(host.HardenAPT(log), aptDropInPath, needrestartDropInPath)),
+			phases.Serial(log,
+				track(arc.InstallArc(cfg, log)),
+				track(hooks.Run(log, cfg, config.HookPostArc, hooks.Facts{})),
+			),
+			track(hostrouting.Configure(cfg, log)),
+			track(wsl.ConfigureHost(log)),
+			track(deviceprofile.ConfigureHost(log, nodeDeviceProfile(cfg))),
+			track(sriov.Configure(log, cfg)),
+			track(localstorage.Configure(log, cfg)),
 		),
+		// Runs after the device profile, which may edit the same boot
+		// command line.
+		track(performance.Configure(log, cfg, nodeDeviceProfile(cfg).BootCmdline())),
 	)
 }
 
@@ -45,17 +81,121 @@ func StartNode(
 	containerImageArchives *goalstates.ContainerImageArchiveStaging,
 	store stateStore,
 	state *State,
+	timings *StepTimings,
+) phases.Task {
+	return startNode(cfg, log, machineName, gs, containerImageArchives, store, state, timings.Track)
+}
+
+// startNode builds StartNode, passing every step through track.
+func startNode(
+	cfg *config.Config,
+	log *slog.Logger,
+	machineName string,
+	gs *goalstates.MachineGoalState,
+	containerImageArchives *goalstates.ContainerImageArchiveStaging,
+	store stateStore,
+	state *State,
+	track func(phases.Task) phases.Task,
+) phases.Task {
+	facts := hooks.Facts{Machine: machineName, MachineDir: gs.RootFS.MachineDir}
+	dns := localdns.NewInstaller(log, cfg, gs.NodeStart)
+	return phases.Serial(log,
+		fetchGeneration(cfg, log, gs, containerImageArchives, track),
+		track(accelerator.Configure(log, cfg, gs.RootFS.MachineDir)),
+		track(sriov.WriteMachine(log, cfg, gs.RootFS.MachineDir)),
+		track(localstorage.BindMachine(cfg, gs.RootFS.NSpawnConfigFile)),
+		track(ValidateRootFS(log, gs.RootFS)),
+		track(hooks.Run(log, cfg, config.HookPostRootFS, facts)),
+		track(WriteKubeletTuning(cfg, gs.RootFS.MachineDir)),
+		track(unithardening.WriteDropIns(cfg.UnitHardening, gs.RootFS.MachineDir)),
+		track(dns.Configure()),
+		track(kubeconfig.NewManager(log, cfg).Task(gs.RootFS.MachineDir)),
+		track(acrcredentials.NewManager(log, cfg).Task(gs.RootFS.MachineDir)),
+		track(hooks.Run(log, cfg, config.HookPreKubelet, facts)),
+		track(nodestart.StartNode(log, gs.NodeStart)),
+		track(dns.Start()),
+		track(nodestart.WaitForKubelet(log, machineName)),
+		track(npd.Start(log, cfg, gs.NodeStart)),
+		track(RecordManifest(log, cfg.Instance, machineName, gs.RootFS.MachineDir)),
+		track(saveState(store, state)),
+		track(ExportBinaries(log, cfg, machineName, gs.RootFS.MachineDir)),
+	)
+}
+
+// FetchGeneration returns the tasks that fill a new machine generation's
+// directory with its rootfs and the binaries the node runs. Each skips what is
+// already in place, so StartNode runs them quickly on a generation that was
+// prefetched.
+func FetchGeneration(
+	cfg *config.Config,
+	log *slog.Logger,
+	gs *goalstates.MachineGoalState,
+	containerImageArchives *goalstates.ContainerImageArchiveStaging,
+	timings *StepTimings,
+) phases.Task {
+	return fetchGeneration(cfg, log, gs, containerImageArchives, timings.Track)
+}
+
+func fetchGeneration(
+	cfg *config.Config,
+	log *slog.Logger,
+	gs *goalstates.MachineGoalState,
+	containerImageArchives *goalstates.ContainerImageArchiveStaging,
+	track func(phases.Task) phases.Task,
 ) phases.Task {
+	downloads := applyConcurrency(cfg)
 	return phases.Serial(log,
-		stageContainerImageArchiveBindSource(log, containerImageArchives),
-		rootfs.Provision(log, gs.RootFS),
+		track(stageContainerImageArchiveBindSource(log, containerImageArchives)),
+		track(machinestore.Create(log, cfg, gs.RootFS)),
+		track(provisionRootFS(log, gs.RootFS, downloads)),
+		boundedParallel(log, downloads,
+			track(npd.Download(log, cfg, gs.RootFS.MachineDir)),
+			track(nodetools.Download(log, cfg, gs.RootFS.MachineDir)),
+			track(localdns.Download(log, cfg, gs.RootFS.MachineDir)),
+			track(trust.Install(log, cfg, gs.RootFS.MachineDir)),
+			track(InstallBinary(gs.RootFS.MachineDir)),
+		),
+	)
+}
+
+// provisionRootFS is rootfs.Provision with the artifact downloads limited to
+// downloads at a time. Without a limit it is rootfs.Provision itself.
+func provisionRootFS(log *slog.Logger, gs *goalstates.RootFS, downloads int) phases.Task {
+	if downloads <= 0 {
+		return rootfs.Provision(log, gs)
+	}
+	return phases.Serial(log,
+		rootfs.EnsureNSpawnWorkspace(log, gs),
+		boundedParallel(log, downloads,
+			rootfs.DownloadKubeBinaries(log, gs),
+			rootfs.DownloadCRIBinaries(log, gs),
+			rootfs.DownloadCNIBinaries(log, gs),
+		),
 		phases.Parallel(log,
-			npd.Download(log, cfg, gs.RootFS.MachineDir),
-			InstallBinary(gs.RootFS.MachineDir),
+			rootfs.ConfigureOS(gs),
+			rootfs.DisableResolved(gs),
 		),
-		nodestart.StartNode(log, gs.NodeStart),
-		nodestart.WaitForKubelet(log, machineName),
-		npd.Start(log, cfg, gs.NodeStart),
-		saveState(store, state),
 	)
 }
+
+// boundedParallel runs tasks in parallel batches of at most limit tasks. A
+// limit of zero or less runs them all at once.
+func boundedParallel(log *slog.Logger, limit int, tasks ...phases.Task) phases.Task {
+	if limit <= 0 || limit >= len(tasks) {
+		return phases.Parallel(log, tasks...)
+	}
+	batches := make([]phases.Task, 0, (len(tasks)+limit-1)/limit)
+	for batch := range slices.Chunk(tasks, limit) {
+		batches = append(batches, phases.Parallel(log, batch...))
+	}
+	return phases.Serial(log, batches...)
+}
+
+// nodeDeviceProfile returns the profile config validation resolved. Configs
+// that were never validated, such as in tests, get the generic profile.
+func nodeDeviceProfile(cfg *config.Config) deviceprofile.Profile {
+	if profile, err := deviceprofile.Lookup(cfg.Node.DeviceProfile); err == nil {
+		return profile
+	}
+	return deviceprofile.Profile{Name: deviceprofile.Generic}
+}
@@ -0,0 +1,252 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/hostconflict"
+	"github.com/Azure/AKSFlexNode/pkg/machinestore"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+// PlanAction is what start does to an /etc entry.
+type PlanAction string
+
+const (
+	PlanAdd       PlanAction = "add"
+	PlanReplace   PlanAction = "replace"
+	PlanUnchanged PlanAction = "unchanged"
+)
+
+// PlannedEntry is one file start writes. Target is set for symlinks.
+// Machine is set for files inside the machine rootfs, whose Path is then
+// relative to the machine's root.
+type PlannedEntry struct {
+	Action  PlanAction
+	Path    string
+	Target  string
+	Machine string
+}
+
+// StartPlan is what start changes in the host's /etc and which units it
+// acts on, for the operator to confirm before an interactive start.
+type StartPlan struct {
+	Entries     []PlannedEntry
+	UnitActions []string
+}
+
+// Files the host tasks of Unbounded write. The tasks do not report them, so
+// setupHost attaches them with withPlan.
+const (
+	hostSysctlPath         = "/etc/sysctl.d/99-kubernetes.conf"
+	nftablesClearPath      = goalstates.ConfigDir + "/nftables-clear.nft"
+	nftablesFlushUnit      = "nftables-flush.service"
+	dockerDaemonConfigPath = "/etc/docker/daemon.json"
+	aptDropInPath          = "/etc/apt/apt.conf.d/99-unbounded-no-restart-systemd"
+	needrestartDropInPath  = "/etc/needrestart/conf.d/99-unbounded.conf"
+)
+
+// filePlanner is implemented by the steps of SetupHost and StartNode that
+// write files. Plan returns the paths Do would write under the current
+// config, without writing them; files inside the machine are joined to its
+// directory.
+type filePlanner interface {
+	Plan() []string
+}
+
+// plannedTask attaches the files it writes to a task that does not report
+// them itself.
+type plannedTask struct {
+	phases.Task
+	paths []string
+}
+
+func withPlan(task phases.Task, paths ...string) phases.Task {
+	return &plannedTask{Task: task, paths: paths}
+}
+
+func (t *plannedTask) Plan() []string { return t.paths }
+
+// PlanStart returns the plan of a start of cfg on this host.
+func PlanStart(ctx context.Context, cfg *config.Config) (*StartPlan, error) {
+	var conflicts []hostconflict.Conflict
+	if cfg.Agent.QuarantineConflicts {
+		var err error
+		if conflicts, err = hostconflict.NewScanner(utilhost.HostRoot).Scan(ctx); err != nil {
+			return nil, fmt.Errorf("scan host conflicts: %w", err)
+		}
+	}
+	return planStart(utilhost.HostRoot, cfg, conflicts)
+}
+
+func planStart(root utilhost.Root, cfg *config.Config, conflicts []hostconflict.Conflict) (*StartPlan, error) {
+	unitName := cfg.Instance.ServiceUnitName()
+	unitContent, err := renderServiceUnit(newServiceUnitData(cfg))
+	if err != nil {
+		return nil, err
+	}
+	machine := cfg.Instance.Machines()[0]
+	machineUnit := "systemd-nspawn@" + machine + ".service"
+	machineDir := filepath.Join(machinestore.MachinesDir, machine)
+
+	plan := &StartPlan{}
+	var masked []string
+	quarantined := false
+	for _, c := range conflicts {
+		if c.Quarantined {
+			continue
+		}
+		if c.Kind == hostconflict.KindPackage && c.Manager == hostconflict.ManagerDpkg {
+			quarantined = true
+		}
+		if c.Kind != hostconflict.KindUnit {
+			continue
+		}
+		quarantined = true
+		masked = append(masked, c.Name)
+		plan.Entries = append(plan.Entries, planSymlink(root, filepath.Join(systemdSystemDir, c.Name), os.DevNull))
+	}
+	if quarantined {
+		plan.Entries = append(plan.Entries, planFile(root, hostconflict.RecordPath, nil))
+	}
+	plan.Entries = append(plan.Entries,
+		planFile(root, filepath.Join(goalstates.SystemdNSpawnDir, machine+".nspawn"), nil),
+		planFile(root, filepath.Join(systemdSystemDir, machineUnit+".d", "override.conf"), nil),
+		planSymlink(root, filepath.Join(systemdSystemDir, "machines.target.wants", machineUnit), "/usr/lib/systemd/system/systemd-nspawn@.service"),
+		planFile(root, filepath.Join(systemdSystemDir, unitName), unitContent),
+		planSymlink(root, filepath.Join(systemdSystemDir, "multi-user.target.wants", unitName), filepath.Join(systemdSystemDir, unitName)),
+	)
+
+	// Ask the steps start runs for the files they write, so the plan follows
+	// them rather than a list of its own.
+	var tasks []phases.Task
+	track := func(task phases.Task) phases.Task {
+		tasks = append(tasks, task)
+		return task
+	}
+	log := slog.New(slog.DiscardHandler)
+	gs := &goalstates.MachineGoalState{
+		RootFS: &goalstates.RootFS{
+			MachineDir:       machineDir,
+			NSpawnConfigFile: filepath.Join(goalstates.SystemdNSpawnDir, machine+".nspawn"),
+		},
+		NodeStart: &goalstates.NodeStart{MachineName: machine, MachineDir: machineDir, NodeName: cfg.Agent.NodeName},
+	}
+	setupHost(cfg, log, track)
+	startNode(cfg, log, machine, gs, &goalstates.ContainerImageArchiveStaging{}, nil, nil, track)
+	seen := map[string]bool{}
+	for _, e := range plan.Entries {
+		seen[e.Path] = true
+	}
+	for _, task := range tasks {
+		planner, ok := task.(filePlanner)
+		if !ok {
+			continue
+		}
+		for _, path := range planner.Plan() {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			entry := planFile(root, path, nil)
+			if rel, err := filepath.Rel(machineDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+				entry.Machine, entry.Path = machine, "/"+rel
+			}
+			plan.Entries = append(plan.Entries, entry)
+		}
+	}
+
+	if len(masked) > 0 {
+		plan.UnitActions = append(plan.UnitActions, "stop and mask "+strings.Join(masked, " "))
+	}
+	plan.UnitActions = append(plan.UnitActions,
+		"machinectl enable "+machine,
+		"machinectl start "+machine,
+		"systemctl daemon-reload",
+		"systemctl enable "+unitName,
+		"systemctl start "+unitName,
+	)
+	return plan, nil
+}
+
+// planFile compares the file at path with content. Without content, which
+// is only known once the task runs, an existing file is replaced.
+func planFile(root utilhost.Root, path string, content []byte) PlannedEntry {
+	if content == nil {
+		if _, err := os.Lstat(root.Path(path)); err != nil {
+			return PlannedEntry{Action: PlanAdd, Path: path}
+		}
+		return PlannedEntry{Action: PlanReplace, Path: path}
+	}
+	current, err := os.ReadFile(root.Path(path))
+	switch {
+	case err != nil:
+		return PlannedEntry{Action: PlanAdd, Path: path}
+	case bytes.Equal(current, content):
+		return PlannedEntry{Action: PlanUnchanged, Path: path}
+	default:
+		return PlannedEntry{Action: PlanReplace, Path: path}
+	}
+}
+
+// planSymlink compares the symlink at path with target by file name, since
+// distributions install template units under /lib or /usr/lib.
+func planSymlink(root utilhost.Root, path, target string) PlannedEntry {
+	entry := PlannedEntry{Action: PlanAdd, Path: path, Target: target}
+	if current, err := os.Readlink(root.Path(path)); err == nil && filepath.Base(current) == filepath.Base(target) {
+		entry.Action = PlanUnchanged
+	} else if _, err := os.Lstat(root.Path(path)); err == nil {
+		entry.Action = PlanReplace
+	}
+	return entry
+}
+
+// Write prints the plan, leaving out the entries that do not change.
+func (p *StartPlan) Write(w io.Writer) error {
+	var b strings.Builder
+	writeEntries := func(heading, machine string) {
+		b.WriteString(heading)
+		changed := 0
+		for _, e := range p.Entries {
+			if e.Action == PlanUnchanged || e.Machine != machine {
+				continue
+			}
+			changed++
+			fmt.Fprintf(&b, "  %-8s %s", e.Action, e.Path)
+			if e.Target != "" {
+				fmt.Fprintf(&b, " -> %s", e.Target)
+			}
+			b.WriteString("\n")
+		}
+		if changed == 0 {
+			b.WriteString("  none\n")
+		}
+	}
+	writeEntries("Changes to the host:\n", "")
+	var machines []string
+	for _, e := range p.Entries {
+		if e.Machine != "" && !slices.Contains(machines, e.Machine) {
+			machines = append(machines, e.Machine)
+		}
+	}
+	for _, machine := range machines {
+		writeEntries("Changes inside machine "+machine+":\n", machine)
+	}
+	b.WriteString("Unit actions:\n")
+	for _, action := range p.UnitActions {
+		fmt.Fprintf(&b, "  %s\n", action)
+	}
+	b.WriteString("The host packages the node needs are installed, and swap entries in /etc/fstab are commented out.\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/hostconflict"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+func TestPlanStart(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	cfg := &config.Config{
+		Agent:     config.AgentConfig{BinaryPath: "/usr/local/bin/aks-flex-node", ExportBinaries: true},
+		NodeTools: config.NodeToolsConfig{Enabled: true},
+		LocalDNS:  config.LocalDNSConfig{Enabled: true},
+	}
+	unitName := cfg.Instance.ServiceUnitName()
+	unit, err := renderServiceUnit(newServiceUnitData(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile := func(path string, content []byte) {
+		t.Helper()
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A previous start left the agent unit and the nspawn file behind, and
+	// the host runs its own kubelet.
+	writeFile(filepath.Join(systemdSystemDir, unitName), unit)
+	writeFile("/etc/systemd/nspawn/kube1.nspawn", []byte("[Exec]\n"))
+	writeFile("/etc/systemd/system/kubelet.service", []byte("[Service]\n"))
+	conflicts := []hostconflict.Conflict{
+		{Kind: hostconflict.KindUnit, Name: "kubelet.service", Path: "/etc/systemd/system/kubelet.service"},
+		{Kind: hostconflict.KindUnit, Name: "containerd.service", Quarantined: true},
+		{Kind: hostconflict.KindPackage, Name: "kubelet", Manager: hostconflict.ManagerDpkg},
+	}
+
+	plan, err := planStart(utilhost.Root(root), cfg, conflicts)
+	if err != nil {
+		t.Fatalf("planStart: %v", err)
+	}
+	type key struct{ machine, path string }
+	want := map[key]PlanAction{
+		{"", "/etc/systemd/system/kubelet.service"}:                                    PlanReplace,
+		{"", hostconflict.RecordPath}:                                                  PlanAdd,
+		{"", "/etc/systemd/nspawn/kube1.nspawn"}:                                       PlanReplace,
+		{"", "/etc/systemd/system/systemd-nspawn@kube1.service.d/override.conf"}:       PlanAdd,
+		{"", "/etc/systemd/system/machines.target.wants/systemd-nspawn@kube1.service"}: PlanAdd,
+		{"", filepath.Join(systemdSystemDir, unitName)}:                                PlanUnchanged,
+		{"", filepath.Join(systemdSystemDir, "multi-user.target.wants", unitName)}:     PlanAdd,
+		// Files the steps of SetupHost and StartNode report.
+		{"", "/etc/sysctl.d/99-kubernetes.conf"}:                PlanAdd,
+		{"", profileFragmentPath}:                               PlanAdd,
+		{"kube1", "/etc/default/kubelet"}:                       PlanAdd,
+		{"kube1", "/etc/crictl.yaml"}:                           PlanAdd,
+		{"kube1", "/etc/nerdctl/nerdctl.toml"}:                  PlanAdd,
+		{"kube1", "/etc/node-local-dns/Corefile"}:               PlanAdd,
+		{"kube1", "/etc/systemd/system/node-local-dns.service"}: PlanAdd,
+	}
+	seen := map[key]bool{}
+	for _, e := range plan.Entries {
+		k := key{e.Machine, e.Path}
+		if seen[k] {
+			t.Errorf("%s listed twice", e.Path)
+		}
+		seen[k] = true
+		if action, ok := want[k]; ok && action != e.Action {
+			t.Errorf("%s: action = %s, want %s", e.Path, e.Action, action)
+		}
+	}
+	for k := range want {
+		if !seen[k] {
+			t.Errorf("plan does not list %s (machine %q):\n%+v", k.path, k.machine, plan.Entries)
+		}
+	}
+	if plan.UnitActions[0] != "stop and mask kubelet.service" {
+		t.Errorf("unit actions = %v, want the kubelet masked first", plan.UnitActions)
+	}
+
+	var out strings.Builder
+	if err := plan.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "  "+filepath.Join(systemdSystemDir, unitName)) {
+		t.Errorf("plan lists the unchanged agent unit:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "replace  /etc/systemd/system/kubelet.service -> /dev/null") {
+		t.Errorf("plan does not list the kubelet mask:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Changes inside machine kube1:\n") || !strings.Contains(out.String(), "add      /etc/crictl.yaml\n") {
+		t.Errorf("plan does not list the machine's files:\n%s", out.String())
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
 	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
-	"github.com/Azure/unbounded/pkg/agent/goalstates"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
 
@@ -31,6 +30,13 @@ type State struct {
 	PreviousSettingsVersion   string `json:"previousSettingsVersion,omitempty"`
 	PreviousKubernetesVersion string `json:"previousKubernetesVersion,omitempty"`
 	ActiveMachine             string `json:"activeMachine,omitempty"`
+	// AppliedGoal is the goal state the active machine runs. The next goal
+	// is diffed against it to decide whether a kubelet restart is enough.
+	AppliedGoal *aksmachine.GoalState `json:"appliedGoal,omitempty"`
+	// LastKnownGood is the goal state whose machine last passed a health
+	// pass after it was applied. The daemon falls back to it at startup when
+	// the applied goal's machine does not come up.
+	LastKnownGood *aksmachine.GoalState `json:"lastKnownGood,omitempty"`
 }
 
 type saveStateTask struct {
@@ -57,19 +63,35 @@ func (t *saveStateTask) Do(ctx context.Context) error {
 	return nil
 }
 
-func SeededState(goal aksmachine.GoalState) *State {
+func SeededState(goal aksmachine.GoalState, instance config.Instance) *State {
 	return &State{
 		AppliedSettingsVersion:   goal.SettingsVersion,
 		AppliedKubernetesVersion: goal.KubernetesVersion,
-		ActiveMachine:            goalstates.NSpawnMachineKube1,
+		ActiveMachine:            instance.Machines()[0],
+		AppliedGoal:              &goal,
 	}
 }
 
-func validActiveMachine(machine string) bool {
-	return machine == goalstates.NSpawnMachineKube1 || machine == goalstates.NSpawnMachineKube2
+// Bootstrapped reports whether the instance has been bootstrapped: its
+// daemon state records an active machine.
+func Bootstrapped(ctx context.Context, instance config.Instance) (bool, error) {
+	store, err := NewFileStateStore(instance)
+	if err != nil {
+		return false, err
+	}
+	state, err := store.Load(ctx)
+	if err != nil {
+		return false, err
+	}
+	return state != nil && state.ActiveMachine != "", nil
+}
+
+func validActiveMachine(instance config.Instance, machine string) bool {
+	machines := instance.Machines()
+	return machine == machines[0] || machine == machines[1]
 }
 
-func activeMachineFromStore(ctx context.Context, store stateStore) (*activeMachine, error) {
+func activeMachineFromStore(ctx context.Context, store stateStore, instance config.Instance) (*activeMachine, error) {
 	state, err := store.Load(ctx)
 	if err != nil {
 		return nil, err
@@ -77,7 +99,7 @@ func activeMachineFromStore(ctx context.Context, store stateStore) (*activeMachi
 	if state == nil {
 		return nil, fmt.Errorf("daemon state is missing active machine")
 	}
-	if !validActiveMachine(state.ActiveMachine) {
+	if !validActiveMachine(instance, state.ActiveMachine) {
 		return nil, fmt.Errorf("daemon state active machine %q is invalid", state.ActiveMachine)
 	}
 	return &activeMachine{Name: state.ActiveMachine, State: state}, nil
@@ -89,8 +111,9 @@ type stateStore interface {
 	Delete(ctx context.Context) error
 }
 
-func NewFileStateStore() (stateStore, error) {
-	return newFileStateStore("")
+// NewFileStateStore returns the store under the instance's state root.
+func NewFileStateStore(instance config.Instance) (stateStore, error) {
+	return newFileStateStore(filepath.Join(instance.StateDir(), stateFileName))
 }
 
 type fileStateStore struct {
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/config"
 )
 
 func TestFileStateStoreSaveLoad(t *testing.T) {
@@ -119,7 +120,7 @@ func TestFileStateStoreDelete(t *testing.T) {
 func TestSeededState(t *testing.T) {
 	t.Parallel()
 
-	state := SeededState(aksmachine.GoalState{KubernetesVersion: "1.34.0", SettingsVersion: "42"})
+	state := SeededState(aksmachine.GoalState{KubernetesVersion: "1.34.0", SettingsVersion: "42"}, "")
 	if state.AppliedSettingsVersion != "42" {
 		t.Fatalf("AppliedSettingsVersion = %q, want 42", state.AppliedSettingsVersion)
 	}
@@ -132,6 +133,9 @@ func TestSeededState(t *testing.T) {
 	if state.PreviousSettingsVersion != "" || state.PreviousKubernetesVersion != "" {
 		t.Fatalf("previous state = %#v, want empty", state)
 	}
+	if named := SeededState(aksmachine.GoalState{}, "gpu0"); named.ActiveMachine != "kube1-gpu0" {
+		t.Fatalf("named instance ActiveMachine = %q, want kube1-gpu0", named.ActiveMachine)
+	}
 }
 
 func TestSaveStateValidation(t *testing.T) {
@@ -156,9 +160,10 @@ func TestActiveMachineFromStore(t *testing.T) {
 	t.Parallel()
 
 	tests := map[string]struct {
-		state   *State
-		want    string
-		wantErr bool
+		state    *State
+		instance config.Instance
+		want     string
+		wantErr  bool
 	}{
 		"kube1": {
 			state: &State{ActiveMachine: "kube1"},
@@ -168,6 +173,16 @@ func TestActiveMachineFromStore(t *testing.T) {
 			state: &State{ActiveMachine: "kube2"},
 			want:  "kube2",
 		},
+		"named instance": {
+			state:    &State{ActiveMachine: "kube2-gpu0"},
+			instance: "gpu0",
+			want:     "kube2-gpu0",
+		},
+		"other instance's machine": {
+			state:    &State{ActiveMachine: "kube1"},
+			instance: "gpu0",
+			wantErr:  true,
+		},
 		"missing state": {
 			wantErr: true,
 		},
@@ -181,7 +196,7 @@ func TestActiveMachineFromStore(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			got, err := activeMachineFromStore(t.Context(), &testStateStore{state: tt.state})
+			got, err := activeMachineFromStore(t.Context(), &testStateStore{state: tt.state}, tt.instance)
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("activeMachineFromStore error = nil, want error")
@@ -0,0 +1,181 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/utils/ptr"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// metricPrefix selects the agent's own metrics from the registry, which
+	// also holds controller-runtime's and the Go runtime's.
+	metricPrefix = "aks_flex_node_"
+
+	// textfileInstanceLabel tells the metrics of named instances apart in the
+	// node_exporter output, which merges every file in the directory.
+	textfileInstanceLabel = "flex_instance"
+
+	bootstrapComplete = "complete"
+	bootstrapDeferred = "deferred"
+	bootstrapPending  = "pending"
+)
+
+var bootstrapStates = []string{bootstrapComplete, bootstrapDeferred, bootstrapPending}
+
+var (
+	bootstrapStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_bootstrap_state",
+		Help: "Whether the node's bootstrap is complete, deferred until the network is up, or pending (1 for the current state).",
+	}, []string{"state"})
+
+	generationInfoGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_generation_info",
+		Help: "The applied generation: its machine, settings version, and Kubernetes version. Always 1.",
+	}, []string{"machine", "settings_version", "kubernetes_version"})
+
+	unitActiveGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_unit_active",
+		Help: "Whether each kubelet and containerd unit in the active machine is active (1) or not (0).",
+	}, []string{"unit"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(bootstrapStateGauge, generationInfoGauge, unitActiveGauge)
+}
+
+// nodeStatusExporter refreshes the node status gauges on every cycle and,
+// with agent.metricsTextfile.directory set, writes the agent's metrics to a
+// file there for the node_exporter textfile collector. It implements
+// manager.Runnable.
+type nodeStatusExporter struct {
+	log      *slog.Logger
+	state    stateStore
+	deferred *DeferredBootstrap
+	units    func(ctx context.Context, machine string) (map[string]bool, error)
+	gatherer prometheus.Gatherer
+	instance config.Instance
+	// path is the metrics file; empty writes none.
+	path     string
+	interval time.Duration
+}
+
+func newNodeStatusExporter(log *slog.Logger, cfg *config.Config, state stateStore) *nodeStatusExporter {
+	e := &nodeStatusExporter{
+		log:      log,
+		state:    state,
+		deferred: NewDeferredBootstrap(cfg.Instance),
+		units: func(ctx context.Context, machine string) (map[string]bool, error) {
+			return generationUnitStates(ctx, log, machine)
+		},
+		gatherer: ctrlmetrics.Registry,
+		instance: cfg.Instance,
+		interval: time.Duration(cfg.Agent.MetricsTextfile.Interval),
+	}
+	if textfile := cfg.Agent.MetricsTextfile; textfile.Enabled() {
+		// node_exporter only reads files ending in .prom.
+		e.path = filepath.Join(textfile.Directory, strings.TrimSuffix(cfg.Instance.ServiceUnitName(), ".service")+".prom")
+	}
+	return e
+}
+
+// NeedLeaderElection reports false: every daemon exports its own node.
+func (e *nodeStatusExporter) NeedLeaderElection() bool { return false }
+
+func (e *nodeStatusExporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		e.publish(ctx)
+		if e.path != "" {
+			if err := e.writeTextfile(); err != nil {
+				e.log.Warn("failed to write the node_exporter metrics file", "path", e.path, "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish sets the bootstrap, generation, and unit health gauges from the
+// daemon state and the active machine.
+func (e *nodeStatusExporter) publish(ctx context.Context) {
+	deferred, err := e.deferred.Pending()
+	if err != nil {
+		e.log.Warn("failed to check for a deferred bootstrap", "error", err)
+	}
+	state, err := e.state.Load(ctx)
+	if err != nil {
+		e.log.Warn("failed to load daemon state for metrics", "error", err)
+		return
+	}
+	bootstrap := bootstrapComplete
+	switch {
+	case deferred:
+		bootstrap = bootstrapDeferred
+	case state == nil || state.ActiveMachine == "":
+		bootstrap = bootstrapPending
+	}
+	for _, s := range bootstrapStates {
+		bootstrapStateGauge.WithLabelValues(s).Set(0)
+	}
+	bootstrapStateGauge.WithLabelValues(bootstrap).Set(1)
+
+	generationInfoGauge.Reset()
+	unitActiveGauge.Reset()
+	if bootstrap != bootstrapComplete {
+		return
+	}
+	generationInfoGauge.WithLabelValues(state.ActiveMachine, state.AppliedSettingsVersion, state.AppliedKubernetesVersion).Set(1)
+	active, err := e.units(ctx, state.ActiveMachine)
+	if err != nil {
+		// A machine that is not running has no active units.
+		e.log.Debug("failed to check machine units for metrics", "machine", state.ActiveMachine, "error", err)
+	}
+	for _, unit := range generationUnits {
+		value := 0.0
+		if active[unit] {
+			value = 1
+		}
+		unitActiveGauge.WithLabelValues(unit).Set(value)
+	}
+}
+
+// writeTextfile replaces the metrics file atomically, so the collector never
+// reads a partly written one.
+func (e *nodeStatusExporter) writeTextfile() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+	var buf bytes.Buffer
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), metricPrefix) {
+			continue
+		}
+		if e.instance != "" {
+			for _, metric := range family.Metric {
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: ptr.To(textfileInstanceLabel), Value: ptr.To(string(e.instance))})
+			}
+		}
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			return fmt.Errorf("encode %s: %w", family.GetName(), err)
+		}
+	}
+	return utilio.WriteFile(e.path, buf.Bytes(), 0o644) //nolint:gosec // node_exporter runs as its own user
+}
@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestNodeStatusExporterTextfile(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(bootstrapStateGauge, generationInfoGauge, unitActiveGauge, prometheus.NewGauge(prometheus.GaugeOpts{Name: "workqueue_depth"}))
+	dir := t.TempDir()
+	cfg := &config.Config{Instance: "edge"}
+	cfg.Agent.MetricsTextfile = config.MetricsTextfileConfig{Directory: dir}
+	exporter := newNodeStatusExporter(slog.New(slog.DiscardHandler), cfg, &testStateStore{state: &State{
+		ActiveMachine:            "kube1-edge",
+		AppliedSettingsVersion:   "v7",
+		AppliedKubernetesVersion: "1.34.3",
+	}})
+	exporter.deferred = &DeferredBootstrap{path: filepath.Join(t.TempDir(), deferredBootstrapFileName)}
+	exporter.gatherer = registry
+	exporter.units = func(context.Context, string) (map[string]bool, error) {
+		return map[string]bool{"containerd.service": true}, nil
+	}
+
+	exporter.publish(t.Context())
+	if err := exporter.writeTextfile(); err != nil {
+		t.Fatalf("writeTextfile: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "aks-flex-node-agent-edge.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		`aks_flex_node_bootstrap_state{state="complete",flex_instance="edge"} 1`,
+		`aks_flex_node_bootstrap_state{state="deferred",flex_instance="edge"} 0`,
+		`aks_flex_node_generation_info{kubernetes_version="1.34.3",machine="kube1-edge",settings_version="v7",flex_instance="edge"} 1`,
+		`aks_flex_node_unit_active{unit="containerd.service",flex_instance="edge"} 1`,
+		`aks_flex_node_unit_active{unit="kubelet.service",flex_instance="edge"} 0`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics file is missing %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "workqueue_depth") {
+		t.Errorf("metrics file has metrics that are not the agent's:\n%s", got)
+	}
+
+	// A machine that is not running reports every unit inactive.
+	exporter.units = func(context.Context, string) (map[string]bool, error) {
+		return nil, errors.New("machine kube1-edge is not running")
+	}
+	exporter.publish(t.Context())
+	if err := exporter.writeTextfile(); err != nil {
+		t.Fatalf("writeTextfile: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "aks-flex-node-agent-edge.prom")); !strings.Contains(string(data), `aks_flex_node_unit_active{unit="containerd.service",flex_instance="edge"} 0`) {
+		t.Errorf("metrics file after the machine stopped:\n%s", data)
+	}
+}
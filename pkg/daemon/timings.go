@@ -0,0 +1,215 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const timingsFileName = "bootstrap-timings.json"
+
+const (
+	TimingOperationBootstrap = "bootstrap"
+	TimingOperationRepave    = "repave"
+
+	StepOutcomeSucceeded = "succeeded"
+	StepOutcomeFailed    = "failed"
+	// OperationOutcomeUpToDate marks a goal state apply that found the
+	// machine already running it and changed nothing.
+	OperationOutcomeUpToDate = "up-to-date"
+)
+
+// StepTiming is the recorded outcome of one bootstrap step. Attempts counts how
+// many times a step with the same name ran within one operation, which is how
+// retried steps show up.
+type StepTiming struct {
+	Name      string              `json:"name"`
+	StartedAt time.Time           `json:"startedAt"`
+	Duration  config.JSONDuration `json:"duration"`
+	Attempts  int                 `json:"attempts"`
+	Outcome   string              `json:"outcome"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// OperationTimings is the per-step breakdown of a bootstrap or repave.
+type OperationTimings struct {
+	Operation string              `json:"operation"`
+	Machine   string              `json:"machine,omitempty"`
+	StartedAt time.Time           `json:"startedAt"`
+	Duration  config.JSONDuration `json:"duration"`
+	Outcome   string              `json:"outcome"`
+	Steps     []StepTiming        `json:"steps"`
+}
+
+// StepTimings collects per-step durations while tasks run. A nil *StepTimings
+// is valid and records nothing, so callers that do not care about timings can
+// pass nil through the bootstrap task builders.
+type StepTimings struct {
+	now      func() time.Time
+	progress *progress.Tracker
+
+	mu      sync.Mutex
+	record  OperationTimings
+	indexes map[string]int
+	// started keeps the monotonic clock reading that record.StartedAt,
+	// converted to UTC, drops.
+	started time.Time
+}
+
+// NewStepTimings starts a timing record for operation on machine.
+func NewStepTimings(operation, machine string) *StepTimings {
+	t := &StepTimings{now: time.Now, progress: progress.NewTracker(operation, machine), indexes: map[string]int{}}
+	t.started = t.now()
+	t.record = OperationTimings{Operation: operation, Machine: machine, StartedAt: t.started.UTC()}
+	return t
+}
+
+// Progress returns the tracker of the steps that are running now.
+func (t *StepTimings) Progress() *progress.Tracker {
+	if t == nil {
+		return nil
+	}
+	return t.progress
+}
+
+// Track wraps task so its duration and outcome are recorded.
+func (t *StepTimings) Track(task phases.Task) phases.Task {
+	if t == nil {
+		return task
+	}
+	return &timedTask{task: task, timings: t}
+}
+
+// Finish closes the record with the overall outcome and returns a copy.
+func (t *StepTimings) Finish(err error) OperationTimings {
+	if t == nil {
+		return OperationTimings{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.record.Duration = config.JSONDuration(t.now().Sub(t.started))
+	t.record.Outcome = outcome(err)
+	out := t.record
+	out.Steps = append([]StepTiming(nil), t.record.Steps...)
+	return out
+}
+
+func (t *StepTimings) observe(name string, start time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	step := StepTiming{
+		Name:      name,
+		StartedAt: start.UTC(),
+		Duration:  config.JSONDuration(t.now().Sub(start)),
+		Attempts:  1,
+		Outcome:   outcome(err),
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	if i, ok := t.indexes[name]; ok {
+		step.Attempts = t.record.Steps[i].Attempts + 1
+		t.record.Steps[i] = step
+		return
+	}
+	t.indexes[name] = len(t.record.Steps)
+	t.record.Steps = append(t.record.Steps, step)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return StepOutcomeFailed
+	}
+	return StepOutcomeSucceeded
+}
+
+type timedTask struct {
+	task    phases.Task
+	timings *StepTimings
+}
+
+func (t *timedTask) Name() string { return t.task.Name() }
+
+func (t *timedTask) Do(ctx context.Context) error {
+	start := t.timings.now()
+	counter := t.timings.progress.Begin(t.task.Name())
+	err := t.task.Do(progress.WithCounter(ctx, counter))
+	counter.End()
+	t.timings.observe(t.task.Name(), start, err)
+	return err
+}
+
+// WriteTimings renders timings as an aligned table for CLI output.
+func WriteTimings(w io.Writer, timings OperationTimings) error {
+	if _, err := fmt.Fprintf(w, "%s step timings (%s, %s):\n", timings.Operation, time.Duration(timings.Duration), timings.Outcome); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "  STEP\tDURATION\tATTEMPTS\tOUTCOME"); err != nil {
+		return err
+	}
+	for _, step := range timings.Steps {
+		if _, err := fmt.Fprintf(tw, "  %s\t%s\t%d\t%s\n", step.Name, time.Duration(step.Duration).Round(time.Millisecond), step.Attempts, step.Outcome); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// TimingsStore persists the most recent operation timings next to the daemon
+// state so later runs and the daemon can report them.
+type TimingsStore struct {
+	path string
+}
+
+// NewTimingsStore returns a store under the instance's state root.
+func NewTimingsStore(instance config.Instance) *TimingsStore {
+	return newTimingsStore(filepath.Join(instance.StateDir(), timingsFileName))
+}
+
+func newTimingsStore(path string) *TimingsStore {
+	if path == "" {
+		path = filepath.Join(config.ConfigDir, timingsFileName)
+	}
+	return &TimingsStore{path: path}
+}
+
+// Load returns the persisted timings, or nil when none were recorded.
+func (s *TimingsStore) Load() (*OperationTimings, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read bootstrap timings %s: %w", s.path, err)
+	}
+	var timings OperationTimings
+	if err := json.Unmarshal(data, &timings); err != nil {
+		return nil, fmt.Errorf("decode bootstrap timings %s: %w", s.path, err)
+	}
+	return &timings, nil
+}
+
+// Save overwrites the persisted timings.
+func (s *TimingsStore) Save(timings OperationTimings) error {
+	data, err := json.MarshalIndent(timings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal bootstrap timings: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write bootstrap timings %s: %w", s.path, err)
+	}
+	return nil
+}
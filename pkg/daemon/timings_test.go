@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeTask struct {
+	name string
+	errs []error
+}
+
+func (f *fakeTask) Name() string { return f.name }
+
+func (f *fakeTask) Do(context.Context) error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func fixedClock(step time.Duration) func() time.Time {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestStepTimingsTrack(t *testing.T) {
+	t.Parallel()
+
+	timings := NewStepTimings(TimingOperationBootstrap, "kube1")
+	timings.now = fixedClock(time.Second)
+
+	flaky := &fakeTask{name: "flaky", errs: []error{errors.New("transient")}}
+	ok := timings.Track(&fakeTask{name: "ok"})
+	retried := timings.Track(flaky)
+
+	if err := ok.Do(t.Context()); err != nil {
+		t.Fatalf("ok.Do: %v", err)
+	}
+	if err := retried.Do(t.Context()); err == nil {
+		t.Fatal("retried.Do first attempt: want error")
+	}
+	if err := retried.Do(t.Context()); err != nil {
+		t.Fatalf("retried.Do second attempt: %v", err)
+	}
+	if ok.Name() != "ok" {
+		t.Fatalf("Name() = %q, want ok", ok.Name())
+	}
+
+	got := timings.Finish(nil)
+	if got.Operation != TimingOperationBootstrap || got.Machine != "kube1" || got.Outcome != StepOutcomeSucceeded {
+		t.Fatalf("record = %+v", got)
+	}
+	if len(got.Steps) != 2 {
+		t.Fatalf("steps = %+v, want 2", got.Steps)
+	}
+	if s := got.Steps[0]; s.Name != "ok" || s.Attempts != 1 || s.Outcome != StepOutcomeSucceeded || time.Duration(s.Duration) != time.Second {
+		t.Fatalf("steps[0] = %+v", s)
+	}
+	if s := got.Steps[1]; s.Name != "flaky" || s.Attempts != 2 || s.Outcome != StepOutcomeSucceeded || s.Error != "" {
+		t.Fatalf("steps[1] = %+v", s)
+	}
+}
+
+func TestStepTimingsNilIsNoop(t *testing.T) {
+	t.Parallel()
+
+	var timings *StepTimings
+	task := &fakeTask{name: "task"}
+	if got := timings.Track(task); got != task {
+		t.Fatalf("Track on nil = %T, want original task", got)
+	}
+	if got := timings.Finish(errors.New("boom")); got.Operation != "" || len(got.Steps) != 0 {
+		t.Fatalf("Finish on nil = %+v, want zero", got)
+	}
+}
+
+func TestTimingsStoreRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	store := newTimingsStore(filepath.Join(t.TempDir(), timingsFileName))
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load missing: %v", err)
+	}
+	if loaded != nil {
+		t.Fatalf("Load missing = %+v, want nil", loaded)
+	}
+
+	timings := NewStepTimings(TimingOperationRepave, "kube2")
+	timings.now = fixedClock(time.Minute)
+	_ = timings.Track(&fakeTask{name: "start-node", errs: []error{errors.New("kubelet not ready")}}).Do(t.Context())
+	want := timings.Finish(errors.New("kubelet not ready"))
+
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Outcome != StepOutcomeFailed || len(loaded.Steps) != 1 || loaded.Steps[0].Error != "kubelet not ready" || loaded.Duration != want.Duration {
+		t.Fatalf("Load = %+v, want %+v", loaded, want)
+	}
+}
+
+func TestWriteTimings(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	err := WriteTimings(&buf, OperationTimings{
+		Operation: TimingOperationBootstrap,
+		Outcome:   StepOutcomeSucceeded,
+		Steps: []StepTiming{
+			{Name: "install-packages", Attempts: 1, Outcome: StepOutcomeSucceeded},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteTimings: %v", err)
+	}
+	for _, want := range []string{"bootstrap step timings", "STEP", "install-packages"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("output = %q, want %q", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const tokenRefreshInterval = time.Minute
+
+// azureTokens renews cached Azure tokens; it is implemented by
+// *tokencache.Cache.
+type azureTokens interface {
+	Refresh(ctx context.Context) error
+}
+
+// tokenRefresher renews the Azure tokens in the agent's token cache once
+// they pass their refresh point, so a component that needs one finds it
+// current instead of acquiring it mid-operation. It implements
+// manager.Runnable.
+type tokenRefresher struct {
+	log      *slog.Logger
+	tokens   azureTokens
+	interval time.Duration
+	wakeups  chan struct{}
+}
+
+func newTokenRefresher(log *slog.Logger, tokens azureTokens) *tokenRefresher {
+	return &tokenRefresher{
+		log:      log,
+		tokens:   tokens,
+		interval: tokenRefreshInterval,
+		wakeups:  make(chan struct{}, 1),
+	}
+}
+
+// NeedLeaderElection reports false: the tokens belong to the local agent.
+func (r *tokenRefresher) NeedLeaderElection() bool { return false }
+
+func (r *tokenRefresher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-r.wakeups:
+		}
+		// A failed renewal keeps the cached token until it expires and is
+		// retried on the next tick.
+		if err := r.tokens.Refresh(ctx); err != nil {
+			r.log.Warn("failed to renew Azure tokens", "error", err)
+		}
+	}
+}
+
+// wake requests an immediate renewal, for example after the host resumed
+// with tokens that expired while it was suspended.
+func (r *tokenRefresher) wake() {
+	select {
+	case r.wakeups <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+)
+
+const (
+	topologyLabelInterval = 10 * time.Minute
+
+	// imdsComputeURL is the Azure instance metadata service's compute
+	// metadata, reachable from Azure VMs only.
+	imdsComputeURL = "http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01"
+)
+
+// ResolveVMTopology reads the region and zone topology.fromIMDS asks for
+// from the Azure instance metadata service, unless an earlier answer is
+// recorded, and adds them to the node labels of cfg.
+func ResolveVMTopology(ctx context.Context, cfg *config.Config) error {
+	return cfg.ResolveVMTopology(ctx, fetchVMTopology(imdsComputeURL))
+}
+
+// fetchVMTopology returns a query of the metadata service at url.
+func fetchVMTopology(url string) func(context.Context) (*config.VMTopology, error) {
+	return func(ctx context.Context) (*config.VMTopology, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata", "true")
+		// The metadata service is link-local and never behind a proxy.
+		resp, err := httpclient.New("imds", httpclient.KindRequest, httpclient.WithoutProxy()).Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("query the Azure instance metadata service, which only Azure VMs have: %w", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck // response body
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("query the Azure instance metadata service: %s", resp.Status)
+		}
+		vm := &config.VMTopology{}
+		if err := json.NewDecoder(resp.Body).Decode(vm); err != nil {
+			return nil, fmt.Errorf("decode instance metadata: %w", err)
+		}
+		return vm, nil
+	}
+}
+
+// topologyLabeler keeps the topology labels of the config on the Node after
+// registration, so a label removed or changed by hand, or a region or site
+// changed in the config, is corrected. It implements manager.Runnable.
+type topologyLabeler struct {
+	log      *slog.Logger
+	labels   map[string]string
+	reader   client.Reader
+	client   client.Client
+	nodeName string
+	interval time.Duration
+}
+
+func newTopologyLabeler(log *slog.Logger, cfg *config.Config, reader client.Reader, c client.Client, nodeName string) *topologyLabeler {
+	return &topologyLabeler{
+		log:      log,
+		labels:   cfg.Topology.NodeLabels(),
+		reader:   reader,
+		client:   c,
+		nodeName: nodeName,
+		interval: topologyLabelInterval,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon labels its own node.
+func (l *topologyLabeler) NeedLeaderElection() bool { return false }
+
+func (l *topologyLabeler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		if err := l.syncLabels(ctx); err != nil && ctx.Err() == nil {
+			l.log.Warn("failed to sync topology node labels", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncLabels sets the topology labels of the config on the Node and removes
+// the site label when the config no longer sets one. The region and zone
+// labels are left alone when unset, since the cloud provider may own them.
+func (l *topologyLabeler) syncLabels(ctx context.Context) error {
+	node := &corev1.Node{}
+	if err := l.reader.Get(ctx, client.ObjectKey{Name: l.nodeName}, node); err != nil {
+		return fmt.Errorf("get node %s: %w", l.nodeName, err)
+	}
+	labels := maps.Clone(node.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if _, ok := l.labels[config.TopologySiteLabel]; !ok {
+		delete(labels, config.TopologySiteLabel)
+	}
+	maps.Copy(labels, l.labels)
+	if maps.Equal(labels, node.Labels) {
+		return nil
+	}
+	patched := node.DeepCopy()
+	patched.Labels = labels
+	if err := l.client.Patch(ctx, patched, client.MergeFromWithOptions(node, client.MergeFromWithOptimisticLock{})); err != nil {
+		return fmt.Errorf("patch labels of node %s: %w", l.nodeName, err)
+	}
+	l.log.Info("updated topology node labels", "labels", l.labels)
+	return nil
+}
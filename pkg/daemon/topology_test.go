@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestTopologyLabelerSyncLabels(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{
+		"env":                      "prod",
+		config.TopologyRegionLabel: "westus2",
+		config.TopologySiteLabel:   "store-7",
+	}}}
+	kubeClient := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(node).Build()
+	l := &topologyLabeler{
+		log:      slog.New(slog.DiscardHandler),
+		labels:   config.TopologyConfig{Region: "eastus", Zone: "eastus-2"}.NodeLabels(),
+		reader:   kubeClient,
+		client:   kubeClient,
+		nodeName: "node1",
+	}
+	if err := l.syncLabels(t.Context()); err != nil {
+		t.Fatalf("syncLabels() error = %v", err)
+	}
+
+	got := &corev1.Node{}
+	if err := kubeClient.Get(t.Context(), client.ObjectKey{Name: "node1"}, got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"env":                      "prod",
+		config.TopologyRegionLabel: "eastus",
+		config.TopologyZoneLabel:   "eastus-2",
+	}
+	if !maps.Equal(got.Labels, want) {
+		t.Errorf("labels = %v, want %v", got.Labels, want)
+	}
+}
+
+func TestFetchVMTopology(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			http.Error(w, "missing Metadata header", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"location":"eastus2","zone":"3","vmSize":"Standard_D4s_v5"}`))
+	}))
+	defer srv.Close()
+
+	vm, err := fetchVMTopology(srv.URL)(t.Context())
+	if err != nil {
+		t.Fatalf("fetchVMTopology() = %v", err)
+	}
+	if vm.Location != "eastus2" || vm.Zone != "3" {
+		t.Fatalf("fetchVMTopology() = %+v, want eastus2 zone 3", vm)
+	}
+
+	srv.Close()
+	if _, err := fetchVMTopology(srv.URL)(t.Context()); err == nil {
+		t.Fatal("fetchVMTopology() of an unreachable service = nil, want error")
+	}
+}
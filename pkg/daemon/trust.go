@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/trust"
+)
+
+var trustedCAExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aks_flex_node_trusted_ca_expiry_timestamp_seconds",
+	Help: "Expiry of each CA certificate distributed into the active machine, as a Unix timestamp.",
+}, []string{"bundle", "subject"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(trustedCAExpiry)
+}
+
+// trustMonitor re-syncs the configured CA bundles into the active machine,
+// so a CA rotated in Key Vault reaches the running node, and warns about
+// distributed CAs close to expiry. It implements manager.Runnable.
+type trustMonitor struct {
+	log          *slog.Logger
+	state        stateStore
+	interval     time.Duration
+	warning      time.Duration
+	machinesDir  string
+	sync         func(ctx context.Context, machineDir string) (bool, error)
+	certificates func(machineDir string) ([]trust.Certificate, error)
+	now          func() time.Time
+
+	mu   sync.Mutex
+	last []trust.Certificate
+}
+
+func newTrustMonitor(log *slog.Logger, cfg *config.Config, state stateStore) *trustMonitor {
+	return &trustMonitor{
+		log:          log,
+		state:        state,
+		interval:     time.Duration(cfg.Trust.SyncInterval),
+		warning:      time.Duration(cfg.Trust.ExpiryWarning),
+		machinesDir:  machinesDir,
+		sync:         trust.NewDistributor(log, cfg).Sync,
+		certificates: trust.Certificates,
+		now:          time.Now,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon manages its own machine.
+func (m *trustMonitor) NeedLeaderElection() bool { return false }
+
+func (m *trustMonitor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the certificates found by the latest check, or nil before it.
+func (m *trustMonitor) Last() []trust.Certificate {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+func (m *trustMonitor) run(ctx context.Context) {
+	state, err := m.state.Load(ctx)
+	if err != nil || state == nil || state.ActiveMachine == "" {
+		return
+	}
+	machineDir := filepath.Join(m.machinesDir, state.ActiveMachine)
+	if _, err := m.sync(ctx, machineDir); err != nil {
+		m.log.Warn("failed to sync trusted CA bundles", "machine", state.ActiveMachine, "error", err)
+	}
+	certs, err := m.certificates(machineDir)
+	if err != nil {
+		m.log.Warn("failed to read distributed CA certificates", "machine", state.ActiveMachine, "error", err)
+		return
+	}
+
+	trustedCAExpiry.Reset()
+	now := m.now()
+	for _, cert := range certs {
+		trustedCAExpiry.WithLabelValues(cert.Bundle, cert.Subject).Set(float64(cert.NotAfter.Unix()))
+		switch remaining := cert.NotAfter.Sub(now); {
+		case remaining <= 0:
+			m.log.Error("distributed CA certificate has expired", "bundle", cert.Bundle, "subject", cert.Subject, "notAfter", cert.NotAfter)
+		case remaining <= m.warning:
+			m.log.Warn("distributed CA certificate expires soon", "bundle", cert.Bundle, "subject", cert.Subject, "notAfter", cert.NotAfter)
+		}
+	}
+	m.mu.Lock()
+	m.last = certs
+	m.mu.Unlock()
+}
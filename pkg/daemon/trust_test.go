@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/trust"
+)
+
+func TestTrustMonitorRun(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	var synced string
+	monitor := &trustMonitor{
+		log:         slog.New(slog.DiscardHandler),
+		state:       &testStateStore{state: &State{ActiveMachine: "kube2"}},
+		warning:     30 * 24 * time.Hour,
+		machinesDir: "/var/lib/machines",
+		sync: func(_ context.Context, machineDir string) (bool, error) {
+			synced = machineDir
+			return false, errors.New("key vault unreachable")
+		},
+		certificates: func(string) ([]trust.Certificate, error) {
+			return []trust.Certificate{{Bundle: "corp", Subject: "CN=Corp Root", NotAfter: now.Add(7 * 24 * time.Hour)}}, nil
+		},
+		now: func() time.Time { return now },
+	}
+
+	monitor.run(t.Context())
+	if synced != filepath.Join("/var/lib/machines", "kube2") {
+		t.Errorf("synced %q, want the active machine", synced)
+	}
+	if last := monitor.Last(); len(last) != 1 || last[0].Bundle != "corp" {
+		t.Errorf("Last() = %+v, want the certificates even when the sync failed", last)
+	}
+	var nilMonitor *trustMonitor
+	if nilMonitor.Last() != nil {
+		t.Error("nil monitor reported certificates")
+	}
+}
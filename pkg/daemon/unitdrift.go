@@ -0,0 +1,205 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/manifest"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+var unitDriftGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "aks_flex_node_unit_drift_files",
+	Help: "Number of kubelet and containerd unit files in the active machine changed outside the agent.",
+})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(unitDriftGauge)
+}
+
+// machineUnitsFunc returns the files systemd in a running machine loaded its
+// managed units from.
+type machineUnitsFunc func(ctx context.Context, machine string) ([]manifest.Unit, error)
+
+// queryMachineUnits asks systemd inside the machine for the unit files and
+// drop-ins of the units the agent manages there.
+func queryMachineUnits(log *slog.Logger) machineUnitsFunc {
+	return func(ctx context.Context, machine string) ([]manifest.Unit, error) {
+		files, err := utilexec.GetMachineUnitFiles(ctx, log, machine, generationUnits...)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]manifest.Unit, 0, len(generationUnits))
+		for _, name := range generationUnits {
+			units = append(units, manifest.Unit{Name: name, FragmentPath: files[name].FragmentPath, DropInPaths: files[name].DropInPaths})
+		}
+		return units, nil
+	}
+}
+
+// recordUnits returns the machine's units with the content hashes of their
+// files, as the baseline unit drift is measured against.
+func recordUnits(ctx context.Context, query machineUnitsFunc, machine, machineDir string) ([]manifest.Unit, error) {
+	units, err := query(ctx, machine)
+	if err != nil {
+		return nil, err
+	}
+	if err := manifest.HashUnits(machineDir, units); err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// verifyUnits compares the machine's units with the baseline in m. Manifests
+// recorded without units are not checked.
+func verifyUnits(ctx context.Context, manifests *ManifestStore, m *manifest.Manifest) ([]manifest.Mismatch, error) {
+	if len(m.Units) == 0 || manifests.units == nil {
+		return nil, nil
+	}
+	units, err := manifests.units(ctx, m.Machine)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.VerifyUnits(m.MachineDir, m.Units, units), nil
+}
+
+// AcceptUnitDrift records the units of the instance's active machine as they
+// are now loaded, so drop-ins and unit file edits made outside the agent stop
+// being reported. It returns the drift it accepted.
+func AcceptUnitDrift(ctx context.Context, instance config.Instance) ([]manifest.Mismatch, error) {
+	state, err := NewFileStateStore(instance)
+	if err != nil {
+		return nil, err
+	}
+	return acceptUnitDrift(ctx, state, NewManifestStore(instance), instance)
+}
+
+func acceptUnitDrift(ctx context.Context, state stateStore, manifests *ManifestStore, instance config.Instance) ([]manifest.Mismatch, error) {
+	m, err := loadActiveManifest(ctx, state, manifests, instance)
+	if err != nil {
+		return nil, err
+	}
+	drift, err := verifyUnits(ctx, manifests, m)
+	if err != nil {
+		return nil, err
+	}
+	if m.Units, err = recordUnits(ctx, manifests.units, m.Machine, m.MachineDir); err != nil {
+		return nil, fmt.Errorf("record units of %s: %w", m.Machine, err)
+	}
+	return drift, manifests.Save(m)
+}
+
+type refreshUnitHashesTask struct {
+	log       *slog.Logger
+	manifests *ManifestStore
+	machine   string
+}
+
+// refreshUnitHashes returns a task that re-hashes the recorded unit files of
+// machine after the node start rewrote them, which it does from the current
+// config on every machine restart.
+func refreshUnitHashes(log *slog.Logger, instance config.Instance, machine string) phases.Task {
+	return &refreshUnitHashesTask{log: log, manifests: NewManifestStore(instance), machine: machine}
+}
+
+func (t *refreshUnitHashesTask) Name() string { return "refresh-unit-hashes" }
+
+func (t *refreshUnitHashesTask) Do(context.Context) error {
+	m, err := t.manifests.Load()
+	if err != nil || m == nil || m.Machine != t.machine || len(m.Units) == 0 {
+		if err != nil {
+			t.log.Warn("failed to load the machine manifest to refresh unit hashes", "error", err)
+		}
+		return nil
+	}
+	manifest.RefreshUnitHashes(m.MachineDir, m.Units)
+	return t.manifests.Save(m)
+}
+
+// unitDriftWatchdog periodically compares the kubelet and containerd units
+// of the active machine with the baseline recorded at bootstrap or repave,
+// and flags drop-ins and unit file edits made outside the agent on the Node.
+// It implements manager.Runnable.
+type unitDriftWatchdog struct {
+	log       *slog.Logger
+	state     stateStore
+	manifests *ManifestStore
+	instance  config.Instance
+	recorder  *nodeRecorder
+	interval  time.Duration
+
+	mu   sync.Mutex
+	last []manifest.Mismatch
+}
+
+func newUnitDriftWatchdog(log *slog.Logger, cfg *config.Config, state stateStore, manifests *ManifestStore, recorder *nodeRecorder) *unitDriftWatchdog {
+	return &unitDriftWatchdog{
+		log:       log,
+		state:     state,
+		manifests: manifests,
+		instance:  cfg.Instance,
+		recorder:  recorder,
+		interval:  time.Duration(cfg.Agent.UnitDrift.Interval),
+	}
+}
+
+// NeedLeaderElection reports false: every daemon watches its own machine.
+func (w *unitDriftWatchdog) NeedLeaderElection() bool { return false }
+
+func (w *unitDriftWatchdog) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *unitDriftWatchdog) check(ctx context.Context) {
+	m, err := loadActiveManifest(ctx, w.state, w.manifests, w.instance)
+	if err != nil {
+		w.log.Debug("no machine manifest to check units against", "error", err)
+		return
+	}
+	drift, err := verifyUnits(ctx, w.manifests, m)
+	if err != nil {
+		w.log.Warn("failed to check the machine's units for drift", "machine", m.Machine, "error", err)
+		return
+	}
+	unitDriftGauge.Set(float64(len(drift)))
+
+	w.mu.Lock()
+	changed := !slices.Equal(w.last, drift)
+	w.last = drift
+	w.mu.Unlock()
+	if !changed {
+		return
+	}
+	if len(drift) == 0 {
+		w.log.Info("machine units match the recorded baseline again", "machine", m.Machine)
+		return
+	}
+	problems := make([]string, 0, len(drift))
+	for _, d := range drift {
+		problems = append(problems, "/"+d.Path+": "+d.Problem)
+	}
+	message := fmt.Sprintf("Units of machine %s were changed outside the agent: %s. Run aks-flex-node verify --accept-units to keep the changes or verify --repair to remove them.",
+		m.Machine, strings.Join(problems, "; "))
+	w.log.Warn(message)
+	w.recorder.Event(ctx, corev1.EventTypeWarning, EventReasonUnitDrift, message)
+}
@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/manifest"
+)
+
+func TestUnitDrift(t *testing.T) {
+	t.Parallel()
+
+	const (
+		fragment = "/etc/systemd/system/kubelet.service"
+		override = "/etc/systemd/system/kubelet.service.d/override.conf"
+	)
+	machineDir := t.TempDir()
+	writeMachineFile := func(path, content string) {
+		t.Helper()
+		full := filepath.Join(machineDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeMachineFile(fragment, "[Service]\nExecStart=/usr/local/bin/kubelet\n")
+
+	loaded := []manifest.Unit{{Name: "kubelet.service", FragmentPath: fragment}}
+	store := &ManifestStore{
+		path: filepath.Join(t.TempDir(), manifestFileName),
+		units: func(context.Context, string) ([]manifest.Unit, error) {
+			return slices.Clone(loaded), nil
+		},
+	}
+	state := &testStateStore{state: &State{ActiveMachine: "kube1"}}
+	log := slog.New(slog.DiscardHandler)
+	record := &recordManifestTask{log: log, store: store, machine: "kube1", machineDir: machineDir}
+	if err := record.Do(t.Context()); err != nil {
+		t.Fatalf("record manifest: %v", err)
+	}
+
+	watchdog := &unitDriftWatchdog{log: log, state: state, manifests: store}
+	watchdog.check(t.Context())
+	if len(watchdog.last) != 0 {
+		t.Fatalf("drift = %+v right after recording", watchdog.last)
+	}
+
+	// systemctl edit kubelet.
+	writeMachineFile(override, "[Service]\nEnvironment=KUBELET_EXTRA_ARGS=--v=4\n")
+	loaded[0].DropInPaths = []string{override}
+	watchdog.check(t.Context())
+	if len(watchdog.last) != 1 || watchdog.last[0].Path != "etc/systemd/system/kubelet.service.d/override.conf" {
+		t.Fatalf("drift = %+v, want the override drop-in", watchdog.last)
+	}
+	if _, mismatches, err := verifyActiveMachine(t.Context(), state, store, ""); err != nil || len(mismatches) != 1 {
+		t.Fatalf("verifyActiveMachine() = %+v, %v, want the unit drift", mismatches, err)
+	}
+
+	accepted, err := acceptUnitDrift(t.Context(), state, store, "")
+	if err != nil || len(accepted) != 1 {
+		t.Fatalf("acceptUnitDrift() = %+v, %v", accepted, err)
+	}
+	watchdog.check(t.Context())
+	if len(watchdog.last) != 0 {
+		t.Fatalf("drift = %+v after accepting it", watchdog.last)
+	}
+
+	// The node start rewrites the unit file from the config on restart.
+	writeMachineFile(fragment, "[Service]\nExecStart=/usr/local/bin/kubelet --v=2\n")
+	if err := (&refreshUnitHashesTask{log: log, manifests: store, machine: "kube1"}).Do(t.Context()); err != nil {
+		t.Fatalf("refresh unit hashes: %v", err)
+	}
+	watchdog.check(t.Context())
+	if len(watchdog.last) != 0 {
+		t.Fatalf("drift = %+v after the agent rewrote the unit", watchdog.last)
+	}
+}
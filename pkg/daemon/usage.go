@@ -0,0 +1,400 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/inventory"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const usageFileName = "usage.json"
+
+var (
+	cpuUtilizationRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aks_flex_node_cpu_utilization_ratio",
+		Help: "Fraction of the host's CPU time spent busy over the last usage sample interval.",
+	})
+
+	memoryBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_memory_bytes",
+		Help: "Host memory in use (total minus available) and in total.",
+	}, []string{"state"})
+
+	diskBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_disk_bytes",
+		Help: "Used and total bytes of the filesystem holding the nspawn machines.",
+	}, []string{"state"})
+
+	networkBytesPerSecond = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_network_bytes_per_second",
+		Help: "Traffic through the host's physical network interfaces over the last usage sample interval.",
+	}, []string{"direction"})
+
+	podCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aks_flex_node_pods",
+		Help: "Pods with containers on the node, counted from the kubelet's pod log directories.",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(cpuUtilizationRatio, memoryBytes, diskBytes, networkBytesPerSecond, podCount)
+}
+
+// UsageSample is one sample of the host's resource usage.
+type UsageSample struct {
+	Time time.Time `json:"time"`
+	// CPURatio is the fraction of all CPUs' time spent busy since the
+	// previous sample.
+	CPURatio         float64 `json:"cpuRatio"`
+	MemoryUsedBytes  int64   `json:"memoryUsedBytes"`
+	MemoryTotalBytes int64   `json:"memoryTotalBytes"`
+	// DiskUsedBytes and DiskTotalBytes describe the filesystem holding the
+	// nspawn machines, where images and container layers live.
+	DiskUsedBytes  int64 `json:"diskUsedBytes"`
+	DiskTotalBytes int64 `json:"diskTotalBytes"`
+	// Network rates count the host's physical interfaces only, so pod
+	// traffic is not counted again on its veth.
+	NetworkReceiveBytesPerSecond  float64 `json:"networkReceiveBytesPerSecond"`
+	NetworkTransmitBytesPerSecond float64 `json:"networkTransmitBytesPerSecond"`
+	Pods                          int     `json:"pods"`
+}
+
+// Summary describes the sample in one line.
+func (s UsageSample) Summary() string {
+	return fmt.Sprintf("CPU %.0f%%, memory %s of %s, disk %s of %s, network %s/s in %s/s out, %d pods",
+		s.CPURatio*100,
+		progress.FormatBytes(s.MemoryUsedBytes), progress.FormatBytes(s.MemoryTotalBytes),
+		progress.FormatBytes(s.DiskUsedBytes), progress.FormatBytes(s.DiskTotalBytes),
+		progress.FormatBytes(int64(s.NetworkReceiveBytesPerSecond)), progress.FormatBytes(int64(s.NetworkTransmitBytesPerSecond)),
+		s.Pods)
+}
+
+// UsageStore keeps the latest samples in a JSON file under the instance's
+// state root, dropping the oldest once it holds capacity samples.
+type UsageStore struct {
+	path     string
+	capacity int
+}
+
+// NewUsageStore returns a store under the instance's state root.
+func NewUsageStore(instance config.Instance, capacity int) *UsageStore {
+	return &UsageStore{path: filepath.Join(instance.StateDir(), usageFileName), capacity: capacity}
+}
+
+// Load returns the stored samples, oldest first.
+func (s *UsageStore) Load() ([]UsageSample, error) {
+	data, err := os.ReadFile(filepath.Clean(s.path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read usage samples %s: %w", s.path, err)
+	}
+	var samples []UsageSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("decode usage samples %s: %w", s.path, err)
+	}
+	return samples, nil
+}
+
+// Append adds sample and drops the samples over capacity. An unreadable file
+// is replaced rather than blocking new samples.
+func (s *UsageStore) Append(sample UsageSample) error {
+	samples, err := s.Load()
+	if err != nil {
+		samples = nil
+	}
+	samples = append(samples, sample)
+	if s.capacity > 0 && len(samples) > s.capacity {
+		samples = samples[len(samples)-s.capacity:]
+	}
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return fmt.Errorf("marshal usage samples: %w", err)
+	}
+	if err := utilio.WriteFile(s.path, append(data, '\n'), stateFileMode); err != nil {
+		return fmt.Errorf("write usage samples %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// hostCounters are the cumulative kernel counters rates are derived from.
+type hostCounters struct {
+	at        time.Time
+	cpuBusy   uint64
+	cpuTotal  uint64
+	rxBytes   uint64
+	txBytes   uint64
+	hasCounts bool
+}
+
+// usageSampler samples the host's resource usage, exports it as metrics, and
+// appends it to the usage file. It implements manager.Runnable.
+type usageSampler struct {
+	log         *slog.Logger
+	interval    time.Duration
+	store       *UsageStore
+	state       stateStore
+	procDir     string
+	sysDir      string
+	machinesDir string
+	now         func() time.Time
+
+	previous hostCounters
+
+	mu   sync.Mutex
+	last *UsageSample
+}
+
+func newUsageSampler(log *slog.Logger, usage config.UsageConfig, store *UsageStore, state stateStore) *usageSampler {
+	return &usageSampler{
+		log:         log,
+		interval:    time.Duration(usage.Interval),
+		store:       store,
+		state:       state,
+		procDir:     "/proc",
+		sysDir:      "/sys",
+		machinesDir: machinesDir,
+		now:         time.Now,
+	}
+}
+
+// NeedLeaderElection reports false: every daemon samples its own host.
+func (s *usageSampler) NeedLeaderElection() bool { return false }
+
+func (s *usageSampler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.sample(ctx); err != nil {
+			s.log.Warn("failed to sample node resource usage", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the latest sample, or nil before the second one: rates need
+// two readings of the counters.
+func (s *usageSampler) Last() *UsageSample {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *usageSampler) sample(ctx context.Context) error {
+	counters := hostCounters{at: s.now()}
+	var err error
+	if counters.cpuBusy, counters.cpuTotal, err = readCPUTimes(s.procDir); err != nil {
+		return err
+	}
+	if counters.rxBytes, counters.txBytes, err = readNetworkBytes(s.procDir, s.sysDir); err != nil {
+		return err
+	}
+	counters.hasCounts = true
+	previous := s.previous
+	s.previous = counters
+	if !previous.hasCounts {
+		return nil
+	}
+
+	sample := UsageSample{Time: counters.at.UTC()}
+	if total := counters.cpuTotal - previous.cpuTotal; total > 0 {
+		sample.CPURatio = float64(counters.cpuBusy-previous.cpuBusy) / float64(total)
+	}
+	if elapsed := counters.at.Sub(previous.at).Seconds(); elapsed > 0 {
+		sample.NetworkReceiveBytesPerSecond = float64(counterDelta(previous.rxBytes, counters.rxBytes)) / elapsed
+		sample.NetworkTransmitBytesPerSecond = float64(counterDelta(previous.txBytes, counters.txBytes)) / elapsed
+	}
+	if sample.MemoryUsedBytes, sample.MemoryTotalBytes, err = readMemory(s.procDir); err != nil {
+		return err
+	}
+	if sample.DiskUsedBytes, sample.DiskTotalBytes, err = filesystemUsage(s.machinesDir); err != nil {
+		return err
+	}
+	sample.Pods = s.pods(ctx)
+
+	s.mu.Lock()
+	s.last = &sample
+	s.mu.Unlock()
+	publishUsage(sample)
+	return s.store.Append(sample)
+}
+
+// pods counts the kubelet's pod log directories in the active machine, one
+// per pod with containers. It needs no API access.
+func (s *usageSampler) pods(ctx context.Context) int {
+	state, err := s.state.Load(ctx)
+	if err != nil || state == nil || state.ActiveMachine == "" {
+		return 0
+	}
+	entries, err := os.ReadDir(filepath.Join(s.machinesDir, state.ActiveMachine, "var/log/pods"))
+	if err != nil {
+		return 0
+	}
+	pods := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			pods++
+		}
+	}
+	return pods
+}
+
+func publishUsage(sample UsageSample) {
+	cpuUtilizationRatio.Set(sample.CPURatio)
+	memoryBytes.WithLabelValues("used").Set(float64(sample.MemoryUsedBytes))
+	memoryBytes.WithLabelValues("total").Set(float64(sample.MemoryTotalBytes))
+	diskBytes.WithLabelValues("used").Set(float64(sample.DiskUsedBytes))
+	diskBytes.WithLabelValues("total").Set(float64(sample.DiskTotalBytes))
+	networkBytesPerSecond.WithLabelValues("receive").Set(sample.NetworkReceiveBytesPerSecond)
+	networkBytesPerSecond.WithLabelValues("transmit").Set(sample.NetworkTransmitBytesPerSecond)
+	podCount.Set(float64(sample.Pods))
+}
+
+// counterDelta is the increase of a kernel counter, or zero when it was
+// reset, for example by an interface going away.
+func counterDelta(before, after uint64) uint64 {
+	if after < before {
+		return 0
+	}
+	return after - before
+}
+
+// readCPUTimes returns the busy and total jiffies of all CPUs from the first
+// line of /proc/stat. Idle and iowait count as not busy.
+func readCPUTimes(procDir string) (busy, total uint64, err error) {
+	path := filepath.Join(procDir, "stat")
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return 0, 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, 0, fmt.Errorf("read %s: empty", path)
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected %s line %q", path, scanner.Text())
+	}
+	var idle uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse %s: %w", path, err)
+		}
+		// guest and guest_nice are already counted in user and nice.
+		if i >= 8 {
+			break
+		}
+		total += value
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return total - idle, total, nil
+}
+
+// readMemory returns MemTotal minus MemAvailable and MemTotal from
+// /proc/meminfo.
+func readMemory(procDir string) (used, total int64, err error) {
+	path := filepath.Join(procDir, "meminfo")
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return 0, 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	var available int64 = -1
+	total = -1
+	for line := range strings.Lines(string(data)) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || (name != "MemTotal" && name != "MemAvailable") {
+			continue
+		}
+		kib, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse %s %s: %w", path, name, err)
+		}
+		if name == "MemTotal" {
+			total = kib * 1024
+		} else {
+			available = kib * 1024
+		}
+	}
+	if total < 0 || available < 0 {
+		return 0, 0, fmt.Errorf("%s has no MemTotal or MemAvailable", path)
+	}
+	return total - available, total, nil
+}
+
+// readNetworkBytes sums the received and transmitted bytes in /proc/net/dev
+// of the interfaces backed by a device, which leaves out loopback, veths,
+// bridges, and tunnels.
+func readNetworkBytes(procDir, sysDir string) (rx, tx uint64, err error) {
+	path := filepath.Join(procDir, "net/dev")
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return 0, 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	for line := range strings.Lines(string(data)) {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if !inventory.PhysicalInterface(sysDir, name) {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		received, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse %s %s: %w", path, name, err)
+		}
+		transmitted, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse %s %s: %w", path, name, err)
+		}
+		rx += received
+		tx += transmitted
+	}
+	return rx, tx, nil
+}
+
+// filesystemUsage returns the used and total bytes of the filesystem holding
+// path, counting space reserved for root as used.
+func filesystemUsage(path string) (used, total int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	total = int64(stat.Blocks) * stat.Bsize      //nolint:gosec // block counts fit in int64
+	available := int64(stat.Bavail) * stat.Bsize //nolint:gosec // block counts fit in int64
+	return total - available, total, nil
+}
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestUsageSampler(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	procDir := filepath.Join(root, "proc")
+	sysDir := filepath.Join(root, "sys")
+	machines := filepath.Join(root, "machines")
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeCounters := func(user, idle, rx, tx string) {
+		writeFile(filepath.Join(procDir, "stat"), "cpu  "+user+" 0 0 "+idle+" 0 0 0 0 0 0\ncpu0 1 2 3 4\n")
+		writeFile(filepath.Join(procDir, "net/dev"), `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 999999 1 0 0 0 0 0 0 999999 1 0 0 0 0 0 0
+  eth0: `+rx+` 1 0 0 0 0 0 0 `+tx+` 1 0 0 0 0 0 0
+lxc123: 555555 1 0 0 0 0 0 0 555555 1 0 0 0 0 0 0
+`)
+	}
+	writeFile(filepath.Join(procDir, "meminfo"), "MemTotal:        8000000 kB\nMemFree:          100000 kB\nMemAvailable:    6000000 kB\n")
+	writeFile(filepath.Join(sysDir, "class/net/eth0/device/uevent"), "")
+	for _, pod := range []string{"default_web-1_uid1", "kube-system_dns_uid2"} {
+		if err := os.MkdirAll(filepath.Join(machines, "kube1/var/log/pods", pod), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	store := &UsageStore{path: filepath.Join(root, usageFileName), capacity: 2}
+	sampler := newUsageSampler(slog.New(slog.DiscardHandler), config.UsageConfig{Interval: config.JSONDuration(time.Minute)}, store, &testStateStore{state: &State{ActiveMachine: "kube1"}})
+	sampler.procDir, sampler.sysDir, sampler.machinesDir = procDir, sysDir, machines
+	sampler.now = func() time.Time { return now }
+
+	writeCounters("100", "900", "1000", "2000")
+	if err := sampler.sample(t.Context()); err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	if sampler.Last() != nil {
+		t.Fatalf("Last() after the first sample = %+v, want nil", sampler.Last())
+	}
+
+	now = now.Add(10 * time.Second)
+	writeCounters("400", "1600", "11000", "7000")
+	if err := sampler.sample(t.Context()); err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	last := sampler.Last()
+	if last == nil {
+		t.Fatal("Last() = nil after the second sample")
+	}
+	if last.CPURatio != 0.3 {
+		t.Errorf("CPURatio = %v, want 0.3", last.CPURatio)
+	}
+	if last.MemoryUsedBytes != 2000000*1024 || last.MemoryTotalBytes != 8000000*1024 {
+		t.Errorf("memory = %d of %d", last.MemoryUsedBytes, last.MemoryTotalBytes)
+	}
+	if last.NetworkReceiveBytesPerSecond != 1000 || last.NetworkTransmitBytesPerSecond != 500 {
+		t.Errorf("network = %v in %v out, want only eth0 counted", last.NetworkReceiveBytesPerSecond, last.NetworkTransmitBytesPerSecond)
+	}
+	if last.DiskTotalBytes <= 0 || last.DiskUsedBytes > last.DiskTotalBytes {
+		t.Errorf("disk = %d of %d", last.DiskUsedBytes, last.DiskTotalBytes)
+	}
+	if last.Pods != 2 {
+		t.Errorf("Pods = %d, want 2", last.Pods)
+	}
+
+	for range 2 {
+		now = now.Add(10 * time.Second)
+		if err := sampler.sample(t.Context()); err != nil {
+			t.Fatalf("sample: %v", err)
+		}
+	}
+	samples, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(samples) != 2 || !samples[1].Time.Equal(now) {
+		t.Fatalf("stored samples = %+v, want the latest 2", samples)
+	}
+}
@@ -0,0 +1,118 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+// smokeTestTimeout bounds each binary invocation of the rootfs validation. A
+// healthy binary answers a version query immediately.
+const smokeTestTimeout = 30 * time.Second
+
+// requiredCNIPlugins are the plugins the node's CNI config uses, as unbounded
+// requires them of a CNI installation. The plugin archive also holds files
+// such as LICENSE and README.md, installed executable beside the plugins, so
+// the directory is not validated as a whole.
+var requiredCNIPlugins = []string{"bridge", "host-local", "loopback"}
+
+type validateRootFS struct {
+	log       *slog.Logger
+	goalState *goalstates.RootFS
+}
+
+// ValidateRootFS returns a task that smoke-tests the binaries provisioned
+// into a machine rootfs before the machine is started on them: kubelet,
+// containerd, and runc must run and report the goal state's versions, and
+// the required CNI plugins must answer the CNI VERSION handshake. A
+// truncated or wrong-architecture download then fails the bootstrap or
+// repave with the broken binary named, instead of a kubelet that never
+// becomes ready.
+func ValidateRootFS(log *slog.Logger, gs *goalstates.RootFS) phases.Task {
+	return &validateRootFS{log: log, goalState: gs}
+}
+
+func (t *validateRootFS) Name() string { return "validate-rootfs" }
+
+func (t *validateRootFS) Do(ctx context.Context) error {
+	binDir := filepath.Join(t.goalState.MachineDir, goalstates.BinDir)
+	errs := []error{
+		t.checkVersion(ctx, filepath.Join(binDir, "kubelet"), t.goalState.KubernetesVersion),
+		t.checkVersion(ctx, filepath.Join(binDir, "containerd"), t.goalState.ContainerdVersion),
+		t.checkVersion(ctx, filepath.Join(binDir, "runc"), t.goalState.RunCVersion),
+	}
+
+	cniBinDir := filepath.Join(t.goalState.MachineDir, goalstates.CNIBinDir)
+	for _, plugin := range requiredCNIPlugins {
+		errs = append(errs, t.checkCNIPlugin(ctx, filepath.Join(cniBinDir, plugin)))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("rootfs %s failed validation: %w", t.goalState.MachineDir, err)
+	}
+	return nil
+}
+
+// checkVersion runs path --version and checks that the output names
+// version. An empty version only checks that the binary runs.
+func (t *validateRootFS) checkVersion(ctx context.Context, path, version string) error {
+	ctx, cancel := context.WithTimeout(ctx, smokeTestTimeout)
+	defer cancel()
+	output, err := commandOutput(utilexec.New().CommandContext(ctx, path, "--version"))
+	if err != nil {
+		return err
+	}
+	if want := strings.TrimPrefix(version, "v"); want != "" && !strings.Contains(output, want) {
+		return fmt.Errorf("%s reports %q, want version %s", path, firstLine(output), want)
+	}
+	t.log.Debug("rootfs binary passed validation", "binary", path, "version", firstLine(output))
+	return nil
+}
+
+// checkCNIPlugin runs the CNI VERSION command, which every conforming plugin
+// answers without touching the network.
+func (t *validateRootFS) checkCNIPlugin(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, smokeTestTimeout)
+	defer cancel()
+	cmd := utilexec.New().CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(), "CNI_COMMAND=VERSION")
+	cmd.Stdin = strings.NewReader(`{"cniVersion":"1.0.0"}`)
+	output, err := commandOutput(cmd)
+	if err != nil {
+		return err
+	}
+	var version struct {
+		SupportedVersions []string `json:"supportedVersions"`
+	}
+	if err := json.Unmarshal([]byte(output), &version); err != nil || len(version.SupportedVersions) == 0 {
+		return fmt.Errorf("%s did not answer the CNI VERSION command: %q", path, firstLine(output))
+	}
+	return nil
+}
+
+func commandOutput(cmd *exec.Cmd) (string, error) {
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := errors.AsType[*exec.ExitError](err); ok {
+			return "", fmt.Errorf("run %s: %w: %q", cmd.Path, err, firstLine(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("run %s: %w", cmd.Path, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+)
+
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil { //nolint:gosec // test script must be executable
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestValidateRootFS(t *testing.T) {
+	t.Parallel()
+
+	const cniPlugin = `[ "$CNI_COMMAND" = VERSION ] && echo '{"cniVersion":"1.0.0","supportedVersions":["0.4.0","1.0.0"]}'`
+	tests := []struct {
+		name    string
+		scripts map[string]string
+		wantErr []string
+	}{
+		{
+			name: "healthy rootfs",
+			scripts: map[string]string{
+				"usr/local/bin/kubelet":    "echo Kubernetes v1.31.2",
+				"usr/local/bin/containerd": "echo containerd github.com/containerd/containerd/v2 v2.1.8 abc",
+				"usr/local/bin/runc":       "echo runc version 1.5.0",
+				"opt/cni/bin/bridge":       cniPlugin,
+				"opt/cni/bin/host-local":   cniPlugin,
+				"opt/cni/bin/loopback":     cniPlugin,
+			},
+		},
+		{
+			name: "broken and mismatched binaries",
+			scripts: map[string]string{
+				"usr/local/bin/kubelet":    "echo Kubernetes v1.30.0",
+				"usr/local/bin/containerd": "echo 'exec format error' >&2; exit 126",
+				"usr/local/bin/runc":       "echo runc version 1.5.0",
+				"opt/cni/bin/bridge":       cniPlugin,
+				"opt/cni/bin/loopback":     "exit 0",
+			},
+			wantErr: []string{"want version 1.31.2", "containerd: exit status 126", "loopback did not answer", "host-local"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			machineDir := t.TempDir()
+			for path, body := range tt.scripts {
+				writeScript(t, filepath.Join(machineDir, path), body)
+			}
+			// The plugin archive installs its license executable too.
+			license := filepath.Join(machineDir, goalstates.CNIBinDir, "LICENSE")
+			if err := os.WriteFile(license, []byte("Apache License\nVersion 2.0\n"), 0o755); err != nil { //nolint:gosec // installed as the archive does
+				t.Fatal(err)
+			}
+			gs := &goalstates.RootFS{
+				MachineDir:        machineDir,
+				KubernetesVersion: "1.31.2",
+				ContainerdVersion: "2.1.8",
+				RunCVersion:       "1.5.0",
+			}
+
+			err := ValidateRootFS(slog.New(slog.DiscardHandler), gs).Do(t.Context())
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Do() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Do() error = nil, want validation failure")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Do() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
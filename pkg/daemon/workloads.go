@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// workloadRecheckInterval is how soon a restart deferred for the node's
+	// workloads is attempted again.
+	workloadRecheckInterval = 10 * time.Minute
+
+	// annotationSafeToEvict marks pods that must not be evicted, as honored
+	// by the cluster autoscaler.
+	annotationSafeToEvict = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+)
+
+// workloadGuard finds the pods on the node that a machine restart, which
+// stops every container, would disrupt against their owners' wishes.
+type workloadGuard struct {
+	reader   client.Reader
+	nodeName string
+}
+
+// blockers returns one description per pod that is marked not safe to evict
+// or whose PodDisruptionBudget does not allow its disruption. DaemonSet,
+// static, and finished pods are ignored since they are neither evicted nor
+// rescheduled.
+func (g *workloadGuard) blockers(ctx context.Context) ([]string, error) {
+	var pods corev1.PodList
+	if err := g.reader.List(ctx, &pods, client.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("spec.nodeName", g.nodeName)}); err != nil {
+		return nil, fmt.Errorf("list pods on node %s: %w", g.nodeName, err)
+	}
+
+	var blockers []string
+	byNamespace := map[string][]*corev1.Pod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !disruptable(pod) {
+			continue
+		}
+		if pod.Annotations[annotationSafeToEvict] == "false" {
+			blockers = append(blockers, fmt.Sprintf("pod %s/%s is annotated %s=false", pod.Namespace, pod.Name, annotationSafeToEvict))
+			continue
+		}
+		byNamespace[pod.Namespace] = append(byNamespace[pod.Namespace], pod)
+	}
+
+	for namespace, nsPods := range byNamespace {
+		var pdbs policyv1.PodDisruptionBudgetList
+		if err := g.reader.List(ctx, &pdbs, client.InNamespace(namespace)); err != nil {
+			return nil, fmt.Errorf("list PodDisruptionBudgets in %s: %w", namespace, err)
+		}
+		for i := range pdbs.Items {
+			pdb := &pdbs.Items[i]
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil || selector.Empty() {
+				continue
+			}
+			var covered []string
+			for _, pod := range nsPods {
+				if selector.Matches(labels.Set(pod.Labels)) {
+					covered = append(covered, pod.Name)
+				}
+			}
+			if len(covered) == 0 || int(pdb.Status.DisruptionsAllowed) >= len(covered) {
+				continue
+			}
+			slices.Sort(covered)
+			blockers = append(blockers, fmt.Sprintf("PodDisruptionBudget %s/%s allows %d disruptions but pods %s run on this node",
+				namespace, pdb.Name, pdb.Status.DisruptionsAllowed, strings.Join(covered, ", ")))
+		}
+	}
+	slices.Sort(blockers)
+	return blockers, nil
+}
+
+// disruptable reports whether stopping the machine disrupts pod in a way its
+// owner can object to.
+func disruptable(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if _, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; mirror {
+		return false
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func testPod(name, node string, labels map[string]string, mutate ...func(*corev1.Pod)) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: name, Labels: labels},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, m := range mutate {
+		m(pod)
+	}
+	return pod
+}
+
+func TestWorkloadGuardBlockers(t *testing.T) {
+	t.Parallel()
+
+	web := map[string]string{"app": "web"}
+	objects := []client.Object{
+		testPod("web-1", "node1", web),
+		testPod("web-2", "node1", web),
+		testPod("web-3", "node2", web),
+		testPod("batch", "node1", nil, func(p *corev1.Pod) {
+			p.Annotations = map[string]string{annotationSafeToEvict: "false"}
+		}),
+		testPod("agent", "node1", map[string]string{"app": "agent"}, func(p *corev1.Pod) {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent"}}
+			p.Annotations = map[string]string{annotationSafeToEvict: "false"}
+		}),
+		testPod("done", "node1", web, func(p *corev1.Pod) { p.Status.Phase = corev1.PodSucceeded }),
+		&policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "apps", Name: "web"},
+			Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: web}},
+			Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+		},
+	}
+	reader := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(objects...).
+		WithIndex(&corev1.Pod{}, "spec.nodeName", func(obj client.Object) []string {
+			return []string{obj.(*corev1.Pod).Spec.NodeName}
+		}).
+		Build()
+
+	guard := &workloadGuard{reader: reader, nodeName: "node1"}
+	blockers, err := guard.blockers(t.Context())
+	if err != nil {
+		t.Fatalf("blockers() error = %v", err)
+	}
+	if len(blockers) != 2 ||
+		!strings.Contains(blockers[0], "PodDisruptionBudget apps/web allows 1 disruptions but pods web-1, web-2") ||
+		!strings.Contains(blockers[1], "pod apps/batch") {
+		t.Fatalf("blockers() = %q", blockers)
+	}
+
+	disruption := disruptionGuard{workloads: guard}
+	log := slog.New(slog.DiscardHandler)
+	if err := disruption.allow(t.Context(), log, config.DisruptionKubelet); err != nil {
+		t.Errorf("allow(kubelet) = %v, want nil since containers keep running", err)
+	}
+	refused, ok := errors.AsType[*DisruptionRefusedError](disruption.allow(t.Context(), log, config.DisruptionMachine))
+	if !ok || refused.RetryAfter != workloadRecheckInterval || len(refused.Blockers) != 2 {
+		t.Fatalf("allow(machine) = %v, want a deferral naming the blockers", refused)
+	}
+}
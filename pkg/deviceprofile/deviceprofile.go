@@ -0,0 +1,152 @@
+// Package deviceprofile selects bootstrap defaults for the class of hardware
+// the agent runs on.
+//
+// Most nodes are cloud or datacenter machines where the kubelet and bootstrap
+// defaults fit. Single-board computers such as the Raspberry Pi have a few GiB
+// of memory, slow SD or eMMC storage, distribution swap services that come
+// back at boot, and firmware that disables the memory cgroup unless the kernel
+// command line enables it. A profile captures those differences so config
+// defaults, host setup, and preflight can adapt without per-device settings.
+package deviceprofile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+const (
+	// Auto detects the profile from the device tree and DMI.
+	Auto = "auto"
+	// Generic keeps the regular defaults.
+	Generic = "generic"
+	// RaspberryPi targets Raspberry Pi 4, 5, and Compute Module boards.
+	RaspberryPi = "raspberry-pi"
+	// ARMSBC targets other device-tree ARM single-board computers.
+	ARMSBC = "arm-sbc"
+
+	// DeviceTreeModelPath and DMIProductNamePath name the board of
+	// device-tree hosts and the product of DMI hosts.
+	DeviceTreeModelPath = "/proc/device-tree/model"
+	DMIProductNamePath  = "/sys/class/dmi/id/product_name"
+)
+
+// Profile holds the per-device defaults. Zero values mean "use the regular
+// default".
+type Profile struct {
+	Name string
+
+	// Kubelet defaults. They only apply when the config leaves the matching
+	// field unset.
+	MaxPods              int
+	ImageGCHighThreshold int
+	ImageGCLowThreshold  int
+	KubeReserved         map[string]string
+	SystemReserved       map[string]string
+	EvictionHard         map[string]string
+
+	// DownloadConcurrency bounds how many artifact downloads run at once
+	// during bootstrap. Zero means no limit.
+	DownloadConcurrency int
+
+	// PackageArchitecture is the Debian architecture the host package manager
+	// must use so host packages match the overlay binaries.
+	PackageArchitecture string
+
+	// SwapUnits are distribution services that set up zram or a swap file on
+	// every boot. Bootstrap masks them so swap stays off after a reboot.
+	SwapUnits []string
+
+	// BootCmdlines lists the firmware kernel command line files, in order of
+	// preference, where the memory cgroup has to be enabled.
+	BootCmdlines []string
+}
+
+var profiles = map[string]Profile{
+	Generic: {Name: Generic},
+	RaspberryPi: {
+		Name:                 RaspberryPi,
+		MaxPods:              32,
+		ImageGCHighThreshold: 75,
+		ImageGCLowThreshold:  65,
+		KubeReserved:         map[string]string{"cpu": "100m", "memory": "256Mi"},
+		SystemReserved:       map[string]string{"cpu": "100m", "memory": "128Mi"},
+		EvictionHard:         map[string]string{"memory.available": "100Mi", "nodefs.available": "10%", "imagefs.available": "10%"},
+		DownloadConcurrency:  1,
+		PackageArchitecture:  "arm64",
+		SwapUnits:            []string{"dphys-swapfile.service", "zramswap.service", "zram-config.service"},
+		BootCmdlines:         []string{"/boot/firmware/cmdline.txt", "/boot/cmdline.txt"},
+	},
+	ARMSBC: {
+		Name:                 ARMSBC,
+		MaxPods:              32,
+		ImageGCHighThreshold: 75,
+		ImageGCLowThreshold:  65,
+		KubeReserved:         map[string]string{"cpu": "100m", "memory": "256Mi"},
+		SystemReserved:       map[string]string{"cpu": "100m", "memory": "128Mi"},
+		EvictionHard:         map[string]string{"memory.available": "100Mi", "nodefs.available": "10%", "imagefs.available": "10%"},
+		DownloadConcurrency:  2,
+		PackageArchitecture:  "arm64",
+		SwapUnits:            []string{"zramswap.service", "zram-config.service", "armbian-zram-config.service"},
+	},
+}
+
+// Names returns the selectable profile names, including Auto.
+func Names() []string {
+	names := []string{Auto}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// Lookup returns the named profile. An empty name or Auto is an error;
+// callers resolve those with Detect first.
+func Lookup(name string) (Profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown device profile %q (supported: %s)", name, strings.Join(Names(), ", "))
+	}
+	return p, nil
+}
+
+// Detect returns the profile name matching the current host.
+func Detect() string {
+	return DetectAt(utilhost.HostRoot)
+}
+
+// DetectAt returns the profile name matching the host whose /proc and /sys
+// are under root.
+func DetectAt(root utilhost.Root) string {
+	return detect(ReadFirmwareString(root.Path(DeviceTreeModelPath)), ReadFirmwareString(root.Path(DMIProductNamePath)))
+}
+
+// detect classifies a host by its device-tree model and DMI product name.
+// ARM servers boot through UEFI and ACPI and expose DMI, so only hosts that
+// describe themselves through a device tree alone count as boards.
+func detect(deviceTreeModel, dmiProductName string) string {
+	switch {
+	case strings.HasPrefix(deviceTreeModel, "Raspberry Pi"):
+		return RaspberryPi
+	case deviceTreeModel != "" && dmiProductName == "":
+		return ARMSBC
+	default:
+		return Generic
+	}
+}
+
+// ReadFirmwareString returns the content of a DMI or device-tree file without
+// the trailing NUL that device-tree strings carry, or "" when the file cannot
+// be read.
+func ReadFirmwareString(path string) string {
+	data, err := os.ReadFile(path) //#nosec G304 -- fixed system path
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(data, "\x00")))
+}
@@ -0,0 +1,240 @@
+package deviceprofile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		model      string
+		dmiProduct string
+		want       string
+	}{
+		{name: "raspberry pi 5", model: "Raspberry Pi 5 Model B Rev 1.0", want: RaspberryPi},
+		{name: "compute module", model: "Raspberry Pi Compute Module 4 Rev 1.1", want: RaspberryPi},
+		{name: "other board", model: "Radxa ROCK 5B", want: ARMSBC},
+		{name: "arm server", model: "", dmiProduct: "Mt.Jade", want: Generic},
+		{name: "device tree with dmi", model: "Ampere Altra", dmiProduct: "Altra", want: Generic},
+		{name: "x86 vm", dmiProduct: "Virtual Machine", want: Generic},
+		{name: "nothing", want: Generic},
+	}
+	for _, tt := range tests {
+		if got := detect(tt.model, tt.dmiProduct); got != tt.want {
+			t.Errorf("%s: detect(%q, %q) = %q, want %q", tt.name, tt.model, tt.dmiProduct, got, tt.want)
+		}
+	}
+}
+
+func TestReadFirmwareStringStripsDeviceTreeNUL(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "model")
+	if err := os.WriteFile(path, []byte("Raspberry Pi 4 Model B Rev 1.4\x00"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got := ReadFirmwareString(path); got != "Raspberry Pi 4 Model B Rev 1.4" {
+		t.Fatalf("ReadFirmwareString = %q", got)
+	}
+	if got := ReadFirmwareString(filepath.Join(t.TempDir(), "missing")); got != "" {
+		t.Fatalf("ReadFirmwareString(missing) = %q, want empty", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range Names()[1:] {
+		p, err := Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", name, err)
+		}
+		if p.Name != name {
+			t.Fatalf("Lookup(%q).Name = %q", name, p.Name)
+		}
+	}
+	for _, name := range []string{"", Auto, "pi"} {
+		if _, err := Lookup(name); err == nil {
+			t.Fatalf("Lookup(%q) succeeded, want error", name)
+		}
+	}
+}
+
+func TestAddCmdlineArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		cmdline     string
+		want        string
+		wantChanged bool
+	}{
+		{
+			name:        "adds missing flags",
+			cmdline:     "console=serial0,115200 root=PARTUUID=1234-02 rootwait\n",
+			want:        "console=serial0,115200 root=PARTUUID=1234-02 rootwait cgroup_enable=memory cgroup_memory=1\n",
+			wantChanged: true,
+		},
+		{
+			name:        "adds only what is missing",
+			cmdline:     "root=/dev/mmcblk0p2 cgroup_enable=memory",
+			want:        "root=/dev/mmcblk0p2 cgroup_enable=memory cgroup_memory=1\n",
+			wantChanged: true,
+		},
+		{
+			name:    "already present",
+			cmdline: "root=/dev/mmcblk0p2 cgroup_memory=1 cgroup_enable=memory\n",
+			want:    "root=/dev/mmcblk0p2 cgroup_memory=1 cgroup_enable=memory\n",
+		},
+	}
+	for _, tt := range tests {
+		got, changed := addCmdlineArgs(tt.cmdline, memoryCgroupArgs...)
+		if got != tt.want || changed != tt.wantChanged {
+			t.Errorf("%s: addCmdlineArgs = (%q, %v), want (%q, %v)", tt.name, got, changed, tt.want, tt.wantChanged)
+		}
+	}
+}
+
+func TestMemoryEnabledInProcCgroups(t *testing.T) {
+	t.Parallel()
+
+	const header = "#subsys_name\thierarchy\tnum_cgroups\tenabled\n"
+	if !memoryEnabledInProcCgroups(header + "cpu\t2\t40\t1\nmemory\t4\t90\t1\n") {
+		t.Error("enabled memory controller reported disabled")
+	}
+	if memoryEnabledInProcCgroups(header + "cpu\t2\t40\t1\nmemory\t0\t90\t0\n") {
+		t.Error("disabled memory controller reported enabled")
+	}
+	if memoryEnabledInProcCgroups(header) {
+		t.Error("missing memory controller reported enabled")
+	}
+}
+
+func TestEnsureMemoryCgroup(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	controllers := filepath.Join(dir, "cgroup.controllers")
+	cmdline := filepath.Join(dir, "cmdline.txt")
+	if err := os.WriteFile(cmdline, []byte("root=/dev/mmcblk0p2 rootwait\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	task := &configureHostTask{
+		log:               slog.New(slog.NewTextHandler(io.Discard, nil)),
+		profile:           Profile{Name: RaspberryPi, BootCmdlines: []string{filepath.Join(dir, "missing.txt"), cmdline}},
+		cgroupControllers: controllers,
+	}
+
+	if err := os.WriteFile(controllers, []byte("cpuset cpu io pids\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	err := task.ensureMemoryCgroup(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "reboot") {
+		t.Fatalf("ensureMemoryCgroup error = %v, want reboot required", err)
+	}
+	data, err := os.ReadFile(cmdline)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got, want := string(data), "root=/dev/mmcblk0p2 rootwait cgroup_enable=memory cgroup_memory=1\n"; got != want {
+		t.Fatalf("cmdline.txt = %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(controllers, []byte("cpuset cpu io memory pids\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := task.ensureMemoryCgroup(context.Background()); err != nil {
+		t.Fatalf("ensureMemoryCgroup with memory controller: %v", err)
+	}
+}
+
+func TestResetHostUnmasksRecordedUnits(t *testing.T) {
+	t.Parallel()
+
+	recordPath := filepath.Join(t.TempDir(), "device-profile.json")
+	var unmasked [][]string
+	task := &resetHostTask{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		recordPath: recordPath,
+		unmask: func(_ context.Context, units []string) error {
+			unmasked = append(unmasked, units)
+			return nil
+		},
+	}
+
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do without a record: %v", err)
+	}
+	if len(unmasked) != 0 {
+		t.Fatalf("unmasked %v without a record, want nothing", unmasked)
+	}
+
+	if err := saveRecord(recordPath, &Record{MaskedUnits: []string{"dphys-swapfile.service"}}); err != nil {
+		t.Fatalf("saveRecord: %v", err)
+	}
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if len(unmasked) != 1 || !slices.Equal(unmasked[0], []string{"dphys-swapfile.service"}) {
+		t.Fatalf("unmasked %v, want only the recorded unit", unmasked)
+	}
+	if _, err := os.Stat(recordPath); !os.IsNotExist(err) {
+		t.Fatalf("record still exists after reset: %v", err)
+	}
+}
+
+func TestPreflightChecks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	disabled := filepath.Join(dir, "disabled")
+	enabled := filepath.Join(dir, "enabled")
+	if err := os.WriteFile(disabled, []byte("cpu io pids\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(enabled, []byte("cpu io memory pids\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	profile := profiles[RaspberryPi]
+
+	tests := []struct {
+		name    string
+		checker preflight.Checker
+		want    preflight.Severity
+	}{
+		{name: "memory cgroup enabled", checker: memoryCgroupChecker{profile: profile, cgroupControllers: enabled}, want: preflight.SeverityOK},
+		{name: "memory cgroup disabled", checker: memoryCgroupChecker{profile: profile, cgroupControllers: disabled}, want: preflight.SeverityError},
+		{name: "arm64 userspace", checker: archChecker("arm64\n", nil), want: preflight.SeverityOK},
+		{name: "armhf userspace", checker: archChecker("armhf\n", nil), want: preflight.SeverityError},
+		{name: "no dpkg", checker: archChecker("", errors.New("not found")), want: preflight.SeverityWarning},
+	}
+	for _, tt := range tests {
+		results := tt.checker.Check(context.Background())
+		if len(results) != 1 || results[0].Severity != tt.want {
+			t.Errorf("%s: results = %+v, want severity %v", tt.name, results, tt.want)
+		}
+	}
+
+	if checks := Preflight(nil, profiles[Generic]); len(checks) != 0 {
+		t.Errorf("generic profile has %d preflight checks, want 0", len(checks))
+	}
+}
+
+func archChecker(out string, err error) packageArchChecker {
+	return packageArchChecker{
+		want:     "arm64",
+		dpkgArch: func(context.Context) (string, error) { return out, err },
+	}
+}
@@ -0,0 +1,253 @@
+package deviceprofile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const (
+	cgroupControllersPath = "/sys/fs/cgroup/cgroup.controllers"
+	procCgroupsPath       = "/proc/cgroups"
+)
+
+// RecordPath lists the swap services ConfigureHost masked, so ResetHost
+// unmasks exactly those and leaves units an administrator masked alone. It
+// lives in the agent's config directory; config imports this package, so the
+// directory is spelled out.
+const RecordPath = "/etc/aks-flex-node/device-profile.json"
+
+// Record is the persisted list of units a device profile masked.
+type Record struct {
+	MaskedUnits []string `json:"maskedUnits,omitempty"`
+}
+
+// memoryCgroupArgs enable the memory controller on Raspberry Pi kernels, which
+// ship with it disabled.
+var memoryCgroupArgs = []string{"cgroup_enable=memory", "cgroup_memory=1"}
+
+type configureHostTask struct {
+	log        *slog.Logger
+	profile    Profile
+	recordPath string
+	// cgroupControllers is overridable for tests.
+	cgroupControllers string
+}
+
+// ConfigureHost returns a task that applies the host side of a profile: it
+// masks distribution swap services and makes sure the memory cgroup is
+// enabled on the kernel command line. It does nothing for profiles without
+// such settings.
+func ConfigureHost(log *slog.Logger, profile Profile) phases.Task {
+	return &configureHostTask{log: log, profile: profile, recordPath: RecordPath, cgroupControllers: cgroupControllersPath}
+}
+
+func (t *configureHostTask) Name() string { return "configure-device-profile" }
+
+// Plan returns the boot command line file when the memory cgroup flags are
+// added to it.
+func (t *configureHostTask) Plan() []string {
+	if len(t.profile.BootCmdlines) == 0 || memoryControllerEnabled(t.cgroupControllers) {
+		return nil
+	}
+	if path := firstExisting(t.profile.BootCmdlines); path != "" {
+		return []string{path}
+	}
+	return nil
+}
+
+func (t *configureHostTask) Do(ctx context.Context) error {
+	if t.profile.Name != Generic {
+		t.log.Info("applying device profile", "profile", t.profile.Name)
+	}
+	if err := t.maskSwapUnits(ctx); err != nil {
+		return err
+	}
+	return t.ensureMemoryCgroup(ctx)
+}
+
+func (t *configureHostTask) maskSwapUnits(ctx context.Context) error {
+	if len(t.profile.SwapUnits) == 0 {
+		return nil
+	}
+	states, err := utilexec.GetUnitStates(ctx, t.log, t.profile.SwapUnits...)
+	if err != nil {
+		return err
+	}
+	var units []string
+	for _, unit := range t.profile.SwapUnits {
+		if state := states[unit]; state.Exists() && state.UnitFileState != "masked" {
+			units = append(units, unit)
+		}
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	// Record before masking: unmasking a unit that was not masked is
+	// harmless, while an unrecorded mask would outlive reset.
+	record, err := loadRecord(t.recordPath)
+	if err != nil {
+		return err
+	}
+	for _, unit := range units {
+		if !slices.Contains(record.MaskedUnits, unit) {
+			record.MaskedUnits = append(record.MaskedUnits, unit)
+		}
+	}
+	if err := saveRecord(t.recordPath, record); err != nil {
+		return err
+	}
+	t.log.Info("masking distribution swap services", "profile", t.profile.Name, "units", units)
+	if err := utilexec.MaskUnits(ctx, t.log, units...); err != nil {
+		return fmt.Errorf("mask swap services: %w", err)
+	}
+	for _, unit := range units {
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitDisable, Target: unit, Detail: "masked by device profile " + t.profile.Name})
+	}
+	return nil
+}
+
+// ensureMemoryCgroup adds the memory cgroup flags to the boot command line
+// when the running kernel has the controller disabled. The change only takes
+// effect after a reboot, so the task fails to stop bootstrap before the
+// kubelet crash-loops on a host without memory accounting.
+func (t *configureHostTask) ensureMemoryCgroup(ctx context.Context) error {
+	if len(t.profile.BootCmdlines) == 0 || memoryControllerEnabled(t.cgroupControllers) {
+		return nil
+	}
+	path := firstExisting(t.profile.BootCmdlines)
+	if path == "" {
+		return fmt.Errorf("memory cgroup is disabled and no boot command line file was found (looked in %s)", strings.Join(t.profile.BootCmdlines, ", "))
+	}
+	data, err := os.ReadFile(path) //#nosec G304 -- fixed profile path
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	updated, changed := addCmdlineArgs(string(data), memoryCgroupArgs...)
+	if changed {
+		before := audit.HashBytes(data)
+		if err := utilio.WriteFile(path, []byte(updated), 0o644); err != nil { //nolint:gosec // firmware reads the file as a regular boot file
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes([]byte(updated))})
+	}
+	return fmt.Errorf("memory cgroup is disabled; %s enables it, reboot the host and run bootstrap again", path)
+}
+
+type resetHostTask struct {
+	log        *slog.Logger
+	recordPath string
+	unmask     func(ctx context.Context, units []string) error
+}
+
+// ResetHost returns a task that unmasks the swap services ConfigureHost
+// masked. Reset runs without the agent config, so it acts on the record
+// alone; services that were masked before bootstrap stay masked. The boot
+// command line is left alone: the memory cgroup flags are harmless without
+// the agent and removing them could break other workloads.
+func ResetHost(log *slog.Logger) phases.Task {
+	return &resetHostTask{log: log, recordPath: RecordPath, unmask: func(ctx context.Context, units []string) error {
+		return utilexec.UnmaskUnits(ctx, log, units...)
+	}}
+}
+
+func (t *resetHostTask) Name() string { return "reset-device-profile" }
+
+func (t *resetHostTask) Do(ctx context.Context) error {
+	record, err := loadRecord(t.recordPath)
+	if err != nil {
+		return err
+	}
+	if len(record.MaskedUnits) > 0 {
+		if err := t.unmask(ctx, record.MaskedUnits); err != nil {
+			return fmt.Errorf("unmask swap services: %w", err)
+		}
+		for _, unit := range record.MaskedUnits {
+			audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitEnable, Target: unit, Detail: "unmasked by reset"})
+		}
+	}
+	if err := os.Remove(t.recordPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove device profile record: %w", err)
+	}
+	return nil
+}
+
+func loadRecord(path string) (*Record, error) {
+	record := &Record{}
+	if err := utilio.ReadJSON(path, record); err != nil {
+		return nil, fmt.Errorf("read device profile record: %w", err)
+	}
+	return record, nil
+}
+
+func saveRecord(path string, record *Record) error {
+	if err := utilio.WriteJSON(path, record, 0o600); err != nil {
+		return fmt.Errorf("write device profile record: %w", err)
+	}
+	return nil
+}
+
+// memoryControllerEnabled reports whether the cgroup v2 root lists the memory
+// controller. Hosts still on cgroup v1 have no cgroup.controllers file and
+// are checked through /proc/cgroups instead.
+func memoryControllerEnabled(path string) bool {
+	data, err := os.ReadFile(path) //#nosec G304 -- fixed system path
+	if err == nil {
+		return slices.Contains(strings.Fields(string(data)), "memory")
+	}
+	data, err = os.ReadFile(procCgroupsPath)
+	if err != nil {
+		return false
+	}
+	return memoryEnabledInProcCgroups(string(data))
+}
+
+// memoryEnabledInProcCgroups parses /proc/cgroups, whose rows are
+// "subsys_name hierarchy num_cgroups enabled".
+func memoryEnabledInProcCgroups(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 4 && fields[0] == "memory" {
+			return fields[3] == "1"
+		}
+	}
+	return false
+}
+
+// addCmdlineArgs appends args missing from the single-line cmdline.txt
+// format and reports whether anything changed.
+func addCmdlineArgs(cmdline string, args ...string) (string, bool) {
+	fields := strings.Fields(cmdline)
+	changed := false
+	for _, arg := range args {
+		if !slices.Contains(fields, arg) {
+			fields = append(fields, arg)
+			changed = true
+		}
+	}
+	return strings.Join(fields, " ") + "\n", changed
+}
+
+// BootCmdline returns the profile's firmware kernel command line file found
+// on the host, or "" when the profile has none or none exists.
+func (p Profile) BootCmdline() string {
+	return firstExisting(p.BootCmdlines)
+}
+
+func firstExisting(paths []string) string {
+	for _, path := range paths {
+		if utilio.FileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package deviceprofile
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	memoryCgroupCheckName = "memory-cgroup"
+	packageArchCheckName  = "package-architecture"
+)
+
+// Preflight returns the checks a profile needs, or nil for profiles without
+// host requirements.
+func Preflight(log *slog.Logger, profile Profile) []preflight.Checker {
+	var checks []preflight.Checker
+	if len(profile.BootCmdlines) > 0 {
+		checks = append(checks, memoryCgroupChecker{profile: profile, cgroupControllers: cgroupControllersPath})
+	}
+	if profile.PackageArchitecture != "" {
+		checks = append(checks, packageArchChecker{
+			want: profile.PackageArchitecture,
+			dpkgArch: func(ctx context.Context) (string, error) {
+				return utilexec.OutputCmd(ctx, log, "dpkg", "--print-architecture")
+			},
+		})
+	}
+	return checks
+}
+
+type memoryCgroupChecker struct {
+	profile           Profile
+	cgroupControllers string
+}
+
+func (memoryCgroupChecker) Name() string { return memoryCgroupCheckName }
+
+func (c memoryCgroupChecker) Check(context.Context) []preflight.Result {
+	if memoryControllerEnabled(c.cgroupControllers) {
+		return preflight.ResultsOK(memoryCgroupCheckName, "host cgroups", "memory controller is enabled")
+	}
+	target := firstExisting(c.profile.BootCmdlines)
+	if target == "" {
+		target = strings.Join(c.profile.BootCmdlines, ", ")
+	}
+	return preflight.ResultsError(memoryCgroupCheckName, target,
+		"memory controller is disabled; bootstrap adds %q to the boot command line, after which the host must be rebooted",
+		strings.Join(memoryCgroupArgs, " "))
+}
+
+// packageArchChecker catches 32-bit userspaces on 64-bit boards, such as
+// Raspberry Pi OS armhf with an arm64 kernel: host packages would be
+// installed for the wrong architecture next to arm64 overlay binaries.
+type packageArchChecker struct {
+	want     string
+	dpkgArch func(context.Context) (string, error)
+}
+
+func (packageArchChecker) Name() string { return packageArchCheckName }
+
+func (c packageArchChecker) Check(ctx context.Context) []preflight.Result {
+	got, err := c.dpkgArch(ctx)
+	if err != nil {
+		return preflight.ResultsWarning(packageArchCheckName, "dpkg", "could not determine package architecture: %v", err)
+	}
+	got = strings.TrimSpace(got)
+	if got != c.want {
+		return preflight.ResultsError(packageArchCheckName, "dpkg",
+			"package architecture is %s, want %s; install a 64-bit operating system image", got, c.want)
+	}
+	return preflight.ResultsOK(packageArchCheckName, "dpkg", "package architecture is "+got)
+}
@@ -0,0 +1,279 @@
+// Package egress computes the network endpoints a node connects to, for
+// network teams that allowlist egress through firewalls or proxies. The report
+// is derived from the config and resolved goal state without any network
+// access.
+package egress
+
+import (
+	"cmp"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/localdns"
+	"github.com/Azure/AKSFlexNode/pkg/nodetools"
+	"github.com/Azure/AKSFlexNode/pkg/npd"
+	"github.com/Azure/unbounded/pkg/agent/artifactsource"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases/rootfs"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	mcrRegistry      = "mcr.microsoft.com"
+	dockerHubDefault = "registry-1.docker.io"
+)
+
+// redirects are the hosts that well-known download hosts redirect to. A
+// firewall that allows only the first host fails the download.
+var redirects = map[string][]string{
+	"github.com": {"objects.githubusercontent.com", "release-assets.githubusercontent.com"},
+	"dl.k8s.io":  {"cdn.dl.k8s.io"},
+}
+
+// Endpoint is one destination the node opens connections to.
+type Endpoint struct {
+	// Host is a DNS name or IP. A leading "*." matches any subdomain.
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	// Purposes say which components use the endpoint.
+	Purposes []string `json:"purposes"`
+	// URLs are examples of what is fetched from the endpoint, without
+	// credentials.
+	URLs []string `json:"urls,omitempty"`
+}
+
+// Report is the node's egress allowlist.
+type Report struct {
+	Endpoints []Endpoint `json:"endpoints"`
+	// Notes describe egress the report cannot enumerate.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Collect computes the report for cfg and the machine goal state gs.
+func Collect(cfg *config.Config, gs *goalstates.MachineGoalState) Report {
+	c := &collector{endpoints: map[string]*Endpoint{}}
+	env := azclient.ResourceManagerEnvironmentFromConfig(cfg)
+	c.addControlPlane(cfg, env)
+	if cfg.IsARCEnabled() {
+		c.addArc(cfg, env)
+	}
+
+	c.addArtifacts(gs.RootFS, cfg)
+	c.addImage(gs.RootFS.OCIImage, "nspawn rootfs OCI image")
+	c.addImage(gs.NodeStart.Containerd.SandboxImage, "pod sandbox image")
+	for _, bundle := range cfg.Trust.CABundles {
+		if bundle.KeyVault != nil {
+			c.addURL(bundle.KeyVault.VaultURL, "Key Vault CA bundle")
+		}
+	}
+	if cfg.ACRCredentials.Enabled {
+		for _, registry := range cfg.ACRCredentials.Registries {
+			c.addURL("https://"+registry+"/oauth2/exchange", "ACR credential token exchange")
+		}
+	}
+
+	c.notes = append(c.notes,
+		"Images of workloads and cluster add-ons are pulled from the registries the cluster specifies and are not listed.",
+		"Hook scripts and extensions installed through Azure Arc may reach further endpoints.",
+	)
+	return c.report()
+}
+
+type collector struct {
+	endpoints map[string]*Endpoint
+	notes     []string
+}
+
+// ControlPlane returns the endpoints bootstrap reaches before it downloads
+// anything: Azure Resource Manager, Microsoft Entra ID, and the API server.
+func ControlPlane(cfg *config.Config) []Endpoint {
+	c := &collector{endpoints: map[string]*Endpoint{}}
+	c.addControlPlane(cfg, azclient.ResourceManagerEnvironmentFromConfig(cfg))
+	return c.report().Endpoints
+}
+
+func (c *collector) addControlPlane(cfg *config.Config, env azclient.ResourceManagerEnvironment) {
+	arcEnabled := cfg.IsARCEnabled()
+	if cfg.Agent.MachineClient.Mode != config.MachineClientModeInCluster || arcEnabled {
+		armURL := env.Endpoint
+		if cfg.Agent.MachineClient.Mode != config.MachineClientModeInCluster && cfg.Agent.MachineClient.EndpointURL != "" {
+			armURL = cfg.Agent.MachineClient.EndpointURL
+		}
+		c.addURL(armURL, "Azure Resource Manager")
+	}
+	if cfg.IsSPConfigured() || cfg.IsWorkloadIdentityConfigured() || arcEnabled {
+		c.addURL(env.AuthorityHost, "Microsoft Entra ID")
+	}
+	if server := cfg.APIServerURL(); server != "" {
+		c.addURL(server, "AKS API server")
+	}
+}
+
+// ArcEndpoints returns the endpoints the Azure Connected Machine agent
+// needs. It is empty for clouds whose Arc endpoints are not known here.
+func ArcEndpoints(cfg *config.Config) []Endpoint {
+	c := &collector{endpoints: map[string]*Endpoint{}}
+	c.addArc(cfg, azclient.ResourceManagerEnvironmentFromConfig(cfg))
+	return c.report().Endpoints
+}
+
+// addArc adds the endpoints the Azure Connected Machine agent needs. Only
+// the public cloud names are known here.
+func (c *collector) addArc(cfg *config.Config, env azclient.ResourceManagerEnvironment) {
+	if env.AzcmagentCloudName != "" {
+		c.notes = append(c.notes, "Azure Arc endpoints for "+env.AzcmagentCloudName+" are not listed; see the Azure Connected Machine agent network requirements for that cloud.")
+		return
+	}
+	region := strings.ToLower(strings.ReplaceAll(cfg.Azure.Arc.Location, " ", ""))
+	c.add("gbl.his.arc.azure.com", 443, "https", "Azure Arc install script and identity")
+	if region != "" {
+		c.add(region+".his.arc.azure.com", 443, "https", "Azure Arc identity")
+		c.add(region+"-gas.guestconfiguration.azure.com", 443, "https", "Azure Arc guest configuration")
+	} else {
+		c.add("*.his.arc.azure.com", 443, "https", "Azure Arc identity")
+		c.add("*.guestconfiguration.azure.com", 443, "https", "Azure Arc guest configuration")
+	}
+	c.add("agentserviceapi.guestconfiguration.azure.com", 443, "https", "Azure Arc guest configuration")
+	c.add("packages.microsoft.com", 443, "https", "Azure Arc agent package")
+	c.add("pas.windows.net", 443, "https", "Microsoft Entra ID")
+	c.add("*.guestnotificationservice.azure.com", 443, "https", "Azure Arc notifications")
+	c.add("*.servicebus.windows.net", 443, "https", "Azure Arc notifications")
+	c.add("*.blob.core.windows.net", 443, "https", "Azure Arc extension packages")
+}
+
+// addArtifacts adds the download sources of every binary the agent installs.
+// It reuses the sources preflight probes, so the two cannot drift apart.
+func (c *collector) addArtifacts(rootFS *goalstates.RootFS, cfg *config.Config) {
+	log := slog.New(slog.DiscardHandler)
+	checkers := preflight.Flatten(
+		[]preflight.Checker{
+			rootfs.CheckKubernetesArtifacts(log, rootFS),
+			rootfs.CheckCRIArtifacts(log, rootFS),
+			rootfs.CheckCNIArtifacts(log, rootFS),
+		},
+		nodetools.Preflight(cfg),
+		localdns.Preflight(cfg),
+	)
+	for _, checker := range checkers {
+		reachability, ok := checker.(artifactsource.ReachabilityChecker)
+		if !ok {
+			continue
+		}
+		sources, err := reachability.Sources()
+		if err != nil {
+			c.notes = append(c.notes, "Sources of "+reachability.Target+" could not be resolved: "+err.Error())
+			continue
+		}
+		c.addSources(sources, reachability.Target)
+	}
+	if sources, err := npd.ArtifactSources(cfg); err != nil {
+		c.notes = append(c.notes, "Sources of node-problem-detector could not be resolved: "+err.Error())
+	} else {
+		c.addSources(sources, "node-problem-detector artifact")
+	}
+	if source := strings.TrimSpace(cfg.Bootstrap.OfflineArtifacts.Source); source != "" {
+		c.addURL(source, "offline bootstrap artifacts")
+	}
+}
+
+func (c *collector) addSources(sources artifactsource.Sources, purpose string) {
+	for _, source := range sources {
+		c.addURL(source.String(), purpose)
+	}
+}
+
+// addImage adds the registry of an image reference. Blobs of images on
+// mcr.microsoft.com are served from regional data endpoints.
+func (c *collector) addImage(ref, purpose string) {
+	registry := imageRegistry(ref)
+	if registry == "" {
+		return
+	}
+	host, port := registry, 443
+	if h, p, err := net.SplitHostPort(registry); err == nil {
+		if n, err := strconv.Atoi(p); err == nil {
+			host, port = h, n
+		}
+	}
+	c.add(host, port, "https", purpose)
+	if host == mcrRegistry {
+		c.add("*.data.mcr.microsoft.com", 443, "https", purpose)
+	}
+}
+
+// addURL adds the host of an http or https URL. Other sources, such as
+// local paths, need no egress.
+func (c *collector) addURL(raw, purpose string) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return
+	}
+	port := 443
+	if u.Scheme == "http" {
+		port = 80
+	}
+	if p := u.Port(); p != "" {
+		if n, err := strconv.Atoi(p); err == nil {
+			port = n
+		}
+	}
+	endpoint := c.add(u.Hostname(), port, u.Scheme, purpose)
+	for _, target := range redirects[endpoint.Host] {
+		c.add(target, 443, "https", purpose)
+	}
+	// Mirrors and proxies may carry credentials in the URL.
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	if example := u.String(); !slices.Contains(endpoint.URLs, example) && u.Path != "" && u.Path != "/" {
+		endpoint.URLs = append(endpoint.URLs, example)
+	}
+}
+
+func (c *collector) add(host string, port int, protocol, purpose string) *Endpoint {
+	host = strings.ToLower(host)
+	key := protocol + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+	endpoint, ok := c.endpoints[key]
+	if !ok {
+		endpoint = &Endpoint{Host: host, Port: port, Protocol: protocol}
+		c.endpoints[key] = endpoint
+	}
+	if !slices.Contains(endpoint.Purposes, purpose) {
+		endpoint.Purposes = append(endpoint.Purposes, purpose)
+	}
+	return endpoint
+}
+
+func (c *collector) report() Report {
+	report := Report{Endpoints: make([]Endpoint, 0, len(c.endpoints)), Notes: c.notes}
+	for _, endpoint := range c.endpoints {
+		slices.Sort(endpoint.URLs)
+		report.Endpoints = append(report.Endpoints, *endpoint)
+	}
+	slices.SortFunc(report.Endpoints, func(a, b Endpoint) int {
+		return cmp.Or(cmp.Compare(a.Host, b.Host), cmp.Compare(a.Port, b.Port), cmp.Compare(a.Protocol, b.Protocol))
+	})
+	return report
+}
+
+// imageRegistry returns the registry host of an image reference, following
+// the Docker convention that a first path component without a dot, colon, or
+// "localhost" is a Docker Hub repository. Local archives have no registry.
+func imageRegistry(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "/") || strings.Contains(ref, "://") {
+		return ""
+	}
+	first, _, found := strings.Cut(ref, "/")
+	if !found || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return dockerHubDefault
+	}
+	return strings.ToLower(first)
+}
@@ -0,0 +1,147 @@
+package egress
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WriteCSV writes one row per endpoint with a header row.
+func WriteCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"host", "port", "protocol", "purposes", "urls"}); err != nil {
+		return err
+	}
+	for _, e := range report.Endpoints {
+		row := []string{e.Host, strconv.Itoa(e.Port), e.Protocol, strings.Join(e.Purposes, "; "), strings.Join(e.URLs, " ")}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePAC writes a proxy auto-config file that sends the report's hosts
+// through proxy, given as host:port, and everything else direct.
+func WritePAC(w io.Writer, report Report, proxy string) error {
+	var b strings.Builder
+	b.WriteString("// AKS Flex Node egress allowlist.\n")
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	for _, host := range hosts(report) {
+		if domain, ok := strings.CutPrefix(host, "*."); ok {
+			fmt.Fprintf(&b, "  if (dnsDomainIs(host, %q)) return %q;\n", "."+domain, "PROXY "+proxy)
+			continue
+		}
+		fmt.Fprintf(&b, "  if (host == %q) return %q;\n", host, "PROXY "+proxy)
+	}
+	b.WriteString("  return \"DIRECT\";\n}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteSquid writes squid ACLs allowing CONNECT and plain requests to the
+// report's hosts and ports.
+func WriteSquid(w io.Writer, report Report) error {
+	var b strings.Builder
+	b.WriteString("# AKS Flex Node egress allowlist.\n")
+	all := hosts(report)
+	for _, host := range all {
+		// squid matches ".example.com" as the domain and its subdomains, and
+		// rejects a host that such an entry already covers.
+		if coveredByWildcard(host, all) {
+			continue
+		}
+		fmt.Fprintf(&b, "acl aks_flex_node_dst dstdomain %s\n", strings.TrimPrefix(host, "*"))
+	}
+	for _, port := range ports(report) {
+		fmt.Fprintf(&b, "acl aks_flex_node_ports port %d\n", port)
+	}
+	b.WriteString("http_access allow aks_flex_node_dst aks_flex_node_ports\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteAzureFirewall writes an Azure CLI command that adds an Azure Firewall
+// application rule for each protocol and port, with the report's hosts as
+// target FQDNs. The firewall name and resource group are placeholders.
+func WriteAzureFirewall(w io.Writer, report Report) error {
+	type ruleKey struct {
+		protocol string
+		port     int
+	}
+	var keys []ruleKey
+	fqdns := map[ruleKey][]string{}
+	for _, e := range report.Endpoints {
+		key := ruleKey{protocol: e.Protocol, port: e.Port}
+		if _, ok := fqdns[key]; !ok {
+			keys = append(keys, key)
+		}
+		if !slices.Contains(fqdns[key], e.Host) {
+			fqdns[key] = append(fqdns[key], e.Host)
+		}
+	}
+	slices.SortFunc(keys, func(a, b ruleKey) int {
+		if a.protocol != b.protocol {
+			return strings.Compare(a.protocol, b.protocol)
+		}
+		return a.port - b.port
+	})
+
+	var b strings.Builder
+	b.WriteString("# AKS Flex Node egress allowlist. Replace <firewall> and <resource-group>.\n")
+	for i, key := range keys {
+		protocol := "Https"
+		if key.protocol == "http" {
+			protocol = "Http"
+		}
+		fmt.Fprintf(&b, "az network firewall application-rule create \\\n")
+		fmt.Fprintf(&b, "  --firewall-name <firewall> --resource-group <resource-group> \\\n")
+		fmt.Fprintf(&b, "  --collection-name aks-flex-node --name %s-%d \\\n", key.protocol, key.port)
+		if i == 0 {
+			fmt.Fprintf(&b, "  --priority 200 --action Allow \\\n")
+		}
+		fmt.Fprintf(&b, "  --source-addresses '*' --protocols %s=%d \\\n", protocol, key.port)
+		fmt.Fprintf(&b, "  --target-fqdns %s\n", strings.Join(fqdns[key], " "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// hosts returns the report's distinct hosts in order.
+func hosts(report Report) []string {
+	var out []string
+	for _, e := range report.Endpoints {
+		if !slices.Contains(out, e.Host) {
+			out = append(out, e.Host)
+		}
+	}
+	return out
+}
+
+// coveredByWildcard reports whether a "*." entry in all other than host
+// matches host.
+func coveredByWildcard(host string, all []string) bool {
+	for _, other := range all {
+		domain, ok := strings.CutPrefix(other, "*")
+		if ok && other != host && (strings.HasSuffix(host, domain) || host == domain[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ports returns the report's distinct ports in ascending order.
+func ports(report Report) []int {
+	var out []int
+	for _, e := range report.Endpoints {
+		if !slices.Contains(out, e.Port) {
+			out = append(out, e.Port)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
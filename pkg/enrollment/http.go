@@ -0,0 +1,79 @@
+package enrollment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+)
+
+// HTTPProvisionerName is the name of the built-in bearer token provisioner.
+const HTTPProvisionerName = "http"
+
+// maxResponseBytes bounds the response, which is a config document.
+const maxResponseBytes = 1 << 20
+
+func init() {
+	Register(HTTPProvisionerName, NewHTTPProvisioner)
+}
+
+type httpProvisioner struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPProvisioner returns a provisioner that POSTs the device identity to
+// endpoint with the enrollment token as a bearer token and expects a Result
+// document back. Only https endpoints are accepted, since the response
+// carries credentials.
+func NewHTTPProvisioner(endpoint string) (Provisioner, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid enrollment endpoint %q", endpoint)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("enrollment endpoint %q must use https", endpoint)
+	}
+	return &httpProvisioner{endpoint: endpoint, client: httpclient.New("enrollment", httpclient.KindRequest)}, nil
+}
+
+func (p *httpProvisioner) Provision(ctx context.Context, req Request) (*Result, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal enrollment request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create enrollment request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+req.Credential)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("enrollment request to %s: %w", p.endpoint, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // body close
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("read enrollment response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrollment rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("decode enrollment response: %w", err)
+	}
+	if len(result.Config) == 0 {
+		return nil, fmt.Errorf("enrollment response has no config")
+	}
+	return &result, nil
+}
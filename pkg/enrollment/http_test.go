@@ -0,0 +1,97 @@
+package enrollment
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestProvisioner(t *testing.T, handler http.HandlerFunc) Provisioner {
+	t.Helper()
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+	p, err := New(HTTPProvisionerName, srv.URL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	p.(*httpProvisioner).client = srv.Client()
+	return p
+}
+
+func TestHTTPProvisioner(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantConfig string
+		wantErr    string
+	}{
+		{
+			name:       "enrolled",
+			status:     http.StatusOK,
+			response:   `{"config": {"azure": {"tenantId": "t"}}}`,
+			wantConfig: `{"azure": {"tenantId": "t"}}`,
+		},
+		{
+			name:     "token rejected",
+			status:   http.StatusForbidden,
+			response: "token already used",
+			wantErr:  "status 403: token already used",
+		},
+		{
+			name:     "no config",
+			status:   http.StatusOK,
+			response: `{}`,
+			wantErr:  "no config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := newTestProvisioner(t, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer one-time" {
+					t.Errorf("Authorization = %q", got)
+				}
+				var req Request
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NodeName != "edge-1" || req.MachineID != "abc" {
+					t.Errorf("request = %+v, %v", req, err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			})
+			result, err := p.Provision(context.Background(), Request{Credential: "one-time", NodeName: "edge-1", MachineID: "abc"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Provision error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Provision: %v", err)
+			}
+			if string(result.Config) != tt.wantConfig {
+				t.Fatalf("config = %s, want %s", result.Config, tt.wantConfig)
+			}
+		})
+	}
+}
+
+func TestNewRejectsBadProvisioners(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct{ name, endpoint, wantErr string }{
+		{"tpm", "https://provision.example.com", "unknown enrollment provisioner"},
+		{HTTPProvisionerName, "http://provision.example.com", "must use https"},
+		{HTTPProvisionerName, "provision.example.com", "invalid enrollment endpoint"},
+	} {
+		if _, err := New(tt.name, tt.endpoint); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("New(%q, %q) error = %v, want %q", tt.name, tt.endpoint, err, tt.wantErr)
+		}
+	}
+}
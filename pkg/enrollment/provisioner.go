@@ -0,0 +1,67 @@
+// Package enrollment exchanges a factory-provisioned device's one-time
+// enrollment credential for its Arc onboarding credentials and node config,
+// so devices that cannot carry a service principal or run az login can still
+// bootstrap. The exchange itself is pluggable: the built-in "http" provisioner
+// presents a bearer token to a provisioning endpoint, and other mechanisms,
+// such as TPM attestation, register their own.
+package enrollment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Request identifies the device to the provisioning endpoint.
+type Request struct {
+	// Credential is the one-time enrollment token or attestation blob.
+	Credential string `json:"-"`
+	NodeName   string `json:"nodeName"`
+	MachineID  string `json:"machineId,omitempty"`
+}
+
+// Result is what the provisioning endpoint hands back.
+type Result struct {
+	// Config is the agent config document. Its azure section carries the Arc
+	// onboarding credentials, typically a scoped service principal.
+	Config json.RawMessage `json:"config"`
+}
+
+// Provisioner exchanges an enrollment credential for the device's config.
+type Provisioner interface {
+	Provision(ctx context.Context, req Request) (*Result, error)
+}
+
+// Factory returns a provisioner that talks to endpoint.
+type Factory func(endpoint string) (Provisioner, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a provisioner available under name. It panics on duplicate
+// names, as the registrations are fixed at init time.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("enrollment provisioner %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New returns the provisioner registered under name.
+func New(name, endpoint string) (Provisioner, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	names := slices.Sorted(maps.Keys(registry))
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown enrollment provisioner %q, registered: %v", name, names)
+	}
+	return factory(endpoint)
+}
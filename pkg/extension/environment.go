@@ -0,0 +1,50 @@
+// Package extension implements the Azure Arc machine extension handler
+// contract for the agent: it reads the handler environment and the sequenced
+// settings files the extension manager writes, turns the settings into the
+// agent config, and reports the outcome of each operation in the status file
+// format the extension manager polls.
+package extension
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// handlerEnvironmentFile is written by the extension manager into the
+// extension's root directory before any handler command runs.
+const handlerEnvironmentFile = "HandlerEnvironment.json"
+
+// Environment holds the directories the extension manager assigns to the
+// handler.
+type Environment struct {
+	LogFolder     string `json:"logFolder"`
+	ConfigFolder  string `json:"configFolder"`
+	StatusFolder  string `json:"statusFolder"`
+	HeartbeatFile string `json:"heartbeatFile,omitempty"`
+}
+
+// LoadEnvironment reads HandlerEnvironment.json from the extension directory.
+func LoadEnvironment(dir string) (*Environment, error) {
+	path := filepath.Join(dir, handlerEnvironmentFile)
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read handler environment: %w", err)
+	}
+	// The file is a single-element array wrapping the environment.
+	var envs []struct {
+		HandlerEnvironment Environment `json:"handlerEnvironment"`
+	}
+	if err := json.Unmarshal(data, &envs); err != nil {
+		return nil, fmt.Errorf("decode handler environment %s: %w", path, err)
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("handler environment %s is empty", path)
+	}
+	env := envs[0].HandlerEnvironment
+	if env.ConfigFolder == "" || env.StatusFolder == "" {
+		return nil, fmt.Errorf("handler environment %s is missing configFolder or statusFolder", path)
+	}
+	return &env, nil
+}
@@ -0,0 +1,173 @@
+package extension
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+// sequenceNumberEnv is set by the extension manager to the sequence number of
+// the settings the current command should apply.
+const sequenceNumberEnv = "ConfigSequenceNumber"
+
+// DefaultCertDir is where the guest agent places the certificates that
+// encrypt protected settings.
+const DefaultCertDir = "/var/lib/waagent"
+
+// Settings is one sequenced settings file.
+type Settings struct {
+	SequenceNumber int
+	Public         json.RawMessage
+	Protected      json.RawMessage
+}
+
+type settingsFile struct {
+	RuntimeSettings []struct {
+		HandlerSettings struct {
+			PublicSettings                  json.RawMessage `json:"publicSettings"`
+			ProtectedSettings               json.RawMessage `json:"protectedSettings"`
+			ProtectedSettingsCertThumbprint string          `json:"protectedSettingsCertThumbprint"`
+		} `json:"handlerSettings"`
+	} `json:"runtimeSettings"`
+}
+
+// SequenceNumber returns the sequence number the extension manager asked for,
+// falling back to the newest settings file in the config folder. It returns
+// -1 when there are no settings yet, as during install.
+func (e *Environment) SequenceNumber() (int, error) {
+	if v := os.Getenv(sequenceNumberEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", sequenceNumberEnv, v, err)
+		}
+		return n, nil
+	}
+	entries, err := os.ReadDir(e.ConfigFolder)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("list extension config folder: %w", err)
+	}
+	seq := -1
+	for _, entry := range entries {
+		n, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".settings"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".settings") {
+			continue
+		}
+		seq = max(seq, n)
+	}
+	return seq, nil
+}
+
+// LoadSettings reads the settings for seq, decrypting the protected settings
+// with the certificate in certDir named by their thumbprint.
+func (e *Environment) LoadSettings(ctx context.Context, seq int, certDir string) (*Settings, error) {
+	path := filepath.Join(e.ConfigFolder, strconv.Itoa(seq)+".settings")
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read extension settings: %w", err)
+	}
+	var file settingsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode extension settings %s: %w", path, err)
+	}
+	settings := &Settings{SequenceNumber: seq}
+	if len(file.RuntimeSettings) == 0 {
+		return settings, nil
+	}
+	handler := file.RuntimeSettings[0].HandlerSettings
+	settings.Public = handler.PublicSettings
+	settings.Protected, err = protectedSettings(ctx, handler.ProtectedSettings, handler.ProtectedSettingsCertThumbprint, certDir)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// protectedSettings returns the protected settings as JSON. They arrive either
+// as a base64 PKCS#7 envelope encrypted to the certificate with thumbprint, or,
+// when no thumbprint is given, as plain JSON.
+func protectedSettings(ctx context.Context, raw json.RawMessage, thumbprint, certDir string) (json.RawMessage, error) {
+	if isNull(raw) {
+		return nil, nil
+	}
+	var encrypted string
+	if err := json.Unmarshal(raw, &encrypted); err != nil {
+		return raw, nil
+	}
+	if encrypted == "" {
+		return nil, nil
+	}
+	if thumbprint == "" {
+		return nil, fmt.Errorf("protected settings are encrypted but no certificate thumbprint was given")
+	}
+	envelope, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decode protected settings: %w", err)
+	}
+
+	cmd := utilexec.New().CommandContext(ctx, "openssl", "smime", "-inform", "DER", "-decrypt",
+		"-recip", filepath.Join(certDir, thumbprint+".crt"),
+		"-inkey", filepath.Join(certDir, thumbprint+".prv"))
+	cmd.Stdin = bytes.NewReader(envelope)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	plain, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("decrypt protected settings with certificate %s: %w: %s", thumbprint, err, strings.TrimSpace(stderr.String()))
+	}
+	if !json.Valid(plain) {
+		return nil, fmt.Errorf("decrypted protected settings are not JSON")
+	}
+	return plain, nil
+}
+
+// Config returns the agent config the settings describe: the public settings
+// with the protected settings merged over them, so secrets such as a service
+// principal's client secret or a bootstrap token can be kept out of the
+// public half.
+func (s *Settings) Config() ([]byte, error) {
+	merged := map[string]any{}
+	for _, part := range []json.RawMessage{s.Public, s.Protected} {
+		if isNull(part) {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal(part, &m); err != nil {
+			return nil, fmt.Errorf("extension settings must be a JSON object: %w", err)
+		}
+		mergeInto(merged, m)
+	}
+	if len(merged) == 0 {
+		return nil, fmt.Errorf("extension settings are empty")
+	}
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+// mergeInto merges src into dst, recursing into objects present in both.
+func mergeInto(dst, src map[string]any) {
+	for k, v := range src {
+		srcObj, srcIsObj := v.(map[string]any)
+		dstObj, dstIsObj := dst[k].(map[string]any)
+		if srcIsObj && dstIsObj {
+			mergeInto(dstObj, srcObj)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func isNull(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
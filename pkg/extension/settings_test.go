@@ -0,0 +1,123 @@
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestEnvironment(t *testing.T) *Environment {
+	t.Helper()
+	dir := t.TempDir()
+	env := Environment{
+		LogFolder:    filepath.Join(dir, "log"),
+		ConfigFolder: filepath.Join(dir, "config"),
+		StatusFolder: filepath.Join(dir, "status"),
+	}
+	data, err := json.Marshal([]map[string]any{{"version": 1.0, "handlerEnvironment": env}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, handlerEnvironmentFile), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadEnvironment(dir)
+	if err != nil {
+		t.Fatalf("LoadEnvironment: %v", err)
+	}
+	if *loaded != env {
+		t.Fatalf("environment = %+v, want %+v", *loaded, env)
+	}
+	return loaded
+}
+
+func writeSettings(t *testing.T, env *Environment, name, body string) {
+	t.Helper()
+	if err := os.MkdirAll(env.ConfigFolder, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(env.ConfigFolder, name), []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSequenceNumberPicksNewestSettings(t *testing.T) {
+	t.Parallel()
+
+	env := writeTestEnvironment(t)
+	seq, err := env.SequenceNumber()
+	if err != nil || seq != -1 {
+		t.Fatalf("SequenceNumber without settings = %d, %v; want -1", seq, err)
+	}
+
+	for _, name := range []string{"0.settings", "2.settings", "10.settings", "11.settings.bak", "HandlerState"} {
+		writeSettings(t, env, name, "{}")
+	}
+	seq, err = env.SequenceNumber()
+	if err != nil || seq != 10 {
+		t.Fatalf("SequenceNumber = %d, %v; want 10", seq, err)
+	}
+}
+
+func TestLoadSettingsMergesProtectedOverPublic(t *testing.T) {
+	t.Parallel()
+
+	env := writeTestEnvironment(t)
+	writeSettings(t, env, "3.settings", `{"runtimeSettings": [{"handlerSettings": {
+		"publicSettings": {"azure": {"subscriptionId": "sub", "servicePrincipal": {"clientId": "app"}}, "agent": {"logLevel": "info"}},
+		"protectedSettings": {"azure": {"servicePrincipal": {"clientSecret": "secret"}}}
+	}}]}`)
+
+	settings, err := env.LoadSettings(context.Background(), 3, t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadSettings: %v", err)
+	}
+	data, err := settings.Config()
+	if err != nil {
+		t.Fatalf("Config: %v", err)
+	}
+	var got struct {
+		Azure struct {
+			SubscriptionID   string `json:"subscriptionId"`
+			ServicePrincipal struct {
+				ClientID     string `json:"clientId"`
+				ClientSecret string `json:"clientSecret"`
+			} `json:"servicePrincipal"`
+		} `json:"azure"`
+		Agent struct {
+			LogLevel string `json:"logLevel"`
+		} `json:"agent"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Azure.SubscriptionID != "sub" || got.Azure.ServicePrincipal.ClientID != "app" ||
+		got.Azure.ServicePrincipal.ClientSecret != "secret" || got.Agent.LogLevel != "info" {
+		t.Fatalf("merged config = %s", data)
+	}
+}
+
+func TestLoadSettingsRejectsEncryptedWithoutThumbprint(t *testing.T) {
+	t.Parallel()
+
+	env := writeTestEnvironment(t)
+	writeSettings(t, env, "0.settings", `{"runtimeSettings": [{"handlerSettings": {"protectedSettings": "MIIB"}}]}`)
+	if _, err := env.LoadSettings(context.Background(), 0, t.TempDir()); err == nil {
+		t.Fatal("LoadSettings succeeded, want error")
+	}
+}
+
+func TestConfigRejectsEmptySettings(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []Settings{{}, {Public: json.RawMessage("null")}} {
+		if _, err := s.Config(); err == nil {
+			t.Fatalf("Config(%+v) succeeded, want error", s)
+		}
+	}
+	if _, err := (&Settings{Public: json.RawMessage(`["not", "an", "object"]`)}).Config(); err == nil {
+		t.Fatal("Config with array settings succeeded, want error")
+	}
+}
@@ -0,0 +1,71 @@
+package extension
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// statusName identifies the agent in the extension status the portal shows.
+const statusName = "AKS Flex Node agent"
+
+// State is the state of an extension operation.
+type State string
+
+const (
+	StateTransitioning State = "transitioning"
+	StateSuccess       State = "success"
+	StateError         State = "error"
+)
+
+type statusFile struct {
+	Version      float64      `json:"version"`
+	TimestampUTC string       `json:"timestampUTC"`
+	Status       statusReport `json:"status"`
+}
+
+type statusReport struct {
+	Name             string           `json:"name"`
+	Operation        string           `json:"operation"`
+	Status           State            `json:"status"`
+	Code             int              `json:"code"`
+	FormattedMessage formattedMessage `json:"formattedMessage"`
+}
+
+type formattedMessage struct {
+	Lang    string `json:"lang"`
+	Message string `json:"message"`
+}
+
+// WriteStatus reports the state of operation for the settings with sequence
+// number seq. The file is replaced atomically, since the extension manager
+// may read it at any time.
+func (e *Environment) WriteStatus(seq int, operation string, state State, message string) error {
+	code := 0
+	if state == StateError {
+		code = 1
+	}
+	data, err := json.Marshal([]statusFile{{
+		Version:      1.0,
+		TimestampUTC: time.Now().UTC().Format(time.RFC3339),
+		Status: statusReport{
+			Name:             statusName,
+			Operation:        operation,
+			Status:           state,
+			Code:             code,
+			FormattedMessage: formattedMessage{Lang: "en-US", Message: message},
+		},
+	}})
+	if err != nil {
+		return fmt.Errorf("marshal extension status: %w", err)
+	}
+	path := filepath.Join(e.StatusFolder, strconv.Itoa(seq)+".status")
+	if err := utilio.WriteFile(path, data, 0o644); err != nil { //nolint:gosec // read by the extension manager
+		return fmt.Errorf("write extension status %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package extension
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		state    State
+		wantCode int
+	}{
+		{StateTransitioning, 0},
+		{StateSuccess, 0},
+		{StateError, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			t.Parallel()
+
+			env := &Environment{StatusFolder: t.TempDir()}
+			if err := env.WriteStatus(4, "enable", tt.state, "message"); err != nil {
+				t.Fatalf("WriteStatus: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(env.StatusFolder, "4.status"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []statusFile
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("decode status: %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("status entries = %d, want 1", len(got))
+			}
+			status := got[0].Status
+			if status.Operation != "enable" || status.Status != tt.state || status.Code != tt.wantCode || status.FormattedMessage.Message != "message" {
+				t.Fatalf("status = %+v", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Package hooks runs the operator scripts configured at the hook points of
+// the bootstrap pipeline, from preBootstrap through preUnbootstrap before a
+// node is torn down. Hooks run on the host with a timeout, get the node's
+// facts as AKS_FLEX_NODE_* environment variables, and have their combined
+// output kept in a log file under the agent log directory.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const (
+	// maxOutput bounds how much of a hook's output is kept. A chatty hook
+	// keeps its last maxOutput bytes.
+	maxOutput = 64 << 10
+	// errorOutput bounds how much of a failed hook's output is quoted in the
+	// returned error.
+	errorOutput = 1 << 10
+	// waitDelay is how long a timed-out hook's output pipes may stay open
+	// after it was killed, for example by a child that left its group.
+	waitDelay = 10 * time.Second
+)
+
+// Facts are the per-step values exported to hooks next to the node's
+// configuration.
+type Facts struct {
+	// Machine and MachineDir name the nspawn machine being brought up. They
+	// are empty at host-only points.
+	Machine    string
+	MachineDir string
+}
+
+// Run returns a task that runs the hooks configured for point in order. A
+// failed hook fails the task unless its onFailure policy is "continue".
+func Run(log *slog.Logger, cfg *config.Config, point string, facts Facts) phases.Task {
+	return &runTask{log: log, cfg: cfg, point: point, facts: facts, hooks: cfg.Hooks.At(point)}
+}
+
+type runTask struct {
+	log   *slog.Logger
+	cfg   *config.Config
+	point string
+	facts Facts
+	hooks []config.HookConfig
+}
+
+func (t *runTask) Name() string { return "hooks-" + t.point }
+
+func (t *runTask) Do(ctx context.Context) error {
+	for i, hook := range t.hooks {
+		err := t.run(ctx, i, hook)
+		if err == nil {
+			continue
+		}
+		if !hook.ContinueOnFailure() || ctx.Err() != nil {
+			return err
+		}
+		t.log.Warn("hook failed, continuing", "hook", t.point, "path", hook.Path, "error", err)
+	}
+	return nil
+}
+
+func (t *runTask) run(ctx context.Context, index int, hook config.HookConfig) error {
+	timeout := hook.TimeoutOrDefault()
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output := &tailBuffer{limit: maxOutput}
+	cmd := exec.CommandContext(runCtx, hook.Path, hook.Args...) //nolint:gosec // operator-configured hook
+	cmd.Env = t.env(hook)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Run the hook in its own process group and kill the whole group on
+	// timeout, so children it started do not outlive it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = waitDelay
+
+	t.log.Info("running hook", "hook", t.point, "path", hook.Path)
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start).Round(time.Millisecond)
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	logPath := t.logPath(index)
+	if logPath != "" {
+		if werr := utilio.WriteFile(logPath, output.Bytes(), 0o600); werr != nil {
+			t.log.Warn("failed to save hook output", "path", logPath, "error", werr)
+			logPath = ""
+		}
+	}
+	detail := t.point + " succeeded"
+	if err != nil {
+		detail = t.point + " failed: " + err.Error()
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationHookRun, Target: hook.Path, Detail: detail})
+
+	if err != nil {
+		tail := strings.TrimSpace(output.Tail(errorOutput))
+		if tail == "" {
+			return fmt.Errorf("%s hook %s: %w", t.point, hook.Path, err)
+		}
+		return fmt.Errorf("%s hook %s: %w: %s", t.point, hook.Path, err, tail)
+	}
+	t.log.Info("hook finished", "hook", t.point, "path", hook.Path, "duration", duration, "output", logPath)
+	return nil
+}
+
+// env returns the agent's environment with the hook's own variables and the
+// node facts added. Facts win over the hook's variables of the same name.
+func (t *runTask) env(hook config.HookConfig) []string {
+	env := os.Environ()
+	for name, value := range hook.Env {
+		env = append(env, name+"="+value)
+	}
+	facts := map[string]string{
+		"AKS_FLEX_NODE_HOOK":               t.point,
+		"AKS_FLEX_NODE_NODE_NAME":          t.cfg.Agent.NodeName,
+		"AKS_FLEX_NODE_INSTANCE":           string(t.cfg.Instance),
+		"AKS_FLEX_NODE_STATE_DIR":          t.cfg.Instance.StateDir(),
+		"AKS_FLEX_NODE_KUBERNETES_VERSION": t.cfg.Components.Kubernetes,
+		"AKS_FLEX_NODE_MACHINE":            t.facts.Machine,
+		"AKS_FLEX_NODE_MACHINE_DIR":        t.facts.MachineDir,
+	}
+	if cluster := t.cfg.Azure.TargetCluster; cluster != nil {
+		facts["AKS_FLEX_NODE_CLUSTER_RESOURCE_ID"] = cluster.ResourceID
+		facts["AKS_FLEX_NODE_LOCATION"] = cluster.Location
+	}
+	if arc := t.cfg.Azure.Arc; arc != nil && arc.Enabled {
+		facts["AKS_FLEX_NODE_ARC_MACHINE_NAME"] = arc.MachineName
+	}
+	for name, value := range facts {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// logPath returns where the output of the hook at index is kept, or "" when
+// no log directory is configured.
+func (t *runTask) logPath(index int) string {
+	if t.cfg.Agent.LogDir == "" {
+		return ""
+	}
+	dir := filepath.Join(t.cfg.Agent.LogDir, "hooks")
+	if t.cfg.Instance != "" {
+		dir = filepath.Join(dir, string(t.cfg.Instance))
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%d.log", t.point, index))
+}
+
+// tailBuffer keeps the last limit bytes written to it. The hook's stdout and
+// stderr share one, so writes are serialized.
+type tailBuffer struct {
+	limit int
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the kept output.
+func (b *tailBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf...)
+}
+
+// Tail returns at most the last n bytes of the kept output.
+func (b *tailBuffer) Tail(n int) string {
+	out := b.Bytes()
+	if len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return string(out)
+}
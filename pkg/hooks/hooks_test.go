@@ -0,0 +1,113 @@
+package hooks
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil { //nolint:gosec // test hook must be executable
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunExportsFactsAndKeepsOutput(t *testing.T) {
+	t.Parallel()
+
+	logDir := t.TempDir()
+	cfg := &config.Config{
+		Agent:      config.AgentConfig{NodeName: "node-a", LogDir: logDir},
+		Components: config.ComponentsConfig{Kubernetes: "1.33.2"},
+		Hooks: config.HooksConfig{PreKubelet: []config.HookConfig{{
+			Path: writeScript(t, `echo "$AKS_FLEX_NODE_HOOK $AKS_FLEX_NODE_NODE_NAME $AKS_FLEX_NODE_KUBERNETES_VERSION $AKS_FLEX_NODE_MACHINE $SITE $1"`),
+			Args: []string{"arg"},
+			Env:  map[string]string{"SITE": "lab", "AKS_FLEX_NODE_MACHINE": "overridden"},
+		}}},
+	}
+	task := Run(slog.New(slog.DiscardHandler), cfg, config.HookPreKubelet, Facts{Machine: "kube1", MachineDir: "/var/lib/machines/kube1"})
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(logDir, "hooks", "preKubelet-0.log")) //nolint:gosec // test path
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "preKubelet node-a 1.33.2 kube1 lab arg\n"; string(got) != want {
+		t.Errorf("hook output = %q, want %q", got, want)
+	}
+}
+
+func TestRunFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	second := config.HookConfig{Path: writeScript(t, "touch "+marker)}
+	tests := []struct {
+		name      string
+		onFailure string
+		wantErr   bool
+	}{
+		{name: "abort", onFailure: config.HookAbort, wantErr: true},
+		{name: "default", wantErr: true},
+		{name: "continue", onFailure: config.HookContinue},
+	}
+	for _, tt := range tests {
+		_ = os.Remove(marker)
+		cfg := &config.Config{Hooks: config.HooksConfig{PreBootstrap: []config.HookConfig{
+			{Path: writeScript(t, "echo edr install failed >&2; exit 3"), OnFailure: tt.onFailure},
+			second,
+		}}}
+		err := Run(slog.New(slog.DiscardHandler), cfg, config.HookPreBootstrap, Facts{}).Do(t.Context())
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: Do() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "edr install failed") {
+			t.Errorf("%s: Do() error = %v, want the hook output quoted", tt.name, err)
+		}
+		if _, serr := os.Stat(marker); (serr == nil) == tt.wantErr {
+			t.Errorf("%s: second hook ran = %v, want %v", tt.name, serr == nil, !tt.wantErr)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Hooks: config.HooksConfig{PostArc: []config.HookConfig{{
+		Path:    writeScript(t, "sleep 30"),
+		Timeout: config.JSONDuration(100 * time.Millisecond),
+	}}}}
+	start := time.Now()
+	err := Run(slog.New(slog.DiscardHandler), cfg, config.HookPostArc, Facts{}).Do(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Do() error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Do() took %v, want the hook killed at its timeout", elapsed)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	t.Parallel()
+
+	b := &tailBuffer{limit: 4}
+	_, _ = b.Write([]byte("abc"))
+	_, _ = b.Write([]byte("defg"))
+	if got := string(b.Bytes()); got != "defg" {
+		t.Errorf("Bytes() = %q, want %q", got, "defg")
+	}
+	if got := b.Tail(2); got != "fg" {
+		t.Errorf("Tail(2) = %q, want %q", got, "fg")
+	}
+}
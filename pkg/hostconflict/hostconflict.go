@@ -0,0 +1,272 @@
+// Package hostconflict finds host software that manages its own kubelet or
+// container runtime next to the agent's nspawn machines, such as kubeadm
+// leftovers or distribution kubelet and containerd packages, and can
+// quarantine it for the lifetime of the node.
+package hostconflict
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+// Kind classifies a conflict.
+type Kind string
+
+const (
+	// KindUnit is a systemd unit that runs a kubelet or container runtime on
+	// the host.
+	KindUnit Kind = "unit"
+	// KindPackage is a distribution package that ships such a unit and that
+	// unattended upgrades would update, and restart, behind the agent.
+	KindPackage Kind = "package"
+	// KindKubeadm is state a kubeadm join or init left on the host.
+	KindKubeadm Kind = "kubeadm"
+)
+
+// Package managers a KindPackage conflict can come from.
+const (
+	ManagerDpkg = "dpkg"
+	ManagerRPM  = "rpm"
+)
+
+// Conflict is one piece of competing host software.
+type Conflict struct {
+	Kind Kind   `json:"kind"`
+	Name string `json:"name"`
+	// Path is the unit file or kubeadm file that was found.
+	Path string `json:"path,omitempty"`
+	// Manager is the package manager that owns a package.
+	Manager string `json:"manager,omitempty"`
+	// Quarantined reports that the unit is masked or the package is held,
+	// either by Quarantine or by an administrator.
+	Quarantined bool `json:"quarantined"`
+}
+
+func (c Conflict) String() string {
+	switch c.Kind {
+	case KindUnit:
+		return fmt.Sprintf("unit %s (%s)", c.Name, c.Path)
+	case KindPackage:
+		return fmt.Sprintf("%s package %s", c.Manager, c.Name)
+	default:
+		return fmt.Sprintf("kubeadm %s (%s)", c.Name, c.Path)
+	}
+}
+
+// competingUnits run a kubelet or container runtime directly on the host.
+// docker is left out: bootstrap already masks it.
+var competingUnits = []string{
+	"kubelet.service",
+	"containerd.service",
+	"crio.service",
+	"k3s.service",
+	"k3s-agent.service",
+	"rke2-server.service",
+	"rke2-agent.service",
+	"snap.microk8s.daemon-kubelite.service",
+}
+
+// competingPackages ship the units above.
+var competingPackages = []string{
+	"kubelet",
+	"kubeadm",
+	"containerd",
+	"containerd.io",
+	"cri-o",
+}
+
+// unitDirs are the systemd unit search paths, most specific first.
+var unitDirs = []string{
+	"/etc/systemd/system",
+	"/run/systemd/system",
+	"/usr/local/lib/systemd/system",
+	"/usr/lib/systemd/system",
+	"/lib/systemd/system",
+}
+
+// kubeadmPaths are files kubeadm writes on the host. The agent's kubelet
+// keeps its configuration inside the nspawn machine, so none of them belong
+// to the agent.
+var kubeadmPaths = map[string]string{
+	"kubelet-kubeconfig": "/etc/kubernetes/kubelet.conf",
+	"bootstrap-config":   "/etc/kubernetes/bootstrap-kubelet.conf",
+	"kubelet-flags":      "/var/lib/kubelet/kubeadm-flags.env",
+	"static-pods":        "/etc/kubernetes/manifests",
+}
+
+const dpkgStatusPath = "/var/lib/dpkg/status"
+
+// Scanner looks for conflicts on the host under root.
+type Scanner struct {
+	root utilhost.Root
+	// rpmPackages returns which of names rpm reports installed. It is nil on
+	// hosts without rpm.
+	rpmPackages func(ctx context.Context, names []string) ([]string, error)
+}
+
+// NewScanner returns a Scanner for the host under root.
+func NewScanner(root utilhost.Root) *Scanner {
+	s := &Scanner{root: root}
+	if _, err := exec.LookPath("rpm"); err == nil {
+		s.rpmPackages = func(ctx context.Context, names []string) ([]string, error) {
+			return queryRPM(ctx, root, names)
+		}
+	}
+	return s
+}
+
+// Scan returns every conflict found, quarantined ones included.
+func (s *Scanner) Scan(ctx context.Context) ([]Conflict, error) {
+	conflicts := s.scanUnits()
+	packages, err := s.scanPackages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conflicts = append(conflicts, packages...)
+	return append(conflicts, s.scanKubeadm()...), nil
+}
+
+func (s *Scanner) path(p string) string {
+	return s.root.Path(p)
+}
+
+// scanUnits reports the first unit file systemd would load for each
+// competing unit. A unit linked to /dev/null is masked.
+func (s *Scanner) scanUnits() []Conflict {
+	var conflicts []Conflict
+	for _, unit := range competingUnits {
+		for _, dir := range unitDirs {
+			path := filepath.Join(dir, unit)
+			info, err := os.Lstat(s.path(path))
+			if err != nil {
+				continue
+			}
+			masked := false
+			if info.Mode()&os.ModeSymlink != 0 {
+				target, _ := os.Readlink(s.path(path))
+				masked = target == os.DevNull
+			}
+			conflicts = append(conflicts, Conflict{Kind: KindUnit, Name: unit, Path: path, Quarantined: masked})
+			break
+		}
+	}
+	return conflicts
+}
+
+func (s *Scanner) scanPackages(ctx context.Context) ([]Conflict, error) {
+	conflicts, err := s.scanDpkg()
+	if err != nil {
+		return nil, err
+	}
+	if s.rpmPackages == nil {
+		return conflicts, nil
+	}
+	installed, err := s.rpmPackages(ctx, competingPackages)
+	if err != nil {
+		return nil, fmt.Errorf("query rpm packages: %w", err)
+	}
+	for _, name := range installed {
+		conflicts = append(conflicts, Conflict{Kind: KindPackage, Name: name, Manager: ManagerRPM})
+	}
+	return conflicts, nil
+}
+
+// scanDpkg reads the dpkg status database directly, which is faster than a
+// dpkg-query per package and works without dpkg on PATH.
+func (s *Scanner) scanDpkg() ([]Conflict, error) {
+	f, err := os.Open(s.path(dpkgStatusPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open dpkg status: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	return parseDpkgStatus(f)
+}
+
+// parseDpkgStatus returns the competing packages that are installed. The
+// first word of the Status field is the selection, which is "hold" for a
+// package apt-mark held.
+func parseDpkgStatus(r io.Reader) ([]Conflict, error) {
+	var conflicts []Conflict
+	var name, status string
+	flush := func() {
+		fields := strings.Fields(status)
+		if slices.Contains(competingPackages, name) && len(fields) == 3 && fields[2] == "installed" {
+			conflicts = append(conflicts, Conflict{Kind: KindPackage, Name: name, Manager: ManagerDpkg, Quarantined: fields[0] == "hold"})
+		}
+		name, status = "", ""
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "Package: "):
+			name = strings.TrimPrefix(line, "Package: ")
+		case strings.HasPrefix(line, "Status: "):
+			status = strings.TrimPrefix(line, "Status: ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read dpkg status: %w", err)
+	}
+	flush()
+	return conflicts, nil
+}
+
+func (s *Scanner) scanKubeadm() []Conflict {
+	var conflicts []Conflict
+	for _, name := range slices.Sorted(maps.Keys(kubeadmPaths)) {
+		path := kubeadmPaths[name]
+		info, err := os.Stat(s.path(path))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			entries, err := os.ReadDir(s.path(path))
+			if err != nil || len(entries) == 0 {
+				continue
+			}
+		}
+		conflicts = append(conflicts, Conflict{Kind: KindKubeadm, Name: name, Path: path})
+	}
+	return conflicts
+}
+
+// queryRPM asks rpm for names in the database under root. rpm exits
+// non-zero when any of them is not installed, so the output is parsed
+// regardless of the exit status.
+func queryRPM(ctx context.Context, root utilhost.Root, names []string) ([]string, error) {
+	args := []string{"-q", "--qf", "%{NAME}\n"}
+	if !root.IsHost() {
+		args = append(args, "--root", string(root))
+	}
+	args = append(args, names...)
+	out, err := exec.CommandContext(ctx, "rpm", args...).Output() // #nosec G204 -- fixed binary and package names
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	var installed []string
+	for line := range strings.Lines(string(out)) {
+		if name := strings.TrimSpace(line); slices.Contains(names, name) {
+			installed = append(installed, name)
+		}
+	}
+	return installed, nil
+}
@@ -0,0 +1,182 @@
+package hostconflict
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+const testDpkgStatus = `Package: curl
+Status: install ok installed
+Version: 8.5.0
+
+Package: kubelet
+Status: install ok installed
+Version: 1.30.0
+
+Package: kubeadm
+Status: hold ok installed
+Version: 1.30.0
+
+Package: containerd
+Status: deinstall ok config-files
+Version: 1.7.12
+`
+
+func writeHostFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestHost(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeHostFile(t, root, "/lib/systemd/system/kubelet.service", "[Service]\n")
+	writeHostFile(t, root, "/lib/systemd/system/containerd.service", "[Service]\n")
+	if err := os.MkdirAll(filepath.Join(root, "/etc/systemd/system"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.DevNull, filepath.Join(root, "/etc/systemd/system/containerd.service")); err != nil {
+		t.Fatal(err)
+	}
+	writeHostFile(t, root, dpkgStatusPath, testDpkgStatus)
+	writeHostFile(t, root, "/etc/kubernetes/manifests/kube-proxy.yaml", "kind: Pod\n")
+	return root
+}
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+
+	root := newTestHost(t)
+	scanner := &Scanner{
+		root: utilhost.Root(root),
+		rpmPackages: func(_ context.Context, names []string) ([]string, error) {
+			if !slices.Contains(names, "cri-o") {
+				t.Errorf("rpm query = %v, want cri-o included", names)
+			}
+			return []string{"cri-o"}, nil
+		},
+	}
+	conflicts, err := scanner.Scan(t.Context())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	want := []Conflict{
+		{Kind: KindUnit, Name: "kubelet.service", Path: "/lib/systemd/system/kubelet.service"},
+		{Kind: KindUnit, Name: "containerd.service", Path: "/etc/systemd/system/containerd.service", Quarantined: true},
+		{Kind: KindPackage, Name: "kubelet", Manager: ManagerDpkg},
+		{Kind: KindPackage, Name: "kubeadm", Manager: ManagerDpkg, Quarantined: true},
+		{Kind: KindPackage, Name: "cri-o", Manager: ManagerRPM},
+		{Kind: KindKubeadm, Name: "static-pods", Path: "/etc/kubernetes/manifests"},
+	}
+	if !slices.Equal(conflicts, want) {
+		t.Fatalf("Scan() =\n%v\nwant\n%v", conflicts, want)
+	}
+}
+
+func TestScanCleanHost(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	// An empty manifests directory is what the kubernetes packages leave.
+	if err := os.MkdirAll(filepath.Join(root, "/etc/kubernetes/manifests"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err := (&Scanner{root: utilhost.Root(root)}).Scan(t.Context())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("Scan() = %v, want none", conflicts)
+	}
+}
+
+type recordedActions struct {
+	calls []string
+}
+
+func (r *recordedActions) actions() hostActions {
+	record := func(verb string) func(context.Context, []string) error {
+		return func(_ context.Context, names []string) error {
+			r.calls = append(r.calls, verb+" "+strings.Join(names, ","))
+			return nil
+		}
+	}
+	return hostActions{
+		maskUnits:      record("mask"),
+		unmaskUnits:    record("unmask"),
+		holdPackages:   record("hold"),
+		unholdPackages: record("unhold"),
+	}
+}
+
+func TestQuarantineAndRelease(t *testing.T) {
+	t.Parallel()
+
+	root := newTestHost(t)
+	recordPath := filepath.Join(t.TempDir(), "conflict-quarantine.json")
+	host := &recordedActions{}
+	log := slog.New(slog.DiscardHandler)
+
+	quarantine := &quarantineTask{log: log, enabled: true, scanner: &Scanner{root: utilhost.Root(root)}, recordPath: recordPath, actions: host.actions()}
+	if err := quarantine.Do(t.Context()); err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	// Already masked and held conflicts are the administrator's and are left
+	// out of the record.
+	want := []string{"mask kubelet.service", "hold kubelet"}
+	if !slices.Equal(host.calls, want) {
+		t.Fatalf("quarantine calls = %v, want %v", host.calls, want)
+	}
+	record, err := loadRecord(recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(record.MaskedUnits, []string{"kubelet.service"}) || !slices.Equal(record.HeldPackages, []string{"kubelet"}) {
+		t.Fatalf("record = %+v", record)
+	}
+
+	host.calls = nil
+	release := &releaseTask{log: log, recordPath: recordPath, actions: host.actions()}
+	if err := release.Do(t.Context()); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	want = []string{"unmask kubelet.service", "unhold kubelet"}
+	if !slices.Equal(host.calls, want) {
+		t.Fatalf("release calls = %v, want %v", host.calls, want)
+	}
+	if _, err := os.Stat(recordPath); !os.IsNotExist(err) {
+		t.Fatalf("record still present: %v", err)
+	}
+
+	host.calls = nil
+	if err := release.Do(t.Context()); err != nil || len(host.calls) != 0 {
+		t.Fatalf("second release = %v, calls %v; want no-op", err, host.calls)
+	}
+}
+
+func TestQuarantineDisabled(t *testing.T) {
+	t.Parallel()
+
+	host := &recordedActions{}
+	task := &quarantineTask{log: slog.New(slog.DiscardHandler), scanner: &Scanner{root: utilhost.Root(newTestHost(t))}, recordPath: filepath.Join(t.TempDir(), "record.json"), actions: host.actions()}
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if len(host.calls) != 0 {
+		t.Fatalf("calls = %v, want none", host.calls)
+	}
+}
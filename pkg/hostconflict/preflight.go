@@ -0,0 +1,49 @@
+package hostconflict
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+const checkName = "host-conflicts"
+
+// Preflight returns the host conflict check. Conflicts are warnings rather
+// than errors: a host containerd left over from Docker can coexist, while a
+// second kubelet fights the agent's for ports and cgroups, and only the
+// operator knows which one they have.
+func Preflight(quarantine bool) []preflight.Checker {
+	return []preflight.Checker{conflictChecker{scanner: NewScanner(utilhost.HostRoot), quarantine: quarantine}}
+}
+
+type conflictChecker struct {
+	scanner    *Scanner
+	quarantine bool
+}
+
+func (conflictChecker) Name() string { return checkName }
+
+func (c conflictChecker) Check(ctx context.Context) []preflight.Result {
+	conflicts, err := c.scanner.Scan(ctx)
+	if err != nil {
+		return preflight.ResultsWarning(checkName, "host", "could not scan for conflicting software: %v", err)
+	}
+	var found []string
+	for _, conflict := range conflicts {
+		if !conflict.Quarantined {
+			found = append(found, conflict.String())
+		}
+	}
+	if len(found) == 0 {
+		return preflight.ResultsOK(checkName, "host", "no competing kubelet or container runtime was found")
+	}
+	if c.quarantine {
+		return preflight.ResultsWarning(checkName, "host",
+			"competing software will be quarantined by bootstrap: %s", strings.Join(found, ", "))
+	}
+	return preflight.ResultsWarning(checkName, "host",
+		"competing software manages a kubelet or container runtime: %s; remove it or set agent.quarantineConflicts", strings.Join(found, ", "))
+}
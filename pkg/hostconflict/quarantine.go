@@ -0,0 +1,217 @@
+package hostconflict
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+// RecordPath lists what Quarantine changed, so Release reverts exactly that
+// and leaves units and holds an administrator set alone.
+const RecordPath = config.ConfigDir + "/conflict-quarantine.json"
+
+// Record is the persisted list of quarantined units and packages.
+type Record struct {
+	MaskedUnits  []string `json:"maskedUnits,omitempty"`
+	HeldPackages []string `json:"heldPackages,omitempty"`
+}
+
+// hostActions performs the host mutations; tests replace them.
+type hostActions struct {
+	maskUnits      func(ctx context.Context, units []string) error
+	unmaskUnits    func(ctx context.Context, units []string) error
+	holdPackages   func(ctx context.Context, packages []string) error
+	unholdPackages func(ctx context.Context, packages []string) error
+}
+
+func defaultActions(log *slog.Logger, root utilhost.Root) hostActions {
+	if !root.IsHost() {
+		// Nothing runs under another root, so units are masked without
+		// stopping them.
+		run := func(ctx context.Context, name string, args ...string) error {
+			_, err := root.Output(ctx, log, name, args...)
+			return err
+		}
+		return hostActions{
+			maskUnits: func(ctx context.Context, units []string) error {
+				return run(ctx, "systemctl", append([]string{"mask"}, units...)...)
+			},
+			unmaskUnits: func(ctx context.Context, units []string) error {
+				return run(ctx, "systemctl", append([]string{"unmask"}, units...)...)
+			},
+			holdPackages: func(ctx context.Context, packages []string) error {
+				return run(ctx, "apt-mark", append([]string{"hold"}, packages...)...)
+			},
+			unholdPackages: func(ctx context.Context, packages []string) error {
+				return run(ctx, "apt-mark", append([]string{"unhold"}, packages...)...)
+			},
+		}
+	}
+	return hostActions{
+		maskUnits: func(ctx context.Context, units []string) error {
+			return utilexec.MaskUnits(ctx, log, units...)
+		},
+		unmaskUnits: func(ctx context.Context, units []string) error {
+			return utilexec.UnmaskUnits(ctx, log, units...)
+		},
+		holdPackages: func(ctx context.Context, packages []string) error {
+			return utilexec.RunCmd(ctx, log, utilexec.AptMark(), append([]string{"hold"}, packages...)...)
+		},
+		unholdPackages: func(ctx context.Context, packages []string) error {
+			return utilexec.RunCmd(ctx, log, utilexec.AptMark(), append([]string{"unhold"}, packages...)...)
+		},
+	}
+}
+
+type quarantineTask struct {
+	log        *slog.Logger
+	enabled    bool
+	scanner    *Scanner
+	recordPath string
+	actions    hostActions
+}
+
+// Quarantine returns a task that stops and masks competing units and holds
+// competing dpkg packages so unattended upgrades cannot restart them. rpm
+// packages and kubeadm state are only logged: rpm has no hold without a
+// plugin, and kubeadm's files are inert once its kubelet unit is masked. The
+// task does nothing unless enabled.
+func Quarantine(log *slog.Logger, enabled bool) phases.Task {
+	root := utilhost.HostRoot
+	return &quarantineTask{log: log, enabled: enabled, scanner: NewScanner(root), recordPath: root.Path(RecordPath), actions: defaultActions(log, root)}
+}
+
+func (t *quarantineTask) Name() string { return "quarantine-host-conflicts" }
+
+func (t *quarantineTask) Do(ctx context.Context) error {
+	if !t.enabled {
+		return nil
+	}
+	conflicts, err := t.scanner.Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("scan host conflicts: %w", err)
+	}
+	var units, packages []string
+	for _, c := range conflicts {
+		switch {
+		case c.Quarantined:
+		case c.Kind == KindUnit:
+			units = append(units, c.Name)
+		case c.Kind == KindPackage && c.Manager == ManagerDpkg:
+			packages = append(packages, c.Name)
+		default:
+			t.log.Warn("host conflict left in place", "conflict", c.String())
+		}
+	}
+	if len(units) == 0 && len(packages) == 0 {
+		return nil
+	}
+
+	record, err := loadRecord(t.recordPath)
+	if err != nil {
+		return err
+	}
+	// Record before acting: reverting a change that did not happen is
+	// harmless, while an unrecorded mask would outlive reset.
+	record.MaskedUnits = appendMissing(record.MaskedUnits, units...)
+	record.HeldPackages = appendMissing(record.HeldPackages, packages...)
+	if err := saveRecord(t.recordPath, record); err != nil {
+		return err
+	}
+
+	if len(units) > 0 {
+		t.log.Info("masking competing host units", "units", units)
+		if err := t.actions.maskUnits(ctx, units); err != nil {
+			return fmt.Errorf("mask competing units: %w", err)
+		}
+		for _, unit := range units {
+			audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitDisable, Target: unit, Detail: "masked as a host conflict"})
+		}
+	}
+	if len(packages) > 0 {
+		t.log.Info("holding competing host packages", "packages", packages)
+		if err := t.actions.holdPackages(ctx, packages); err != nil {
+			return fmt.Errorf("hold competing packages: %w", err)
+		}
+		for _, pkg := range packages {
+			audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationPackageHold, Target: pkg, Detail: "held as a host conflict"})
+		}
+	}
+	return nil
+}
+
+type releaseTask struct {
+	log        *slog.Logger
+	recordPath string
+	actions    hostActions
+}
+
+// Release returns a task that unmasks and unholds what Quarantine changed. It
+// runs on reset, without the agent config, so it acts on the record alone.
+func Release(log *slog.Logger) phases.Task {
+	root := utilhost.HostRoot
+	return &releaseTask{log: log, recordPath: root.Path(RecordPath), actions: defaultActions(log, root)}
+}
+
+func (t *releaseTask) Name() string { return "release-host-conflicts" }
+
+func (t *releaseTask) Do(ctx context.Context) error {
+	record, err := loadRecord(t.recordPath)
+	if err != nil {
+		return err
+	}
+	if len(record.MaskedUnits) > 0 {
+		if err := t.actions.unmaskUnits(ctx, record.MaskedUnits); err != nil {
+			return fmt.Errorf("unmask quarantined units: %w", err)
+		}
+		for _, unit := range record.MaskedUnits {
+			audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitEnable, Target: unit, Detail: "unmasked by reset"})
+		}
+	}
+	if len(record.HeldPackages) > 0 {
+		if err := t.actions.unholdPackages(ctx, record.HeldPackages); err != nil {
+			return fmt.Errorf("unhold quarantined packages: %w", err)
+		}
+		for _, pkg := range record.HeldPackages {
+			audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationPackageUnhold, Target: pkg, Detail: "unheld by reset"})
+		}
+	}
+	if err := os.Remove(t.recordPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove quarantine record: %w", err)
+	}
+	return nil
+}
+
+func loadRecord(path string) (*Record, error) {
+	record := &Record{}
+	if err := utilio.ReadJSON(path, record); err != nil {
+		return nil, fmt.Errorf("read quarantine record: %w", err)
+	}
+	return record, nil
+}
+
+func saveRecord(path string, record *Record) error {
+	if err := utilio.WriteJSON(path, record, 0o600); err != nil {
+		return fmt.Errorf("write quarantine record: %w", err)
+	}
+	return nil
+}
+
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
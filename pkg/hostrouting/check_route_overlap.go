@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/netip"
+	"path/filepath"
 	"strings"
 	"text/template"
 
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
 	"github.com/Azure/unbounded/pkg/agent/phases"
 )
 
@@ -58,6 +60,11 @@ func CheckRouteOverlap(cfg *config.Config, logger *slog.Logger) phases.Task {
 
 func (t *checkRouteOverlapTask) Name() string { return "check-route-overlap" }
 
+// Plan returns the script and its unit, which are installed on every host.
+func (t *checkRouteOverlapTask) Plan() []string {
+	return []string{checkRouteOverlapScriptPath, filepath.Join(goalstates.SystemdSystemDir, checkRouteOverlapUnit)}
+}
+
 func (t *checkRouteOverlapTask) Do(ctx context.Context) error {
 	mode, err := parseRouteOverlapMode(t.cfg.Mode)
 	if err != nil {
@@ -69,7 +76,7 @@ func (t *checkRouteOverlapTask) Do(ctx context.Context) error {
 		return fmt.Errorf("rendering check-route-overlap script: %w", err)
 	}
 
-	scriptUpdated, err := writeScriptIfChanged(checkRouteOverlapScriptPath, []byte(script))
+	scriptUpdated, err := auditedWriteScriptIfChanged(ctx, t.logger, checkRouteOverlapScriptPath, []byte(script))
 	if err != nil {
 		return fmt.Errorf("writing check-route-overlap script: %w", err)
 	}
@@ -23,6 +23,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/config"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
 	"github.com/Azure/unbounded/pkg/agent/goalstates"
@@ -67,6 +68,14 @@ func ConfigureStaticRoutes(cfg *config.Config, logger *slog.Logger) phases.Task
 
 func (t *configureStaticRoutesTask) Name() string { return "configure-static-routes" }
 
+// Plan returns the script and its unit when routes are configured.
+func (t *configureStaticRoutesTask) Plan() []string {
+	if len(t.cfg.Routes) == 0 {
+		return nil
+	}
+	return []string{staticRoutesScriptPath, filepath.Join(goalstates.SystemdSystemDir, staticRoutesUnit)}
+}
+
 func (t *configureStaticRoutesTask) Do(ctx context.Context) error {
 	if err := validateStaticRoutesConfig(t.cfg); err != nil {
 		return fmt.Errorf("configure-static-routes: invalid config: %w", err)
@@ -83,7 +92,7 @@ func (t *configureStaticRoutesTask) Do(ctx context.Context) error {
 		return fmt.Errorf("rendering static-routes script: %w", err)
 	}
 
-	scriptUpdated, err := writeScriptIfChanged(staticRoutesScriptPath, []byte(script))
+	scriptUpdated, err := auditedWriteScriptIfChanged(ctx, t.logger, staticRoutesScriptPath, []byte(script))
 	if err != nil {
 		return fmt.Errorf("writing static-routes script: %w", err)
 	}
@@ -221,6 +230,18 @@ func writeScriptIfChanged(path string, content []byte) (bool, error) {
 	return true, nil
 }
 
+// auditedWriteScriptIfChanged is writeScriptIfChanged plus an audit record
+// when the script on disk actually changes.
+func auditedWriteScriptIfChanged(ctx context.Context, logger *slog.Logger, path string, content []byte) (bool, error) {
+	before := audit.HashFile(path)
+	changed, err := writeScriptIfChanged(path, content)
+	if err != nil || !changed {
+		return changed, err
+	}
+	audit.Record(ctx, logger, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content)})
+	return true, nil
+}
+
 // ensureSystemdUnit writes the unit file, daemon-reloads, enables, and starts
 // the unit. When restart is true (unit file or script changed) and the unit is
 // already active it is restarted so the updated script runs.
@@ -231,9 +252,14 @@ func ensureSystemdUnit(ctx context.Context, logger *slog.Logger, unit string, un
 	unitChanged := errors.Is(err, os.ErrNotExist) || !bytes.Equal(existing, unitContent)
 
 	if unitChanged {
+		before := ""
+		if err == nil {
+			before = audit.HashBytes(existing)
+		}
 		if err := utilio.WriteFile(unitPath, unitContent, 0o644); err != nil {
 			return fmt.Errorf("write unit file %s: %w", unitPath, err)
 		}
+		audit.Record(ctx, logger, audit.Event{Operation: audit.OperationFileWrite, Target: unitPath, BeforeHash: before, AfterHash: audit.HashBytes(unitContent)})
 	}
 
 	systemctl := "systemctl"
@@ -251,6 +277,7 @@ func ensureSystemdUnit(ctx context.Context, logger *slog.Logger, unit string, un
 		if err := runCmd(ctx, logger, systemctl, "restart", unit); err != nil {
 			return fmt.Errorf("systemctl restart %s: %w", unit, err)
 		}
+		audit.Record(ctx, logger, audit.Event{Operation: audit.OperationUnitRestart, Target: unit})
 		return nil
 	}
 
@@ -258,6 +285,7 @@ func ensureSystemdUnit(ctx context.Context, logger *slog.Logger, unit string, un
 	if err := runCmd(ctx, logger, systemctl, "start", unit); err != nil {
 		return fmt.Errorf("systemctl start %s: %w", unit, err)
 	}
+	audit.Record(ctx, logger, audit.Event{Operation: audit.OperationUnitStart, Target: unit})
 	return nil
 }
 
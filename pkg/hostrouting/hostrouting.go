@@ -13,8 +13,18 @@ import (
 // Before=systemd-nspawn@.service so the kernel route table is correct before
 // the container boots.
 func Configure(cfg *config.Config, logger *slog.Logger) phases.Task {
-	return phases.Serial(logger,
-		ConfigureStaticRoutes(cfg, logger),
-		CheckRouteOverlap(cfg, logger),
-	)
+	static := &configureStaticRoutesTask{cfg: cfg.HostRouting.StaticRoutes, logger: logger}
+	overlap := &checkRouteOverlapTask{cfg: cfg.HostRouting.RouteOverlap, logger: logger}
+	return &configureTask{Task: phases.Serial(logger, static, overlap), static: static, overlap: overlap}
+}
+
+type configureTask struct {
+	phases.Task
+	static  *configureStaticRoutesTask
+	overlap *checkRouteOverlapTask
+}
+
+// Plan returns the scripts and units of both tasks.
+func (t *configureTask) Plan() []string {
+	return append(t.static.Plan(), t.overlap.Plan()...)
 }
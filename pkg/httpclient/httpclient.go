@@ -0,0 +1,146 @@
+// Package httpclient builds the agent's outbound HTTP clients from one place,
+// so every client has dial, TLS, response header, and overall timeouts,
+// shares a connection pool with the other clients of the same configuration,
+// and reports per-client request metrics.
+package httpclient
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// Kind selects the overall timeout of a client.
+type Kind int
+
+const (
+	// KindRequest is for API and token requests, bounded by RequestTimeout.
+	KindRequest Kind = iota
+	// KindDownload is for artifact downloads, bounded by DownloadTimeout.
+	KindDownload
+)
+
+// Defaults applied to zero fields of config.HTTPClientConfig.
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultRequestTimeout        = time.Minute
+	DefaultDownloadTimeout       = 10 * time.Minute
+	DefaultMaxIdleConnsPerHost   = 10
+)
+
+var (
+	mu             sync.Mutex
+	defaultOptions config.HTTPClientConfig
+	transports     = map[transportKey]*http.Transport{}
+)
+
+// transportKey identifies a shared transport.
+type transportKey struct {
+	cfg     config.HTTPClientConfig
+	noProxy bool
+}
+
+// Option adjusts a client New or NewForConfig returns.
+type Option func(*transportKey)
+
+// WithoutProxy makes the client connect directly, ignoring the proxy
+// environment, for link-local endpoints such as the Azure instance metadata
+// service that a proxy cannot reach.
+func WithoutProxy() Option {
+	return func(k *transportKey) { k.noProxy = true }
+}
+
+// SetDefault sets the configuration New uses, for packages that build clients
+// without access to the agent config, and installs the artifact download
+// client in utilio, which cannot import this package. Commands call it after
+// loading config.
+func SetDefault(cfg config.HTTPClientConfig) {
+	mu.Lock()
+	defaultOptions = cfg
+	mu.Unlock()
+	utilio.SetHTTPClient(NewForConfig(cfg, "artifact-download", KindDownload))
+}
+
+// New returns a client named name, for metrics, using the default
+// configuration.
+func New(name string, kind Kind, opts ...Option) *http.Client {
+	mu.Lock()
+	cfg := defaultOptions
+	mu.Unlock()
+	return NewForConfig(cfg, name, kind, opts...)
+}
+
+// NewForConfig returns a client named name, for metrics, using cfg. Clients
+// with equal configuration and options share one transport and its
+// connection pool.
+func NewForConfig(cfg config.HTTPClientConfig, name string, kind Kind, opts ...Option) *http.Client {
+	key := transportKey{cfg: withDefaults(cfg)}
+	for _, opt := range opts {
+		opt(&key)
+	}
+	timeout := key.cfg.RequestTimeout
+	if kind == KindDownload {
+		timeout = key.cfg.DownloadTimeout
+	}
+	return &http.Client{
+		Transport: &instrumentedTransport{name: name, next: transportFor(key)},
+		Timeout:   time.Duration(timeout),
+	}
+}
+
+func withDefaults(cfg config.HTTPClientConfig) config.HTTPClientConfig {
+	defaultDuration := func(d *config.JSONDuration, def time.Duration) {
+		if *d == 0 {
+			*d = config.JSONDuration(def)
+		}
+	}
+	defaultDuration(&cfg.DialTimeout, DefaultDialTimeout)
+	defaultDuration(&cfg.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout)
+	defaultDuration(&cfg.ResponseHeaderTimeout, DefaultResponseHeaderTimeout)
+	defaultDuration(&cfg.IdleConnTimeout, DefaultIdleConnTimeout)
+	defaultDuration(&cfg.RequestTimeout, DefaultRequestTimeout)
+	defaultDuration(&cfg.DownloadTimeout, DefaultDownloadTimeout)
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	return cfg
+}
+
+func transportFor(key transportKey) *http.Transport {
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := transports[key]; ok {
+		return t
+	}
+	cfg := key.cfg
+	dialer := &net.Dialer{Timeout: time.Duration(cfg.DialTimeout), KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   time.Duration(cfg.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(cfg.ResponseHeaderTimeout),
+		IdleConnTimeout:       time.Duration(cfg.IdleConnTimeout),
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+	}
+	if key.noProxy {
+		t.Proxy = nil
+	}
+	if cfg.DisableHTTP2 {
+		// A non-nil empty map keeps the transport from negotiating h2.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	transports[key] = t
+	return t
+}
@@ -0,0 +1,136 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+func TestNewForConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.HTTPClientConfig{
+		DialTimeout:     config.JSONDuration(3 * time.Second),
+		RequestTimeout:  config.JSONDuration(20 * time.Second),
+		DownloadTimeout: config.JSONDuration(5 * time.Minute),
+		MaxConnsPerHost: 4,
+		DisableHTTP2:    true,
+	}
+	request := NewForConfig(cfg, "test-request", KindRequest)
+	download := NewForConfig(cfg, "test-download", KindDownload)
+
+	if request.Timeout != 20*time.Second || download.Timeout != 5*time.Minute {
+		t.Fatalf("timeouts = %v / %v, want 20s / 5m", request.Timeout, download.Timeout)
+	}
+	requestTransport := request.Transport.(*instrumentedTransport).next.(*http.Transport)
+	downloadTransport := download.Transport.(*instrumentedTransport).next.(*http.Transport)
+	if requestTransport != downloadTransport {
+		t.Fatal("clients with equal configuration do not share a transport")
+	}
+	if requestTransport.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout ||
+		requestTransport.ResponseHeaderTimeout != DefaultResponseHeaderTimeout ||
+		requestTransport.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost ||
+		requestTransport.MaxConnsPerHost != 4 {
+		t.Fatalf("transport = %+v, want defaults with MaxConnsPerHost 4", requestTransport)
+	}
+	if requestTransport.ForceAttemptHTTP2 || requestTransport.TLSNextProto == nil {
+		t.Fatal("HTTP/2 is not disabled")
+	}
+
+	other := NewForConfig(config.HTTPClientConfig{}, "test-default", KindRequest)
+	if other.Transport.(*instrumentedTransport).next == requestTransport {
+		t.Fatal("clients with different configuration share a transport")
+	}
+	if other.Timeout != DefaultRequestTimeout {
+		t.Fatalf("default request timeout = %v, want %v", other.Timeout, DefaultRequestTimeout)
+	}
+}
+
+func TestWithoutProxy(t *testing.T) {
+	t.Parallel()
+
+	proxied := NewForConfig(config.HTTPClientConfig{}, "test-proxied", KindRequest)
+	direct := NewForConfig(config.HTTPClientConfig{}, "test-direct", KindRequest, WithoutProxy())
+	proxiedTransport := proxied.Transport.(*instrumentedTransport).next.(*http.Transport)
+	directTransport := direct.Transport.(*instrumentedTransport).next.(*http.Transport)
+	if proxiedTransport == directTransport {
+		t.Fatal("clients with and without a proxy share a transport")
+	}
+	if proxiedTransport.Proxy == nil {
+		t.Fatal("default client ignores the proxy environment")
+	}
+	if directTransport.Proxy != nil {
+		t.Fatal("WithoutProxy client uses the proxy environment")
+	}
+}
+
+func TestInstrumentedTransportCountsRequests(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	client := NewForConfig(config.HTTPClientConfig{}, "test-metrics", KindRequest)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	_ = resp.Body.Close()
+	srv.Close()
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("Get of closed server succeeded")
+	}
+
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("test-metrics", "418")); got != 1 {
+		t.Fatalf("requests with code 418 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("test-metrics", "error")); got != 1 {
+		t.Fatalf("requests with code error = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(requestsInFlight.WithLabelValues("test-metrics")); got != 0 {
+		t.Fatalf("requests in flight = %v, want 0", got)
+	}
+}
+
+func TestInstrumentedTransportSetsUserAgent(t *testing.T) {
+	t.Parallel()
+
+	agents := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.UserAgent()
+	}))
+	defer srv.Close()
+
+	client := NewForConfig(config.HTTPClientConfig{}, "test-user-agent", KindRequest)
+	for _, userAgent := range []string{"", "azsdk-go-test/1.0"} {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		_ = resp.Body.Close()
+		if req.Header.Get("User-Agent") != userAgent {
+			t.Fatal("transport modified the caller's request")
+		}
+	}
+	if got := <-agents; got != version.UserAgent() {
+		t.Fatalf("default User-Agent = %q, want %q", got, version.UserAgent())
+	}
+	if got := <-agents; got != "azsdk-go-test/1.0" {
+		t.Fatalf("caller User-Agent = %q, want it kept", got)
+	}
+}
@@ -0,0 +1,62 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aks_flex_node_http_client_requests_total",
+		Help: "Outbound HTTP requests by client and status code; code is \"error\" when no response was received.",
+	}, []string{"client", "code"})
+
+	requestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aks_flex_node_http_client_request_duration_seconds",
+		Help:    "Time until the response headers of outbound HTTP requests arrived, by client.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"client"})
+
+	requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aks_flex_node_http_client_requests_in_flight",
+		Help: "Outbound HTTP requests waiting for response headers, by client.",
+	}, []string{"client"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(requestsTotal, requestDurationSeconds, requestsInFlight)
+}
+
+// instrumentedTransport records per-client request metrics and identifies
+// the agent in requests that carry no User-Agent of their own.
+type instrumentedTransport struct {
+	name string
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	inFlight := requestsInFlight.WithLabelValues(t.name)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	if req.Header.Get("User-Agent") == "" {
+		// RoundTrippers must not modify the caller's request.
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", version.UserAgent())
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	requestDurationSeconds.WithLabelValues(t.name).Observe(time.Since(start).Seconds())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	requestsTotal.WithLabelValues(t.name, code).Inc()
+	return resp, err
+}
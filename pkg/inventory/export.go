@@ -0,0 +1,233 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/hybridcompute/armhybridcompute"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/azclient"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// arcTagPrefix prefixes the tags the arc exporter owns on the Arc
+	// machine, so operator tags are left alone.
+	arcTagPrefix = "aksFlexNode."
+	// maxTagValueLength is the Azure limit on a tag value.
+	maxTagValueLength = 256
+	// maxErrorBodyBytes bounds the response body quoted in HTTP errors.
+	maxErrorBodyBytes = 1024
+)
+
+// Exporter hands an inventory to an asset management system.
+type Exporter interface {
+	Name() string
+	Export(ctx context.Context, inv *Inventory) error
+}
+
+// NewExporters returns the exporters configured in agent.inventory.
+func NewExporters(log *slog.Logger, cfg *config.Config) ([]Exporter, error) {
+	var exporters []Exporter
+	for _, exporter := range cfg.Agent.Inventory.ExportersOrDefault() {
+		switch exporter.Type {
+		case config.InventoryExporterFile:
+			path := exporter.Path
+			if path == "" {
+				path = filepath.Join(cfg.Instance.StateDir(), config.InventoryFileName)
+			}
+			exporters = append(exporters, &fileExporter{path: path})
+		case config.InventoryExporterHTTP:
+			exporters = append(exporters, &httpExporter{
+				url:     exporter.URL,
+				headers: exporter.Headers,
+				client:  httpclient.NewForConfig(cfg.Agent.HTTP, "inventory", httpclient.KindRequest),
+			})
+		case config.InventoryExporterArc:
+			arc, err := newArcExporter(log, cfg)
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, arc)
+		default:
+			return nil, fmt.Errorf("unknown inventory exporter type %q", exporter.Type)
+		}
+	}
+	return exporters, nil
+}
+
+// fileExporter writes the inventory as JSON, for a CMDB agent on the host to
+// pick up.
+type fileExporter struct {
+	path string
+}
+
+func (e *fileExporter) Name() string { return "file " + e.path }
+
+func (e *fileExporter) Export(_ context.Context, inv *Inventory) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal inventory: %w", err)
+	}
+	if err := utilio.WriteFile(e.path, append(data, '\n'), 0o644); err != nil { //nolint:gosec // read by asset agents; holds no secrets
+		return fmt.Errorf("write inventory %s: %w", e.path, err)
+	}
+	return nil
+}
+
+// httpExporter POSTs the inventory as JSON.
+type httpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (e *httpExporter) Name() string { return "http " + e.url }
+
+func (e *httpExporter) Export(ctx context.Context, inv *Inventory) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("marshal inventory: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post inventory: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return fmt.Errorf("post inventory: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// arcMachines is the part of armhybridcompute.MachinesClient the arc
+// exporter uses.
+type arcMachines interface {
+	Get(ctx context.Context, resourceGroupName, machineName string, options *armhybridcompute.MachinesClientGetOptions) (armhybridcompute.MachinesClientGetResponse, error)
+	Update(ctx context.Context, resourceGroupName, machineName string, parameters armhybridcompute.MachineUpdate, options *armhybridcompute.MachinesClientUpdateOptions) (armhybridcompute.MachinesClientUpdateResponse, error)
+}
+
+// arcExporter sets a summary of the inventory as aksFlexNode.* tags on the
+// Arc machine resource, where Azure Resource Graph queries can reach it. It
+// authenticates as the Arc machine's managed identity, which needs write
+// access to the machine resource.
+type arcExporter struct {
+	log            *slog.Logger
+	subscriptionID string
+	resourceGroup  string
+	machineName    string
+	machines       arcMachines
+}
+
+func newArcExporter(log *slog.Logger, cfg *config.Config) (*arcExporter, error) {
+	cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{ClientOptions: azclient.ClientOptionsFromConfig(cfg)})
+	if err != nil {
+		return nil, fmt.Errorf("create Arc managed identity credential: %w", err)
+	}
+	machines, err := armhybridcompute.NewMachinesClient(cfg.Azure.SubscriptionID, cred, azclient.ARMClientOptionsFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("create hybrid compute client: %w", err)
+	}
+	return &arcExporter{
+		log:            log,
+		subscriptionID: cfg.Azure.SubscriptionID,
+		resourceGroup:  cfg.Azure.Arc.ResourceGroup,
+		machineName:    cfg.Azure.Arc.MachineName,
+		machines:       machines,
+	}, nil
+}
+
+func (e *arcExporter) Name() string { return "arc " + e.machineName }
+
+// Export merges the inventory tags into the machine's tags. A tags PATCH
+// replaces the whole set, so the current tags are read first, and the
+// machine is only patched when an inventory tag changed.
+func (e *arcExporter) Export(ctx context.Context, inv *Inventory) error {
+	machine, err := e.machines.Get(ctx, e.resourceGroup, e.machineName, nil)
+	if err != nil {
+		return fmt.Errorf("get Arc machine: %w", err)
+	}
+	tags := maps.Clone(machine.Tags)
+	if tags == nil {
+		tags = map[string]*string{}
+	}
+	changed := false
+	for key, value := range arcTags(inv) {
+		if current, ok := tags[key]; !ok || current == nil || *current != value {
+			tags[key] = &value
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if _, err := e.machines.Update(ctx, e.resourceGroup, e.machineName, armhybridcompute.MachineUpdate{Tags: tags}, nil); err != nil {
+		return fmt.Errorf("update Arc machine tags: %w", err)
+	}
+	audit.Record(ctx, e.log, audit.Event{
+		Operation: audit.OperationAzureResourceUpdate,
+		Target: fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.HybridCompute/machines/%s",
+			e.subscriptionID, e.resourceGroup, e.machineName),
+		Detail: "inventory tags",
+	})
+	return nil
+}
+
+// arcTags returns the inventory summary the arc exporter sets as tags. Empty
+// values are left out, and values are cut to the Azure tag value limit.
+func arcTags(inv *Inventory) map[string]string {
+	var macs []string
+	for _, nic := range inv.NICs {
+		macs = append(macs, nic.MAC)
+	}
+	var diskBytes int64
+	for _, disk := range inv.Disks {
+		diskBytes += disk.SizeBytes
+	}
+	values := map[string]string{
+		"vendor":            inv.Hardware.Vendor,
+		"model":             inv.Hardware.Model,
+		"serial":            inv.Hardware.Serial,
+		"cpus":              strconv.Itoa(inv.Hardware.CPUs),
+		"memoryBytes":       strconv.FormatInt(inv.Hardware.MemoryBytes, 10),
+		"diskBytes":         strconv.FormatInt(diskBytes, 10),
+		"macs":              strings.Join(macs, ","),
+		"os":                inv.OS.PrettyName,
+		"kernel":            inv.OS.KernelRelease,
+		"agentVersion":      inv.Agent.Version,
+		"kubernetesVersion": inv.Agent.KubernetesVersion,
+	}
+	tags := map[string]string{}
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		if len(value) > maxTagValueLength {
+			value = value[:maxTagValueLength]
+		}
+		tags[arcTagPrefix+key] = value
+	}
+	return tags
+}
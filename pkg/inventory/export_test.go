@@ -0,0 +1,127 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/hybridcompute/armhybridcompute"
+	"k8s.io/utils/ptr"
+)
+
+func testInventory() *Inventory {
+	return &Inventory{
+		SchemaVersion: SchemaVersion,
+		Hostname:      "edge-01",
+		Hardware:      Hardware{Model: "Edge 1000", Serial: "SN123", CPUs: 4, MemoryBytes: 8 << 30},
+		NICs:          []NIC{{Name: "eth0", MAC: "00:11:22:33:44:55"}, {Name: "eth1", MAC: "00:11:22:33:44:56"}},
+		Disks:         []Disk{{Name: "sda", SizeBytes: 100}, {Name: "sdb", SizeBytes: 200}},
+		OS:            OS{PrettyName: "Ubuntu 24.04.2 LTS"},
+		Agent:         Agent{Version: "v1.2.3", KubernetesVersion: "1.33.2"},
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cmdb", "inventory.json")
+	if err := (&fileExporter{path: path}).Export(t.Context(), testInventory()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Inventory
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decode inventory: %v", err)
+	}
+	if got.Hardware.Serial != "SN123" || len(got.NICs) != 2 {
+		t.Errorf("exported inventory = %+v", got)
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	t.Parallel()
+
+	var received Inventory
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if received.Hostname == "rejected" {
+			http.Error(w, "unknown asset", http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+
+	exporter := &httpExporter{url: server.URL, headers: map[string]string{"Authorization": "Bearer x"}, client: server.Client()}
+	if err := exporter.Export(t.Context(), testInventory()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if auth != "Bearer x" || received.Hostname != "edge-01" {
+		t.Errorf("server got Authorization %q and inventory %+v", auth, received)
+	}
+
+	rejected := testInventory()
+	rejected.Hostname = "rejected"
+	err := exporter.Export(t.Context(), rejected)
+	if err == nil || !strings.Contains(err.Error(), "409") || !strings.Contains(err.Error(), "unknown asset") {
+		t.Errorf("Export() error = %v, want the status and body", err)
+	}
+}
+
+type fakeArcMachines struct {
+	tags    map[string]*string
+	updates int
+}
+
+func (f *fakeArcMachines) Get(context.Context, string, string, *armhybridcompute.MachinesClientGetOptions) (armhybridcompute.MachinesClientGetResponse, error) {
+	return armhybridcompute.MachinesClientGetResponse{Machine: armhybridcompute.Machine{Tags: f.tags}}, nil
+}
+
+func (f *fakeArcMachines) Update(_ context.Context, _, _ string, update armhybridcompute.MachineUpdate, _ *armhybridcompute.MachinesClientUpdateOptions) (armhybridcompute.MachinesClientUpdateResponse, error) {
+	f.tags = update.Tags
+	f.updates++
+	return armhybridcompute.MachinesClientUpdateResponse{}, nil
+}
+
+func TestArcExporterMergesTags(t *testing.T) {
+	t.Parallel()
+
+	machines := &fakeArcMachines{tags: map[string]*string{"owner": ptr.To("team-a"), "aksFlexNode.serial": ptr.To("OLD")}}
+	exporter := &arcExporter{log: slog.New(slog.DiscardHandler), resourceGroup: "rg", machineName: "edge-01", machines: machines}
+	for range 2 {
+		if err := exporter.Export(t.Context(), testInventory()); err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+	}
+	if machines.updates != 1 {
+		t.Errorf("updates = %d, want 1 since the second export changed nothing", machines.updates)
+	}
+	for key, want := range map[string]string{
+		"owner":                         "team-a",
+		"aksFlexNode.serial":            "SN123",
+		"aksFlexNode.macs":              "00:11:22:33:44:55,00:11:22:33:44:56",
+		"aksFlexNode.diskBytes":         "300",
+		"aksFlexNode.os":                "Ubuntu 24.04.2 LTS",
+		"aksFlexNode.kubernetesVersion": "1.33.2",
+	} {
+		got := ptr.Deref(machines.tags[key], "")
+		if got != want {
+			t.Errorf("tag %s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := machines.tags["aksFlexNode.vendor"]; ok {
+		t.Error("empty vendor was set as a tag")
+	}
+}
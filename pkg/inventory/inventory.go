@@ -0,0 +1,368 @@
+// Package inventory collects the hardware and software inventory of a host,
+// such as its model and serial number, NICs, disks, and OS, for asset
+// management systems. Exporters hand the inventory to a local file, an HTTP
+// endpoint, or the Azure Arc machine resource.
+package inventory
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/deviceprofile"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+// SchemaVersion is bumped when a field is renamed or changes meaning, so
+// consumers can require the shape they were written for.
+const SchemaVersion = 1
+
+const (
+	dmiDir               = "sys/class/dmi/id"
+	deviceTreeSerialPath = "proc/device-tree/serial-number"
+	netClassDir          = "sys/class/net"
+	blockDir             = "sys/block"
+	cpuOnlinePath        = "sys/devices/system/cpu/online"
+	meminfoPath          = "proc/meminfo"
+	osReleasePath        = "etc/os-release"
+	kernelReleasePath    = "proc/sys/kernel/osrelease"
+	nvidiaGPUsDir        = "proc/driver/nvidia/gpus"
+
+	// sectorSize is the unit of /sys/block/<disk>/size, whatever the
+	// device's logical block size.
+	sectorSize = 512
+)
+
+// Inventory describes one host. The host fields are collected by Collect;
+// the node fields are filled in by the daemon, which knows its config and
+// active machine.
+type Inventory struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	CollectedAt   time.Time `json:"collectedAt"`
+	Hostname      string    `json:"hostname"`
+	Hardware      Hardware  `json:"hardware"`
+	NICs          []NIC     `json:"nics"`
+	Disks         []Disk    `json:"disks"`
+	GPUs          []GPU     `json:"gpus,omitempty"`
+	OS            OS        `json:"os"`
+	Agent         Agent     `json:"agent"`
+	Cluster       Cluster   `json:"cluster"`
+}
+
+// Hardware identifies the machine. Model and Serial come from DMI, or from
+// the device tree on boards without it.
+type Hardware struct {
+	Vendor       string `json:"vendor,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	Architecture string `json:"architecture"`
+	CPUs         int    `json:"cpus"`
+	MemoryBytes  int64  `json:"memoryBytes"`
+}
+
+// NIC is a network interface backed by a device. Virtual interfaces such as
+// bridges, veths, and tunnels are left out.
+type NIC struct {
+	Name   string `json:"name"`
+	MAC    string `json:"mac"`
+	Driver string `json:"driver,omitempty"`
+	MTU    int    `json:"mtu,omitempty"`
+	// SpeedMbps is omitted when the link is down or the driver does not
+	// report it.
+	SpeedMbps int `json:"speedMbps,omitempty"`
+}
+
+// Disk is a block device backed by a device. Loop, device-mapper, RAID, and
+// zram devices are left out.
+type Disk struct {
+	Name       string `json:"name"`
+	Model      string `json:"model,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	SizeBytes  int64  `json:"sizeBytes"`
+	Rotational bool   `json:"rotational"`
+}
+
+// GPU is an NVIDIA GPU known to the loaded driver. Hosts without the driver
+// report none.
+type GPU struct {
+	BusID string `json:"busId"`
+	Model string `json:"model,omitempty"`
+	UUID  string `json:"uuid,omitempty"`
+}
+
+// OS is the host operating system from os-release.
+type OS struct {
+	ID            string `json:"id,omitempty"`
+	VersionID     string `json:"versionId,omitempty"`
+	PrettyName    string `json:"prettyName,omitempty"`
+	KernelRelease string `json:"kernelRelease,omitempty"`
+}
+
+// Agent is the agent build and the node software it runs.
+type Agent struct {
+	Version           string `json:"version"`
+	DeviceProfile     string `json:"deviceProfile"`
+	Instance          string `json:"instance,omitempty"`
+	ActiveMachine     string `json:"activeMachine,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+}
+
+// Cluster is the node's cluster membership.
+type Cluster struct {
+	NodeName          string `json:"nodeName,omitempty"`
+	ClusterResourceID string `json:"clusterResourceId,omitempty"`
+	AgentPool         string `json:"agentPool,omitempty"`
+	ArcMachine        string `json:"arcMachine,omitempty"`
+}
+
+// Collector reads the host inventory from the filesystem under root.
+type Collector struct {
+	root     utilhost.Root
+	now      func() time.Time
+	hostname func() (string, error)
+}
+
+// NewCollector returns a collector for the host under root.
+func NewCollector(root utilhost.Root) *Collector {
+	return &Collector{root: root, now: time.Now, hostname: os.Hostname}
+}
+
+// Collect returns the host inventory. Fields the host cannot report are left
+// empty rather than failing the whole inventory.
+func (c *Collector) Collect() (*Inventory, error) {
+	inv := &Inventory{
+		SchemaVersion: SchemaVersion,
+		CollectedAt:   c.now().UTC(),
+		Agent:         Agent{Version: version.Version, DeviceProfile: deviceprofile.DetectAt(c.root)},
+	}
+	var errs []error
+	var err error
+	if inv.Hostname, err = c.hostname(); err != nil {
+		errs = append(errs, fmt.Errorf("read hostname: %w", err))
+	}
+	if err := c.hardware(&inv.Hardware); err != nil {
+		errs = append(errs, err)
+	}
+	if inv.NICs, err = c.nics(); err != nil {
+		errs = append(errs, err)
+	}
+	if inv.Disks, err = c.disks(); err != nil {
+		errs = append(errs, err)
+	}
+	if inv.GPUs, err = c.gpus(); err != nil {
+		errs = append(errs, err)
+	}
+	if inv.OS, err = c.os(); err != nil {
+		errs = append(errs, err)
+	}
+	return inv, errors.Join(errs...)
+}
+
+func (c *Collector) path(rel string) string {
+	return c.root.Path(rel)
+}
+
+func (c *Collector) hardware(hw *Hardware) error {
+	hw.Architecture = runtime.GOARCH
+	hw.Vendor = deviceprofile.ReadFirmwareString(c.path(filepath.Join(dmiDir, "sys_vendor")))
+	hw.Model = deviceprofile.ReadFirmwareString(c.path(deviceprofile.DMIProductNamePath))
+	if hw.Model == "" {
+		hw.Model = deviceprofile.ReadFirmwareString(c.path(deviceprofile.DeviceTreeModelPath))
+	}
+	hw.Serial = deviceprofile.ReadFirmwareString(c.path(filepath.Join(dmiDir, "product_serial")))
+	if hw.Serial == "" {
+		hw.Serial = deviceprofile.ReadFirmwareString(c.path(deviceTreeSerialPath))
+	}
+
+	var errs []error
+	online, err := os.ReadFile(c.path(cpuOnlinePath))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read online CPUs: %w", err))
+	} else if hw.CPUs, err = countCPUs(strings.TrimSpace(string(online))); err != nil {
+		errs = append(errs, err)
+	}
+	if hw.MemoryBytes, err = memTotal(c.path(meminfoPath)); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// countCPUs counts the CPUs in a kernel CPU list such as "0-3,6".
+func countCPUs(list string) (int, error) {
+	count := 0
+	for part := range strings.SplitSeq(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil {
+			return 0, fmt.Errorf("parse CPU list %q: %w", list, err)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil {
+				return 0, fmt.Errorf("parse CPU list %q: %w", list, err)
+			}
+		}
+		count += hi - lo + 1
+	}
+	return count, nil
+}
+
+func memTotal(path string) (int64, error) {
+	data, err := os.ReadFile(path) //#nosec G304 -- fixed system path under the collector root
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	for line := range strings.Lines(string(data)) {
+		if value, ok := strings.CutPrefix(line, "MemTotal:"); ok {
+			kib, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("parse %s MemTotal: %w", path, err)
+			}
+			return kib * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("%s has no MemTotal", path)
+}
+
+// PhysicalInterface reports whether the network interface name is backed by
+// a device under sysDir, which leaves out loopback, veths, bridges, and
+// tunnels.
+func PhysicalInterface(sysDir, name string) bool {
+	_, err := os.Stat(filepath.Join(sysDir, "class/net", name, "device"))
+	return err == nil
+}
+
+func (c *Collector) nics() ([]NIC, error) {
+	dir := c.path(netClassDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list network interfaces: %w", err)
+	}
+	nics := []NIC{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !PhysicalInterface(c.path("sys"), name) {
+			continue
+		}
+		nic := NIC{
+			Name: name,
+			MAC:  readString(filepath.Join(dir, name, "address")),
+			MTU:  readInt(filepath.Join(dir, name, "mtu")),
+			// The kernel reports -1, or fails the read, for a link that is
+			// down.
+			SpeedMbps: max(readInt(filepath.Join(dir, name, "speed")), 0),
+		}
+		if driver, err := os.Readlink(filepath.Join(dir, name, "device/driver")); err == nil {
+			nic.Driver = filepath.Base(driver)
+		}
+		nics = append(nics, nic)
+	}
+	return nics, nil
+}
+
+func (c *Collector) disks() ([]Disk, error) {
+	dir := c.path(blockDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list block devices: %w", err)
+	}
+	disks := []Disk{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, err := os.Stat(filepath.Join(dir, name, "device")); err != nil {
+			continue
+		}
+		disk := Disk{
+			Name:       name,
+			Model:      readString(filepath.Join(dir, name, "device/model")),
+			Serial:     readString(filepath.Join(dir, name, "device/serial")),
+			SizeBytes:  int64(readInt(filepath.Join(dir, name, "size"))) * sectorSize,
+			Rotational: readString(filepath.Join(dir, name, "queue/rotational")) == "1",
+		}
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+func (c *Collector) gpus() ([]GPU, error) {
+	dir := c.path(nvidiaGPUsDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list NVIDIA GPUs: %w", err)
+	}
+	var gpus []GPU
+	for _, entry := range entries {
+		gpu := GPU{BusID: entry.Name()}
+		for line := range strings.Lines(readString(filepath.Join(dir, entry.Name(), "information"))) {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			switch strings.TrimSpace(key) {
+			case "Model":
+				gpu.Model = strings.TrimSpace(value)
+			case "GPU UUID":
+				gpu.UUID = strings.TrimSpace(value)
+			}
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+func (c *Collector) os() (OS, error) {
+	var info OS
+	info.KernelRelease = readString(c.path(kernelReleasePath))
+	f, err := os.Open(c.path(osReleasePath))
+	if err != nil {
+		return info, fmt.Errorf("read os-release: %w", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			info.ID = value
+		case "VERSION_ID":
+			info.VersionID = value
+		case "PRETTY_NAME":
+			info.PrettyName = value
+		}
+	}
+	return info, scanner.Err()
+}
+
+// readString returns the trimmed content of a sysfs attribute, or "" when it
+// cannot be read.
+func readString(path string) string {
+	data, err := os.ReadFile(path) //#nosec G304 -- sysfs path under the collector root
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readInt returns a numeric sysfs attribute, or 0 when it cannot be read.
+func readInt(path string) int {
+	n, err := strconv.Atoi(readString(path))
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, body := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"sys/class/dmi/id/sys_vendor":                      "Contoso\n",
+		"sys/class/dmi/id/product_name":                    "Edge 1000\n",
+		"sys/class/dmi/id/product_serial":                  "SN123\n",
+		cpuOnlinePath:                                      "0-3,6\n",
+		meminfoPath:                                        "MemTotal:        8000000 kB\nMemFree: 1 kB\n",
+		osReleasePath:                                      "ID=ubuntu\nVERSION_ID=\"24.04\"\nPRETTY_NAME=\"Ubuntu 24.04.2 LTS\"\n",
+		kernelReleasePath:                                  "6.8.0-azure\n",
+		"sys/class/net/eth0/address":                       "00:11:22:33:44:55\n",
+		"sys/class/net/eth0/mtu":                           "1500\n",
+		"sys/class/net/eth0/speed":                         "-1\n",
+		"sys/class/net/eth0/device/vendor":                 "0x8086\n",
+		"sys/class/net/cni0/address":                       "aa:bb:cc:dd:ee:ff\n",
+		"sys/block/nvme0n1/size":                           "2000\n",
+		"sys/block/nvme0n1/device/model":                   "Fast SSD  \n",
+		"sys/block/nvme0n1/device/serial":                  "DISK1\n",
+		"sys/block/nvme0n1/queue/rotational":               "0\n",
+		"sys/block/loop0/size":                             "100\n",
+		"proc/driver/nvidia/gpus/0000:3b:00.0/information": "Model: \t\t NVIDIA A100-SXM4-80GB\nIRQ:   \t\t 183\nGPU UUID: \t GPU-1111\nBus Location: \t 0000:3b:00.0\n",
+	})
+	if err := os.MkdirAll(filepath.Join(root, "sys/bus/pci/drivers/e1000e"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sys/bus/pci/drivers/e1000e"), filepath.Join(root, "sys/class/net/eth0/device/driver")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Collector{
+		root:     utilhost.Root(root),
+		now:      func() time.Time { return time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC) },
+		hostname: func() (string, error) { return "edge-01", nil },
+	}
+	inv, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if inv.Hostname != "edge-01" || inv.SchemaVersion != SchemaVersion {
+		t.Errorf("inventory = %+v", inv)
+	}
+	hw := inv.Hardware
+	if hw.Vendor != "Contoso" || hw.Model != "Edge 1000" || hw.Serial != "SN123" || hw.CPUs != 5 || hw.MemoryBytes != 8000000*1024 {
+		t.Errorf("hardware = %+v", hw)
+	}
+	if len(inv.NICs) != 1 {
+		t.Fatalf("NICs = %+v, want only eth0", inv.NICs)
+	}
+	if nic := inv.NICs[0]; nic.Name != "eth0" || nic.MAC != "00:11:22:33:44:55" || nic.MTU != 1500 || nic.SpeedMbps != 0 || nic.Driver != "e1000e" {
+		t.Errorf("NIC = %+v", nic)
+	}
+	if len(inv.Disks) != 1 {
+		t.Fatalf("disks = %+v, want only nvme0n1", inv.Disks)
+	}
+	if disk := inv.Disks[0]; disk.Model != "Fast SSD" || disk.Serial != "DISK1" || disk.SizeBytes != 2000*sectorSize || disk.Rotational {
+		t.Errorf("disk = %+v", disk)
+	}
+	if len(inv.GPUs) != 1 || inv.GPUs[0] != (GPU{BusID: "0000:3b:00.0", Model: "NVIDIA A100-SXM4-80GB", UUID: "GPU-1111"}) {
+		t.Errorf("GPUs = %+v", inv.GPUs)
+	}
+	if inv.OS != (OS{ID: "ubuntu", VersionID: "24.04", PrettyName: "Ubuntu 24.04.2 LTS", KernelRelease: "6.8.0-azure"}) {
+		t.Errorf("OS = %+v", inv.OS)
+	}
+}
+
+func TestCollectDeviceTreeBoard(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"proc/device-tree/model":         "Raspberry Pi 5 Model B Rev 1.0\x00",
+		"proc/device-tree/serial-number": "10000000abcdef\x00",
+	})
+	c := &Collector{root: utilhost.Root(root), now: time.Now, hostname: func() (string, error) { return "pi", nil }}
+	inv, err := c.Collect()
+	if err == nil {
+		t.Error("Collect() of a host without /proc or /sys files succeeded")
+	}
+	if inv.Hardware.Model != "Raspberry Pi 5 Model B Rev 1.0" || inv.Hardware.Serial != "10000000abcdef" {
+		t.Errorf("hardware = %+v", inv.Hardware)
+	}
+	if inv.Agent.DeviceProfile != "raspberry-pi" {
+		t.Errorf("device profile = %q, want raspberry-pi", inv.Agent.DeviceProfile)
+	}
+}
+
+func TestCountCPUs(t *testing.T) {
+	t.Parallel()
+
+	for list, want := range map[string]int{"0": 1, "0-7": 8, "0-3,8-11": 8, "0,2,4": 3} {
+		got, err := countCPUs(list)
+		if err != nil || got != want {
+			t.Errorf("countCPUs(%q) = %d, %v, want %d", list, got, err, want)
+		}
+	}
+	if _, err := countCPUs("x"); err == nil {
+		t.Error("countCPUs(x) succeeded")
+	}
+}
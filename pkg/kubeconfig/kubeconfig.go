@@ -0,0 +1,228 @@
+// Package kubeconfig generates and rotates the kubelet kubeconfig for nodes
+// that join with their Azure Arc identity instead of a bootstrap token.
+//
+// The kubeconfig uses the `token file` exec credential from
+// config.TokenFileExecCredential, so rotation only rewrites the instance's
+// token file on the host and in the nspawn machine's /etc; the
+// kubelet picks up the new token on its next exec call without a restart.
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// RefreshBefore is how long before expiry a token is regenerated.
+const RefreshBefore = 15 * time.Minute
+
+// Applies reports whether the kubelet authenticates with a token the agent
+// generates: from the Arc identity, a client certificate, or a workload
+// identity. A bootstrap token configured alongside takes precedence.
+func Applies(cfg *config.Config) bool {
+	return cfg.KubeletUsesTokenFile()
+}
+
+// Manager generates the kubelet kubeconfig and checks whether it needs to be
+// regenerated.
+type Manager struct {
+	log           *slog.Logger
+	cfg           *config.Config
+	sources       []Source
+	hostTokenPath string
+	now           func() time.Time
+}
+
+// NewManager returns a Manager that obtains tokens from Sources(log, cfg).
+func NewManager(log *slog.Logger, cfg *config.Config) *Manager {
+	return &Manager{
+		log:           log,
+		cfg:           cfg,
+		sources:       Sources(log, cfg),
+		hostTokenPath: cfg.Instance.KubeletTokenPath(),
+		now:           time.Now,
+	}
+}
+
+// Generate obtains a token from the first source that returns one, stores it
+// on the host and, when machineDir is set, in the machine's /etc, and writes
+// the machine's kubelet kubeconfig.
+func (m *Manager) Generate(ctx context.Context, machineDir string) (Token, error) {
+	var errs []error
+	for _, source := range m.sources {
+		token, err := source.Token(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			continue
+		}
+		if err := m.write(machineDir, token); err != nil {
+			return Token{}, err
+		}
+		m.log.Info("generated kubelet kubeconfig", "source", source.Name(), "expiresOn", token.ExpiresOn, "machineDir", machineDir)
+		return token, nil
+	}
+	return Token{}, fmt.Errorf("obtain kubelet token: %w", errors.Join(errs...))
+}
+
+func (m *Manager) write(machineDir string, token Token) error {
+	paths := []string{m.hostTokenPath}
+	if machineDir != "" {
+		paths = append(paths, filepath.Join(machineDir, m.cfg.Instance.KubeletTokenPath()))
+	}
+	for _, path := range paths {
+		if err := utilio.WriteFile(path, []byte(token.Value), 0o600); err != nil {
+			return fmt.Errorf("write kubelet token %s: %w", path, err)
+		}
+	}
+	if machineDir == "" {
+		return nil
+	}
+	data, err := clientcmd.Write(m.kubeconfig())
+	if err != nil {
+		return fmt.Errorf("serialize kubelet kubeconfig: %w", err)
+	}
+	path := filepath.Join(machineDir, goalstates.KubeletKubeconfigPath)
+	if err := utilio.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write kubelet kubeconfig %s: %w", path, err)
+	}
+	return nil
+}
+
+// kubeconfig mirrors the exec kubeconfig the nodestart phase writes so the
+// two stay interchangeable.
+func (m *Manager) kubeconfig() clientcmdapi.Config {
+	return clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"cluster": {
+				CertificateAuthority: goalstates.KubeletAPIServerCACertPath,
+				Server:               m.cfg.APIServerURL(),
+			},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			"kubelet": {Exec: config.TokenFileExecCredential(m.cfg.Instance.KubeletTokenPath())},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			"default": {Cluster: "cluster", AuthInfo: "kubelet"},
+		},
+		CurrentContext: "default",
+	}
+}
+
+// Check returns why the kubeconfig for machineDir needs to be regenerated, or
+// nil when it is current: a token is missing, unreadable, differs between the
+// host and the machine, or expires within RefreshBefore, or the kubeconfig is
+// missing or does not match the config.
+func (m *Manager) Check(machineDir string) error {
+	host, err := os.ReadFile(m.hostTokenPath)
+	if err != nil {
+		return fmt.Errorf("read kubelet token: %w", err)
+	}
+	expiresOn, err := TokenExpiry(host)
+	if err != nil {
+		return err
+	}
+	if remaining := expiresOn.Sub(m.now()); remaining < RefreshBefore {
+		return fmt.Errorf("kubelet token expires at %s", expiresOn.UTC().Format(time.RFC3339))
+	}
+	if machineDir == "" {
+		return nil
+	}
+
+	machine, err := os.ReadFile(filepath.Join(machineDir, m.cfg.Instance.KubeletTokenPath()))
+	if err != nil {
+		return fmt.Errorf("read machine kubelet token: %w", err)
+	}
+	if string(machine) != string(host) {
+		return fmt.Errorf("machine kubelet token differs from the host token")
+	}
+	got, err := clientcmd.LoadFromFile(filepath.Join(machineDir, goalstates.KubeletKubeconfigPath))
+	if err != nil {
+		return fmt.Errorf("load kubelet kubeconfig: %w", err)
+	}
+	want := m.kubeconfig()
+	current := got.Contexts[got.CurrentContext]
+	if current == nil || got.Clusters[current.Cluster] == nil || got.AuthInfos[current.AuthInfo] == nil {
+		return fmt.Errorf("kubelet kubeconfig has no usable current context")
+	}
+	if got.Clusters[current.Cluster].Server != want.Clusters["cluster"].Server {
+		return fmt.Errorf("kubelet kubeconfig server %s does not match %s", got.Clusters[current.Cluster].Server, want.Clusters["cluster"].Server)
+	}
+	exec := got.AuthInfos[current.AuthInfo].Exec
+	if exec == nil || exec.Command != want.AuthInfos["kubelet"].Exec.Command || !reflect.DeepEqual(exec.Args, want.AuthInfos["kubelet"].Exec.Args) {
+		return fmt.Errorf("kubelet kubeconfig does not use the rotated token file")
+	}
+	return nil
+}
+
+// Task returns a phase that generates the kubeconfig for machineDir. It is a
+// no-op unless the kubelet authenticates with the Arc identity.
+func (m *Manager) Task(machineDir string) phases.Task {
+	return &generateTask{manager: m, machineDir: machineDir}
+}
+
+type generateTask struct {
+	manager    *Manager
+	machineDir string
+}
+
+func (t *generateTask) Name() string { return "generate-kubeconfig" }
+
+// Plan returns the kubelet token on the host and in the machine, and the
+// machine's kubelet kubeconfig.
+func (t *generateTask) Plan() []string {
+	if !Applies(t.manager.cfg) {
+		return nil
+	}
+	return []string{
+		t.manager.hostTokenPath,
+		filepath.Join(t.machineDir, t.manager.cfg.Instance.KubeletTokenPath()),
+		filepath.Join(t.machineDir, goalstates.KubeletKubeconfigPath),
+	}
+}
+
+func (t *generateTask) Do(ctx context.Context) error {
+	if !Applies(t.manager.cfg) {
+		return nil
+	}
+	_, err := t.manager.Generate(ctx, t.machineDir)
+	return err
+}
+
+// TokenExpiry returns the expiry in the exp claim of a JWT bearer token. The
+// signature is not verified; the API server does that.
+func TokenExpiry(token []byte) (time.Time, error) {
+	parts := strings.Split(strings.TrimSpace(string(token)), ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("kubelet token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decode kubelet token claims: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("decode kubelet token claims: %w", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("kubelet token has no exp claim")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
@@ -0,0 +1,281 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// fakeJWT returns an unsigned JWT whose exp claim is expiresOn.
+func fakeJWT(expiresOn time.Time) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		enc.EncodeToString(fmt.Appendf(nil, `{"exp":%d}`, expiresOn.Unix())) + "." +
+		enc.EncodeToString([]byte("sig"))
+}
+
+type fakeSource struct {
+	name  string
+	token Token
+	err   error
+}
+
+func (f *fakeSource) Name() string                         { return f.name }
+func (f *fakeSource) Token(context.Context) (Token, error) { return f.token, f.err }
+
+func testManager(t *testing.T, now time.Time, sources ...Source) *Manager {
+	t.Helper()
+	return &Manager{
+		log: slog.New(slog.DiscardHandler),
+		cfg: &config.Config{
+			Azure: config.AzureConfig{Arc: &config.ArcConfig{Enabled: true}},
+			Node:  config.NodeConfig{Kubelet: config.KubeletConfig{ClusterFQDN: "api.example.test:443", CACertData: "Y2E="}},
+		},
+		sources:       sources,
+		hostTokenPath: filepath.Join(t.TempDir(), "kubelet-token"),
+		now:           func() time.Time { return now },
+	}
+}
+
+func TestArcIdentityChallenge(t *testing.T) {
+	t.Parallel()
+
+	keyDir := t.TempDir()
+	keyPath := filepath.Join(keyDir, "challenge.key")
+	if err := os.WriteFile(keyPath, []byte("secret\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != aksAADServerID {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "Basic secret" {
+			w.Header().Set("WWW-Authenticate", "Basic realm="+keyPath)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"tok","expires_on":"1700000000"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	source := &arcIdentity{endpoint: server.URL, keyDir: keyDir, resource: aksAADServerID, client: server.Client()}
+	token, err := source.Token(t.Context())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if token.Value != "tok" || !token.ExpiresOn.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("Token = %+v", token)
+	}
+
+	// A challenge naming a file outside the key directory must not be read.
+	source.keyDir = t.TempDir()
+	if _, err := source.Token(t.Context()); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Fatalf("Token with foreign key path error = %v, want outside key dir", err)
+	}
+}
+
+func TestAzureCLIToken(t *testing.T) {
+	t.Parallel()
+
+	var gotArgs []string
+	source := &azureCLI{tenantID: "tenant", run: func(_ context.Context, args ...string) ([]byte, error) {
+		gotArgs = args
+		return []byte(`{"accessToken":"tok","expiresOn":"2023-11-14 22:13:20.000000","expires_on":1700000000}`), nil
+	}}
+	token, err := source.Token(t.Context())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if token.Value != "tok" || token.ExpiresOn.Unix() != 1700000000 {
+		t.Fatalf("Token = %+v", token)
+	}
+	if args := strings.Join(gotArgs, " "); !strings.Contains(args, "--resource "+aksAADServerID) || !strings.Contains(args, "--tenant tenant") {
+		t.Fatalf("az args = %q", args)
+	}
+}
+
+type fakeCredential struct {
+	token  azcore.AccessToken
+	scopes []string
+}
+
+func (f *fakeCredential) GetToken(_ context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.scopes = opts.Scopes
+	return f.token, nil
+}
+
+func TestCredentialSourceToken(t *testing.T) {
+	t.Parallel()
+
+	expiresOn := time.Unix(1700000000, 0)
+	cred := &fakeCredential{token: azcore.AccessToken{Token: "tok", ExpiresOn: expiresOn}}
+	source := &credentialSource{
+		cfg: &config.Config{},
+		log: slog.New(slog.DiscardHandler),
+		newCredential: func(*config.Config, *slog.Logger) (azcore.TokenCredential, error) {
+			return cred, nil
+		},
+	}
+	token, err := source.Token(t.Context())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if token.Value != "tok" || !token.ExpiresOn.Equal(expiresOn) {
+		t.Fatalf("Token = %+v", token)
+	}
+	if len(cred.scopes) != 1 || cred.scopes[0] != aksAADServerID+"/.default" {
+		t.Fatalf("scopes = %v", cred.scopes)
+	}
+}
+
+func TestSourcesForAuthMethod(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		azure config.AzureConfig
+		want  []string
+	}{
+		{name: "arc", azure: config.AzureConfig{Arc: &config.ArcConfig{Enabled: true}}, want: []string{"arc-identity", "azure-cli"}},
+		{name: "arc managed identity", azure: config.AzureConfig{ManagedIdentity: &config.ManagedIdentityConfig{Source: config.ManagedIdentitySourceArc}}, want: []string{"arc-identity"}},
+		{name: "workload identity", azure: config.AzureConfig{WorkloadIdentity: &config.WorkloadIdentityConfig{TokenFile: "/var/run/token"}}, want: []string{"azure-credential"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, source := range Sources(slog.New(slog.DiscardHandler), &config.Config{Azure: tt.azure}) {
+				got = append(got, source.Name())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("Sources = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateFallsBackAndWritesKubeconfig(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	value := fakeJWT(now.Add(time.Hour))
+	m := testManager(t, now,
+		&fakeSource{name: "arc-identity", err: errors.New("himds not running")},
+		&fakeSource{name: "azure-cli", token: Token{Value: value, ExpiresOn: now.Add(time.Hour)}},
+	)
+	machineDir := t.TempDir()
+	if err := m.Check(machineDir); err == nil {
+		t.Fatal("Check before Generate = nil, want missing token")
+	}
+	if _, err := m.Generate(t.Context(), machineDir); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, path := range []string{m.hostTokenPath, filepath.Join(machineDir, config.KubeletTokenPath)} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != value {
+			t.Fatalf("token %s = %q, %v", path, data, err)
+		}
+	}
+	if err := m.Check(machineDir); err != nil {
+		t.Fatalf("Check after Generate: %v", err)
+	}
+
+	failing := testManager(t, now, &fakeSource{name: "arc-identity", err: errors.New("himds not running")})
+	if _, err := failing.Generate(t.Context(), ""); err == nil || !strings.Contains(err.Error(), "arc-identity: himds not running") {
+		t.Fatalf("Generate error = %v, want source error", err)
+	}
+}
+
+func TestCheckDetectsStaleCredentials(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		expires time.Time
+		damage  func(t *testing.T, machineDir string)
+		want    string
+	}{
+		{name: "expiring token", expires: now.Add(RefreshBefore - time.Minute), want: "expires at"},
+		{
+			name:    "machine token differs",
+			expires: now.Add(time.Hour),
+			damage: func(t *testing.T, machineDir string) {
+				writeFile(t, filepath.Join(machineDir, config.KubeletTokenPath), fakeJWT(now.Add(2*time.Hour)))
+			},
+			want: "differs",
+		},
+		{
+			name:    "kubeconfig replaced",
+			expires: now.Add(time.Hour),
+			damage: func(t *testing.T, machineDir string) {
+				writeFile(t, filepath.Join(machineDir, goalstates.KubeletKubeconfigPath), "apiVersion: v1\nkind: Config\n")
+			},
+			want: "current context",
+		},
+		{
+			name:    "kubeconfig missing",
+			expires: now.Add(time.Hour),
+			damage: func(t *testing.T, machineDir string) {
+				if err := os.Remove(filepath.Join(machineDir, goalstates.KubeletKubeconfigPath)); err != nil {
+					t.Fatalf("Remove: %v", err)
+				}
+			},
+			want: "load kubelet kubeconfig",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := testManager(t, now, &fakeSource{name: "test", token: Token{Value: fakeJWT(tt.expires), ExpiresOn: tt.expires}})
+			machineDir := t.TempDir()
+			if _, err := m.Generate(t.Context(), machineDir); err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if tt.damage != nil {
+				tt.damage(t, machineDir)
+			}
+			if err := m.Check(machineDir); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Check = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	t.Parallel()
+
+	want := time.Unix(1700000000, 0)
+	got, err := TokenExpiry([]byte(fakeJWT(want) + "\n"))
+	if err != nil || !got.Equal(want) {
+		t.Fatalf("TokenExpiry = %v, %v; want %v", got, err, want)
+	}
+	for _, token := range []string{"opaque", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".c"} {
+		if _, err := TokenExpiry([]byte(token)); err == nil {
+			t.Errorf("TokenExpiry(%q) = nil error", token)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+	"github.com/Azure/AKSFlexNode/pkg/tokencache"
+)
+
+const (
+	// aksAADServerID is the Microsoft Entra application ID of the AKS API
+	// server; tokens for the kubelet are requested for this resource.
+	aksAADServerID = "6dae42f8-4368-4678-94ff-3960e28e3630"
+
+	// arcIdentityEndpoint is the token endpoint of the local Arc hybrid
+	// instance metadata service (himds).
+	arcIdentityEndpoint = "http://127.0.0.1:40342/metadata/identity/oauth2/token"
+	arcAPIVersion       = "2020-06-01"
+	// arcTokenKeyDir is where himds writes the one-time challenge key files
+	// that only root and the himds group can read.
+	arcTokenKeyDir = "/var/opt/azcmagent/tokens"
+	arcMaxKeySize  = 4096
+
+	azureCLIConfigDir = config.ConfigDir + "/azure"
+)
+
+// Token is a bearer token for the kubelet and its expiry.
+type Token struct {
+	Value     string
+	ExpiresOn time.Time
+}
+
+// Source obtains a kubelet bearer token for the cluster.
+type Source interface {
+	Name() string
+	Token(ctx context.Context) (Token, error)
+}
+
+// Sources returns the token sources for cfg in the order Generate tries
+// them. With the Arc identity that is the Arc machine identity, then, when
+// the agent onboarded the machine, the Azure CLI login copied during
+// onboarding. Otherwise it is the agent's Azure credential, such as a client
+// certificate or a workload identity.
+func Sources(log *slog.Logger, cfg *config.Config) []Source {
+	if !cfg.UsesArcIdentity() {
+		return []Source{&credentialSource{cfg: cfg, log: log, newCredential: aksmachine.NewCredential}}
+	}
+	sources := []Source{NewArcIdentity(cfg, aksAADServerID)}
+	if cfg.IsARCEnabled() {
+		sources = append(sources, &azureCLI{tenantID: cfg.Azure.TenantID, run: runAzureCLI})
+	}
+	return sources
+}
+
+// NewArcIdentity returns a Source of Entra tokens for resource from the
+// host's Arc machine identity.
+func NewArcIdentity(cfg *config.Config, resource string) Source {
+	return &arcIdentity{
+		endpoint: arcIdentityEndpoint,
+		keyDir:   arcTokenKeyDir,
+		resource: resource,
+		client:   httpclient.NewForConfig(cfg.Agent.HTTP, "arc-identity", httpclient.KindRequest),
+	}
+}
+
+// arcIdentity exchanges the Arc machine identity for an Entra token through
+// the himds challenge flow: the first request is answered with 401 and the
+// path of a key file, and the second request proves local root access by
+// presenting that key.
+type arcIdentity struct {
+	endpoint string
+	keyDir   string
+	resource string
+	client   *http.Client
+}
+
+func (a *arcIdentity) Name() string { return "arc-identity" }
+
+func (a *arcIdentity) Token(ctx context.Context) (Token, error) {
+	resp, err := a.request(ctx, "")
+	if err != nil {
+		return Token{}, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+		key, err := a.challengeKey(challenge)
+		if err != nil {
+			return Token{}, err
+		}
+		if resp, err = a.request(ctx, key); err != nil {
+			return Token{}, err
+		}
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body close
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Token{}, fmt.Errorf("read Arc identity response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("arc identity endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var out struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return Token{}, fmt.Errorf("decode Arc identity response: %w", err)
+	}
+	return newToken(out.AccessToken, out.ExpiresOn.String())
+}
+
+func (a *arcIdentity) request(ctx context.Context, key string) (*http.Response, error) {
+	query := url.Values{"api-version": {arcAPIVersion}, "resource": {a.resource}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	if key != "" {
+		req.Header.Set("Authorization", "Basic "+key)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request Arc identity token: %w", err)
+	}
+	return resp, nil
+}
+
+// challengeKey reads the key file named by a "Basic realm=<path>" challenge.
+// The path must be a .key file directly under keyDir so a spoofed endpoint
+// cannot make the agent disclose arbitrary files.
+func (a *arcIdentity) challengeKey(challenge string) (string, error) {
+	path, ok := strings.CutPrefix(challenge, "Basic realm=")
+	if !ok {
+		return "", fmt.Errorf("unexpected Arc identity challenge %q", challenge)
+	}
+	if filepath.Dir(path) != filepath.Clean(a.keyDir) || filepath.Ext(path) != ".key" {
+		return "", fmt.Errorf("arc identity challenge key %s is outside %s", path, a.keyDir)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("stat Arc identity challenge key: %w", err)
+	}
+	if info.Size() > arcMaxKeySize {
+		return "", fmt.Errorf("arc identity challenge key %s is larger than %d bytes", path, arcMaxKeySize)
+	}
+	key, err := os.ReadFile(path) // #nosec G304 -- path is validated to be a key file under keyDir
+	if err != nil {
+		return "", fmt.Errorf("read Arc identity challenge key: %w", err)
+	}
+	return strings.TrimSpace(string(key)), nil
+}
+
+// credentialSource requests the kubelet token with the Azure credential the
+// agent uses for ARM. The credential is created on every request, so a
+// certificate replaced on disk is picked up at the next refresh.
+type credentialSource struct {
+	cfg           *config.Config
+	log           *slog.Logger
+	newCredential func(*config.Config, *slog.Logger) (azcore.TokenCredential, error)
+}
+
+func (c *credentialSource) Name() string { return "azure-credential" }
+
+func (c *credentialSource) Token(ctx context.Context) (Token, error) {
+	cred, err := c.newCredential(c.cfg, c.log)
+	if err != nil {
+		return Token{}, err
+	}
+	// The manager decided the kubelet token needs renewing, so a cached one
+	// would not do.
+	token, err := cred.GetToken(tokencache.Fresh(ctx), policy.TokenRequestOptions{Scopes: []string{aksAADServerID + "/.default"}})
+	if err != nil {
+		return Token{}, err
+	}
+	if token.Token == "" {
+		return Token{}, fmt.Errorf("token response has no access token")
+	}
+	return Token{Value: token.Token, ExpiresOn: token.ExpiresOn}, nil
+}
+
+// azureCLI requests the kubelet token from the Azure CLI login that Arc
+// onboarding copies to /etc/aks-flex-node/azure. This is the token
+// `az aks get-credentials` kubeconfigs obtain through kubelogin's azurecli
+// login mode.
+type azureCLI struct {
+	tenantID string
+	run      func(ctx context.Context, args ...string) ([]byte, error)
+}
+
+func (a *azureCLI) Name() string { return "azure-cli" }
+
+func (a *azureCLI) Token(ctx context.Context) (Token, error) {
+	args := []string{"account", "get-access-token", "--resource", aksAADServerID, "--output", "json"}
+	if a.tenantID != "" {
+		args = append(args, "--tenant", a.tenantID)
+	}
+	out, err := a.run(ctx, args...)
+	if err != nil {
+		return Token{}, err
+	}
+	var token struct {
+		AccessToken string      `json:"accessToken"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err := json.Unmarshal(out, &token); err != nil {
+		return Token{}, fmt.Errorf("decode az account get-access-token output: %w", err)
+	}
+	return newToken(token.AccessToken, token.ExpiresOn.String())
+}
+
+// runAzureCLI runs az with the agent's Azure CLI profile. Stdout carries the
+// token, so it is captured rather than logged.
+func runAzureCLI(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "az", args...) // #nosec G204 -- fixed az subcommand
+	cmd.Env = append(os.Environ(), "AZURE_CONFIG_DIR="+azureCLIConfigDir)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("az %s: %w: %s", strings.Join(args[:2], " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("az %s: %w", strings.Join(args[:2], " "), err)
+	}
+	return out, nil
+}
+
+func newToken(value, expiresOn string) (Token, error) {
+	if value == "" {
+		return Token{}, fmt.Errorf("token response has no access token")
+	}
+	seconds, err := strconv.ParseInt(expiresOn, 10, 64)
+	if err != nil {
+		return Token{}, fmt.Errorf("parse token expiry %q: %w", expiresOn, err)
+	}
+	return Token{Value: value, ExpiresOn: time.Unix(seconds, 0)}, nil
+}
@@ -0,0 +1,379 @@
+// Package localdns installs the optional node-local DNS cache into the nspawn
+// machine rootfs. It is CoreDNS listening on a link-local address, in the
+// style of upstream NodeLocal DNSCache: cluster names are forwarded to the
+// cluster DNS service over TCP and everything else to the configured
+// upstreams, and answers are cached on the node so pods keep resolving
+// through short WAN or VPN outages.
+package localdns
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	utilexec "k8s.io/utils/exec"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+	"github.com/Azure/AKSFlexNode/pkg/unithardening"
+	machineexec "github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/artifactsource"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	DefaultVersion = "1.12.1"
+
+	coreDNSURLTemplate = "https://github.com/coredns/coredns/releases/download/v%s/coredns_%s_linux_%s.tgz"
+
+	// Paths as they appear inside the container.
+	binaryPath   = "/usr/local/bin/coredns"
+	corefilePath = "/etc/node-local-dns/Corefile"
+
+	systemdUnit = "node-local-dns.service"
+	unitPath    = "/etc/systemd/system/" + systemdUnit
+	wantsPath   = "/etc/systemd/system/multi-user.target.wants/" + systemdUnit
+
+	// iface is the dummy interface holding the listen address. The machine
+	// shares the host network namespace, so the address is reachable from
+	// the host and from host-network pods too.
+	iface = "nodelocaldns"
+
+	// ClusterDomain is the cluster DNS domain forwarded to the cluster DNS
+	// service. AKS clusters always use the default.
+	ClusterDomain = "cluster.local"
+
+	healthPort = 8080
+
+	artifactCheckName = "local-dns-artifact"
+	artifactTarget    = "node-local DNS cache artifact"
+)
+
+var (
+	//go:embed assets/node-local-dns.service
+	serviceTemplate string
+	//go:embed assets/Corefile
+	corefileTemplate string
+
+	serviceTmpl  = template.Must(template.New("node-local-dns-service").Parse(serviceTemplate))
+	corefileTmpl = template.Must(template.New("node-local-dns-corefile").Parse(corefileTemplate))
+)
+
+// skippedTask stands in for the local DNS tasks when the cache is not
+// installed.
+type skippedTask struct{ name string }
+
+func (t skippedTask) Name() string           { return t.name }
+func (skippedTask) Do(context.Context) error { return nil }
+
+type downloadTask struct {
+	log        *slog.Logger
+	cfg        *config.Config
+	version    string
+	machineDir string
+}
+
+// Download returns a task that installs the CoreDNS binary into the nspawn
+// machine rootfs at machineDir. It does nothing unless localDNS.enabled is
+// set, and in offline mode.
+func Download(log *slog.Logger, cfg *config.Config, machineDir string) phases.Task {
+	if !cfg.LocalDNSEnabled() {
+		return skippedTask{name: "download-local-dns"}
+	}
+	return &downloadTask{log: log, cfg: cfg, version: version(cfg), machineDir: machineDir}
+}
+
+func (t *downloadTask) Name() string { return "download-local-dns" }
+
+func (t *downloadTask) Do(ctx context.Context) error {
+	hostPath := filepath.Join(t.machineDir, binaryPath)
+	if versionMatch(hostPath, t.version) {
+		return nil
+	}
+	source, err := artifactsource.Parse(coreDNSURL(t.version))
+	if err != nil {
+		return fmt.Errorf("construct coredns download source: %w", err)
+	}
+	body, err := source.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("open coredns artifact: %w", err)
+	}
+	defer body.Close() //nolint:errcheck // body close
+
+	counter := progress.FromContext(ctx)
+	for tarFile, err := range utilio.DecompressTarGzWithPolicy(counter.Reader(body), t.cfg.Bootstrap.Extraction.Policy()) {
+		if err != nil {
+			return fmt.Errorf("decompress coredns tar: %w", err)
+		}
+		if tarFile.Name != "coredns" {
+			continue
+		}
+		before := audit.HashFile(hostPath)
+		if err := utilio.InstallFile(hostPath, tarFile.Body, 0o755); err != nil { //nolint:gosec // binary must be executable
+			return fmt.Errorf("install coredns binary: %w", err)
+		}
+		audit.Record(ctx, t.log, audit.Event{
+			Operation:  audit.OperationPackageExtract,
+			Target:     hostPath,
+			BeforeHash: before,
+			AfterHash:  audit.HashFile(hostPath),
+			Detail:     "coredns " + t.version,
+		})
+		counter.AddFile()
+		return nil
+	}
+	return fmt.Errorf("coredns %s archive has no coredns binary", t.version)
+}
+
+// Installer runs the cache in an nspawn machine. Configure writes it into the
+// rootfs and enables it before the machine starts, and the unit is ordered
+// before the kubelet, so pods never start without the DNS server the kubelet
+// hands them. Start makes sure it runs once the machine is up.
+type Installer struct {
+	log         *slog.Logger
+	cfg         *config.Config
+	machineDir  string
+	machineName string
+	// restart is set by Configure when it changed the files of a cache that
+	// was already running.
+	restart bool
+}
+
+// NewInstaller returns the installer of the cache into the machine nodeStart
+// starts.
+func NewInstaller(log *slog.Logger, cfg *config.Config, nodeStart *goalstates.NodeStart) *Installer {
+	return &Installer{log: log, cfg: cfg, machineDir: nodeStart.MachineDir, machineName: nodeStart.MachineName}
+}
+
+// Configure returns a task that renders the Corefile and the systemd unit
+// into the machine rootfs and enables the unit. It does nothing unless
+// localDNS.enabled is set, and in offline mode.
+func (i *Installer) Configure() phases.Task {
+	if !i.cfg.LocalDNSEnabled() {
+		return skippedTask{name: "configure-local-dns"}
+	}
+	return &configureTask{i}
+}
+
+// Start returns a task that ensures the cache is running inside the machine,
+// restarting it when Configure changed its files. It does nothing unless
+// localDNS.enabled is set, and in offline mode.
+func (i *Installer) Start() phases.Task {
+	if !i.cfg.LocalDNSEnabled() {
+		return skippedTask{name: "start-local-dns"}
+	}
+	return &startTask{i}
+}
+
+type configureTask struct{ *Installer }
+
+func (t *configureTask) Name() string { return "configure-local-dns" }
+
+// Plan returns the Corefile, the unit file, and its enablement symlink inside
+// the machine.
+func (t *configureTask) Plan() []string {
+	return []string{
+		filepath.Join(t.machineDir, corefilePath),
+		filepath.Join(t.machineDir, unitPath),
+		filepath.Join(t.machineDir, wantsPath),
+	}
+}
+
+func (t *configureTask) Do(ctx context.Context) error {
+	corefile, err := Corefile(t.cfg)
+	if err != nil {
+		return err
+	}
+	var unit bytes.Buffer
+	if err := serviceTmpl.Execute(&unit, map[string]any{
+		"Interface":    iface,
+		"Address":      t.cfg.LocalDNSAddress(),
+		"BinaryPath":   binaryPath,
+		"CorefilePath": corefilePath,
+	}); err != nil {
+		return fmt.Errorf("render local DNS service template: %w", err)
+	}
+	hardened, err := unithardening.Apply(t.cfg.UnitHardening, systemdUnit, unit.Bytes())
+	if err != nil {
+		return err
+	}
+
+	corefileUpdated, err := t.ensureFile(ctx, corefilePath, []byte(corefile))
+	if err != nil {
+		return fmt.Errorf("ensure Corefile: %w", err)
+	}
+	unitUpdated, err := t.ensureFile(ctx, unitPath, hardened)
+	if err != nil {
+		return fmt.Errorf("ensure local DNS service file: %w", err)
+	}
+	if err := t.ensureEnabled(); err != nil {
+		return fmt.Errorf("enable local DNS cache: %w", err)
+	}
+	// A machine that boots from here on picks up the files. Only a cache
+	// already running in a started machine must be restarted.
+	if corefileUpdated || unitUpdated {
+		_, err := machineexec.MachineRun(ctx, t.log, t.machineName, "systemctl", "is-active", systemdUnit)
+		t.restart = err == nil
+	}
+	return nil
+}
+
+// ensureFile writes content to path inside the machine unless it is already
+// there, and reports whether it wrote.
+func (t *configureTask) ensureFile(ctx context.Context, path string, content []byte) (bool, error) {
+	hostPath := filepath.Join(t.machineDir, path)
+	current, err := os.ReadFile(hostPath) //nolint:gosec // path is constructed, not user input
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return false, err
+	case bytes.Equal(current, content):
+		return false, nil
+	}
+	before := audit.HashFile(hostPath)
+	if err := utilio.WriteFile(hostPath, content, 0o644); err != nil { //nolint:gosec // unit and Corefile must be readable
+		return false, err
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileWrite, Target: hostPath, BeforeHash: before, AfterHash: audit.HashBytes(content)})
+	return true, nil
+}
+
+// ensureEnabled links the unit into multi-user.target.wants, as systemctl
+// enable would, so the machine starts the cache when it boots.
+func (t *configureTask) ensureEnabled() error {
+	link := filepath.Join(t.machineDir, wantsPath)
+	if target, err := os.Readlink(link); err == nil && target == unitPath {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil { //nolint:gosec // systemd reads the directory inside the machine
+		return err
+	}
+	if err := os.Remove(link); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(unitPath, link)
+}
+
+type startTask struct{ *Installer }
+
+func (t *startTask) Name() string { return "start-local-dns" }
+
+func (t *startTask) Do(ctx context.Context) error {
+	if _, err := machineexec.MachineRun(ctx, t.log, t.machineName, "systemctl", "is-active", systemdUnit); err != nil {
+		if _, err := machineexec.MachineRun(ctx, t.log, t.machineName, "systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("daemon-reload in machine %s: %w", t.machineName, err)
+		}
+		if _, err := machineexec.MachineRun(ctx, t.log, t.machineName, "systemctl", "enable", "--now", systemdUnit); err != nil {
+			return fmt.Errorf("start local DNS cache in machine %s: %w", t.machineName, err)
+		}
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitStart, Target: systemdUnit, Detail: "machine " + t.machineName})
+		return nil
+	}
+	if !t.restart {
+		return nil
+	}
+	if _, err := machineexec.MachineRun(ctx, t.log, t.machineName, "systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("daemon-reload in machine %s: %w", t.machineName, err)
+	}
+	if _, err := machineexec.MachineRun(ctx, t.log, t.machineName, "systemctl", "restart", systemdUnit); err != nil {
+		return fmt.Errorf("restart local DNS cache in machine %s: %w", t.machineName, err)
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitRestart, Target: systemdUnit, Detail: "machine " + t.machineName})
+	return nil
+}
+
+// Corefile renders the cache's CoreDNS config for cfg.
+func Corefile(cfg *config.Config) (string, error) {
+	upstreams := "/etc/resolv.conf"
+	if len(cfg.LocalDNS.Upstreams) > 0 {
+		upstreams = strings.Join(cfg.LocalDNS.Upstreams, " ")
+	}
+	var buf bytes.Buffer
+	if err := corefileTmpl.Execute(&buf, map[string]any{
+		"ClusterDomain": ClusterDomain,
+		"Address":       cfg.LocalDNSAddress(),
+		"ClusterDNS":    cfg.Networking.DNSServiceIP,
+		"Upstreams":     upstreams,
+		"HealthPort":    healthPort,
+	}); err != nil {
+		return "", fmt.Errorf("render Corefile: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Check resolves the API server's service name through the cache at address,
+// which exercises the cache and its path to the cluster DNS service.
+func Check(ctx context.Context, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(address, "53"))
+		},
+	}
+	if _, err := resolver.LookupHost(ctx, "kubernetes.default.svc."+ClusterDomain+"."); err != nil {
+		return fmt.Errorf("resolve through local DNS cache at %s: %w", address, err)
+	}
+	return nil
+}
+
+// Preflight returns a reachability check for the CoreDNS download when the
+// cache is enabled.
+func Preflight(cfg *config.Config) []preflight.Checker {
+	if !cfg.LocalDNSEnabled() {
+		return nil
+	}
+	return []preflight.Checker{
+		artifactsource.ReachabilityChecker{
+			CheckName:  artifactCheckName,
+			Target:     artifactTarget,
+			OKMessage:  "node-local DNS cache artifact is reachable",
+			ErrMessage: "node-local DNS cache artifact is not reachable",
+			Sources: func() (artifactsource.Sources, error) {
+				source, err := artifactsource.Parse(coreDNSURL(version(cfg)))
+				if err != nil {
+					return nil, err
+				}
+				return artifactsource.Sources{"coredns": source}, nil
+			},
+		},
+	}
+}
+
+func version(cfg *config.Config) string {
+	if cfg.LocalDNS.Version != "" {
+		return strings.TrimPrefix(cfg.LocalDNS.Version, "v")
+	}
+	return DefaultVersion
+}
+
+func coreDNSURL(version string) string {
+	return fmt.Sprintf(coreDNSURLTemplate, version, version, utilhost.GetArch())
+}
+
+func versionMatch(hostBinaryPath, expectedVersion string) bool {
+	if !utilio.IsExecutable(hostBinaryPath) {
+		return false
+	}
+	output, err := utilexec.New().Command(hostBinaryPath, "-version").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(output), expectedVersion)
+}
@@ -0,0 +1,100 @@
+package localdns
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestCoreDNSURL(t *testing.T) {
+	t.Parallel()
+
+	want := "https://github.com/coredns/coredns/releases/download/v1.12.1/coredns_1.12.1_linux_" + runtime.GOARCH + ".tgz"
+	if got := coreDNSURL(version(&config.Config{LocalDNS: config.LocalDNSConfig{Version: "v1.12.1"}})); got != want {
+		t.Errorf("coreDNSURL() = %s, want %s", got, want)
+	}
+}
+
+func TestTasksSkippedUnlessEnabled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want bool
+	}{
+		{name: "default", cfg: &config.Config{}},
+		{name: "enabled", cfg: &config.Config{LocalDNS: config.LocalDNSConfig{Enabled: true}}, want: true},
+		{
+			name: "offline",
+			cfg: &config.Config{
+				LocalDNS:  config.LocalDNSConfig{Enabled: true},
+				Bootstrap: config.BootstrapConfig{OfflineArtifacts: config.OfflineArtifactsConfig{Source: "/opt/artifacts"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, skipped := Download(slog.New(slog.DiscardHandler), tt.cfg, t.TempDir()).(skippedTask)
+		if skipped == tt.want {
+			t.Errorf("%s: Download() skipped = %v, want %v", tt.name, skipped, !tt.want)
+		}
+		if got := len(Preflight(tt.cfg)) > 0; got != tt.want {
+			t.Errorf("%s: Preflight() has checks = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCorefile(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{
+		Networking: config.NetworkingConfig{DNSServiceIP: "10.0.0.10"},
+		LocalDNS:   config.LocalDNSConfig{Enabled: true},
+	}
+	corefile, err := Corefile(cfg)
+	if err != nil {
+		t.Fatalf("Corefile() error = %v", err)
+	}
+	for _, want := range []string{
+		"cluster.local:53 in-addr.arpa:53 ip6.arpa:53 {",
+		"bind 169.254.20.10",
+		"forward . 10.0.0.10 {",
+		"forward . /etc/resolv.conf",
+		"health 169.254.20.10:8080",
+	} {
+		if !strings.Contains(corefile, want) {
+			t.Errorf("Corefile =\n%s\nwant %q", corefile, want)
+		}
+	}
+
+	cfg.LocalDNS.Address = "169.254.0.53"
+	cfg.LocalDNS.Upstreams = []string{"192.0.2.53", "198.51.100.53:5353"}
+	corefile, err = Corefile(cfg)
+	if err != nil {
+		t.Fatalf("Corefile() error = %v", err)
+	}
+	if !strings.Contains(corefile, "bind 169.254.0.53") || !strings.Contains(corefile, "forward . 192.0.2.53 198.51.100.53:5353\n") {
+		t.Errorf("Corefile =\n%s\nwant the configured address and upstreams", corefile)
+	}
+}
+
+func TestConfigureEnablesUnit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	task := &configureTask{&Installer{machineDir: dir}}
+	for range 2 {
+		if err := task.ensureEnabled(); err != nil {
+			t.Fatalf("ensureEnabled() error = %v", err)
+		}
+	}
+	target, err := os.Readlink(filepath.Join(dir, wantsPath))
+	if err != nil || target != unitPath {
+		t.Fatalf("wants link = %q, %v; want %s", target, err, unitPath)
+	}
+}
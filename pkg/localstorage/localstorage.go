@@ -0,0 +1,333 @@
+// Package localstorage prepares node-local storage for CSI-less nodes: an LVM
+// volume group for an LVM provisioner, or a host directory bind-mounted into
+// the nspawn machine for the local-path provisioner. What it creates is
+// recorded so reset removes exactly that.
+package localstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// RecordPath lists the volume group and modules file the agent created.
+	RecordPath = config.ConfigDir + "/local-storage.json"
+
+	// ModulesLoadFile loads the device-mapper modules LVM provisioners use
+	// at every boot.
+	ModulesLoadFile = "/etc/modules-load.d/aks-flex-node-storage.conf"
+
+	modulesLoadHeader = "# Managed by aks-flex-node. Changes are overwritten.\n"
+)
+
+// lvmModules are the device-mapper modules for thin pools and snapshots.
+var lvmModules = []string{"dm_thin_pool", "dm_snapshot"}
+
+// Runner runs a host command and returns its standard output.
+type Runner func(ctx context.Context, name string, args ...string) (string, error)
+
+// Record is the persisted local storage setup.
+type Record struct {
+	// VolumeGroup is the volume group the agent created, or "".
+	VolumeGroup string `json:"volumeGroup,omitempty"`
+	// Devices are the physical volumes the agent added to it.
+	Devices []string `json:"devices,omitempty"`
+	// ModulesLoadFile reports whether the agent wrote ModulesLoadFile.
+	ModulesLoadFile bool `json:"modulesLoadFile,omitempty"`
+}
+
+// Host changes the storage of a host.
+type Host struct {
+	log        *slog.Logger
+	run        Runner
+	recordPath string
+	modulesDir string
+}
+
+// NewHost returns a Host for the host under root.
+func NewHost(log *slog.Logger, root utilhost.Root) *Host {
+	return &Host{
+		log: log,
+		run: func(ctx context.Context, name string, args ...string) (string, error) {
+			return root.Output(ctx, log, name, args...)
+		},
+		recordPath: root.Path(RecordPath),
+		modulesDir: root.Path(filepath.Dir(ModulesLoadFile)),
+	}
+}
+
+// physicalVolumes returns the volume group of each LVM physical volume.
+func (h *Host) physicalVolumes(ctx context.Context) (map[string]string, error) {
+	out, err := h.run(ctx, "pvs", "--noheadings", "--separator", ":", "-o", "pv_name,vg_name")
+	if err != nil {
+		return nil, fmt.Errorf("list physical volumes: %w", err)
+	}
+	pvs := map[string]string{}
+	for line := range strings.Lines(out) {
+		name, vg, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok {
+			pvs[name] = vg
+		}
+	}
+	return pvs, nil
+}
+
+// ApplyLVM creates the volume group, or extends it with configured devices
+// it lacks. Devices that belong to another volume group are refused, and
+// LVM itself refuses devices that hold a filesystem or partition table.
+func (h *Host) ApplyLVM(ctx context.Context, lvm *config.LVMStorageConfig) error {
+	pvs, err := h.physicalVolumes(ctx)
+	if err != nil {
+		return err
+	}
+	exists := slices.Contains(slices.Collect(maps.Values(pvs)), lvm.VolumeGroup)
+	var missing []string
+	for _, device := range lvm.Devices {
+		resolved := resolveDevice(device)
+		switch vg, ok := pvs[resolved]; {
+		case ok && vg == lvm.VolumeGroup:
+		case ok && vg != "":
+			return fmt.Errorf("device %s already belongs to volume group %s", device, vg)
+		default:
+			missing = append(missing, resolved)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// Record before acting: removing a volume group that was never created
+	// is harmless, while an unrecorded one would outlive reset.
+	record, err := loadRecord(h.recordPath)
+	if err != nil {
+		return err
+	}
+	if !exists || record.VolumeGroup == lvm.VolumeGroup {
+		record.VolumeGroup = lvm.VolumeGroup
+		record.Devices = appendMissing(record.Devices, missing...)
+		if err := saveRecord(h.recordPath, record); err != nil {
+			return err
+		}
+	}
+
+	if exists {
+		h.log.Info("extending LVM volume group", "volumeGroup", lvm.VolumeGroup, "devices", missing)
+		if _, err := h.run(ctx, "vgextend", append([]string{lvm.VolumeGroup}, missing...)...); err != nil {
+			return fmt.Errorf("extend volume group %s: %w", lvm.VolumeGroup, err)
+		}
+		return nil
+	}
+	h.log.Info("creating LVM volume group", "volumeGroup", lvm.VolumeGroup, "devices", missing)
+	if _, err := h.run(ctx, "vgcreate", append([]string{lvm.VolumeGroup}, missing...)...); err != nil {
+		return fmt.Errorf("create volume group %s: %w", lvm.VolumeGroup, err)
+	}
+	return nil
+}
+
+// ValidateLVM checks that every configured device is in the volume group.
+func (h *Host) ValidateLVM(ctx context.Context, lvm *config.LVMStorageConfig) error {
+	pvs, err := h.physicalVolumes(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, device := range lvm.Devices {
+		if vg := pvs[resolveDevice(device)]; vg != lvm.VolumeGroup {
+			errs = append(errs, fmt.Errorf("device %s is not in volume group %s", device, lvm.VolumeGroup))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteModulesLoad writes ModulesLoadFile and loads the modules now.
+func (h *Host) WriteModulesLoad(ctx context.Context) error {
+	record, err := loadRecord(h.recordPath)
+	if err != nil {
+		return err
+	}
+	if !record.ModulesLoadFile {
+		record.ModulesLoadFile = true
+		if err := saveRecord(h.recordPath, record); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(h.modulesDir, filepath.Base(ModulesLoadFile))
+	content := []byte(modulesLoadHeader + strings.Join(lvmModules, "\n") + "\n")
+	if current, err := os.ReadFile(path); err != nil || string(current) != string(content) { //#nosec G304 -- fixed path
+		before := audit.HashFile(path)
+		if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // read by systemd-modules-load
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		audit.Record(ctx, h.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content), Detail: "local storage kernel modules"})
+	}
+	if _, err := h.run(ctx, "modprobe", append([]string{"-a"}, lvmModules...)...); err != nil {
+		return fmt.Errorf("load %s: %w", strings.Join(lvmModules, " "), err)
+	}
+	return nil
+}
+
+// Reset removes what the record lists. A volume group that still holds
+// logical volumes is left in place with a warning, as removing it would
+// destroy workload data.
+func (h *Host) Reset(ctx context.Context) error {
+	record, err := loadRecord(h.recordPath)
+	if err != nil {
+		return err
+	}
+	if record.ModulesLoadFile {
+		path := filepath.Join(h.modulesDir, filepath.Base(ModulesLoadFile))
+		data, err := os.ReadFile(path) //#nosec G304 -- fixed path
+		if err == nil && strings.HasPrefix(string(data), modulesLoadHeader) {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("remove %s: %w", path, err)
+			}
+			audit.Record(ctx, h.log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: audit.HashBytes(data), Detail: "local storage kernel modules"})
+		}
+	}
+	if record.VolumeGroup != "" {
+		if err := h.removeVolumeGroup(ctx, record); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(h.recordPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove local storage record: %w", err)
+	}
+	return nil
+}
+
+func (h *Host) removeVolumeGroup(ctx context.Context, record *Record) error {
+	out, err := h.run(ctx, "vgs", "--noheadings", "-o", "lv_count", record.VolumeGroup)
+	if err != nil {
+		h.log.Warn("volume group not found; nothing to remove", "volumeGroup", record.VolumeGroup, "error", err)
+		return nil
+	}
+	if count, _ := strconv.Atoi(strings.TrimSpace(out)); count > 0 {
+		h.log.Warn("leaving LVM volume group that still holds logical volumes; remove it by hand once the data is no longer needed",
+			"volumeGroup", record.VolumeGroup, "logicalVolumes", count)
+		return nil
+	}
+	h.log.Info("removing LVM volume group", "volumeGroup", record.VolumeGroup, "devices", record.Devices)
+	if _, err := h.run(ctx, "vgremove", record.VolumeGroup); err != nil {
+		return fmt.Errorf("remove volume group %s: %w", record.VolumeGroup, err)
+	}
+	if len(record.Devices) > 0 {
+		if _, err := h.run(ctx, "pvremove", record.Devices...); err != nil {
+			return fmt.Errorf("remove physical volumes %s: %w", strings.Join(record.Devices, " "), err)
+		}
+	}
+	return nil
+}
+
+type configureTask struct {
+	log  *slog.Logger
+	cfg  config.LocalStorageConfig
+	host *Host
+}
+
+// Configure returns a task that creates the configured volume group and
+// local-path directory and, when asked, the LVM provisioner's kernel module
+// prerequisites. Nothing is done without local storage config.
+func Configure(log *slog.Logger, cfg *config.Config) phases.Task {
+	return &configureTask{log: log, cfg: cfg.LocalStorage, host: NewHost(log, utilhost.HostRoot)}
+}
+
+func (t *configureTask) Name() string { return "configure-local-storage" }
+
+// Plan returns the record and, with LVM prerequisites, the modules file.
+func (t *configureTask) Plan() []string {
+	lvm := t.cfg.LVM
+	if lvm == nil {
+		return nil
+	}
+	if lvm.Prerequisites {
+		return []string{RecordPath, ModulesLoadFile}
+	}
+	return []string{RecordPath}
+}
+
+func (t *configureTask) Do(ctx context.Context) error {
+	if lvm := t.cfg.LVM; lvm != nil {
+		if lvm.Prerequisites {
+			if err := t.host.WriteModulesLoad(ctx); err != nil {
+				return err
+			}
+		}
+		if err := t.host.ApplyLVM(ctx, lvm); err != nil {
+			return err
+		}
+		if err := t.host.ValidateLVM(ctx, lvm); err != nil {
+			return err
+		}
+	}
+	if lp := t.cfg.LocalPath; lp != nil {
+		if err := os.MkdirAll(lp.Path, 0o755); err != nil { //nolint:gosec // provisioner volumes are created below it
+			return fmt.Errorf("create local-path directory %s: %w", lp.Path, err)
+		}
+	}
+	return nil
+}
+
+type resetTask struct {
+	host *Host
+}
+
+// ResetHost returns a task that removes the volume group and modules file
+// the agent created. It runs on reset, without the agent config, so it acts
+// on the record alone. The local-path directory and its volumes are kept.
+func ResetHost(log *slog.Logger) phases.Task {
+	return &resetTask{host: NewHost(log, utilhost.HostRoot)}
+}
+
+func (t *resetTask) Name() string { return "reset-local-storage" }
+
+func (t *resetTask) Do(ctx context.Context) error {
+	return t.host.Reset(ctx)
+}
+
+func loadRecord(path string) (*Record, error) {
+	record := &Record{}
+	if err := utilio.ReadJSON(path, record); err != nil {
+		return nil, fmt.Errorf("read local storage record: %w", err)
+	}
+	return record, nil
+}
+
+func saveRecord(path string, record *Record) error {
+	if err := utilio.WriteJSON(path, record, 0o600); err != nil {
+		return fmt.Errorf("write local storage record: %w", err)
+	}
+	return nil
+}
+
+// resolveDevice returns the device node a /dev/disk link points to, as LVM
+// lists physical volumes by node.
+func resolveDevice(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		return resolved
+	}
+	return device
+}
+
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,191 @@
+package localstorage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// fakeLVM answers the LVM commands from an in-memory set of physical
+// volumes and records every command.
+type fakeLVM struct {
+	pvs      map[string]string
+	lvCount  string
+	commands []string
+}
+
+func (f *fakeLVM) run(_ context.Context, name string, args ...string) (string, error) {
+	f.commands = append(f.commands, strings.Join(append([]string{name}, args...), " "))
+	switch name {
+	case "pvs":
+		var out strings.Builder
+		for pv, vg := range f.pvs {
+			out.WriteString("  " + pv + ":" + vg + "\n")
+		}
+		return out.String(), nil
+	case "vgcreate", "vgextend":
+		for _, pv := range args[1:] {
+			f.pvs[pv] = args[0]
+		}
+	case "vgs":
+		if f.lvCount == "" {
+			return "", errors.New("volume group not found")
+		}
+		return "  " + f.lvCount + "\n", nil
+	}
+	return "", nil
+}
+
+func newTestHost(t *testing.T, lvm *fakeLVM) *Host {
+	t.Helper()
+	dir := t.TempDir()
+	return &Host{
+		log:        slog.New(slog.DiscardHandler),
+		run:        lvm.run,
+		recordPath: filepath.Join(dir, "local-storage.json"),
+		modulesDir: filepath.Join(dir, "modules-load.d"),
+	}
+}
+
+func TestApplyLVMCreatesAndResetRemovesVolumeGroup(t *testing.T) {
+	t.Parallel()
+
+	lvm := &fakeLVM{pvs: map[string]string{"/dev/sda2": "ubuntu-vg"}}
+	h := newTestHost(t, lvm)
+	cfg := &config.LVMStorageConfig{VolumeGroup: "flex", Devices: []string{"/dev/sdb", "/dev/sdc"}}
+	if err := h.ApplyLVM(t.Context(), cfg); err != nil {
+		t.Fatalf("ApplyLVM() error = %v", err)
+	}
+	if err := h.ValidateLVM(t.Context(), cfg); err != nil {
+		t.Fatalf("ValidateLVM() error = %v", err)
+	}
+	if !slices.Contains(lvm.commands, "vgcreate flex /dev/sdb /dev/sdc") {
+		t.Errorf("commands = %v, want vgcreate", lvm.commands)
+	}
+
+	// A second apply finds the volume group complete.
+	lvm.commands = nil
+	if err := h.ApplyLVM(t.Context(), cfg); err != nil {
+		t.Fatalf("second ApplyLVM() error = %v", err)
+	}
+	if len(lvm.commands) != 1 {
+		t.Errorf("second apply ran %v, want only pvs", lvm.commands)
+	}
+
+	lvm.lvCount = "0"
+	lvm.commands = nil
+	if err := (&resetTask{host: h}).Do(t.Context()); err != nil {
+		t.Fatalf("reset error = %v", err)
+	}
+	if !slices.Contains(lvm.commands, "vgremove flex") || !slices.Contains(lvm.commands, "pvremove /dev/sdb /dev/sdc") {
+		t.Errorf("reset ran %v, want vgremove and pvremove", lvm.commands)
+	}
+	if _, err := os.Stat(h.recordPath); !os.IsNotExist(err) {
+		t.Errorf("record still exists: %v", err)
+	}
+}
+
+func TestApplyLVMExtendsVolumeGroup(t *testing.T) {
+	t.Parallel()
+
+	lvm := &fakeLVM{pvs: map[string]string{"/dev/sdb": "flex", "/dev/sdc": ""}}
+	h := newTestHost(t, lvm)
+	cfg := &config.LVMStorageConfig{VolumeGroup: "flex", Devices: []string{"/dev/sdb", "/dev/sdc"}}
+	if err := h.ApplyLVM(t.Context(), cfg); err != nil {
+		t.Fatalf("ApplyLVM() error = %v", err)
+	}
+	if !slices.Contains(lvm.commands, "vgextend flex /dev/sdc") {
+		t.Errorf("commands = %v, want vgextend", lvm.commands)
+	}
+	// The volume group predates the agent, so reset leaves it alone.
+	if record, err := loadRecord(h.recordPath); err != nil || record.VolumeGroup != "" {
+		t.Errorf("record = %+v, %v, want no volume group", record, err)
+	}
+}
+
+func TestApplyLVMRefusesDeviceOfAnotherVolumeGroup(t *testing.T) {
+	t.Parallel()
+
+	h := newTestHost(t, &fakeLVM{pvs: map[string]string{"/dev/sdb": "data"}})
+	err := h.ApplyLVM(t.Context(), &config.LVMStorageConfig{VolumeGroup: "flex", Devices: []string{"/dev/sdb"}})
+	if err == nil || !strings.Contains(err.Error(), "already belongs to volume group data") {
+		t.Fatalf("ApplyLVM() = %v, want other volume group error", err)
+	}
+}
+
+func TestResetKeepsVolumeGroupWithVolumes(t *testing.T) {
+	t.Parallel()
+
+	lvm := &fakeLVM{pvs: map[string]string{}, lvCount: "3"}
+	h := newTestHost(t, lvm)
+	if err := saveRecord(h.recordPath, &Record{VolumeGroup: "flex", Devices: []string{"/dev/sdb"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reset(t.Context()); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	for _, command := range lvm.commands {
+		if strings.HasPrefix(command, "vgremove") || strings.HasPrefix(command, "pvremove") {
+			t.Errorf("reset ran %q on a volume group with logical volumes", command)
+		}
+	}
+}
+
+func TestWriteModulesLoad(t *testing.T) {
+	t.Parallel()
+
+	lvm := &fakeLVM{pvs: map[string]string{}}
+	h := newTestHost(t, lvm)
+	if err := h.WriteModulesLoad(t.Context()); err != nil {
+		t.Fatalf("WriteModulesLoad() error = %v", err)
+	}
+	path := filepath.Join(h.modulesDir, filepath.Base(ModulesLoadFile))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "dm_thin_pool\ndm_snapshot\n") {
+		t.Errorf("modules file = %q", data)
+	}
+	if !slices.Contains(lvm.commands, "modprobe -a dm_thin_pool dm_snapshot") {
+		t.Errorf("commands = %v, want modprobe", lvm.commands)
+	}
+
+	if err := h.Reset(t.Context()); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("modules file still exists: %v", err)
+	}
+}
+
+func TestAddBind(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "kube1.nspawn")
+	if err := os.WriteFile(path, []byte("[Exec]\nCapability=all\n\n[Files]\nBindReadOnly=/lib/modules"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := AddBind(path, config.DefaultLocalPath); err != nil {
+			t.Fatalf("AddBind() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "Bind=/opt/local-path-provisioner\n"); got != 1 {
+		t.Errorf("nspawn file has %d binds, want 1:\n%s", got, data)
+	}
+	if !strings.Contains(string(data), "BindReadOnly=/lib/modules\n\n[Files]\n") {
+		t.Errorf("nspawn file =\n%s", data)
+	}
+}
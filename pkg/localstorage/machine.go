@@ -0,0 +1,60 @@
+package localstorage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+type bindMachineTask struct {
+	cfg              config.LocalStorageConfig
+	nspawnConfigFile string
+}
+
+// BindMachine returns a task that bind-mounts the local-path directory into
+// the machine at the same path through the machine's nspawn settings file,
+// so volumes outlive repaves. The bind is set up by systemd-nspawn in the
+// machine's own mount namespace; removing the machine directory does not
+// reach the volumes.
+func BindMachine(cfg *config.Config, nspawnConfigFile string) phases.Task {
+	return &bindMachineTask{cfg: cfg.LocalStorage, nspawnConfigFile: nspawnConfigFile}
+}
+
+func (t *bindMachineTask) Name() string { return "bind-local-storage" }
+
+func (t *bindMachineTask) Do(context.Context) error {
+	if t.cfg.LocalPath == nil {
+		return nil
+	}
+	return AddBind(t.nspawnConfigFile, t.cfg.LocalPath.Path)
+}
+
+// AddBind adds a Bind= of path to the nspawn settings file unless it is
+// already there. The [Files] section is repeated at the end, which systemd
+// merges with the one the rootfs templates render.
+func AddBind(nspawnConfigFile, path string) error {
+	data, err := os.ReadFile(nspawnConfigFile) //#nosec G304 -- nspawn settings file of the goal state
+	if err != nil {
+		return fmt.Errorf("read %s: %w", nspawnConfigFile, err)
+	}
+	bind := "Bind=" + path
+	for line := range strings.Lines(string(data)) {
+		if strings.TrimSpace(line) == bind {
+			return nil
+		}
+	}
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "\n[Files]\n# Local-path provisioner volumes, kept on the host across repaves.\n" + bind + "\n"
+	if err := os.WriteFile(nspawnConfigFile, []byte(content), 0o644); err != nil { //nolint:gosec // read by systemd-nspawn
+		return fmt.Errorf("write %s: %w", nspawnConfigFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package localstorage
+
+import (
+	"context"
+	"os"
+	"os/exec"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+const checkName = "local-storage"
+
+// Preflight returns the local storage check, or nil without LVM config. The
+// local-path directory needs nothing the host could lack.
+func Preflight(cfg *config.Config) []preflight.Checker {
+	if cfg.LocalStorage.LVM == nil {
+		return nil
+	}
+	return []preflight.Checker{lvmChecker{lvm: cfg.LocalStorage.LVM, lookPath: exec.LookPath}}
+}
+
+type lvmChecker struct {
+	lvm      *config.LVMStorageConfig
+	lookPath func(string) (string, error)
+}
+
+func (lvmChecker) Name() string { return checkName }
+
+func (c lvmChecker) Check(context.Context) []preflight.Result {
+	var results []preflight.Result
+	if _, err := c.lookPath("vgcreate"); err != nil {
+		results = append(results, preflight.ResultsError(checkName, "lvm2", "vgcreate not found; install the lvm2 package")...)
+	} else {
+		results = append(results, preflight.ResultsOK(checkName, "lvm2", "LVM tools are installed")...)
+	}
+	for _, device := range c.lvm.Devices {
+		info, err := os.Stat(device)
+		switch {
+		case err != nil:
+			results = append(results, preflight.ResultsError(checkName, device, "%v", err)...)
+		case info.Mode()&os.ModeDevice == 0 || info.Mode()&os.ModeCharDevice != 0:
+			results = append(results, preflight.ResultsError(checkName, device, "%s is not a block device", device)...)
+		default:
+			results = append(results, preflight.ResultsOK(checkName, device, device+" is a block device")...)
+		}
+	}
+	return results
+}
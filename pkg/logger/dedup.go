@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for NewDedupHandler.
+const (
+	// DefaultDedupWindow is how long a repeated warning stays suppressed
+	// after it was last written.
+	DefaultDedupWindow = 5 * time.Minute
+	// DefaultEscalateAfter is the number of consecutive occurrences after
+	// which a repeated warning is written as an error.
+	DefaultEscalateAfter = 20
+
+	// maxDedupEntries bounds the remembered messages; stale ones are
+	// dropped when it is reached.
+	maxDedupEntries = 1024
+)
+
+// DedupOptions configures NewDedupHandler. Zero fields use the defaults.
+type DedupOptions struct {
+	Window        time.Duration
+	EscalateAfter int
+	// Now is the clock, for tests.
+	Now func() time.Time
+}
+
+// dedupEntry tracks one distinct warning.
+type dedupEntry struct {
+	lastWritten time.Time
+	lastSeen    time.Time
+	suppressed  int
+	occurrences int
+}
+
+type dedupState struct {
+	opts    DedupOptions
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+// dedupHandler rate-limits identical warnings and errors so loops that hit
+// the same failure every interval do not flood the journal during an outage.
+type dedupHandler struct {
+	next  slog.Handler
+	state *dedupState
+	// prefix identifies the attributes and groups added through WithAttrs
+	// and WithGroup, which are part of a record's identity.
+	prefix string
+}
+
+// NewDedupHandler wraps next so a record at warning level or above with the
+// same message and attributes as an earlier one is written at most once per
+// window. The next record written after suppression carries the number of
+// suppressed repeats in a "repeated" attribute. A warning that keeps
+// recurring, without a quiet window in between, is written as an error once
+// it has occurred EscalateAfter times. Records below warning level pass
+// through unchanged.
+func NewDedupHandler(next slog.Handler, opts DedupOptions) slog.Handler {
+	if opts.Window <= 0 {
+		opts.Window = DefaultDedupWindow
+	}
+	if opts.EscalateAfter <= 0 {
+		opts.EscalateAfter = DefaultEscalateAfter
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &dedupHandler{next: next, state: &dedupState{opts: opts, entries: map[string]*dedupEntry{}}}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < slog.LevelWarn {
+		return h.next.Handle(ctx, record)
+	}
+	key := h.key(record)
+	write, suppressed, occurrences := h.state.observe(key)
+	if !write {
+		return nil
+	}
+	if suppressed > 0 {
+		record = record.Clone()
+		record.AddAttrs(slog.Int("repeated", suppressed))
+	}
+	if record.Level == slog.LevelWarn && occurrences >= h.state.opts.EscalateAfter {
+		escalated := slog.NewRecord(record.Time, slog.LevelError, record.Message, record.PC)
+		record.Attrs(func(a slog.Attr) bool {
+			escalated.AddAttrs(a)
+			return true
+		})
+		escalated.AddAttrs(slog.Int("occurrences", occurrences))
+		record = escalated
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.prefix)
+	for _, a := range attrs {
+		writeAttrKey(&b, a)
+	}
+	return &dedupHandler{next: h.next.WithAttrs(attrs), state: h.state, prefix: b.String()}
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	return &dedupHandler{next: h.next.WithGroup(name), state: h.state, prefix: h.prefix + name + "{"}
+}
+
+func (h *dedupHandler) key(record slog.Record) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s|%s", record.Level, h.prefix, record.Message)
+	record.Attrs(func(a slog.Attr) bool {
+		writeAttrKey(&b, a)
+		return true
+	})
+	return b.String()
+}
+
+func writeAttrKey(b *strings.Builder, a slog.Attr) {
+	fmt.Fprintf(b, "|%s=%s", a.Key, a.Value.Resolve())
+}
+
+// observe records one occurrence of key and reports whether to write it,
+// how many repeats were suppressed since it was last written, and how many
+// times it has occurred without a quiet window.
+func (s *dedupState) observe(key string) (write bool, suppressed, occurrences int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.opts.Now()
+	entry, ok := s.entries[key]
+	if !ok || now.Sub(entry.lastSeen) >= s.opts.Window {
+		if !ok {
+			s.prune(now)
+			entry = &dedupEntry{}
+			s.entries[key] = entry
+		}
+		// The condition cleared and came back; start counting afresh.
+		*entry = dedupEntry{lastWritten: now, lastSeen: now, occurrences: 1, suppressed: entry.suppressed}
+		suppressed, entry.suppressed = entry.suppressed, 0
+		return true, suppressed, 1
+	}
+	entry.lastSeen = now
+	entry.occurrences++
+	if now.Sub(entry.lastWritten) < s.opts.Window {
+		entry.suppressed++
+		return false, 0, entry.occurrences
+	}
+	entry.lastWritten = now
+	suppressed, entry.suppressed = entry.suppressed, 0
+	return true, suppressed, entry.occurrences
+}
+
+// prune drops entries not seen for a window once the map is full.
+func (s *dedupState) prune(now time.Time) {
+	if len(s.entries) < maxDedupEntries {
+		return
+	}
+	for key, entry := range s.entries {
+		if now.Sub(entry.lastSeen) >= s.opts.Window {
+			delete(s.entries, key)
+		}
+	}
+}
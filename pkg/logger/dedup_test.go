@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupHandler(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	log := slog.New(NewDedupHandler(slog.NewTextHandler(&buf, nil), DedupOptions{
+		Window:        time.Minute,
+		EscalateAfter: 5,
+		Now:           func() time.Time { return now },
+	})).With("loop", "heartbeat")
+
+	lines := func() []string {
+		out := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		buf.Reset()
+		return out
+	}
+
+	for range 3 {
+		log.Warn("failed to renew heartbeat lease", "error", "timeout")
+		log.Info("heartbeat tick")
+		now = now.Add(15 * time.Second)
+	}
+	got := lines()
+	if len(got) != 4 {
+		t.Fatalf("got %d lines, want one warning and three info lines:\n%s", len(got), strings.Join(got, "\n"))
+	}
+
+	// A different error is a different message.
+	log.Warn("failed to renew heartbeat lease", "error", "forbidden")
+	if got := lines(); len(got) != 1 || strings.Contains(got[0], "repeated") {
+		t.Fatalf("distinct warning = %q, want it written without a summary", got)
+	}
+
+	now = now.Add(30 * time.Second)
+	log.Warn("failed to renew heartbeat lease", "error", "timeout")
+	got = lines()
+	if len(got) != 1 || !strings.Contains(got[0], "level=WARN") || !strings.Contains(got[0], "repeated=2") {
+		t.Fatalf("after window = %q, want a warning with repeated=2", got)
+	}
+
+	now = now.Add(15 * time.Second)
+	log.Warn("failed to renew heartbeat lease", "error", "timeout")
+	now = now.Add(50 * time.Second)
+	log.Warn("failed to renew heartbeat lease", "error", "timeout")
+	got = lines()
+	if len(got) != 1 || !strings.Contains(got[0], "level=ERROR") || !strings.Contains(got[0], "occurrences=6") {
+		t.Fatalf("recurring warning = %q, want it escalated to an error", got)
+	}
+
+	// A quiet window resets the escalation.
+	now = now.Add(2 * time.Minute)
+	log.Warn("failed to renew heartbeat lease", "error", "timeout")
+	if got := lines(); len(got) != 1 || !strings.Contains(got[0], "level=WARN") {
+		t.Fatalf("after quiet window = %q, want a plain warning", got)
+	}
+}
@@ -30,20 +30,26 @@ func ParseLogLevel(level string) (slog.Level, error) {
 // CreateLogger creates and returns a *slog.Logger with the specified level
 // and optional log directory for file output.
 func CreateLogger(level, logDir string) *slog.Logger {
+	return CreateLoggerTo(os.Stdout, level, logDir)
+}
+
+// CreateLoggerTo is CreateLogger with console output going to console
+// instead of stdout, for commands whose stdout is machine-readable.
+func CreateLoggerTo(console io.Writer, level, logDir string) *slog.Logger {
 	logLevel, err := ParseLogLevel(level)
 	if err != nil {
-		fmt.Printf("Warning: %v. Using 'info' level as default.\n", err)
+		_, _ = fmt.Fprintf(console, "Warning: %v. Using 'info' level as default.\n", err)
 		logLevel = slog.LevelInfo
 	}
 
 	levelVar := &slog.LevelVar{}
 	levelVar.Set(logLevel)
 
-	// Build the list of writers. Stdout is always included for journal/terminal.
-	writers := []io.Writer{os.Stdout}
+	// Build the list of writers. The console is always included for journal/terminal.
+	writers := []io.Writer{console}
 	if logDir != "" {
 		if fileWriter, err := setupLogFileWriter(logDir); err != nil {
-			fmt.Printf("Warning: Failed to setup log file in directory '%s': %v. Logging to stdout only.\n", logDir, err)
+			_, _ = fmt.Fprintf(console, "Warning: Failed to setup log file in directory '%s': %v. Logging to the console only.\n", logDir, err)
 		} else {
 			writers = append(writers, fileWriter)
 		}
@@ -72,7 +78,9 @@ func CreateLogger(level, logDir string) *slog.Logger {
 		})
 	}
 
-	return slog.New(handler)
+	// Periodic loops hit the same failure every interval during an outage;
+	// keep their repeats out of the journal.
+	return slog.New(NewDedupHandler(handler, DedupOptions{}))
 }
 
 // isRunningUnderSystemd detects if the process is running under systemd
@@ -0,0 +1,260 @@
+// Package machinestore creates the rootfs directories of the node's machine
+// generations under /var/lib/machines.
+//
+// The directory backend leaves that to the rootfs bootstrap, which unpacks the
+// OCI image into every generation's directory. The btrfs backend unpacks each
+// image once into a read-only base subvolume and creates every generation as
+// a writable snapshot of it, so generations share the image's extents and a
+// repave starts without an unpack. machinectl remove deletes a generation's
+// subvolume like a directory, so removal is the same for both backends.
+package machinestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+	"github.com/Azure/unbounded/pkg/agent/phases/rootfs/oci"
+	"golang.org/x/sys/unix"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+const (
+	// MachinesDir holds the machine generations.
+	MachinesDir = "/var/lib/machines"
+
+	// basesDirName holds the btrfs base subvolumes. machinectl does not list
+	// images whose names start with a dot.
+	basesDirName  = ".aks-flex-node-bases"
+	stagingSuffix = ".staging"
+)
+
+// Runner runs a host command and returns its standard output.
+type Runner func(ctx context.Context, name string, args ...string) (string, error)
+
+// Unpack fills dir with the rootfs image.
+type Unpack func(ctx context.Context, dir string) error
+
+// Backend creates the directories of new machine generations.
+type Backend interface {
+	Name() string
+	// Create makes machineDir for a new generation of the image. A
+	// non-empty machineDir is left as it is, like the rootfs bootstrap
+	// leaves it.
+	Create(ctx context.Context, machineDir, image string, unpack Unpack) error
+}
+
+// Select returns the backend named by node.machineStorage for machinesDir.
+// Auto picks btrfs when machinesDir, or its nearest existing parent, is on a
+// btrfs file system.
+func Select(log *slog.Logger, name, machinesDir string, run Runner) (Backend, error) {
+	switch name {
+	case "", config.MachineStorageAuto:
+		if !onBtrfs(machinesDir) {
+			return directoryBackend{}, nil
+		}
+	case config.MachineStorageDirectory:
+		return directoryBackend{}, nil
+	case config.MachineStorageBtrfs:
+		if !onBtrfs(machinesDir) {
+			return nil, fmt.Errorf("node.machineStorage is btrfs but %s is not on a btrfs file system", machinesDir)
+		}
+	default:
+		return nil, fmt.Errorf("unknown machine storage backend %q", name)
+	}
+	return &btrfsBackend{log: log, run: run, basesDir: filepath.Join(machinesDir, basesDirName)}, nil
+}
+
+func onBtrfs(dir string) bool {
+	for {
+		var fs unix.Statfs_t
+		err := unix.Statfs(dir, &fs)
+		if err == nil {
+			return fs.Type == unix.BTRFS_SUPER_MAGIC
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, unix.ENOENT) || parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// directoryBackend keeps the plain directories the rootfs bootstrap creates.
+type directoryBackend struct{}
+
+func (directoryBackend) Name() string { return config.MachineStorageDirectory }
+
+func (directoryBackend) Create(context.Context, string, string, Unpack) error { return nil }
+
+// btrfsBackend creates generations as snapshots of a base subvolume per image.
+type btrfsBackend struct {
+	log      *slog.Logger
+	run      Runner
+	basesDir string
+}
+
+func (b *btrfsBackend) Name() string { return config.MachineStorageBtrfs }
+
+func (b *btrfsBackend) Create(ctx context.Context, machineDir, image string, unpack Unpack) error {
+	entries, err := os.ReadDir(machineDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read machine directory %s: %w", machineDir, err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	base, err := b.ensureBase(ctx, image, unpack)
+	if err != nil {
+		return err
+	}
+	// An empty directory left by an earlier attempt is in the way of the
+	// snapshot.
+	if err := os.Remove(machineDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove empty machine directory %s: %w", machineDir, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(machineDir), 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(machineDir), err)
+	}
+	if _, err := b.run(ctx, "btrfs", "subvolume", "snapshot", base, machineDir); err != nil {
+		return fmt.Errorf("snapshot %s to %s: %w", base, machineDir, err)
+	}
+	b.log.Info("created machine generation as a btrfs snapshot", "machineDir", machineDir, "base", base)
+	b.pruneBases(ctx, base)
+	return nil
+}
+
+// ensureBase returns the read-only base subvolume of image, unpacking it into
+// a staging subvolume first when it does not exist yet. The read-only
+// snapshot of the staging subvolume promotes it atomically, so a base is
+// either complete or absent.
+func (b *btrfsBackend) ensureBase(ctx context.Context, image string, unpack Unpack) (string, error) {
+	base := filepath.Join(b.basesDir, baseName(image))
+	if _, err := os.Stat(base); err == nil {
+		return base, nil
+	}
+	if err := os.MkdirAll(b.basesDir, 0o700); err != nil {
+		return "", fmt.Errorf("create %s: %w", b.basesDir, err)
+	}
+	staging := base + stagingSuffix
+	if _, err := os.Stat(staging); err == nil {
+		// Left by an interrupted unpack.
+		if _, err := b.run(ctx, "btrfs", "subvolume", "delete", staging); err != nil {
+			return "", fmt.Errorf("delete stale staging subvolume %s: %w", staging, err)
+		}
+	}
+	if _, err := b.run(ctx, "btrfs", "subvolume", "create", staging); err != nil {
+		return "", fmt.Errorf("create staging subvolume %s: %w", staging, err)
+	}
+	if err := unpack(ctx, staging); err != nil {
+		b.deleteSubvolume(ctx, staging)
+		return "", fmt.Errorf("unpack rootfs image %s: %w", image, err)
+	}
+	if _, err := b.run(ctx, "btrfs", "subvolume", "snapshot", "-r", staging, base); err != nil {
+		return "", fmt.Errorf("promote base subvolume %s: %w", base, err)
+	}
+	b.deleteSubvolume(ctx, staging)
+	b.log.Info("unpacked rootfs image into a btrfs base subvolume", "image", image, "base", base)
+	return base, nil
+}
+
+// pruneBases deletes the bases of other images. Generations do not depend on
+// their base, so only the next repave of an older image unpacks it again.
+func (b *btrfsBackend) pruneBases(ctx context.Context, keep string) {
+	entries, err := os.ReadDir(b.basesDir)
+	if err != nil {
+		b.log.Warn("failed to list btrfs base subvolumes", "dir", b.basesDir, "error", err)
+		return
+	}
+	for _, entry := range entries {
+		if path := filepath.Join(b.basesDir, entry.Name()); path != keep {
+			b.deleteSubvolume(ctx, path)
+		}
+	}
+}
+
+func (b *btrfsBackend) deleteSubvolume(ctx context.Context, path string) {
+	if _, err := b.run(ctx, "btrfs", "subvolume", "delete", path); err != nil {
+		b.log.Warn("failed to delete btrfs subvolume", "path", path, "error", err)
+	}
+}
+
+// baseName derives a stable subvolume name from the image reference, which
+// may contain slashes and colons.
+func baseName(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return hex.EncodeToString(sum[:8])
+}
+
+type createTask struct {
+	log    *slog.Logger
+	cfg    *config.Config
+	gs     *goalstates.RootFS
+	run    Runner
+	unpack Unpack
+}
+
+// Create returns a task that creates the machine directory of gs with the
+// backend node.machineStorage selects, before the rootfs bootstrap fills it.
+func Create(log *slog.Logger, cfg *config.Config, gs *goalstates.RootFS) phases.Task {
+	return &createTask{
+		log: log,
+		cfg: cfg,
+		gs:  gs,
+		run: func(ctx context.Context, name string, args ...string) (string, error) {
+			return utilexec.OutputCmd(ctx, log, name, args...)
+		},
+		unpack: func(ctx context.Context, dir string) error {
+			return oci.DownloadRootFS(log, dir, gs.HostArch, gs.OCIImage).Do(ctx)
+		},
+	}
+}
+
+func (t *createTask) Name() string { return "create-machine-storage" }
+
+func (t *createTask) Do(ctx context.Context) error {
+	backend, err := Select(t.log, t.cfg.Node.MachineStorage, filepath.Dir(t.gs.MachineDir), t.run)
+	if err != nil {
+		return err
+	}
+	t.log.Info("creating machine storage", "backend", backend.Name(), "machineDir", t.gs.MachineDir)
+	// The image and architecture together identify the unpacked rootfs.
+	return backend.Create(ctx, t.gs.MachineDir, t.gs.HostArch+"/"+t.gs.OCIImage, t.unpack)
+}
+
+type resetTask struct {
+	log *slog.Logger
+	run Runner
+}
+
+// ResetHost returns a task that deletes the btrfs base subvolumes. The
+// machine generations themselves are removed with their machines.
+func ResetHost(log *slog.Logger) phases.Task {
+	return &resetTask{log: log, run: func(ctx context.Context, name string, args ...string) (string, error) {
+		return utilexec.OutputCmd(ctx, log, name, args...)
+	}}
+}
+
+func (t *resetTask) Name() string { return "reset-machine-storage" }
+
+func (t *resetTask) Do(ctx context.Context) error {
+	basesDir := filepath.Join(MachinesDir, basesDirName)
+	if _, err := os.Stat(basesDir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	backend := &btrfsBackend{log: t.log, run: t.run, basesDir: basesDir}
+	backend.pruneBases(ctx, "")
+	if err := os.RemoveAll(basesDir); err != nil {
+		return fmt.Errorf("remove %s: %w", basesDir, err)
+	}
+	return nil
+}
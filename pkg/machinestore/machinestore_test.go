@@ -0,0 +1,129 @@
+package machinestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// fakeBtrfs runs the btrfs subvolume commands on plain directories.
+func fakeBtrfs(t *testing.T, commands *[]string) Runner {
+	t.Helper()
+	return func(_ context.Context, name string, args ...string) (string, error) {
+		*commands = append(*commands, fmt.Sprint(append([]string{name}, args...)))
+		if name != "btrfs" || len(args) < 3 || args[0] != "subvolume" {
+			return "", fmt.Errorf("unexpected command %s %v", name, args)
+		}
+		switch args[1] {
+		case "create":
+			return "", os.Mkdir(args[2], 0o755)
+		case "delete":
+			return "", os.RemoveAll(args[2])
+		case "snapshot":
+			src, dst := args[len(args)-2], args[len(args)-1]
+			return "", os.CopyFS(dst, os.DirFS(src))
+		}
+		return "", fmt.Errorf("unexpected btrfs command %v", args)
+	}
+}
+
+func TestBtrfsBackendCreate(t *testing.T) {
+	t.Parallel()
+
+	machines := t.TempDir()
+	var commands []string
+	backend := &btrfsBackend{log: slog.New(slog.DiscardHandler), run: fakeBtrfs(t, &commands), basesDir: filepath.Join(machines, basesDirName)}
+	unpacks := 0
+	unpack := func(image string) Unpack {
+		return func(_ context.Context, dir string) error {
+			unpacks++
+			return os.WriteFile(filepath.Join(dir, "os-release"), []byte(image), 0o644)
+		}
+	}
+
+	kube1 := filepath.Join(machines, "kube1")
+	kube2 := filepath.Join(machines, "kube2")
+	if err := backend.Create(t.Context(), kube1, "amd64/ubuntu:24.04", unpack("24.04")); err != nil {
+		t.Fatalf("Create kube1: %v", err)
+	}
+	// An empty directory from an interrupted attempt does not stop the snapshot.
+	if err := os.Mkdir(kube2, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Create(t.Context(), kube2, "amd64/ubuntu:24.04", unpack("24.04")); err != nil {
+		t.Fatalf("Create kube2: %v", err)
+	}
+	if unpacks != 1 {
+		t.Fatalf("unpacked %d times, want once for both generations", unpacks)
+	}
+	for _, dir := range []string{kube1, kube2} {
+		if data, err := os.ReadFile(filepath.Join(dir, "os-release")); err != nil || string(data) != "24.04" {
+			t.Fatalf("%s rootfs = %q, %v", dir, data, err)
+		}
+	}
+
+	// A generation that already has content is left alone.
+	commands = nil
+	if err := backend.Create(t.Context(), kube1, "amd64/ubuntu:26.04", unpack("26.04")); err != nil || len(commands) != 0 {
+		t.Fatalf("Create existing = %v, commands %v", err, commands)
+	}
+
+	// A new image gets its own base, and the old one is pruned.
+	if err := os.RemoveAll(kube2); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Create(t.Context(), kube2, "amd64/ubuntu:26.04", unpack("26.04")); err != nil {
+		t.Fatalf("Create new image: %v", err)
+	}
+	bases, err := os.ReadDir(backend.basesDir)
+	if err != nil || len(bases) != 1 || bases[0].Name() != baseName("amd64/ubuntu:26.04") {
+		t.Fatalf("bases = %v, %v; want only the new image", bases, err)
+	}
+}
+
+func TestBtrfsBackendUnpackFailure(t *testing.T) {
+	t.Parallel()
+
+	machines := t.TempDir()
+	var commands []string
+	backend := &btrfsBackend{log: slog.New(slog.DiscardHandler), run: fakeBtrfs(t, &commands), basesDir: filepath.Join(machines, basesDirName)}
+	err := backend.Create(t.Context(), filepath.Join(machines, "kube1"), "amd64/ubuntu:24.04", func(context.Context, string) error {
+		return errors.New("registry unavailable")
+	})
+	if err == nil {
+		t.Fatal("Create() with a failed unpack succeeded")
+	}
+	if entries, _ := os.ReadDir(backend.basesDir); len(entries) != 0 {
+		t.Fatalf("bases after a failed unpack = %v, want none", entries)
+	}
+	if _, err := os.Stat(filepath.Join(machines, "kube1")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("machine directory after a failed unpack: %v", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.DiscardHandler)
+	backend, err := Select(log, config.MachineStorageDirectory, t.TempDir(), nil)
+	if err != nil || backend.Name() != config.MachineStorageDirectory {
+		t.Fatalf("Select(directory) = %v, %v", backend, err)
+	}
+	if _, err := Select(log, "zfs", t.TempDir(), nil); err == nil {
+		t.Fatal("Select(zfs) succeeded")
+	}
+	dir := filepath.Join(t.TempDir(), "machines")
+	backend, err = Select(log, config.MachineStorageAuto, dir, nil)
+	if err != nil {
+		t.Fatalf("Select(auto): %v", err)
+	}
+	if want := map[bool]string{true: config.MachineStorageBtrfs, false: config.MachineStorageDirectory}[onBtrfs(dir)]; backend.Name() != want {
+		t.Fatalf("Select(auto) = %s, want %s", backend.Name(), want)
+	}
+}
@@ -0,0 +1,131 @@
+// Package manifest records the path, mode, and SHA-256 of the files installed
+// into a machine rootfs, and re-hashes them later so bit rot and manual
+// tampering of the node's binaries do not go unnoticed.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Entry is one recorded file. Regular files carry their content hash,
+// symlinks their target.
+type Entry struct {
+	Path   string      `json:"path"`
+	Mode   fs.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256,omitempty"`
+	Link   string      `json:"link,omitempty"`
+}
+
+// Manifest is the recorded content of a machine rootfs.
+type Manifest struct {
+	Machine    string    `json:"machine"`
+	MachineDir string    `json:"machineDir"`
+	RecordedAt time.Time `json:"recordedAt"`
+	Entries    []Entry   `json:"entries"`
+	// Units are the managed systemd units of the machine, so drop-ins and
+	// unit file edits made outside the agent are noticed.
+	Units []Unit `json:"units,omitempty"`
+}
+
+// Mismatch is a recorded file whose current state differs from the manifest.
+type Mismatch struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+}
+
+// Build records every file under the paths, relative to root. A path may name
+// a directory, which is walked, or a single file. Paths that do not exist are
+// skipped: not every node installs every optional tool.
+func Build(machine, root string, paths []string) (*Manifest, error) {
+	m := &Manifest{Machine: machine, MachineDir: root, RecordedAt: time.Now().UTC()}
+	for _, path := range paths {
+		err := filepath.WalkDir(filepath.Join(root, path), func(full string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, full)
+			if err != nil {
+				return err
+			}
+			entry, err := hashEntry(full)
+			if err != nil {
+				return err
+			}
+			entry.Path = rel
+			m.Entries = append(m.Entries, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %w", path, err)
+		}
+	}
+	slices.SortFunc(m.Entries, func(a, b Entry) int { return strings.Compare(a.Path, b.Path) })
+	return m, nil
+}
+
+// Verify re-hashes the recorded files under m.MachineDir and returns the ones
+// that are missing or differ in type, mode, or content.
+func Verify(m *Manifest) []Mismatch {
+	var mismatches []Mismatch
+	for _, want := range m.Entries {
+		got, err := hashEntry(filepath.Join(m.MachineDir, want.Path))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			mismatches = append(mismatches, Mismatch{Path: want.Path, Problem: "missing"})
+		case err != nil:
+			mismatches = append(mismatches, Mismatch{Path: want.Path, Problem: err.Error()})
+		case got.Mode.Type() != want.Mode.Type():
+			mismatches = append(mismatches, Mismatch{Path: want.Path, Problem: fmt.Sprintf("type changed from %s to %s", want.Mode.Type(), got.Mode.Type())})
+		case got.Link != want.Link:
+			mismatches = append(mismatches, Mismatch{Path: want.Path, Problem: fmt.Sprintf("symlink target changed from %s to %s", want.Link, got.Link)})
+		case got.SHA256 != want.SHA256:
+			mismatches = append(mismatches, Mismatch{Path: want.Path, Problem: "content changed"})
+		case got.Mode.Perm() != want.Mode.Perm() || got.Mode&(fs.ModeSetuid|fs.ModeSetgid) != want.Mode&(fs.ModeSetuid|fs.ModeSetgid):
+			mismatches = append(mismatches, Mismatch{Path: want.Path, Problem: fmt.Sprintf("mode changed from %s to %s", want.Mode, got.Mode)})
+		}
+	}
+	return mismatches
+}
+
+func hashEntry(path string) (Entry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry := Entry{Mode: info.Mode()}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		entry.Link, err = os.Readlink(path)
+		return entry, err
+	case !info.Mode().IsRegular():
+		return entry, nil
+	}
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return Entry{}, err
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return Entry{}, fmt.Errorf("hash %s: %w", path, err)
+	}
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return entry, nil
+}
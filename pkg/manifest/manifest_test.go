@@ -0,0 +1,114 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, root string)
+		path    string
+		problem string
+	}{
+		{
+			name:   "unchanged",
+			tamper: func(*testing.T, string) {},
+		},
+		{
+			name: "missing",
+			tamper: func(t *testing.T, root string) {
+				if err := os.Remove(filepath.Join(root, "usr/local/bin/kubelet")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			path:    "usr/local/bin/kubelet",
+			problem: "missing",
+		},
+		{
+			name: "content changed",
+			tamper: func(t *testing.T, root string) {
+				if err := os.WriteFile(filepath.Join(root, "usr/local/bin/kubelet"), []byte("tampered"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			path:    "usr/local/bin/kubelet",
+			problem: "content changed",
+		},
+		{
+			name: "mode changed",
+			tamper: func(t *testing.T, root string) {
+				if err := os.Chmod(filepath.Join(root, "opt/cni/bin/bridge"), 0o777); err != nil {
+					t.Fatal(err)
+				}
+			},
+			path:    "opt/cni/bin/bridge",
+			problem: "mode changed from -rwxr-xr-x to -rwxrwxrwx",
+		},
+		{
+			name: "symlink retargeted",
+			tamper: func(t *testing.T, root string) {
+				link := filepath.Join(root, "usr/local/bin/ctr")
+				if err := os.Remove(link); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink("kubelet", link); err != nil {
+					t.Fatal(err)
+				}
+			},
+			path:    "usr/local/bin/ctr",
+			problem: "symlink target changed from containerd to kubelet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			writeFile(t, filepath.Join(root, "usr/local/bin/kubelet"), "kubelet")
+			writeFile(t, filepath.Join(root, "usr/local/bin/containerd"), "containerd")
+			writeFile(t, filepath.Join(root, "opt/cni/bin/bridge"), "bridge")
+			if err := os.Symlink("containerd", filepath.Join(root, "usr/local/bin/ctr")); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := Build("kube1", root, []string{"usr/local/bin", "opt/cni/bin", "usr/bin/node-problem-detector"})
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if len(m.Entries) != 4 {
+				t.Fatalf("entries = %+v, want 4", m.Entries)
+			}
+
+			tt.tamper(t, root)
+			mismatches := Verify(m)
+			if tt.path == "" {
+				if len(mismatches) != 0 {
+					t.Fatalf("mismatches = %+v, want none", mismatches)
+				}
+				return
+			}
+			if len(mismatches) != 1 || mismatches[0].Path != tt.path || mismatches[0].Problem != tt.problem {
+				t.Fatalf("mismatches = %+v, want %s: %s", mismatches, tt.path, tt.problem)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(body), 0o755); err != nil { //nolint:gosec // test binary
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runtimeUnitDir holds the drop-ins of systemctl set-property --runtime and
+// systemctl edit --runtime. It is a tmpfs inside the machine, so its files are
+// not in the machine directory and are not hashed.
+const runtimeUnitDir = "/run/"
+
+// Unit is the configuration systemd loaded a unit from: its unit file and
+// drop-ins, as absolute paths inside the machine, and the content hash of each
+// of them stored in the machine rootfs.
+type Unit struct {
+	Name         string            `json:"name"`
+	FragmentPath string            `json:"fragmentPath"`
+	DropInPaths  []string          `json:"dropInPaths,omitempty"`
+	SHA256       map[string]string `json:"sha256,omitempty"`
+}
+
+func (u Unit) paths() []string {
+	paths := slices.Clone(u.DropInPaths)
+	if u.FragmentPath != "" {
+		paths = append(paths, u.FragmentPath)
+	}
+	return paths
+}
+
+// HashUnits records the content hash of each unit file under root.
+func HashUnits(root string, units []Unit) error {
+	for i := range units {
+		units[i].SHA256 = map[string]string{}
+		for _, path := range units[i].paths() {
+			if strings.HasPrefix(path, runtimeUnitDir) {
+				continue
+			}
+			entry, err := hashEntry(filepath.Join(root, path))
+			if err != nil {
+				return fmt.Errorf("hash unit file %s of %s: %w", path, units[i].Name, err)
+			}
+			units[i].SHA256[path] = entry.SHA256
+		}
+	}
+	return nil
+}
+
+// VerifyUnits compares the unit files systemd loaded, observed, with the
+// recorded ones and returns the differences as mismatches of the files that
+// cause them: a unit file loaded from another path, a drop-in added outside
+// the managed tree, a recorded drop-in that is gone, or a recorded file whose
+// content changed.
+func VerifyUnits(root string, recorded, observed []Unit) []Mismatch {
+	var mismatches []Mismatch
+	for _, want := range recorded {
+		i := slices.IndexFunc(observed, func(u Unit) bool { return u.Name == want.Name })
+		if i < 0 || observed[i].FragmentPath == "" {
+			mismatches = append(mismatches, Mismatch{Path: relative(want.FragmentPath), Problem: fmt.Sprintf("%s is not loaded", want.Name)})
+			continue
+		}
+		got := observed[i]
+		if got.FragmentPath != want.FragmentPath {
+			mismatches = append(mismatches, Mismatch{
+				Path:    relative(got.FragmentPath),
+				Problem: fmt.Sprintf("%s is loaded from this unit file instead of %s", want.Name, want.FragmentPath),
+			})
+		}
+		for _, path := range got.DropInPaths {
+			if slices.Contains(want.DropInPaths, path) {
+				continue
+			}
+			problem := "unmanaged drop-in of " + want.Name
+			if strings.HasPrefix(path, runtimeUnitDir) {
+				problem = "runtime drop-in of " + want.Name
+			}
+			mismatches = append(mismatches, Mismatch{Path: relative(path), Problem: problem})
+		}
+		for _, path := range want.DropInPaths {
+			if !slices.Contains(got.DropInPaths, path) {
+				mismatches = append(mismatches, Mismatch{Path: relative(path), Problem: "drop-in of " + want.Name + " is not loaded"})
+			}
+		}
+		for _, path := range slices.Sorted(maps.Keys(want.SHA256)) {
+			if !slices.Contains(got.paths(), path) {
+				continue
+			}
+			entry, err := hashEntry(filepath.Join(root, path))
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				mismatches = append(mismatches, Mismatch{Path: relative(path), Problem: "missing"})
+			case err != nil:
+				mismatches = append(mismatches, Mismatch{Path: relative(path), Problem: err.Error()})
+			case entry.SHA256 != want.SHA256[path]:
+				mismatches = append(mismatches, Mismatch{Path: relative(path), Problem: "content of a unit file of " + want.Name + " changed"})
+			}
+		}
+	}
+	return mismatches
+}
+
+// relative returns path relative to the machine root, like the paths of
+// Entry.
+func relative(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// RefreshUnitHashes re-hashes the recorded unit files under root after the
+// agent rewrote them, keeping the recorded set of files. Files that are gone
+// keep their hash, so VerifyUnits still reports them.
+func RefreshUnitHashes(root string, units []Unit) {
+	for _, unit := range units {
+		for path := range unit.SHA256 {
+			if entry, err := hashEntry(filepath.Join(root, path)); err == nil {
+				unit.SHA256[path] = entry.SHA256
+			}
+		}
+	}
+}
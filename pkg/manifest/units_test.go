@@ -0,0 +1,108 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyUnits(t *testing.T) {
+	t.Parallel()
+
+	const (
+		fragment = "/etc/systemd/system/kubelet.service"
+		dropIn   = "/etc/systemd/system/kubelet.service.d/10-kubeconfig.conf"
+		override = "/etc/systemd/system/kubelet.service.d/override.conf"
+		runtime  = "/run/systemd/system.control/kubelet.service.d/50-CPUWeight.conf"
+		vendor   = "/usr/lib/systemd/system/kubelet.service"
+	)
+	loaded := Unit{Name: "kubelet.service", FragmentPath: fragment, DropInPaths: []string{dropIn}}
+	tests := []struct {
+		name     string
+		observed Unit
+		tamper   func(t *testing.T, root string)
+		path     string
+		problem  string
+	}{
+		{name: "unchanged", observed: loaded},
+		{
+			name:     "override drop-in",
+			observed: Unit{Name: "kubelet.service", FragmentPath: fragment, DropInPaths: []string{dropIn, override}},
+			path:     "etc/systemd/system/kubelet.service.d/override.conf",
+			problem:  "unmanaged drop-in of kubelet.service",
+		},
+		{
+			name:     "runtime drop-in",
+			observed: Unit{Name: "kubelet.service", FragmentPath: fragment, DropInPaths: []string{dropIn, runtime}},
+			path:     "run/systemd/system.control/kubelet.service.d/50-CPUWeight.conf",
+			problem:  "runtime drop-in of kubelet.service",
+		},
+		{
+			name:     "unit file moved",
+			observed: Unit{Name: "kubelet.service", FragmentPath: vendor, DropInPaths: []string{dropIn}},
+			path:     "usr/lib/systemd/system/kubelet.service",
+			problem:  "kubelet.service is loaded from this unit file instead of " + fragment,
+		},
+		{
+			name:     "drop-in removed",
+			observed: Unit{Name: "kubelet.service", FragmentPath: fragment},
+			path:     "etc/systemd/system/kubelet.service.d/10-kubeconfig.conf",
+			problem:  "drop-in of kubelet.service is not loaded",
+		},
+		{
+			name:     "not loaded",
+			observed: Unit{Name: "kubelet.service"},
+			path:     "etc/systemd/system/kubelet.service",
+			problem:  "kubelet.service is not loaded",
+		},
+		{
+			name:     "edited in place",
+			observed: loaded,
+			tamper: func(t *testing.T, root string) {
+				writeUnitFile(t, root, fragment, "[Service]\nExecStart=/bin/true\n")
+			},
+			path:    "etc/systemd/system/kubelet.service",
+			problem: "content of a unit file of kubelet.service changed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			writeUnitFile(t, root, fragment, "[Service]\nExecStart=/usr/local/bin/kubelet\n")
+			writeUnitFile(t, root, dropIn, "[Service]\nEnvironment=KUBECONFIG=/var/lib/kubelet/kubeconfig\n")
+			recorded := []Unit{loaded}
+			if err := HashUnits(root, recorded); err != nil {
+				t.Fatalf("HashUnits: %v", err)
+			}
+			if len(recorded[0].SHA256) != 2 {
+				t.Fatalf("hashes = %v, want the unit file and drop-in", recorded[0].SHA256)
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, root)
+			}
+
+			mismatches := VerifyUnits(root, recorded, []Unit{tt.observed})
+			if tt.path == "" {
+				if len(mismatches) != 0 {
+					t.Fatalf("VerifyUnits() = %+v, want none", mismatches)
+				}
+				return
+			}
+			if len(mismatches) != 1 || mismatches[0].Path != tt.path || mismatches[0].Problem != tt.problem {
+				t.Fatalf("VerifyUnits() = %+v, want %s: %s", mismatches, tt.path, tt.problem)
+			}
+		})
+	}
+}
+
+func writeUnitFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
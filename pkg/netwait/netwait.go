@@ -0,0 +1,186 @@
+// Package netwait holds bootstrap until the network it needs is up.
+//
+// Sites behind captive portals, cellular links, or slow WAN routers often
+// boot before DNS and the Azure endpoints are reachable. Starting Azure
+// dependent steps then fails with errors that look like misconfiguration.
+// Wait instead polls DNS resolution and TCP reachability of the control plane
+// endpoints and reports progress until they all answer.
+package netwait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/egress"
+)
+
+// ErrUnavailable is returned when the network is still unavailable at the
+// timeout.
+var ErrUnavailable = errors.New("network unavailable")
+
+const (
+	// pollInterval is the time between two rounds of checks.
+	pollInterval = 10 * time.Second
+	// checkTimeout bounds each DNS lookup and connection attempt.
+	checkTimeout = 5 * time.Second
+)
+
+// Target is one host:port that must accept connections. Proxy, if set, is the
+// host:port of the proxy connections to the target go through; only the proxy
+// is then checked, since the node does not resolve the target itself.
+type Target struct {
+	Address string
+	Proxy   string
+}
+
+// Waiter checks targets until they are all reachable.
+type Waiter struct {
+	log     *slog.Logger
+	targets []Target
+
+	// resolve and dial are overridden in tests.
+	resolve func(ctx context.Context, host string) error
+	dial    func(ctx context.Context, address string) error
+	// interval is the time between two rounds of checks.
+	interval time.Duration
+}
+
+// New returns a Waiter for the control plane endpoints of cfg and
+// bootstrap.networkWait.endpoints.
+func New(log *slog.Logger, cfg *config.Config) *Waiter {
+	return &Waiter{
+		log:      log,
+		targets:  Targets(cfg),
+		resolve:  resolveHost,
+		dial:     dialAddress,
+		interval: pollInterval,
+	}
+}
+
+// Targets returns what a Waiter for cfg checks.
+func Targets(cfg *config.Config) []Target {
+	var targets []Target
+	for _, endpoint := range egress.ControlPlane(cfg) {
+		address := net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port))
+		targets = append(targets, Target{Address: address, Proxy: proxyFor(endpoint.Protocol, address)})
+	}
+	for _, address := range cfg.Bootstrap.NetworkWait.Endpoints {
+		targets = append(targets, Target{Address: address})
+	}
+	return targets
+}
+
+// proxyFor returns the proxy host:port HTTPS_PROXY, HTTP_PROXY, and NO_PROXY
+// select for a URL of scheme on address, or "" for a direct connection.
+func proxyFor(scheme, address string) string {
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: scheme, Host: address}})
+	if err != nil || proxy == nil {
+		return ""
+	}
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	port := "80"
+	if proxy.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// Wait blocks until every target is reachable, logging what is still missing
+// after each round. A timeout of zero waits until ctx is done. It returns an
+// error wrapping ErrUnavailable, with the last failures, at the timeout.
+func (w *Waiter) Wait(ctx context.Context, timeout time.Duration) error {
+	if len(w.targets) == 0 {
+		return nil
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		failures := w.check(ctx)
+		if len(failures) == 0 {
+			if attempt > 1 {
+				w.log.Info("network is available", "waited", time.Since(start).Round(time.Second))
+			}
+			return nil
+		}
+		w.log.Info("waiting for the network",
+			"attempt", attempt,
+			"waited", time.Since(start).Round(time.Second),
+			"unreachable", len(failures),
+			"firstError", failures[0],
+		)
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w after %s: %s", ErrUnavailable, timeout, strings.Join(failures, "; "))
+			}
+			return ctx.Err()
+		case <-time.After(w.interval):
+		}
+	}
+}
+
+// check runs one round and returns a description of each failing target.
+func (w *Waiter) check(ctx context.Context) []string {
+	var failures []string
+	for _, target := range w.targets {
+		if err := w.checkTarget(ctx, target); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	return failures
+}
+
+func (w *Waiter) checkTarget(ctx context.Context, target Target) error {
+	address := target.Address
+	if target.Proxy != "" {
+		address = target.Proxy
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%s: %w", address, err)
+	}
+	if net.ParseIP(host) == nil {
+		if err := w.resolve(ctx, host); err != nil {
+			return fmt.Errorf("resolve %s: %w", host, err)
+		}
+	}
+	if err := w.dial(ctx, address); err != nil {
+		if target.Proxy != "" {
+			return fmt.Errorf("connect to proxy %s for %s: %w", target.Proxy, target.Address, err)
+		}
+		return fmt.Errorf("connect to %s: %w", address, err)
+	}
+	return nil
+}
+
+func resolveHost(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	_, err := net.DefaultResolver.LookupHost(ctx, host)
+	return err
+}
+
+func dialAddress(ctx context.Context, address string) error {
+	dialer := net.Dialer{Timeout: checkTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,112 @@
+package netwait
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func testWaiter(targets []Target, resolve, dial func(context.Context, string) error) *Waiter {
+	return &Waiter{
+		log:      slog.New(slog.DiscardHandler),
+		targets:  targets,
+		resolve:  resolve,
+		dial:     dial,
+		interval: time.Millisecond,
+	}
+}
+
+func TestWaitUntilReachable(t *testing.T) {
+	t.Parallel()
+
+	var rounds atomic.Int32
+	resolve := func(_ context.Context, host string) error {
+		if host == "management.azure.com" && rounds.Add(1) < 3 {
+			return errors.New("no such host")
+		}
+		return nil
+	}
+	var dialed []string
+	dial := func(_ context.Context, address string) error {
+		dialed = append(dialed, address)
+		return nil
+	}
+	w := testWaiter([]Target{
+		{Address: "management.azure.com:443"},
+		{Address: "10.0.0.1:6443"},
+	}, resolve, dial)
+
+	if err := w.Wait(t.Context(), time.Minute); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if rounds.Load() != 3 {
+		t.Errorf("resolved %d times, want 3", rounds.Load())
+	}
+	if last := dialed[len(dialed)-1]; last != "10.0.0.1:6443" {
+		t.Errorf("last dial = %q", last)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	t.Parallel()
+
+	ok := func(context.Context, string) error { return nil }
+	refused := func(context.Context, string) error { return errors.New("connection refused") }
+	w := testWaiter([]Target{{Address: "example.hcp.eastus.azmk8s.io:443", Proxy: "proxy.contoso.com:3128"}}, ok, refused)
+
+	err := w.Wait(t.Context(), 20*time.Millisecond)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Wait() error = %v, want ErrUnavailable", err)
+	}
+	if !strings.Contains(err.Error(), "proxy proxy.contoso.com:3128") {
+		t.Errorf("Wait() error = %v, want the proxy named", err)
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	failing := func(context.Context, string) error { return errors.New("unreachable") }
+	w := testWaiter([]Target{{Address: "a:443"}}, failing, failing)
+	if err := w.Wait(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestTargets(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy.contoso.com:3128")
+	t.Setenv("NO_PROXY", "azmk8s.io")
+
+	cfg := &config.Config{
+		Azure: config.AzureConfig{
+			ResourceManagerEndpointURL: config.DefaultResourceManagerEndpointURL,
+			ServicePrincipal:           &config.ServicePrincipalConfig{TenantID: "t", ClientID: "c", ClientSecret: "s"},
+		},
+		Node:      config.NodeConfig{Kubelet: config.KubeletConfig{ClusterFQDN: "example.hcp.eastus.azmk8s.io"}},
+		Bootstrap: config.BootstrapConfig{NetworkWait: config.NetworkWaitConfig{Endpoints: []string{"mirror.contoso.com:8443"}}},
+	}
+	want := map[string]string{
+		"management.azure.com:443":         "proxy.contoso.com:3128",
+		"login.microsoftonline.com:443":    "proxy.contoso.com:3128",
+		"example.hcp.eastus.azmk8s.io:443": "",
+		"mirror.contoso.com:8443":          "",
+	}
+	targets := Targets(cfg)
+	if len(targets) != len(want) {
+		t.Fatalf("Targets() = %+v, want %d targets", targets, len(want))
+	}
+	for _, target := range targets {
+		proxy, ok := want[target.Address]
+		if !ok || target.Proxy != proxy {
+			t.Errorf("target %+v, want proxy %q", target, proxy)
+		}
+	}
+}
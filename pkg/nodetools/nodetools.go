@@ -0,0 +1,252 @@
+// Package nodetools installs the optional node debugging toolkit into the
+// nspawn machine rootfs: nerdctl and jq next to the crictl and ctr the node
+// already ships, with crictl and nerdctl pre-wired to the node's containerd.
+package nodetools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	utilexec "k8s.io/utils/exec"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/artifactsource"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	DefaultNerdctlVersion = "v2.1.3"
+	DefaultJQVersion      = "1.8.1"
+
+	nerdctlURLTemplate = "https://github.com/containerd/nerdctl/releases/download/%s/nerdctl-%s-linux-%s.tar.gz"
+	jqURLTemplate      = "https://github.com/jqlang/jq/releases/download/jq-%s/jq-linux-%s"
+
+	// Paths as they appear inside the container.
+	nerdctlBinaryPath = "/usr/local/bin/nerdctl"
+	jqBinaryPath      = "/usr/local/bin/jq"
+	crictlConfigPath  = "/etc/crictl.yaml"
+	nerdctlConfigPath = "/etc/nerdctl/nerdctl.toml"
+
+	containerdEndpoint = "unix:///run/containerd/containerd.sock"
+
+	artifactCheckName = "node-tools-artifacts"
+	artifactTarget    = "node debugging tools artifacts"
+)
+
+// crictlConfig points crictl at the node's containerd, so it works without
+// --runtime-endpoint and does not probe the deprecated dockershim socket.
+const crictlConfig = `runtime-endpoint: ` + containerdEndpoint + `
+image-endpoint: ` + containerdEndpoint + `
+timeout: 10
+`
+
+// nerdctlConfig makes nerdctl show the containers and images the kubelet
+// manages instead of the empty default namespace.
+const nerdctlConfig = `address = "` + containerdEndpoint + `"
+namespace = "k8s.io"
+`
+
+// skippedTask stands in for the download when node tools are not installed.
+type skippedTask struct{}
+
+func (skippedTask) Name() string             { return "download-node-tools" }
+func (skippedTask) Do(context.Context) error { return nil }
+
+type downloadTask struct {
+	log            *slog.Logger
+	cfg            *config.Config
+	nerdctlVersion string
+	jqVersion      string
+	machineDir     string
+}
+
+// Download returns a task that installs the node tools into the nspawn
+// machine rootfs at machineDir. It does nothing unless nodeTools.enabled is
+// set, and in offline mode, where the release downloads are unreachable.
+func Download(log *slog.Logger, cfg *config.Config, machineDir string) phases.Task {
+	if !enabled(cfg) {
+		return skippedTask{}
+	}
+	return &downloadTask{
+		log:            log,
+		cfg:            cfg,
+		nerdctlVersion: nerdctlVersion(cfg),
+		jqVersion:      jqVersion(cfg),
+		machineDir:     machineDir,
+	}
+}
+
+func (t *downloadTask) Name() string { return "download-node-tools" }
+
+// Plan returns the crictl and nerdctl configs inside the machine.
+func (t *downloadTask) Plan() []string {
+	return []string{
+		filepath.Join(t.machineDir, crictlConfigPath),
+		filepath.Join(t.machineDir, nerdctlConfigPath),
+	}
+}
+
+func (t *downloadTask) Do(ctx context.Context) error {
+	if err := t.installConfig(ctx, crictlConfigPath, crictlConfig); err != nil {
+		return err
+	}
+	if err := t.installConfig(ctx, nerdctlConfigPath, nerdctlConfig); err != nil {
+		return err
+	}
+
+	counter := progress.FromContext(ctx)
+	if err := t.installNerdctl(ctx, counter); err != nil {
+		return err
+	}
+	return t.installJQ(ctx, counter)
+}
+
+func (t *downloadTask) installConfig(ctx context.Context, path, content string) error {
+	hostPath := filepath.Join(t.machineDir, path)
+	before := audit.HashFile(hostPath)
+	if err := utilio.WriteFile(hostPath, []byte(content), 0o644); err != nil { //nolint:gosec // config must be readable
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	t.recordExtract(ctx, hostPath, before, "node tools config")
+	return nil
+}
+
+func (t *downloadTask) installNerdctl(ctx context.Context, counter *progress.Counter) error {
+	hostPath := filepath.Join(t.machineDir, nerdctlBinaryPath)
+	if versionMatch(hostPath, strings.TrimPrefix(t.nerdctlVersion, "v")) {
+		return nil
+	}
+	source, err := artifactsource.Parse(nerdctlURL(t.nerdctlVersion))
+	if err != nil {
+		return fmt.Errorf("construct nerdctl download source: %w", err)
+	}
+	body, err := source.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("open nerdctl artifact: %w", err)
+	}
+	defer body.Close() //nolint:errcheck // body close
+
+	for tarFile, err := range utilio.DecompressTarGzWithPolicy(counter.Reader(body), t.cfg.Bootstrap.Extraction.Policy()) {
+		if err != nil {
+			return fmt.Errorf("decompress nerdctl tar: %w", err)
+		}
+		if tarFile.Name != "nerdctl" {
+			continue
+		}
+		before := audit.HashFile(hostPath)
+		if err := utilio.InstallFile(hostPath, tarFile.Body, 0o755); err != nil { //nolint:gosec // binary must be executable
+			return fmt.Errorf("install nerdctl binary: %w", err)
+		}
+		t.recordExtract(ctx, hostPath, before, "nerdctl "+t.nerdctlVersion)
+		counter.AddFile()
+		return nil
+	}
+	return fmt.Errorf("nerdctl %s archive has no nerdctl binary", t.nerdctlVersion)
+}
+
+func (t *downloadTask) installJQ(ctx context.Context, counter *progress.Counter) error {
+	hostPath := filepath.Join(t.machineDir, jqBinaryPath)
+	if versionMatch(hostPath, t.jqVersion) {
+		return nil
+	}
+	source, err := artifactsource.Parse(jqURL(t.jqVersion))
+	if err != nil {
+		return fmt.Errorf("construct jq download source: %w", err)
+	}
+	body, err := source.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("open jq artifact: %w", err)
+	}
+	defer body.Close() //nolint:errcheck // body close
+
+	before := audit.HashFile(hostPath)
+	if err := utilio.InstallFile(hostPath, counter.Reader(body), 0o755); err != nil { //nolint:gosec // binary must be executable
+		return fmt.Errorf("install jq binary: %w", err)
+	}
+	t.recordExtract(ctx, hostPath, before, "jq "+t.jqVersion)
+	counter.AddFile()
+	return nil
+}
+
+func (t *downloadTask) recordExtract(ctx context.Context, path, before, detail string) {
+	audit.Record(ctx, t.log, audit.Event{
+		Operation:  audit.OperationPackageExtract,
+		Target:     path,
+		BeforeHash: before,
+		AfterHash:  audit.HashFile(path),
+		Detail:     detail,
+	})
+}
+
+// Preflight returns reachability checks for the node tools downloads when
+// they are enabled.
+func Preflight(cfg *config.Config) []preflight.Checker {
+	if !enabled(cfg) {
+		return nil
+	}
+	return []preflight.Checker{
+		artifactsource.ReachabilityChecker{
+			CheckName:  artifactCheckName,
+			Target:     artifactTarget,
+			OKMessage:  "node debugging tools artifacts are reachable",
+			ErrMessage: "node debugging tools artifact is not reachable",
+			Sources: func() (artifactsource.Sources, error) {
+				nerdctl, err := artifactsource.Parse(nerdctlURL(nerdctlVersion(cfg)))
+				if err != nil {
+					return nil, err
+				}
+				jq, err := artifactsource.Parse(jqURL(jqVersion(cfg)))
+				if err != nil {
+					return nil, err
+				}
+				return artifactsource.Sources{"nerdctl": nerdctl, "jq": jq}, nil
+			},
+		},
+	}
+}
+
+func enabled(cfg *config.Config) bool {
+	return cfg != nil && cfg.NodeTools.Enabled && strings.TrimSpace(cfg.Bootstrap.OfflineArtifacts.Source) == ""
+}
+
+func nerdctlVersion(cfg *config.Config) string {
+	if cfg.NodeTools.NerdctlVersion != "" {
+		return cfg.NodeTools.NerdctlVersion
+	}
+	return DefaultNerdctlVersion
+}
+
+func jqVersion(cfg *config.Config) string {
+	if cfg.NodeTools.JQVersion != "" {
+		return cfg.NodeTools.JQVersion
+	}
+	return DefaultJQVersion
+}
+
+func nerdctlURL(version string) string {
+	version = "v" + strings.TrimPrefix(version, "v")
+	return fmt.Sprintf(nerdctlURLTemplate, version, strings.TrimPrefix(version, "v"), utilhost.GetArch())
+}
+
+func jqURL(version string) string {
+	return fmt.Sprintf(jqURLTemplate, strings.TrimPrefix(version, "jq-"), utilhost.GetArch())
+}
+
+func versionMatch(hostBinaryPath, expectedVersion string) bool {
+	if !utilio.IsExecutable(hostBinaryPath) {
+		return false
+	}
+	output, err := utilexec.New().Command(hostBinaryPath, "--version").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(output), expectedVersion)
+}
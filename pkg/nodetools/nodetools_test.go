@@ -0,0 +1,87 @@
+package nodetools
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func TestDownloadURLs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		got, want string
+	}{
+		{nerdctlURL("v2.1.3"), "https://github.com/containerd/nerdctl/releases/download/v2.1.3/nerdctl-2.1.3-linux-" + runtime.GOARCH + ".tar.gz"},
+		{nerdctlURL("2.1.3"), "https://github.com/containerd/nerdctl/releases/download/v2.1.3/nerdctl-2.1.3-linux-" + runtime.GOARCH + ".tar.gz"},
+		{jqURL("1.8.1"), "https://github.com/jqlang/jq/releases/download/jq-1.8.1/jq-linux-" + runtime.GOARCH},
+		{jqURL("jq-1.8.1"), "https://github.com/jqlang/jq/releases/download/jq-1.8.1/jq-linux-" + runtime.GOARCH},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("URL = %s, want %s", tt.got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSkippedUnlessEnabled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want bool
+	}{
+		{name: "default", cfg: &config.Config{}},
+		{name: "enabled", cfg: &config.Config{NodeTools: config.NodeToolsConfig{Enabled: true}}, want: true},
+		{
+			name: "offline",
+			cfg: &config.Config{
+				NodeTools: config.NodeToolsConfig{Enabled: true},
+				Bootstrap: config.BootstrapConfig{OfflineArtifacts: config.OfflineArtifactsConfig{Source: "/opt/artifacts"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, skipped := Download(slog.New(slog.DiscardHandler), tt.cfg, t.TempDir()).(skippedTask)
+		if skipped == tt.want {
+			t.Errorf("%s: Download() skipped = %v, want %v", tt.name, skipped, !tt.want)
+		}
+		if got := len(Preflight(tt.cfg)) > 0; got != tt.want {
+			t.Errorf("%s: Preflight() has checks = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstallConfig(t *testing.T) {
+	t.Parallel()
+
+	machineDir := t.TempDir()
+	task := &downloadTask{log: slog.New(slog.DiscardHandler), cfg: &config.Config{}, machineDir: machineDir}
+	if err := task.installConfig(t.Context(), crictlConfigPath, crictlConfig); err != nil {
+		t.Fatalf("installConfig(crictl) error = %v", err)
+	}
+	if err := task.installConfig(t.Context(), nerdctlConfigPath, nerdctlConfig); err != nil {
+		t.Fatalf("installConfig(nerdctl) error = %v", err)
+	}
+
+	crictl, err := os.ReadFile(filepath.Join(machineDir, crictlConfigPath))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(crictl), "runtime-endpoint: unix:///run/containerd/containerd.sock") {
+		t.Fatalf("crictl.yaml =\n%s\nwant the containerd runtime endpoint", crictl)
+	}
+	nerdctl, err := os.ReadFile(filepath.Join(machineDir, nerdctlConfigPath))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(nerdctl), `namespace = "k8s.io"`) {
+		t.Fatalf("nerdctl.toml =\n%s\nwant the k8s.io namespace", nerdctl)
+	}
+}
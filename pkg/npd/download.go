@@ -2,6 +2,7 @@ package npd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -9,7 +10,9 @@ import (
 
 	utilexec "k8s.io/utils/exec"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/progress"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
 	"github.com/Azure/unbounded/pkg/agent/artifactsource"
@@ -20,7 +23,8 @@ import (
 const (
 	DefaultVersion = "v1.35.1"
 
-	defaultNPDURLTemplate = "https://github.com/kubernetes/node-problem-detector/releases/download/%s/node-problem-detector-%s-linux_%s.tar.gz"
+	npdReleaseBaseURL = "https://github.com/kubernetes/node-problem-detector/releases/download"
+	npdURLTemplate    = "%s/%s/node-problem-detector-%s-linux_%s.tar.gz"
 
 	// Paths as they appear inside the container.
 	npdBinaryPath = "/usr/bin/node-problem-detector"
@@ -53,6 +57,7 @@ func (disabledPreflightCheck) Check(context.Context) []preflight.Result {
 }
 
 type downloadTask struct {
+	log        *slog.Logger
 	cfg        *config.Config
 	version    string
 	machineDir string
@@ -70,11 +75,20 @@ func Download(log *slog.Logger, cfg *config.Config, machineDir string) phases.Ta
 	if version == "" {
 		version = DefaultVersion
 	}
-	return &downloadTask{cfg: cfg, version: version, machineDir: machineDir}
+	return &downloadTask{log: log, cfg: cfg, version: version, machineDir: machineDir}
 }
 
 func (t *downloadTask) Name() string { return "download-npd" }
 
+// Plan returns the kernel monitor config, which comes with the release
+// unless the installed binary already has the configured version.
+func (t *downloadTask) Plan() []string {
+	if versionMatch(filepath.Join(t.machineDir, npdBinaryPath), t.version) {
+		return nil
+	}
+	return []string{filepath.Join(t.machineDir, npdConfigPath)}
+}
+
 func (t *downloadTask) Do(ctx context.Context) error {
 	hostBinaryPath := filepath.Join(t.machineDir, npdBinaryPath)
 	hostConfigPath := filepath.Join(t.machineDir, npdConfigPath)
@@ -83,25 +97,62 @@ func (t *downloadTask) Do(ctx context.Context) error {
 		return nil // already installed at correct version
 	}
 
-	downloadSource, err := constructDownloadSource(t.cfg, t.version)
+	sources, err := constructDownloadSources(t.cfg, t.version)
 	if err != nil {
-		return fmt.Errorf("construct npd download source: %w", err)
+		return fmt.Errorf("construct npd download sources: %w", err)
 	}
 
-	for tarFile, err := range downloadSource.DecompressTarGz(ctx) {
+	var errs []error
+	for _, source := range health.order(sources) {
+		err := t.install(ctx, source.Source, hostBinaryPath, hostConfigPath)
+		if ctx.Err() != nil {
+			return err
+		}
+		health.record(source, err)
+		if err == nil {
+			return nil
+		}
+		t.log.Warn("npd download failed, trying the next source", "source", source.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", source.Name, err))
+	}
+	return errors.Join(errs...)
+}
+
+// install downloads the release tarball from source and installs the binary
+// and config from it. Files are replaced atomically, so a failed attempt can
+// be retried from another source.
+func (t *downloadTask) install(ctx context.Context, source artifactsource.Source, hostBinaryPath, hostConfigPath string) error {
+	// The release tarball is tens of megabytes, so report download and
+	// extraction progress for slow links.
+	counter := progress.FromContext(ctx)
+	counter.Restart()
+	counter.SetTotal(artifactSize(ctx, source))
+	body, err := source.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("open npd artifact: %w", err)
+	}
+	defer body.Close() //nolint:errcheck // body close
+
+	for tarFile, err := range utilio.DecompressTarGzWithPolicy(counter.Reader(body), t.cfg.Bootstrap.Extraction.Policy()) {
 		if err != nil {
 			return fmt.Errorf("decompress npd tar: %w", err)
 		}
 
 		switch tarFile.Name {
 		case "bin/node-problem-detector":
+			before := audit.HashFile(hostBinaryPath)
 			if err := utilio.InstallFile(hostBinaryPath, tarFile.Body, 0o755); err != nil { //nolint:gosec // binary must be executable
 				return fmt.Errorf("install npd binary: %w", err)
 			}
+			t.recordExtract(ctx, hostBinaryPath, before)
+			counter.AddFile()
 		case "config/kernel-monitor.json":
+			before := audit.HashFile(hostConfigPath)
 			if err := utilio.InstallFile(hostConfigPath, tarFile.Body, 0o644); err != nil { //nolint:gosec // config must be readable
 				return fmt.Errorf("install npd config: %w", err)
 			}
+			t.recordExtract(ctx, hostConfigPath, before)
+			counter.AddFile()
 		default:
 			continue
 		}
@@ -110,13 +161,33 @@ func (t *downloadTask) Do(ctx context.Context) error {
 	return nil
 }
 
-func constructDownloadURL(version string) string {
+func (t *downloadTask) recordExtract(ctx context.Context, path, before string) {
+	audit.Record(ctx, t.log, audit.Event{
+		Operation:  audit.OperationPackageExtract,
+		Target:     path,
+		BeforeHash: before,
+		AfterHash:  audit.HashFile(path),
+		Detail:     "node-problem-detector " + t.version,
+	})
+}
+
+func constructDownloadURL(baseURL, version string) string {
 	arch := utilhost.GetArch()
-	return fmt.Sprintf(defaultNPDURLTemplate, version, version, arch)
+	return fmt.Sprintf(npdURLTemplate, baseURL, version, version, arch)
 }
 
-func constructDownloadSource(_ *config.Config, version string) (artifactsource.Source, error) {
-	return artifactsource.Parse(constructDownloadURL(version))
+// artifactSize returns the download size of an HTTP source for progress
+// reporting, or -1 when it is unknown.
+func artifactSize(ctx context.Context, source artifactsource.Source) int64 {
+	url := source.String()
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return -1
+	}
+	size, err := utilio.RemoteContentLength(ctx, url)
+	if err != nil {
+		return -1
+	}
+	return size
 }
 
 // disabledForOfflineArtifacts skips NPD when offline bootstrap artifacts are
@@ -132,27 +203,7 @@ func Preflight(cfg *config.Config) []preflight.Checker {
 		return []preflight.Checker{disabledPreflightCheck{}}
 	}
 
-	return []preflight.Checker{
-		artifactsource.ReachabilityChecker{
-			CheckName:  npdArtifactCheckName,
-			Target:     npdArtifactTarget,
-			OKMessage:  "node-problem-detector artifact is reachable",
-			ErrMessage: "node-problem-detector artifact is not reachable",
-			Sources: func() (artifactsource.Sources, error) {
-				version := DefaultVersion
-				if cfg != nil && cfg.Npd.Version != "" {
-					version = cfg.Npd.Version
-				}
-
-				source, err := constructDownloadSource(cfg, version)
-				if err != nil {
-					return nil, err
-				}
-
-				return artifactsource.Sources{"node-problem-detector": source}, nil
-			},
-		},
-	}
+	return []preflight.Checker{mirrorReachabilityChecker{cfg: cfg}}
 }
 
 func versionMatch(hostBinaryPath, expectedVersion string) bool {
@@ -11,16 +11,29 @@ import (
 	"github.com/Azure/unbounded/pkg/agent/preflight"
 )
 
-func TestConstructDownloadSource(t *testing.T) {
+func TestConstructDownloadSources(t *testing.T) {
 	t.Parallel()
 
-	got, err := constructDownloadSource(&config.Config{}, "v1.35.1")
+	cfg := &config.Config{Npd: config.NPDConfig{Mirrors: []string{"https://mirror.example.com/npd/"}}}
+	got, err := constructDownloadSources(cfg, "v1.35.1")
 	if err != nil {
-		t.Fatalf("constructDownloadSource() error = %v", err)
+		t.Fatalf("constructDownloadSources() error = %v", err)
 	}
-	want := "https://github.com/kubernetes/node-problem-detector/releases/download/v1.35.1/node-problem-detector-v1.35.1-linux_" + runtime.GOARCH + ".tar.gz"
-	if got.String() != want {
-		t.Fatalf("source = %q, want %q", got.String(), want)
+	suffix := "/v1.35.1/node-problem-detector-v1.35.1-linux_" + runtime.GOARCH + ".tar.gz"
+	want := []string{
+		"https://mirror.example.com/npd" + suffix,
+		"https://github.com/kubernetes/node-problem-detector/releases/download" + suffix,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sources = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Source.String() != want[i] {
+			t.Fatalf("source %d = %q, want %q", i, got[i].Source.String(), want[i])
+		}
+	}
+	if got[0].Name != "node-problem-detector-mirror-1" || got[1].Name != "node-problem-detector" {
+		t.Fatalf("source names = %q, %q", got[0].Name, got[1].Name)
 	}
 }
 
@@ -0,0 +1,147 @@
+package npd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/artifactsource"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+// mirrorRetryAfter is how long a source that failed a download is tried only
+// after the sources that did not.
+const mirrorRetryAfter = 10 * time.Minute
+
+// downloadSource is one place the NPD release tarball can be fetched from.
+// Name is a redacted label safe for logs and preflight output; mirror URLs may
+// carry credentials.
+type downloadSource struct {
+	Name   string
+	Source artifactsource.Source
+}
+
+// constructDownloadSources returns the configured mirrors in order, followed
+// by the upstream GitHub release.
+func constructDownloadSources(cfg *config.Config, version string) ([]downloadSource, error) {
+	var mirrors []string
+	if cfg != nil {
+		mirrors = cfg.Npd.Mirrors
+	}
+	sources := make([]downloadSource, 0, len(mirrors)+1)
+	for i, mirror := range mirrors {
+		source, err := artifactsource.Parse(constructDownloadURL(strings.TrimSuffix(mirror, "/"), version))
+		if err != nil {
+			return nil, fmt.Errorf("parse npd mirror %d: %w", i+1, err)
+		}
+		sources = append(sources, downloadSource{Name: fmt.Sprintf("node-problem-detector-mirror-%d", i+1), Source: source})
+	}
+	source, err := artifactsource.Parse(constructDownloadURL(npdReleaseBaseURL, version))
+	if err != nil {
+		return nil, err
+	}
+	return append(sources, downloadSource{Name: "node-problem-detector", Source: source}), nil
+}
+
+// ArtifactSources returns the sources the NPD release tarball may be
+// downloaded from, keyed by their redacted names. It returns nil when NPD is
+// disabled in offline mode.
+func ArtifactSources(cfg *config.Config) (artifactsource.Sources, error) {
+	if disabledForOfflineArtifacts(cfg) {
+		return nil, nil
+	}
+	version := DefaultVersion
+	if cfg != nil && cfg.Npd.Version != "" {
+		version = cfg.Npd.Version
+	}
+	sources, err := constructDownloadSources(cfg, version)
+	if err != nil {
+		return nil, err
+	}
+	out := make(artifactsource.Sources, len(sources))
+	for _, source := range sources {
+		out[source.Name] = source.Source
+	}
+	return out, nil
+}
+
+// sourceHealth remembers which download sources failed recently, so the
+// long-running daemon does not wait on a dead mirror again on every repave.
+type sourceHealth struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	failedAt map[string]time.Time
+}
+
+var health = &sourceHealth{now: time.Now, failedAt: map[string]time.Time{}}
+
+// order returns sources with the ones that failed within mirrorRetryAfter
+// moved to the end, keeping the configured order otherwise.
+func (h *sourceHealth) order(sources []downloadSource) []downloadSource {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	recentlyFailed := func(s downloadSource) bool {
+		failedAt, ok := h.failedAt[s.Source.String()]
+		return ok && now.Sub(failedAt) < mirrorRetryAfter
+	}
+	ordered := slices.Clone(sources)
+	slices.SortStableFunc(ordered, func(a, b downloadSource) int {
+		switch af, bf := recentlyFailed(a), recentlyFailed(b); {
+		case af == bf:
+			return 0
+		case af:
+			return 1
+		default:
+			return -1
+		}
+	})
+	return ordered
+}
+
+func (h *sourceHealth) record(source downloadSource, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failedAt[source.Source.String()] = h.now()
+		return
+	}
+	delete(h.failedAt, source.Source.String())
+}
+
+// mirrorReachabilityChecker passes when any download source is reachable:
+// an unreachable mirror is a warning because the download fails over, and
+// only no reachable source at all is an error.
+type mirrorReachabilityChecker struct {
+	cfg *config.Config
+}
+
+func (mirrorReachabilityChecker) Name() string { return npdArtifactCheckName }
+
+func (c mirrorReachabilityChecker) Check(ctx context.Context) []preflight.Result {
+	version := DefaultVersion
+	if c.cfg != nil && c.cfg.Npd.Version != "" {
+		version = c.cfg.Npd.Version
+	}
+	sources, err := constructDownloadSources(c.cfg, version)
+	if err != nil {
+		return preflight.ResultsError(npdArtifactCheckName, npdArtifactTarget, "artifact sources could not be resolved")
+	}
+
+	var unreachable []preflight.Result
+	for _, source := range sources {
+		if err := source.Source.Probe(ctx); err != nil {
+			unreachable = append(unreachable, preflight.Warning(npdArtifactCheckName, npdArtifactTarget,
+				"node-problem-detector artifact is not reachable: %s", source.Name))
+		}
+	}
+	if len(unreachable) == len(sources) {
+		return preflight.ResultsError(npdArtifactCheckName, npdArtifactTarget, "node-problem-detector artifact is not reachable from any source")
+	}
+	return append(unreachable, preflight.OK(npdArtifactCheckName, npdArtifactTarget, "node-problem-detector artifact is reachable"))
+}
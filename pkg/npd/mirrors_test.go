@@ -0,0 +1,141 @@
+package npd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/unbounded/pkg/agent/artifactsource"
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+func npdTarball(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, body := range map[string]string{
+		"bin/node-problem-detector":  "#!/bin/sh\n",
+		"config/kernel-monitor.json": "{}\n",
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(body))}); err != nil {
+			t.Fatalf("WriteHeader: %v", err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadFailsOverToNextMirror(t *testing.T) {
+	t.Parallel()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+	tarball := npdTarball(t)
+	var served int
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			served++
+		}
+		_, _ = w.Write(tarball)
+	}))
+	t.Cleanup(up.Close)
+
+	cfg := &config.Config{Npd: config.NPDConfig{Version: "v1.2.3", Mirrors: []string{down.URL, up.URL}}}
+	machineDir := t.TempDir()
+	if err := Download(slog.New(slog.DiscardHandler), cfg, machineDir).Do(t.Context()); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if served != 1 {
+		t.Fatalf("second mirror served %d downloads, want 1", served)
+	}
+	for _, path := range []string{npdBinaryPath, npdConfigPath} {
+		if _, err := os.Stat(filepath.Join(machineDir, path)); err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+	}
+
+	// The mirror that just failed is tried last on the next download.
+	sources, err := constructDownloadSources(cfg, "v1.2.3")
+	if err != nil {
+		t.Fatalf("constructDownloadSources() error = %v", err)
+	}
+	ordered := health.order(sources)
+	if !strings.HasPrefix(ordered[len(ordered)-1].Source.String(), down.URL) {
+		t.Fatalf("last source = %s, want the failed mirror %s", ordered[len(ordered)-1].Source.String(), down.URL)
+	}
+}
+
+func TestSourceHealthOrder(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &sourceHealth{now: func() time.Time { return now }, failedAt: map[string]time.Time{}}
+	var sources []downloadSource
+	for _, name := range []string{"a", "b", "c"} {
+		source, err := artifactsource.Parse("https://" + name + ".example.com/npd.tar.gz")
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		sources = append(sources, downloadSource{Name: name, Source: source})
+	}
+	names := func(sources []downloadSource) string {
+		var out []string
+		for _, s := range sources {
+			out = append(out, s.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	h.record(sources[0], context.DeadlineExceeded)
+	h.record(sources[1], context.DeadlineExceeded)
+	if got := names(h.order(sources)); got != "c,a,b" {
+		t.Fatalf("order = %s, want c,a,b", got)
+	}
+	h.record(sources[1], nil)
+	if got := names(h.order(sources)); got != "b,c,a" {
+		t.Fatalf("order after recovery = %s, want b,c,a", got)
+	}
+	now = now.Add(mirrorRetryAfter)
+	if got := names(h.order(sources)); got != "a,b,c" {
+		t.Fatalf("order after retry window = %s, want a,b,c", got)
+	}
+}
+
+func TestPreflightToleratesUnreachableMirror(t *testing.T) {
+	t.Parallel()
+
+	up := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(up.Close)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(down.Close)
+
+	check := mirrorReachabilityChecker{cfg: &config.Config{Npd: config.NPDConfig{Mirrors: []string{down.URL, up.URL}}}}
+	for _, result := range check.Check(t.Context()) {
+		if result.Severity == preflight.SeverityError {
+			t.Fatalf("Check() = error %q, want only warnings while a mirror is reachable", result.Message)
+		}
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"path/filepath"
 	"text/template"
 
+	"github.com/Azure/AKSFlexNode/pkg/audit"
 	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/unithardening"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
 	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
 	"github.com/Azure/unbounded/pkg/agent/goalstates"
@@ -34,6 +36,7 @@ type startTask struct {
 	machineDir     string
 	machineName    string
 	nodeName       string
+	hardening      config.UnitHardeningConfig
 }
 
 // Start returns a task that renders the NPD systemd unit file into the
@@ -51,13 +54,19 @@ func Start(log *slog.Logger, cfg *config.Config, nodeStart *goalstates.NodeStart
 		machineDir:     nodeStart.MachineDir,
 		machineName:    nodeStart.MachineName,
 		nodeName:       nodeStart.NodeName,
+		hardening:      cfg.UnitHardening,
 	}
 }
 
 func (t *startTask) Name() string { return "start-npd" }
 
+// Plan returns the NPD unit file inside the machine.
+func (t *startTask) Plan() []string {
+	return []string{filepath.Join(t.machineDir, "etc/systemd/system", systemdUnitNPD)}
+}
+
 func (t *startTask) Do(ctx context.Context) error {
-	serviceUpdated, err := t.ensureServiceFile()
+	serviceUpdated, err := t.ensureServiceFile(ctx)
 	if err != nil {
 		return fmt.Errorf("ensure npd service file: %w", err)
 	}
@@ -65,7 +74,7 @@ func (t *startTask) Do(ctx context.Context) error {
 	return t.ensureSystemdUnit(ctx, serviceUpdated)
 }
 
-func (t *startTask) ensureServiceFile() (updated bool, err error) {
+func (t *startTask) ensureServiceFile(ctx context.Context) (updated bool, err error) {
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, map[string]any{
 		"NPDBinaryPath":  npdBinaryPath,
@@ -76,24 +85,34 @@ func (t *startTask) ensureServiceFile() (updated bool, err error) {
 	}); err != nil {
 		return false, fmt.Errorf("render npd service template: %w", err)
 	}
+	unit, err := unithardening.Apply(t.hardening, systemdUnitNPD, buf.Bytes())
+	if err != nil {
+		return false, err
+	}
 
 	hostServicePath := filepath.Join(t.machineDir, "etc/systemd/system", systemdUnitNPD)
 
 	current, err := os.ReadFile(hostServicePath) //nolint:gosec // path is constructed, not user input
+	before := ""
+	if err == nil {
+		before = audit.HashBytes(current)
+	}
 	switch {
 	case errors.Is(err, os.ErrNotExist):
 		// fall through to create
 	case err != nil:
 		return false, err
 	default:
-		if bytes.Equal(bytes.TrimSpace(current), bytes.TrimSpace(buf.Bytes())) {
+		if bytes.Equal(bytes.TrimSpace(current), bytes.TrimSpace(unit)) {
 			return false, nil
 		}
 	}
 
-	if err := utilio.InstallFile(hostServicePath, &buf, 0o644); err != nil { //nolint:gosec // service files must be world-readable
+	after := audit.HashBytes(unit)
+	if err := utilio.InstallFile(hostServicePath, bytes.NewReader(unit), 0o644); err != nil { //nolint:gosec // service files must be world-readable
 		return false, err
 	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileWrite, Target: hostServicePath, BeforeHash: before, AfterHash: after})
 	return true, nil
 }
 
@@ -113,6 +132,7 @@ func (t *startTask) ensureSystemdUnit(ctx context.Context, restart bool) error {
 			"systemctl", "enable", "--now", systemdUnitNPD); startErr != nil {
 			return fmt.Errorf("start npd in machine %s: %w", t.machineName, startErr)
 		}
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitStart, Target: systemdUnitNPD, Detail: "machine " + t.machineName})
 		return nil
 	default:
 		if restart {
@@ -120,6 +140,7 @@ func (t *startTask) ensureSystemdUnit(ctx context.Context, restart bool) error {
 				"systemctl", "restart", systemdUnitNPD); restartErr != nil {
 				return fmt.Errorf("restart npd in machine %s: %w", t.machineName, restartErr)
 			}
+			audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitRestart, Target: systemdUnitNPD, Detail: "machine " + t.machineName})
 		}
 		return nil
 	}
@@ -1,6 +1,7 @@
 package npd
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -48,7 +49,7 @@ func TestRenderedNPDUnitUsesCanonicalKubeconfig(t *testing.T) {
 	if !ok {
 		t.Fatalf("Start did not return *startTask")
 	}
-	if _, err := task.ensureServiceFile(); err != nil {
+	if _, err := task.ensureServiceFile(context.Background()); err != nil {
 		t.Fatalf("ensureServiceFile: %v", err)
 	}
 
@@ -0,0 +1,308 @@
+// Package performance applies the performance profile for latency-sensitive
+// workloads: hugepages and CPU isolation on the kernel command line, with
+// the reboot they need, and checks after the reboot that the kernel
+// allocated what was asked for before the kubelet advertises it.
+package performance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// GrubDropIn carries the profile's kernel arguments on GRUB hosts. It
+	// sorts after the cloud image's own drop-ins so it appends to their
+	// command line.
+	GrubDropIn = "/etc/default/grub.d/99-aks-flex-node-performance.cfg"
+
+	grubHeader = "# Managed by aks-flex-node. Changes are overwritten.\n"
+
+	procCmdlinePath   = "proc/cmdline"
+	kernelVersionPath = "proc/sys/kernel/version"
+	realtimePath      = "sys/kernel/realtime"
+	isolatedCPUsPath  = "sys/devices/system/cpu/isolated"
+	hugePagesDir      = "sys/kernel/mm/hugepages"
+)
+
+// hugePageKernelSizes maps the kubelet hugepage sizes to the kernel's
+// hugepagesz values and sysfs directory names.
+var hugePageKernelSizes = map[string]struct{ arg, sysfs string }{
+	config.HugePageSize2Mi: {arg: "2M", sysfs: "hugepages-2048kB"},
+	config.HugePageSize1Gi: {arg: "1G", sysfs: "hugepages-1048576kB"},
+}
+
+// KernelArgs returns the kernel command line arguments of the profile.
+func KernelArgs(cfg config.PerformanceConfig) []string {
+	var args []string
+	for i, pages := range cfg.HugePages {
+		size := hugePageKernelSizes[pages.Size].arg
+		if i == 0 {
+			args = append(args, "default_hugepagesz="+size)
+		}
+		args = append(args, "hugepagesz="+size, "hugepages="+strconv.Itoa(pages.Count))
+	}
+	if cpus := cfg.IsolatedCPUs; cpus != "" {
+		args = append(args, "isolcpus=managed_irq,domain,"+cpus, "nohz_full="+cpus, "rcu_nocbs="+cpus)
+	}
+	return append(args, cfg.KernelArgs...)
+}
+
+// Host reads and changes the host under root.
+type Host struct {
+	log  *slog.Logger
+	root utilhost.Root
+	// bootCmdline is the firmware cmdline.txt of boards booting without
+	// GRUB, or "" on GRUB hosts.
+	bootCmdline string
+	updateGrub  func(ctx context.Context) error
+}
+
+// NewHost returns a Host for the host under root. bootCmdline is the
+// firmware kernel command line file of the device profile, or "" to
+// configure GRUB.
+func NewHost(log *slog.Logger, root utilhost.Root, bootCmdline string) *Host {
+	return &Host{
+		log:         log,
+		root:        root,
+		bootCmdline: bootCmdline,
+		updateGrub: func(ctx context.Context) error {
+			_, err := root.Output(ctx, log, "update-grub")
+			return err
+		},
+	}
+}
+
+func (h *Host) path(rel string) string {
+	return h.root.Path(rel)
+}
+
+// Realtime reports whether the running kernel is a PREEMPT_RT kernel.
+func (h *Host) Realtime() bool {
+	if data, err := os.ReadFile(h.path(realtimePath)); err == nil {
+		return strings.TrimSpace(string(data)) == "1"
+	}
+	data, err := os.ReadFile(h.path(kernelVersionPath))
+	return err == nil && strings.Contains(string(data), "PREEMPT_RT")
+}
+
+// MissingArgs returns the profile's kernel arguments the running kernel was
+// not booted with.
+func (h *Host) MissingArgs(cfg config.PerformanceConfig) ([]string, error) {
+	data, err := os.ReadFile(h.path(procCmdlinePath))
+	if err != nil {
+		return nil, fmt.Errorf("read kernel command line: %w", err)
+	}
+	running := strings.Fields(string(data))
+	var missing []string
+	for _, arg := range KernelArgs(cfg) {
+		if !slices.Contains(running, arg) {
+			missing = append(missing, arg)
+		}
+	}
+	return missing, nil
+}
+
+// Validate checks that the running kernel allocated the profile's hugepages
+// and isolated its CPUs.
+func (h *Host) Validate(cfg config.PerformanceConfig) error {
+	var errs []error
+	for _, pages := range cfg.HugePages {
+		path := h.path(filepath.Join(hugePagesDir, hugePageKernelSizes[pages.Size].sysfs, "nr_hugepages"))
+		data, err := os.ReadFile(path) //#nosec G304 -- sysfs path under the host root
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read %s hugepages: %w", pages.Size, err))
+			continue
+		}
+		if got, _ := strconv.Atoi(strings.TrimSpace(string(data))); got < pages.Count {
+			errs = append(errs, fmt.Errorf("kernel allocated %d of %d %s hugepages; free memory or lower performance.hugePages", got, pages.Count, pages.Size))
+		}
+	}
+	if cfg.IsolatedCPUs != "" {
+		data, err := os.ReadFile(h.path(isolatedCPUsPath))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read isolated CPUs: %w", err))
+		} else {
+			got, gotErr := ParseCPUList(strings.TrimSpace(string(data)))
+			want, wantErr := ParseCPUList(cfg.IsolatedCPUs)
+			if err := errors.Join(gotErr, wantErr); err != nil {
+				errs = append(errs, err)
+			} else if !slices.Equal(got, want) {
+				errs = append(errs, fmt.Errorf("kernel isolated CPUs %q, want %q", strings.TrimSpace(string(data)), cfg.IsolatedCPUs))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseCPUList returns the sorted CPUs of a kernel CPU list such as
+// "0-3,6". The empty list has no CPUs.
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	if list == "" {
+		return cpus, nil
+	}
+	for part := range strings.SplitSeq(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("parse CPU list %q: %w", list, err)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("parse CPU list %q: %w", list, err)
+			}
+		}
+		for cpu := lo; cpu <= hi; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	slices.Sort(cpus)
+	return slices.Compact(cpus), nil
+}
+
+// WriteBootConfig makes the next boot use the profile's kernel arguments,
+// through the firmware cmdline.txt or a GRUB drop-in, and reports whether
+// anything changed.
+func (h *Host) WriteBootConfig(ctx context.Context, cfg config.PerformanceConfig) (bool, error) {
+	args := KernelArgs(cfg)
+	if h.bootCmdline != "" {
+		path := h.path(h.bootCmdline)
+		data, err := os.ReadFile(path) //#nosec G304 -- fixed device profile path
+		if err != nil {
+			return false, fmt.Errorf("read %s: %w", path, err)
+		}
+		updated := setCmdlineArgs(string(data), args)
+		if updated == string(data) {
+			return false, nil
+		}
+		if err := utilio.WriteFile(path, []byte(updated), 0o644); err != nil { //nolint:gosec // firmware reads the file as a regular boot file
+			return false, fmt.Errorf("write %s: %w", path, err)
+		}
+		audit.Record(ctx, h.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: audit.HashBytes(data), AfterHash: audit.HashBytes([]byte(updated)), Detail: "performance profile kernel arguments"})
+		return true, nil
+	}
+
+	path := h.path(GrubDropIn)
+	content := []byte(fmt.Sprintf("%sGRUB_CMDLINE_LINUX_DEFAULT=\"$GRUB_CMDLINE_LINUX_DEFAULT %s\"\n", grubHeader, strings.Join(args, " ")))
+	if current, err := os.ReadFile(path); err == nil && string(current) == string(content) { //#nosec G304 -- fixed path under the host root
+		return false, nil
+	}
+	before := audit.HashFile(path)
+	if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // read by update-grub
+		return false, fmt.Errorf("write %s: %w", path, err)
+	}
+	audit.Record(ctx, h.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content), Detail: "performance profile kernel arguments"})
+	if err := h.updateGrub(ctx); err != nil {
+		return true, fmt.Errorf("update-grub: %w", err)
+	}
+	return true, nil
+}
+
+// RemoveBootConfig removes the GRUB drop-in a previous profile wrote and
+// reports whether it existed. Arguments added to a firmware cmdline.txt are
+// left alone, as they cannot be told apart from the operator's own.
+func (h *Host) RemoveBootConfig(ctx context.Context) (bool, error) {
+	path := h.path(GrubDropIn)
+	data, err := os.ReadFile(path) //#nosec G304 -- fixed path under the host root
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !strings.HasPrefix(string(data), grubHeader)) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return false, fmt.Errorf("remove %s: %w", path, err)
+	}
+	audit.Record(ctx, h.log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: audit.HashBytes(data), Detail: "performance profile kernel arguments"})
+	if err := h.updateGrub(ctx); err != nil {
+		return true, fmt.Errorf("update-grub: %w", err)
+	}
+	return true, nil
+}
+
+// setCmdlineArgs replaces the arguments of the single-line cmdline.txt
+// format that share a key with args, so a changed CPU list or page count
+// replaces the old one, and appends args.
+func setCmdlineArgs(cmdline string, args []string) string {
+	keys := make([]string, 0, len(args))
+	for _, arg := range args {
+		key, _, _ := strings.Cut(arg, "=")
+		keys = append(keys, key)
+	}
+	fields := slices.DeleteFunc(strings.Fields(cmdline), func(field string) bool {
+		key, _, _ := strings.Cut(field, "=")
+		return slices.Contains(keys, key)
+	})
+	return strings.Join(append(fields, args...), " ") + "\n"
+}
+
+type configureTask struct {
+	log  *slog.Logger
+	cfg  config.PerformanceConfig
+	host *Host
+}
+
+// Configure returns a task that applies the performance profile to the
+// host. When the running kernel lacks the profile's arguments it writes the
+// boot config and fails, so bootstrap stops until the host is rebooted; once
+// booted with them it checks the allocations. Without a profile it removes a
+// GRUB drop-in a previous profile wrote.
+func Configure(log *slog.Logger, cfg *config.Config, bootCmdline string) phases.Task {
+	return &configureTask{log: log, cfg: cfg.Performance, host: NewHost(log, utilhost.HostRoot, bootCmdline)}
+}
+
+func (t *configureTask) Name() string { return "configure-performance-profile" }
+
+// Plan returns the boot config file when the running kernel lacks the
+// profile's arguments.
+func (t *configureTask) Plan() []string {
+	if !t.cfg.Enabled() {
+		return nil
+	}
+	if missing, err := t.host.MissingArgs(t.cfg); err != nil || len(missing) == 0 {
+		return nil
+	}
+	if t.host.bootCmdline != "" {
+		return []string{t.host.bootCmdline}
+	}
+	return []string{GrubDropIn}
+}
+
+func (t *configureTask) Do(ctx context.Context) error {
+	if !t.cfg.Enabled() {
+		removed, err := t.host.RemoveBootConfig(ctx)
+		if removed {
+			t.log.Warn("removed the performance profile kernel arguments; they stay in effect until the host is rebooted")
+		}
+		return err
+	}
+	if t.cfg.RealTimeKernel && !t.host.Realtime() {
+		return fmt.Errorf("performance.realTimeKernel is set but the running kernel is not PREEMPT_RT; install a real-time kernel, reboot the host, and run bootstrap again")
+	}
+	missing, err := t.host.MissingArgs(t.cfg)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		if _, err := t.host.WriteBootConfig(ctx, t.cfg); err != nil {
+			return err
+		}
+		return fmt.Errorf("kernel was not booted with %q; the boot config now adds it, reboot the host and run bootstrap again", strings.Join(missing, " "))
+	}
+	return t.host.Validate(t.cfg)
+}
@@ -0,0 +1,174 @@
+package performance
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+var telcoProfile = config.PerformanceConfig{
+	HugePages:    []config.HugePagesConfig{{Size: config.HugePageSize1Gi, Count: 4}, {Size: config.HugePageSize2Mi, Count: 256}},
+	IsolatedCPUs: "2-7",
+}
+
+// newTestHost returns a Host rooted in a temporary directory holding the
+// given files, and a pointer to the number of update-grub runs.
+func newTestHost(t *testing.T, bootCmdline string, files map[string]string) (*Host, *int) {
+	t.Helper()
+	root := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updates := 0
+	return &Host{
+		log:         slog.New(slog.DiscardHandler),
+		root:        utilhost.Root(root),
+		bootCmdline: bootCmdline,
+		updateGrub: func(context.Context) error {
+			updates++
+			return nil
+		},
+	}, &updates
+}
+
+func TestKernelArgs(t *testing.T) {
+	t.Parallel()
+
+	cfg := telcoProfile
+	cfg.KernelArgs = []string{"intel_pstate=disable"}
+	want := []string{
+		"default_hugepagesz=1G", "hugepagesz=1G", "hugepages=4", "hugepagesz=2M", "hugepages=256",
+		"isolcpus=managed_irq,domain,2-7", "nohz_full=2-7", "rcu_nocbs=2-7", "intel_pstate=disable",
+	}
+	if got := KernelArgs(cfg); !slices.Equal(got, want) {
+		t.Errorf("KernelArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseCPUList("6,0-2,2")
+	if err != nil {
+		t.Fatalf("ParseCPUList() error = %v", err)
+	}
+	if want := []int{0, 1, 2, 6}; !slices.Equal(got, want) {
+		t.Errorf("ParseCPUList() = %v, want %v", got, want)
+	}
+	if _, err := ParseCPUList("a-b"); err == nil {
+		t.Error("ParseCPUList(a-b) error = nil, want error")
+	}
+}
+
+func TestConfigureWritesGrubDropInUntilRebooted(t *testing.T) {
+	t.Parallel()
+
+	host, updates := newTestHost(t, "", map[string]string{procCmdlinePath: "BOOT_IMAGE=/vmlinuz root=/dev/sda1\n"})
+	task := &configureTask{log: host.log, cfg: telcoProfile, host: host}
+	err := task.Do(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "reboot the host") {
+		t.Fatalf("Do() = %v, want reboot error", err)
+	}
+	data, err := os.ReadFile(host.path(GrubDropIn))
+	if err != nil {
+		t.Fatalf("read drop-in: %v", err)
+	}
+	if !strings.Contains(string(data), `"$GRUB_CMDLINE_LINUX_DEFAULT default_hugepagesz=1G`) {
+		t.Errorf("drop-in = %q", data)
+	}
+	if *updates != 1 {
+		t.Errorf("update-grub ran %d times, want 1", *updates)
+	}
+
+	// A second run before the reboot leaves the unchanged drop-in alone.
+	if err := task.Do(t.Context()); err == nil {
+		t.Fatal("second Do() = nil, want reboot error")
+	}
+	if *updates != 1 {
+		t.Errorf("update-grub ran %d times after second run, want 1", *updates)
+	}
+
+	// Without a profile the drop-in is removed.
+	removeTask := &configureTask{log: host.log, host: host}
+	if err := removeTask.Do(t.Context()); err != nil {
+		t.Fatalf("Do() without profile = %v", err)
+	}
+	if _, err := os.Stat(host.path(GrubDropIn)); !os.IsNotExist(err) {
+		t.Errorf("drop-in still exists: %v", err)
+	}
+}
+
+func TestConfigureValidatesAfterReboot(t *testing.T) {
+	t.Parallel()
+
+	cmdline := "root=/dev/sda1 " + strings.Join(KernelArgs(telcoProfile), " ") + "\n"
+	files := map[string]string{
+		procCmdlinePath:  cmdline,
+		isolatedCPUsPath: "2-7\n",
+		filepath.Join(hugePagesDir, "hugepages-1048576kB", "nr_hugepages"): "4\n",
+		filepath.Join(hugePagesDir, "hugepages-2048kB", "nr_hugepages"):    "100\n",
+	}
+	host, _ := newTestHost(t, "", files)
+	task := &configureTask{log: host.log, cfg: telcoProfile, host: host}
+	err := task.Do(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "allocated 100 of 256 2Mi hugepages") {
+		t.Fatalf("Do() = %v, want short 2Mi allocation error", err)
+	}
+
+	if err := os.WriteFile(host.path(filepath.Join(hugePagesDir, "hugepages-2048kB", "nr_hugepages")), []byte("256\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do() = %v, want nil", err)
+	}
+}
+
+func TestConfigureRequiresRealtimeKernel(t *testing.T) {
+	t.Parallel()
+
+	host, _ := newTestHost(t, "", map[string]string{kernelVersionPath: "#1 SMP PREEMPT_DYNAMIC\n"})
+	task := &configureTask{log: host.log, cfg: config.PerformanceConfig{RealTimeKernel: true}, host: host}
+	if err := task.Do(t.Context()); err == nil || !strings.Contains(err.Error(), "PREEMPT_RT") {
+		t.Fatalf("Do() = %v, want PREEMPT_RT error", err)
+	}
+
+	host, _ = newTestHost(t, "", map[string]string{realtimePath: "1\n", procCmdlinePath: "root=/dev/sda1\n"})
+	task.host = host
+	if err := task.Do(t.Context()); err != nil {
+		t.Fatalf("Do() on PREEMPT_RT kernel = %v, want nil", err)
+	}
+}
+
+func TestWriteBootConfigReplacesCmdlineArgs(t *testing.T) {
+	t.Parallel()
+
+	const cmdline = "boot/firmware/cmdline.txt"
+	host, updates := newTestHost(t, cmdline, map[string]string{cmdline: "console=tty1 hugepages=64 isolcpus=1\n"})
+	changed, err := host.WriteBootConfig(t.Context(), config.PerformanceConfig{HugePages: []config.HugePagesConfig{{Size: config.HugePageSize2Mi, Count: 128}}})
+	if err != nil || !changed {
+		t.Fatalf("WriteBootConfig() = %v, %v, want true, nil", changed, err)
+	}
+	data, err := os.ReadFile(host.path(cmdline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "console=tty1 isolcpus=1 default_hugepagesz=2M hugepagesz=2M hugepages=128\n"; string(data) != want {
+		t.Errorf("cmdline.txt = %q, want %q", data, want)
+	}
+	if *updates != 0 {
+		t.Errorf("update-grub ran %d times on a firmware cmdline host", *updates)
+	}
+}
@@ -0,0 +1,48 @@
+package performance
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+const checkName = "performance-profile"
+
+// Preflight returns the performance profile check, or nil without a
+// profile.
+func Preflight(log *slog.Logger, cfg *config.Config, bootCmdline string) []preflight.Checker {
+	if !cfg.Performance.Enabled() {
+		return nil
+	}
+	return []preflight.Checker{profileChecker{cfg: cfg.Performance, host: NewHost(log, utilhost.HostRoot, bootCmdline)}}
+}
+
+type profileChecker struct {
+	cfg  config.PerformanceConfig
+	host *Host
+}
+
+func (profileChecker) Name() string { return checkName }
+
+func (c profileChecker) Check(context.Context) []preflight.Result {
+	if c.cfg.RealTimeKernel && !c.host.Realtime() {
+		return preflight.ResultsError(checkName, "kernel", "performance.realTimeKernel is set but the running kernel is not PREEMPT_RT")
+	}
+	missing, err := c.host.MissingArgs(c.cfg)
+	if err != nil {
+		return preflight.ResultsError(checkName, "kernel command line", "%v", err)
+	}
+	if len(missing) > 0 {
+		return preflight.ResultsWarning(checkName, "kernel command line",
+			"kernel was not booted with %q; bootstrap adds it to the boot config, after which the host must be rebooted", strings.Join(missing, " "))
+	}
+	if err := c.host.Validate(c.cfg); err != nil {
+		return preflight.ResultsError(checkName, "kernel", "%v", err)
+	}
+	return preflight.ResultsOK(checkName, "kernel", "kernel was booted with the performance profile")
+}
@@ -0,0 +1,126 @@
+// Package posture collects the host security posture the agent reports to the
+// cluster: UEFI secure boot, kernel lockdown, the kernel release, and the
+// agent version. Cluster-side admission can use it to keep workloads off flex
+// nodes that fall below policy.
+package posture
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/version"
+)
+
+// Values of the secure boot field. StateUnsupported is also used for the
+// kernel lockdown field when the host cannot report it, such as on legacy
+// BIOS boots or kernels built without the lockdown LSM.
+const (
+	SecureBootEnabled  = "enabled"
+	SecureBootDisabled = "disabled"
+	StateUnsupported   = "unsupported"
+)
+
+const (
+	efiDir             = "sys/firmware/efi"
+	secureBootVariable = efiDir + "/efivars/SecureBoot-8be4df61-93ca-11d2-aa0d-e39e8f9a5a8c"
+	lockdownFile       = "sys/kernel/security/lockdown"
+	kernelReleaseFile  = "proc/sys/kernel/osrelease"
+
+	efiVariableAttrLength = 4
+)
+
+// Report is the posture of one node. The host fields are collected by
+// Collect; the machine fields are filled in by the daemon, which knows the
+// active machine.
+type Report struct {
+	CollectedAt    time.Time `json:"collectedAt"`
+	AgentVersion   string    `json:"agentVersion"`
+	KernelRelease  string    `json:"kernelRelease"`
+	SecureBoot     string    `json:"secureBoot"`
+	KernelLockdown string    `json:"kernelLockdown"`
+
+	ActiveMachine     string `json:"activeMachine,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	// RootFSVerified reports whether the active machine's binaries match the
+	// manifest recorded when it was installed; nil when none was recorded.
+	RootFSVerified   *bool `json:"rootfsVerified,omitempty"`
+	RootFSMismatches int   `json:"rootfsMismatches,omitempty"`
+}
+
+// Collector reads the host posture from the filesystem under root.
+type Collector struct {
+	root utilhost.Root
+	now  func() time.Time
+}
+
+// NewCollector returns a collector for the host under root.
+func NewCollector(root utilhost.Root) *Collector {
+	return &Collector{root: root, now: time.Now}
+}
+
+// Collect returns the host posture. Fields the host cannot report are set to
+// "unsupported" rather than failing the whole report.
+func (c *Collector) Collect() (*Report, error) {
+	report := &Report{CollectedAt: c.now().UTC(), AgentVersion: version.Version}
+	var errs []error
+
+	release, err := os.ReadFile(c.root.Path(kernelReleaseFile))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read kernel release: %w", err))
+	}
+	report.KernelRelease = strings.TrimSpace(string(release))
+
+	if report.SecureBoot, err = c.secureBoot(); err != nil {
+		errs = append(errs, err)
+	}
+	if report.KernelLockdown, err = c.kernelLockdown(); err != nil {
+		errs = append(errs, err)
+	}
+	return report, errors.Join(errs...)
+}
+
+// secureBoot reads the SecureBoot EFI variable: four attribute bytes followed
+// by a one-byte value of 1 when secure boot is on.
+func (c *Collector) secureBoot() (string, error) {
+	if _, err := os.Stat(c.root.Path(efiDir)); errors.Is(err, fs.ErrNotExist) {
+		return StateUnsupported, nil
+	}
+	data, err := os.ReadFile(c.root.Path(secureBootVariable))
+	if errors.Is(err, fs.ErrNotExist) {
+		// UEFI firmware without secure boot support.
+		return SecureBootDisabled, nil
+	}
+	if err != nil {
+		return StateUnsupported, fmt.Errorf("read SecureBoot EFI variable: %w", err)
+	}
+	if len(data) <= efiVariableAttrLength {
+		return StateUnsupported, fmt.Errorf("SecureBoot EFI variable is %d bytes", len(data))
+	}
+	if data[efiVariableAttrLength] == 1 {
+		return SecureBootEnabled, nil
+	}
+	return SecureBootDisabled, nil
+}
+
+// kernelLockdown returns the active lockdown mode, which the kernel lists in
+// brackets: "[none] integrity confidentiality".
+func (c *Collector) kernelLockdown() (string, error) {
+	data, err := os.ReadFile(c.root.Path(lockdownFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return StateUnsupported, nil
+	}
+	if err != nil {
+		return StateUnsupported, fmt.Errorf("read kernel lockdown: %w", err)
+	}
+	for field := range strings.FieldsSeq(string(data)) {
+		if mode, ok := strings.CutPrefix(field, "["); ok {
+			return strings.TrimSuffix(mode, "]"), nil
+		}
+	}
+	return StateUnsupported, fmt.Errorf("unexpected kernel lockdown state %q", strings.TrimSpace(string(data)))
+}
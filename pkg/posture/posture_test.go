@@ -0,0 +1,98 @@
+package posture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		files        map[string]string
+		dirs         []string
+		wantSecure   string
+		wantLockdown string
+		wantErr      bool
+	}{
+		{
+			name: "secure boot and integrity lockdown",
+			files: map[string]string{
+				secureBootVariable: "\x06\x00\x00\x00\x01",
+				lockdownFile:       "none [integrity] confidentiality\n",
+			},
+			wantSecure:   SecureBootEnabled,
+			wantLockdown: "integrity",
+		},
+		{
+			name: "secure boot off",
+			files: map[string]string{
+				secureBootVariable: "\x06\x00\x00\x00\x00",
+				lockdownFile:       "[none] integrity confidentiality\n",
+			},
+			wantSecure:   SecureBootDisabled,
+			wantLockdown: "none",
+		},
+		{
+			name:         "uefi without secure boot variable",
+			dirs:         []string{efiDir},
+			wantSecure:   SecureBootDisabled,
+			wantLockdown: StateUnsupported,
+		},
+		{
+			name:         "legacy bios without lockdown lsm",
+			wantSecure:   StateUnsupported,
+			wantLockdown: StateUnsupported,
+		},
+		{
+			name:         "truncated secure boot variable",
+			files:        map[string]string{secureBootVariable: "\x06\x00"},
+			wantSecure:   StateUnsupported,
+			wantLockdown: StateUnsupported,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			files := map[string]string{kernelReleaseFile: "6.8.0-azure\n"}
+			for path, body := range tt.files {
+				files[path] = body
+			}
+			for path, body := range files {
+				full := filepath.Join(root, path)
+				if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(full, []byte(body), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, dir := range tt.dirs {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+			c := &Collector{root: utilhost.Root(root), now: func() time.Time { return now }}
+			report, err := c.Collect()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collect error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if report.SecureBoot != tt.wantSecure || report.KernelLockdown != tt.wantLockdown {
+				t.Fatalf("secureBoot = %q, lockdown = %q; want %q, %q", report.SecureBoot, report.KernelLockdown, tt.wantSecure, tt.wantLockdown)
+			}
+			if report.KernelRelease != "6.8.0-azure" || !report.CollectedAt.Equal(now) || report.AgentVersion == "" {
+				t.Fatalf("report = %+v", report)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Package progress tracks the steps of a running bootstrap or repave and the
+// bytes and files of the downloads inside them, so a slow multi-hundred
+// megabyte install can be told apart from a stuck one.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StallAfter is how long a step with a byte or file counter may go without
+// advancing before it is reported as stalled.
+const StallAfter = 2 * time.Minute
+
+// Step is the progress of one running step. The byte and file counters are
+// only set by steps that report them; other steps show their elapsed time.
+type Step struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"startedAt"`
+	// UpdatedAt is when a counter last advanced.
+	UpdatedAt      time.Time `json:"updatedAt"`
+	BytesDone      int64     `json:"bytesDone,omitempty"`
+	BytesTotal     int64     `json:"bytesTotal,omitempty"`
+	FilesExtracted int       `json:"filesExtracted,omitempty"`
+}
+
+// counted reports whether the step reports byte or file counts.
+func (s Step) counted() bool {
+	return s.BytesDone > 0 || s.BytesTotal > 0 || s.FilesExtracted > 0
+}
+
+// ETA estimates the remaining download time from the average rate so far. It
+// returns false when the total is unknown or nothing was downloaded yet.
+func (s Step) ETA(now time.Time) (time.Duration, bool) {
+	elapsed := now.Sub(s.StartedAt)
+	if s.BytesTotal <= 0 || s.BytesDone <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+	remaining := max(s.BytesTotal-s.BytesDone, 0)
+	return time.Duration(float64(elapsed) * float64(remaining) / float64(s.BytesDone)), true
+}
+
+// Stalled reports whether the step's counters stopped advancing.
+func (s Step) Stalled(now time.Time) bool {
+	return s.counted() && now.Sub(s.UpdatedAt) >= StallAfter
+}
+
+// Summary renders the step on one line, for example
+// "download-npd: 120.0 MiB of 700.0 MiB (17%), 3 files, 12.0 MiB/s, ETA 48s".
+func (s Step) Summary(now time.Time) string {
+	elapsed := now.Sub(s.StartedAt).Round(time.Second)
+	if !s.counted() {
+		return fmt.Sprintf("%s: running for %s", s.Name, elapsed)
+	}
+	parts := []string{FormatBytes(s.BytesDone)}
+	if s.BytesTotal > 0 {
+		parts[0] = fmt.Sprintf("%s of %s (%d%%)", FormatBytes(s.BytesDone), FormatBytes(s.BytesTotal), s.BytesDone*100/s.BytesTotal)
+	}
+	if s.FilesExtracted > 0 {
+		parts = append(parts, fmt.Sprintf("%d files", s.FilesExtracted))
+	}
+	if seconds := now.Sub(s.StartedAt).Seconds(); seconds > 0 && s.BytesDone > 0 {
+		parts = append(parts, FormatBytes(int64(float64(s.BytesDone)/seconds))+"/s")
+	}
+	if s.Stalled(now) {
+		parts = append(parts, "no progress for "+now.Sub(s.UpdatedAt).Round(time.Second).String())
+	} else if eta, ok := s.ETA(now); ok {
+		parts = append(parts, "ETA "+eta.Round(time.Second).String())
+	}
+	return s.Name + ": " + strings.Join(parts, ", ")
+}
+
+// FormatBytes formats n with a binary unit, such as "1.5 GiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB", "TiB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
+
+// Operation is the bootstrap or repave in flight and its running steps.
+type Operation struct {
+	Name      string    `json:"name"`
+	Machine   string    `json:"machine,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Steps     []Step    `json:"steps"`
+}
+
+// Tracker records the running steps of one operation. It is safe for
+// concurrent use by parallel steps.
+type Tracker struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	operation Operation
+	running   []*Counter
+}
+
+// NewTracker starts tracking operation on machine.
+func NewTracker(operation, machine string) *Tracker {
+	t := &Tracker{now: time.Now}
+	t.operation = Operation{Name: operation, Machine: machine, StartedAt: t.now().UTC()}
+	return t
+}
+
+// Begin marks step as running until End is called on the returned counter.
+// A nil *Tracker returns a nil counter.
+func (t *Tracker) Begin(step string) *Counter {
+	if t == nil {
+		return nil
+	}
+	now := t.now().UTC()
+	c := &Counter{tracker: t, step: Step{Name: step, StartedAt: now, UpdatedAt: now}}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = append(t.running, c)
+	return c
+}
+
+// Snapshot returns a copy of the operation with its running steps.
+func (t *Tracker) Snapshot() *Operation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := t.operation
+	out.Steps = make([]Step, 0, len(t.running))
+	for _, c := range t.running {
+		out.Steps = append(out.Steps, c.step)
+	}
+	return &out
+}
+
+// Counter accumulates the byte and file counts of one running step. A nil
+// *Counter is valid and counts nothing, so tasks can report progress whether
+// or not their caller tracks it.
+type Counter struct {
+	tracker *Tracker
+	step    Step
+}
+
+// SetTotal records the expected download size in bytes.
+func (c *Counter) SetTotal(bytes int64) {
+	if c == nil || bytes <= 0 {
+		return
+	}
+	c.tracker.mu.Lock()
+	defer c.tracker.mu.Unlock()
+	c.step.BytesTotal = bytes
+}
+
+// AddFile counts one extracted file.
+func (c *Counter) AddFile() {
+	if c == nil {
+		return
+	}
+	c.tracker.mu.Lock()
+	defer c.tracker.mu.Unlock()
+	c.step.FilesExtracted++
+	c.step.UpdatedAt = c.tracker.now().UTC()
+}
+
+func (c *Counter) addBytes(n int) {
+	if c == nil || n <= 0 {
+		return
+	}
+	c.tracker.mu.Lock()
+	defer c.tracker.mu.Unlock()
+	c.step.BytesDone += int64(n)
+	c.step.UpdatedAt = c.tracker.now().UTC()
+}
+
+// Reader returns r counting the bytes read from it as downloaded.
+func (c *Counter) Reader(r io.Reader) io.Reader {
+	if c == nil {
+		return r
+	}
+	return &countingReader{r: r, counter: c}
+}
+
+// Restart clears the counts of a step that starts its download over, for
+// example from another mirror, so the rate and ETA describe the new attempt.
+func (c *Counter) Restart() {
+	if c == nil {
+		return
+	}
+	c.tracker.mu.Lock()
+	defer c.tracker.mu.Unlock()
+	now := c.tracker.now().UTC()
+	c.step = Step{Name: c.step.Name, StartedAt: now, UpdatedAt: now}
+}
+
+// End removes the step from the running steps.
+func (c *Counter) End() {
+	if c == nil {
+		return
+	}
+	c.tracker.mu.Lock()
+	defer c.tracker.mu.Unlock()
+	c.tracker.running = slices.DeleteFunc(c.tracker.running, func(running *Counter) bool { return running == c })
+}
+
+type countingReader struct {
+	r       io.Reader
+	counter *Counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.counter.addBytes(n)
+	return n, err
+}
+
+type counterKey struct{}
+
+// WithCounter returns ctx carrying the counter of the step it is passed to.
+func WithCounter(ctx context.Context, c *Counter) context.Context {
+	return context.WithValue(ctx, counterKey{}, c)
+}
+
+// FromContext returns the counter of the running step, or nil.
+func FromContext(ctx context.Context) *Counter {
+	c, _ := ctx.Value(counterKey{}).(*Counter)
+	return c
+}
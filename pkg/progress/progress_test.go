@@ -0,0 +1,88 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterTracksRunningSteps(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tracker := NewTracker("bootstrap", "kube1")
+	tracker.now = func() time.Time { return now }
+
+	idle := tracker.Begin("install-packages")
+	download := tracker.Begin("download-npd")
+	download.SetTotal(400)
+	ctx := WithCounter(context.Background(), download)
+	if _, err := io.Copy(io.Discard, FromContext(ctx).Reader(bytes.NewReader(make([]byte, 100)))); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	download.AddFile()
+
+	snapshot := tracker.Snapshot()
+	if snapshot.Name != "bootstrap" || snapshot.Machine != "kube1" || len(snapshot.Steps) != 2 {
+		t.Fatalf("Snapshot = %+v, want bootstrap of kube1 with two steps", snapshot)
+	}
+	step := snapshot.Steps[1]
+	if step.BytesDone != 100 || step.BytesTotal != 400 || step.FilesExtracted != 1 {
+		t.Fatalf("download step = %+v, want 100 of 400 bytes and 1 file", step)
+	}
+
+	later := now.Add(10 * time.Second)
+	if eta, ok := step.ETA(later); !ok || eta != 30*time.Second {
+		t.Fatalf("ETA = %s, %v; want 30s", eta, ok)
+	}
+	if got, want := step.Summary(later), "download-npd: 100 B of 400 B (25%), 1 files, 10 B/s, ETA 30s"; got != want {
+		t.Fatalf("Summary = %q, want %q", got, want)
+	}
+	if got := snapshot.Steps[0].Summary(later); got != "install-packages: running for 10s" {
+		t.Fatalf("uncounted Summary = %q", got)
+	}
+	if stalled := now.Add(StallAfter); !step.Stalled(stalled) || !strings.Contains(step.Summary(stalled), "no progress for 2m0s") {
+		t.Fatalf("Summary after %s = %q, want stalled", StallAfter, step.Summary(stalled))
+	}
+	if snapshot.Steps[0].Stalled(now.Add(time.Hour)) {
+		t.Fatal("step without counters reported as stalled")
+	}
+
+	idle.End()
+	download.End()
+	if steps := tracker.Snapshot().Steps; len(steps) != 0 {
+		t.Fatalf("Steps after End = %+v, want none", steps)
+	}
+}
+
+func TestNilCounter(t *testing.T) {
+	t.Parallel()
+
+	var counter *Counter
+	counter.SetTotal(10)
+	counter.AddFile()
+	counter.End()
+	r := strings.NewReader("data")
+	if got := counter.Reader(r); got != r {
+		t.Fatal("nil counter wrapped the reader")
+	}
+	if FromContext(context.Background()) != nil {
+		t.Fatal("FromContext without a counter != nil")
+	}
+	if (*Tracker)(nil).Begin("step") != nil {
+		t.Fatal("nil tracker returned a counter")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	for n, want := range map[int64]string{512: "512 B", 1536: "1.5 KiB", 700 << 20: "700.0 MiB", 3 << 30: "3.0 GiB"} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
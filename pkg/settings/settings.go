@@ -0,0 +1,184 @@
+// Package settings resolves command settings with one precedence for every
+// command: a command-line flag wins over the config file, which wins over the
+// default. The flags that override a config field can also be set by their
+// AKS_FLEX_NODE_* environment variable, which sits between the flag and the
+// file.
+package settings
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+// EnvPrefix prefixes the environment variable of every config flag.
+const EnvPrefix = "AKS_FLEX_NODE_"
+
+// Sources of a setting's effective value.
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceConfig  = "config"
+	SourceDefault = "default"
+)
+
+const (
+	// sourceAnnotation records on a flag where its value came from.
+	sourceAnnotation = "aks-flex-node/source"
+	// configPathAnnotation binds a flag to the config field it overrides.
+	configPathAnnotation = "aks-flex-node/config-path"
+)
+
+// configFlag is a flag that overrides a config file field.
+type configFlag struct {
+	path  string
+	usage string
+}
+
+// configFlags are the flags AddConfigFlags can add, by name.
+var configFlags = map[string]configFlag{
+	"log-level":      {path: "agent.logLevel", usage: "Override agent.logLevel: debug, info, warning, or error"},
+	"max-disruption": {path: "agent.disruption.maxDisruption", usage: "Override agent.disruption.maxDisruption: none, kubelet, or machine"},
+}
+
+// EnvName returns the environment variable that sets flag name, for example
+// AKS_FLEX_NODE_MAX_DISRUPTION for --max-disruption.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// AddConfigFlags adds the named config-overriding flags to cmd. LoadConfig
+// applies those set by flag or environment over the config file.
+func AddConfigFlags(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		flag, ok := configFlags[name]
+		if !ok {
+			panic(fmt.Sprintf("settings: unknown config flag %q", name))
+		}
+		cmd.Flags().String(name, "", flag.usage)
+		_ = cmd.Flags().SetAnnotation(name, configPathAnnotation, []string{flag.path})
+	}
+}
+
+// Resolve sets every config flag of cmd that the command line left unset
+// from its environment variable, and records each flag's source. Other flags
+// are never read from the environment: names such as AKS_FLEX_NODE_INSTANCE
+// and AKS_FLEX_NODE_VERSION already mean something to hooks and the install
+// scripts.
+func Resolve(cmd *cobra.Command) error {
+	var errs []string
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		source := SourceDefault
+		if flag.Changed {
+			source = SourceFlag
+		} else if value, ok := os.LookupEnv(EnvName(flag.Name)); ok && isConfigFlag(flag) {
+			if err := cmd.Flags().Set(flag.Name, value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", EnvName(flag.Name), err))
+				return
+			}
+			source = SourceEnv
+		}
+		if flag.Annotations == nil {
+			flag.Annotations = map[string][]string{}
+		}
+		flag.Annotations[sourceAnnotation] = []string{source}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment settings: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// LoadConfig loads the config file for instance and applies the config
+// flags of cmd that were set by flag or environment over it.
+func LoadConfig(cmd *cobra.Command, configPath string, instance config.Instance) (*config.Config, error) {
+	cfg, err := config.LoadInstanceConfigWithOverrides(configPath, instance, overrides(cmd))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config from %s: %w", configPath, err)
+	}
+	return cfg, nil
+}
+
+// LoadConfigWithOrigins loads the config like LoadConfig and also returns
+// the profile, file, instance section, or override that set each value.
+func LoadConfigWithOrigins(cmd *cobra.Command, configPath string, instance config.Instance) (*config.Config, config.Origins, error) {
+	cfg, origins, err := config.LoadInstanceConfigWithOrigins(configPath, instance, overrides(cmd))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config from %s: %w", configPath, err)
+	}
+	return cfg, origins, nil
+}
+
+// isConfigFlag reports whether flag was added by AddConfigFlags.
+func isConfigFlag(flag *pflag.Flag) bool {
+	return len(flag.Annotations[configPathAnnotation]) > 0
+}
+
+func overrides(cmd *cobra.Command) config.Overrides {
+	out := config.Overrides{}
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		path := flag.Annotations[configPathAnnotation]
+		if len(path) == 0 || !flag.Changed {
+			return
+		}
+		out[path[0]] = flag.Value.String()
+	})
+	return out
+}
+
+// Setting is one resolved flag of a command.
+type Setting struct {
+	Flag string `json:"flag"`
+	// Env is the environment variable that sets a config flag.
+	Env string `json:"env,omitempty"`
+	// ConfigPath is the config field the flag overrides, if any.
+	ConfigPath string `json:"configPath,omitempty"`
+	Value      string `json:"value"`
+	Source     string `json:"source"`
+}
+
+// Effective lists the flags of cmd with their values and sources, sorted by
+// flag name. A config flag left unset reports the config file as its source
+// when the file sets the field.
+func Effective(cmd *cobra.Command, cfg *config.Config) []Setting {
+	var out []Setting
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" {
+			return
+		}
+		setting := Setting{Flag: flag.Name, Value: flag.Value.String(), Source: SourceDefault}
+		if source := flag.Annotations[sourceAnnotation]; len(source) > 0 {
+			setting.Source = source[0]
+		}
+		if path := flag.Annotations[configPathAnnotation]; len(path) > 0 {
+			setting.Env = EnvName(flag.Name)
+			setting.ConfigPath = path[0]
+			if setting.Source == SourceDefault && cfg != nil {
+				if value := configValue(cfg, path[0]); value != "" {
+					setting.Value = value
+					setting.Source = SourceConfig
+				}
+			}
+		}
+		out = append(out, setting)
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Flag < out[j].Flag })
+	return out
+}
+
+// configValue returns the config field at path for the bound flags.
+func configValue(cfg *config.Config, path string) string {
+	switch path {
+	case "agent.logLevel":
+		return cfg.Agent.LogLevel
+	case "agent.disruption.maxDisruption":
+		return cfg.Agent.Disruption.MaxDisruption
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testConfig = `{
+	"azure": {
+		"targetAgentPoolName": "pool1",
+		"bootstrapToken": {"token": "abcdef.0123456789abcdef"},
+		"targetCluster": {
+			"resourceId": "/subscriptions/12345678-1234-1234-1234-123456789012/resourceGroups/test-rg/providers/Microsoft.ContainerService/managedClusters/test-cluster"
+		}
+	},
+	"agent": {"logLevel": "warning", "disruption": {"maxDisruption": "machine"}},
+	"components": {"kubernetes": "1.29.0"},
+	"node": {
+		"kubelet": {
+			"clusterFQDN": "test-cluster-dns-12345678.hcp.eastus.azmk8s.io",
+			"caCertData": "LS0tLS1CRUdJTi1DRVJUSUZJQ0FURS0tLS0t"
+		}
+	}
+}`
+
+func TestEnvName(t *testing.T) {
+	t.Parallel()
+
+	if got := EnvName("max-disruption"); got != "AKS_FLEX_NODE_MAX_DISRUPTION" {
+		t.Fatalf("EnvName() = %q", got)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	t.Setenv("AKS_FLEX_NODE_INSTANCE", "gpu0")
+	t.Setenv("AKS_FLEX_NODE_LOG_LEVEL", "error")
+	t.Setenv("AKS_FLEX_NODE_MAX_DISRUPTION", "none")
+
+	var configPath string
+	var instance *Setting
+	cmd := &cobra.Command{
+		Use: "test",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return Resolve(cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(cmd, configPath, "")
+			if err != nil {
+				return err
+			}
+			// The flag beats the environment, which beats the file.
+			if cfg.Agent.LogLevel != "debug" || cfg.Agent.Disruption.MaxDisruption != "none" {
+				t.Errorf("agent = %q/%q, want debug/none", cfg.Agent.LogLevel, cfg.Agent.Disruption.MaxDisruption)
+			}
+			sources := map[string]string{}
+			for _, s := range Effective(cmd, cfg) {
+				sources[s.Flag] = s.Source
+				if s.Flag == "instance" {
+					instance = &s
+				}
+			}
+			// Only config flags are read from the environment.
+			want := map[string]string{"config": SourceFlag, "instance": SourceDefault, "log-level": SourceFlag, "max-disruption": SourceEnv}
+			for flag, source := range want {
+				if sources[flag] != source {
+					t.Errorf("%s source = %q, want %q", flag, sources[flag], source)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "")
+	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().String("instance", "", "")
+	AddConfigFlags(cmd, "log-level", "max-disruption")
+	cmd.SetArgs([]string{"--config", path, "--log-level", "debug"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if instance == nil || instance.Value != "" || instance.Env != "" {
+		t.Fatalf("instance setting = %+v, want the default with no environment variable", instance)
+	}
+}
+
+func TestEffectiveReportsConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	cmd := &cobra.Command{Use: "test"}
+	AddConfigFlags(cmd, "max-disruption")
+	if err := Resolve(cmd); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	cfg, err := LoadConfig(cmd, path, "")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	got := Effective(cmd, cfg)
+	if len(got) != 1 || got[0].Source != SourceConfig || got[0].Value != "machine" || got[0].ConfigPath != "agent.disruption.maxDisruption" {
+		t.Fatalf("Effective() = %+v, want max-disruption=machine from the config file", got)
+	}
+}
+
+func TestResolveIgnoresEnvForOtherFlags(t *testing.T) {
+	t.Setenv("AKS_FLEX_NODE_JSON", "maybe")
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().Bool("json", false, "")
+	if err := Resolve(cmd); err != nil {
+		t.Fatalf("Resolve() error = %v, want AKS_FLEX_NODE_JSON ignored", err)
+	}
+	if got := Effective(cmd, nil); len(got) != 1 || got[0].Value != "false" || got[0].Source != SourceDefault {
+		t.Fatalf("Effective() = %+v, want json=false from the default", got)
+	}
+}
@@ -0,0 +1,160 @@
+// Package shutdown lets the agent daemon stop without abandoning work half
+// done.
+//
+// SIGTERM cancels the daemon's context wherever it happens to be. For most
+// work that is fine, but a repave interrupted between stopping the old machine
+// and starting the new one, or a reset interrupted between removing files,
+// leaves the host for the next start to untangle, and the status patch that
+// would have explained it is lost too. Such work runs as a critical section
+// instead: its context outlives the daemon's by a grace period, so it can
+// finish and report, while everything else stops at once. Drain then waits
+// for the sections still running and keeps systemd informed.
+package shutdown
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often Drain reports the sections still running.
+const progressInterval = 5 * time.Second
+
+// Coordinator tracks the critical sections in progress.
+type Coordinator struct {
+	grace time.Duration
+
+	mu       sync.Mutex
+	sections map[int]string
+	nextID   int
+	idle     chan struct{}
+
+	// notify sends a state string to systemd; overridden in tests.
+	notify func(state string)
+}
+
+// New returns a coordinator that lets critical sections run for grace after
+// the context they were started from is canceled.
+func New(grace time.Duration) *Coordinator {
+	return &Coordinator{grace: grace, sections: map[int]string{}, notify: sdNotify}
+}
+
+// Critical starts the critical section name and returns its context, which is
+// canceled grace after ctx is, or when done is called. done must be called
+// when the section ends, typically with defer. A nil Coordinator returns ctx,
+// so callers that were not given one keep the old behavior.
+func (c *Coordinator) Critical(ctx context.Context, name string) (context.Context, func()) {
+	if c == nil {
+		return ctx, func() {}
+	}
+	sectionCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	var deadline *time.Timer
+	var deadlineMu sync.Mutex
+	stop := context.AfterFunc(ctx, func() {
+		deadlineMu.Lock()
+		defer deadlineMu.Unlock()
+		deadline = time.AfterFunc(c.grace, cancel)
+	})
+
+	c.mu.Lock()
+	id := c.nextID
+	c.nextID++
+	c.sections[id] = name
+	c.mu.Unlock()
+
+	var once sync.Once
+	return sectionCtx, func() {
+		once.Do(func() {
+			stop()
+			deadlineMu.Lock()
+			if deadline != nil {
+				deadline.Stop()
+			}
+			deadlineMu.Unlock()
+			cancel()
+
+			c.mu.Lock()
+			delete(c.sections, id)
+			if len(c.sections) == 0 && c.idle != nil {
+				close(c.idle)
+				c.idle = nil
+			}
+			c.mu.Unlock()
+		})
+	}
+}
+
+// Active returns the names of the critical sections in progress.
+func (c *Coordinator) Active() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.sections))
+	for _, name := range c.sections {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Drain waits until no critical section is running or grace has passed,
+// logging the sections still running and reporting them to systemd as the
+// unit status. It returns the sections that had not finished.
+func (c *Coordinator) Drain(log *slog.Logger) []string {
+	c.notify("STOPPING=1")
+	timeout := time.NewTimer(c.grace)
+	defer timeout.Stop()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	for waited := false; ; waited = true {
+		c.mu.Lock()
+		if len(c.sections) == 0 {
+			c.mu.Unlock()
+			if waited {
+				log.Info("in-flight operations finished", "waited", time.Since(start).Round(time.Second))
+				c.notify("STATUS=in-flight operations finished")
+			}
+			return nil
+		}
+		if c.idle == nil {
+			c.idle = make(chan struct{})
+		}
+		idle := c.idle
+		c.mu.Unlock()
+
+		active := c.Active()
+		log.Info("waiting for in-flight operations before stopping", "operations", active, "waited", time.Since(start).Round(time.Second), "grace", c.grace)
+		c.notify("STATUS=finishing " + strings.Join(active, ", ") + " before stopping")
+		select {
+		case <-idle:
+		case <-ticker.C:
+		case <-timeout.C:
+			active := c.Active()
+			log.Warn("stopping with operations still in flight; they are canceled", "operations", active)
+			return active
+		}
+	}
+}
+
+// sdNotify sends state to the socket systemd passes in NOTIFY_SOCKET. Outside
+// systemd, or when the unit does not accept notifications, it does nothing.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = conn.Write([]byte(state))
+}
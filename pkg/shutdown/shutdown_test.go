@@ -0,0 +1,104 @@
+package shutdown
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCoordinator(grace time.Duration) (*Coordinator, *[]string) {
+	var mu sync.Mutex
+	var notified []string
+	c := New(grace)
+	c.notify = func(state string) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, state)
+	}
+	return c, &notified
+}
+
+func TestCriticalOutlivesParent(t *testing.T) {
+	t.Parallel()
+
+	c, _ := testCoordinator(time.Hour)
+	parent, cancel := context.WithCancel(t.Context())
+	ctx, done := c.Critical(parent, "repave")
+	cancel()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("critical section was canceled with its parent")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := c.Active(); !slices.Equal(got, []string{"repave"}) {
+		t.Errorf("Active() = %v", got)
+	}
+	done()
+	if ctx.Err() == nil {
+		t.Error("critical section context outlived done")
+	}
+	if got := c.Active(); len(got) != 0 {
+		t.Errorf("Active() after done = %v", got)
+	}
+}
+
+func TestCriticalCanceledAfterGrace(t *testing.T) {
+	t.Parallel()
+
+	c, _ := testCoordinator(10 * time.Millisecond)
+	parent, cancel := context.WithCancel(t.Context())
+	ctx, done := c.Critical(parent, "reset")
+	defer done()
+	cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("critical section was not canceled after the grace period")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	c, notified := testCoordinator(5 * time.Second)
+	_, done := c.Critical(t.Context(), "repave")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done()
+	}()
+
+	if remaining := c.Drain(slog.New(slog.DiscardHandler)); len(remaining) != 0 {
+		t.Errorf("Drain() = %v, want every section finished", remaining)
+	}
+	want := []string{"STOPPING=1", "STATUS=finishing repave before stopping", "STATUS=in-flight operations finished"}
+	if !slices.Equal(*notified, want) {
+		t.Errorf("notified %q, want %q", *notified, want)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, _ := testCoordinator(10 * time.Millisecond)
+	_, done := c.Critical(t.Context(), "repave")
+	defer done()
+	if remaining := c.Drain(slog.New(slog.DiscardHandler)); !slices.Equal(remaining, []string{"repave"}) {
+		t.Errorf("Drain() = %v, want the unfinished section", remaining)
+	}
+}
+
+func TestNilCoordinator(t *testing.T) {
+	t.Parallel()
+
+	var c *Coordinator
+	ctx, done := c.Critical(t.Context(), "repave")
+	done()
+	if ctx != t.Context() {
+		t.Error("nil coordinator did not return the parent context")
+	}
+}
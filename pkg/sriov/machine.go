@@ -0,0 +1,178 @@
+package sriov
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// DevicePluginConfigPath is where the SR-IOV device plugin config is
+	// written in the machine, the plugin's default --config-file. A device
+	// plugin DaemonSet picks it up by mounting the host path
+	// /var/lib/machines/<machine>/etc/pcidp.
+	DevicePluginConfigPath = "/etc/pcidp/config.json"
+
+	// CNIConfigDir is where Multus looks up the CNI config of a
+	// NetworkAttachmentDefinition that has no spec.config.
+	CNIConfigDir = "/etc/cni/multus/net.d"
+
+	// cniConfigPrefix marks the CNI configs the agent owns, so stale ones
+	// are removed without touching the operator's.
+	cniConfigPrefix = "aks-flex-node-sriov-"
+)
+
+type devicePluginConfig struct {
+	ResourceList []devicePluginResource `json:"resourceList"`
+}
+
+type devicePluginResource struct {
+	ResourceName   string                `json:"resourceName"`
+	ResourcePrefix string                `json:"resourcePrefix"`
+	Selectors      devicePluginSelectors `json:"selectors"`
+}
+
+type devicePluginSelectors struct {
+	PFNames []string `json:"pfNames"`
+	Drivers []string `json:"drivers,omitempty"`
+}
+
+// DevicePluginConfig renders the SR-IOV device plugin config for cfg: one
+// resource per interface, selecting its virtual functions.
+func DevicePluginConfig(cfg config.SRIOVConfig) ([]byte, error) {
+	plugin := devicePluginConfig{ResourceList: []devicePluginResource{}}
+	for _, iface := range cfg.Interfaces {
+		resource := devicePluginResource{
+			ResourceName:   iface.Resource(),
+			ResourcePrefix: config.SRIOVResourcePrefix,
+			Selectors:      devicePluginSelectors{PFNames: []string{iface.Name}},
+		}
+		if iface.Driver != "" {
+			resource.Selectors.Drivers = []string{iface.Driver}
+		}
+		plugin.ResourceList = append(plugin.ResourceList, resource)
+	}
+	data, err := json.MarshalIndent(plugin, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal SR-IOV device plugin config: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// CNIConfig renders the sriov CNI config of the interface's network.
+func CNIConfig(iface config.SRIOVInterfaceConfig) ([]byte, error) {
+	network := map[string]any{
+		"cniVersion": "0.4.0",
+		"name":       iface.Network.Name,
+		"type":       "sriov",
+	}
+	if iface.Network.VLAN > 0 {
+		network["vlan"] = iface.Network.VLAN
+	}
+	if len(iface.Network.IPAM) > 0 {
+		network["ipam"] = iface.Network.IPAM
+	}
+	data, err := json.MarshalIndent(network, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal CNI config of network %s: %w", iface.Network.Name, err)
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteMachineConfig writes the device plugin config and the CNI configs of
+// cfg into the machine at machineDir, and removes CNI configs a previous
+// config wrote. Nothing is written without SR-IOV config.
+func WriteMachineConfig(ctx context.Context, log *slog.Logger, cfg config.SRIOVConfig, machineDir string) error {
+	want := map[string][]byte{}
+	if cfg.Enabled() {
+		plugin, err := DevicePluginConfig(cfg)
+		if err != nil {
+			return err
+		}
+		want[filepath.Join(machineDir, DevicePluginConfigPath)] = plugin
+	}
+	for _, iface := range cfg.Interfaces {
+		if iface.Network == nil {
+			continue
+		}
+		network, err := CNIConfig(iface)
+		if err != nil {
+			return err
+		}
+		want[filepath.Join(machineDir, CNIConfigDir, cniConfigPrefix+iface.Network.Name+".conf")] = network
+	}
+
+	dir := filepath.Join(machineDir, CNIConfigDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("list %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if _, ok := want[path]; ok || !strings.HasPrefix(entry.Name(), cniConfigPrefix) {
+			continue
+		}
+		before := audit.HashFile(path)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("remove stale CNI config %s: %w", path, err)
+		}
+		audit.Record(ctx, log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: before, Detail: "SR-IOV CNI config"})
+	}
+
+	for path, content := range want {
+		current, err := os.ReadFile(path) //#nosec G304 -- path inside the machine
+		if err == nil && bytes.Equal(current, content) {
+			continue
+		}
+		before := audit.HashFile(path)
+		if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // read by the device plugin and Multus
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		audit.Record(ctx, log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content), Detail: "SR-IOV device plugin and CNI config"})
+	}
+	return nil
+}
+
+type writeMachineConfigTask struct {
+	log        *slog.Logger
+	cfg        config.SRIOVConfig
+	machineDir string
+}
+
+// WriteMachine returns a task that writes the SR-IOV device plugin config
+// and the CNI configs into the machine at machineDir.
+func WriteMachine(log *slog.Logger, cfg *config.Config, machineDir string) phases.Task {
+	return &writeMachineConfigTask{log: log, cfg: cfg.SRIOV, machineDir: machineDir}
+}
+
+func (t *writeMachineConfigTask) Name() string { return "write-sriov-config" }
+
+// Plan returns the device plugin config and the CNI configs of t.cfg.
+func (t *writeMachineConfigTask) Plan() []string {
+	var paths []string
+	if t.cfg.Enabled() {
+		paths = append(paths, filepath.Join(t.machineDir, DevicePluginConfigPath))
+	}
+	for _, iface := range t.cfg.Interfaces {
+		if iface.Network != nil {
+			paths = append(paths, filepath.Join(t.machineDir, CNIConfigDir, cniConfigPrefix+iface.Network.Name+".conf"))
+		}
+	}
+	return paths
+}
+
+func (t *writeMachineConfigTask) Do(ctx context.Context) error {
+	return WriteMachineConfig(ctx, t.log, t.cfg, t.machineDir)
+}
@@ -0,0 +1,47 @@
+package sriov
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+const checkName = "sriov"
+
+// Preflight returns the SR-IOV check, or nil without SR-IOV config.
+func Preflight(log *slog.Logger, cfg *config.Config) []preflight.Checker {
+	if !cfg.SRIOV.Enabled() {
+		return nil
+	}
+	return []preflight.Checker{sriovChecker{cfg: cfg.SRIOV, host: NewHost(log, utilhost.HostRoot)}}
+}
+
+type sriovChecker struct {
+	cfg  config.SRIOVConfig
+	host *Host
+}
+
+func (sriovChecker) Name() string { return checkName }
+
+func (c sriovChecker) Check(context.Context) []preflight.Result {
+	var results []preflight.Result
+	for _, iface := range c.cfg.Interfaces {
+		nic, err := c.host.NIC(iface.Name)
+		switch {
+		case err != nil:
+			results = append(results, preflight.ResultsError(checkName, iface.Name, "%v", err)...)
+		case iface.NumVFs > nic.TotalVFs:
+			results = append(results, preflight.ResultsError(checkName, iface.Name,
+				"%s supports %d virtual functions, %d configured", iface.Name, nic.TotalVFs, iface.NumVFs)...)
+		default:
+			results = append(results, preflight.ResultsOK(checkName, iface.Name,
+				fmt.Sprintf("%s supports %d virtual functions", iface.Name, nic.TotalVFs))...)
+		}
+	}
+	return results
+}
@@ -0,0 +1,415 @@
+// Package sriov creates SR-IOV virtual functions on the host's NICs, binds
+// them to the configured driver, writes the SR-IOV device plugin config and
+// the Multus CNI configs into the nspawn machine, and removes the virtual
+// functions again on reset.
+package sriov
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/phases"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+// RecordPath lists the physical functions the agent created virtual
+// functions on, so reset removes exactly those.
+const RecordPath = config.ConfigDir + "/sriov-interfaces.json"
+
+const (
+	classNetDir     = "sys/class/net"
+	pciDriversDir   = "sys/bus/pci/drivers"
+	pciDriversProbe = "sys/bus/pci/drivers_probe"
+	vfioDevDir      = "dev/vfio"
+
+	// vfioDriver exposes a virtual function to user space, such as DPDK,
+	// instead of as a network interface.
+	vfioDriver = "vfio-pci"
+)
+
+// NIC is an SR-IOV capable physical function.
+type NIC struct {
+	Name       string `json:"name"`
+	PCIAddress string `json:"pciAddress"`
+	TotalVFs   int    `json:"totalVFs"`
+	NumVFs     int    `json:"numVFs"`
+	VFs        []VF   `json:"vfs,omitempty"`
+}
+
+// VF is a virtual function of a NIC.
+type VF struct {
+	PCIAddress string `json:"pciAddress"`
+	// Driver is "" when no driver is bound.
+	Driver string `json:"driver,omitempty"`
+	// Netdev is the network interface of a VF bound to a kernel network
+	// driver.
+	Netdev string `json:"netdev,omitempty"`
+	// IOMMUGroup is the group whose /dev/vfio node a VF bound to vfio-pci
+	// is opened through.
+	IOMMUGroup string `json:"iommuGroup,omitempty"`
+}
+
+// Record is the persisted list of physical functions with agent-created
+// virtual functions.
+type Record struct {
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+// Host reads and changes the host's PCI devices under root.
+type Host struct {
+	log        *slog.Logger
+	root       utilhost.Root
+	recordPath string
+	modprobe   func(ctx context.Context, module string) error
+}
+
+// NewHost returns a Host for the host under root.
+func NewHost(log *slog.Logger, root utilhost.Root) *Host {
+	return &Host{
+		log:        log,
+		root:       root,
+		recordPath: root.Path(RecordPath),
+		modprobe: func(ctx context.Context, module string) error {
+			_, err := root.Output(ctx, log, "modprobe", module)
+			return err
+		},
+	}
+}
+
+func (h *Host) path(rel string) string {
+	return h.root.Path(rel)
+}
+
+// Detect returns the host's SR-IOV capable NICs, sorted by name.
+func (h *Host) Detect() ([]NIC, error) {
+	entries, err := os.ReadDir(h.path(classNetDir))
+	if err != nil {
+		return nil, fmt.Errorf("list network interfaces: %w", err)
+	}
+	var nics []NIC
+	for _, entry := range entries {
+		if !utilio.FileExists(h.path(filepath.Join(classNetDir, entry.Name(), "device", "sriov_totalvfs"))) {
+			continue
+		}
+		nic, err := h.NIC(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		nics = append(nics, nic)
+	}
+	return nics, nil
+}
+
+// NIC returns the SR-IOV state of the named physical function.
+func (h *Host) NIC(name string) (NIC, error) {
+	device := h.path(filepath.Join(classNetDir, name, "device"))
+	if _, err := os.Stat(device); err != nil {
+		return NIC{}, fmt.Errorf("network interface %s has no PCI device: %w", name, err)
+	}
+	total, err := readInt(filepath.Join(device, "sriov_totalvfs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return NIC{}, fmt.Errorf("network interface %s does not support SR-IOV", name)
+	}
+	if err != nil {
+		return NIC{}, err
+	}
+	num, err := readInt(filepath.Join(device, "sriov_numvfs"))
+	if err != nil {
+		return NIC{}, err
+	}
+	nic := NIC{Name: name, PCIAddress: pciAddress(device), TotalVFs: total, NumVFs: num}
+	for i := range num {
+		vfDevice := filepath.Join(device, "virtfn"+strconv.Itoa(i))
+		if _, err := os.Stat(vfDevice); err != nil {
+			// The kernel creates the links as the VFs probe; a
+			// missing one is reported by Validate.
+			continue
+		}
+		vf := VF{PCIAddress: pciAddress(vfDevice), Driver: linkBase(filepath.Join(vfDevice, "driver"))}
+		if netdevs, err := os.ReadDir(filepath.Join(vfDevice, "net")); err == nil && len(netdevs) > 0 {
+			vf.Netdev = netdevs[0].Name()
+		}
+		vf.IOMMUGroup = linkBase(filepath.Join(vfDevice, "iommu_group"))
+		nic.VFs = append(nic.VFs, vf)
+	}
+	return nic, nil
+}
+
+// Apply creates the configured number of virtual functions on each
+// interface and binds them to the configured driver. Interfaces a previous
+// config set up that are no longer configured get their virtual functions
+// removed.
+func (h *Host) Apply(ctx context.Context, cfg config.SRIOVConfig) error {
+	record, err := loadRecord(h.recordPath)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, name := range record.Interfaces {
+		if !slices.ContainsFunc(cfg.Interfaces, func(iface config.SRIOVInterfaceConfig) bool { return iface.Name == name }) {
+			stale = append(stale, name)
+		}
+	}
+	if err := h.Remove(ctx, stale); err != nil {
+		return err
+	}
+
+	// Record before acting: removing virtual functions that were never
+	// created is harmless, while unrecorded ones would outlive reset.
+	record.Interfaces = nil
+	for _, iface := range cfg.Interfaces {
+		record.Interfaces = append(record.Interfaces, iface.Name)
+	}
+	if err := saveRecord(h.recordPath, record); err != nil {
+		return err
+	}
+
+	for _, iface := range cfg.Interfaces {
+		if err := h.applyInterface(ctx, iface); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Host) applyInterface(ctx context.Context, iface config.SRIOVInterfaceConfig) error {
+	nic, err := h.NIC(iface.Name)
+	if err != nil {
+		return err
+	}
+	if iface.NumVFs > nic.TotalVFs {
+		return fmt.Errorf("network interface %s supports %d virtual functions, %d configured", iface.Name, nic.TotalVFs, iface.NumVFs)
+	}
+	if nic.NumVFs != iface.NumVFs {
+		h.log.Info("creating SR-IOV virtual functions", "interface", iface.Name, "from", nic.NumVFs, "to", iface.NumVFs)
+		if err := h.setNumVFs(ctx, iface.Name, iface.NumVFs); err != nil {
+			return err
+		}
+		if nic, err = h.NIC(iface.Name); err != nil {
+			return err
+		}
+	}
+	if iface.Driver == "" {
+		return nil
+	}
+	if !utilio.FileExists(h.path(filepath.Join(pciDriversDir, iface.Driver))) {
+		if err := h.modprobe(ctx, iface.Driver); err != nil {
+			return fmt.Errorf("load driver %s: %w", iface.Driver, err)
+		}
+	}
+	for _, vf := range nic.VFs {
+		if vf.Driver == iface.Driver {
+			continue
+		}
+		if err := h.bind(vf, iface.Driver); err != nil {
+			return fmt.Errorf("bind virtual function %s of %s to %s: %w", vf.PCIAddress, iface.Name, iface.Driver, err)
+		}
+	}
+	return nil
+}
+
+// setNumVFs changes the number of virtual functions of a physical function.
+// The kernel only accepts a new count after the old ones were removed.
+func (h *Host) setNumVFs(ctx context.Context, name string, num int) error {
+	path := h.path(filepath.Join(classNetDir, name, "device", "sriov_numvfs"))
+	before := audit.HashFile(path)
+	if num != 0 {
+		if err := writeSysfs(path, "0"); err != nil {
+			return err
+		}
+	}
+	if err := writeSysfs(path, strconv.Itoa(num)); err != nil {
+		return err
+	}
+	audit.Record(ctx, h.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes([]byte(strconv.Itoa(num))), Detail: "SR-IOV virtual functions"})
+	return nil
+}
+
+// bind rebinds a virtual function to driver through driver_override, which
+// also keeps the NIC's VF driver from claiming it back.
+func (h *Host) bind(vf VF, driver string) error {
+	device := h.path(filepath.Join("sys/bus/pci/devices", vf.PCIAddress))
+	if err := writeSysfs(filepath.Join(device, "driver_override"), driver); err != nil {
+		return err
+	}
+	if vf.Driver != "" {
+		if err := writeSysfs(h.path(filepath.Join(pciDriversDir, vf.Driver, "unbind")), vf.PCIAddress); err != nil {
+			return err
+		}
+	}
+	return writeSysfs(h.path(pciDriversProbe), vf.PCIAddress)
+}
+
+// Validate checks that each interface has its virtual functions, bound to
+// the configured driver and visible as a network interface, or as a VFIO
+// device when bound to vfio-pci.
+func (h *Host) Validate(cfg config.SRIOVConfig) error {
+	var errs []error
+	for _, iface := range cfg.Interfaces {
+		nic, err := h.NIC(iface.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(nic.VFs) != iface.NumVFs {
+			errs = append(errs, fmt.Errorf("network interface %s has %d virtual functions, %d configured", iface.Name, len(nic.VFs), iface.NumVFs))
+		}
+		for _, vf := range nic.VFs {
+			switch {
+			case iface.Driver != "" && vf.Driver != iface.Driver:
+				errs = append(errs, fmt.Errorf("virtual function %s of %s is bound to %q, want %s", vf.PCIAddress, iface.Name, vf.Driver, iface.Driver))
+			case vf.Driver == vfioDriver:
+				if vf.IOMMUGroup == "" || !utilio.FileExists(h.path(filepath.Join(vfioDevDir, vf.IOMMUGroup))) {
+					errs = append(errs, fmt.Errorf("virtual function %s of %s has no VFIO device; enable the IOMMU on the kernel command line", vf.PCIAddress, iface.Name))
+				}
+			case vf.Netdev == "":
+				errs = append(errs, fmt.Errorf("virtual function %s of %s has no network interface", vf.PCIAddress, iface.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Remove removes the virtual functions of the named interfaces. Interfaces
+// that no longer exist are skipped.
+func (h *Host) Remove(ctx context.Context, names []string) error {
+	for _, name := range names {
+		nic, err := h.NIC(name)
+		if err != nil {
+			h.log.Warn("skipping removal of SR-IOV virtual functions", "interface", name, "error", err)
+			continue
+		}
+		if nic.NumVFs == 0 {
+			continue
+		}
+		h.log.Info("removing SR-IOV virtual functions", "interface", name, "count", nic.NumVFs)
+		if err := h.setNumVFs(ctx, name, 0); err != nil {
+			return fmt.Errorf("remove virtual functions of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+type configureTask struct {
+	log  *slog.Logger
+	cfg  config.SRIOVConfig
+	host *Host
+}
+
+// Configure returns a task that creates and binds the configured virtual
+// functions and checks they are visible. Without SR-IOV config it removes
+// the virtual functions a previous config created.
+func Configure(log *slog.Logger, cfg *config.Config) phases.Task {
+	return &configureTask{log: log, cfg: cfg.SRIOV, host: NewHost(log, utilhost.HostRoot)}
+}
+
+func (t *configureTask) Name() string { return "configure-sriov" }
+
+// Plan returns the record of configured interfaces, which Apply rewrites on
+// every run so a dropped interface is cleaned up.
+func (t *configureTask) Plan() []string { return []string{RecordPath} }
+
+func (t *configureTask) Do(ctx context.Context) error {
+	if err := t.host.Apply(ctx, t.cfg); err != nil {
+		return err
+	}
+	return t.host.Validate(t.cfg)
+}
+
+type resetTask struct {
+	host *Host
+}
+
+// ResetHost returns a task that removes the virtual functions the agent
+// created. It runs on reset, without the agent config, so it acts on the
+// record alone.
+func ResetHost(log *slog.Logger) phases.Task {
+	return &resetTask{host: NewHost(log, utilhost.HostRoot)}
+}
+
+func (t *resetTask) Name() string { return "reset-sriov" }
+
+func (t *resetTask) Do(ctx context.Context) error {
+	record, err := loadRecord(t.host.recordPath)
+	if err != nil {
+		return err
+	}
+	if err := t.host.Remove(ctx, record.Interfaces); err != nil {
+		return err
+	}
+	if err := os.Remove(t.host.recordPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove SR-IOV record: %w", err)
+	}
+	return nil
+}
+
+func loadRecord(path string) (*Record, error) {
+	record := &Record{}
+	if err := utilio.ReadJSON(path, record); err != nil {
+		return nil, fmt.Errorf("read SR-IOV record: %w", err)
+	}
+	return record, nil
+}
+
+func saveRecord(path string, record *Record) error {
+	if len(record.Interfaces) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove SR-IOV record: %w", err)
+		}
+		return nil
+	}
+	if err := utilio.WriteJSON(path, record, 0o600); err != nil {
+		return fmt.Errorf("write SR-IOV record: %w", err)
+	}
+	return nil
+}
+
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path) //#nosec G304 -- sysfs path under the host root
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", path, err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// writeSysfs writes an attribute in place; sysfs attributes cannot be
+// replaced by renaming a temporary file over them.
+func writeSysfs(path, value string) error {
+	if err := os.WriteFile(path, []byte(value), 0o200); err != nil { //nolint:gosec // sysfs attribute
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// pciAddress returns the PCI address a sysfs device link points to.
+func pciAddress(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		return filepath.Base(resolved)
+	}
+	return ""
+}
+
+// linkBase returns the last element of a symlink's target, or "" when the
+// link does not exist.
+func linkBase(link string) string {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
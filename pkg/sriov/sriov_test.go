@@ -0,0 +1,252 @@
+package sriov
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilhost"
+)
+
+const pfAddress = "0000:3b:00.0"
+
+// fakeHost builds a sysfs tree with one SR-IOV physical function ens1f0
+// that supports eight virtual functions and has numVFs of them, bound to
+// driver.
+func fakeHost(t *testing.T, numVFs int, driver string) *Host {
+	t.Helper()
+	root := t.TempDir()
+	h := &Host{
+		log:        slog.New(slog.DiscardHandler),
+		root:       utilhost.Root(root),
+		recordPath: filepath.Join(root, "sriov-interfaces.json"),
+		modprobe:   func(context.Context, string) error { return nil },
+	}
+	pf := h.path(filepath.Join("sys/bus/pci/devices", pfAddress))
+	mustWrite(t, filepath.Join(pf, "sriov_totalvfs"), "8\n")
+	mustWrite(t, filepath.Join(pf, "sriov_numvfs"), strconv.Itoa(numVFs)+"\n")
+	mustSymlink(t, pf, h.path(filepath.Join(classNetDir, "ens1f0", "device")))
+	mustWrite(t, h.path(pciDriversProbe), "")
+	for i := range numVFs {
+		address := "0000:3b:02." + strconv.Itoa(i)
+		vf := h.path(filepath.Join("sys/bus/pci/devices", address))
+		mustWrite(t, filepath.Join(vf, "driver_override"), "")
+		mustSymlink(t, vf, filepath.Join(pf, "virtfn"+strconv.Itoa(i)))
+		mustSymlink(t, h.path("sys/kernel/iommu_groups/"+strconv.Itoa(40+i)), filepath.Join(vf, "iommu_group"))
+		if driver != "" {
+			mustWrite(t, h.path(filepath.Join(pciDriversDir, driver, "unbind")), "")
+			mustSymlink(t, h.path(filepath.Join(pciDriversDir, driver)), filepath.Join(vf, "driver"))
+		}
+		if driver == vfioDriver {
+			mustWrite(t, h.path(filepath.Join(vfioDevDir, strconv.Itoa(40+i))), "")
+		} else if driver != "" {
+			if err := os.MkdirAll(filepath.Join(vf, "net", "ens1f0v"+strconv.Itoa(i)), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return h
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	h := fakeHost(t, 2, "iavf")
+	// A NIC without SR-IOV is not listed.
+	mustWrite(t, h.path(filepath.Join(classNetDir, "eth0", "device", "vendor")), "0x8086\n")
+
+	nics, err := h.Detect()
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	if len(nics) != 1 {
+		t.Fatalf("Detect() = %+v, want one NIC", nics)
+	}
+	nic := nics[0]
+	if nic.Name != "ens1f0" || nic.PCIAddress != pfAddress || nic.TotalVFs != 8 || nic.NumVFs != 2 || len(nic.VFs) != 2 {
+		t.Errorf("Detect() = %+v", nic)
+	}
+	if vf := nic.VFs[1]; vf.PCIAddress != "0000:3b:02.1" || vf.Driver != "iavf" || vf.Netdev != "ens1f0v1" || vf.IOMMUGroup != "41" {
+		t.Errorf("VF = %+v", vf)
+	}
+}
+
+func TestApplyCreatesVFsAndRecordsInterface(t *testing.T) {
+	t.Parallel()
+
+	h := fakeHost(t, 0, "")
+	cfg := config.SRIOVConfig{Interfaces: []config.SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 4}}}
+	if err := h.Apply(t.Context(), cfg); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := readFile(t, h.path(filepath.Join(classNetDir, "ens1f0", "device", "sriov_numvfs"))); got != "4" {
+		t.Errorf("sriov_numvfs = %q, want 4", got)
+	}
+	record, err := loadRecord(h.recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Interfaces) != 1 || record.Interfaces[0] != "ens1f0" {
+		t.Errorf("record = %+v", record)
+	}
+
+	// Reset removes the recorded virtual functions and the record.
+	if err := (&resetTask{host: h}).Do(t.Context()); err != nil {
+		t.Fatalf("reset error = %v", err)
+	}
+	if got := readFile(t, h.path(filepath.Join(classNetDir, "ens1f0", "device", "sriov_numvfs"))); got != "0" {
+		t.Errorf("sriov_numvfs after reset = %q, want 0", got)
+	}
+	if _, err := os.Stat(h.recordPath); !os.IsNotExist(err) {
+		t.Errorf("record still exists: %v", err)
+	}
+}
+
+func TestApplyRejectsTooManyVFs(t *testing.T) {
+	t.Parallel()
+
+	h := fakeHost(t, 0, "")
+	cfg := config.SRIOVConfig{Interfaces: []config.SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 16}}}
+	if err := h.Apply(t.Context(), cfg); err == nil || !strings.Contains(err.Error(), "supports 8") {
+		t.Fatalf("Apply() = %v, want too many VFs error", err)
+	}
+}
+
+func TestApplyBindsDriver(t *testing.T) {
+	t.Parallel()
+
+	h := fakeHost(t, 2, "iavf")
+	var loaded []string
+	h.modprobe = func(_ context.Context, module string) error {
+		loaded = append(loaded, module)
+		return nil
+	}
+	cfg := config.SRIOVConfig{Interfaces: []config.SRIOVInterfaceConfig{{Name: "ens1f0", NumVFs: 2, Driver: vfioDriver}}}
+	if err := h.Apply(t.Context(), cfg); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(loaded) != 1 || loaded[0] != vfioDriver {
+		t.Errorf("modprobe loaded %v, want vfio-pci", loaded)
+	}
+	if got := readFile(t, h.path("sys/bus/pci/devices/0000:3b:02.1/driver_override")); got != vfioDriver {
+		t.Errorf("driver_override = %q, want vfio-pci", got)
+	}
+	if got := readFile(t, h.path(filepath.Join(pciDriversDir, "iavf", "unbind"))); got != "0000:3b:02.1" {
+		t.Errorf("unbind = %q, want the last VF", got)
+	}
+	if got := readFile(t, h.path(pciDriversProbe)); got != "0000:3b:02.1" {
+		t.Errorf("drivers_probe = %q, want the last VF", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		driver  string
+		iface   config.SRIOVInterfaceConfig
+		wantErr string
+	}{
+		{name: "netdev", driver: "iavf", iface: config.SRIOVInterfaceConfig{Name: "ens1f0", NumVFs: 2}},
+		{name: "vfio", driver: vfioDriver, iface: config.SRIOVInterfaceConfig{Name: "ens1f0", NumVFs: 2, Driver: vfioDriver}},
+		{name: "missing VFs", driver: "iavf", iface: config.SRIOVInterfaceConfig{Name: "ens1f0", NumVFs: 4}, wantErr: "has 2 virtual functions, 4 configured"},
+		{name: "wrong driver", driver: "iavf", iface: config.SRIOVInterfaceConfig{Name: "ens1f0", NumVFs: 2, Driver: vfioDriver}, wantErr: `bound to "iavf"`},
+		{name: "unbound", iface: config.SRIOVInterfaceConfig{Name: "ens1f0", NumVFs: 2}, wantErr: "no network interface"},
+		{name: "unknown interface", driver: "iavf", iface: config.SRIOVInterfaceConfig{Name: "ens9", NumVFs: 2}, wantErr: "no PCI device"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := fakeHost(t, 2, tt.driver)
+			err := h.Validate(config.SRIOVConfig{Interfaces: []config.SRIOVInterfaceConfig{tt.iface}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteMachineConfig(t *testing.T) {
+	t.Parallel()
+
+	machineDir := t.TempDir()
+	stale := filepath.Join(machineDir, CNIConfigDir, cniConfigPrefix+"old.conf")
+	operator := filepath.Join(machineDir, CNIConfigDir, "operator.conf")
+	mustWrite(t, stale, "{}")
+	mustWrite(t, operator, "{}")
+
+	cfg := config.SRIOVConfig{Interfaces: []config.SRIOVInterfaceConfig{
+		{Name: "ens1f0", NumVFs: 4, Network: &config.SRIOVNetworkConfig{Name: "fronthaul", VLAN: 100, IPAM: json.RawMessage(`{"type":"host-local","subnet":"10.10.0.0/24"}`)}},
+		{Name: "ens1f1", NumVFs: 2, Driver: vfioDriver, ResourceName: "dpdk"},
+	}}
+	if err := WriteMachineConfig(t.Context(), slog.New(slog.DiscardHandler), cfg, machineDir); err != nil {
+		t.Fatalf("WriteMachineConfig() error = %v", err)
+	}
+
+	var plugin devicePluginConfig
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(machineDir, DevicePluginConfigPath))), &plugin); err != nil {
+		t.Fatal(err)
+	}
+	if len(plugin.ResourceList) != 2 ||
+		plugin.ResourceList[0].ResourceName != "sriov_ens1f0" || plugin.ResourceList[0].Selectors.PFNames[0] != "ens1f0" ||
+		plugin.ResourceList[1].ResourceName != "dpdk" || plugin.ResourceList[1].Selectors.Drivers[0] != vfioDriver ||
+		plugin.ResourceList[1].ResourcePrefix != config.SRIOVResourcePrefix {
+		t.Errorf("device plugin config = %+v", plugin)
+	}
+
+	var network map[string]any
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(machineDir, CNIConfigDir, cniConfigPrefix+"fronthaul.conf"))), &network); err != nil {
+		t.Fatal(err)
+	}
+	if network["name"] != "fronthaul" || network["type"] != "sriov" || network["vlan"] != float64(100) || network["ipam"].(map[string]any)["type"] != "host-local" {
+		t.Errorf("CNI config = %v", network)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale CNI config still exists: %v", err)
+	}
+	if _, err := os.Stat(operator); err != nil {
+		t.Errorf("operator CNI config was removed: %v", err)
+	}
+}
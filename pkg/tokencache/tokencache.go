@@ -0,0 +1,321 @@
+// Package tokencache shares the Azure access tokens the agent's components
+// request, so a token is acquired once per identity and scope instead of once
+// per client, and is renewed well before it expires.
+//
+// A cached token is served until RefreshFraction of its lifetime has passed.
+// The next request after that acquires a new one; when the acquisition fails,
+// the cached token keeps being served until it is about to expire, so a brief
+// Microsoft Entra outage does not fail a long operation midway. A cache with
+// a path persists its tokens in a file only root can read, so a restarted
+// agent does not have to reach Entra before it can call ARM.
+package tokencache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+)
+
+const (
+	// RefreshFraction is the share of a token's lifetime after which it is
+	// renewed.
+	RefreshFraction = 0.8
+
+	// FileName is the cache under the instance's state root.
+	FileName = "token-cache"
+
+	// expiryMargin is how long before its expiry a token is no longer
+	// served, leaving time for the request that carries it.
+	expiryMargin = 2 * time.Minute
+
+	fileMode = 0o600
+)
+
+// Outcomes of a token request.
+const (
+	OutcomeCached   = "cached"
+	OutcomeAcquired = "acquired"
+	OutcomeFailed   = "failed"
+)
+
+var tokenRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "aks_flex_node_azure_token_requests_total",
+	Help: "Azure access token requests by credential and outcome: cached, acquired, or failed to acquire.",
+}, []string{"credential", "outcome"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(tokenRequestsTotal)
+}
+
+// Cache holds access tokens by credential, tenant, and scopes.
+type Cache struct {
+	log  *slog.Logger
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// saveMu orders writes of the cache file.
+	saveMu sync.Mutex
+}
+
+// entry is one cached token. Its exported fields are persisted and guarded by
+// Cache.mu; acquire serializes the acquisitions of the entry's token.
+type entry struct {
+	Credential string    `json:"credential"`
+	Identity   string    `json:"identity"`
+	TenantID   string    `json:"tenantId,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	Token      string    `json:"token"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresOn  time.Time `json:"expiresOn"`
+
+	acquire sync.Mutex
+	// source acquires the entry's token. Entries loaded from the cache file
+	// have none until their credential requests a token.
+	source azcore.TokenCredential
+}
+
+// key identifies the entry's token: a credential, the principal it
+// authenticates as, and the tenant and sorted scopes requested.
+func (e *entry) key() string {
+	return strings.Join([]string{e.Credential, e.Identity, e.TenantID, strings.Join(e.Scopes, " ")}, "|")
+}
+
+func (e *entry) refreshAt() time.Time {
+	lifetime := e.ExpiresOn.Sub(e.AcquiredAt)
+	return e.AcquiredAt.Add(time.Duration(float64(lifetime) * RefreshFraction))
+}
+
+func (e *entry) usable(now time.Time) bool {
+	return e.Token != "" && now.Before(e.ExpiresOn.Add(-expiryMargin))
+}
+
+func (e *entry) persisted() bool {
+	return e.Identity != "" && e.Token != ""
+}
+
+// New returns a cache persisted in dir, or kept in memory only when dir is
+// empty. Tokens persisted by an earlier run are loaded; a cache file that
+// cannot be read is logged and ignored.
+func New(log *slog.Logger, dir string) *Cache {
+	return newCache(log, dir, time.Now)
+}
+
+func newCache(log *slog.Logger, dir string, now func() time.Time) *Cache {
+	c := &Cache{log: log, now: now, entries: map[string]*entry{}}
+	if dir == "" {
+		return c
+	}
+	c.path = filepath.Join(dir, FileName)
+	if err := c.load(); err != nil {
+		log.Warn("ignoring persisted Azure token cache", "path", c.path, "error", err)
+	}
+	return c
+}
+
+var (
+	defaultMu    sync.RWMutex
+	defaultCache = New(slog.Default(), "")
+)
+
+// SetDefault installs the process-wide cache the agent's credentials use.
+// The daemon installs a persisted one; other commands keep the in-memory
+// default.
+func SetDefault(c *Cache) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultCache = c
+}
+
+// Default returns the process-wide cache installed by SetDefault.
+func Default() *Cache {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultCache
+}
+
+type freshKey struct{}
+
+// Fresh returns a context whose token requests skip the cached token. The
+// new token replaces it. Callers that track expiry themselves, like the
+// kubelet token rotation, use it so they are not handed a token they already
+// decided to replace.
+func Fresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+// Wrap returns a credential that serves source's tokens from the cache.
+// credential names the authentication method in metrics and logs; identity
+// tells apart the principals a method can authenticate as, such as the
+// client ID. Tokens of a credential without a fixed identity, like a chain
+// that tries several, are not persisted, since the next run may resolve to
+// another principal.
+func (c *Cache) Wrap(credential, identity string, source azcore.TokenCredential) azcore.TokenCredential {
+	return &cachedCredential{cache: c, credential: credential, identity: identity, source: source}
+}
+
+type cachedCredential struct {
+	cache      *Cache
+	credential string
+	identity   string
+	source     azcore.TokenCredential
+}
+
+func (c *cachedCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	// A claims challenge asks for a token the cached one is not.
+	if opts.Claims != "" {
+		token, err := c.source.GetToken(ctx, opts)
+		c.cache.count(c.credential, err)
+		return token, err
+	}
+	return c.cache.token(ctx, c.entry(opts), opts, isFresh(ctx))
+}
+
+func (c *cachedCredential) entry(opts policy.TokenRequestOptions) *entry {
+	want := &entry{Credential: c.credential, Identity: c.identity, TenantID: opts.TenantID, Scopes: slices.Sorted(slices.Values(opts.Scopes))}
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	e, ok := c.cache.entries[want.key()]
+	if !ok {
+		e = want
+		c.cache.entries[e.key()] = e
+	}
+	e.source = c.source
+	return e
+}
+
+func (c *Cache) token(ctx context.Context, e *entry, opts policy.TokenRequestOptions, fresh bool) (azcore.AccessToken, error) {
+	e.acquire.Lock()
+	defer e.acquire.Unlock()
+
+	c.mu.Lock()
+	now := c.now()
+	cached := azcore.AccessToken{Token: e.Token, ExpiresOn: e.ExpiresOn}
+	current := !fresh && e.usable(now) && now.Before(e.refreshAt())
+	usable := e.usable(now)
+	source := e.source
+	c.mu.Unlock()
+	if current {
+		tokenRequestsTotal.WithLabelValues(e.Credential, OutcomeCached).Inc()
+		return cached, nil
+	}
+
+	token, err := source.GetToken(ctx, opts)
+	c.count(e.Credential, err)
+	if err != nil {
+		if usable && !fresh {
+			c.log.Warn("failed to renew Azure token, using the cached one until it expires",
+				"credential", e.Credential, "expiresOn", cached.ExpiresOn, "error", err)
+			return cached, nil
+		}
+		return azcore.AccessToken{}, err
+	}
+
+	c.mu.Lock()
+	e.Token = token.Token
+	e.AcquiredAt = now
+	e.ExpiresOn = token.ExpiresOn
+	persist := e.persisted()
+	c.mu.Unlock()
+	if persist {
+		if err := c.save(); err != nil {
+			c.log.Warn("failed to persist Azure token cache", "path", c.path, "error", err)
+		}
+	}
+	return token, nil
+}
+
+func (c *Cache) count(credential string, err error) {
+	outcome := OutcomeAcquired
+	if err != nil {
+		outcome = OutcomeFailed
+	}
+	tokenRequestsTotal.WithLabelValues(credential, outcome).Inc()
+}
+
+// Refresh renews the tokens past their refresh point, so the components
+// using them find a current token instead of waiting for one. Tokens no
+// credential requested since the agent started are left alone.
+func (c *Cache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	now := c.now()
+	var due []*entry
+	for _, e := range c.entries {
+		if e.source != nil && e.Token != "" && !now.Before(e.refreshAt()) {
+			due = append(due, e)
+		}
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, e := range due {
+		opts := policy.TokenRequestOptions{Scopes: e.Scopes, TenantID: e.TenantID}
+		if _, err := c.token(ctx, e, opts, false); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", e.Credential, strings.Join(e.Scopes, " "), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	now := c.now()
+	var entries []*entry
+	for _, e := range c.entries {
+		if e.persisted() && e.usable(now) {
+			entries = append(entries, e)
+		}
+	}
+	data, err := json.Marshal(entries)
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshal token cache: %w", err)
+	}
+	// The tokens are stored in plain text. Only root can read the file, and
+	// a key kept beside it would protect nothing from a reader who can.
+	if err := utilio.WriteFile(c.path, data, fileMode); err != nil {
+		return fmt.Errorf("write token cache %s: %w", c.path, err)
+	}
+	return nil
+}
+
+func (c *Cache) load() error {
+	var entries []*entry
+	if err := utilio.ReadJSON(c.path, &entries); err != nil {
+		return fmt.Errorf("read token cache: %w", err)
+	}
+	now := c.now()
+	for _, e := range entries {
+		if !e.persisted() || !e.usable(now) {
+			continue
+		}
+		c.entries[e.key()] = e
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package tokencache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+var armScope = policy.TokenRequestOptions{Scopes: []string{"https://management.azure.com/.default"}}
+
+// fakeSource issues numbered tokens valid for lifetime from now(), or fails
+// with err.
+type fakeSource struct {
+	now      func() time.Time
+	lifetime time.Duration
+	err      error
+	issued   int
+}
+
+func (f *fakeSource) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if f.err != nil {
+		return azcore.AccessToken{}, f.err
+	}
+	f.issued++
+	return azcore.AccessToken{Token: fmt.Sprintf("token-%d", f.issued), ExpiresOn: f.now().Add(f.lifetime)}, nil
+}
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func testCache(dir string, clock *testClock) *Cache {
+	return newCache(slog.New(slog.DiscardHandler), dir, clock.Now)
+}
+
+func getToken(t *testing.T, ctx context.Context, cred azcore.TokenCredential) string {
+	t.Helper()
+	token, err := cred.GetToken(ctx, armScope)
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	return token.Token
+}
+
+func TestCacheRenewsAtRefreshFraction(t *testing.T) {
+	t.Parallel()
+
+	clock := &testClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	source := &fakeSource{now: clock.Now, lifetime: time.Hour}
+	cache := testCache("", clock)
+	cred := cache.Wrap("service-principal", "tenant/client", source)
+	other := cache.Wrap("service-principal", "tenant/client", source)
+
+	if got := getToken(t, t.Context(), cred); got != "token-1" {
+		t.Fatalf("first token = %q", got)
+	}
+	clock.now = clock.now.Add(47 * time.Minute)
+	if got := getToken(t, t.Context(), other); got != "token-1" {
+		t.Fatalf("token before the refresh point = %q, want the cached token-1 shared across credentials", got)
+	}
+	clock.now = clock.now.Add(2 * time.Minute)
+	if got := getToken(t, t.Context(), cred); got != "token-2" {
+		t.Fatalf("token past the refresh point = %q, want token-2", got)
+	}
+	if got := getToken(t, Fresh(t.Context()), cred); got != "token-3" {
+		t.Fatalf("fresh token = %q, want token-3", got)
+	}
+	if got := getToken(t, t.Context(), cache.Wrap("service-principal", "tenant/other", source)); got != "token-4" {
+		t.Fatalf("token of another identity = %q, want token-4", got)
+	}
+}
+
+func TestCacheServesCachedTokenWhenRenewalFails(t *testing.T) {
+	t.Parallel()
+
+	clock := &testClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	source := &fakeSource{now: clock.Now, lifetime: time.Hour}
+	cache := testCache("", clock)
+	cred := cache.Wrap("workload-identity", "tenant/client", source)
+	getToken(t, t.Context(), cred)
+
+	source.err = errors.New("entra unavailable")
+	clock.now = clock.now.Add(50 * time.Minute)
+	if got := getToken(t, t.Context(), cred); got != "token-1" {
+		t.Fatalf("token while renewal fails = %q, want the cached token-1", got)
+	}
+	if err := cache.Refresh(t.Context()); err != nil {
+		t.Fatalf("Refresh with a usable cached token: %v", err)
+	}
+	if _, err := cred.GetToken(Fresh(t.Context()), armScope); err == nil {
+		t.Fatal("fresh GetToken succeeded, want the renewal error")
+	}
+	clock.now = clock.now.Add(9 * time.Minute)
+	if _, err := cred.GetToken(t.Context(), armScope); err == nil {
+		t.Fatal("GetToken near expiry succeeded, want the renewal error")
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	t.Parallel()
+
+	clock := &testClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	source := &fakeSource{now: clock.Now, lifetime: time.Hour}
+	cache := testCache("", clock)
+	cred := cache.Wrap("managed-identity", "system", source)
+	getToken(t, t.Context(), cred)
+
+	if err := cache.Refresh(t.Context()); err != nil || source.issued != 1 {
+		t.Fatalf("Refresh before the refresh point: err = %v, issued = %d", err, source.issued)
+	}
+	clock.now = clock.now.Add(48 * time.Minute)
+	if err := cache.Refresh(t.Context()); err != nil || source.issued != 2 {
+		t.Fatalf("Refresh at the refresh point: err = %v, issued = %d", err, source.issued)
+	}
+	if got := getToken(t, t.Context(), cred); got != "token-2" {
+		t.Fatalf("token after Refresh = %q, want token-2", got)
+	}
+}
+
+func TestCachePersists(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	clock := &testClock{now: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	source := &fakeSource{now: clock.Now, lifetime: time.Hour}
+	cache := testCache(dir, clock)
+	getToken(t, t.Context(), cache.Wrap("service-principal", "tenant/client", source))
+	getToken(t, t.Context(), cache.Wrap("default", "", source))
+
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != fileMode {
+		t.Errorf("cache mode = %v, want %v", info.Mode().Perm(), os.FileMode(fileMode))
+	}
+
+	// A restarted agent serves the persisted token without acquiring one,
+	// except for the default chain, whose identity is not fixed.
+	clock.now = clock.now.Add(10 * time.Minute)
+	restarted := testCache(dir, clock)
+	source = &fakeSource{now: clock.Now, lifetime: time.Hour}
+	if got := getToken(t, t.Context(), restarted.Wrap("service-principal", "tenant/client", source)); got != "token-1" {
+		t.Fatalf("token after restart = %q, want the persisted token-1", got)
+	}
+	if getToken(t, t.Context(), restarted.Wrap("default", "", source)); source.issued != 1 {
+		t.Fatalf("issued = %d, want the default chain's token acquired again", source.issued)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte("not json"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if corrupt := testCache(dir, clock); len(corrupt.entries) != 0 {
+		t.Fatalf("entries from a corrupt cache = %d, want the cache ignored", len(corrupt.entries))
+	}
+}
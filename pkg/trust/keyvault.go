@@ -0,0 +1,82 @@
+package trust
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/httpclient"
+)
+
+const (
+	keyVaultAPIVersion = "7.4"
+	pkcs12ContentType  = "application/x-pkcs12"
+)
+
+type keyVaultReader struct {
+	cred   azcore.TokenCredential
+	client *http.Client
+}
+
+// NewKeyVaultReader returns a SecretReader that calls the Key Vault REST API
+// with cred.
+func NewKeyVaultReader(cred azcore.TokenCredential) SecretReader {
+	return &keyVaultReader{cred: cred, client: httpclient.New("key-vault", httpclient.KindRequest)}
+}
+
+func (r *keyVaultReader) GetSecret(ctx context.Context, secret *config.KeyVaultSecretConfig) (string, error) {
+	vault, err := url.Parse(secret.VaultURL)
+	if err != nil {
+		return "", fmt.Errorf("parse vault URL: %w", err)
+	}
+	token, err := r.cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{keyVaultScope(vault.Hostname())}})
+	if err != nil {
+		return "", fmt.Errorf("get Key Vault token: %w", err)
+	}
+
+	path := "/secrets/" + url.PathEscape(secret.SecretName)
+	if secret.Version != "" {
+		path += "/" + url.PathEscape(secret.Version)
+	}
+	endpoint := strings.TrimRight(secret.VaultURL, "/") + path + "?api-version=" + keyVaultAPIVersion
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("get secret %s: %w", secret.SecretName, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // response body
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("get secret %s: %s: %s", secret.SecretName, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var body struct {
+		Value       string `json:"value"`
+		ContentType string `json:"contentType"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode secret %s: %w", secret.SecretName, err)
+	}
+	if body.ContentType == pkcs12ContentType {
+		return "", fmt.Errorf("secret %s is a PKCS#12 certificate; store the CA with the PEM content type", secret.SecretName)
+	}
+	return body.Value, nil
+}
+
+// keyVaultScope returns the token scope of the cloud the vault at host is
+// in: contoso.vault.azure.net is in https://vault.azure.net.
+func keyVaultScope(host string) string {
+	_, suffix, _ := strings.Cut(host, ".")
+	return "https://" + suffix + "/.default"
+}
@@ -0,0 +1,336 @@
+// Package trust distributes enterprise CA bundles into the nspawn machine's
+// OS trust store and containerd's registry host configs, and reads back the
+// distributed certificates so their expiry can be tracked.
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/aksmachine"
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const (
+	// CertDir holds the distributed certificates inside the machine, under
+	// the directory update-ca-certificates reads local CAs from. The agent
+	// owns every file in it.
+	CertDir = "/usr/local/share/ca-certificates/aks-flex-node"
+
+	// containerdCertsDir is the config_path containerd reads registry
+	// hosts.toml files from.
+	containerdCertsDir = "/etc/containerd/certs.d"
+	// hostsHeader marks the hosts.toml files the agent wrote, so only those
+	// are removed when a registry leaves trust.registries.
+	hostsHeader = "# Managed by aks-flex-node from trust.registries.\n"
+
+	updateCACertificates = "/usr/sbin/update-ca-certificates"
+)
+
+// Certificate is one distributed CA certificate.
+type Certificate struct {
+	Bundle   string    `json:"bundle"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// SecretReader reads a PEM bundle from Key Vault.
+type SecretReader interface {
+	GetSecret(ctx context.Context, secret *config.KeyVaultSecretConfig) (string, error)
+}
+
+// Distributor writes the configured CA bundles into a machine rootfs.
+type Distributor struct {
+	log   *slog.Logger
+	trust config.TrustConfig
+	// newSecrets builds the Key Vault reader the first time a bundle needs
+	// it, so nodes without Key Vault bundles never resolve credentials.
+	newSecrets func() (SecretReader, error)
+	secrets    SecretReader
+	// updateTrust regenerates the machine's trust store.
+	updateTrust func(ctx context.Context, machineDir string) error
+}
+
+// NewDistributor returns a distributor of cfg.Trust that reads Key Vault
+// secrets with the agent's Azure credentials.
+func NewDistributor(log *slog.Logger, cfg *config.Config) *Distributor {
+	return &Distributor{
+		log:   log,
+		trust: cfg.Trust,
+		newSecrets: func() (SecretReader, error) {
+			cred, err := aksmachine.NewCredential(cfg, log)
+			if err != nil {
+				return nil, fmt.Errorf("resolve Key Vault credential: %w", err)
+			}
+			return NewKeyVaultReader(cred), nil
+		},
+		updateTrust: func(ctx context.Context, machineDir string) error {
+			return runUpdateCACertificates(ctx, log, machineDir)
+		},
+	}
+}
+
+// Sync makes the machine at machineDir trust exactly the configured bundles:
+// it writes one file per certificate under CertDir, removes the files of
+// bundles no longer configured, regenerates the trust store when anything
+// changed, and points each configured registry's hosts.toml at the
+// certificates. It reports whether the trust store changed.
+func (d *Distributor) Sync(ctx context.Context, machineDir string) (bool, error) {
+	want := map[string][]byte{}
+	for _, bundle := range d.trust.CABundles {
+		data, err := d.read(ctx, bundle)
+		if err != nil {
+			return false, fmt.Errorf("read CA bundle %s: %w", bundle.Name, err)
+		}
+		certs, err := splitPEM(data)
+		if err != nil {
+			return false, fmt.Errorf("CA bundle %s: %w", bundle.Name, err)
+		}
+		for i, cert := range certs {
+			want[fmt.Sprintf("%s-%d.crt", bundle.Name, i)] = cert
+		}
+	}
+
+	changed, err := d.writeCertificates(ctx, filepath.Join(machineDir, CertDir), want)
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		if err := d.updateTrust(ctx, machineDir); err != nil {
+			return false, err
+		}
+		d.log.Info("updated the machine's trusted CAs", "certificates", len(want))
+	}
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := d.writeRegistryHosts(ctx, filepath.Join(machineDir, containerdCertsDir), names); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+func (d *Distributor) read(ctx context.Context, bundle config.CABundleConfig) ([]byte, error) {
+	switch {
+	case bundle.Path != "":
+		return os.ReadFile(filepath.Clean(bundle.Path))
+	case bundle.Data != "":
+		return []byte(bundle.Data), nil
+	case bundle.KeyVault != nil:
+		if d.secrets == nil {
+			secrets, err := d.newSecrets()
+			if err != nil {
+				return nil, err
+			}
+			d.secrets = secrets
+		}
+		value, err := d.secrets.GetSecret(ctx, bundle.KeyVault)
+		return []byte(value), err
+	default:
+		return nil, fmt.Errorf("no source configured")
+	}
+}
+
+func (d *Distributor) writeCertificates(ctx context.Context, dir string, want map[string][]byte) (bool, error) {
+	changed := false
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if _, ok := want[entry.Name()]; ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		before := audit.HashFile(path)
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("remove stale CA certificate %s: %w", path, err)
+		}
+		audit.Record(ctx, d.log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: before, Detail: "CA certificate"})
+		changed = true
+	}
+	for name, content := range want {
+		path := filepath.Join(dir, name)
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, content) {
+			continue
+		}
+		before := audit.HashFile(path)
+		if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // trust store is world-readable
+			return false, fmt.Errorf("write CA certificate %s: %w", path, err)
+		}
+		audit.Record(ctx, d.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content), Detail: "CA certificate"})
+		changed = true
+	}
+	return changed, nil
+}
+
+func (d *Distributor) writeRegistryHosts(ctx context.Context, certsDir string, certNames []string) error {
+	entries, err := os.ReadDir(certsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read %s: %w", certsDir, err)
+	}
+	for _, entry := range entries {
+		if slices.Contains(d.trust.Registries, entry.Name()) {
+			continue
+		}
+		path := filepath.Join(certsDir, entry.Name(), "hosts.toml")
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.HasPrefix(string(data), hostsHeader) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(certsDir, entry.Name())); err != nil {
+			return fmt.Errorf("remove stale registry hosts %s: %w", path, err)
+		}
+		audit.Record(ctx, d.log, audit.Event{Operation: audit.OperationFileRemove, Target: path, BeforeHash: audit.HashBytes(data), Detail: "containerd registry hosts"})
+	}
+	for _, registry := range d.trust.Registries {
+		path := filepath.Join(certsDir, registry, "hosts.toml")
+		content := []byte(registryHosts(registry, certNames))
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, content) {
+			continue
+		}
+		before := audit.HashFile(path)
+		if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // containerd config is world-readable
+			return fmt.Errorf("write registry hosts %s: %w", path, err)
+		}
+		audit.Record(ctx, d.log, audit.Event{Operation: audit.OperationFileWrite, Target: path, BeforeHash: before, AfterHash: audit.HashBytes(content), Detail: "containerd registry hosts"})
+	}
+	return nil
+}
+
+// registryHosts renders a containerd hosts.toml that trusts the distributed
+// certificates for registry. containerd re-reads it on every pull.
+func registryHosts(registry string, certNames []string) string {
+	var b strings.Builder
+	b.WriteString(hostsHeader)
+	fmt.Fprintf(&b, "server = %q\n\n", "https://"+registry)
+	fmt.Fprintf(&b, "[host.%q]\n", "https://"+registry)
+	b.WriteString("  capabilities = [\"pull\", \"resolve\"]\n")
+	cas := make([]string, 0, len(certNames))
+	for _, name := range certNames {
+		cas = append(cas, fmt.Sprintf("%q", filepath.Join(CertDir, name)))
+	}
+	fmt.Fprintf(&b, "  ca = [%s]\n", strings.Join(cas, ", "))
+	return b.String()
+}
+
+// splitPEM returns each certificate of a PEM bundle re-encoded on its own.
+// Anything other than certificates is rejected so a private key pasted into
+// the wrong field never lands in the trust store.
+func splitPEM(data []byte) ([][]byte, error) {
+	var certs [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %q; only certificates are accepted", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parse certificate: %w", err)
+		}
+		certs = append(certs, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes}))
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificates found")
+	}
+	return certs, nil
+}
+
+// Certificates returns the certificates distributed into the machine at
+// machineDir, in file name order.
+func Certificates(machineDir string) ([]Certificate, error) {
+	dir := filepath.Join(machineDir, CertDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dir, err)
+	}
+	var certs []Certificate
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", entry.Name(), err)
+		}
+		bundle := strings.TrimSuffix(entry.Name(), ".crt")
+		if i := strings.LastIndexByte(bundle, '-'); i > 0 {
+			bundle = bundle[:i]
+		}
+		certs = append(certs, Certificate{Bundle: bundle, Subject: cert.Subject.String(), NotAfter: cert.NotAfter.UTC()})
+	}
+	return certs, nil
+}
+
+// runUpdateCACertificates regenerates the machine's trust store with its own
+// update-ca-certificates, so it works before the machine is started.
+func runUpdateCACertificates(ctx context.Context, log *slog.Logger, machineDir string) error {
+	if _, err := os.Stat(filepath.Join(machineDir, updateCACertificates)); err != nil {
+		return fmt.Errorf("machine rootfs has no %s; install the ca-certificates package in the image: %w", updateCACertificates, err)
+	}
+	if _, err := utilexec.OutputCmd(ctx, log, "chroot", machineDir, updateCACertificates); err != nil {
+		return fmt.Errorf("update-ca-certificates: %w", err)
+	}
+	return nil
+}
+
+type installTask struct {
+	distributor *Distributor
+	machineDir  string
+}
+
+// Install returns a task that syncs the configured CA bundles into the
+// machine at machineDir. It also runs without bundles, to remove the ones a
+// previous config distributed.
+func Install(log *slog.Logger, cfg *config.Config, machineDir string) phases.Task {
+	return &installTask{distributor: NewDistributor(log, cfg), machineDir: machineDir}
+}
+
+func (t *installTask) Name() string { return "install-ca-bundles" }
+
+// Plan returns the certificate directory and the hosts.toml of each trusted
+// registry inside the machine.
+func (t *installTask) Plan() []string {
+	var paths []string
+	if len(t.distributor.trust.CABundles) > 0 {
+		paths = append(paths, filepath.Join(t.machineDir, CertDir))
+	}
+	for _, registry := range t.distributor.trust.Registries {
+		paths = append(paths, filepath.Join(t.machineDir, containerdCertsDir, registry, "hosts.toml"))
+	}
+	return paths
+}
+
+func (t *installTask) Do(ctx context.Context) error {
+	_, err := t.distributor.Sync(ctx, t.machineDir)
+	return err
+}
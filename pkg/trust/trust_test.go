@@ -0,0 +1,130 @@
+package trust
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+func testCA(t *testing.T, name string, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) GetSecret(_ context.Context, secret *config.KeyVaultSecretConfig) (string, error) {
+	return f[secret.SecretName], nil
+}
+
+func TestDistributorSync(t *testing.T) {
+	t.Parallel()
+
+	machineDir := t.TempDir()
+	expiry := time.Now().Add(90 * 24 * time.Hour).UTC().Truncate(time.Second)
+	updates := 0
+	d := &Distributor{
+		log: slog.New(slog.DiscardHandler),
+		trust: config.TrustConfig{
+			CABundles: []config.CABundleConfig{
+				{Name: "corp", Data: testCA(t, "Corp Root", expiry) + testCA(t, "Corp Issuing", expiry)},
+				{Name: "vault", KeyVault: &config.KeyVaultSecretConfig{VaultURL: "https://contoso.vault.azure.net", SecretName: "registry-ca"}},
+			},
+			Registries: []string{"registry.corp.example:5000"},
+		},
+		newSecrets:  func() (SecretReader, error) { return fakeSecrets{"registry-ca": testCA(t, "Registry CA", expiry)}, nil },
+		updateTrust: func(context.Context, string) error { updates++; return nil },
+	}
+
+	changed, err := d.Sync(t.Context(), machineDir)
+	if err != nil || !changed || updates != 1 {
+		t.Fatalf("Sync() = %v, %v with %d trust updates, want a change and one update", changed, err, updates)
+	}
+	certs, err := Certificates(machineDir)
+	if err != nil {
+		t.Fatalf("Certificates() error = %v", err)
+	}
+	if len(certs) != 3 || certs[0].Bundle != "corp" || certs[0].Subject != "CN=Corp Root" || certs[2].Bundle != "vault" || !certs[2].NotAfter.Equal(expiry) {
+		t.Errorf("Certificates() = %+v", certs)
+	}
+	hosts, err := os.ReadFile(filepath.Join(machineDir, containerdCertsDir, "registry.corp.example:5000", "hosts.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`server = "https://registry.corp.example:5000"`, CertDir + "/corp-1.crt", CertDir + "/vault-0.crt"} {
+		if !strings.Contains(string(hosts), want) {
+			t.Errorf("hosts.toml missing %q:\n%s", want, hosts)
+		}
+	}
+
+	if changed, err := d.Sync(t.Context(), machineDir); err != nil || changed || updates != 1 {
+		t.Errorf("second Sync() = %v, %v with %d trust updates, want no change", changed, err, updates)
+	}
+
+	d.trust = config.TrustConfig{}
+	if changed, err := d.Sync(t.Context(), machineDir); err != nil || !changed || updates != 2 {
+		t.Errorf("Sync() without bundles = %v, %v with %d trust updates, want the stale bundles removed", changed, err, updates)
+	}
+	if certs, _ := Certificates(machineDir); len(certs) != 0 {
+		t.Errorf("Certificates() after removal = %+v", certs)
+	}
+	if _, err := os.Stat(filepath.Join(machineDir, containerdCertsDir, "registry.corp.example:5000")); !os.IsNotExist(err) {
+		t.Errorf("stale registry hosts still present: %v", err)
+	}
+}
+
+func TestSplitPEMRejectsKeys(t *testing.T) {
+	t.Parallel()
+
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")}))
+	if _, err := splitPEM([]byte(key)); err == nil || !strings.Contains(err.Error(), "PRIVATE KEY") {
+		t.Errorf("splitPEM(key) error = %v, want it rejected", err)
+	}
+	if _, err := splitPEM([]byte("not pem")); err == nil {
+		t.Error("splitPEM(garbage) succeeded")
+	}
+}
+
+func TestKeyVaultScope(t *testing.T) {
+	t.Parallel()
+
+	for host, want := range map[string]string{
+		"contoso.vault.azure.net":         "https://vault.azure.net/.default",
+		"contoso.vault.azure.cn":          "https://vault.azure.cn/.default",
+		"contoso.vault.usgovcloudapi.net": "https://vault.usgovcloudapi.net/.default",
+	} {
+		if got := keyVaultScope(host); got != want {
+			t.Errorf("keyVaultScope(%s) = %s, want %s", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package ubuntucore recognizes Ubuntu Core hosts, which the agent does not
+// support.
+//
+// Ubuntu Core is assembled from snaps: there is no apt or dpkg to install
+// systemd-container, most of /etc is read-only outside the paths snaps are
+// granted through the system-files interface, and the agent itself is not
+// published as a snap. Bootstrap would fail partway through host setup, so
+// preflight and start reject these hosts up front instead.
+package ubuntucore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	osReleasePath = "/etc/os-release"
+	checkName     = "ubuntu-core"
+	osID          = "ubuntu-core"
+)
+
+// ErrUnsupported is returned by EnsureSupported on Ubuntu Core hosts.
+var ErrUnsupported = errors.New("the agent does not support Ubuntu Core: it needs apt to install systemd-container and a writable /etc; use Ubuntu Server")
+
+// Detect reports whether the host runs Ubuntu Core.
+func Detect() bool {
+	f, err := os.Open(osReleasePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	return isUbuntuCore(f)
+}
+
+// isUbuntuCore reads os-release and matches its ID field.
+func isUbuntuCore(r io.Reader) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if ok && key == "ID" {
+			return strings.Trim(value, `"'`) == osID
+		}
+	}
+	return false
+}
+
+// EnsureSupported fails on Ubuntu Core, before bootstrap mutates the host.
+func EnsureSupported() error {
+	if Detect() {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// Preflight returns the Ubuntu Core check, or nil on other hosts.
+func Preflight() []preflight.Checker {
+	if !Detect() {
+		return nil
+	}
+	return []preflight.Checker{checker{}}
+}
+
+type checker struct{}
+
+func (checker) Name() string { return checkName }
+
+func (checker) Check(context.Context) []preflight.Result {
+	return preflight.ResultsError(checkName, osReleasePath, "%v", ErrUnsupported)
+}
@@ -0,0 +1,30 @@
+package ubuntucore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsUbuntuCore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		osRelease string
+		want      bool
+	}{
+		{name: "ubuntu core", osRelease: "NAME=\"Ubuntu Core\"\nVERSION=\"24\"\nID=ubuntu-core\nVERSION_ID=\"24\"\n", want: true},
+		{name: "quoted id", osRelease: "ID=\"ubuntu-core\"\n", want: true},
+		{name: "ubuntu server", osRelease: "NAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\n"},
+		{name: "id like only", osRelease: "ID=custom\nID_LIKE=ubuntu-core\n"},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isUbuntuCore(strings.NewReader(tt.osRelease)); got != tt.want {
+				t.Fatalf("isUbuntuCore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package unithardening adds a systemd sandboxing profile to the units the
+// agent renders into the nspawn machine, so they run with the usual
+// protections without each template spelling them out. The kubelet and
+// containerd units come from the rootfs image and are hardened through a
+// drop-in instead.
+package unithardening
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+const (
+	header     = "# Hardening applied by aks-flex-node\n"
+	dropInName = "90-aks-flex-node-hardening.conf"
+)
+
+// RuntimeUnits are the units of the rootfs image that run the node's
+// containers.
+var RuntimeUnits = []string{"kubelet.service", "containerd.service"}
+
+type directive struct {
+	key, value string
+}
+
+// profile is the baseline applied to every unit. It leaves the kernel log
+// and network configuration reachable, since the node problem detector reads
+// /dev/kmsg and the local DNS cache sets up its dummy interface.
+var profile = []directive{
+	{"NoNewPrivileges", "yes"},
+	{"ProtectSystem", "full"},
+	{"ProtectHome", "yes"},
+	{"PrivateTmp", "yes"},
+	{"RestrictAddressFamilies", "AF_UNIX AF_INET AF_INET6 AF_NETLINK"},
+	{"RestrictSUIDSGID", "yes"},
+	{"RestrictRealtime", "yes"},
+	{"LockPersonality", "yes"},
+}
+
+// runtimeExclusions are the profile directives left out of the runtime
+// units' drop-ins, with the reason each cannot apply there. Containers are
+// started by these units and inherit their namespaces and seccomp filters.
+// An operator can still set one explicitly through the unit's directives.
+var runtimeExclusions = map[string]string{
+	"NoNewPrivileges":         "inherited by every container, it breaks setuid binaries and privileged pods",
+	"ProtectSystem":           "it gives the unit a private mount namespace, hiding volume and rootfs mounts from the rest of the node",
+	"ProtectHome":             "it gives the unit a private mount namespace, hiding volume and rootfs mounts from the rest of the node",
+	"PrivateTmp":              "it gives the unit a private mount namespace and hides the node's /tmp from hostPath volumes",
+	"RestrictAddressFamilies": "its seccomp filter is inherited by every container and overrides the pod's own profile",
+	"RestrictSUIDSGID":        "its seccomp filter is inherited by every container and breaks images that set up setuid files",
+	"RestrictRealtime":        "its seccomp filter is inherited by every container and denies pods realtime scheduling",
+	"LockPersonality":         "its seccomp filter is inherited by every container and breaks 32-bit userspace in pods",
+}
+
+// Apply returns unit, the rendered contents of the named unit, with the
+// hardening profile and the unit's overrides appended to its [Service]
+// section. It returns unit unchanged when hardening is off or disabled for
+// the unit.
+func Apply(cfg config.UnitHardeningConfig, name string, unit []byte) ([]byte, error) {
+	override := cfg.For(name)
+	if !cfg.Enabled || override.Disabled {
+		return unit, nil
+	}
+
+	var section bytes.Buffer
+	section.WriteString(header)
+	for _, d := range directives(override) {
+		fmt.Fprintf(&section, "%s=%s\n", d.key, d.value)
+	}
+
+	lines := strings.SplitAfter(string(unit), "\n")
+	inService := false
+	for i, line := range lines {
+		header := strings.TrimSpace(line)
+		if !strings.HasPrefix(header, "[") {
+			continue
+		}
+		if inService {
+			return insert(lines, i, section.String()), nil
+		}
+		inService = header == "[Service]"
+	}
+	if !inService {
+		return nil, fmt.Errorf("unit %s has no [Service] section", name)
+	}
+	return insert(lines, len(lines), section.String()), nil
+}
+
+// DropIn returns the drop-in that hardens the named runtime unit, or nil when
+// hardening is off, disabled for the unit, or leaves nothing to apply. It
+// holds the unit's resource caps and explicit directives; the profile
+// directives in runtimeExclusions are left out unless set explicitly.
+func DropIn(cfg config.UnitHardeningConfig, name string) []byte {
+	override := cfg.For(name)
+	if !cfg.Enabled || override.Disabled {
+		return nil
+	}
+	var lines []string
+	for _, d := range directives(override) {
+		if _, excluded := runtimeExclusions[d.key]; excluded {
+			if _, set := override.Directives[d.key]; !set {
+				continue
+			}
+		}
+		lines = append(lines, d.key+"="+d.value+"\n")
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(header + "[Service]\n" + strings.Join(lines, ""))
+}
+
+// WriteDropIns returns a task that writes the hardening drop-ins of the
+// runtime units into machineDir before the machine starts, and removes the
+// ones no longer configured.
+func WriteDropIns(cfg config.UnitHardeningConfig, machineDir string) phases.Task {
+	return &writeDropInsTask{cfg: cfg, machineDir: machineDir}
+}
+
+type writeDropInsTask struct {
+	cfg        config.UnitHardeningConfig
+	machineDir string
+}
+
+func (t *writeDropInsTask) Name() string { return "write-unit-hardening" }
+
+// Plan returns the drop-in paths inside the machine.
+func (t *writeDropInsTask) Plan() []string {
+	paths := make([]string, 0, len(RuntimeUnits))
+	for _, unit := range RuntimeUnits {
+		paths = append(paths, t.path(unit))
+	}
+	return paths
+}
+
+func (t *writeDropInsTask) Do(context.Context) error {
+	for _, unit := range RuntimeUnits {
+		path := t.path(unit)
+		content := DropIn(t.cfg, unit)
+		if content == nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("remove %s: %w", path, err)
+			}
+			continue
+		}
+		if err := utilio.WriteFile(path, content, 0o644); err != nil { //nolint:gosec // read by systemd inside the machine
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (t *writeDropInsTask) path(unit string) string {
+	return filepath.Join(t.machineDir, "etc/systemd/system", unit+".d", dropInName)
+}
+
+// directives returns the profile with override applied, in the order they
+// are written.
+func directives(override config.UnitHardeningOverride) []directive {
+	result := make([]directive, 0, len(profile)+len(override.Directives)+2)
+	for _, d := range profile {
+		if value, ok := override.Directives[d.key]; ok {
+			d.value = value
+		}
+		if d.value != "" {
+			result = append(result, d)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(override.Directives)) {
+		value := override.Directives[key]
+		if value == "" || slices.ContainsFunc(profile, func(d directive) bool { return d.key == key }) {
+			continue
+		}
+		result = append(result, directive{key, value})
+	}
+	if override.MemoryMaxBytes > 0 {
+		result = append(result, directive{"MemoryMax", fmt.Sprint(override.MemoryMaxBytes)})
+	}
+	if override.CPUQuotaPercent > 0 {
+		result = append(result, directive{"CPUQuota", fmt.Sprintf("%d%%", override.CPUQuotaPercent)})
+	}
+	return result
+}
+
+// insert places section before lines[at], separated from the following
+// section by a blank line.
+func insert(lines []string, at int, section string) []byte {
+	before := strings.Join(lines[:at], "")
+	after := strings.Join(lines[at:], "")
+	trimmed := strings.TrimRight(before, "\n") + "\n"
+	if after != "" {
+		section += "\n"
+	}
+	return []byte(trimmed + section + after)
+}
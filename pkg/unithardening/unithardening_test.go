@@ -0,0 +1,152 @@
+package unithardening
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/AKSFlexNode/pkg/config"
+)
+
+const testUnit = `[Unit]
+Description=Node-local DNS cache
+
+[Service]
+ExecStart=/usr/local/bin/coredns
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.UnitHardeningConfig{Enabled: true, Units: map[string]config.UnitHardeningOverride{
+		"node-local-dns.service": {
+			MemoryMaxBytes:  64 << 20,
+			CPUQuotaPercent: 50,
+			Directives:      map[string]string{"ProtectSystem": "strict", "PrivateTmp": "", "AmbientCapabilities": "CAP_NET_ADMIN"},
+		},
+	}}
+	got, err := Apply(cfg, "node-local-dns.service", []byte(testUnit))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := `[Unit]
+Description=Node-local DNS cache
+
+[Service]
+ExecStart=/usr/local/bin/coredns
+Restart=always
+# Hardening applied by aks-flex-node
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6 AF_NETLINK
+RestrictSUIDSGID=yes
+RestrictRealtime=yes
+LockPersonality=yes
+AmbientCapabilities=CAP_NET_ADMIN
+MemoryMax=67108864
+CPUQuota=50%
+
+[Install]
+WantedBy=multi-user.target
+`
+	if string(got) != want {
+		t.Errorf("Apply() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestApplyServiceLast(t *testing.T) {
+	t.Parallel()
+
+	got, err := Apply(config.UnitHardeningConfig{Enabled: true}, "a.service", []byte("[Service]\nExecStart=/bin/true"))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !strings.HasPrefix(string(got), "[Service]\nExecStart=/bin/true\n# Hardening") || !strings.HasSuffix(string(got), "LockPersonality=yes\n") {
+		t.Errorf("Apply() =\n%s", got)
+	}
+}
+
+func TestApplySkips(t *testing.T) {
+	t.Parallel()
+
+	for name, cfg := range map[string]config.UnitHardeningConfig{
+		"disabled":      {},
+		"unit disabled": {Enabled: true, Units: map[string]config.UnitHardeningOverride{"a.service": {Disabled: true}}},
+	} {
+		got, err := Apply(cfg, "a.service", []byte(testUnit))
+		if err != nil || string(got) != testUnit {
+			t.Errorf("%s: Apply() = %q, %v, want the unit unchanged", name, got, err)
+		}
+	}
+	if _, err := Apply(config.UnitHardeningConfig{Enabled: true}, "a.service", []byte("[Unit]\n")); err == nil {
+		t.Error("Apply() of a unit without [Service] succeeded")
+	}
+}
+
+func TestDropIn(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.UnitHardeningConfig{Enabled: true, Units: map[string]config.UnitHardeningOverride{
+		"containerd.service": {
+			MemoryMaxBytes: 1 << 30,
+			Directives:     map[string]string{"LockPersonality": "yes", "OOMScoreAdjust": "-999"},
+		},
+	}}
+	want := `# Hardening applied by aks-flex-node
+[Service]
+LockPersonality=yes
+OOMScoreAdjust=-999
+MemoryMax=1073741824
+`
+	if got := DropIn(cfg, "containerd.service"); string(got) != want {
+		t.Errorf("DropIn(containerd) =\n%s\nwant\n%s", got, want)
+	}
+	if got := DropIn(cfg, "kubelet.service"); got != nil {
+		t.Errorf("DropIn(kubelet) = %q, want nil without caps or explicit directives", got)
+	}
+	if got := DropIn(config.UnitHardeningConfig{Units: cfg.Units}, "containerd.service"); got != nil {
+		t.Errorf("DropIn() with hardening off = %q, want nil", got)
+	}
+}
+
+func TestRuntimeExclusionsCoverProfile(t *testing.T) {
+	t.Parallel()
+
+	for _, d := range profile {
+		if runtimeExclusions[d.key] == "" {
+			t.Errorf("profile directive %s has no runtime exclusion reason", d.key)
+		}
+	}
+}
+
+func TestWriteDropIns(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "etc/systemd/system/kubelet.service.d", dropInName)
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("[Service]\nCPUQuota=10%\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.UnitHardeningConfig{Enabled: true, Units: map[string]config.UnitHardeningOverride{
+		"containerd.service": {CPUQuotaPercent: 200},
+	}}
+	if err := WriteDropIns(cfg, dir).Do(t.Context()); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("kubelet drop-in still exists: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "etc/systemd/system/containerd.service.d", dropInName))
+	if err != nil || !strings.HasSuffix(string(got), "CPUQuota=200%\n") {
+		t.Errorf("containerd drop-in = %q, %v", got, err)
+	}
+}
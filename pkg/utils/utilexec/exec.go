@@ -12,7 +12,24 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-	"sync"
+	"time"
+)
+
+const (
+	// systemctlQueryTimeout bounds read-only systemctl calls such as
+	// is-active, which should answer immediately unless systemd is wedged.
+	systemctlQueryTimeout = 30 * time.Second
+	// systemctlJobTimeout bounds systemctl calls that enqueue a job and wait
+	// for it. It is slightly above systemd's default 90s stop timeout so a
+	// slow but healthy unit is not reported as a hang.
+	systemctlJobTimeout = 2 * time.Minute
+	// commandWaitDelay bounds how long Wait blocks for output pipes after the
+	// process has been killed on context cancellation, so children that
+	// inherited the pipes cannot keep the agent from shutting down.
+	commandWaitDelay = 5 * time.Second
+	// serviceInactivePollInterval is how often WaitServiceInactive queries
+	// the unit.
+	serviceInactivePollInterval = time.Second
 )
 
 // Interface abstracts command creation for code that needs test injection.
@@ -47,36 +64,10 @@ func RunCmdAt(ctx context.Context, logger *slog.Logger, stderrLevel slog.Level,
 	cmd := newCmd(ctx)
 	cmd.Args = append(cmd.Args, args...)
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start %s: %w", cmd.Path, err)
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		streamLogs(ctx, logger, stdout, slog.LevelDebug)
-	}()
-	go func() {
-		defer wg.Done()
-		streamLogs(ctx, logger, stderr, stderrLevel)
-	}()
-	wg.Wait()
-
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("%s failed: %w", cmd.Path, err)
-	}
-	return nil
+	stdout, waitStdout := logPipe(ctx, logger, slog.LevelDebug, nil)
+	stderr, waitStderr := logPipe(ctx, logger, stderrLevel, nil)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return runLogged(cmd, waitStdout, waitStderr)
 }
 
 // OutputCmd runs the command specified by name and args, and returns the
@@ -87,40 +78,70 @@ func OutputCmd(ctx context.Context, logger *slog.Logger, name string, args ...st
 
 // OutputCmdAt is like OutputCmd but streams stderr at stderrLevel.
 func OutputCmdAt(ctx context.Context, logger *slog.Logger, stderrLevel slog.Level, name string, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, name, args...) // #nosec G204 -- callers pass trusted binary names
+	return outputCmd(ctx, logger, stderrLevel, func(ctx context.Context) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, name) // #nosec G204 -- callers pass trusted binary names
+		cmd.WaitDelay = commandWaitDelay
+		return cmd
+	}, args...)
+}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
+// outputCmd is OutputCmdAt for a command created from newCmd with args
+// appended.
+func outputCmd(ctx context.Context, logger *slog.Logger, stderrLevel slog.Level, newCmd func(context.Context) *exec.Cmd, args ...string) (string, error) {
+	cmd := newCmd(ctx)
+	cmd.Args = append(cmd.Args, args...)
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to create stderr pipe: %w", err)
+	var buf bytes.Buffer
+	stdout, waitStdout := logPipe(ctx, logger, slog.LevelDebug, &buf)
+	stderr, waitStderr := logPipe(ctx, logger, stderrLevel, nil)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := runLogged(cmd, waitStdout, waitStderr); err != nil {
+		return "", err
 	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
 
+// runLogged runs cmd, whose output goes to log pipes, and waits for the
+// logging to finish. exec copies the output itself, so Wait returns WaitDelay
+// after the context ended even when a child still holds the output open.
+func runLogged(cmd *exec.Cmd, waitOutput ...func()) error {
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+		for _, wait := range waitOutput {
+			wait()
+		}
+		return fmt.Errorf("failed to start %s: %w", cmd.Path, err)
 	}
+	err := cmd.Wait()
+	for _, wait := range waitOutput {
+		wait()
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", cmd.Path, err)
+	}
+	return nil
+}
 
-	var buf bytes.Buffer
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		streamLogs(ctx, logger, io.TeeReader(stdout, &buf), slog.LevelDebug)
-	}()
+// logPipe returns a writer whose lines are logged at level and, when tee is
+// set, copied to it, and a function that closes the writer and waits for the
+// last line.
+func logPipe(ctx context.Context, logger *slog.Logger, level slog.Level, tee io.Writer) (io.Writer, func()) {
+	r, w := io.Pipe()
+	done := make(chan struct{})
 	go func() {
-		defer wg.Done()
-		streamLogs(ctx, logger, stderr, stderrLevel)
+		defer close(done)
+		var reader io.Reader = r
+		if tee != nil {
+			reader = io.TeeReader(r, tee)
+		}
+		streamLogs(ctx, logger, reader, level)
+		// Drain what streamLogs left after the context ended, so the
+		// writer never blocks.
+		_, _ = io.Copy(io.Discard, reader)
 	}()
-	wg.Wait()
-
-	if err := cmd.Wait(); err != nil {
-		return "", fmt.Errorf("%s failed: %w", cmd.Path, err)
+	return w, func() {
+		_ = w.Close()
+		<-done
 	}
-
-	return strings.TrimRight(buf.String(), "\n"), nil
 }
 
 // MachineRun executes a command inside the named nspawn machine using
@@ -136,7 +157,9 @@ func MachineRun(ctx context.Context, logger *slog.Logger, machine string, args .
 // Systemctl returns a command factory for systemctl.
 func Systemctl() func(context.Context) *exec.Cmd {
 	return func(ctx context.Context) *exec.Cmd {
-		return exec.CommandContext(ctx, "systemctl") // #nosec G204 -- fixed binary
+		cmd := exec.CommandContext(ctx, "systemctl") // #nosec G204 -- fixed binary
+		cmd.WaitDelay = commandWaitDelay
+		return cmd
 	}
 }
 
@@ -154,6 +177,13 @@ func Dpkg() func(context.Context) *exec.Cmd {
 	}
 }
 
+// AptMark returns a command factory for apt-mark.
+func AptMark() func(context.Context) *exec.Cmd {
+	return func(ctx context.Context) *exec.Cmd {
+		return exec.CommandContext(ctx, "apt-mark") // #nosec G204 -- fixed binary
+	}
+}
+
 // Bash returns a command factory for bash.
 func Bash() func(context.Context) *exec.Cmd {
 	return func(ctx context.Context) *exec.Cmd {
@@ -184,7 +214,13 @@ func Pgrep() func(context.Context) *exec.Cmd {
 
 // IsServiceActive checks whether a systemd service is active.
 func IsServiceActive(ctx context.Context, logger *slog.Logger, serviceName string) bool {
-	output, err := OutputCmdAt(ctx, logger, slog.LevelDebug, "systemctl", "is-active", serviceName)
+	return isServiceActive(ctx, logger, Systemctl(), serviceName)
+}
+
+func isServiceActive(ctx context.Context, logger *slog.Logger, newCmd func(context.Context) *exec.Cmd, serviceName string) bool {
+	ctx, cancel := context.WithTimeout(ctx, systemctlQueryTimeout)
+	defer cancel()
+	output, err := outputCmd(ctx, logger, slog.LevelDebug, newCmd, "is-active", serviceName)
 	if err != nil {
 		return false
 	}
@@ -193,22 +229,244 @@ func IsServiceActive(ctx context.Context, logger *slog.Logger, serviceName strin
 
 // ServiceExists checks whether a systemd unit file exists.
 func ServiceExists(ctx context.Context, logger *slog.Logger, serviceName string) bool {
+	ctx, cancel := context.WithTimeout(ctx, systemctlQueryTimeout)
+	defer cancel()
 	return RunCmdAt(ctx, logger, slog.LevelDebug, Systemctl(), "list-unit-files", serviceName+".service") == nil
 }
 
+// StartService starts a systemd service.
+func StartService(ctx context.Context, logger *slog.Logger, serviceName string) error {
+	return runSystemctlJob(ctx, logger, "start", serviceName)
+}
+
+// EnableService enables a systemd service.
+func EnableService(ctx context.Context, logger *slog.Logger, serviceName string) error {
+	return runSystemctlJob(ctx, logger, "enable", serviceName)
+}
+
+// RestartService restarts a systemd service, starting it if it is stopped.
+func RestartService(ctx context.Context, logger *slog.Logger, serviceName string) error {
+	return runSystemctlJob(ctx, logger, "restart", serviceName)
+}
+
 // StopService stops a systemd service.
 func StopService(ctx context.Context, logger *slog.Logger, serviceName string) error {
-	return RunCmd(ctx, logger, Systemctl(), "stop", serviceName)
+	return runSystemctlJob(ctx, logger, "stop", serviceName)
+}
+
+// StopServiceWithin stops a systemd service like StopService, but waits up to
+// timeout instead of the default job timeout, for units whose TimeoutStopSec
+// exceeds it.
+func StopServiceWithin(ctx context.Context, logger *slog.Logger, serviceName string, timeout time.Duration) error {
+	return runSystemctlJobWithin(ctx, logger, timeout, "stop", serviceName)
+}
+
+// WaitServiceInactive polls the service until it is inactive, failed, or
+// unknown to systemd, or timeout passes.
+func WaitServiceInactive(ctx context.Context, logger *slog.Logger, serviceName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(serviceInactivePollInterval)
+	defer ticker.Stop()
+	for {
+		states, err := GetUnitStates(ctx, logger, serviceName)
+		if err == nil {
+			state := states[serviceName]
+			if !state.Exists() || state.ActiveState == "inactive" || state.ActiveState == "failed" {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for %s to stop: %w", serviceName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
 // DisableService disables a systemd service.
 func DisableService(ctx context.Context, logger *slog.Logger, serviceName string) error {
-	return RunCmd(ctx, logger, Systemctl(), "disable", serviceName)
+	return runSystemctlJob(ctx, logger, "disable", serviceName)
 }
 
 // ReloadSystemd reloads systemd daemon configuration.
 func ReloadSystemd(ctx context.Context, logger *slog.Logger) error {
-	return RunCmd(ctx, logger, Systemctl(), "daemon-reload")
+	return runSystemctlJob(ctx, logger, "daemon-reload")
+}
+
+// DisableUnits disables all units with a single systemctl invocation.
+func DisableUnits(ctx context.Context, logger *slog.Logger, units ...string) error {
+	if len(units) == 0 {
+		return nil
+	}
+	return runSystemctlJob(ctx, logger, append([]string{"disable"}, units...)...)
+}
+
+// MaskUnits stops and masks all units with a single systemctl invocation so
+// nothing can start them again, including at boot.
+func MaskUnits(ctx context.Context, logger *slog.Logger, units ...string) error {
+	if len(units) == 0 {
+		return nil
+	}
+	return runSystemctlJob(ctx, logger, append([]string{"mask", "--now"}, units...)...)
+}
+
+// UnmaskUnits reverts MaskUnits.
+func UnmaskUnits(ctx context.Context, logger *slog.Logger, units ...string) error {
+	if len(units) == 0 {
+		return nil
+	}
+	return runSystemctlJob(ctx, logger, append([]string{"unmask"}, units...)...)
+}
+
+// UnitState is the subset of systemd unit properties the agent inspects.
+type UnitState struct {
+	LoadState     string
+	ActiveState   string
+	SubState      string
+	UnitFileState string
+}
+
+// Exists reports whether systemd knows the unit, either because a unit file is
+// installed or because it is currently loaded.
+func (s UnitState) Exists() bool {
+	return s.LoadState != "" && s.LoadState != "not-found"
+}
+
+// Active reports whether the unit is active.
+func (s UnitState) Active() bool {
+	return s.ActiveState == "active"
+}
+
+var unitStateProperties = []string{"LoadState", "ActiveState", "SubState", "UnitFileState"}
+
+// GetUnitStates queries the state of all units with a single systemctl show
+// call instead of one is-active/list-unit-files round trip per unit. The
+// result is keyed by the names passed in.
+func GetUnitStates(ctx context.Context, logger *slog.Logger, units ...string) (map[string]UnitState, error) {
+	if len(units) == 0 {
+		return map[string]UnitState{}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, systemctlQueryTimeout)
+	defer cancel()
+
+	args := make([]string, 0, 2+len(units))
+	args = append(args, "show", "--property="+strings.Join(unitStateProperties, ","))
+	args = append(args, units...)
+	output, err := OutputCmdAt(ctx, logger, slog.LevelDebug, "systemctl", args...)
+	if err != nil {
+		return nil, fmt.Errorf("query unit states: %w", err)
+	}
+	return parseUnitStates(output, units)
+}
+
+// parseUnitStates reads the unit states from systemctl show output.
+func parseUnitStates(output string, units []string) (map[string]UnitState, error) {
+	properties, err := splitUnitProperties(output, units)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]UnitState, len(units))
+	for unit, props := range properties {
+		states[unit] = UnitState{
+			LoadState:     props["LoadState"],
+			ActiveState:   props["ActiveState"],
+			SubState:      props["SubState"],
+			UnitFileState: props["UnitFileState"],
+		}
+	}
+	return states, nil
+}
+
+// splitUnitProperties splits systemctl show output, which prints one
+// blank-line separated block per unit in argument order, into the properties
+// of each unit.
+func splitUnitProperties(output string, units []string) (map[string]map[string]string, error) {
+	blocks := strings.Split(strings.TrimSpace(output), "\n\n")
+	if len(blocks) != len(units) {
+		return nil, fmt.Errorf("systemctl show returned %d unit blocks, want %d", len(blocks), len(units))
+	}
+	properties := make(map[string]map[string]string, len(units))
+	for i, block := range blocks {
+		props := map[string]string{}
+		for _, line := range strings.Split(block, "\n") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if !ok {
+				continue
+			}
+			props[key] = value
+		}
+		properties[units[i]] = props
+	}
+	return properties, nil
+}
+
+// UnitFiles are the files systemd loaded a unit from.
+type UnitFiles struct {
+	// FragmentPath is the unit file.
+	FragmentPath string
+	// DropInPaths are the drop-ins, including runtime ones under /run.
+	DropInPaths []string
+}
+
+// GetMachineUnitFiles queries the files systemd inside the nspawn machine
+// loaded the units from, over the machine's D-Bus with a single systemctl
+// show call. The result is keyed by the names passed in.
+func GetMachineUnitFiles(ctx context.Context, logger *slog.Logger, machine string, units ...string) (map[string]UnitFiles, error) {
+	if len(units) == 0 {
+		return map[string]UnitFiles{}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, systemctlQueryTimeout)
+	defer cancel()
+
+	args := make([]string, 0, 3+len(units))
+	args = append(args, "--machine="+machine, "show", "--property=FragmentPath,DropInPaths")
+	args = append(args, units...)
+	output, err := OutputCmdAt(ctx, logger, slog.LevelDebug, "systemctl", args...)
+	if err != nil {
+		return nil, fmt.Errorf("query unit files in %s: %w", machine, err)
+	}
+	return parseUnitFiles(output, units)
+}
+
+// parseUnitFiles reads the unit files from systemctl show output.
+// DropInPaths is space separated.
+func parseUnitFiles(output string, units []string) (map[string]UnitFiles, error) {
+	properties, err := splitUnitProperties(output, units)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]UnitFiles, len(units))
+	for unit, props := range properties {
+		files[unit] = UnitFiles{FragmentPath: props["FragmentPath"], DropInPaths: strings.Fields(props["DropInPaths"])}
+	}
+	return files, nil
+}
+
+// runSystemctlJob runs a state-changing systemctl command bounded by both the
+// caller's context and systemctlJobTimeout, so a wedged systemd fails the
+// operation instead of blocking agent shutdown.
+func runSystemctlJob(ctx context.Context, logger *slog.Logger, args ...string) error {
+	return runSystemctlJobWithin(ctx, logger, systemctlJobTimeout, args...)
+}
+
+// runSystemctlJobWithin is runSystemctlJob bounded by timeout.
+func runSystemctlJobWithin(ctx context.Context, logger *slog.Logger, timeout time.Duration, args ...string) error {
+	return runSystemctlJobWith(ctx, logger, Systemctl(), timeout, args...)
+}
+
+// runSystemctlJobWith is runSystemctlJobWithin for the systemctl command
+// newCmd creates.
+func runSystemctlJobWith(ctx context.Context, logger *slog.Logger, newCmd func(context.Context) *exec.Cmd, timeout time.Duration, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := RunCmd(ctx, logger, newCmd, args...); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("systemctl %s: %w: %w", strings.Join(args, " "), ctxErr, err)
+		}
+		return err
+	}
+	return nil
 }
 
 // streamLogs reads lines from reader and logs each line at level.
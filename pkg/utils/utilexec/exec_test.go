@@ -0,0 +1,169 @@
+package utilexec
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeSystemctl returns a command factory that runs script with sh in place
+// of systemctl, ignoring the systemctl arguments.
+func fakeSystemctl(script string, waitDelay time.Duration) func(context.Context) *exec.Cmd {
+	return func(ctx context.Context) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "sh", "-c", script, "systemctl")
+		cmd.WaitDelay = waitDelay
+		return cmd
+	}
+}
+
+func TestRunSystemctlJobWrapsContextError(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.DiscardHandler)
+	err := runSystemctlJobWith(t.Context(), log, fakeSystemctl("sleep 30", time.Second), 50*time.Millisecond, "stop", "kubelet")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expired job error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	err = runSystemctlJobWith(ctx, log, fakeSystemctl("sleep 30", time.Second), time.Minute, "stop", "kubelet")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled job error = %v, want it to wrap context.Canceled", err)
+	}
+
+	err = runSystemctlJobWith(t.Context(), log, fakeSystemctl("exit 3", time.Second), time.Minute, "stop", "kubelet")
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		t.Fatalf("failed job error = %v, want the exit status without a context error", err)
+	}
+}
+
+func TestRunSystemctlJobWaitDelay(t *testing.T) {
+	t.Parallel()
+
+	// The background sleep inherits stdout and stderr and outlives the
+	// killed shell; without WaitDelay reading them would block until it
+	// exits.
+	start := time.Now()
+	err := runSystemctlJobWith(t.Context(), slog.New(slog.DiscardHandler),
+		fakeSystemctl("sleep 30 & wait", 100*time.Millisecond), 100*time.Millisecond, "stop", "kubelet")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("job returned after %v, want the orphaned pipes cut off by WaitDelay", elapsed)
+	}
+
+	if got := Systemctl()(t.Context()).WaitDelay; got != commandWaitDelay {
+		t.Fatalf("Systemctl() WaitDelay = %v, want %v", got, commandWaitDelay)
+	}
+}
+
+func TestIsServiceActive(t *testing.T) {
+	t.Parallel()
+
+	log := slog.New(slog.DiscardHandler)
+	tests := []struct {
+		name   string
+		script string
+		ctx    func() context.Context
+		want   bool
+	}{
+		{name: "active", script: "echo active", want: true},
+		{name: "inactive", script: "echo inactive; exit 3"},
+		{name: "activating", script: "echo activating"},
+		{
+			name:   "cancelled",
+			script: "echo active",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := t.Context()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+			if got := isServiceActive(ctx, log, fakeSystemctl(tt.script, time.Second), "kubelet"); got != tt.want {
+				t.Fatalf("isServiceActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnitStates(t *testing.T) {
+	t.Parallel()
+
+	output := `LoadState=loaded
+ActiveState=active
+SubState=running
+UnitFileState=enabled
+
+LoadState=not-found
+ActiveState=inactive
+SubState=dead
+UnitFileState=
+`
+	states, err := parseUnitStates(output, []string{"himdsd", "extd"})
+	if err != nil {
+		t.Fatalf("parseUnitStates: %v", err)
+	}
+
+	tests := []struct {
+		unit       string
+		wantExists bool
+		wantActive bool
+		wantFile   string
+	}{
+		{unit: "himdsd", wantExists: true, wantActive: true, wantFile: "enabled"},
+		{unit: "extd", wantExists: false, wantActive: false, wantFile: ""},
+	}
+	for _, tt := range tests {
+		state := states[tt.unit]
+		if state.Exists() != tt.wantExists || state.Active() != tt.wantActive || state.UnitFileState != tt.wantFile {
+			t.Errorf("%s state = %+v, want exists=%v active=%v unitFileState=%q", tt.unit, state, tt.wantExists, tt.wantActive, tt.wantFile)
+		}
+	}
+}
+
+func TestParseUnitStatesBlockMismatch(t *testing.T) {
+	t.Parallel()
+
+	if _, err := parseUnitStates("LoadState=loaded\n", []string{"a", "b"}); err == nil {
+		t.Fatal("parseUnitStates: want error for missing unit block")
+	}
+}
+
+func TestParseUnitFiles(t *testing.T) {
+	t.Parallel()
+
+	output := `FragmentPath=/etc/systemd/system/kubelet.service
+DropInPaths=/etc/systemd/system/kubelet.service.d/10-kubeconfig.conf /run/systemd/system.control/kubelet.service.d/50-CPUWeight.conf
+
+FragmentPath=/etc/systemd/system/containerd.service
+DropInPaths=
+`
+	files, err := parseUnitFiles(output, []string{"kubelet.service", "containerd.service"})
+	if err != nil {
+		t.Fatalf("parseUnitFiles: %v", err)
+	}
+	kubelet := files["kubelet.service"]
+	if kubelet.FragmentPath != "/etc/systemd/system/kubelet.service" || !slices.Equal(kubelet.DropInPaths, []string{
+		"/etc/systemd/system/kubelet.service.d/10-kubeconfig.conf",
+		"/run/systemd/system.control/kubelet.service.d/50-CPUWeight.conf",
+	}) {
+		t.Fatalf("kubelet.service files = %+v", kubelet)
+	}
+	if containerd := files["containerd.service"]; containerd.FragmentPath != "/etc/systemd/system/containerd.service" || len(containerd.DropInPaths) != 0 {
+		t.Fatalf("containerd.service files = %+v", containerd)
+	}
+}
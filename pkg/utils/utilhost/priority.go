@@ -0,0 +1,54 @@
+package utilhost
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// I/O scheduling classes and levels of ioprio_set(2).
+const (
+	IOPrioClassBestEffort = 2
+	IOPrioClassIdle       = 3
+	// IOPrioLowest is the lowest level within a class.
+	IOPrioLowest = 7
+
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// taskDir lists the threads of the current process.
+const taskDir = "/proc/self/task"
+
+// LowerPriority sets the CPU niceness and, when ioClass is not zero, the I/O
+// scheduling class and level of every thread of the current process. Linux
+// keeps both per thread and new threads inherit them from the thread that
+// creates them, so threads the Go runtime starts later run at the same
+// priority, as do the commands the process runs.
+func LowerPriority(nice, ioClass, ioLevel int) error {
+	entries, err := os.ReadDir(taskDir)
+	if err != nil {
+		return fmt.Errorf("list threads: %w", err)
+	}
+	var errs []error
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("set niceness of thread %d: %w", tid, err))
+		}
+		if ioClass == 0 {
+			continue
+		}
+		prio := uintptr(ioClass<<ioprioClassShift | ioLevel)
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), prio); errno != 0 && errno != unix.ESRCH {
+			errs = append(errs, fmt.Errorf("set I/O priority of thread %d: %w", tid, errno))
+		}
+	}
+	return errors.Join(errs...)
+}
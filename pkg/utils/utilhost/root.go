@@ -0,0 +1,42 @@
+package utilhost
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+)
+
+// Root is the directory the agent's host modules read and change the host
+// under: "/" on the running host, a mounted image or chroot when preparing
+// one offline, and a temporary directory in tests. It is a plain value, so
+// concurrent users such as parallel tests each carry their own.
+type Root string
+
+// HostRoot is the root of the running host.
+const HostRoot Root = "/"
+
+// Path returns the host path p under the root. The empty Root is the
+// running host's.
+func (r Root) Path(p string) string {
+	if r == "" {
+		r = HostRoot
+	}
+	return filepath.Join(string(r), p)
+}
+
+// IsHost reports whether r is the running host's root.
+func (r Root) IsHost() bool {
+	return r == "" || filepath.Clean(string(r)) == "/"
+}
+
+// Output runs a privileged command against the root and returns its
+// standard output. Outside the running host it runs through chroot, so the
+// command sees the root's binaries and configuration.
+func (r Root) Output(ctx context.Context, log *slog.Logger, name string, args ...string) (string, error) {
+	if r.IsHost() {
+		return utilexec.OutputCmd(ctx, log, name, args...)
+	}
+	return utilexec.OutputCmd(ctx, log, "chroot", append([]string{string(r), name}, args...)...)
+}
@@ -0,0 +1,29 @@
+package utilhost
+
+import "testing"
+
+func TestRoot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		root     Root
+		wantPath string
+		wantHost bool
+	}{
+		{root: HostRoot, wantPath: "/etc/os-release", wantHost: true},
+		{root: "", wantPath: "/etc/os-release", wantHost: true},
+		{root: "/mnt/image", wantPath: "/mnt/image/etc/os-release"},
+		{root: "/mnt/image/", wantPath: "/mnt/image/etc/os-release"},
+	}
+	for _, tt := range tests {
+		if got := tt.root.Path("/etc/os-release"); got != tt.wantPath {
+			t.Errorf("Root(%q).Path() = %q, want %q", tt.root, got, tt.wantPath)
+		}
+		if got := tt.root.Path("etc/os-release"); got != tt.wantPath {
+			t.Errorf("Root(%q).Path() of a relative path = %q, want %q", tt.root, got, tt.wantPath)
+		}
+		if got := tt.root.IsHost(); got != tt.wantHost {
+			t.Errorf("Root(%q).IsHost() = %v, want %v", tt.root, got, tt.wantHost)
+		}
+	}
+}
@@ -12,11 +12,27 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
-var remoteHTTPClient = &http.Client{
-	Timeout: 10 * time.Minute, // FIXME: proper configuration
+var (
+	remoteHTTPClientMu sync.RWMutex
+	remoteHTTPClient   = &http.Client{Timeout: 10 * time.Minute}
+)
+
+// SetHTTPClient replaces the client used for remote downloads. It is set by
+// httpclient.SetDefault, which this package cannot import.
+func SetHTTPClient(c *http.Client) {
+	remoteHTTPClientMu.Lock()
+	defer remoteHTTPClientMu.Unlock()
+	remoteHTTPClient = c
+}
+
+func httpClient() *http.Client {
+	remoteHTTPClientMu.RLock()
+	defer remoteHTTPClientMu.RUnlock()
+	return remoteHTTPClient
 }
 
 func downloadFromRemote(ctx context.Context, url string) (io.ReadCloser, error) {
@@ -25,7 +41,7 @@ func downloadFromRemote(ctx context.Context, url string) (io.ReadCloser, error)
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	resp, err := remoteHTTPClient.Do(req) // #nosec - FIXME: harden to mitigate SSRF in the following PRs
+	resp, err := httpClient().Do(req) // #nosec - FIXME: harden to mitigate SSRF in the following PRs
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform HTTP request: %w", err)
 	}
@@ -43,6 +59,24 @@ type TarFile struct {
 	Body io.Reader
 }
 
+// RemoteContentLength returns the size the server reports for url, or -1
+// when it does not report one.
+func RemoteContentLength(ctx context.Context, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, http.NoBody)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	resp, err := httpClient().Do(req) // #nosec - FIXME: harden to mitigate SSRF in the following PRs
+	if err != nil {
+		return -1, fmt.Errorf("failed to perform HTTP request: %w", err)
+	}
+	_ = resp.Body.Close() //nolint:errcheck // body close
+	if resp.StatusCode != http.StatusOK {
+		return -1, fmt.Errorf("HEAD %q failed with status code %d", url, resp.StatusCode)
+	}
+	return resp.ContentLength, nil
+}
+
 // DecompressTarGzFromRemote returns an iterator that yields the files contained in a .tar.gz file located at the given URL.
 func DecompressTarGzFromRemote(ctx context.Context, url string) iter.Seq2[*TarFile, error] {
 	return func(yield func(*TarFile, error) bool) {
@@ -53,7 +87,31 @@ func DecompressTarGzFromRemote(ctx context.Context, url string) iter.Seq2[*TarFi
 		}
 		defer body.Close() //nolint:errcheck // body close
 
-		gzipStream, err := gzip.NewReader(body)
+		for tarFile, err := range DecompressTarGz(body) {
+			if !yield(tarFile, err) {
+				return
+			}
+		}
+	}
+}
+
+// DecompressTarGz returns an iterator that yields the regular files contained
+// in the .tar.gz stream r, enforcing the default extraction policy.
+func DecompressTarGz(r io.Reader) iter.Seq2[*TarFile, error] {
+	return DecompressTarGzWithPolicy(r, ExtractionPolicy{})
+}
+
+// DecompressTarGzWithPolicy returns an iterator that yields the regular files
+// contained in the .tar.gz stream r. Every entry is checked against policy
+// before any file is yielded for it; a violation ends the iteration with an
+// error. Directories are skipped, and links are validated but not yielded.
+//
+// The archive is decoded as it is read: each file's Body reads straight from
+// r, so memory use stays bounded regardless of the archive size. Callers
+// should stream the Body to its destination rather than buffer it.
+func DecompressTarGzWithPolicy(r io.Reader, policy ExtractionPolicy) iter.Seq2[*TarFile, error] {
+	return func(yield func(*TarFile, error) bool) {
+		gzipStream, err := gzip.NewReader(r)
 		if err != nil {
 			yield(nil, err)
 			return
@@ -61,6 +119,7 @@ func DecompressTarGzFromRemote(ctx context.Context, url string) iter.Seq2[*TarFi
 		defer gzipStream.Close() //nolint:errcheck // gzip reader close
 
 		tarReader := tar.NewReader(gzipStream)
+		limits := policy.newLimits()
 
 		for {
 			header, err := tarReader.Next()
@@ -72,17 +131,24 @@ func DecompressTarGzFromRemote(ctx context.Context, url string) iter.Seq2[*TarFi
 				return
 			}
 
-			if header.Typeflag != tar.TypeReg {
+			if header.Typeflag == tar.TypeDir {
 				continue
 			}
-
 			cleanedName, err := cleanedTarEntryName(header.Name)
 			if err != nil {
 				yield(nil, fmt.Errorf("invalid tar entry %q: %w", header.Name, err))
 				return
 			}
+			if err := limits.check(cleanedName, header); err != nil {
+				yield(nil, fmt.Errorf("tar entry %q: %w", header.Name, err))
+				return
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
 
-			if !yield(&TarFile{Name: cleanedName, Body: tarReader}, nil) {
+			tarFile := &TarFile{Name: cleanedName, Body: tarReader}
+			if !yield(tarFile, nil) {
 				return
 			}
 		}
@@ -0,0 +1,94 @@
+package utilio
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultMaxExtractedBytes bounds the total uncompressed size of an
+	// archive, so a small compressed download cannot fill the disk.
+	DefaultMaxExtractedBytes int64 = 8 * 1024 * 1024 * 1024 // 8 GiB
+	// DefaultMaxExtractedFiles bounds the number of non-directory entries in
+	// an archive.
+	DefaultMaxExtractedFiles = 100000
+)
+
+// ErrExtractionPolicy is returned when an archive entry violates the
+// extraction policy.
+var ErrExtractionPolicy = errors.New("archive violates extraction policy")
+
+// ExtractionPolicy bounds what archive extraction accepts. Device nodes and
+// FIFOs are always rejected, as are hardlinks and symlinks whose targets
+// resolve outside the extraction root. Entry modes are not passed on: callers
+// install each file with a fixed mode, so setuid and setgid bits in an
+// archive never reach the host.
+type ExtractionPolicy struct {
+	// MaxTotalBytes is the largest total uncompressed size of the regular
+	// files. Zero selects DefaultMaxExtractedBytes.
+	MaxTotalBytes int64
+	// MaxFiles is the largest number of entries other than directories.
+	// Zero selects DefaultMaxExtractedFiles.
+	MaxFiles int
+}
+
+func (p ExtractionPolicy) newLimits() *extractionLimits {
+	limits := &extractionLimits{maxBytes: p.MaxTotalBytes, maxFiles: p.MaxFiles}
+	if limits.maxBytes <= 0 {
+		limits.maxBytes = DefaultMaxExtractedBytes
+	}
+	if limits.maxFiles <= 0 {
+		limits.maxFiles = DefaultMaxExtractedFiles
+	}
+	return limits
+}
+
+// extractionLimits tracks one archive against its policy.
+type extractionLimits struct {
+	maxBytes int64
+	maxFiles int
+	bytes    int64
+	files    int
+}
+
+// check validates the entry name, already cleaned, against the policy and
+// accounts for its size.
+func (l *extractionLimits) check(name string, header *tar.Header) error {
+	l.files++
+	if l.files > l.maxFiles {
+		return fmt.Errorf("%w: more than %d entries", ErrExtractionPolicy, l.maxFiles)
+	}
+	switch header.Typeflag {
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return fmt.Errorf("%w: device node or FIFO", ErrExtractionPolicy)
+	case tar.TypeLink:
+		// Hardlink targets are archive paths relative to the root.
+		if _, err := cleanedTarEntryName(header.Linkname); err != nil {
+			return fmt.Errorf("%w: hardlink target %q is outside the extraction root", ErrExtractionPolicy, header.Linkname)
+		}
+	case tar.TypeSymlink:
+		if !symlinkStaysInside(name, header.Linkname) {
+			return fmt.Errorf("%w: symlink target %q is outside the extraction root", ErrExtractionPolicy, header.Linkname)
+		}
+	case tar.TypeReg:
+		if header.Size > l.maxBytes-l.bytes {
+			return fmt.Errorf("%w: extracted size exceeds %d bytes", ErrExtractionPolicy, l.maxBytes)
+		}
+		l.bytes += header.Size
+	}
+	return nil
+}
+
+// symlinkStaysInside reports whether a symlink at name pointing at target
+// resolves inside the extraction root. Absolute targets would resolve against
+// the host root and are rejected.
+func symlinkStaysInside(name, target string) bool {
+	if target == "" || filepath.IsAbs(target) || strings.ContainsRune(target, '\x00') {
+		return false
+	}
+	resolved := filepath.Clean(filepath.Join(filepath.Dir(name), filepath.FromSlash(target)))
+	return resolved != ".." && !strings.HasPrefix(resolved, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,168 @@
+package utilio
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+type tarEntry struct {
+	header tar.Header
+	body   string
+}
+
+func writeTarGz(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		header := entry.header
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(entry.body))
+		}
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatalf("WriteHeader(%s): %v", header.Name, err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatalf("Write(%s): %v", header.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func file(name, body string, mode int64) tarEntry {
+	return tarEntry{header: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: mode}, body: body}
+}
+
+func TestDecompressTarGzWithPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		policy  ExtractionPolicy
+		wantErr bool
+	}{
+		{
+			name: "regular files, directories, and inside links",
+			entries: []tarEntry{
+				{header: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}},
+				file("bin/tool", "tool", 0o755),
+				{header: tar.Header{Name: "bin/alias", Typeflag: tar.TypeSymlink, Linkname: "tool"}},
+				{header: tar.Header{Name: "lib/tool", Typeflag: tar.TypeSymlink, Linkname: "../bin/tool"}},
+				{header: tar.Header{Name: "bin/copy", Typeflag: tar.TypeLink, Linkname: "bin/tool"}},
+			},
+		},
+		{
+			name:    "character device",
+			entries: []tarEntry{{header: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}}},
+			wantErr: true,
+		},
+		{
+			name:    "block device",
+			entries: []tarEntry{{header: tar.Header{Name: "dev/sda", Typeflag: tar.TypeBlock, Devmajor: 8}}},
+			wantErr: true,
+		},
+		{
+			name:    "fifo",
+			entries: []tarEntry{{header: tar.Header{Name: "run/pipe", Typeflag: tar.TypeFifo}}},
+			wantErr: true,
+		},
+		{
+			name:    "hardlink outside root",
+			entries: []tarEntry{{header: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}}},
+			wantErr: true,
+		},
+		{
+			name:    "absolute symlink",
+			entries: []tarEntry{{header: tar.Header{Name: "shadow", Typeflag: tar.TypeSymlink, Linkname: "/etc/shadow"}}},
+			wantErr: true,
+		},
+		{
+			name:    "relative symlink escaping root",
+			entries: []tarEntry{{header: tar.Header{Name: "bin/escape", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}}},
+			wantErr: true,
+		},
+		{
+			name:    "total size over limit",
+			entries: []tarEntry{file("a", "12345", 0o644), file("b", "67890", 0o644)},
+			policy:  ExtractionPolicy{MaxTotalBytes: 8},
+			wantErr: true,
+		},
+		{
+			name:    "file count over limit",
+			entries: []tarEntry{file("a", "", 0o644), file("b", "", 0o644), file("c", "", 0o644)},
+			policy:  ExtractionPolicy{MaxFiles: 2},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var err error
+			for _, err = range DecompressTarGzWithPolicy(bytes.NewReader(writeTarGz(t, tt.entries...)), tt.policy) {
+				if err != nil {
+					break
+				}
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrExtractionPolicy) {
+					t.Fatalf("error = %v, want ErrExtractionPolicy", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestDecompressTarGzStreams(t *testing.T) {
+	t.Parallel()
+
+	// Random content does not compress, so the archive is as large as its
+	// files and reading all of it up front would be visible.
+	large := make([]byte, 4<<20)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	archive := writeTarGz(t, file("first", "small", 0o644), file("second", string(large), 0o644))
+	source := &countingReader{r: bytes.NewReader(archive)}
+
+	for tarFile, err := range DecompressTarGz(source) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tarFile.Name != "first" {
+			t.Fatalf("first yielded file = %s, want first", tarFile.Name)
+		}
+		if source.n >= len(archive)/2 {
+			t.Fatalf("read %d of %d archive bytes before yielding the first file, want the archive streamed", source.n, len(archive))
+		}
+		break
+	}
+}
@@ -0,0 +1,36 @@
+package utilio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ReadJSON decodes the JSON file at path into v. A missing file is not an
+// error and leaves v unchanged, so callers start from an empty record.
+//
+// NOTE: we assume the path is trusted and cleaned without path traversal characters.
+func ReadJSON(path string, v any) error {
+	data, err := os.ReadFile(path) //#nosec G304 -- trusted agent path
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteJSON writes v to path as indented JSON with a trailing newline,
+// atomically like WriteFile.
+func WriteJSON(path string, v any, perm os.FileMode) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", path, err)
+	}
+	return WriteFile(path, append(data, '\n'), perm)
+}
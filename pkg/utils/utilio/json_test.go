@@ -0,0 +1,40 @@
+package utilio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	type record struct {
+		Devices []string `json:"devices"`
+	}
+	path := filepath.Join(t.TempDir(), "state", "record.json")
+
+	got := &record{}
+	if err := ReadJSON(path, got); err != nil || got.Devices != nil {
+		t.Fatalf("ReadJSON() of a missing file = %+v, %v, want an empty record", got, err)
+	}
+
+	if err := WriteJSON(path, &record{Devices: []string{"/dev/nvme0n1"}}, 0o600); err != nil {
+		t.Fatalf("WriteJSON() = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"devices\": [\n    \"/dev/nvme0n1\"\n  ]\n}\n"; string(data) != want {
+		t.Fatalf("file = %q, want %q", data, want)
+	}
+	if err := ReadJSON(path, got); err != nil || len(got.Devices) != 1 || got.Devices[0] != "/dev/nvme0n1" {
+		t.Fatalf("ReadJSON() = %+v, %v", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadJSON(path, got); err == nil {
+		t.Fatal("ReadJSON() of a corrupt file = nil, want error")
+	}
+}
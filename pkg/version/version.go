@@ -0,0 +1,60 @@
+// Package version reports the build of the running agent. The variables are
+// set at build time through -ldflags -X; unset builds report "dev".
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information set at link time.
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the running build. Builds without ldflags, such as go install,
+// fall back to the VCS stamp the Go toolchain embeds.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitCommit == "unknown":
+				info.GitCommit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "unknown":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// UserAgent is the User-Agent the agent's HTTP clients send, for example
+// "aks-flex-node/v0.4.0 (linux/amd64; 1a2b3c4)".
+func UserAgent() string {
+	info := Get()
+	return "aks-flex-node/" + info.Version + " (" + info.Platform + "; " + info.GitCommit + ")"
+}
+
+// ApplicationID identifies the agent in the User-Agent of Azure SDK clients,
+// which truncate it to 24 characters.
+func ApplicationID() string {
+	return "aks-flex-node/" + Version
+}
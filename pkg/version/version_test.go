@@ -0,0 +1,22 @@
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	info := Get()
+	if info.Version != Version || info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Fatalf("Get() = %+v", info)
+	}
+	if info.GitCommit == "" || info.BuildTime == "" {
+		t.Fatalf("Get() = %+v, want commit and build time filled in", info)
+	}
+	if ua := UserAgent(); !strings.HasPrefix(ua, "aks-flex-node/"+Version+" (") || !strings.Contains(ua, info.Platform) {
+		t.Fatalf("UserAgent() = %q", ua)
+	}
+}
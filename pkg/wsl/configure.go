@@ -0,0 +1,101 @@
+package wsl
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/AKSFlexNode/pkg/audit"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilexec"
+	"github.com/Azure/AKSFlexNode/pkg/utils/utilio"
+	"github.com/Azure/unbounded/pkg/agent/goalstates"
+	"github.com/Azure/unbounded/pkg/agent/phases"
+)
+
+// SwapOffUnit keeps swap disabled across WSL VM restarts.
+const SwapOffUnit = "aks-flex-node-wsl-swapoff.service"
+
+//go:embed assets/aks-flex-node-wsl-swapoff.service
+var swapOffUnitContent []byte
+
+type configureHostTask struct {
+	log    *slog.Logger
+	detect func() bool
+}
+
+// ConfigureHost returns a task that applies the WSL host profile. On non-WSL
+// hosts it does nothing.
+func ConfigureHost(log *slog.Logger) phases.Task {
+	return &configureHostTask{log: log, detect: Detect}
+}
+
+func (t *configureHostTask) Name() string { return "configure-wsl-host" }
+
+// Plan returns the swap-off unit on WSL hosts.
+func (t *configureHostTask) Plan() []string {
+	if !t.detect() {
+		return nil
+	}
+	return []string{filepath.Join(goalstates.SystemdSystemDir, SwapOffUnit)}
+}
+
+func (t *configureHostTask) Do(ctx context.Context) error {
+	if !t.detect() {
+		return nil
+	}
+	t.log.Info("WSL host detected; applying WSL bootstrap profile")
+
+	unitPath := filepath.Join(goalstates.SystemdSystemDir, SwapOffUnit)
+	existing, err := os.ReadFile(unitPath) //#nosec G304 -- trusted constant path
+	if err != nil || !bytes.Equal(existing, swapOffUnitContent) {
+		before := audit.HashFile(unitPath)
+		if err := utilio.WriteFile(unitPath, swapOffUnitContent, 0o644); err != nil { //nolint:gosec // unit files must be world-readable
+			return fmt.Errorf("write %s: %w", unitPath, err)
+		}
+		audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileWrite, Target: unitPath, BeforeHash: before, AfterHash: audit.HashBytes(swapOffUnitContent)})
+		if err := utilexec.ReloadSystemd(ctx, t.log); err != nil {
+			return fmt.Errorf("systemctl daemon-reload: %w", err)
+		}
+	}
+	if err := utilexec.EnableService(ctx, t.log, SwapOffUnit); err != nil {
+		return fmt.Errorf("systemctl enable %s: %w", SwapOffUnit, err)
+	}
+	if err := utilexec.StartService(ctx, t.log, SwapOffUnit); err != nil {
+		return fmt.Errorf("systemctl start %s: %w", SwapOffUnit, err)
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationUnitStart, Target: SwapOffUnit})
+	return nil
+}
+
+type resetHostTask struct {
+	log *slog.Logger
+}
+
+// ResetHost returns a task that removes what ConfigureHost installed. It runs
+// on every host so a reset after moving a disk image out of WSL still cleans
+// up; the caller reloads systemd afterwards.
+func ResetHost(log *slog.Logger) phases.Task {
+	return &resetHostTask{log: log}
+}
+
+func (t *resetHostTask) Name() string { return "reset-wsl-host" }
+
+func (t *resetHostTask) Do(ctx context.Context) error {
+	unitPath := filepath.Join(goalstates.SystemdSystemDir, SwapOffUnit)
+	if _, err := os.Stat(unitPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := utilexec.DisableService(ctx, t.log, SwapOffUnit); err != nil {
+		t.log.Warn("failed to disable unit", "unit", SwapOffUnit, "error", err)
+	}
+	before := audit.HashFile(unitPath)
+	if err := utilexec.RemoveFileIfExists(unitPath); err != nil {
+		return err
+	}
+	audit.Record(ctx, t.log, audit.Event{Operation: audit.OperationFileRemove, Target: unitPath, BeforeHash: before})
+	return nil
+}
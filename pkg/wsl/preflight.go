@@ -0,0 +1,96 @@
+package wsl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+const (
+	systemdCheckName    = "wsl-systemd"
+	resolvConfCheckName = "wsl-resolv-conf"
+	swapCheckName       = "wsl-swap"
+
+	windowsWSLConfig = `%UserProfile%\.wslconfig`
+)
+
+// Preflight returns the WSL-specific checks, or nil on non-WSL hosts.
+func Preflight() []preflight.Checker {
+	if !Detect() {
+		return nil
+	}
+	paths := hostPaths{wslConf: WSLConfPath, resolvConf: resolvConfPath, swaps: swapsPath}
+	return []preflight.Checker{
+		systemdChecker{paths: paths},
+		resolvConfChecker{paths: paths},
+		swapChecker{paths: paths},
+	}
+}
+
+// hostPaths lets tests point the checks at fixture files.
+type hostPaths struct {
+	wslConf    string
+	resolvConf string
+	swaps      string
+}
+
+type systemdChecker struct{ paths hostPaths }
+
+func (systemdChecker) Name() string { return systemdCheckName }
+
+func (c systemdChecker) Check(context.Context) []preflight.Result {
+	cfg, err := readConf(c.paths.wslConf)
+	if err != nil {
+		return preflight.ResultsError(systemdCheckName, c.paths.wslConf, "read wsl.conf: %v", err)
+	}
+	if !cfg.boolValue("boot", "systemd", false) {
+		return preflight.ResultsError(systemdCheckName, c.paths.wslConf,
+			"systemd is not enabled; add \"[boot]\" with \"systemd=true\" and run \"wsl --shutdown\" from Windows")
+	}
+	return preflight.ResultsOK(systemdCheckName, c.paths.wslConf, "systemd is enabled")
+}
+
+type resolvConfChecker struct{ paths hostPaths }
+
+func (resolvConfChecker) Name() string { return resolvConfCheckName }
+
+// Check warns when WSL owns /etc/resolv.conf. WSL rewrites the file, or the
+// symlink into /mnt/wsl, on every distribution start, which silently undoes
+// DNS settings made for the node.
+func (c resolvConfChecker) Check(context.Context) []preflight.Result {
+	cfg, err := readConf(c.paths.wslConf)
+	if err != nil {
+		return preflight.ResultsError(resolvConfCheckName, c.paths.wslConf, "read wsl.conf: %v", err)
+	}
+	if cfg.boolValue("network", "generateResolvConf", true) {
+		return preflight.ResultsWarning(resolvConfCheckName, c.paths.resolvConf,
+			"WSL regenerates resolv.conf on every start; set \"generateResolvConf=false\" under \"[network]\" in wsl.conf and manage resolv.conf as a regular file")
+	}
+	if target, err := os.Readlink(c.paths.resolvConf); err == nil && filepath.IsAbs(target) && filepath.Dir(target) == "/mnt/wsl" {
+		return preflight.ResultsWarning(resolvConfCheckName, c.paths.resolvConf,
+			"resolv.conf still links into /mnt/wsl; replace the symlink with a regular file")
+	}
+	return preflight.ResultsOK(resolvConfCheckName, c.paths.resolvConf, "resolv.conf is not managed by WSL")
+}
+
+type swapChecker struct{ paths hostPaths }
+
+func (swapChecker) Name() string { return swapCheckName }
+
+// Check warns about active swap. Bootstrap turns it off and installs a unit
+// that does so on every WSL boot, but swap=0 in .wslconfig avoids the race
+// entirely.
+func (c swapChecker) Check(context.Context) []preflight.Result {
+	f, err := os.Open(c.paths.swaps)
+	if err != nil {
+		return preflight.ResultsWarning(swapCheckName, c.paths.swaps, "read active swap: %v", err)
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	if activeSwapCount(f) > 0 {
+		return preflight.ResultsWarning(swapCheckName, c.paths.swaps,
+			"swap is active; bootstrap disables it on every WSL start, but setting \"swap=0\" under \"[wsl2]\" in %s is recommended", windowsWSLConfig)
+	}
+	return preflight.ResultsOK(swapCheckName, c.paths.swaps, "swap is off")
+}
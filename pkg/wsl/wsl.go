@@ -0,0 +1,121 @@
+// Package wsl adapts bootstrap to hosts running under Windows Subsystem for
+// Linux 2.
+//
+// WSL differs from a regular VM in ways that break a kubelet host: systemd is
+// opt-in through /etc/wsl.conf, the utility VM re-attaches swap on every boot,
+// and WSL regenerates /etc/resolv.conf unless told not to. Detection is
+// automatic; on other hosts every check and task in this package is a no-op.
+package wsl
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	osReleasePath = "/proc/sys/kernel/osrelease"
+	// interopPath exists on WSL hosts with Windows interop enabled.
+	interopPath = "/proc/sys/fs/binfmt_misc/WSLInterop"
+
+	WSLConfPath    = "/etc/wsl.conf"
+	resolvConfPath = "/etc/resolv.conf"
+	swapsPath      = "/proc/swaps"
+)
+
+// Detect reports whether the agent runs inside a WSL 2 distribution.
+func Detect() bool {
+	if data, err := os.ReadFile(osReleasePath); err == nil && isWSLKernelRelease(string(data)) {
+		return true
+	}
+	_, err := os.Stat(interopPath)
+	return err == nil
+}
+
+// isWSLKernelRelease matches kernel releases such as
+// "5.15.153.1-microsoft-standard-WSL2".
+func isWSLKernelRelease(release string) bool {
+	release = strings.ToLower(release)
+	return strings.Contains(release, "microsoft") || strings.Contains(release, "wsl")
+}
+
+// conf is a parsed wsl.conf: section -> key -> value, with section and key
+// names lower-cased because WSL reads them case-insensitively.
+type conf map[string]map[string]string
+
+func (c conf) get(section, key string) (string, bool) {
+	v, ok := c[strings.ToLower(section)][strings.ToLower(key)]
+	return v, ok
+}
+
+// boolValue returns the boolean at section.key, or def when unset or invalid.
+func (c conf) boolValue(section, key string, def bool) bool {
+	v, ok := c.get(section, key)
+	if !ok {
+		return def
+	}
+	switch strings.ToLower(v) {
+	case "true", "1", "yes":
+		return true
+	case "false", "0", "no":
+		return false
+	default:
+		return def
+	}
+}
+
+func readConf(path string) (conf, error) {
+	f, err := os.Open(path) //#nosec G304 -- fixed system path
+	if os.IsNotExist(err) {
+		return conf{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	return parseConf(f)
+}
+
+func parseConf(r io.Reader) (conf, error) {
+	c := conf{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if i := strings.IndexAny(value, "#;"); i >= 0 {
+			value = value[:i]
+		}
+		if c[section] == nil {
+			c[section] = map[string]string{}
+		}
+		c[section][strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return c, scanner.Err()
+}
+
+// activeSwapCount returns the number of swap areas listed in /proc/swaps.
+func activeSwapCount(r io.Reader) int {
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		if n == 0 && strings.HasPrefix(scanner.Text(), "Filename") {
+			continue
+		}
+		if strings.TrimSpace(scanner.Text()) != "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package wsl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/unbounded/pkg/agent/preflight"
+)
+
+func TestIsWSLKernelRelease(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		release string
+		want    bool
+	}{
+		{release: "5.15.153.1-microsoft-standard-WSL2", want: true},
+		{release: "6.6.36.3-microsoft-standard-WSL2+", want: true},
+		{release: "6.8.0-1015-azure", want: false},
+		{release: "6.1.0-rpi7-rpi-v8", want: false},
+	}
+	for _, tt := range tests {
+		if got := isWSLKernelRelease(tt.release); got != tt.want {
+			t.Errorf("isWSLKernelRelease(%q) = %v, want %v", tt.release, got, tt.want)
+		}
+	}
+}
+
+func TestParseConf(t *testing.T) {
+	t.Parallel()
+
+	c, err := parseConf(strings.NewReader(`
+# comment
+[Boot]
+Systemd = true  # inline comment
+
+[network]
+generateResolvConf=false
+hostname="edge-wsl"
+`))
+	if err != nil {
+		t.Fatalf("parseConf: %v", err)
+	}
+	if !c.boolValue("boot", "systemd", false) {
+		t.Error("boot.systemd = false, want true")
+	}
+	if c.boolValue("network", "generateResolvConf", true) {
+		t.Error("network.generateResolvConf = true, want false")
+	}
+	if v, _ := c.get("network", "hostname"); v != "edge-wsl" {
+		t.Errorf("network.hostname = %q, want edge-wsl", v)
+	}
+	if !c.boolValue("interop", "enabled", true) {
+		t.Error("missing key did not return default")
+	}
+}
+
+func TestPreflightChecks(t *testing.T) {
+	t.Parallel()
+
+	const swapHeader = "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n"
+	tests := []struct {
+		name    string
+		wslConf string
+		swaps   string
+		checker func(hostPaths) preflight.Checker
+		want    preflight.Severity
+	}{
+		{
+			name:    "systemd enabled",
+			wslConf: "[boot]\nsystemd=true\n",
+			checker: func(p hostPaths) preflight.Checker { return systemdChecker{paths: p} },
+			want:    preflight.SeverityOK,
+		},
+		{
+			name:    "systemd missing",
+			wslConf: "[network]\nhostname=x\n",
+			checker: func(p hostPaths) preflight.Checker { return systemdChecker{paths: p} },
+			want:    preflight.SeverityError,
+		},
+		{
+			name:    "resolv.conf generated by WSL",
+			wslConf: "[boot]\nsystemd=true\n",
+			checker: func(p hostPaths) preflight.Checker { return resolvConfChecker{paths: p} },
+			want:    preflight.SeverityWarning,
+		},
+		{
+			name:    "resolv.conf owned by host",
+			wslConf: "[network]\ngenerateResolvConf=false\n",
+			checker: func(p hostPaths) preflight.Checker { return resolvConfChecker{paths: p} },
+			want:    preflight.SeverityOK,
+		},
+		{
+			name:    "swap active",
+			swaps:   swapHeader + "/dev/sdb partition 4194304 0 -2\n",
+			checker: func(p hostPaths) preflight.Checker { return swapChecker{paths: p} },
+			want:    preflight.SeverityWarning,
+		},
+		{
+			name:    "swap off",
+			swaps:   swapHeader,
+			checker: func(p hostPaths) preflight.Checker { return swapChecker{paths: p} },
+			want:    preflight.SeverityOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			paths := hostPaths{
+				wslConf:    filepath.Join(dir, "wsl.conf"),
+				resolvConf: filepath.Join(dir, "resolv.conf"),
+				swaps:      filepath.Join(dir, "swaps"),
+			}
+			for path, content := range map[string]string{paths.wslConf: tt.wslConf, paths.swaps: tt.swaps, paths.resolvConf: "nameserver 10.0.0.1\n"} {
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+			}
+
+			results := tt.checker(paths).Check(t.Context())
+			if len(results) != 1 || results[0].Severity != tt.want {
+				t.Fatalf("results = %+v, want severity %s", results, tt.want)
+			}
+		})
+	}
+}
@@ -14,7 +14,9 @@ NC='\033[0m' # No Color
 # Configuration
 REPO="Azure/AKSFlexNode"
 SERVICE_NAME="aks-flex-node"
-INSTALL_DIR="/usr/local/bin"
+# Binary directory; hosts with a read-only /usr (Flatcar, Fedora IoT) use e.g.
+# /opt/bin and set agent.binaryPath to match.
+INSTALL_DIR="${AKS_FLEX_NODE_INSTALL_DIR:-/usr/local/bin}"
 CONFIG_DIR="/etc/aks-flex-node"
 DATA_DIR="/var/lib/aks-flex-node"
 LOG_DIR="/var/log/aks-flex-node"
@@ -257,6 +259,11 @@ install_binary() {
 
     log_info "Installing binary to $INSTALL_DIR..."
 
+    mkdir -p "$INSTALL_DIR"
+    if [[ "$INSTALL_DIR/aks-flex-node" != "/usr/local/bin/aks-flex-node" ]]; then
+        log_warning "Set \"agent\": {\"binaryPath\": \"$INSTALL_DIR/aks-flex-node\"} in the config so the agent service runs this binary."
+    fi
+
     # Install binary
     cp "$binary_path" "$INSTALL_DIR/aks-flex-node"
     chmod +x "$INSTALL_DIR/aks-flex-node"
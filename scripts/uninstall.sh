@@ -12,7 +12,7 @@ BLUE='\033[0;34m'
 NC='\033[0m' # No Color
 
 # Configuration (should match install.sh)
-INSTALL_DIR="/usr/local/bin"
+INSTALL_DIR="${AKS_FLEX_NODE_INSTALL_DIR:-/usr/local/bin}"
 CONFIG_DIR="/etc/aks-flex-node"
 DATA_DIR="/var/lib/aks-flex-node"
 LOG_DIR="/var/log/aks-flex-node"